@@ -152,6 +152,7 @@ func main() {
 	app.Commands = criocli.DefaultCommands
 	app.Commands = append(app.Commands,
 		criocli.CheckCommand,
+		criocli.CheckpointCommand,
 		criocli.ConfigCommand,
 		criocli.PublishCommand,
 		criocli.StatusCommand,
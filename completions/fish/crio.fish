@@ -2,7 +2,7 @@
 
 function __fish_crio_no_subcommand --description 'Test if there has been any subcommand yet'
     for i in (commandline -opc)
-        if contains -- $i check complete completion help h config man markdown md status config c containers container cs s info i version wipe help h
+        if contains -- $i check checkpoint doctor complete completion help h config man markdown md status config c containers container cs s info i version wipe help h
             return 1
         end
     end
@@ -21,6 +21,10 @@ complete -c crio -n '__fish_crio_no_subcommand' -f -l blockio-config-file -r -d
 complete -c crio -n '__fish_crio_no_subcommand' -f -l blockio-reload -d 'Reload blockio-config-file and rescan blockio devices in the system before applying blockio parameters.'
 complete -c crio -n '__fish_crio_no_subcommand' -f -l cdi-spec-dirs -r -d 'Directories to scan for CDI Spec files.'
 complete -c crio -n '__fish_crio_no_subcommand' -f -l cgroup-manager -r -d 'cgroup manager (cgroupfs or systemd).'
+complete -c crio -n '__fish_crio_no_subcommand' -f -l checkpoint-archive-gid -r -d 'Owning group ID of checkpoint archives. -1 keeps the group of the CRI-O process.'
+complete -c crio -n '__fish_crio_no_subcommand' -f -l checkpoint-archive-mode -r -d 'Octal file mode of checkpoint archives written by CRI-O.'
+complete -c crio -n '__fish_crio_no_subcommand' -f -l checkpoint-archive-selinux-label -r -d 'SELinux label of checkpoint archives. If empty, the default label is kept.'
+complete -c crio -n '__fish_crio_no_subcommand' -f -l checkpoint-archive-uid -r -d 'Owning user ID of checkpoint archives. -1 keeps the user of the CRI-O process.'
 complete -c crio -n '__fish_crio_no_subcommand' -l clean-shutdown-file -r -d 'Location for CRI-O to lay down the clean shutdown file. It indicates whether we\'ve had time to sync changes to disk before shutting down. If not found, crio wipe will clear the storage directory.'
 complete -c crio -n '__fish_crio_no_subcommand' -l cni-config-dir -r -d 'CNI configuration files directory.'
 complete -c crio -n '__fish_crio_no_subcommand' -f -l cni-default-network -r -d 'Name of the default CNI network to select. If not set or "", then CRI-O will pick-up the first one found in --cni-config-dir.'
@@ -143,6 +147,9 @@ complete -c crio -n '__fish_crio_no_subcommand' -f -l profile-mem -r -d 'Write a
 complete -c crio -n '__fish_crio_no_subcommand' -f -l profile-port -r -d 'Port for the pprof profiler.'
 complete -c crio -n '__fish_crio_no_subcommand' -f -l rdt-config-file -r -d 'Path to the RDT configuration file for configuring the resctrl pseudo-filesystem.'
 complete -c crio -n '__fish_crio_no_subcommand' -f -l read-only -d 'Setup all unprivileged containers to run as read-only. Automatically mounts the containers\' tmpfs on \'/run\', \'/tmp\' and \'/var/tmp\'.'
+complete -c crio -n '__fish_crio_no_subcommand' -l resource-cleanup-dir -r -d 'Directory in which CRI-O persists the cleanup of sandboxes and containers whose creation timed out, so that leftovers are cleaned up when CRI-O starts after a crash. The cleanup is not persisted if empty.'
+complete -c crio -n '__fish_crio_no_subcommand' -f -l resource-cleanup-max-per-cycle -r -d 'Maximum number of stale sandboxes and containers cleaned up in a single cleanup cycle, oldest first. The remaining ones are deferred to the next cycle. Unlimited if 0.'
+complete -c crio -n '__fish_crio_no_subcommand' -f -l resource-store-timeout -r -d 'Time in seconds after which sandboxes and containers whose creation timed out and which have not been retrieved by a retry of the kubelet are cleaned up. The built-in timeouts are used if 0, otherwise it must be at least 10 seconds.'
 complete -c crio -n '__fish_crio_no_subcommand' -l root -s r -r -d 'The CRI-O root directory.'
 complete -c crio -n '__fish_crio_no_subcommand' -l runroot -r -d 'The CRI-O state directory.'
 complete -c crio -n '__fish_crio_no_subcommand' -f -l runtimes -r -d 'OCI runtimes, format is \'runtime_name:runtime_path:runtime_root:runtime_type:privileged_without_host_devices:runtime_config_path:container_min_memory\'.'
@@ -197,6 +204,10 @@ complete -c crio -n '__fish_seen_subcommand_from check' -f -l force -s f -d 'Rem
 complete -c crio -n '__fish_seen_subcommand_from check' -f -l repair -s r -d 'Remove damaged images and layers'
 complete -c crio -n '__fish_seen_subcommand_from check' -f -l quick -s q -d 'Perform only quick checks'
 complete -c crio -n '__fish_seen_subcommand_from check' -f -l wipe -s w -d 'Wipe storage directory on repair failure'
+complete -c crio -n '__fish_seen_subcommand_from checkpoint' -f -l help -s h -d 'show help'
+complete -r -c crio -n '__fish_crio_no_subcommand' -a 'checkpoint' -d 'Inspect the checkpoint/restore support of CRI-O'
+complete -c crio -n '__fish_seen_subcommand_from doctor' -f -l help -s h -d 'show help'
+complete -r -c crio -n '__fish_seen_subcommand_from checkpoint' -a 'doctor' -d 'Check the prerequisites of checkpointing and restoring containers with the configuration of CRI-O.'
 complete -c crio -n '__fish_seen_subcommand_from complete completion' -f -l help -s h -d 'show help'
 complete -r -c crio -n '__fish_crio_no_subcommand' -a 'complete completion' -d 'Generate bash, fish or zsh completions.'
 complete -c crio -n '__fish_seen_subcommand_from complete completion' -f -l help -s h -d 'show help'
@@ -0,0 +1,47 @@
+package criocli
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/cri-o/cri-o/internal/lib"
+)
+
+var CheckpointCommand = &cli.Command{
+	Name:  "checkpoint",
+	Usage: "Inspect the checkpoint/restore support of CRI-O",
+	Subcommands: []*cli.Command{{
+		Action: checkpointDoctor,
+		Name:   "doctor",
+		Usage:  "Check the prerequisites of checkpointing and restoring containers with the configuration of CRI-O.",
+	}},
+}
+
+func checkpointDoctor(c *cli.Context) error {
+	config, err := GetConfigFromContext(c)
+	if err != nil {
+		return fmt.Errorf("unable to load configuration: %w", err)
+	}
+
+	report := lib.CheckpointSelfCheck(config)
+	for _, check := range report.Checks {
+		result := "PASS"
+		switch {
+		case !check.Passed && check.Required:
+			result = "FAIL"
+		case !check.Passed:
+			result = "WARN"
+		}
+		fmt.Printf("[%s] %s: %s\n", result, check.Name, check.Message)
+		if !check.Passed && check.Remediation != "" {
+			fmt.Printf("       hint: %s\n", check.Remediation)
+		}
+	}
+
+	if !report.Passed() {
+		return errors.New("checkpoint/restore prerequisites are not met")
+	}
+	return nil
+}
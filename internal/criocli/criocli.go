@@ -293,6 +293,18 @@ func mergeConfig(config *libconfig.Config, ctx *cli.Context) error {
 	if ctx.IsSet("enable-criu-support") {
 		config.EnableCriuSupport = ctx.Bool("enable-criu-support")
 	}
+	if ctx.IsSet("checkpoint-archive-mode") {
+		config.CheckpointArchiveMode = ctx.String("checkpoint-archive-mode")
+	}
+	if ctx.IsSet("checkpoint-archive-uid") {
+		config.CheckpointArchiveUID = ctx.Int("checkpoint-archive-uid")
+	}
+	if ctx.IsSet("checkpoint-archive-gid") {
+		config.CheckpointArchiveGID = ctx.Int("checkpoint-archive-gid")
+	}
+	if ctx.IsSet("checkpoint-archive-selinux-label") {
+		config.CheckpointArchiveSELinuxLabel = ctx.String("checkpoint-archive-selinux-label")
+	}
 	if ctx.IsSet("ctr-stop-timeout") {
 		config.CtrStopTimeout = ctx.Int64("ctr-stop-timeout")
 	}
@@ -338,6 +350,15 @@ func mergeConfig(config *libconfig.Config, ctx *cli.Context) error {
 	if ctx.IsSet("clean-shutdown-file") {
 		config.CleanShutdownFile = ctx.String("clean-shutdown-file")
 	}
+	if ctx.IsSet("resource-cleanup-dir") {
+		config.ResourceCleanupDir = ctx.String("resource-cleanup-dir")
+	}
+	if ctx.IsSet("resource-cleanup-max-per-cycle") {
+		config.ResourceCleanupMaxPerCycle = ctx.Int("resource-cleanup-max-per-cycle")
+	}
+	if ctx.IsSet("resource-store-timeout") {
+		config.ResourceStoreTimeout = ctx.Int64("resource-store-timeout")
+	}
 	if ctx.IsSet("absent-mount-sources-to-reject") {
 		config.AbsentMountSourcesToReject = StringSliceTrySplit(ctx, "absent-mount-sources-to-reject")
 	}
@@ -1156,6 +1177,25 @@ func getCrioFlags(defConf *libconfig.Config) []cli.Flag {
 			EnvVars:   []string{"CONTAINER_CLEAN_SHUTDOWN_FILE"},
 			TakesFile: true,
 		},
+		&cli.StringFlag{
+			Name:      "resource-cleanup-dir",
+			Usage:     "Directory in which CRI-O persists the cleanup of sandboxes and containers whose creation timed out, so that leftovers are cleaned up when CRI-O starts after a crash. The cleanup is not persisted if empty.",
+			Value:     defConf.ResourceCleanupDir,
+			EnvVars:   []string{"CONTAINER_RESOURCE_CLEANUP_DIR"},
+			TakesFile: true,
+		},
+		&cli.IntFlag{
+			Name:    "resource-cleanup-max-per-cycle",
+			Usage:   "Maximum number of stale sandboxes and containers cleaned up in a single cleanup cycle, oldest first. The remaining ones are deferred to the next cycle. Unlimited if 0.",
+			EnvVars: []string{"CONTAINER_RESOURCE_CLEANUP_MAX_PER_CYCLE"},
+			Value:   defConf.ResourceCleanupMaxPerCycle,
+		},
+		&cli.Int64Flag{
+			Name:    "resource-store-timeout",
+			Usage:   "Time in seconds after which sandboxes and containers whose creation timed out and which have not been retrieved by a retry of the kubelet are cleaned up. The built-in timeouts are used if 0, otherwise it must be at least 10 seconds.",
+			EnvVars: []string{"CONTAINER_RESOURCE_STORE_TIMEOUT"},
+			Value:   defConf.ResourceStoreTimeout,
+		},
 		&cli.StringSliceFlag{
 			Name:    "absent-mount-sources-to-reject",
 			Value:   cli.NewStringSlice(defConf.AbsentMountSourcesToReject...),
@@ -1186,6 +1226,30 @@ func getCrioFlags(defConf *libconfig.Config) []cli.Flag {
 			EnvVars: []string{"CONTAINER_ENABLE_CRIU_SUPPORT"},
 			Value:   false,
 		},
+		&cli.StringFlag{
+			Name:    "checkpoint-archive-mode",
+			Usage:   "Octal file mode of checkpoint archives written by CRI-O.",
+			EnvVars: []string{"CONTAINER_CHECKPOINT_ARCHIVE_MODE"},
+			Value:   defConf.CheckpointArchiveMode,
+		},
+		&cli.IntFlag{
+			Name:    "checkpoint-archive-uid",
+			Usage:   "Owning user ID of checkpoint archives. -1 keeps the user of the CRI-O process.",
+			EnvVars: []string{"CONTAINER_CHECKPOINT_ARCHIVE_UID"},
+			Value:   defConf.CheckpointArchiveUID,
+		},
+		&cli.IntFlag{
+			Name:    "checkpoint-archive-gid",
+			Usage:   "Owning group ID of checkpoint archives. -1 keeps the group of the CRI-O process.",
+			EnvVars: []string{"CONTAINER_CHECKPOINT_ARCHIVE_GID"},
+			Value:   defConf.CheckpointArchiveGID,
+		},
+		&cli.StringFlag{
+			Name:    "checkpoint-archive-selinux-label",
+			Usage:   "SELinux label of checkpoint archives. If empty, the default label is kept.",
+			EnvVars: []string{"CONTAINER_CHECKPOINT_ARCHIVE_SELINUX_LABEL"},
+			Value:   defConf.CheckpointArchiveSELinuxLabel,
+		},
 		&cli.BoolFlag{
 			Name:    "enable-pod-events",
 			Usage:   "If true, CRI-O starts sending the container events to the kubelet",
@@ -2,22 +2,32 @@ package lib
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strconv"
 	"time"
 
 	metadata "github.com/checkpoint-restore/checkpointctl/lib"
 	"github.com/checkpoint-restore/go-criu/v7/stats"
+	criu "github.com/checkpoint-restore/go-criu/v7/utils"
 	"github.com/containers/common/pkg/crutils"
 	"github.com/containers/storage/pkg/archive"
+	json "github.com/json-iterator/go"
 	rspec "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/opencontainers/runtime-tools/generate"
+	selinux "github.com/opencontainers/selinux/go-selinux"
+	"golang.org/x/sys/unix"
+	kubetypes "k8s.io/kubelet/pkg/types"
 
 	"github.com/cri-o/cri-o/internal/log"
 	"github.com/cri-o/cri-o/internal/oci"
+	"github.com/cri-o/cri-o/internal/version"
 	"github.com/cri-o/cri-o/pkg/annotations"
+	libconfig "github.com/cri-o/cri-o/pkg/config"
 )
 
 // ContainerCheckpointOptions is the relevant subset of libpod.ContainerCheckpointOptions.
@@ -30,6 +40,250 @@ type ContainerCheckpointOptions struct {
 	// TargetFile tells the API to read (or write) the checkpoint image
 	// from (or to) the filename set in TargetFile
 	TargetFile string
+	// ArchiveFileMode is the file mode of the written checkpoint archive.
+	// Defaults to 0o600 if unset.
+	ArchiveFileMode os.FileMode
+	// ArchiveUID and ArchiveGID set the owner of the written checkpoint
+	// archive. The current owner is kept if nil.
+	ArchiveUID *int
+	ArchiveGID *int
+	// ArchiveSELinuxLabel is the SELinux label of the written checkpoint
+	// archive. The label is left untouched if empty.
+	ArchiveSELinuxLabel string
+	// DiagnosticOnly tells the API to only dump the process memory of the
+	// container for debugging purposes. The container is kept running and
+	// the archive contains neither the root file system changes nor the
+	// metadata needed for a restore.
+	DiagnosticOnly bool
+	// Overwrite allows replacing an existing file at TargetFile.
+	Overwrite bool
+	// ParentCheckpoint is the path of an earlier checkpoint archive of the
+	// same container. Only the memory pages changed since the parent are
+	// written to TargetFile, restoring it requires all archives of the
+	// parent chain to be unchanged at their original location.
+	ParentCheckpoint string
+	// ArchivePartSize splits the checkpoint archive into parts of at most
+	// this many bytes, which are written next to TargetFile. TargetFile then
+	// holds the manifest listing the parts. The archive is not split if zero.
+	// Parts which cannot be written to an object store are sent again.
+	ArchivePartSize int64
+	// DeviceBlocklist are the glob patterns of the device paths whose state
+	// cannot be checkpointed. Checkpointing a container they are assigned
+	// to fails with ErrCheckpointPrecondition before pausing it.
+	DeviceBlocklist []string
+	// ArchiveFormat is the format of the checkpoint archive, the native
+	// format if empty. Diagnostic checkpoints are always written in the
+	// native format.
+	ArchiveFormat string
+	// TmpfsMaxSize is the maximum size in bytes of the contents of each
+	// tmpfs mount included in the checkpoint archive. The contents are not
+	// included if zero, larger mounts fail the checkpoint.
+	TmpfsMaxSize int64
+	// GhostLimit is the maximum size in bytes of files deleted while still
+	// open which CRIU includes in the checkpoint, CRIU's default if zero.
+	// It requires the CRIU configuration file of the container, see
+	// oci.SetCriuGhostLimit.
+	GhostLimit int64
+	// Progress is called with the percentage of the checkpoint archive
+	// written so far, each time it increases. It must not block.
+	Progress func(percent int)
+
+	// archiveFormatVersion is the format version of the archive being
+	// written, which is recorded in the manifest of split archives.
+	archiveFormatVersion int
+}
+
+const (
+	// CheckpointInfoFile is the name of the CRI-O specific metadata file in
+	// the checkpoint archive.
+	CheckpointInfoFile = "crio-checkpoint.json"
+
+	// CheckpointFormatVersion is the newest version of the checkpoint
+	// archive format supported by this version of CRI-O. It has to be bumped
+	// for every change of the archive content which older versions cannot
+	// restore. Archives are written with the oldest version able to describe
+	// their content, see writeCheckpointInfo.
+	//
+	// Version 2: the root file system diff is owned by IDs inside the user
+	// namespace of the container (IDMapped).
+	//
+	// Version 3: the CRIU images only contain the changes since the parent
+	// checkpoints (Parents).
+	//
+	// The manifest of a split archive records the version of the archive,
+	// its own format is versioned by CheckpointManifestMediaType.
+	CheckpointFormatVersion = 3
+)
+
+// CheckpointInfo is the CRI-O specific metadata stored in the checkpoint archive.
+type CheckpointInfo struct {
+	// FormatVersion is the version of the archive format. Archives without
+	// a version are treated as version 1.
+	FormatVersion int `json:"formatVersion"`
+	// Diagnostic is set for memory-only checkpoints which cannot be restored.
+	Diagnostic bool `json:"diagnostic,omitempty"`
+	// IDMapped is set if the owners in the root file system diff are IDs
+	// inside the user namespace of the container instead of host IDs.
+	IDMapped bool `json:"idMapped,omitempty"`
+	// BaseImageDigest is the manifest digest of the image the container was
+	// created from. It is used to verify the base image during restore.
+	BaseImageDigest string `json:"baseImageDigest,omitempty"`
+	// Parents is the chain of checkpoints an incremental checkpoint is
+	// based on, starting with the direct parent.
+	Parents []CheckpointParent `json:"parents,omitempty"`
+	// CriuUsage is the resource usage of CRIU while dumping the container.
+	// It is informational only and not needed for a restore.
+	CriuUsage *oci.CriuResourceUsage `json:"criuUsage,omitempty"`
+	// FIFOs are the FIFOs on volumes which were open in the checkpointed
+	// processes. They are recreated on restore if missing.
+	FIFOs []CheckpointFIFO `json:"fifos,omitempty"`
+	// MemoryBytes is the size of the memory pages of the dumped processes.
+	// A restore with a lower memory limit cannot succeed.
+	MemoryBytes int64 `json:"memoryBytes,omitempty"`
+	// RestoreCount is the number of restores of the checkpointed container.
+	// It is informational only, restores of the checkpoint continue
+	// counting from it.
+	RestoreCount int `json:"restoreCount,omitempty"`
+	// ShellJob is set if the processes have been dumped as shell job, which
+	// they have to be restored as well.
+	ShellJob bool `json:"shellJob,omitempty"`
+	// CgroupMode is the cgroup version of the checkpointed node, "v1" or
+	// "v2", and ManageCgroupsMode the manage-cgroups mode of CRIU the
+	// cgroups have been dumped with.
+	CgroupMode        string `json:"cgroupMode,omitempty"`
+	ManageCgroupsMode string `json:"manageCgroupsMode,omitempty"`
+	// Tmpfs are the tmpfs mounts of the container, with their contents if
+	// they have been included.
+	Tmpfs []CheckpointTmpfs `json:"tmpfs,omitempty"`
+	// SandboxIPs are the IPs of the sandbox of the checkpointed container,
+	// which are compared with the IPs of the sandbox restored into.
+	SandboxIPs []string `json:"sandboxIPs,omitempty"`
+}
+
+var (
+	// ErrDiagnosticCheckpoint is returned when trying to restore a checkpoint
+	// which was created with DiagnosticOnly.
+	ErrDiagnosticCheckpoint = errors.New("diagnostic checkpoint, cannot restore")
+
+	// ErrCheckpointFormatTooNew is returned when the checkpoint archive has
+	// been written by a newer version of CRI-O using an unknown format.
+	ErrCheckpointFormatTooNew = errors.New("checkpoint archive format is newer than supported")
+
+	// ErrCorruptCheckpointMetadata is returned when the CRI-O specific
+	// metadata of the checkpoint archive cannot be parsed.
+	ErrCorruptCheckpointMetadata = errors.New("corrupt checkpoint metadata")
+)
+
+// ErrCheckpointArchiveExists is returned when the target file of a checkpoint
+// already exists and Overwrite is not set.
+var ErrCheckpointArchiveExists = errors.New("checkpoint archive already exists")
+
+var (
+	// ErrCheckpointUnsupportedFeature is returned if the container uses a
+	// feature which cannot be checkpointed or restored with the available
+	// CRIU.
+	ErrCheckpointUnsupportedFeature = errors.New("feature not supported by checkpoint/restore")
+
+	// ErrCheckpointPrecondition is returned if the container is not in a
+	// state which allows checkpointing it.
+	ErrCheckpointPrecondition = errors.New("checkpoint precondition failed")
+
+	// ErrCriuFailed is returned if CRIU failed to checkpoint or restore the
+	// container.
+	ErrCriuFailed = errors.New("CRIU failed")
+)
+
+// ReadCheckpointInfo reads the CRI-O specific metadata from the extracted
+// checkpoint archive in dir. Archives without this file have been written
+// before the format was versioned and are treated as regular version 1
+// checkpoints.
+func ReadCheckpointInfo(dir string) (*CheckpointInfo, error) {
+	content, err := os.ReadFile(filepath.Join(dir, CheckpointInfoFile))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return &CheckpointInfo{FormatVersion: 1}, nil
+		}
+		return nil, fmt.Errorf("failed to read %q: %w", CheckpointInfoFile, err)
+	}
+
+	info := &CheckpointInfo{}
+	if err := json.Unmarshal(content, info); err != nil {
+		return nil, fmt.Errorf("%s: %w: %w", CheckpointInfoFile, ErrCorruptCheckpointMetadata, err)
+	}
+
+	switch {
+	case info.FormatVersion == 0:
+		info.FormatVersion = 1
+	case info.FormatVersion < 0:
+		return nil, fmt.Errorf("%s: %w: invalid format version %d", CheckpointInfoFile, ErrCorruptCheckpointMetadata, info.FormatVersion)
+	case info.FormatVersion > CheckpointFormatVersion:
+		return nil, fmt.Errorf("%w: archive has version %d, supported up to %d", ErrCheckpointFormatTooNew, info.FormatVersion, CheckpointFormatVersion)
+	}
+
+	return info, nil
+}
+
+// writeCheckpointInfo writes the CRI-O specific metadata for the checkpoint
+// archive to dir.
+func writeCheckpointInfo(dir string, info *CheckpointInfo) error {
+	info.FormatVersion = 1
+	if info.IDMapped {
+		info.FormatVersion = 2
+	}
+	if len(info.Parents) > 0 {
+		info.FormatVersion = 3
+	}
+	if _, err := metadata.WriteJSONFile(info, dir, CheckpointInfoFile); err != nil {
+		return fmt.Errorf("error writing %q: %w", CheckpointInfoFile, err)
+	}
+	return nil
+}
+
+// baseImageDigest returns the manifest digest of the image the container was
+// created from or an empty string if it cannot be determined.
+func (c *ContainerServer) baseImageDigest(ctx context.Context, ctr *oci.Container) string {
+	id := ctr.ImageID()
+	if id == nil {
+		return ""
+	}
+	status, err := c.StorageImageServer().ImageStatusByID(c.config.SystemContext, *id)
+	if err != nil {
+		log.Warnf(ctx, "Unable to record base image digest of container %s: %v", ctr.ID(), err)
+		return ""
+	}
+	return status.Digest.String()
+}
+
+// effectiveCheckpointOptions validates opts and returns a copy of them with
+// all implied options set, leaving the options of the caller untouched.
+func effectiveCheckpointOptions(opts *ContainerCheckpointOptions) (*ContainerCheckpointOptions, error) {
+	effective := *opts
+	if err := libconfig.ValidateCheckpointGhostLimit(effective.GhostLimit); err != nil {
+		return nil, fmt.Errorf("invalid ghost file limit: %w", err)
+	}
+	if effective.DiagnosticOnly {
+		if effective.TargetFile == "" {
+			return nil, errors.New("diagnostic checkpoints require a target file")
+		}
+		// Diagnostic checkpoints never stop the container.
+		effective.KeepRunning = true
+	}
+	if IsRemoteCheckpointLocation(effective.TargetFile) {
+		if effective.ArchiveFormat == libconfig.CheckpointArchiveFormatOCI && !effective.DiagnosticOnly {
+			return nil, fmt.Errorf("%w: checkpoint archive format %q cannot be written to %s", ErrCheckpointUnsupportedFeature, effective.ArchiveFormat, effective.TargetFile)
+		}
+	}
+	if effective.ParentCheckpoint != "" {
+		switch {
+		case effective.TargetFile == "":
+			return nil, errors.New("incremental checkpoints require a target file")
+		case effective.DiagnosticOnly:
+			return nil, errors.New("diagnostic checkpoints cannot be incremental")
+		case filepath.Clean(effective.ParentCheckpoint) == filepath.Clean(effective.TargetFile):
+			return nil, errors.New("incremental checkpoint cannot replace its parent")
+		}
+	}
+	return &effective, nil
 }
 
 // ContainerCheckpoint checkpoints a running container.
@@ -37,7 +291,7 @@ func (c *ContainerServer) ContainerCheckpoint(
 	ctx context.Context,
 	config *metadata.ContainerConfig,
 	opts *ContainerCheckpointOptions,
-) (string, error) {
+) (_ string, retErr error) {
 	ctr, err := c.LookupContainer(ctx, config.ID)
 	if err != nil {
 		return "", fmt.Errorf("failed to find container %s: %w", config.ID, err)
@@ -51,7 +305,51 @@ func (c *ContainerServer) ContainerCheckpoint(
 
 	cStatus := ctr.State()
 	if cStatus.Status != oci.ContainerStateRunning {
-		return "", fmt.Errorf("container %s is not running", ctr.ID())
+		return "", fmt.Errorf("%w: container %s is not running", ErrCheckpointPrecondition, ctr.ID())
+	}
+
+	opts, err = effectiveCheckpointOptions(opts)
+	if err != nil {
+		return "", err
+	}
+
+	// Fail early instead of dumping the container just to find out that the
+	// archive cannot be written.
+	if IsRemoteCheckpointLocation(opts.TargetFile) {
+		if _, err := c.checkpointStore(opts.TargetFile, opts); err != nil {
+			return "", err
+		}
+	} else if opts.TargetFile != "" && !opts.Overwrite {
+		if _, err := os.Lstat(opts.TargetFile); err == nil {
+			return "", fmt.Errorf("%s: %w", opts.TargetFile, ErrCheckpointArchiveExists)
+		}
+	}
+
+	if hasIDMappings(ctr.IDMappings()) {
+		if err := checkUsernsCriuVersion(); err != nil {
+			return "", err
+		}
+	}
+	if hasTimeNamespace(specgen.Config) {
+		if err := checkTimensCriuVersion(); err != nil {
+			return "", err
+		}
+	}
+	if err := checkSysvSharedMemory(cStatus.Pid); err != nil {
+		return "", err
+	}
+	if err := checkCheckpointDevices(specgen.Config, opts.DeviceBlocklist); err != nil {
+		return "", err
+	}
+	if err := setCheckpointGhostLimit(specgen.Config, opts.GhostLimit); err != nil {
+		return "", err
+	}
+	if err := checkSharedPidNamespace(ctr.ID(), c.GetSandbox(ctr.Sandbox())); err != nil {
+		return "", err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return "", fmt.Errorf("checkpoint of container %s aborted: %w", ctr.ID(), err)
 	}
 
 	// At this point the container needs to be paused. As we first checkpoint
@@ -81,19 +379,78 @@ func (c *ContainerServer) ContainerCheckpoint(
 		if err = c.ContainerStateToDisk(ctx, ctr); err != nil {
 			log.Warnf(ctx, "Unable to write containers %s state to disk: %v", ctr.ID(), err)
 		}
+		// An aborted dump must not leave the container frozen.
+		if ctx.Err() != nil && ctr.State().Status == oci.ContainerStateRunning {
+			if err := verifyContainerThawed(ctx, ctr); err != nil {
+				retErr = errors.Join(retErr, err)
+			}
+		}
 	}()
+	// Report an unsupported runtime as such, it usually does not freeze
+	// the container through a cgroup of the host.
+	if err := c.runtime.CheckpointRestoreSupported(ctr); err != nil {
+		return "", fmt.Errorf("failed to checkpoint container %s: %w", ctr.ID(), err)
+	}
+	// Do not rely on the runtime having frozen the container, a missing
+	// freezer would otherwise silently lead to an inconsistent dump.
+	if err := verifyContainerFrozen(ctx, ctr); err != nil {
+		return "", err
+	}
+	// The processes are frozen, so no pipes are opened or closed anymore.
+	fifos, err := checkContainerPipes(cStatus.Pid, specgen.Config)
+	if err != nil {
+		return "", err
+	}
 
-	if opts.TargetFile != "" {
-		if err := c.prepareCheckpointExport(ctr); err != nil {
+	// Everything written to the directory of the container from now on is
+	// removed again if the checkpoint fails or is aborted.
+	workDir := newCheckpointWorkDir(ctr.Dir())
+	defer workDir.cleanup(ctx)
+
+	// The tmpfs mounts are gone once the container has been dumped.
+	var tmpfs []CheckpointTmpfs
+	if opts.TargetFile != "" && !opts.DiagnosticOnly {
+		defer os.RemoveAll(filepath.Join(ctr.Dir(), TmpfsCheckpointDirectory))
+		root := filepath.Join("/proc", strconv.Itoa(cStatus.Pid), "root")
+		if tmpfs, err = exportTmpfs(ctr.Dir(), root, tmpfsMounts(specgen.Config), opts.TmpfsMaxSize); err != nil {
+			return "", err
+		}
+	}
+
+	if opts.TargetFile != "" && !opts.DiagnosticOnly {
+		workDir.add(ctx, metadata.SpecDumpFile, metadata.ConfigDumpFile, "bind.mounts")
+		if err := c.prepareCheckpointExport(ctx, ctr); err != nil {
 			return "", fmt.Errorf("failed to write config dumps for container %s: %w", ctr.ID(), err)
 		}
 	}
 
+	parents, err := prepareCheckpointParents(ctx, ctr, opts.ParentCheckpoint)
+	if err != nil {
+		return "", fmt.Errorf("failed to prepare incremental checkpoint of container %s: %w", ctr.ID(), err)
+	}
+	if parents != nil {
+		defer removeCheckpointParents(ctx, ctr.Dir())
+	}
+
+	workDir.add(ctx, metadata.CheckpointDirectory)
 	if err := c.runtime.CheckpointContainer(ctx, ctr, specgen.Config, opts.KeepRunning); err != nil {
-		return "", fmt.Errorf("failed to checkpoint container %s: %w", ctr.ID(), err)
+		return "", fmt.Errorf("failed to checkpoint container %s: %w: %w", ctr.ID(), ErrCriuFailed, err)
 	}
 	if opts.TargetFile != "" {
-		if err := c.exportCheckpoint(ctx, ctr, specgen.Config, opts.TargetFile); err != nil {
+		workDir.add(ctx,
+			metadata.RootFsDiffTar,
+			metadata.DeletedFilesFile,
+			metadata.DevShmCheckpointTar,
+			annotations.LogPath,
+		)
+		info := &CheckpointInfo{
+			Parents:      parents,
+			FIFOs:        fifos,
+			RestoreCount: ctr.RestoreCount(),
+			ShellJob:     ctr.ShellJob(),
+			Tmpfs:        tmpfs,
+		}
+		if err := c.exportCheckpoint(ctx, ctr, specgen.Config, opts, info); err != nil {
 			return "", fmt.Errorf("failed to write file system changes of container %s: %w", ctr.ID(), err)
 		}
 		defer func() {
@@ -103,6 +460,9 @@ func (c *ContainerServer) ContainerCheckpoint(
 			}
 		}()
 	}
+	// The archive is written, or without target file the CRIU images in the
+	// directory of the container are the result of the checkpoint.
+	workDir.commit()
 	if !opts.KeepRunning {
 		if err := c.storageRuntimeServer.StopContainer(ctx, ctr.ID()); err != nil {
 			return "", fmt.Errorf("failed to unmount container %s: %w", ctr.ID(), err)
@@ -185,13 +545,20 @@ type ExternalBindMount struct {
 // prepareCheckpointExport writes the config and spec to
 // JSON files for later export
 // Podman: libpod/container_internal.go.
-func (c *ContainerServer) prepareCheckpointExport(ctr *oci.Container) error {
+func (c *ContainerServer) prepareCheckpointExport(ctx context.Context, ctr *oci.Container) error {
 	// save spec
 	jsonPath := filepath.Join(ctr.BundlePath(), "config.json")
 	g, err := generate.NewFromFile(jsonPath)
 	if err != nil {
 		return fmt.Errorf("generating spec for container %q failed: %w", ctr.ID(), err)
 	}
+
+	runtimeHandler := c.checkpointRuntimeHandler(ctr)
+
+	// Only the dumped spec is annotated, the bundle is not changed.
+	for key, value := range c.checkpointAnnotations(ctx, ctr, runtimeHandler) {
+		g.AddAnnotation(key, value)
+	}
 	if _, err := metadata.WriteJSONFile(g.Config, ctr.Dir(), metadata.SpecDumpFile); err != nil {
 		return fmt.Errorf("generating spec for container %q failed: %w", ctr.ID(), err)
 	}
@@ -211,15 +578,9 @@ func (c *ContainerServer) prepareCheckpointExport(ctr *oci.Container) error {
 		RootfsImageRef:  rootFSImageRef,
 		RootfsImageName: rootFSImageName,
 		CreatedTime:     ctr.CreatedAt(),
-		OCIRuntime: func() string {
-			runtimeHandler := c.GetSandbox(ctr.Sandbox()).RuntimeHandler()
-			if runtimeHandler != "" {
-				return runtimeHandler
-			}
-			return c.config.DefaultRuntime
-		}(),
-		CheckpointedAt: time.Now(),
-		Restored:       ctr.Restore(),
+		OCIRuntime:      runtimeHandler,
+		CheckpointedAt:  time.Now(),
+		Restored:        ctr.Restore(),
 	}
 
 	if _, err := metadata.WriteJSONFile(config, ctr.Dir(), metadata.ConfigDumpFile); err != nil {
@@ -273,17 +634,74 @@ func (c *ContainerServer) prepareCheckpointExport(ctr *oci.Container) error {
 	return nil
 }
 
-func (c *ContainerServer) exportCheckpoint(ctx context.Context, ctr *oci.Container, specgen *rspec.Spec, export string) error {
+// checkpointRuntimeHandler returns the runtime handler of the sandbox of ctr.
+func (c *ContainerServer) checkpointRuntimeHandler(ctr *oci.Container) string {
+	if runtimeHandler := c.GetSandbox(ctr.Sandbox()).RuntimeHandler(); runtimeHandler != "" {
+		return runtimeHandler
+	}
+	return c.config.DefaultRuntime
+}
+
+// checkpointAnnotations returns the annotations checkpointctl uses to describe
+// the origin of a checkpoint. Empty values are omitted.
+func (c *ContainerServer) checkpointAnnotations(ctx context.Context, ctr *oci.Container, runtimeHandler string) map[string]string {
+	containerName := ctr.Name()
+	if md := ctr.Metadata(); md != nil && md.Name != "" {
+		containerName = md.Name
+	}
+	values := map[string]string{
+		metadata.CheckpointAnnotationEngine:                   "CRI-O",
+		metadata.CheckpointAnnotationEngineVersion:            version.Version,
+		metadata.CheckpointAnnotationName:                     containerName,
+		metadata.CheckpointAnnotationRootfsImageUserRequested: ctr.UserRequestedImage(),
+		metadata.CheckpointAnnotationRuntimeName:              runtimeHandler,
+		metadata.CheckpointAnnotationHostArch:                 runtime.GOARCH,
+		metadata.CheckpointAnnotationCgroupVersion:            HostCgroupMode(),
+		metadata.CheckpointAnnotationRootfsImageSha:           c.baseImageDigest(ctx, ctr),
+	}
+	if sb := c.GetSandbox(ctr.Sandbox()); sb != nil {
+		values[metadata.CheckpointAnnotationPod] = sb.KubeName()
+		values[metadata.CheckpointAnnotationPodID] = sb.Labels()[kubetypes.KubernetesPodUIDLabel]
+		values[metadata.CheckpointAnnotationNamespace] = sb.Namespace()
+	}
+	if imageName := ctr.ImageName(); imageName != nil {
+		values[metadata.CheckpointAnnotationRootfsImageName] = imageName.StringForOutOfProcessConsumptionOnly()
+	}
+	if imageID := ctr.ImageID(); imageID != nil {
+		values[metadata.CheckpointAnnotationRootfsImageID] = imageID.IDStringForOutOfProcessConsumptionOnly()
+	}
+	if criuVersion, err := criu.GetCriuVersion(); err == nil {
+		values[metadata.CheckpointAnnotationCriuVersion] = strconv.Itoa(criuVersion)
+	}
+
+	result := make(map[string]string, len(values))
+	for key, value := range values {
+		if value != "" {
+			result[key] = value
+		}
+	}
+	return result
+}
+
+// exportCheckpoint writes the checkpoint archive of the container. info
+// holds the metadata known before the container was dumped, the rest is
+// filled in here.
+func (c *ContainerServer) exportCheckpoint(ctx context.Context, ctr *oci.Container, specgen *rspec.Spec, opts *ContainerCheckpointOptions, info *CheckpointInfo) error {
 	id := ctr.ID()
 	dest := ctr.Dir()
 	log.Debugf(ctx, "Exporting checkpoint image of container %q to %q", id, dest)
 
+	if opts.DiagnosticOnly {
+		return c.exportDiagnosticCheckpoint(ctx, ctr, opts)
+	}
+
 	includeFiles := []string{
 		stats.StatsDump,
 		metadata.DumpLogFile,
 		metadata.CheckpointDirectory,
 		metadata.ConfigDumpFile,
 		metadata.SpecDumpFile,
+		CheckpointInfoFile,
 		"bind.mounts",
 	}
 
@@ -300,6 +718,44 @@ func (c *ContainerServer) exportCheckpoint(ctx context.Context, ctr *oci.Contain
 	if err != nil {
 		return err
 	}
+	// The container is still frozen, so the shared memory is consistent
+	// with the dumped processes.
+	exportedDevShm, err := exportDevShm(dest, specgen)
+	if err != nil {
+		return fmt.Errorf("error exporting checkpoint of %q: %w", id, err)
+	}
+	if exportedDevShm {
+		addToTarFiles = append(addToTarFiles, metadata.DevShmCheckpointTar)
+	}
+	for _, t := range info.Tmpfs {
+		if t.Archive != "" {
+			includeFiles = append(includeFiles, TmpfsCheckpointDirectory)
+			break
+		}
+	}
+
+	info.BaseImageDigest = c.baseImageDigest(ctx, ctr)
+	info.CriuUsage = ctr.CriuUsage()
+	info.CgroupMode = HostCgroupMode()
+	// No mode is passed to the runtime, which defaults to soft.
+	info.ManageCgroupsMode = ManageCgroupsSoft
+	if sb := c.GetSandbox(ctr.Sandbox()); sb != nil {
+		info.SandboxIPs = sb.IPs()
+	}
+	if info.MemoryBytes, err = checkpointMemoryBytes(ctr.CheckpointPath()); err != nil {
+		log.Warnf(ctx, "Unable to determine the memory size of the checkpoint of %q: %v", id, err)
+	}
+	if mappings := ctr.IDMappings(); hasIDMappings(mappings) {
+		if err := shiftRootFsDiffToContainer(dest, mappings); err != nil {
+			return fmt.Errorf("error exporting root file-system diff for %q: %w", id, err)
+		}
+		info.IDMapped = true
+	}
+	if err := writeCheckpointInfo(dest, info); err != nil {
+		return fmt.Errorf("error exporting checkpoint of %q: %w", id, err)
+	}
+	opts.archiveFormatVersion = info.FormatVersion
+	defer os.Remove(filepath.Join(dest, CheckpointInfoFile))
 
 	// Put log file into checkpoint archive
 	_, err = os.Stat(specgen.Annotations[annotations.LogPath])
@@ -333,16 +789,16 @@ func (c *ContainerServer) exportCheckpoint(ctx context.Context, ctr *oci.Contain
 	if err != nil {
 		return fmt.Errorf("error reading checkpoint directory %q: %w", id, err)
 	}
-
-	// The resulting tar archive should not be readable by everyone as it contains
-	// every memory page of the checkpointed processes.
-	outFile, err := os.OpenFile(export, os.O_RDWR|os.O_CREATE, 0o600)
-	if err != nil {
-		return fmt.Errorf("error creating checkpoint export file %q: %w", export, err)
+	var reader io.Reader = input
+	if opts.Progress != nil {
+		reader = newCheckpointProgressReader(input, dest, includeFiles, opts.Progress)
 	}
-	defer outFile.Close()
 
-	_, err = io.Copy(outFile, input)
+	if opts.ArchiveFormat == libconfig.CheckpointArchiveFormatOCI {
+		err = writeOCICheckpointArchive(ctx, reader, c.checkpointAnnotations(ctx, ctr, c.checkpointRuntimeHandler(ctr)), opts)
+	} else {
+		err = c.writeCheckpointLocation(ctx, reader, opts)
+	}
 	if err != nil {
 		return err
 	}
@@ -353,3 +809,122 @@ func (c *ContainerServer) exportCheckpoint(ctx context.Context, ctr *oci.Contain
 
 	return nil
 }
+
+// exportDiagnosticCheckpoint exports only the CRIU images of the container
+// together with a marker which prevents restoring from the archive.
+func (c *ContainerServer) exportDiagnosticCheckpoint(ctx context.Context, ctr *oci.Container, opts *ContainerCheckpointOptions) error {
+	info := &CheckpointInfo{Diagnostic: true, CriuUsage: ctr.CriuUsage()}
+	if err := writeCheckpointInfo(ctr.Dir(), info); err != nil {
+		return fmt.Errorf("error exporting checkpoint of %q: %w", ctr.ID(), err)
+	}
+	opts.archiveFormatVersion = info.FormatVersion
+	defer os.Remove(filepath.Join(ctr.Dir(), CheckpointInfoFile))
+
+	input, err := archive.TarWithOptions(ctr.Dir(), &archive.TarOptions{
+		Compression:      archive.Uncompressed,
+		IncludeSourceDir: true,
+		IncludeFiles: []string{
+			stats.StatsDump,
+			metadata.DumpLogFile,
+			metadata.CheckpointDirectory,
+			CheckpointInfoFile,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("error reading checkpoint directory %q: %w", ctr.ID(), err)
+	}
+
+	return c.writeCheckpointLocation(ctx, input, opts)
+}
+
+// writeCheckpointArchive writes the archive to a temporary file next to the
+// target, applies the requested mode, ownership and SELinux label and
+// finally renames it to the target file. This way the archive only becomes
+// visible at its final location once it is complete.
+func writeCheckpointArchive(ctx context.Context, input io.Reader, opts *ContainerCheckpointOptions) error {
+	store := &localCheckpointStore{opts: opts}
+	if opts.ArchivePartSize > 0 {
+		return writeSplitCheckpointArchive(ctx, store, opts.TargetFile, input, opts)
+	}
+	return writeCheckpointStoreArchive(ctx, store, opts.TargetFile, input)
+}
+
+// linkFile is used to publish the checkpoint archive without overwriting an
+// existing file, it is replaced by tests.
+var linkFile = os.Link
+
+// setCheckpointArchiveAttributes applies the configured mode, owner and
+// SELinux label to the checkpoint archive at path.
+func setCheckpointArchiveAttributes(ctx context.Context, path string, opts *ContainerCheckpointOptions) error {
+	// The resulting tar archive should not be readable by everyone as it contains
+	// every memory page of the checkpointed processes.
+	mode := opts.ArchiveFileMode
+	if mode == 0 {
+		mode = 0o600
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		return fmt.Errorf("error setting mode of checkpoint export file %q: %w", path, err)
+	}
+
+	if opts.ArchiveUID != nil || opts.ArchiveGID != nil {
+		uid, gid := -1, -1
+		if opts.ArchiveUID != nil {
+			uid = *opts.ArchiveUID
+		}
+		if opts.ArchiveGID != nil {
+			gid = *opts.ArchiveGID
+		}
+		if err := os.Chown(path, uid, gid); err != nil {
+			return fmt.Errorf("error setting owner of checkpoint export file %q: %w", path, err)
+		}
+	}
+
+	if opts.ArchiveSELinuxLabel != "" {
+		if err := selinux.SetFileLabel(path, opts.ArchiveSELinuxLabel); err != nil {
+			if !errors.Is(err, unix.ENOTSUP) {
+				return fmt.Errorf("error labeling checkpoint export file %q: %w", path, err)
+			}
+			log.Warnf(ctx, "Unable to label checkpoint export file %s: %v", path, err)
+		}
+	}
+
+	return nil
+}
+
+// copyCheckpointArchive copies the checkpoint archive src to the new file
+// dst, failing with ErrCheckpointArchiveExists if dst already exists.
+func copyCheckpointArchive(ctx context.Context, src, dst string, opts *ContainerCheckpointOptions) (retErr error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("error opening checkpoint export file %q: %w", src, err)
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("%s: %w", dst, ErrCheckpointArchiveExists)
+		}
+		return fmt.Errorf("error creating checkpoint export file %q: %w", dst, err)
+	}
+	defer func() {
+		if retErr != nil {
+			if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
+				log.Warnf(ctx, "Unable to remove partial checkpoint archive %s: %v", dst, err)
+			}
+		}
+	}()
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return fmt.Errorf("error copying checkpoint export file to %q: %w", dst, err)
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return fmt.Errorf("error syncing checkpoint export file %q: %w", dst, err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("error closing checkpoint export file %q: %w", dst, err)
+	}
+	return setCheckpointArchiveAttributes(ctx, dst, opts)
+}
@@ -0,0 +1,63 @@
+package lib
+
+import (
+	"context"
+	"time"
+
+	metadata "github.com/checkpoint-restore/checkpointctl/lib"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+	"go.uber.org/mock/gomock"
+	types "k8s.io/cri-api/pkg/apis/runtime/v1"
+	kubetypes "k8s.io/kubelet/pkg/types"
+
+	"github.com/cri-o/cri-o/internal/lib/sandbox"
+	"github.com/cri-o/cri-o/internal/oci"
+	"github.com/cri-o/cri-o/internal/storage"
+	libconfig "github.com/cri-o/cri-o/pkg/config"
+	criostoragemock "github.com/cri-o/cri-o/test/mocks/criostorage"
+)
+
+var _ = Describe("CheckpointAnnotations", func() {
+	It("should describe the container, its pod and its image", func() {
+		// Given
+		const podUID = "8f3c2c1e-5a4e-4d4b-9b1e-6f1f3c1e2d3a"
+		imageDigest := digest.FromString("manifest")
+		imageID, err := storage.ParseStorageImageIDFromOutOfProcessData("8a788232037eaf17794408ff3df6b922a1aedf9ef8de36afdae3ed0b0381907b")
+		Expect(err).ToNot(HaveOccurred())
+
+		imageServer := criostoragemock.NewMockImageServer(gomock.NewController(GinkgoT()))
+		imageServer.EXPECT().ImageStatusByID(gomock.Any(), imageID).Return(&storage.ImageResult{ID: imageID, Digest: imageDigest}, nil)
+		c := &ContainerServer{
+			storageImageServer: imageServer,
+			state:              &containerServerState{sandboxes: sandbox.NewMemoryStore()},
+			config:             &libconfig.Config{},
+		}
+
+		sb, err := sandbox.New("sandbox-id", "namespace", "name", "kube-name", "",
+			map[string]string{kubetypes.KubernetesPodUIDLabel: podUID}, nil, "", "",
+			&types.PodSandboxMetadata{}, "", "", false, "", "", "", nil, false, time.Now(), "", nil, nil)
+		Expect(err).ToNot(HaveOccurred())
+		c.state.sandboxes.Add(sb.ID(), sb)
+
+		ctr, err := oci.NewContainer("container-id", "k8s_ctr", "", "", nil, nil, nil, "image", nil, &imageID, "",
+			&types.ContainerMetadata{Name: "ctr"}, sb.ID(), false, false, false, "", "", time.Now(), "")
+		Expect(err).ToNot(HaveOccurred())
+
+		// When
+		values := c.checkpointAnnotations(context.Background(), ctr, "runc")
+
+		// Then
+		Expect(values).To(And(
+			HaveKeyWithValue(metadata.CheckpointAnnotationEngine, "CRI-O"),
+			HaveKeyWithValue(metadata.CheckpointAnnotationName, "ctr"),
+			HaveKeyWithValue(metadata.CheckpointAnnotationPod, "kube-name"),
+			HaveKeyWithValue(metadata.CheckpointAnnotationPodID, podUID),
+			HaveKeyWithValue(metadata.CheckpointAnnotationNamespace, "namespace"),
+			HaveKeyWithValue(metadata.CheckpointAnnotationRuntimeName, "runc"),
+			HaveKeyWithValue(metadata.CheckpointAnnotationRootfsImageID, imageID.IDStringForOutOfProcessConsumptionOnly()),
+			HaveKeyWithValue(metadata.CheckpointAnnotationRootfsImageSha, imageDigest.String()),
+		))
+	})
+})
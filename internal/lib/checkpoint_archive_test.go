@@ -0,0 +1,132 @@
+package lib
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	selinux "github.com/opencontainers/selinux/go-selinux"
+	"golang.org/x/sys/unix"
+)
+
+// testDirEntries returns the sorted names of the files in dir.
+func testDirEntries(dir string) []string {
+	entries, err := os.ReadDir(dir)
+	Expect(err).ToNot(HaveOccurred())
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+var _ = Describe("CheckpointArchive", func() {
+	var target string
+
+	BeforeEach(func() {
+		target = filepath.Join(GinkgoT().TempDir(), "checkpoint.tar")
+	})
+
+	It("should set the attributes of the archive", func() {
+		// Given
+		uid, gid := os.Getuid(), os.Getgid()
+		if uid == 0 {
+			// Only root can hand the archive to another user.
+			uid, gid = 1000, 1000
+		}
+		opts := &ContainerCheckpointOptions{
+			TargetFile:      target,
+			ArchiveFileMode: 0o640,
+			ArchiveUID:      &uid,
+			ArchiveGID:      &gid,
+		}
+		label := ""
+		if selinux.GetEnabled() {
+			label = "system_u:object_r:container_file_t:s0"
+			opts.ArchiveSELinuxLabel = label
+		}
+
+		// When
+		Expect(writeCheckpointArchive(context.Background(), strings.NewReader("archive"), opts)).To(Succeed())
+
+		// Then
+		info, err := os.Stat(target)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0o640)))
+		stat, ok := info.Sys().(*syscall.Stat_t)
+		Expect(ok).To(BeTrue())
+		Expect(int(stat.Uid)).To(Equal(uid))
+		Expect(int(stat.Gid)).To(Equal(gid))
+		if label != "" {
+			Expect(selinux.FileLabel(target)).To(Equal(label))
+		}
+	})
+
+	It("should default to mode 0600", func() {
+		// When
+		Expect(writeCheckpointArchive(context.Background(), strings.NewReader("archive"), &ContainerCheckpointOptions{TargetFile: target})).To(Succeed())
+
+		// Then
+		info, err := os.Stat(target)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0o600)))
+	})
+
+	It("should not replace an existing archive", func() {
+		// Given
+		opts := &ContainerCheckpointOptions{TargetFile: target}
+		Expect(writeCheckpointArchive(context.Background(), strings.NewReader("archive"), opts)).To(Succeed())
+		Expect(testDirEntries(filepath.Dir(target))).To(Equal([]string{"checkpoint.tar"}))
+
+		// When
+		err := writeCheckpointArchive(context.Background(), strings.NewReader("second"), opts)
+
+		// Then
+		Expect(err).To(MatchError(ErrCheckpointArchiveExists))
+		Expect(os.ReadFile(target)).To(BeEquivalentTo("archive"))
+	})
+
+	DescribeTable("should fall back to copying the archive if it cannot be linked",
+		func(linkErr error) {
+			// Given
+			linkFile = func(oldname, newname string) error {
+				return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: linkErr}
+			}
+			DeferCleanup(func() { linkFile = os.Link })
+			opts := &ContainerCheckpointOptions{TargetFile: target, ArchiveFileMode: 0o640}
+
+			// When
+			Expect(writeCheckpointArchive(context.Background(), strings.NewReader("archive"), opts)).To(Succeed())
+
+			// Then
+			Expect(os.ReadFile(target)).To(BeEquivalentTo("archive"))
+			info, err := os.Stat(target)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0o640)))
+			Expect(testDirEntries(filepath.Dir(target))).To(HaveLen(1))
+
+			err = writeCheckpointArchive(context.Background(), strings.NewReader("second"), opts)
+			Expect(err).To(MatchError(ErrCheckpointArchiveExists))
+			Expect(testDirEntries(filepath.Dir(target))).To(HaveLen(1))
+		},
+		Entry("across file systems", unix.EXDEV),
+		Entry("without permission", unix.EPERM),
+		Entry("without support", unix.ENOTSUP),
+	)
+
+	It("should replace an existing archive if requested", func() {
+		// Given
+		Expect(os.WriteFile(target, []byte("existing"), 0o600)).To(Succeed())
+		opts := &ContainerCheckpointOptions{TargetFile: target, Overwrite: true}
+
+		// When
+		Expect(writeCheckpointArchive(context.Background(), strings.NewReader("archive"), opts)).To(Succeed())
+
+		// Then
+		Expect(os.ReadFile(target)).To(BeEquivalentTo("archive"))
+	})
+})
@@ -0,0 +1,68 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cri-o/cri-o/internal/config/node"
+)
+
+// The manage-cgroups modes of CRIU which can be chosen for a restore.
+const (
+	// ManageCgroupsSoft restores the properties of the cgroups CRIU
+	// creates and leaves existing cgroups alone. It is the default of
+	// runc and crun, also for checkpoints.
+	ManageCgroupsSoft = "soft"
+	// ManageCgroupsFull restores the properties of all cgroups.
+	ManageCgroupsFull = "full"
+	// ManageCgroupsIgnore neither dumps nor restores cgroups, the runtime
+	// sets them up from the spec of the restored container.
+	ManageCgroupsIgnore = "ignore"
+)
+
+// ErrIncompatibleCgroupMode is returned if a checkpoint cannot be restored
+// with the requested manage-cgroups mode, because the cgroup version of the
+// node differs from the one of the checkpointed node.
+var ErrIncompatibleCgroupMode = errors.New("checkpoint cannot be restored with the cgroup setup of this node")
+
+// HostCgroupMode returns the cgroup version of the node, "v1" or "v2".
+func HostCgroupMode() string {
+	if node.CgroupIsV2() {
+		return "v2"
+	}
+	return "v1"
+}
+
+// RestoreManageCgroupsMode returns the manage-cgroups mode to restore the
+// checkpoint described by info with on a node with hostCgroupMode. requested
+// is the mode chosen for the restore, if any. An empty result leaves the
+// choice to the runtime.
+//
+// The cgroup properties in a checkpoint only apply to the cgroup version
+// they have been dumped on, so checkpoints of a node with another cgroup
+// version can only be restored ignoring them, which is the default then.
+// Checkpoints dumped ignoring the cgroups cannot be restored in full mode.
+func RestoreManageCgroupsMode(info *CheckpointInfo, requested, hostCgroupMode string) (string, error) {
+	switch requested {
+	case "", ManageCgroupsSoft, ManageCgroupsFull, ManageCgroupsIgnore:
+	default:
+		return "", fmt.Errorf("invalid manage-cgroups mode %q: must be %s, %s or %s",
+			requested, ManageCgroupsSoft, ManageCgroupsFull, ManageCgroupsIgnore)
+	}
+	if info.CgroupMode == "" {
+		// The checkpoint predates recording the cgroup version.
+		return requested, nil
+	}
+	if info.CgroupMode != hostCgroupMode {
+		if requested == "" || requested == ManageCgroupsIgnore {
+			return ManageCgroupsIgnore, nil
+		}
+		return "", fmt.Errorf("%w: checkpoint has been created with cgroup %s, this node uses cgroup %s, which requires the manage-cgroups mode %s instead of %s",
+			ErrIncompatibleCgroupMode, info.CgroupMode, hostCgroupMode, ManageCgroupsIgnore, requested)
+	}
+	if requested == ManageCgroupsFull && info.ManageCgroupsMode == ManageCgroupsIgnore {
+		return "", fmt.Errorf("%w: checkpoint has been created with the manage-cgroups mode %s and holds no cgroup properties to restore in mode %s",
+			ErrIncompatibleCgroupMode, ManageCgroupsIgnore, ManageCgroupsFull)
+	}
+	return requested, nil
+}
@@ -0,0 +1,51 @@
+package lib
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CheckpointCgroups", func() {
+	It("should record the cgroup mode in the checkpoint info", func() {
+		// Given
+		dir := GinkgoT().TempDir()
+
+		// When
+		Expect(writeCheckpointInfo(dir, &CheckpointInfo{CgroupMode: "v1", ManageCgroupsMode: ManageCgroupsSoft})).To(Succeed())
+
+		// Then
+		info, err := ReadCheckpointInfo(dir)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.CgroupMode).To(Equal("v1"))
+		Expect(info.ManageCgroupsMode).To(Equal(ManageCgroupsSoft))
+	})
+
+	DescribeTable("RestoreManageCgroupsMode",
+		func(cgroupMode, dumpMode, requested, expected string) {
+			info := &CheckpointInfo{CgroupMode: cgroupMode, ManageCgroupsMode: dumpMode}
+			Expect(RestoreManageCgroupsMode(info, requested, "v2")).To(Equal(expected))
+		},
+		Entry("same version, default", "v2", ManageCgroupsSoft, "", ""),
+		Entry("same version, full", "v2", ManageCgroupsSoft, ManageCgroupsFull, ManageCgroupsFull),
+		Entry("same version, ignore", "v2", ManageCgroupsSoft, ManageCgroupsIgnore, ManageCgroupsIgnore),
+		Entry("other version, default", "v1", ManageCgroupsSoft, "", ManageCgroupsIgnore),
+		Entry("other version, ignore", "v1", ManageCgroupsSoft, ManageCgroupsIgnore, ManageCgroupsIgnore),
+		Entry("unknown version", "", "", ManageCgroupsFull, ManageCgroupsFull),
+	)
+
+	DescribeTable("RestoreManageCgroupsMode should fail for incompatible modes",
+		func(cgroupMode, dumpMode, requested string) {
+			info := &CheckpointInfo{CgroupMode: cgroupMode, ManageCgroupsMode: dumpMode}
+			_, err := RestoreManageCgroupsMode(info, requested, "v2")
+			Expect(err).To(MatchError(ErrIncompatibleCgroupMode))
+		},
+		Entry("same version, full without properties", "v2", ManageCgroupsIgnore, ManageCgroupsFull),
+		Entry("other version, soft", "v1", ManageCgroupsSoft, ManageCgroupsSoft),
+		Entry("other version, full", "v1", ManageCgroupsSoft, ManageCgroupsFull),
+	)
+
+	It("should fail for an invalid mode", func() {
+		_, err := RestoreManageCgroupsMode(&CheckpointInfo{CgroupMode: "v2"}, "strict", "v2")
+		Expect(err).To(HaveOccurred())
+	})
+})
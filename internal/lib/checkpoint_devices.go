@@ -0,0 +1,40 @@
+package lib
+
+import (
+	"fmt"
+	"path/filepath"
+
+	rspec "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// checkCheckpointDevices fails if a device assigned to the container, either
+// as device node or as bind mount from the host, matches one of the glob
+// patterns of the blocklist. CRIU cannot dump the state of such devices and
+// would only fail deep into the checkpoint.
+func checkCheckpointDevices(spec *rspec.Spec, blocklist []string) error {
+	if len(blocklist) == 0 {
+		return nil
+	}
+	var devices []string
+	if spec.Linux != nil {
+		for i := range spec.Linux.Devices {
+			devices = append(devices, spec.Linux.Devices[i].Path)
+		}
+	}
+	for _, m := range spec.Mounts {
+		if m.Type == bindMount {
+			devices = append(devices, m.Source)
+		}
+	}
+	for _, device := range devices {
+		for _, pattern := range blocklist {
+			if matched, _ := filepath.Match(pattern, filepath.Clean(device)); matched {
+				return fmt.Errorf(
+					"%w: device %s blocks checkpointing the container, as its state cannot be checkpointed (matches %q of checkpoint_device_blocklist, which can be removed if a CRIU plugin handles the device)",
+					ErrCheckpointPrecondition, device, pattern,
+				)
+			}
+		}
+	}
+	return nil
+}
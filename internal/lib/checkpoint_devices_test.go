@@ -0,0 +1,35 @@
+package lib
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	rspec "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+var _ = Describe("CheckpointDevices", func() {
+	blocklist := []string{"/dev/nvidia*", "/dev/dri/*", "/dev/fuse"}
+
+	DescribeTable("should accept containers without blocked devices",
+		func(spec *rspec.Spec) {
+			Expect(checkCheckpointDevices(spec, blocklist)).To(Succeed())
+		},
+		Entry("no devices", &rspec.Spec{}),
+		Entry("allowed device", &rspec.Spec{Linux: &rspec.Linux{Devices: []rspec.LinuxDevice{{Path: "/dev/net/tun"}}}}),
+		Entry("device path of other mount type", &rspec.Spec{Mounts: []rspec.Mount{{Destination: "/dev/dri", Type: "tmpfs", Source: "/dev/dri/card0"}}}),
+	)
+
+	DescribeTable("should reject containers with blocked devices",
+		func(spec *rspec.Spec, device string) {
+			err := checkCheckpointDevices(spec, blocklist)
+			Expect(err).To(MatchError(ErrCheckpointPrecondition))
+			Expect(err.Error()).To(ContainSubstring(device))
+		},
+		Entry("blocked device node", &rspec.Spec{Linux: &rspec.Linux{Devices: []rspec.LinuxDevice{{Path: "/dev/null"}, {Path: "/dev/nvidia0"}}}}, "/dev/nvidia0"),
+		Entry("blocked device bind mount", &rspec.Spec{Mounts: []rspec.Mount{{Destination: "/dev/fuse", Type: bindMount, Source: "/dev/fuse"}}}, "/dev/fuse"),
+	)
+
+	It("should accept all devices without blocklist", func() {
+		spec := &rspec.Spec{Linux: &rspec.Linux{Devices: []rspec.LinuxDevice{{Path: "/dev/nvidia0"}}}}
+		Expect(checkCheckpointDevices(spec, nil)).To(Succeed())
+	})
+})
@@ -0,0 +1,133 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	libctrcgroups "github.com/opencontainers/runc/libcontainer/cgroups"
+
+	"github.com/cri-o/cri-o/internal/config/node"
+	"github.com/cri-o/cri-o/internal/log"
+	"github.com/cri-o/cri-o/internal/oci"
+)
+
+// The locations of the cgroup hierarchies, replaced in tests by fake trees.
+var (
+	// procRoot is the mount point of procfs.
+	procRoot = "/proc"
+	// cgroupV2Root is the mount point of the unified cgroup hierarchy.
+	cgroupV2Root = "/sys/fs/cgroup"
+	// cgroupIsV2 reports whether the unified cgroup hierarchy is used.
+	cgroupIsV2 = node.CgroupIsV2
+	// freezerMountpoint returns the mount point of the cgroup v1 freezer.
+	freezerMountpoint = func() (string, error) {
+		return libctrcgroups.FindCgroupMountpoint("", "freezer")
+	}
+)
+
+// ErrFreezerUnavailable is returned when a container cannot be checkpointed
+// because its processes cannot be frozen with the cgroup freezer.
+var ErrFreezerUnavailable = errors.New("cgroup freezer not available")
+
+// errContainerNoProcess is returned by containerFrozen if the container has
+// no process whose cgroup could be inspected.
+var errContainerNoProcess = errors.New("container has no process")
+
+// verifyContainerFrozen ensures that the processes of the paused container
+// are frozen, so that CRIU does not dump an inconsistent state.
+// On cgroup v2 freezing is part of the core interface of every cgroup,
+// while on cgroup v1 it requires the separate freezer controller.
+func verifyContainerFrozen(ctx context.Context, ctr *oci.Container) error {
+	frozen, err := containerFrozen(ctr)
+	if errors.Is(err, errContainerNoProcess) {
+		// Without a process there is nothing to freeze and the
+		// runtime fails to checkpoint the container anyway.
+		log.Debugf(ctx, "Unable to verify freezer state of container %s: %v", ctr.ID(), err)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to checkpoint container %s: %w", ctr.ID(), err)
+	}
+	if !frozen {
+		return fmt.Errorf("%w: container %s is not frozen after pausing it, refusing to checkpoint it", ErrCheckpointPrecondition, ctr.ID())
+	}
+	return nil
+}
+
+// verifyContainerThawed ensures that the processes of the container are not
+// left frozen after its checkpoint has been aborted.
+func verifyContainerThawed(ctx context.Context, ctr *oci.Container) error {
+	frozen, err := containerFrozen(ctr)
+	if err != nil {
+		log.Debugf(ctx, "Unable to verify freezer state of container %s: %v", ctr.ID(), err)
+		return nil
+	}
+	if frozen {
+		return fmt.Errorf("container %s is still frozen after aborting its checkpoint", ctr.ID())
+	}
+	return nil
+}
+
+// containerFrozen reads the freezer state of the cgroup of the container.
+func containerFrozen(ctr *oci.Container) (bool, error) {
+	pid, err := ctr.Pid()
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", errContainerNoProcess, err)
+	}
+	cgroups, err := libctrcgroups.ParseCgroupFile(filepath.Join(procRoot, strconv.Itoa(pid), "cgroup"))
+	if err != nil {
+		return false, fmt.Errorf("failed to read cgroup of container %s: %w", ctr.ID(), err)
+	}
+
+	if cgroupIsV2() {
+		return cgroupV2Frozen(filepath.Join(cgroupV2Root, cgroups[""]))
+	}
+	return cgroupV1Frozen(cgroups["freezer"])
+}
+
+// cgroupV2Frozen reads the frozen state of the cgroup v2 directory dir.
+func cgroupV2Frozen(dir string) (bool, error) {
+	if _, err := os.Stat(filepath.Join(dir, "cgroup.freeze")); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, fmt.Errorf("%w: %s does not support freezing", ErrFreezerUnavailable, dir)
+		}
+		return false, err
+	}
+	events, err := os.ReadFile(filepath.Join(dir, "cgroup.events"))
+	if err != nil {
+		return false, err
+	}
+	for _, line := range strings.Split(string(events), "\n") {
+		if key, value, ok := strings.Cut(line, " "); ok && key == "frozen" {
+			return value == "1", nil
+		}
+	}
+	return false, fmt.Errorf("no frozen state in %s", filepath.Join(dir, "cgroup.events"))
+}
+
+// cgroupV1Frozen reads the state of the freezer controller for the cgroup
+// path relative to the freezer hierarchy.
+func cgroupV1Frozen(path string) (bool, error) {
+	if path == "" {
+		return false, fmt.Errorf("%w: freezer controller not enabled", ErrFreezerUnavailable)
+	}
+	mountPoint, err := freezerMountpoint()
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", ErrFreezerUnavailable, err)
+	}
+	return freezerStateFrozen(filepath.Join(mountPoint, path))
+}
+
+// freezerStateFrozen reads the state of the cgroup v1 freezer directory dir.
+func freezerStateFrozen(dir string) (bool, error) {
+	state, err := os.ReadFile(filepath.Join(dir, "freezer.state"))
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(string(state)) == "FROZEN", nil
+}
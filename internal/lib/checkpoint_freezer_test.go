@@ -0,0 +1,129 @@
+package lib
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	types "k8s.io/cri-api/pkg/apis/runtime/v1"
+
+	"github.com/cri-o/cri-o/internal/oci"
+)
+
+// newCheckpointTestContainer returns a container with the given id whose
+// directory is a temporary directory.
+func newCheckpointTestContainer(id string) *oci.Container {
+	ctr, err := oci.NewContainer(id, "k8s_ctr", "", "", nil, nil, nil, "image", nil, nil, "",
+		&types.ContainerMetadata{Name: "ctr"}, "sandbox-id", false, false, false, "", GinkgoT().TempDir(), time.Now(), "")
+	Expect(err).ToNot(HaveOccurred())
+	return ctr
+}
+
+// fakeFreezerContainer returns a container running as the test process whose
+// cgroup is read from a fake tree containing files. The hierarchies used by
+// verifyContainerFrozen are redirected to the tree until the spec ends.
+func fakeFreezerContainer(v2 bool, files map[string]string) *oci.Container {
+	root := GinkgoT().TempDir()
+	pid := os.Getpid()
+
+	procDir := filepath.Join(root, "proc", strconv.Itoa(pid))
+	Expect(os.MkdirAll(procDir, 0o755)).To(Succeed())
+	cgroup := "4:freezer:/kubepods/ctr\n"
+	if v2 {
+		cgroup = "0::/kubepods/ctr\n"
+	}
+	Expect(os.WriteFile(filepath.Join(procDir, "cgroup"), []byte(cgroup), 0o644)).To(Succeed())
+	cgroupDir := filepath.Join(root, "cgroup", "kubepods", "ctr")
+	Expect(os.MkdirAll(cgroupDir, 0o755)).To(Succeed())
+	for name, content := range files {
+		Expect(os.WriteFile(filepath.Join(cgroupDir, name), []byte(content), 0o644)).To(Succeed())
+	}
+
+	oldProcRoot, oldCgroupV2Root, oldCgroupIsV2, oldFreezerMountpoint := procRoot, cgroupV2Root, cgroupIsV2, freezerMountpoint
+	DeferCleanup(func() {
+		procRoot, cgroupV2Root, cgroupIsV2, freezerMountpoint = oldProcRoot, oldCgroupV2Root, oldCgroupIsV2, oldFreezerMountpoint
+	})
+	procRoot = filepath.Join(root, "proc")
+	cgroupV2Root = filepath.Join(root, "cgroup")
+	cgroupIsV2 = func() bool { return v2 }
+	freezerMountpoint = func() (string, error) { return filepath.Join(root, "cgroup"), nil }
+
+	ctr := newCheckpointTestContainer("container-id")
+	state := &oci.ContainerState{State: specs.State{Status: oci.ContainerStatePaused, Pid: pid}}
+	Expect(state.SetInitPid(pid)).To(Succeed())
+	ctr.SetState(state)
+	return ctr
+}
+
+var _ = Describe("CheckpointFreezer", func() {
+	DescribeTable("cgroupV2Frozen",
+		func(events string, frozen bool) {
+			dir := GinkgoT().TempDir()
+			Expect(os.WriteFile(filepath.Join(dir, "cgroup.freeze"), []byte("1\n"), 0o644)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(dir, "cgroup.events"), []byte(events), 0o644)).To(Succeed())
+			Expect(cgroupV2Frozen(dir)).To(Equal(frozen))
+		},
+		Entry("frozen", "populated 1\nfrozen 1\n", true),
+		Entry("not frozen", "populated 1\nfrozen 0\n", false),
+	)
+
+	It("should fail on cgroup v2 without freezer", func() {
+		_, err := cgroupV2Frozen(GinkgoT().TempDir())
+		Expect(err).To(MatchError(ErrFreezerUnavailable))
+	})
+
+	It("should fail on cgroup v1 without freezer", func() {
+		_, err := cgroupV1Frozen("")
+		Expect(err).To(MatchError(ErrFreezerUnavailable))
+	})
+
+	DescribeTable("freezerStateFrozen",
+		func(state string, frozen bool) {
+			dir := GinkgoT().TempDir()
+			Expect(os.WriteFile(filepath.Join(dir, "freezer.state"), []byte(state), 0o644)).To(Succeed())
+			Expect(freezerStateFrozen(dir)).To(Equal(frozen))
+		},
+		Entry("frozen", "FROZEN\n", true),
+		Entry("freezing", "FREEZING\n", false),
+		Entry("thawed", "THAWED\n", false),
+	)
+
+	DescribeTable("verifyContainerFrozen",
+		func(v2 bool, files map[string]string, frozen bool) {
+			// Given
+			ctr := fakeFreezerContainer(v2, files)
+
+			// When
+			frozenErr := verifyContainerFrozen(context.Background(), ctr)
+			thawedErr := verifyContainerThawed(context.Background(), ctr)
+
+			// Then
+			if frozen {
+				Expect(frozenErr).ToNot(HaveOccurred())
+				Expect(thawedErr).To(HaveOccurred())
+			} else {
+				Expect(frozenErr).To(HaveOccurred())
+				Expect(thawedErr).ToNot(HaveOccurred())
+			}
+		},
+		Entry("cgroup v2 frozen", true, map[string]string{"cgroup.freeze": "1\n", "cgroup.events": "populated 1\nfrozen 1\n"}, true),
+		Entry("cgroup v2 not frozen", true, map[string]string{"cgroup.freeze": "0\n", "cgroup.events": "populated 1\nfrozen 0\n"}, false),
+		Entry("cgroup v1 frozen", false, map[string]string{"freezer.state": "FROZEN\n"}, true),
+		Entry("cgroup v1 not frozen", false, map[string]string{"freezer.state": "THAWED\n"}, false),
+	)
+
+	DescribeTable("verifyContainerFrozen should fail without freezer",
+		func(v2 bool) {
+			// Neither cgroup.freeze nor freezer.state exist.
+			ctr := fakeFreezerContainer(v2, nil)
+			Expect(verifyContainerFrozen(context.Background(), ctr)).ToNot(Succeed())
+		},
+		Entry("cgroup v2", true),
+		Entry("cgroup v1", false),
+	)
+})
@@ -0,0 +1,24 @@
+package lib
+
+import (
+	"fmt"
+
+	rspec "github.com/opencontainers/runtime-spec/specs-go"
+
+	"github.com/cri-o/cri-o/internal/oci"
+)
+
+// setCheckpointGhostLimit sets the ghost file limit of the next checkpoint
+// in the CRIU configuration file of the container with the given spec. The
+// runtime only passes the file to CRIU if it has been configured when the
+// container was created, so a limit cannot be set for containers without it.
+func setCheckpointGhostLimit(spec *rspec.Spec, limit int64) error {
+	path := spec.Annotations[oci.CriuConfigAnnotation]
+	if path == "" {
+		if limit == 0 {
+			return nil
+		}
+		return fmt.Errorf("%w: the ghost file limit cannot be set, the container has been created without CRIU configuration file", ErrCheckpointPrecondition)
+	}
+	return oci.SetCriuGhostLimit(path, limit)
+}
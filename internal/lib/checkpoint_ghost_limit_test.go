@@ -0,0 +1,35 @@
+package lib
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	rspec "github.com/opencontainers/runtime-spec/specs-go"
+
+	"github.com/cri-o/cri-o/internal/oci"
+)
+
+var _ = Describe("CheckpointGhostLimit", func() {
+	It("should keep the default limit without CRIU configuration file", func() {
+		Expect(setCheckpointGhostLimit(&rspec.Spec{}, 0)).To(Succeed())
+	})
+
+	It("should fail to set a limit without CRIU configuration file", func() {
+		Expect(setCheckpointGhostLimit(&rspec.Spec{}, 1<<20)).To(MatchError(ErrCheckpointPrecondition))
+	})
+
+	It("should append the limit to the CRIU configuration file", func() {
+		// Given
+		path := filepath.Join(GinkgoT().TempDir(), "criu.conf")
+		Expect(os.WriteFile(path, []byte("tcp-close\n"), 0o600)).To(Succeed())
+		spec := &rspec.Spec{Annotations: map[string]string{oci.CriuConfigAnnotation: path}}
+
+		// When
+		Expect(setCheckpointGhostLimit(spec, 1<<20)).To(Succeed())
+
+		// Then
+		Expect(os.ReadFile(path)).To(BeEquivalentTo("tcp-close\nghost-limit 1048576\n"))
+	})
+})
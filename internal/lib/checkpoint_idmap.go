@@ -0,0 +1,122 @@
+package lib
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	metadata "github.com/checkpoint-restore/checkpointctl/lib"
+	criu "github.com/checkpoint-restore/go-criu/v7/utils"
+	"github.com/containers/storage/pkg/idtools"
+)
+
+// usernsCriuVersion is the minimum CRIU version required to checkpoint and
+// restore containers running in a user namespace.
+const usernsCriuVersion = 31700
+
+// hasIDMappings returns true if the mappings describe a user namespace.
+func hasIDMappings(mappings *idtools.IDMappings) bool {
+	return mappings != nil && !mappings.Empty()
+}
+
+// checkUsernsCriuVersion fails if the installed CRIU is too old to
+// checkpoint or restore containers in a user namespace.
+func checkUsernsCriuVersion() error {
+	if err := criu.CheckForCriu(usernsCriuVersion); err != nil {
+		return fmt.Errorf("%w: container uses a user namespace: %w", ErrCheckpointUnsupportedFeature, err)
+	}
+	return nil
+}
+
+// idMappedArchives are the archives in the checkpoint whose owners depend
+// on the user namespace of the container.
+var idMappedArchives = []string{metadata.RootFsDiffTar, metadata.DevShmCheckpointTar}
+
+// shiftRootFsDiffToContainer translates the owners of the files in the root
+// file system diff and the shared memory in dir from host IDs to IDs inside
+// the user namespace of the container. This makes the archive independent of
+// the host ID range the container was running with.
+func shiftRootFsDiffToContainer(dir string, mappings *idtools.IDMappings) error {
+	for _, name := range idMappedArchives {
+		if err := shiftTarOwners(filepath.Join(dir, name), func(pair idtools.IDPair) (idtools.IDPair, error) {
+			uid, gid, err := mappings.ToContainer(pair)
+			return idtools.IDPair{UID: uid, GID: gid}, err
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// shiftRootFsDiffToHost translates the owners of the files in the root file
+// system diff and the shared memory in dir from IDs inside the user
+// namespace to host IDs of the restored container.
+func shiftRootFsDiffToHost(dir string, mappings *idtools.IDMappings) error {
+	for _, name := range idMappedArchives {
+		if err := shiftTarOwners(filepath.Join(dir, name), mappings.ToHost); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// shiftTarOwners rewrites the tar archive at path with the owner of every
+// entry translated by shift. A missing archive is not an error, as it only
+// exists if the container changed its root file system.
+func shiftTarOwners(path string, shift func(idtools.IDPair) (idtools.IDPair, error)) (retErr error) {
+	in, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer in.Close()
+
+	out, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file for %s: %w", path, err)
+	}
+	defer func() {
+		out.Close()
+		if retErr != nil {
+			os.Remove(out.Name())
+		}
+	}()
+
+	reader := tar.NewReader(in)
+	writer := tar.NewWriter(out)
+	for {
+		hdr, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		pair, err := shift(idtools.IDPair{UID: hdr.Uid, GID: hdr.Gid})
+		if err != nil {
+			return fmt.Errorf("failed to map owner of %s in %s: %w", hdr.Name, path, err)
+		}
+		hdr.Uid, hdr.Gid = pair.UID, pair.GID
+		// Names might not be valid anymore after the shift.
+		hdr.Uname, hdr.Gname = "", ""
+		if err := writer.WriteHeader(hdr); err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		if _, err := io.Copy(writer, reader); err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	return os.Rename(out.Name(), path)
+}
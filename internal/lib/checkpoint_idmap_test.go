@@ -0,0 +1,160 @@
+package lib
+
+import (
+	"archive/tar"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+
+	metadata "github.com/checkpoint-restore/checkpointctl/lib"
+	"github.com/containers/storage/pkg/idtools"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// writeTestTar writes a tar archive of entries to path. Every entry with a
+// size has the content "content".
+func writeTestTar(path string, entries ...*tar.Header) {
+	f, err := os.Create(path)
+	Expect(err).ToNot(HaveOccurred())
+	defer f.Close()
+	w := tar.NewWriter(f)
+	for _, hdr := range entries {
+		Expect(w.WriteHeader(hdr)).To(Succeed())
+		if hdr.Size > 0 {
+			_, err := w.Write([]byte("content"))
+			Expect(err).ToNot(HaveOccurred())
+		}
+	}
+	Expect(w.Close()).To(Succeed())
+}
+
+// readTestTar returns the entries of the tar archive at path and their
+// content.
+func readTestTar(path string) (entries []*tar.Header, contents []string) {
+	f, err := os.Open(path)
+	Expect(err).ToNot(HaveOccurred())
+	defer f.Close()
+	r := tar.NewReader(f)
+	for {
+		hdr, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return entries, contents
+		}
+		Expect(err).ToNot(HaveOccurred())
+		content, err := io.ReadAll(r)
+		Expect(err).ToNot(HaveOccurred())
+		entries = append(entries, hdr)
+		contents = append(contents, string(content))
+	}
+}
+
+func testMappings(hostID int) *idtools.IDMappings {
+	m := []idtools.IDMap{{ContainerID: 0, HostID: hostID, Size: 65536}}
+	return idtools.NewIDMappingsFromMaps(m, m)
+}
+
+func testFile(uid, gid int) *tar.Header {
+	return &tar.Header{Name: "file", Mode: 0o644, Size: 7, Uid: uid, Gid: gid}
+}
+
+var _ = Describe("CheckpointIDMap", func() {
+	var (
+		dir  string
+		path string
+	)
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		path = filepath.Join(dir, metadata.RootFsDiffTar)
+	})
+
+	It("should shift the rootfs diff between user namespaces", func() {
+		// Given
+		writeTestTar(path, testFile(100005, 100007))
+
+		// When
+		// Checkpoint of a container running with host IDs 100000-165535.
+		Expect(shiftRootFsDiffToContainer(dir, testMappings(100000))).To(Succeed())
+
+		// Then
+		entries, _ := readTestTar(path)
+		Expect(entries).To(HaveLen(1))
+		Expect(entries[0].Uid).To(Equal(5))
+		Expect(entries[0].Gid).To(Equal(7))
+
+		// When
+		// Restore into a container running with host IDs 200000-265535.
+		Expect(shiftRootFsDiffToHost(dir, testMappings(200000))).To(Succeed())
+
+		// Then
+		entries, contents := readTestTar(path)
+		Expect(entries).To(HaveLen(1))
+		Expect(entries[0].Uid).To(Equal(200005))
+		Expect(entries[0].Gid).To(Equal(200007))
+		Expect(contents).To(Equal([]string{"content"}))
+	})
+
+	It("should keep the entries on a round trip", func() {
+		// Given
+		entries := []*tar.Header{
+			{Name: "dir/", Typeflag: tar.TypeDir, Mode: 0o755, Uid: 100000, Gid: 100000},
+			{Name: "dir/file", Typeflag: tar.TypeReg, Mode: 0o600, Uid: 101234, Gid: 101235, Size: 7},
+			{Name: "dir/link", Typeflag: tar.TypeSymlink, Linkname: "file", Mode: 0o777, Uid: 165535, Gid: 165535},
+		}
+		writeTestTar(path, entries...)
+		mappings := testMappings(100000)
+
+		// When
+		Expect(shiftTarOwners(path, func(pair idtools.IDPair) (idtools.IDPair, error) {
+			uid, gid, err := mappings.ToContainer(pair)
+			return idtools.IDPair{UID: uid, GID: gid}, err
+		})).To(Succeed())
+		Expect(shiftTarOwners(path, mappings.ToHost)).To(Succeed())
+
+		// Then
+		read, contents := readTestTar(path)
+		Expect(read).To(HaveLen(len(entries)))
+		for i, expected := range entries {
+			hdr := read[i]
+			Expect(hdr.Name).To(Equal(expected.Name))
+			Expect(hdr.Typeflag).To(Equal(expected.Typeflag))
+			Expect(hdr.Linkname).To(Equal(expected.Linkname))
+			Expect(hdr.Mode).To(Equal(expected.Mode))
+			Expect(hdr.Uid).To(Equal(expected.Uid))
+			Expect(hdr.Gid).To(Equal(expected.Gid))
+			Expect(contents[i]).To(HaveLen(int(expected.Size)))
+		}
+	})
+
+	It("should fail for an owner outside of the user namespace", func() {
+		// Given
+		writeTestTar(path, testFile(5, 5))
+
+		// When
+		err := shiftRootFsDiffToContainer(dir, testMappings(100000))
+
+		// Then
+		Expect(err).To(HaveOccurred())
+		entries, _ := readTestTar(path)
+		Expect(entries[0].Uid).To(Equal(5))
+	})
+
+	It("should succeed without rootfs diff", func() {
+		Expect(shiftRootFsDiffToHost(dir, testMappings(100000))).To(Succeed())
+	})
+
+	DescribeTable("should write the format version of the checkpoint info",
+		func(info CheckpointInfo, version int) {
+			Expect(writeCheckpointInfo(dir, &info)).To(Succeed())
+			read, err := ReadCheckpointInfo(dir)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(read.FormatVersion).To(Equal(version))
+		},
+		Entry("without features", CheckpointInfo{}, 1),
+		Entry("diagnostic", CheckpointInfo{Diagnostic: true}, 1),
+		Entry("ID mapped", CheckpointInfo{IDMapped: true}, 2),
+		Entry("with parents", CheckpointInfo{IDMapped: true, Parents: []CheckpointParent{{Archive: "/parent.tar"}}}, 3),
+	)
+})
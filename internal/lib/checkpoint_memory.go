@@ -0,0 +1,31 @@
+package lib
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// checkpointPagesPattern matches the CRIU images holding the memory pages
+// of the dumped processes.
+const checkpointPagesPattern = "pages-*.img"
+
+// checkpointMemoryBytes returns the size of the memory pages CRIU dumped to
+// the checkpoint directory dir, which have to fit into the memory limit of
+// the restored container. Pages of the parent of an incremental checkpoint
+// are not included.
+func checkpointMemoryBytes(dir string) (int64, error) {
+	pages, err := filepath.Glob(filepath.Join(dir, checkpointPagesPattern))
+	if err != nil {
+		return 0, err
+	}
+	var size int64
+	for _, page := range pages {
+		fi, err := os.Stat(page)
+		if err != nil {
+			return 0, fmt.Errorf("stat memory pages: %w", err)
+		}
+		size += fi.Size()
+	}
+	return size, nil
+}
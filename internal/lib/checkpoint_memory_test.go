@@ -0,0 +1,31 @@
+package lib
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CheckpointMemory", func() {
+	It("should only count the memory pages", func() {
+		// Given
+		dir := GinkgoT().TempDir()
+		for name, size := range map[string]int{
+			"pages-1.img":   4096,
+			"pages-2.img":   8192,
+			"pagemap-1.img": 100,
+			"core-1.img":    100,
+		} {
+			Expect(os.WriteFile(filepath.Join(dir, name), make([]byte, size), 0o600)).To(Succeed())
+		}
+
+		// When
+		size, err := checkpointMemoryBytes(dir)
+
+		// Then
+		Expect(err).ToNot(HaveOccurred())
+		Expect(size).To(BeEquivalentTo(12288))
+	})
+})
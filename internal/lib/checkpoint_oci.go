@@ -0,0 +1,307 @@
+package lib
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"time"
+
+	metadata "github.com/checkpoint-restore/checkpointctl/lib"
+	criu "github.com/checkpoint-restore/go-criu/v7/utils"
+	"github.com/containers/storage/pkg/archive"
+	json "github.com/json-iterator/go"
+	"github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/cri-o/cri-o/internal/log"
+	"github.com/cri-o/cri-o/pkg/annotations"
+)
+
+var (
+	// ErrInvalidOCICheckpointArchive is returned when an OCI image layout
+	// archive does not hold a single checkpoint image with a single layer.
+	ErrInvalidOCICheckpointArchive = errors.New("invalid OCI checkpoint archive")
+
+	// ErrCheckpointCriuTooOld is returned when restoring a checkpoint written
+	// by a newer version of CRIU than the available one.
+	ErrCheckpointCriuTooOld = errors.New("checkpoint has been written by a newer CRIU")
+)
+
+// maxOCILayoutMetadataSize limits the size of the index and manifest read
+// from OCI checkpoint archives.
+const maxOCILayoutMetadataSize = 4 << 20
+
+// ociLayoutEntry is a file of an OCI image layout archive.
+type ociLayoutEntry struct {
+	name    string
+	size    int64
+	content io.Reader
+}
+
+// ociBlobPath returns the path of the blob with the given digest in an OCI
+// image layout.
+func ociBlobPath(dgst digest.Digest) string {
+	return path.Join(v1.ImageBlobsDir, dgst.Algorithm().String(), dgst.Encoded())
+}
+
+// ociCheckpointAnnotations returns the annotations of the manifest of an OCI
+// checkpoint archive. CRI-O recognizes checkpoint images by its own
+// annotation, other container engines by the one of checkpointctl.
+func ociCheckpointAnnotations(checkpointAnnotations map[string]string) map[string]string {
+	result := make(map[string]string, len(checkpointAnnotations)+2)
+	for key, value := range checkpointAnnotations {
+		result[key] = value
+	}
+	if name := checkpointAnnotations[metadata.CheckpointAnnotationName]; name != "" {
+		result[annotations.CheckpointAnnotationName] = name
+	}
+	if criuVersion := checkpointAnnotations[metadata.CheckpointAnnotationCriuVersion]; criuVersion != "" {
+		result[annotations.CheckpointAnnotationCriuVersion] = criuVersion
+	}
+	return result
+}
+
+// writeOCICheckpointArchive writes the native checkpoint archive read from
+// input as the single layer of an OCI image layout archive to the target
+// file of opts. The layer is staged in a temporary file next to the target,
+// as the manifest written before it refers to its digest.
+func writeOCICheckpointArchive(ctx context.Context, input io.Reader, checkpointAnnotations map[string]string, opts *ContainerCheckpointOptions) error {
+	if opts.ArchivePartSize > 0 {
+		return errors.New("OCI checkpoint archives cannot be split")
+	}
+	layerFile, err := os.CreateTemp(filepath.Dir(opts.TargetFile), "."+filepath.Base(opts.TargetFile)+".layer")
+	if err != nil {
+		return fmt.Errorf("error creating checkpoint layer file: %w", err)
+	}
+	defer func() {
+		layerFile.Close()
+		if err := os.Remove(layerFile.Name()); err != nil && !os.IsNotExist(err) {
+			log.Warnf(ctx, "Unable to remove temporary checkpoint layer %s: %v", layerFile.Name(), err)
+		}
+	}()
+
+	digester := digest.Canonical.Digester()
+	size, err := io.Copy(io.MultiWriter(layerFile, digester.Hash()), input)
+	if err != nil {
+		return fmt.Errorf("error writing checkpoint layer file %q: %w", layerFile.Name(), err)
+	}
+	if _, err := layerFile.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	layer := v1.Descriptor{
+		MediaType: v1.MediaTypeImageLayer,
+		Digest:    digester.Digest(),
+		Size:      size,
+	}
+
+	created := time.Now().UTC()
+	config, err := json.Marshal(&v1.Image{
+		Created:  &created,
+		Platform: v1.Platform{Architecture: runtime.GOARCH, OS: "linux"},
+		RootFS:   v1.RootFS{Type: "layers", DiffIDs: []digest.Digest{layer.Digest}},
+	})
+	if err != nil {
+		return err
+	}
+	configDescriptor := v1.Descriptor{
+		MediaType: v1.MediaTypeImageConfig,
+		Digest:    digest.FromBytes(config),
+		Size:      int64(len(config)),
+	}
+	manifest, err := json.Marshal(&v1.Manifest{
+		Versioned:   specs.Versioned{SchemaVersion: 2},
+		MediaType:   v1.MediaTypeImageManifest,
+		Config:      configDescriptor,
+		Layers:      []v1.Descriptor{layer},
+		Annotations: ociCheckpointAnnotations(checkpointAnnotations),
+	})
+	if err != nil {
+		return err
+	}
+	manifestDescriptor := v1.Descriptor{
+		MediaType: v1.MediaTypeImageManifest,
+		Digest:    digest.FromBytes(manifest),
+		Size:      int64(len(manifest)),
+	}
+	index, err := json.Marshal(&v1.Index{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: v1.MediaTypeImageIndex,
+		Manifests: []v1.Descriptor{manifestDescriptor},
+	})
+	if err != nil {
+		return err
+	}
+	layout, err := json.Marshal(&v1.ImageLayout{Version: v1.ImageLayoutVersion})
+	if err != nil {
+		return err
+	}
+
+	entries := []ociLayoutEntry{
+		{name: v1.ImageLayoutFile, size: int64(len(layout)), content: bytes.NewReader(layout)},
+		{name: v1.ImageIndexFile, size: int64(len(index)), content: bytes.NewReader(index)},
+		{name: ociBlobPath(manifestDescriptor.Digest), size: manifestDescriptor.Size, content: bytes.NewReader(manifest)},
+		{name: ociBlobPath(configDescriptor.Digest), size: configDescriptor.Size, content: bytes.NewReader(config)},
+		{name: ociBlobPath(layer.Digest), size: layer.Size, content: layerFile},
+	}
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(writeOCILayoutArchive(writer, entries))
+	}()
+	err = writeCheckpointArchive(ctx, reader, opts)
+	// Stop the writer if the archive could not be written completely.
+	reader.Close()
+	return err
+}
+
+// writeOCILayoutArchive writes the entries as tar archive to w, preceded by
+// the directories of the blobs.
+func writeOCILayoutArchive(w io.Writer, entries []ociLayoutEntry) error {
+	tw := tar.NewWriter(w)
+	for _, dir := range []string{v1.ImageBlobsDir, path.Join(v1.ImageBlobsDir, digest.Canonical.String())} {
+		if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: dir + "/", Mode: 0o755}); err != nil {
+			return err
+		}
+	}
+	for _, entry := range entries {
+		if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: entry.name, Mode: 0o644, Size: entry.size}); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, entry.content); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// isOCILayoutArchive checks whether the tar archive starting with header is
+// an OCI image layout archive instead of a native checkpoint archive.
+func isOCILayoutArchive(header []byte) bool {
+	hdr, err := tar.NewReader(bytes.NewReader(header)).Next()
+	if err != nil {
+		return false
+	}
+	name := path.Clean(hdr.Name)
+	return name == v1.ImageLayoutFile || name == v1.ImageIndexFile || name == v1.ImageBlobsDir
+}
+
+// openOCICheckpointLayer returns the native checkpoint archive held by the
+// OCI image layout archive file as its single layer. The archive is read
+// several times, skipping over the content of the entries not needed.
+func openOCICheckpointLayer(file *os.File) (io.ReadCloser, error) {
+	index := &v1.Index{}
+	if err := readOCILayoutJSON(file, v1.ImageIndexFile, index); err != nil {
+		return nil, err
+	}
+	if len(index.Manifests) != 1 || index.Manifests[0].MediaType != v1.MediaTypeImageManifest {
+		return nil, fmt.Errorf("%w: expected a single image manifest in %s", ErrInvalidOCICheckpointArchive, v1.ImageIndexFile)
+	}
+	manifest := &v1.Manifest{}
+	if err := readOCILayoutJSON(file, ociBlobPath(index.Manifests[0].Digest), manifest); err != nil {
+		return nil, err
+	}
+	if len(manifest.Layers) != 1 {
+		return nil, fmt.Errorf("%w: expected a single layer, got %d", ErrInvalidOCICheckpointArchive, len(manifest.Layers))
+	}
+	tr, err := findOCILayoutEntry(file, ociBlobPath(manifest.Layers[0].Digest))
+	if err != nil {
+		return nil, err
+	}
+	// The layer of checkpoint images built by other tools may be compressed.
+	layer, err := archive.DecompressStream(tr)
+	if err != nil {
+		return nil, err
+	}
+	return &ociCheckpointLayer{ReadCloser: layer, file: file}, nil
+}
+
+// ociCheckpointLayer reads the layer of an OCI checkpoint archive and closes
+// the archive together with it.
+type ociCheckpointLayer struct {
+	io.ReadCloser
+	file *os.File
+}
+
+func (l *ociCheckpointLayer) Close() error {
+	l.ReadCloser.Close()
+	return l.file.Close()
+}
+
+// readOCILayoutJSON decodes the JSON file with the given name of the OCI
+// image layout archive file into v.
+func readOCILayoutJSON(file *os.File, name string, v any) error {
+	tr, err := findOCILayoutEntry(file, name)
+	if err != nil {
+		return err
+	}
+	content, err := io.ReadAll(io.LimitReader(tr, maxOCILayoutMetadataSize))
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(content, v); err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrInvalidOCICheckpointArchive, name, err)
+	}
+	return nil
+}
+
+// findOCILayoutEntry returns a reader of the content of the file with the
+// given name of the OCI image layout archive file.
+func findOCILayoutEntry(file *os.File, name string) (*tar.Reader, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(file)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%w: %s not found", ErrInvalidOCICheckpointArchive, name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidOCICheckpointArchive, err)
+		}
+		if path.Clean(hdr.Name) == name {
+			return tr, nil
+		}
+	}
+}
+
+// CheckCheckpointCriuVersion checks whether the available CRIU is able to
+// restore the checkpoint whose spec has the given annotations. CRIU restores
+// the images written by older versions, but not necessarily those of newer
+// ones. Checkpoints without a recorded CRIU version are not checked.
+func CheckCheckpointCriuVersion(specAnnotations map[string]string) error {
+	criuVersion, err := criu.GetCriuVersion()
+	if err != nil {
+		// The restore itself reports a missing CRIU.
+		return nil
+	}
+	return checkCriuVersion(specAnnotations, criuVersion)
+}
+
+// checkCriuVersion checks the CRIU version recorded in the checkpoint
+// annotations against criuVersion.
+func checkCriuVersion(specAnnotations map[string]string, criuVersion int) error {
+	recorded := specAnnotations[metadata.CheckpointAnnotationCriuVersion]
+	if recorded == "" {
+		recorded = specAnnotations[annotations.CheckpointAnnotationCriuVersion]
+	}
+	if recorded == "" {
+		return nil
+	}
+	version, err := strconv.Atoi(recorded)
+	if err != nil {
+		return fmt.Errorf("%w: invalid CRIU version %q", ErrCorruptCheckpointMetadata, recorded)
+	}
+	if version > criuVersion {
+		return fmt.Errorf("%w: checkpoint has been written by CRIU %d, available is %d", ErrCheckpointCriuTooOld, version, criuVersion)
+	}
+	return nil
+}
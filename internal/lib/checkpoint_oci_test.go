@@ -0,0 +1,93 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+
+	metadata "github.com/checkpoint-restore/checkpointctl/lib"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/cri-o/cri-o/pkg/annotations"
+)
+
+var _ = Describe("CheckpointOCI", func() {
+	var target string
+
+	BeforeEach(func() {
+		target = filepath.Join(GinkgoT().TempDir(), "checkpoint.tar")
+	})
+
+	It("should write the archive as OCI image", func() {
+		// Given
+		source := GinkgoT().TempDir()
+		Expect(os.WriteFile(filepath.Join(source, metadata.ConfigDumpFile), []byte(`{"id":"ctr"}`), 0o644)).To(Succeed())
+		checkpointAnnotations := map[string]string{
+			metadata.CheckpointAnnotationName:        "ctr",
+			metadata.CheckpointAnnotationCriuVersion: "40000",
+		}
+
+		// When
+		Expect(writeOCICheckpointArchive(context.Background(), tarTestDir(source, metadata.ConfigDumpFile),
+			checkpointAnnotations, &ContainerCheckpointOptions{TargetFile: target})).To(Succeed())
+
+		// Then
+		Expect(testDirEntries(filepath.Dir(target))).To(Equal([]string{"checkpoint.tar"}))
+		file, err := os.Open(target)
+		Expect(err).ToNot(HaveOccurred())
+		defer file.Close()
+		index := &v1.Index{}
+		Expect(readOCILayoutJSON(file, v1.ImageIndexFile, index)).To(Succeed())
+		manifest := &v1.Manifest{}
+		Expect(readOCILayoutJSON(file, ociBlobPath(index.Manifests[0].Digest), manifest)).To(Succeed())
+		Expect(manifest.Annotations).To(And(
+			HaveKeyWithValue(metadata.CheckpointAnnotationName, "ctr"),
+			HaveKeyWithValue(annotations.CheckpointAnnotationName, "ctr"),
+			HaveKeyWithValue(annotations.CheckpointAnnotationCriuVersion, "40000"),
+		))
+
+		// The restore reads the native archive from the layer.
+		dest := importTestCheckpoint(target)
+		Expect(os.ReadFile(filepath.Join(dest, metadata.ConfigDumpFile))).To(BeEquivalentTo(`{"id":"ctr"}`))
+	})
+
+	It("should reject an archive with multiple layers", func() {
+		// Given
+		index := []byte(`{"schemaVersion":2,"manifests":[{"mediaType":"` + v1.MediaTypeImageManifest +
+			`","digest":"sha256:2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae","size":2}]}`)
+		manifest := []byte(`{"schemaVersion":2,"layers":[{},{}]}`)
+		var buf bytes.Buffer
+		Expect(writeOCILayoutArchive(&buf, []ociLayoutEntry{
+			{name: v1.ImageIndexFile, size: int64(len(index)), content: bytes.NewReader(index)},
+			{name: "blobs/sha256/2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae", size: int64(len(manifest)), content: bytes.NewReader(manifest)},
+		})).To(Succeed())
+		Expect(os.WriteFile(target, buf.Bytes(), 0o600)).To(Succeed())
+
+		// When
+		_, err := OpenCheckpointArchive(target)
+
+		// Then
+		Expect(err).To(MatchError(ErrInvalidOCICheckpointArchive))
+	})
+
+	DescribeTable("should accept a supported CRIU version",
+		func(checkpointAnnotations map[string]string) {
+			Expect(checkCriuVersion(checkpointAnnotations, 40000)).To(Succeed())
+		},
+		Entry("unknown version", nil),
+		Entry("older version", map[string]string{metadata.CheckpointAnnotationCriuVersion: "30000"}),
+		Entry("same version", map[string]string{metadata.CheckpointAnnotationCriuVersion: "40000"}),
+	)
+
+	DescribeTable("should reject an unsupported CRIU version",
+		func(checkpointAnnotations map[string]string, expected error) {
+			Expect(checkCriuVersion(checkpointAnnotations, 40000)).To(MatchError(expected))
+		},
+		Entry("newer version", map[string]string{metadata.CheckpointAnnotationCriuVersion: "40100"}, ErrCheckpointCriuTooOld),
+		Entry("newer version in CRI-O annotation", map[string]string{annotations.CheckpointAnnotationCriuVersion: "40100"}, ErrCheckpointCriuTooOld),
+		Entry("invalid version", map[string]string{metadata.CheckpointAnnotationCriuVersion: "4.1"}, ErrCorruptCheckpointMetadata),
+	)
+})
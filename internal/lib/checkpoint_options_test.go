@@ -0,0 +1,55 @@
+package lib
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CheckpointOptions", func() {
+	It("should keep diagnostic checkpoints running", func() {
+		// Given
+		opts := &ContainerCheckpointOptions{
+			TargetFile:     "/tmp/checkpoint.tar",
+			DiagnosticOnly: true,
+		}
+
+		// When
+		effective, err := effectiveCheckpointOptions(opts)
+
+		// Then
+		Expect(err).ToNot(HaveOccurred())
+		Expect(effective.KeepRunning).To(BeTrue())
+		Expect(opts.KeepRunning).To(BeFalse())
+	})
+
+	It("should return a copy of regular options", func() {
+		// Given
+		opts := &ContainerCheckpointOptions{TargetFile: "/tmp/checkpoint.tar"}
+
+		// When
+		effective, err := effectiveCheckpointOptions(opts)
+
+		// Then
+		Expect(err).ToNot(HaveOccurred())
+		Expect(effective).ToNot(BeIdenticalTo(opts))
+		Expect(effective).To(Equal(opts))
+	})
+
+	It("should accept a parent checkpoint", func() {
+		opts := &ContainerCheckpointOptions{ParentCheckpoint: "/tmp/parent.tar", TargetFile: "/tmp/checkpoint.tar"}
+		Expect(effectiveCheckpointOptions(opts)).ToNot(BeNil())
+	})
+
+	DescribeTable("should reject invalid options",
+		func(opts *ContainerCheckpointOptions) {
+			_, err := effectiveCheckpointOptions(opts)
+			Expect(err).To(HaveOccurred())
+		},
+		Entry("diagnostic without target file", &ContainerCheckpointOptions{DiagnosticOnly: true}),
+		Entry("parent without target file", &ContainerCheckpointOptions{ParentCheckpoint: "/tmp/parent.tar"}),
+		Entry("diagnostic with parent", &ContainerCheckpointOptions{ParentCheckpoint: "/tmp/parent.tar", TargetFile: "/tmp/checkpoint.tar", DiagnosticOnly: true}),
+		Entry("parent overwritten by the checkpoint", &ContainerCheckpointOptions{ParentCheckpoint: "/tmp/checkpoint.tar", TargetFile: "/tmp/./checkpoint.tar", Overwrite: true}),
+		Entry("negative ghost file limit", &ContainerCheckpointOptions{TargetFile: "/tmp/checkpoint.tar", GhostLimit: -1}),
+		Entry("ghost file limit too large", &ContainerCheckpointOptions{TargetFile: "/tmp/checkpoint.tar", GhostLimit: 1 << 32}),
+	)
+})
@@ -0,0 +1,162 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	metadata "github.com/checkpoint-restore/checkpointctl/lib"
+	"github.com/containers/storage/pkg/archive"
+	"github.com/opencontainers/go-digest"
+
+	"github.com/cri-o/cri-o/internal/log"
+	"github.com/cri-o/cri-o/internal/oci"
+	"github.com/cri-o/cri-o/pkg/annotations"
+)
+
+// CheckpointParent references a checkpoint archive an incremental
+// checkpoint is based on.
+type CheckpointParent struct {
+	// Archive is the absolute path of the parent checkpoint archive.
+	Archive string `json:"archive"`
+	// Digest is the digest of the parent checkpoint archive at the time the
+	// incremental checkpoint was written.
+	Digest string `json:"digest"`
+}
+
+// ErrIncompatibleCheckpointParent is returned if the parent of an
+// incremental checkpoint cannot be used, for example because it belongs to
+// another container or has been modified since.
+var ErrIncompatibleCheckpointParent = errors.New("incompatible parent checkpoint")
+
+// prepareCheckpointParents extracts the images of the parent checkpoint
+// archive and of all its own parents below the directory of the container,
+// where the runtime picks them up to write an incremental checkpoint. It
+// returns the parent chain to be recorded in the new checkpoint, starting
+// with the direct parent.
+func prepareCheckpointParents(ctx context.Context, ctr *oci.Container, parentArchive string) (_ []CheckpointParent, retErr error) {
+	parentDir := filepath.Join(ctr.Dir(), oci.CheckpointParentDirectory)
+	// Left over images of an earlier checkpoint must not end up as parent.
+	if err := os.RemoveAll(parentDir); err != nil {
+		return nil, fmt.Errorf("failed to remove parent checkpoint directory %s: %w", parentDir, err)
+	}
+	if parentArchive == "" {
+		return nil, nil
+	}
+	defer func() {
+		if retErr != nil {
+			removeCheckpointParents(ctx, ctr.Dir())
+		}
+	}()
+
+	parentArchive, err := filepath.Abs(parentArchive)
+	if err != nil {
+		return nil, err
+	}
+	dgst, err := extractCheckpointParent(parentArchive, parentDir)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := ReadCheckpointInfo(parentDir)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", parentArchive, err)
+	}
+	if info.Diagnostic {
+		return nil, fmt.Errorf("%s: %w: %w", parentArchive, ErrIncompatibleCheckpointParent, ErrDiagnosticCheckpoint)
+	}
+	config := &metadata.ContainerConfig{}
+	if _, err := metadata.ReadJSONFile(config, parentDir, metadata.ConfigDumpFile); err != nil {
+		return nil, fmt.Errorf("%s: %w: %w", parentArchive, ErrIncompatibleCheckpointParent, err)
+	}
+	if config.ID != ctr.ID() {
+		return nil, fmt.Errorf("%s: %w: checkpoint of container %s instead of %s", parentArchive, ErrIncompatibleCheckpointParent, config.ID, ctr.ID())
+	}
+	if _, err := os.Stat(ctr.CheckpointParentPath()); err != nil {
+		return nil, fmt.Errorf("%s: %w: %w", parentArchive, ErrIncompatibleCheckpointParent, err)
+	}
+
+	if err := extractCheckpointParents(parentDir, info.Parents); err != nil {
+		return nil, err
+	}
+
+	parents := []CheckpointParent{{Archive: parentArchive, Digest: dgst.String()}}
+	return append(parents, info.Parents...), nil
+}
+
+// extractCheckpointParents extracts the images of the given parent chain
+// below dir. CRIU links the images of an incremental checkpoint to the
+// images of its parent at CheckpointParentDirectory next to them, so every
+// parent is nested in the directory of its child.
+func extractCheckpointParents(dir string, parents []CheckpointParent) error {
+	for _, parent := range parents {
+		dir = filepath.Join(dir, oci.CheckpointParentDirectory)
+		dgst, err := extractCheckpointParent(parent.Archive, dir)
+		if err != nil {
+			return err
+		}
+		if dgst.String() != parent.Digest {
+			return fmt.Errorf("%s: %w: archive has been modified, expected digest %s but got %s", parent.Archive, ErrIncompatibleCheckpointParent, parent.Digest, dgst)
+		}
+	}
+	return nil
+}
+
+// extractCheckpointParent extracts the images and metadata of the
+// checkpoint archive into dir and returns the digest of the archive.
+func extractCheckpointParent(parentArchive, dir string) (digest.Digest, error) {
+	archiveFile, err := OpenCheckpointArchive(parentArchive)
+	if err != nil {
+		return "", fmt.Errorf("failed to open parent checkpoint archive: %w", err)
+	}
+	defer archiveFile.Close()
+
+	digester := digest.Canonical.Digester()
+	input := io.TeeReader(archiveFile, digester.Hash())
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	// Only the images and metadata of the parent are needed.
+	options := &archive.TarOptions{
+		ExcludePatterns: []string{
+			metadata.RootFsDiffTar,
+			metadata.DeletedFilesFile,
+			metadata.SpecDumpFile,
+			annotations.LogPath,
+		},
+	}
+	if err := archive.Untar(input, dir, options); err != nil {
+		return "", fmt.Errorf("unpacking of parent checkpoint archive %s failed: %w", parentArchive, err)
+	}
+	// Include the trailing padding of the archive in the digest.
+	if _, err := io.Copy(io.Discard, input); err != nil {
+		return "", fmt.Errorf("failed to read parent checkpoint archive %s: %w", parentArchive, err)
+	}
+	return digester.Digest(), nil
+}
+
+// restoreCheckpointParents extracts the images of all parents of the
+// imported checkpoint of the container, which CRIU needs to restore an
+// incremental checkpoint.
+func restoreCheckpointParents(ctr *oci.Container) error {
+	info, err := ReadCheckpointInfo(ctr.Dir())
+	if err != nil {
+		return err
+	}
+	if err := extractCheckpointParents(ctr.Dir(), info.Parents); err != nil {
+		return fmt.Errorf("failed to restore parents of checkpoint for %s: %w", ctr.ID(), err)
+	}
+	return nil
+}
+
+// removeCheckpointParents removes the extracted images of the parent chain
+// of a checkpoint from dir.
+func removeCheckpointParents(ctx context.Context, dir string) {
+	parentDir := filepath.Join(dir, oci.CheckpointParentDirectory)
+	if err := os.RemoveAll(parentDir); err != nil {
+		log.Warnf(ctx, "Unable to remove parent checkpoint directory %s: %v", parentDir, err)
+	}
+}
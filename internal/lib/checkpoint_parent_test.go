@@ -0,0 +1,152 @@
+package lib
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+
+	metadata "github.com/checkpoint-restore/checkpointctl/lib"
+	"github.com/containers/storage/pkg/archive"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/cri-o/cri-o/internal/oci"
+)
+
+// tarTestDir returns an uncompressed tar stream of dir, limited to
+// includeFiles if set.
+func tarTestDir(dir string, includeFiles ...string) io.ReadCloser {
+	input, err := archive.TarWithOptions(dir, &archive.TarOptions{Compression: archive.Uncompressed, IncludeFiles: includeFiles})
+	Expect(err).ToNot(HaveOccurred())
+	DeferCleanup(input.Close)
+	return input
+}
+
+// writeTestCheckpointArchive writes a minimal checkpoint archive of the
+// container id to path. The memory pages contain path.
+func writeTestCheckpointArchive(path, id string, info *CheckpointInfo) {
+	dir := GinkgoT().TempDir()
+	Expect(os.Mkdir(filepath.Join(dir, metadata.CheckpointDirectory), 0o700)).To(Succeed())
+	Expect(os.WriteFile(filepath.Join(dir, metadata.CheckpointDirectory, "pages-1.img"), []byte(path), 0o600)).To(Succeed())
+	_, err := metadata.WriteJSONFile(&metadata.ContainerConfig{ID: id}, dir, metadata.ConfigDumpFile)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(writeCheckpointInfo(dir, info)).To(Succeed())
+
+	out, err := os.Create(path)
+	Expect(err).ToNot(HaveOccurred())
+	defer out.Close()
+	_, err = io.Copy(out, tarTestDir(dir))
+	Expect(err).ToNot(HaveOccurred())
+}
+
+var _ = Describe("CheckpointParent", func() {
+	var (
+		ctr       *oci.Container
+		dir       string
+		parentDir string
+	)
+
+	BeforeEach(func() {
+		ctr = newCheckpointTestContainer("container-id")
+		dir = GinkgoT().TempDir()
+		parentDir = filepath.Join(ctr.Dir(), oci.CheckpointParentDirectory)
+	})
+
+	It("should record and extract the parent chain", func() {
+		// Given
+		grandparent := filepath.Join(dir, "grandparent.tar")
+		writeTestCheckpointArchive(grandparent, ctr.ID(), &CheckpointInfo{})
+		parent := filepath.Join(dir, "parent.tar")
+
+		// When
+		// The grandparent has no parents of its own.
+		parents, err := prepareCheckpointParents(context.Background(), ctr, grandparent)
+
+		// Then
+		Expect(err).ToNot(HaveOccurred())
+		Expect(parents).To(HaveLen(1))
+		Expect(parents[0].Archive).To(Equal(grandparent))
+		Expect(parents[0].Digest).ToNot(BeEmpty())
+
+		// When
+		writeTestCheckpointArchive(parent, ctr.ID(), &CheckpointInfo{Parents: parents})
+		parents, err = prepareCheckpointParents(context.Background(), ctr, parent)
+
+		// Then
+		Expect(err).ToNot(HaveOccurred())
+		Expect(parents).To(HaveLen(2))
+		Expect(parents[0].Archive).To(Equal(parent))
+		Expect(parents[1].Archive).To(Equal(grandparent))
+		pages := parentDir
+		for _, archivePath := range []string{parent, grandparent} {
+			Expect(os.ReadFile(filepath.Join(pages, metadata.CheckpointDirectory, "pages-1.img"))).To(BeEquivalentTo(archivePath))
+			pages = filepath.Join(pages, oci.CheckpointParentDirectory)
+		}
+
+		// When
+		// A checkpoint without parent removes the left over images.
+		parents, err = prepareCheckpointParents(context.Background(), ctr, "")
+
+		// Then
+		Expect(err).ToNot(HaveOccurred())
+		Expect(parents).To(BeNil())
+		Expect(parentDir).ToNot(BeAnExistingFile())
+	})
+
+	DescribeTable("should reject incompatible parents",
+		func(id string, info func(grandparent string) *CheckpointInfo) {
+			// Given
+			grandparent := filepath.Join(dir, "grandparent.tar")
+			writeTestCheckpointArchive(grandparent, ctr.ID(), &CheckpointInfo{})
+			parent := filepath.Join(dir, "parent.tar")
+			if id == "" {
+				id = ctr.ID()
+			}
+			writeTestCheckpointArchive(parent, id, info(grandparent))
+
+			// When
+			_, err := prepareCheckpointParents(context.Background(), ctr, parent)
+
+			// Then
+			Expect(err).To(MatchError(ErrIncompatibleCheckpointParent))
+			Expect(parentDir).ToNot(BeAnExistingFile())
+		},
+		Entry("of another container", "other-id", func(string) *CheckpointInfo {
+			return &CheckpointInfo{}
+		}),
+		Entry("diagnostic", "", func(string) *CheckpointInfo {
+			return &CheckpointInfo{Diagnostic: true}
+		}),
+		Entry("with a modified parent", "", func(grandparent string) *CheckpointInfo {
+			return &CheckpointInfo{Parents: []CheckpointParent{{Archive: grandparent, Digest: "sha256:0000"}}}
+		}),
+	)
+
+	It("should reject a missing parent", func() {
+		_, err := prepareCheckpointParents(context.Background(), ctr, filepath.Join(dir, "missing.tar"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should restore the parents", func() {
+		// Given
+		parent := filepath.Join(dir, "parent.tar")
+		writeTestCheckpointArchive(parent, ctr.ID(), &CheckpointInfo{})
+		parents, err := prepareCheckpointParents(context.Background(), ctr, parent)
+		Expect(err).ToNot(HaveOccurred())
+		restored := newCheckpointTestContainer("restored-id")
+		Expect(writeCheckpointInfo(restored.Dir(), &CheckpointInfo{Parents: parents})).To(Succeed())
+
+		// When
+		Expect(restoreCheckpointParents(restored)).To(Succeed())
+
+		// Then
+		Expect(filepath.Join(restored.CheckpointParentPath(), "pages-1.img")).To(BeAnExistingFile())
+
+		// When
+		removeCheckpointParents(context.Background(), restored.Dir())
+
+		// Then
+		Expect(filepath.Join(restored.Dir(), oci.CheckpointParentDirectory)).ToNot(BeAnExistingFile())
+	})
+})
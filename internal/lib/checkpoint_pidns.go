@@ -0,0 +1,26 @@
+package lib
+
+import (
+	"fmt"
+
+	types "k8s.io/cri-api/pkg/apis/runtime/v1"
+
+	"github.com/cri-o/cri-o/internal/lib/sandbox"
+)
+
+// checkSharedPidNamespace fails if the container shares the PID namespace of
+// its pod (shareProcessNamespace). CRIU checkpoints a PID namespace as a
+// whole, including the processes of the other containers and the infra
+// container holding it, so a checkpoint of a single container of such a pod
+// could not be restored correctly.
+// NamespaceMode_POD is the zero value, so pods without namespace options are
+// not treated as sharing the PID namespace.
+func checkSharedPidNamespace(ctrID string, sb *sandbox.Sandbox) error {
+	if sb == nil || sb.NamespaceOptions() == nil || sb.NamespaceOptions().Pid != types.NamespaceMode_POD {
+		return nil
+	}
+	return fmt.Errorf(
+		"%w: container %s shares the PID namespace of pod %s (shareProcessNamespace), which CRIU can only checkpoint as a whole; checkpointing a single container of such a pod is not supported",
+		ErrCheckpointPrecondition, ctrID, sb.Name(),
+	)
+}
@@ -0,0 +1,28 @@
+package lib
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	types "k8s.io/cri-api/pkg/apis/runtime/v1"
+
+	"github.com/cri-o/cri-o/internal/lib/sandbox"
+)
+
+var _ = Describe("CheckpointPidNamespace", func() {
+	DescribeTable("should accept containers without shared PID namespace",
+		func(nsOpts *types.NamespaceOption) {
+			sb := &sandbox.Sandbox{}
+			sb.SetNamespaceOptions(nsOpts)
+			Expect(checkSharedPidNamespace("ctr", sb)).To(Succeed())
+		},
+		Entry("no namespace options", nil),
+		Entry("container namespace", &types.NamespaceOption{Pid: types.NamespaceMode_CONTAINER}),
+		Entry("host namespace", &types.NamespaceOption{Pid: types.NamespaceMode_NODE}),
+	)
+
+	It("should reject containers sharing the PID namespace of the pod", func() {
+		sb := &sandbox.Sandbox{}
+		sb.SetNamespaceOptions(&types.NamespaceOption{Pid: types.NamespaceMode_POD})
+		Expect(checkSharedPidNamespace("ctr", sb)).To(MatchError(ErrCheckpointPrecondition))
+	})
+})
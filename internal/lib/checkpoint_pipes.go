@@ -0,0 +1,229 @@
+package lib
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	rspec "github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
+
+	"github.com/cri-o/cri-o/internal/oci"
+)
+
+// CheckpointFIFO is a FIFO on a volume of the container which was open in
+// the checkpointed processes. CRIU dumps the data buffered in the FIFO, but
+// reopens the FIFO itself by path on restore, so it has to exist again.
+type CheckpointFIFO struct {
+	// Path is the path of the FIFO inside the container.
+	Path string      `json:"path"`
+	Mode fs.FileMode `json:"mode"`
+	UID  int         `json:"uid"`
+	GID  int         `json:"gid"`
+}
+
+// containerPipes are the pipes and FIFOs open in the processes of a
+// container.
+type containerPipes struct {
+	// external are the pipes of which only one end is open in the
+	// container. Their other end belongs to a process CRIU does not dump.
+	external []string
+	fifos    []CheckpointFIFO
+}
+
+// inspectContainerPipes collects the pipes and FIFOs open in the processes
+// pids below procPath. The pipes connected to the standard streams of the
+// container init process initPid are left out, the runtime reconnects them
+// on restore. Processes exiting while being inspected are skipped.
+func inspectContainerPipes(procPath string, pids []int, initPid int) (*containerPipes, error) {
+	stdio := make(map[string]bool)
+	for fd := range 3 {
+		link, err := os.Readlink(filepath.Join(procPath, strconv.Itoa(initPid), "fd", strconv.Itoa(fd)))
+		if err == nil && strings.HasPrefix(link, "pipe:") {
+			stdio[link] = true
+		}
+	}
+
+	type pipeEnds struct {
+		read, write bool
+		users       []string
+	}
+	pipes := make(map[string]*pipeEnds)
+	var pipeOrder []string
+	result := &containerPipes{}
+	fifos := make(map[string]bool)
+	for _, pid := range pids {
+		fdDir := filepath.Join(procPath, strconv.Itoa(pid), "fd")
+		entries, err := os.ReadDir(fdDir)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		for _, entry := range entries {
+			link, err := os.Readlink(filepath.Join(fdDir, entry.Name()))
+			if err != nil {
+				continue
+			}
+			switch {
+			case strings.HasPrefix(link, "pipe:"):
+				if stdio[link] {
+					continue
+				}
+				flags, err := readFdFlags(filepath.Join(procPath, strconv.Itoa(pid), "fdinfo", entry.Name()))
+				if err != nil {
+					continue
+				}
+				ends, ok := pipes[link]
+				if !ok {
+					ends = &pipeEnds{}
+					pipes[link] = ends
+					pipeOrder = append(pipeOrder, link)
+				}
+				switch flags & unix.O_ACCMODE {
+				case unix.O_RDONLY:
+					ends.read = true
+				case unix.O_WRONLY:
+					ends.write = true
+				default:
+					ends.read = true
+					ends.write = true
+				}
+				ends.users = append(ends.users, fmt.Sprintf("pid %d fd %s", pid, entry.Name()))
+
+			case filepath.IsAbs(link) && !fifos[link]:
+				info, err := os.Stat(filepath.Join(fdDir, entry.Name()))
+				if err != nil || info.Mode()&fs.ModeNamedPipe == 0 {
+					continue
+				}
+				fifos[link] = true
+				fifo := CheckpointFIFO{Path: link, Mode: info.Mode().Perm()}
+				if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+					fifo.UID = int(stat.Uid)
+					fifo.GID = int(stat.Gid)
+				}
+				result.fifos = append(result.fifos, fifo)
+			}
+		}
+	}
+
+	for _, link := range pipeOrder {
+		if ends := pipes[link]; !ends.read || !ends.write {
+			result.external = append(result.external, fmt.Sprintf("%s (%s)", link, strings.Join(ends.users, ", ")))
+		}
+	}
+	return result, nil
+}
+
+// readFdFlags returns the flags the file descriptor has been opened with
+// from its /proc/<pid>/fdinfo/<fd> file.
+func readFdFlags(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if value, found := strings.CutPrefix(scanner.Text(), "flags:"); found {
+			flags, err := strconv.ParseInt(strings.TrimSpace(value), 8, 64)
+			return int(flags), err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("no flags in %s", path)
+}
+
+// checkContainerPipes fails if processes of the container with the init
+// process pid have pipes to processes outside of the container, which CRIU
+// cannot restore consistently. Pipes between processes of the container are
+// dumped by CRIU. It returns the FIFOs on volumes of the container, which
+// have to be recreated on restore.
+func checkContainerPipes(pid int, spec *rspec.Spec) ([]CheckpointFIFO, error) {
+	pids := append([]int{pid}, oci.DescendantProcesses(pid)...)
+	pipes, err := inspectContainerPipes("/proc", pids, pid)
+	if err != nil {
+		// Without information about the pipes, leave it to CRIU.
+		return nil, nil
+	}
+	if len(pipes.external) > 0 {
+		return nil, fmt.Errorf("%w: container has pipes to processes outside of the container: %s",
+			ErrCheckpointUnsupportedFeature, strings.Join(pipes.external, "; "))
+	}
+
+	var fifos []CheckpointFIFO
+	for _, fifo := range pipes.fifos {
+		// FIFOs in the root file system are part of its diff.
+		if volumeSource(spec, fifo.Path) != "" {
+			fifos = append(fifos, fifo)
+		}
+	}
+	return fifos, nil
+}
+
+// volumeSource returns the path on the host of path inside the container if
+// path is on a bind mount of spec, or an empty string otherwise.
+func volumeSource(spec *rspec.Spec, path string) string {
+	source, destination := "", ""
+	for _, m := range spec.Mounts {
+		if m.Type != bindMount || len(m.Destination) <= len(destination) {
+			continue
+		}
+		rel, err := filepath.Rel(m.Destination, path)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+			continue
+		}
+		source = filepath.Join(m.Source, rel)
+		destination = m.Destination
+	}
+	return source
+}
+
+// restoreFIFOs recreates the FIFOs on volumes which were open in the
+// processes of the checkpoint in dir, if they are missing, so that CRIU can
+// reopen them.
+func restoreFIFOs(dir string, spec *rspec.Spec) error {
+	info, err := ReadCheckpointInfo(dir)
+	if err != nil {
+		return err
+	}
+	for _, fifo := range info.FIFOs {
+		source := volumeSource(spec, fifo.Path)
+		if source == "" {
+			return fmt.Errorf("%w: FIFO %s is not on a volume of the restored container", ErrCheckpointUnsupportedFeature, fifo.Path)
+		}
+		existing, err := os.Lstat(source)
+		if err == nil {
+			if existing.Mode()&fs.ModeNamedPipe == 0 {
+				return fmt.Errorf("%w: FIFO %s of the checkpoint exists on the volume, but is not a FIFO", ErrCheckpointUnsupportedFeature, fifo.Path)
+			}
+			continue
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(source), 0o755); err != nil {
+			return fmt.Errorf("failed to recreate FIFO %s: %w", fifo.Path, err)
+		}
+		if err := unix.Mkfifo(source, uint32(fifo.Mode.Perm())); err != nil {
+			return fmt.Errorf("failed to recreate FIFO %s: %w", fifo.Path, err)
+		}
+		// The mode is subject to the umask.
+		if err := os.Chmod(source, fifo.Mode.Perm()); err != nil {
+			return fmt.Errorf("failed to recreate FIFO %s: %w", fifo.Path, err)
+		}
+		if err := os.Lchown(source, fifo.UID, fifo.GID); err != nil {
+			return fmt.Errorf("failed to recreate FIFO %s: %w", fifo.Path, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package lib
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	rspec "github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
+)
+
+// writeFakeFd creates the /proc entries of the file descriptor fd of pid
+// below procPath, pointing to target and opened with the octal flags.
+func writeFakeFd(procPath, pid, fd, target, flags string) {
+	dir := filepath.Join(procPath, pid)
+	for _, sub := range []string{"fd", "fdinfo"} {
+		Expect(os.MkdirAll(filepath.Join(dir, sub), 0o755)).To(Succeed())
+	}
+	Expect(os.Symlink(target, filepath.Join(dir, "fd", fd))).To(Succeed())
+	fdinfo := "pos:\t0\nflags:\t" + flags + "\nmnt_id:\t15\n"
+	Expect(os.WriteFile(filepath.Join(dir, "fdinfo", fd), []byte(fdinfo), 0o644)).To(Succeed())
+}
+
+var _ = Describe("CheckpointPipes", func() {
+	It("should find external pipes and FIFOs", func() {
+		// Given
+		procPath := GinkgoT().TempDir()
+		fifo := filepath.Join(GinkgoT().TempDir(), "fifo")
+		Expect(unix.Mkfifo(fifo, 0o640)).To(Succeed())
+		// The standard streams of init are reconnected by the runtime, also
+		// when inherited by other processes.
+		writeFakeFd(procPath, "1", "1", "pipe:[100]", "01")
+		writeFakeFd(procPath, "2", "1", "pipe:[100]", "01")
+		// A pipe between two processes of the container.
+		writeFakeFd(procPath, "1", "3", "pipe:[200]", "0100000")
+		writeFakeFd(procPath, "2", "4", "pipe:[200]", "0100001")
+		// A pipe to a process outside of the container.
+		writeFakeFd(procPath, "2", "5", "pipe:[300]", "02000001")
+		// A FIFO open in two processes.
+		writeFakeFd(procPath, "1", "6", fifo, "0100000")
+		writeFakeFd(procPath, "2", "6", fifo, "0100001")
+		writeFakeFd(procPath, "2", "7", "/dev/null", "0100002")
+
+		// When
+		// Process 3 exited while being inspected.
+		pipes, err := inspectContainerPipes(procPath, []int{1, 2, 3}, 1)
+
+		// Then
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pipes.external).To(HaveLen(1))
+		Expect(pipes.external[0]).To(HavePrefix("pipe:[300] (pid 2 fd 5)"))
+		Expect(pipes.fifos).To(HaveLen(1))
+		Expect(pipes.fifos[0].Path).To(Equal(fifo))
+		Expect(pipes.fifos[0].Mode).To(BeEquivalentTo(0o640))
+	})
+
+	DescribeTable("volumeSource",
+		func(path, expected string) {
+			spec := &rspec.Spec{
+				Mounts: []rspec.Mount{
+					{Destination: "/data", Type: bindMount, Source: "/var/lib/volumes/data"},
+					{Destination: "/data/nested", Type: bindMount, Source: "/var/lib/volumes/nested"},
+					{Destination: "/proc", Type: "proc", Source: "proc"},
+				},
+			}
+			Expect(volumeSource(spec, path)).To(Equal(expected))
+		},
+		Entry("volume", "/data/fifo", "/var/lib/volumes/data/fifo"),
+		Entry("nested volume", "/data/nested/a/fifo", "/var/lib/volumes/nested/a/fifo"),
+		Entry("path with volume prefix", "/database/fifo", ""),
+		Entry("other mount type", "/proc/fifo", ""),
+		Entry("root file system", "/fifo", ""),
+	)
+
+	It("should restore the FIFOs", func() {
+		// Given
+		dir := GinkgoT().TempDir()
+		volume := GinkgoT().TempDir()
+		spec := &rspec.Spec{
+			Mounts: []rspec.Mount{{Destination: "/data", Type: bindMount, Source: volume}},
+		}
+		Expect(writeCheckpointInfo(dir, &CheckpointInfo{FIFOs: []CheckpointFIFO{{
+			Path: "/data/sub/fifo",
+			Mode: 0o620,
+			UID:  os.Getuid(),
+			GID:  os.Getgid(),
+		}}})).To(Succeed())
+		fifo := filepath.Join(volume, "sub", "fifo")
+
+		// When
+		Expect(restoreFIFOs(dir, spec)).To(Succeed())
+
+		// Then
+		restored, err := os.Lstat(fifo)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(restored.Mode() & fs.ModeNamedPipe).ToNot(BeZero())
+		Expect(restored.Mode().Perm()).To(Equal(os.FileMode(0o620)))
+		// Existing FIFOs are kept.
+		Expect(restoreFIFOs(dir, spec)).To(Succeed())
+
+		// When
+		Expect(os.Remove(fifo)).To(Succeed())
+		Expect(os.WriteFile(fifo, nil, 0o600)).To(Succeed())
+
+		// Then
+		Expect(restoreFIFOs(dir, spec)).To(MatchError(ErrCheckpointUnsupportedFeature))
+		Expect(restoreFIFOs(dir, &rspec.Spec{})).To(MatchError(ErrCheckpointUnsupportedFeature))
+	})
+})
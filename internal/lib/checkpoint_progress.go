@@ -0,0 +1,58 @@
+package lib
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path/filepath"
+)
+
+// checkpointProgressReader reports the percentage of the checkpoint archive
+// read from the underlying tar stream to report, each time it increases.
+type checkpointProgressReader struct {
+	io.Reader
+	total   int64
+	read    int64
+	percent int
+	report  func(percent int)
+}
+
+// newCheckpointProgressReader returns a reader of the tar stream input of the
+// files in dir, reporting the progress of reading it to report. The size of
+// the stream is estimated by the size of the regular files below names in
+// dir, which are included in the archive.
+func newCheckpointProgressReader(input io.Reader, dir string, names []string, report func(percent int)) io.Reader {
+	var total int64
+	for _, name := range names {
+		// Missing files are skipped by the tar stream as well.
+		_ = filepath.WalkDir(filepath.Join(dir, name), func(_ string, entry fs.DirEntry, err error) error {
+			if err != nil || !entry.Type().IsRegular() {
+				return nil
+			}
+			if info, err := entry.Info(); err == nil {
+				total += info.Size()
+			}
+			return nil
+		})
+	}
+	return &checkpointProgressReader{Reader: input, total: total, report: report}
+}
+
+func (r *checkpointProgressReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.read += int64(n)
+	percent := 100
+	// The headers of the tar stream exceed the estimate, only the end of
+	// the stream completes it.
+	if !errors.Is(err, io.EOF) {
+		percent = 99
+		if r.total > 0 {
+			percent = min(int(r.read*100/r.total), 99)
+		}
+	}
+	if percent > r.percent {
+		r.percent = percent
+		r.report(percent)
+	}
+	return n, err
+}
@@ -0,0 +1,42 @@
+package lib
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CheckpointProgress", func() {
+	It("should report the progress of the archive", func() {
+		// Given
+		dir := GinkgoT().TempDir()
+		Expect(os.Mkdir(filepath.Join(dir, "checkpoint"), 0o700)).To(Succeed())
+		for name, size := range map[string]int{"checkpoint/pages-1.img": 64 << 10, "spec.dump": 1 << 10, "excluded": 1 << 20} {
+			Expect(os.WriteFile(filepath.Join(dir, name), []byte(strings.Repeat("x", size)), 0o600)).To(Succeed())
+		}
+		input := tarTestDir(dir, "checkpoint", "spec.dump")
+		var reported []int
+
+		// When
+		// Missing files do not count.
+		reader := newCheckpointProgressReader(input, dir, []string{"checkpoint", "spec.dump", "missing"}, func(percent int) {
+			reported = append(reported, percent)
+		})
+		Expect(reader.(*checkpointProgressReader).total).To(BeEquivalentTo(65 << 10))
+		_, err := io.Copy(io.Discard, reader)
+
+		// Then
+		Expect(err).ToNot(HaveOccurred())
+		Expect(len(reported)).To(BeNumerically(">=", 2))
+		Expect(reported[len(reported)-1]).To(Equal(100))
+		for i := 1; i < len(reported); i++ {
+			Expect(reported[i]).To(BeNumerically(">", reported[i-1]))
+		}
+		// Only the end of the archive completes it.
+		Expect(reported[len(reported)-2]).To(BeNumerically("<=", 99))
+	})
+})
@@ -0,0 +1,113 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cri-o/cri-o/internal/log"
+)
+
+// checkpointPartPattern matches the file names of the parts of split
+// checkpoint archives.
+var checkpointPartPattern = regexp.MustCompile(`\.part-\d{4}$`)
+
+// retainedCheckpoint is a checkpoint archive in the checkpoint directory
+// together with the parts it has been split into.
+type retainedCheckpoint struct {
+	files   []string
+	size    int64
+	modTime time.Time
+}
+
+// EnforceCheckpointRetention removes the oldest checkpoint archives in dir
+// until at most maxCount archives of at most maxSize bytes in total are
+// left. Limits of 0 are not enforced. Split archives are removed together
+// with their parts. Hidden files, like archives which are still written, and
+// parts not referenced by a manifest are neither removed nor counted as
+// archives. It returns the size of the files left in dir.
+func EnforceCheckpointRetention(ctx context.Context, dir string, maxCount int, maxSize int64) (int64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	sizes := make(map[string]int64, len(entries))
+	modTimes := make(map[string]time.Time, len(entries))
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			// The file has been removed in the meantime.
+			continue
+		}
+		sizes[entry.Name()] = info.Size()
+		modTimes[entry.Name()] = info.ModTime()
+	}
+
+	var usage int64
+	checkpoints := make([]*retainedCheckpoint, 0, len(sizes))
+	for name, size := range sizes {
+		usage += size
+		if checkpointPartPattern.MatchString(name) {
+			continue
+		}
+		checkpoint := &retainedCheckpoint{files: []string{name}, size: size, modTime: modTimes[name]}
+		if manifest, err := readCheckpointManifest(filepath.Join(dir, name)); err == nil && manifest != nil {
+			for _, part := range manifest.Parts {
+				partName := filepath.Base(part.Name)
+				checkpoint.files = append(checkpoint.files, partName)
+				checkpoint.size += sizes[partName]
+			}
+		}
+		checkpoints = append(checkpoints, checkpoint)
+	}
+	sort.Slice(checkpoints, func(i, j int) bool {
+		if checkpoints[i].modTime.Equal(checkpoints[j].modTime) {
+			return checkpoints[i].files[0] < checkpoints[j].files[0]
+		}
+		return checkpoints[i].modTime.Before(checkpoints[j].modTime)
+	})
+	var total int64
+	for _, checkpoint := range checkpoints {
+		total += checkpoint.size
+	}
+	count := len(checkpoints)
+	var errs []error
+	for _, checkpoint := range checkpoints {
+		if (maxCount == 0 || count <= maxCount) && (maxSize == 0 || total <= maxSize) {
+			break
+		}
+		if err := removeRetainedCheckpoint(dir, checkpoint); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		log.Infof(ctx, "Removed checkpoint archive %s (%d bytes) exceeding the retention of %s", filepath.Join(dir, checkpoint.files[0]), checkpoint.size, dir)
+		count--
+		total -= checkpoint.size
+		usage -= checkpoint.size
+	}
+	return usage, errors.Join(errs...)
+}
+
+// removeRetainedCheckpoint removes the checkpoint archive, starting with its
+// manifest, so that it is not restored from with missing parts.
+func removeRetainedCheckpoint(dir string, checkpoint *retainedCheckpoint) error {
+	for _, name := range checkpoint.files {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("removing checkpoint archive: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package lib
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	json "github.com/json-iterator/go"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// writeRetainedFile writes content to the file name in dir, modified age ago.
+func writeRetainedFile(dir, name string, content []byte, age time.Duration) {
+	path := filepath.Join(dir, name)
+	Expect(os.WriteFile(path, content, 0o600)).To(Succeed())
+	modTime := time.Now().Add(-age)
+	Expect(os.Chtimes(path, modTime, modTime)).To(Succeed())
+}
+
+var _ = Describe("CheckpointRetention", func() {
+	var dir string
+
+	// Two regular archives, a split archive between them, a hidden archive
+	// in progress and a part without manifest.
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		writeRetainedFile(dir, "oldest.tar", make([]byte, 100), 3*time.Hour)
+		manifest, err := json.Marshal(&CheckpointManifest{
+			MediaType: CheckpointManifestMediaType,
+			Parts:     []CheckpointPart{{Name: "split.tar.abc.part-0000"}, {Name: "split.tar.abc.part-0001"}},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		writeRetainedFile(dir, "split.tar", manifest, 2*time.Hour)
+		writeRetainedFile(dir, "split.tar.abc.part-0000", make([]byte, 100), 2*time.Hour)
+		writeRetainedFile(dir, "split.tar.abc.part-0001", make([]byte, 100), 2*time.Hour)
+		writeRetainedFile(dir, "newest.tar", make([]byte, 100), time.Hour)
+		writeRetainedFile(dir, ".newer.tar.tmp123", make([]byte, 1000), 4*time.Hour)
+		writeRetainedFile(dir, "pending.tar.def.part-0000", make([]byte, 10), 4*time.Hour)
+	})
+
+	It("should limit the number of archives", func() {
+		// When
+		usage, err := EnforceCheckpointRetention(context.Background(), dir, 1, 0)
+
+		// Then
+		Expect(err).ToNot(HaveOccurred())
+		Expect(testDirEntries(dir)).To(Equal([]string{".newer.tar.tmp123", "newest.tar", "pending.tar.def.part-0000"}))
+		Expect(usage).To(BeEquivalentTo(110))
+	})
+
+	It("should limit the size of the archives", func() {
+		// When
+		// With its manifest, the split archive has more than 200 bytes, so that
+		// the archives have more than 500 bytes until the oldest is removed.
+		_, err := EnforceCheckpointRetention(context.Background(), dir, 0, 500)
+
+		// Then
+		Expect(err).ToNot(HaveOccurred())
+		Expect(testDirEntries(dir)).To(Equal([]string{
+			".newer.tar.tmp123", "newest.tar", "pending.tar.def.part-0000",
+			"split.tar", "split.tar.abc.part-0000", "split.tar.abc.part-0001",
+		}))
+	})
+
+	It("should keep all archives without limits", func() {
+		// Given
+		before := testDirEntries(dir)
+
+		// When
+		_, err := EnforceCheckpointRetention(context.Background(), dir, 0, 0)
+
+		// Then
+		Expect(err).ToNot(HaveOccurred())
+		Expect(testDirEntries(dir)).To(Equal(before))
+	})
+
+	It("should treat a missing directory as empty", func() {
+		Expect(EnforceCheckpointRetention(context.Background(), filepath.Join(dir, "missing"), 1, 1)).To(BeZero())
+	})
+})
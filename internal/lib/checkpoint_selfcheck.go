@@ -0,0 +1,269 @@
+package lib
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/checkpoint-restore/go-criu/v7"
+	"github.com/checkpoint-restore/go-criu/v7/rpc"
+	criuutils "github.com/checkpoint-restore/go-criu/v7/utils"
+	"google.golang.org/protobuf/proto"
+
+	libconfig "github.com/cri-o/cri-o/pkg/config"
+)
+
+// CheckpointCheck is the result of a single check of CheckpointSelfCheck.
+type CheckpointCheck struct {
+	// Name identifies the check.
+	Name string `json:"name"`
+	// Passed is set if the prerequisite is met.
+	Passed bool `json:"passed"`
+	// Required is set if checkpoint/restore does not work at all without
+	// the prerequisite. Otherwise, only some features are not available.
+	Required bool `json:"required"`
+	// Message describes the result of the check.
+	Message string `json:"message"`
+	// Remediation describes how to meet the prerequisite if the check
+	// failed.
+	Remediation string `json:"remediation,omitempty"`
+}
+
+// CheckpointSelfCheckReport is the result of CheckpointSelfCheck.
+type CheckpointSelfCheckReport struct {
+	Checks []CheckpointCheck `json:"checks"`
+}
+
+// Passed returns whether all required checks passed.
+func (r *CheckpointSelfCheckReport) Passed() bool {
+	for _, check := range r.Checks {
+		if check.Required && !check.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+// checkpointSelfCheck runs the checks of CheckpointSelfCheck. Its fields
+// access the host, so that tests can inject failures.
+type checkpointSelfCheck struct {
+	// criuVersion returns the version of the installed CRIU.
+	criuVersion func() (int, error)
+	// criuFeatures probes the optional features of CRIU and the kernel.
+	criuFeatures func() (*rpc.CriuFeatures, error)
+	// runCommand runs the command, failing if it exits unsuccessfully.
+	runCommand func(name string, args ...string) error
+	// procDir is the mount point of procfs.
+	procDir string
+}
+
+// CheckpointSelfCheck checks the prerequisites of checkpointing and restoring
+// containers with the configuration: the CRIU installation, the directories
+// written during checkpoint and restore, the default runtime and the kernel.
+// The checks run even if checkpoint/restore support is disabled, as they are
+// meant to find out why it is not available.
+func CheckpointSelfCheck(config *libconfig.Config) *CheckpointSelfCheckReport {
+	c := criu.MakeCriu()
+	return (&checkpointSelfCheck{
+		criuVersion: c.GetCriuVersion,
+		criuFeatures: func() (*rpc.CriuFeatures, error) {
+			return c.FeatureCheck(&rpc.CriuFeatures{
+				MemTrack:   proto.Bool(true),
+				LazyPages:  proto.Bool(true),
+				PidfdStore: proto.Bool(true),
+			})
+		},
+		runCommand: func(name string, args ...string) error {
+			output, err := exec.Command(name, args...).CombinedOutput()
+			if err != nil && len(output) > 0 {
+				return fmt.Errorf("%w: %s", err, bytes.TrimSpace(output))
+			}
+			return err
+		},
+		procDir: "/proc",
+	}).run(config)
+}
+
+func (s *checkpointSelfCheck) run(config *libconfig.Config) *CheckpointSelfCheckReport {
+	report := &CheckpointSelfCheckReport{}
+	report.Checks = append(report.Checks, s.checkConfig(config), s.checkCriu())
+	report.Checks = append(report.Checks, s.checkDirectories(config)...)
+	report.Checks = append(report.Checks,
+		s.checkRuntime(config),
+		s.checkKernel(),
+		s.checkSoftDirty(),
+	)
+	return report
+}
+
+// checkConfig checks whether checkpoint/restore support is enabled.
+func (s *checkpointSelfCheck) checkConfig(config *libconfig.Config) CheckpointCheck {
+	check := CheckpointCheck{Name: "config", Required: true}
+	if !config.EnableCriuSupport {
+		check.Message = "checkpoint/restore support is disabled"
+		check.Remediation = "set enable_criu_support = true; if it is set, the log of CRI-O names the failed prerequisite"
+		return check
+	}
+	check.Passed = true
+	check.Message = "checkpoint/restore support is enabled"
+	return check
+}
+
+// checkCriu runs the CRIU feature probe.
+func (s *checkpointSelfCheck) checkCriu() CheckpointCheck {
+	check := CheckpointCheck{Name: "criu", Required: true}
+	version, err := s.criuVersion()
+	if err != nil {
+		check.Message = fmt.Sprintf("unable to run CRIU: %v", err)
+		check.Remediation = "install CRIU and make sure the criu binary is in the $PATH of CRI-O"
+		return check
+	}
+	if version < criuutils.PodCriuVersion {
+		check.Message = fmt.Sprintf("CRIU %d is too old", version)
+		check.Remediation = fmt.Sprintf("update CRIU to version %d or newer", criuutils.PodCriuVersion)
+		return check
+	}
+	features, err := s.criuFeatures()
+	if err != nil {
+		check.Message = fmt.Sprintf("CRIU %d failed to check for features: %v", version, err)
+		check.Remediation = "run 'criu check' to find out which prerequisite of CRIU is not met"
+		return check
+	}
+	check.Passed = true
+	check.Message = fmt.Sprintf("CRIU %d (memory tracking: %v, lazy pages: %v, pidfd store: %v)",
+		version, features.GetMemTrack(), features.GetLazyPages(), features.GetPidfdStore())
+	return check
+}
+
+// checkDirectories checks whether the directories written by checkpoints and
+// restores are writable: the run root holding the checkpoint images and
+// logs of CRIU, the temporary directory archives are extracted to, and the
+// directory of crash dumps.
+func (s *checkpointSelfCheck) checkDirectories(config *libconfig.Config) []CheckpointCheck {
+	dirs := []struct {
+		name, dir string
+	}{
+		{"runroot", config.RunRoot},
+		{"tmpdir", os.TempDir()},
+		{"crash_dump_dir", config.CrashDumpDir},
+	}
+	checks := make([]CheckpointCheck, 0, len(dirs))
+	for _, d := range dirs {
+		if d.dir == "" {
+			continue
+		}
+		check := CheckpointCheck{Name: "directory " + d.name, Required: true}
+		if err := checkDirWritable(d.dir); err != nil {
+			check.Message = fmt.Sprintf("%s is not writable: %v", d.dir, err)
+			check.Remediation = fmt.Sprintf("make %s writable by CRI-O, or configure another directory", d.dir)
+		} else {
+			check.Passed = true
+			check.Message = d.dir + " is writable"
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+// checkDirWritable checks whether a file can be created in dir. If dir does
+// not exist yet, it is checked whether it can be created instead.
+func checkDirWritable(dir string) error {
+	for {
+		info, err := os.Stat(dir)
+		if err == nil {
+			if !info.IsDir() {
+				return fmt.Errorf("%s is not a directory", dir)
+			}
+			break
+		}
+		if !errors.Is(err, os.ErrNotExist) || filepath.Dir(dir) == dir {
+			return err
+		}
+		dir = filepath.Dir(dir)
+	}
+	file, err := os.CreateTemp(dir, ".crio-checkpoint-check")
+	if err != nil {
+		return err
+	}
+	file.Close()
+	return os.Remove(file.Name())
+}
+
+// checkRuntime checks whether the default runtime supports checkpointing.
+func (s *checkpointSelfCheck) checkRuntime(config *libconfig.Config) CheckpointCheck {
+	check := CheckpointCheck{Name: "runtime", Required: true}
+	handler, ok := config.Runtimes[config.DefaultRuntime]
+	if !ok {
+		check.Message = fmt.Sprintf("default runtime %q is not configured", config.DefaultRuntime)
+		check.Remediation = "configure the default runtime in the [crio.runtime.runtimes] table"
+		return check
+	}
+	if handler.RuntimeType == libconfig.RuntimeTypeVM {
+		check.Message = fmt.Sprintf("default runtime %q is a VM runtime, which does not support checkpointing", config.DefaultRuntime)
+		check.Remediation = "use an OCI runtime supporting checkpointing, like runc or crun"
+		return check
+	}
+	// Like ValidateRuntimePath, look up the runtime in the $PATH if no path
+	// is configured.
+	runtimePath := handler.RuntimePath
+	if runtimePath == "" {
+		runtimePath = config.DefaultRuntime
+	}
+	if err := s.runCommand(runtimePath, "checkpoint", "--help"); err != nil {
+		check.Message = fmt.Sprintf("%s does not support the checkpoint command: %v", runtimePath, err)
+		check.Remediation = "use a runtime built with checkpoint/restore support, like runc or crun with CRIU support"
+		return check
+	}
+	check.Passed = true
+	check.Message = runtimePath + " supports the checkpoint command"
+	return check
+}
+
+// checkKernel checks whether the kernel has been built with
+// CONFIG_CHECKPOINT_RESTORE, which provides ns_last_pid.
+func (s *checkpointSelfCheck) checkKernel() CheckpointCheck {
+	check := CheckpointCheck{Name: "kernel", Required: true}
+	path := filepath.Join(s.procDir, "sys", "kernel", "ns_last_pid")
+	if _, err := os.Stat(path); err != nil {
+		check.Message = fmt.Sprintf("the kernel does not provide %s: %v", path, err)
+		check.Remediation = "use a kernel built with CONFIG_CHECKPOINT_RESTORE=y"
+		return check
+	}
+	check.Passed = true
+	check.Message = "the kernel has been built with CONFIG_CHECKPOINT_RESTORE"
+	return check
+}
+
+// checkSoftDirty checks whether the kernel tracks memory changes with
+// soft-dirty bits, which is required for pre-dumps and incremental
+// checkpoints only. Clearing the soft-dirty bits of the own process fails
+// without CONFIG_MEM_SOFT_DIRTY.
+func (s *checkpointSelfCheck) checkSoftDirty() CheckpointCheck {
+	check := CheckpointCheck{Name: "soft-dirty"}
+	path := filepath.Join(s.procDir, "self", "clear_refs")
+	if err := writeClearRefs(path); err != nil {
+		check.Message = fmt.Sprintf("the kernel does not track memory changes: %v", err)
+		check.Remediation = "use a kernel built with CONFIG_MEM_SOFT_DIRTY=y to enable incremental checkpoints"
+		return check
+	}
+	check.Passed = true
+	check.Message = "the kernel tracks memory changes"
+	return check
+}
+
+// writeClearRefs clears the soft-dirty bits by writing to the existing
+// clear_refs file at path.
+func writeClearRefs(path string) error {
+	file, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := file.WriteString("4"); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
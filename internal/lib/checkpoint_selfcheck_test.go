@@ -0,0 +1,152 @@
+package lib
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/checkpoint-restore/go-criu/v7/rpc"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"google.golang.org/protobuf/proto"
+
+	libconfig "github.com/cri-o/cri-o/pkg/config"
+)
+
+// findCheckpointCheck returns the check with the given name of report.
+func findCheckpointCheck(report *CheckpointSelfCheckReport, name string) CheckpointCheck {
+	for _, check := range report.Checks {
+		if check.Name == name {
+			return check
+		}
+	}
+	Fail("check " + name + " not found")
+	return CheckpointCheck{}
+}
+
+// expectCheckpointCheckFailed checks that only the check with the given name
+// failed, and that a remediation hint is given.
+func expectCheckpointCheckFailed(report *CheckpointSelfCheckReport, name string) {
+	check := findCheckpointCheck(report, name)
+	Expect(check.Passed).To(BeFalse())
+	Expect(check.Remediation).ToNot(BeEmpty())
+	for _, other := range report.Checks {
+		if other.Name != name {
+			Expect(other.Passed).To(BeTrue(), other.Message)
+		}
+	}
+	Expect(report.Passed()).To(Equal(!check.Required))
+}
+
+var _ = Describe("CheckpointSelfCheck", func() {
+	var (
+		s      *checkpointSelfCheck
+		config *libconfig.Config
+	)
+
+	// The checks pass with the configuration until modified by a spec.
+	BeforeEach(func() {
+		procDir := GinkgoT().TempDir()
+		Expect(os.MkdirAll(filepath.Join(procDir, "sys", "kernel"), 0o755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(procDir, "sys", "kernel", "ns_last_pid"), []byte("1\n"), 0o644)).To(Succeed())
+		Expect(os.MkdirAll(filepath.Join(procDir, "self"), 0o755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(procDir, "self", "clear_refs"), nil, 0o200)).To(Succeed())
+
+		config = &libconfig.Config{}
+		config.EnableCriuSupport = true
+		config.RunRoot = GinkgoT().TempDir()
+		config.DefaultRuntime = "runc"
+		config.Runtimes = libconfig.Runtimes{"runc": &libconfig.RuntimeHandler{RuntimePath: "/usr/bin/runc"}}
+
+		s = &checkpointSelfCheck{
+			criuVersion: func() (int, error) { return 40000, nil },
+			criuFeatures: func() (*rpc.CriuFeatures, error) {
+				return &rpc.CriuFeatures{MemTrack: proto.Bool(true)}, nil
+			},
+			runCommand: func(string, ...string) error { return nil },
+			procDir:    procDir,
+		}
+	})
+
+	It("should pass", func() {
+		// When
+		report := s.run(config)
+
+		// Then
+		for _, check := range report.Checks {
+			Expect(check.Passed).To(BeTrue(), check.Message)
+		}
+		Expect(report.Passed()).To(BeTrue())
+	})
+
+	It("should fail if disabled", func() {
+		config.EnableCriuSupport = false
+		expectCheckpointCheckFailed(s.run(config), "config")
+	})
+
+	DescribeTable("should fail without CRIU",
+		func(inject func()) {
+			inject()
+			expectCheckpointCheckFailed(s.run(config), "criu")
+		},
+		Entry("missing", func() {
+			s.criuVersion = func() (int, error) { return 0, errors.New("criu not found") }
+		}),
+		Entry("too old", func() {
+			s.criuVersion = func() (int, error) { return 30000, nil }
+		}),
+		Entry("feature check failed", func() {
+			s.criuFeatures = func() (*rpc.CriuFeatures, error) { return nil, errors.New("check failed") }
+		}),
+	)
+
+	It("should fail for directories which cannot be written", func() {
+		// Given
+		// Missing directories are created below the first existing parent.
+		config.CrashDumpDir = filepath.Join(GinkgoT().TempDir(), "missing", "crash")
+		file := filepath.Join(GinkgoT().TempDir(), "file")
+		Expect(os.WriteFile(file, nil, 0o644)).To(Succeed())
+		config.RunRoot = file
+
+		// When
+		report := s.run(config)
+
+		// Then
+		expectCheckpointCheckFailed(report, "directory runroot")
+		Expect(findCheckpointCheck(report, "directory runroot").Message).To(ContainSubstring(file))
+		Expect(testDirEntries(filepath.Dir(filepath.Dir(config.CrashDumpDir)))).To(BeEmpty())
+	})
+
+	DescribeTable("should fail without runtime support",
+		func(inject func()) {
+			inject()
+			expectCheckpointCheckFailed(s.run(config), "runtime")
+		},
+		Entry("not configured", func() {
+			config.DefaultRuntime = "crun"
+		}),
+		Entry("VM runtime", func() {
+			config.Runtimes["runc"].RuntimeType = libconfig.RuntimeTypeVM
+		}),
+		Entry("checkpoint not supported", func() {
+			s.runCommand = func(string, ...string) error { return errors.New("unknown command checkpoint") }
+		}),
+	)
+
+	It("should fail without kernel support", func() {
+		Expect(os.Remove(filepath.Join(s.procDir, "sys", "kernel", "ns_last_pid"))).To(Succeed())
+		expectCheckpointCheckFailed(s.run(config), "kernel")
+	})
+
+	It("should pass without soft-dirty bits", func() {
+		// Given
+		Expect(os.Remove(filepath.Join(s.procDir, "self", "clear_refs"))).To(Succeed())
+
+		// When
+		report := s.run(config)
+
+		// Then
+		expectCheckpointCheckFailed(report, "soft-dirty")
+		Expect(report.Passed()).To(BeTrue())
+	})
+})
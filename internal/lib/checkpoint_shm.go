@@ -0,0 +1,150 @@
+package lib
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	metadata "github.com/checkpoint-restore/checkpointctl/lib"
+	"github.com/containers/storage/pkg/archive"
+	rspec "github.com/opencontainers/runtime-spec/specs-go"
+
+	"github.com/cri-o/cri-o/internal/lib/sandbox"
+)
+
+// devShmSource returns the source of the /dev/shm bind mount of the
+// container, or an empty string if the container uses /dev/shm of the host.
+func devShmSource(spec *rspec.Spec) string {
+	for _, m := range spec.Mounts {
+		if m.Destination != sandbox.DevShmPath || m.Type != bindMount {
+			continue
+		}
+		if filepath.Clean(m.Source) == sandbox.DevShmPath {
+			return ""
+		}
+		return m.Source
+	}
+	return ""
+}
+
+// exportDevShm writes the POSIX shared memory objects of the container,
+// which live in the /dev/shm of its pod, to DevShmCheckpointTar in dir.
+// CRIU treats /dev/shm as external bind mount and does not dump its content.
+// It returns false if there is nothing to export.
+func exportDevShm(dir string, spec *rspec.Spec) (exported bool, retErr error) {
+	source := devShmSource(spec)
+	if source == "" {
+		return false, nil
+	}
+	entries, err := os.ReadDir(source)
+	if err != nil {
+		return false, fmt.Errorf("failed to read shared memory of container: %w", err)
+	}
+	if len(entries) == 0 {
+		return false, nil
+	}
+
+	input, err := archive.TarWithOptions(source, &archive.TarOptions{
+		Compression:      archive.Uncompressed,
+		IncludeSourceDir: true,
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to read shared memory of container: %w", err)
+	}
+	defer input.Close()
+
+	tarPath := filepath.Join(dir, metadata.DevShmCheckpointTar)
+	out, err := os.OpenFile(tarPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return false, fmt.Errorf("failed to create %s: %w", tarPath, err)
+	}
+	defer func() {
+		if err := out.Close(); err != nil && retErr == nil {
+			retErr = err
+		}
+		if retErr != nil {
+			os.Remove(tarPath)
+		}
+	}()
+	if _, err := io.Copy(out, input); err != nil {
+		return false, fmt.Errorf("failed to write %s: %w", tarPath, err)
+	}
+	return true, nil
+}
+
+// restoreDevShm extracts the POSIX shared memory objects of an imported
+// checkpoint in dir into the /dev/shm of the restored container, where CRIU
+// expects them to reattach the mappings of the processes.
+func restoreDevShm(dir string, spec *rspec.Spec) error {
+	tarPath := filepath.Join(dir, metadata.DevShmCheckpointTar)
+	if _, err := os.Stat(tarPath); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			// The checkpointed container did not use POSIX shared memory.
+			return nil
+		}
+		return err
+	}
+	source := devShmSource(spec)
+	if source == "" {
+		return fmt.Errorf("%w: checkpoint contains shared memory, but the restored container uses /dev/shm of the host", ErrCheckpointUnsupportedFeature)
+	}
+	if err := archive.UntarPath(tarPath, source); err != nil {
+		return fmt.Errorf("failed to restore shared memory of container: %w", err)
+	}
+	return nil
+}
+
+// sysvShmMappings returns the number of SysV shared memory segments mapped
+// by the process pid.
+func sysvShmMappings(pid int) (int, error) {
+	f, err := os.Open(filepath.Join("/proc", strconv.Itoa(pid), "maps"))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return countSysvShmMappings(f)
+}
+
+// countSysvShmMappings counts the SysV shared memory segments in the
+// content of a /proc/<pid>/maps file. The kernel names their mappings
+// after the key of the segment, like "/SYSV0052e2c1".
+func countSysvShmMappings(r io.Reader) (int, error) {
+	scanner := bufio.NewScanner(r)
+	mappings := 0
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 6 && strings.HasPrefix(fields[5], "/SYSV") {
+			mappings++
+		}
+	}
+	return mappings, scanner.Err()
+}
+
+// checkSysvSharedMemory fails if the container uses SysV shared memory
+// segments which CRIU cannot checkpoint. CRIU dumps the segments together
+// with the IPC namespace of the container, which is not possible if the
+// container shares the IPC namespace of the host.
+func checkSysvSharedMemory(pid int) error {
+	containerIPC, err := os.Readlink(filepath.Join("/proc", strconv.Itoa(pid), "ns", "ipc"))
+	if err != nil {
+		// Without information about the namespace, leave it to CRIU.
+		return nil
+	}
+	hostIPC, err := os.Readlink("/proc/self/ns/ipc")
+	if err != nil || containerIPC != hostIPC {
+		return nil
+	}
+	mappings, err := sysvShmMappings(pid)
+	if err != nil {
+		return nil
+	}
+	if mappings > 0 {
+		return fmt.Errorf("%w: container maps %d SysV shared memory segments of the host IPC namespace", ErrCheckpointUnsupportedFeature, mappings)
+	}
+	return nil
+}
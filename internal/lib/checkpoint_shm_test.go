@@ -0,0 +1,90 @@
+package lib
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	metadata "github.com/checkpoint-restore/checkpointctl/lib"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	rspec "github.com/opencontainers/runtime-spec/specs-go"
+
+	"github.com/cri-o/cri-o/internal/lib/sandbox"
+)
+
+func shmTestSpec(source string) *rspec.Spec {
+	return &rspec.Spec{
+		Mounts: []rspec.Mount{
+			{Destination: "/proc", Type: "proc", Source: "proc"},
+			{Destination: sandbox.DevShmPath, Type: bindMount, Source: source},
+		},
+	}
+}
+
+var _ = Describe("CheckpointShm", func() {
+	It("should count the SysV mappings", func() {
+		maps := `55d0c6a00000-55d0c6a02000 r--p 00000000 fd:01 1835021                    /usr/bin/app
+7f1c2c000000-7f1c2c100000 rw-s 00000000 00:01 32768                      /SYSV0052e2c1 (deleted)
+7f1c2c200000-7f1c2c300000 rw-s 00000000 00:01 32769                      /SYSV00000000 (deleted)
+7f1c2c400000-7f1c2c500000 rw-s 00000000 00:19 12                         /dev/shm/posix
+7ffd5c1e0000-7ffd5c201000 rw-p 00000000 00:00 0                          [stack]
+7ffd5c3f0000-7ffd5c3f2000 rw-p 00000000 00:00 0
+`
+		Expect(countSysvShmMappings(strings.NewReader(maps))).To(Equal(2))
+	})
+
+	DescribeTable("devShmSource",
+		func(spec *rspec.Spec, expected string) {
+			Expect(devShmSource(spec)).To(Equal(expected))
+		},
+		Entry("shm of the pod", shmTestSpec("/run/containers/storage/pod/shm"), "/run/containers/storage/pod/shm"),
+		Entry("shm of the host", shmTestSpec(sandbox.DevShmPath+"/"), ""),
+		Entry("without shm mount", &rspec.Spec{}, ""),
+	)
+
+	It("should export and restore the shared memory", func() {
+		// Given
+		checkpointDir := GinkgoT().TempDir()
+		source := GinkgoT().TempDir()
+
+		// When
+		exported, err := exportDevShm(checkpointDir, shmTestSpec(source))
+
+		// Then
+		// Empty shared memory is not exported.
+		Expect(err).ToNot(HaveOccurred())
+		Expect(exported).To(BeFalse())
+
+		// When
+		Expect(os.WriteFile(filepath.Join(source, "segment"), []byte("shared"), 0o600)).To(Succeed())
+		exported, err = exportDevShm(checkpointDir, shmTestSpec(source))
+
+		// Then
+		Expect(err).ToNot(HaveOccurred())
+		Expect(exported).To(BeTrue())
+		Expect(filepath.Join(checkpointDir, metadata.DevShmCheckpointTar)).To(BeAnExistingFile())
+
+		// When
+		target := GinkgoT().TempDir()
+		Expect(restoreDevShm(checkpointDir, shmTestSpec(target))).To(Succeed())
+
+		// Then
+		Expect(os.ReadFile(filepath.Join(target, "segment"))).To(BeEquivalentTo("shared"))
+		Expect(restoreDevShm(checkpointDir, shmTestSpec(sandbox.DevShmPath))).To(MatchError(ErrCheckpointUnsupportedFeature))
+	})
+
+	It("should restore checkpoints without shared memory into any container", func() {
+		Expect(restoreDevShm(GinkgoT().TempDir(), shmTestSpec(sandbox.DevShmPath))).To(Succeed())
+	})
+
+	It("should accept processes without SysV shared memory", func() {
+		// The test process is in the IPC namespace it compares against, but
+		// maps no SysV segments.
+		Expect(checkSysvSharedMemory(os.Getpid())).To(Succeed())
+	})
+
+	It("should leave unknown processes to CRIU", func() {
+		Expect(checkSysvSharedMemory(-1)).To(Succeed())
+	})
+})
@@ -0,0 +1,512 @@
+package lib
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/containers/storage/pkg/archive"
+	"github.com/containers/storage/pkg/stringid"
+	json "github.com/json-iterator/go"
+	"github.com/opencontainers/go-digest"
+
+	"github.com/cri-o/cri-o/internal/log"
+)
+
+// CheckpointManifestMediaType identifies the manifest of a checkpoint archive
+// which has been split into several parts. It is versioned independently of
+// CheckpointFormatVersion and has to be bumped for every change of the
+// manifest which older versions cannot read.
+//
+// Version 2: the manifest records the format version of the archive
+// (FormatVersion) and the size of its parts (ChunkSize).
+const CheckpointManifestMediaType = "application/vnd.cri-o.checkpoint.manifest.v2+json"
+
+// checkpointManifestMediaTypeV1 identifies the manifests written before
+// version 2, which are still read.
+const checkpointManifestMediaTypeV1 = "application/vnd.cri-o.checkpoint.manifest.v1+json"
+
+// checkpointPartAttempts is the number of times a part of a split checkpoint
+// archive is written to an object store before the checkpoint fails.
+const checkpointPartAttempts = 3
+
+// checkpointPartRetryDelay is the delay before a part is written again, it
+// doubles with every attempt. It is replaced by tests.
+var checkpointPartRetryDelay = time.Second
+
+// ErrCheckpointPartMissing is returned if a part of a split checkpoint
+// archive cannot be found next to its manifest.
+var ErrCheckpointPartMissing = errors.New("checkpoint archive part missing")
+
+// CheckpointManifest ties together the parts of a checkpoint archive which
+// has been split because of ArchivePartSize. It is written to the target
+// file of the checkpoint instead of the archive itself.
+type CheckpointManifest struct {
+	MediaType string `json:"mediaType"`
+	// FormatVersion is the format version of the archive, see
+	// CheckpointFormatVersion. It allows rejecting an archive which is too
+	// new before any part has been read. It is zero for manifests of
+	// version 1.
+	FormatVersion int `json:"formatVersion,omitempty"`
+	// ChunkSize is the size of every part but the last one.
+	ChunkSize int64 `json:"chunkSize,omitempty"`
+	// Parts are the parts of the archive in order. Concatenated, they form
+	// the checkpoint archive.
+	Parts []CheckpointPart `json:"parts"`
+}
+
+// CheckpointPart is a part of a split checkpoint archive.
+type CheckpointPart struct {
+	// Name is the file name of the part, relative to the manifest.
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	Digest string `json:"digest"`
+}
+
+// checkpointPartRef returns the reference of the part name of the split
+// checkpoint archive ref in its store, which is next to ref.
+func checkpointPartRef(ref, name string) string {
+	return ref[:strings.LastIndex(ref, "/")+1] + filepath.Base(name)
+}
+
+// writeSplitCheckpointArchive writes the archive read from input into parts
+// of at most ArchivePartSize bytes next to ref in store and publishes the
+// manifest referencing them at ref. The parts are named uniquely, so the
+// parts of an overwritten checkpoint are not modified before the new
+// manifest has been published.
+//
+// Local parts are streamed to disk. Parts written to an object store are
+// spooled to a temporary file first, so that a failed upload is resumed by
+// sending only the failed part again, unless the store holds it intact
+// already, instead of starting the export over.
+func writeSplitCheckpointArchive(ctx context.Context, store CheckpointStore, ref string, input io.Reader, opts *ContainerCheckpointOptions) (retErr error) {
+	var previous *CheckpointManifest
+	if opts.Overwrite {
+		// Only a split archive has parts to be removed once it is replaced.
+		previous, _ = readCheckpointStoreManifest(ctx, store, ref)
+	}
+
+	w := &checkpointPartWriter{
+		ctx:      ctx,
+		store:    store,
+		ref:      ref,
+		prefix:   filepath.Base(ref) + "." + stringid.GenerateNonCryptoID()[:12],
+		input:    bufio.NewReader(input),
+		partSize: opts.ArchivePartSize,
+	}
+	if IsRemoteCheckpointLocation(ref) {
+		w.attempts = checkpointPartAttempts
+	}
+	defer func() {
+		if retErr != nil {
+			removeCheckpointParts(ctx, store, ref, w.parts)
+		}
+	}()
+	for {
+		more, err := w.writePart()
+		if err != nil {
+			return fmt.Errorf("error writing checkpoint export file %q: %w", ref, err)
+		}
+		if !more {
+			break
+		}
+	}
+
+	manifest, err := json.Marshal(&CheckpointManifest{
+		MediaType:     CheckpointManifestMediaType,
+		FormatVersion: opts.archiveFormatVersion,
+		ChunkSize:     opts.ArchivePartSize,
+		Parts:         w.parts,
+	})
+	if err != nil {
+		return err
+	}
+	if err := w.send(ref, checkpointPartOf("", manifest), func() (io.Reader, error) {
+		return bytes.NewReader(manifest), nil
+	}); err != nil {
+		return err
+	}
+
+	if previous != nil {
+		removeCheckpointParts(ctx, store, ref, previous.Parts)
+	}
+	return nil
+}
+
+// checkpointPartWriter writes the parts of a split checkpoint archive.
+type checkpointPartWriter struct {
+	ctx    context.Context
+	store  CheckpointStore
+	ref    string
+	prefix string
+	input  *bufio.Reader
+	// partSize is the size of every part but the last one.
+	partSize int64
+	// attempts is the number of times a part is written before failing, a
+	// part is written once if zero.
+	attempts int
+	parts    []CheckpointPart
+}
+
+// writePart writes the next part of the archive. It returns false once the
+// whole archive has been written.
+func (w *checkpointPartWriter) writePart() (bool, error) {
+	if _, err := w.input.Peek(1); err != nil {
+		if errors.Is(err, io.EOF) {
+			return false, nil
+		}
+		return false, err
+	}
+	name := fmt.Sprintf("%s.part-%04d", w.prefix, len(w.parts))
+	ref := checkpointPartRef(w.ref, name)
+	content := io.LimitReader(w.input, w.partSize)
+	digester := &checkpointPartDigester{digester: digest.Canonical.Digester()}
+	// Record the part first, so that it is removed on failure.
+	w.parts = append(w.parts, CheckpointPart{Name: name})
+
+	if w.attempts == 0 {
+		if err := w.send(ref, CheckpointPart{}, func() (io.Reader, error) {
+			return io.TeeReader(content, digester), nil
+		}); err != nil {
+			return false, err
+		}
+		w.parts[len(w.parts)-1] = digester.part(name)
+		return true, nil
+	}
+
+	spool, err := os.CreateTemp("", "crio-checkpoint-part")
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		spool.Close()
+		os.Remove(spool.Name())
+	}()
+	if _, err := io.Copy(io.MultiWriter(spool, digester), content); err != nil {
+		return false, err
+	}
+	part := digester.part(name)
+	w.parts[len(w.parts)-1] = part
+	return true, w.send(ref, part, func() (io.Reader, error) {
+		_, err := spool.Seek(0, io.SeekStart)
+		return spool, err
+	})
+}
+
+// send writes the content returned by open to ref. A failed write is
+// repeated up to attempts times after a growing delay, with the content
+// returned by open again, unless ref already holds part intact, which
+// happens if only the response to a successful write has been lost.
+func (w *checkpointPartWriter) send(ref string, part CheckpointPart, open func() (io.Reader, error)) error {
+	delay := checkpointPartRetryDelay
+	for attempt := 1; ; attempt++ {
+		content, err := open()
+		if err != nil {
+			return err
+		}
+		err = writeCheckpointStoreArchive(w.ctx, w.store, ref, content)
+		if err == nil || attempt >= w.attempts || errors.Is(err, ErrCheckpointArchiveExists) {
+			return err
+		}
+		log.Warnf(w.ctx, "Unable to write checkpoint archive part %s, retrying in %v: %v", ref, delay, err)
+		select {
+		case <-w.ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay *= 2
+		if checkpointPartIntact(w.ctx, w.store, ref, part) {
+			return nil
+		}
+	}
+}
+
+// checkpointPartDigester computes the size and digest of a part written to it.
+type checkpointPartDigester struct {
+	digester digest.Digester
+	size     int64
+}
+
+func (d *checkpointPartDigester) Write(p []byte) (int, error) {
+	d.size += int64(len(p))
+	return d.digester.Hash().Write(p)
+}
+
+// part returns the part name with the size and digest of the data written.
+func (d *checkpointPartDigester) part(name string) CheckpointPart {
+	return CheckpointPart{Name: name, Size: d.size, Digest: d.digester.Digest().String()}
+}
+
+// checkpointPartOf returns the part name holding content.
+func checkpointPartOf(name string, content []byte) CheckpointPart {
+	return CheckpointPart{Name: name, Size: int64(len(content)), Digest: digest.FromBytes(content).String()}
+}
+
+// checkpointPartIntact returns whether ref in store holds part with the
+// expected size and digest.
+func checkpointPartIntact(ctx context.Context, store CheckpointStore, ref string, part CheckpointPart) bool {
+	if part.Digest == "" {
+		return false
+	}
+	reader, err := store.Reader(ctx, ref)
+	if err != nil {
+		return false
+	}
+	defer reader.Close()
+	digester := &checkpointPartDigester{digester: digest.Canonical.Digester()}
+	if _, err := io.Copy(digester, reader); err != nil {
+		return false
+	}
+	return digester.size == part.Size && digester.digester.Digest().String() == part.Digest
+}
+
+// removeCheckpointParts removes the parts of the split checkpoint archive ref
+// from store.
+func removeCheckpointParts(ctx context.Context, store CheckpointStore, ref string, parts []CheckpointPart) {
+	// The parts have to be removed even if the checkpoint was cancelled.
+	ctx = context.WithoutCancel(ctx)
+	for _, part := range parts {
+		partRef := checkpointPartRef(ref, part.Name)
+		if err := store.Remove(ctx, partRef); err != nil {
+			log.Warnf(ctx, "Unable to remove checkpoint archive part %s: %v", partRef, err)
+		}
+	}
+}
+
+// readCheckpointStoreManifest reads the manifest of the split checkpoint
+// archive ref in store. It returns nil without error if ref is a regular
+// checkpoint archive.
+func readCheckpointStoreManifest(ctx context.Context, store CheckpointStore, ref string) (*CheckpointManifest, error) {
+	reader, err := store.Reader(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return decodeCheckpointManifest(bufio.NewReader(reader))
+}
+
+// readCheckpointManifest reads the manifest of a split checkpoint archive at
+// path. It returns nil without error if path is a regular checkpoint archive.
+func readCheckpointManifest(path string) (*CheckpointManifest, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return decodeCheckpointManifest(bufio.NewReader(file))
+}
+
+// decodeCheckpointManifest decodes the manifest of a split checkpoint archive
+// from r. It returns nil without error and without consuming r if r starts
+// with a regular checkpoint archive.
+func decodeCheckpointManifest(r *bufio.Reader) (*CheckpointManifest, error) {
+	// A tar archive starts with the name of its first entry.
+	start, err := r.Peek(1)
+	if err != nil || start[0] != '{' {
+		return nil, nil
+	}
+	manifest := &CheckpointManifest{}
+	if err := json.NewDecoder(r).Decode(manifest); err != nil {
+		return nil, fmt.Errorf("failed to decode checkpoint manifest: %w", err)
+	}
+	switch manifest.MediaType {
+	case checkpointManifestMediaTypeV1:
+	case CheckpointManifestMediaType:
+		if manifest.FormatVersion > CheckpointFormatVersion {
+			return nil, fmt.Errorf("%w: archive has version %d, supported up to %d", ErrCheckpointFormatTooNew, manifest.FormatVersion, CheckpointFormatVersion)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported checkpoint manifest media type %q", manifest.MediaType)
+	}
+	return manifest, nil
+}
+
+// OpenCheckpointArchive opens the checkpoint archive at path for reading.
+// If the archive has been split into several parts, path is its manifest and
+// the returned reader streams the parts one after another, verifying the
+// size and digest of every part once it has been read completely.
+// If the archive is an OCI image layout archive, the returned reader streams
+// the native archive held by its layer.
+func OpenCheckpointArchive(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open checkpoint archive %s: %w", path, err)
+	}
+	reader := bufio.NewReader(file)
+	manifest, err := decodeCheckpointManifest(reader)
+	if err != nil || manifest == nil {
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if header, _ := reader.Peek(512); isOCILayoutArchive(header) {
+			layer, err := openOCICheckpointLayer(file)
+			if err != nil {
+				file.Close()
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			return layer, nil
+		}
+		return struct {
+			io.Reader
+			io.Closer
+		}{reader, file}, nil
+	}
+	file.Close()
+
+	dir := filepath.Dir(path)
+	// Fail before anything has been extracted if the archive is incomplete.
+	for _, part := range manifest.Parts {
+		partPath := filepath.Join(dir, filepath.Base(part.Name))
+		if _, err := os.Stat(partPath); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil, fmt.Errorf("%w: %s of %s", ErrCheckpointPartMissing, partPath, path)
+			}
+			return nil, err
+		}
+	}
+	return ReassembleCheckpointArchive(manifest, func(name string) (io.ReadCloser, error) {
+		partPath := filepath.Join(dir, name)
+		file, err := os.Open(partPath)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil, fmt.Errorf("%w: %s", ErrCheckpointPartMissing, partPath)
+			}
+			return nil, fmt.Errorf("failed to open checkpoint archive part %s: %w", partPath, err)
+		}
+		return file, nil
+	}), nil
+}
+
+// openCheckpointStoreArchive opens the checkpoint archive ref in store for
+// reading, reassembling it from its parts if it has been split.
+func openCheckpointStoreArchive(ctx context.Context, store CheckpointStore, ref string) (io.ReadCloser, error) {
+	object, err := store.Reader(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	reader := bufio.NewReader(object)
+	manifest, err := decodeCheckpointManifest(reader)
+	if err != nil || manifest == nil {
+		if err != nil {
+			object.Close()
+			return nil, fmt.Errorf("%s: %w", ref, err)
+		}
+		return struct {
+			io.Reader
+			io.Closer
+		}{reader, object}, nil
+	}
+	object.Close()
+
+	return ReassembleCheckpointArchive(manifest, func(name string) (io.ReadCloser, error) {
+		partRef := checkpointPartRef(ref, name)
+		part, err := store.Reader(ctx, partRef)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%w: %s", ErrCheckpointPartMissing, partRef)
+		}
+		return part, err
+	}), nil
+}
+
+// ReassembleCheckpointArchive returns a reader of the checkpoint archive split
+// into the parts of manifest, which streams the parts one after another.
+// Every part is opened by its name with open once the previous one has been
+// read, and its size and digest are verified once it has been read
+// completely. It allows consumers of split archives, like the restore or
+// uploads to other stores, to process them without a temporary copy.
+func ReassembleCheckpointArchive(manifest *CheckpointManifest, open func(name string) (io.ReadCloser, error)) io.ReadCloser {
+	return &checkpointPartReader{open: open, parts: manifest.Parts}
+}
+
+// checkpointPartReader reads the parts of a split checkpoint archive in order.
+type checkpointPartReader struct {
+	open  func(name string) (io.ReadCloser, error)
+	parts []CheckpointPart
+
+	// file is the part currently read, which has returned size bytes.
+	file     io.ReadCloser
+	size     int64
+	digester digest.Digester
+}
+
+func (r *checkpointPartReader) Read(p []byte) (int, error) {
+	for {
+		if r.file == nil {
+			if len(r.parts) == 0 {
+				return 0, io.EOF
+			}
+			if err := r.openPart(); err != nil {
+				return 0, err
+			}
+		}
+		n, err := r.file.Read(p)
+		r.size += int64(n)
+		r.digester.Hash().Write(p[:n])
+		if errors.Is(err, io.EOF) {
+			if err := r.finishPart(); err != nil {
+				return n, err
+			}
+			if n == 0 {
+				continue
+			}
+			return n, nil
+		}
+		return n, err
+	}
+}
+
+// openPart opens the next part.
+func (r *checkpointPartReader) openPart() error {
+	file, err := r.open(filepath.Base(r.parts[0].Name))
+	if err != nil {
+		return err
+	}
+	r.file = file
+	r.size = 0
+	r.digester = digest.Canonical.Digester()
+	return nil
+}
+
+// finishPart verifies the part which has been read completely.
+func (r *checkpointPartReader) finishPart() error {
+	part := r.parts[0]
+	r.parts = r.parts[1:]
+	r.file.Close()
+	r.file = nil
+	if r.size != part.Size || r.digester.Digest().String() != part.Digest {
+		return fmt.Errorf("checkpoint archive part %s has been modified, expected %d bytes with digest %s but got %d bytes with digest %s",
+			part.Name, part.Size, part.Digest, r.size, r.digester.Digest())
+	}
+	return nil
+}
+
+func (r *checkpointPartReader) Close() error {
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+// untarCheckpointArchive extracts the checkpoint archive at path read from
+// input into dest.
+func untarCheckpointArchive(dest, path string, input io.Reader, options *archive.TarOptions) error {
+	if err := archive.Untar(input, dest, options); err != nil {
+		return fmt.Errorf("unpacking of checkpoint archive %s failed: %w", path, err)
+	}
+	// Read the trailing padding of the archive, which verifies the last
+	// part of a split archive.
+	if _, err := io.Copy(io.Discard, input); err != nil {
+		return fmt.Errorf("failed to read checkpoint archive %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package lib
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/containers/storage/pkg/archive"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// readCheckpointArchive returns the content of the checkpoint archive at path.
+func readCheckpointArchive(path string) ([]byte, error) {
+	input, err := OpenCheckpointArchive(path)
+	if err != nil {
+		return nil, err
+	}
+	defer input.Close()
+	return io.ReadAll(input)
+}
+
+// importTestCheckpoint imports the checkpoint archive at path into a new
+// directory and returns it.
+func importTestCheckpoint(path string) string {
+	dest := GinkgoT().TempDir()
+	Expect((&ContainerServer{}).importCheckpointLocation(context.Background(), dest, path, &archive.TarOptions{})).To(Succeed())
+	return dest
+}
+
+var _ = Describe("CheckpointSplit", func() {
+	var target string
+
+	BeforeEach(func() {
+		target = filepath.Join(GinkgoT().TempDir(), "checkpoint.tar")
+	})
+
+	It("should split the archive into parts", func() {
+		// Given
+		content := bytes.Repeat([]byte("0123456789"), 9)
+		content = append(content, "abcde"...)
+		opts := &ContainerCheckpointOptions{TargetFile: target, ArchivePartSize: 10}
+
+		// When
+		Expect(writeCheckpointArchive(context.Background(), bytes.NewReader(content), opts)).To(Succeed())
+
+		// Then
+		manifest, err := readCheckpointManifest(target)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(manifest).ToNot(BeNil())
+		Expect(manifest.Parts).To(HaveLen(10))
+		Expect(manifest.MediaType).To(Equal(CheckpointManifestMediaType))
+		Expect(manifest.ChunkSize).To(BeEquivalentTo(10))
+		for i, part := range manifest.Parts {
+			expected := int64(10)
+			if i == len(manifest.Parts)-1 {
+				expected = 5
+			}
+			info, err := os.Stat(filepath.Join(filepath.Dir(target), part.Name))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(info.Size()).To(Equal(expected))
+			Expect(part.Size).To(Equal(expected))
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0o600)))
+		}
+		Expect(readCheckpointArchive(target)).To(Equal(content))
+
+		// When
+		// Replacing a split archive removes the parts of the old one.
+		opts.Overwrite = true
+		Expect(writeCheckpointArchive(context.Background(), strings.NewReader("replaced"), opts)).To(Succeed())
+
+		// Then
+		Expect(testDirEntries(filepath.Dir(target))).To(HaveLen(2))
+		Expect(readCheckpointArchive(target)).To(BeEquivalentTo("replaced"))
+	})
+
+	It("should detect modified and missing parts", func() {
+		// Given
+		opts := &ContainerCheckpointOptions{TargetFile: target, ArchivePartSize: 4}
+		Expect(writeCheckpointArchive(context.Background(), strings.NewReader("checkpoint"), opts)).To(Succeed())
+		manifest, err := readCheckpointManifest(target)
+		Expect(err).ToNot(HaveOccurred())
+
+		// When
+		modified := filepath.Join(filepath.Dir(target), manifest.Parts[1].Name)
+		Expect(os.WriteFile(modified, []byte("poin"), 0o600)).To(Succeed())
+
+		// Then
+		_, err = readCheckpointArchive(target)
+		Expect(err).To(MatchError(ContainSubstring("has been modified")))
+
+		// When
+		missing := filepath.Join(filepath.Dir(target), manifest.Parts[2].Name)
+		Expect(os.Remove(missing)).To(Succeed())
+
+		// Then
+		_, err = OpenCheckpointArchive(target)
+		Expect(err).To(MatchError(ErrCheckpointPartMissing))
+		Expect(err).To(MatchError(ContainSubstring(missing)))
+	})
+
+	DescribeTable("should decode the manifest",
+		func(manifest string) {
+			Expect(decodeCheckpointManifest(bufio.NewReader(strings.NewReader(manifest)))).ToNot(BeNil())
+		},
+		Entry("version 1", `{"mediaType": "`+checkpointManifestMediaTypeV1+`", "parts": []}`),
+		Entry("version 2", `{"mediaType": "`+CheckpointManifestMediaType+`", "formatVersion": 3, "chunkSize": 8, "parts": []}`),
+	)
+
+	It("should reject a manifest of a newer format", func() {
+		manifest := `{"mediaType": "` + CheckpointManifestMediaType + `", "formatVersion": 4, "parts": []}`
+		_, err := decodeCheckpointManifest(bufio.NewReader(strings.NewReader(manifest)))
+		Expect(err).To(MatchError(ErrCheckpointFormatTooNew))
+	})
+
+	It("should reject an unknown media type", func() {
+		_, err := decodeCheckpointManifest(bufio.NewReader(strings.NewReader(`{"mediaType": "application/json"}`)))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should read an archive which is not split", func() {
+		// Given
+		Expect(writeCheckpointArchive(context.Background(), strings.NewReader("archive"), &ContainerCheckpointOptions{TargetFile: target})).To(Succeed())
+
+		// When
+		read, err := readCheckpointArchive(target)
+
+		// Then
+		Expect(err).ToNot(HaveOccurred())
+		Expect(read).To(BeEquivalentTo("archive"))
+	})
+
+	It("should import a split archive", func() {
+		// Given
+		source := GinkgoT().TempDir()
+		pages := bytes.Repeat([]byte("page"), 1024)
+		Expect(os.WriteFile(filepath.Join(source, "pages-1.img"), pages, 0o600)).To(Succeed())
+		opts := &ContainerCheckpointOptions{TargetFile: target, ArchivePartSize: 1000}
+		Expect(writeCheckpointArchive(context.Background(), tarTestDir(source), opts)).To(Succeed())
+
+		// When
+		dest := importTestCheckpoint(target)
+
+		// Then
+		Expect(os.ReadFile(filepath.Join(dest, "pages-1.img"))).To(Equal(pages))
+	})
+})
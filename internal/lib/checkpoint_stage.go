@@ -0,0 +1,87 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	metadata "github.com/checkpoint-restore/checkpointctl/lib"
+	"github.com/containers/storage/pkg/archive"
+	rspec "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// criuInventoryFile is the image CRIU starts a restore from, it is written
+// last by a dump.
+const criuInventoryFile = "inventory.img"
+
+// StagedCheckpoint is the metadata of a checkpoint archive extracted ahead
+// of its restore.
+type StagedCheckpoint struct {
+	Info   *CheckpointInfo
+	Config *metadata.ContainerConfig
+}
+
+// StageCheckpoint extracts the checkpoint archive at location completely into
+// dir and verifies that it can be restored on this node. The archive is read
+// to its end, which verifies the checksums of split archives, and has to
+// contain the metadata and the CRIU images of a checkpoint which is not a
+// diagnostic one.
+func (c *ContainerServer) StageCheckpoint(ctx context.Context, dir, location string) (*StagedCheckpoint, error) {
+	if err := c.importCheckpointLocation(ctx, dir, location, &archive.TarOptions{}); err != nil {
+		return nil, err
+	}
+	return readStagedCheckpoint(dir, location)
+}
+
+// readStagedCheckpoint returns the metadata of the checkpoint archive at
+// location extracted into dir, if it can be restored on this node.
+func readStagedCheckpoint(dir, location string) (*StagedCheckpoint, error) {
+	info, err := ReadCheckpointInfo(dir)
+	if err != nil {
+		return nil, err
+	}
+	if info.Diagnostic {
+		return nil, fmt.Errorf("%s: %w", location, ErrDiagnosticCheckpoint)
+	}
+	dumpSpec := new(rspec.Spec)
+	if _, err := metadata.ReadJSONFile(dumpSpec, dir, metadata.SpecDumpFile); err != nil {
+		return nil, fmt.Errorf("failed to read %q: %w", metadata.SpecDumpFile, err)
+	}
+	if err := CheckCheckpointCriuVersion(dumpSpec.Annotations); err != nil {
+		return nil, err
+	}
+	config := new(metadata.ContainerConfig)
+	if _, err := metadata.ReadJSONFile(config, dir, metadata.ConfigDumpFile); err != nil {
+		return nil, fmt.Errorf("failed to read %q: %w", metadata.ConfigDumpFile, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, metadata.CheckpointDirectory, criuInventoryFile)); err != nil {
+		return nil, fmt.Errorf("%s: %w: missing CRIU images: %w", location, ErrCorruptCheckpointMetadata, err)
+	}
+	return &StagedCheckpoint{Info: info, Config: config}, nil
+}
+
+// MoveStagedCheckpoint moves the content of the checkpoint archive staged in
+// dir into the directory dest of the restored container, besides the
+// container config, which is generated for the restored container. Files
+// which cannot be renamed, like across file systems, are copied.
+func MoveStagedCheckpoint(dir, dest string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read staged checkpoint %s: %w", dir, err)
+	}
+	for _, entry := range entries {
+		if entry.Name() == metadata.ConfigDumpFile {
+			continue
+		}
+		src := filepath.Join(dir, entry.Name())
+		dst := filepath.Join(dest, entry.Name())
+		if err := os.Rename(src, dst); err == nil {
+			continue
+		}
+		if err := archive.NewDefaultArchiver().CopyWithTar(src, dst); err != nil {
+			return fmt.Errorf("failed to import %s of staged checkpoint: %w", entry.Name(), err)
+		}
+	}
+	return nil
+}
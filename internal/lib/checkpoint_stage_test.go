@@ -0,0 +1,66 @@
+package lib
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	metadata "github.com/checkpoint-restore/checkpointctl/lib"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	rspec "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// writeStageTestArchive writes a checkpoint archive with the metadata of
+// info and, if inventory is set, the CRIU inventory, and returns its path.
+func writeStageTestArchive(info *CheckpointInfo, inventory bool) string {
+	source := GinkgoT().TempDir()
+	Expect(writeCheckpointInfo(source, info)).To(Succeed())
+	_, err := metadata.WriteJSONFile(&rspec.Spec{}, source, metadata.SpecDumpFile)
+	Expect(err).ToNot(HaveOccurred())
+	_, err = metadata.WriteJSONFile(&metadata.ContainerConfig{ID: "ctr"}, source, metadata.ConfigDumpFile)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(os.Mkdir(filepath.Join(source, metadata.CheckpointDirectory), 0o700)).To(Succeed())
+	if inventory {
+		Expect(os.WriteFile(filepath.Join(source, metadata.CheckpointDirectory, criuInventoryFile), []byte("inventory"), 0o600)).To(Succeed())
+	}
+	target := filepath.Join(GinkgoT().TempDir(), "checkpoint.tar")
+	Expect(writeCheckpointArchive(context.Background(), tarTestDir(source), &ContainerCheckpointOptions{TargetFile: target})).To(Succeed())
+	return target
+}
+
+var _ = Describe("CheckpointStage", func() {
+	It("should stage the checkpoint", func() {
+		// Given
+		target := writeStageTestArchive(&CheckpointInfo{RestoreCount: 2}, true)
+		dir := GinkgoT().TempDir()
+
+		// When
+		staged, err := (&ContainerServer{}).StageCheckpoint(context.Background(), dir, target)
+
+		// Then
+		Expect(err).ToNot(HaveOccurred())
+		Expect(staged.Info.RestoreCount).To(Equal(2))
+		Expect(staged.Config.ID).To(Equal("ctr"))
+
+		// When
+		dest := GinkgoT().TempDir()
+		Expect(MoveStagedCheckpoint(dir, dest)).To(Succeed())
+
+		// Then
+		for _, name := range []string{CheckpointInfoFile, metadata.SpecDumpFile, filepath.Join(metadata.CheckpointDirectory, criuInventoryFile)} {
+			Expect(filepath.Join(dest, name)).To(BeAnExistingFile())
+		}
+		Expect(filepath.Join(dest, metadata.ConfigDumpFile)).ToNot(BeAnExistingFile())
+	})
+
+	DescribeTable("should reject checkpoints which cannot be restored",
+		func(info *CheckpointInfo, inventory bool, expected error) {
+			target := writeStageTestArchive(info, inventory)
+			_, err := (&ContainerServer{}).StageCheckpoint(context.Background(), GinkgoT().TempDir(), target)
+			Expect(err).To(MatchError(expected))
+		},
+		Entry("diagnostic", &CheckpointInfo{Diagnostic: true}, true, ErrDiagnosticCheckpoint),
+		Entry("missing CRIU images", &CheckpointInfo{}, false, ErrCorruptCheckpointMetadata),
+	)
+})
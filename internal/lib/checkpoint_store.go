@@ -0,0 +1,208 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/containers/storage/pkg/archive"
+
+	"github.com/cri-o/cri-o/internal/log"
+	libconfig "github.com/cri-o/cri-o/pkg/config"
+)
+
+// CheckpointStore is a backend checkpoint archives are written to and
+// restored from, addressed by the checkpoint location.
+type CheckpointStore interface {
+	// Writer returns a writer for the checkpoint archive ref. The archive
+	// is published once the writer is closed without error, unless ctx has
+	// been cancelled before, which discards the archive.
+	Writer(ctx context.Context, ref string) (io.WriteCloser, error)
+	// Reader returns a reader of the object ref as it is stored, split
+	// archives are reassembled by openCheckpointStoreArchive. A missing
+	// object is reported as os.ErrNotExist.
+	Reader(ctx context.Context, ref string) (io.ReadCloser, error)
+	// Remove removes the object ref, which is not an error if it is
+	// missing.
+	Remove(ctx context.Context, ref string) error
+}
+
+// IsRemoteCheckpointLocation returns whether the checkpoint location is in a
+// remote store instead of the local file system.
+func IsRemoteCheckpointLocation(location string) bool {
+	return strings.HasPrefix(location, libconfig.CheckpointLocationSchemeS3+"://")
+}
+
+// checkpointStore returns the store of the checkpoint location. Archives are
+// written with the options opts, which may be nil for reading.
+func (c *ContainerServer) checkpointStore(location string, opts *ContainerCheckpointOptions) (CheckpointStore, error) {
+	if opts == nil {
+		opts = &ContainerCheckpointOptions{}
+	}
+	if !IsRemoteCheckpointLocation(location) {
+		return &localCheckpointStore{opts: opts}, nil
+	}
+	return newS3CheckpointStore(&c.config.RuntimeConfig, opts.Overwrite)
+}
+
+// OpenCheckpointLocation opens the checkpoint archive at location, which is
+// either a local file or in a remote store, for reading.
+func (c *ContainerServer) OpenCheckpointLocation(ctx context.Context, location string) (io.ReadCloser, error) {
+	if !IsRemoteCheckpointLocation(location) {
+		return OpenCheckpointArchive(location)
+	}
+	store, err := c.checkpointStore(location, nil)
+	if err != nil {
+		return nil, err
+	}
+	return openCheckpointStoreArchive(ctx, store, location)
+}
+
+// importCheckpointLocation extracts the checkpoint archive at location,
+// which is either a local file or in a remote store, into dest.
+func (c *ContainerServer) importCheckpointLocation(ctx context.Context, dest, location string, options *archive.TarOptions) error {
+	input, err := c.OpenCheckpointLocation(ctx, location)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+	return untarCheckpointArchive(dest, location, input, options)
+}
+
+// writeCheckpointLocation writes the checkpoint archive read from input to
+// the target of opts, which is either a local file or in a remote store.
+func (c *ContainerServer) writeCheckpointLocation(ctx context.Context, input io.Reader, opts *ContainerCheckpointOptions) error {
+	if !IsRemoteCheckpointLocation(opts.TargetFile) {
+		return writeCheckpointArchive(ctx, input, opts)
+	}
+	store, err := c.checkpointStore(opts.TargetFile, opts)
+	if err != nil {
+		return err
+	}
+	if opts.ArchivePartSize > 0 {
+		return writeSplitCheckpointArchive(ctx, store, opts.TargetFile, input, opts)
+	}
+	return writeCheckpointStoreArchive(ctx, store, opts.TargetFile, input)
+}
+
+// writeCheckpointStoreArchive writes the checkpoint archive read from input
+// to ref in store, discarding it if it cannot be written completely.
+func writeCheckpointStoreArchive(ctx context.Context, store CheckpointStore, ref string, input io.Reader) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	writer, err := store.Writer(ctx, ref)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(writer, input); err != nil {
+		cancel()
+		if closeErr := writer.Close(); closeErr != nil && !errors.Is(closeErr, context.Canceled) {
+			log.Warnf(ctx, "Unable to discard checkpoint archive %s: %v", ref, closeErr)
+		}
+		return fmt.Errorf("error writing checkpoint archive %s: %w", ref, err)
+	}
+	return writer.Close()
+}
+
+// localCheckpointStore writes checkpoint archives to and restores them from
+// the local file system.
+type localCheckpointStore struct {
+	opts *ContainerCheckpointOptions
+}
+
+// Writer writes the archive to a temporary file next to path, which becomes
+// visible at path once it is complete.
+func (s *localCheckpointStore) Writer(ctx context.Context, path string) (io.WriteCloser, error) {
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return nil, fmt.Errorf("error creating checkpoint export file %q: %w", path, err)
+	}
+	return &localCheckpointWriter{ctx: ctx, file: file, target: path, opts: s.opts}, nil
+}
+
+// Reader opens the file at path.
+func (s *localCheckpointStore) Reader(_ context.Context, path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open checkpoint archive %s: %w", path, err)
+	}
+	return file, nil
+}
+
+// Remove removes the file at path.
+func (s *localCheckpointStore) Remove(_ context.Context, path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// localCheckpointWriter is a checkpoint archive being written to a
+// temporary file, see localCheckpointStore.Writer.
+type localCheckpointWriter struct {
+	ctx    context.Context
+	file   *os.File
+	target string
+	opts   *ContainerCheckpointOptions
+}
+
+func (w *localCheckpointWriter) Write(p []byte) (int, error) {
+	return w.file.Write(p)
+}
+
+// Close applies the requested mode, ownership and SELinux label to the
+// temporary file and publishes it at the target.
+func (w *localCheckpointWriter) Close() (retErr error) {
+	tmpPath := w.file.Name()
+	defer func() {
+		if retErr != nil {
+			if err := os.Remove(tmpPath); err != nil && !os.IsNotExist(err) {
+				log.Warnf(w.ctx, "Unable to remove temporary checkpoint archive %s: %v", tmpPath, err)
+			}
+		}
+	}()
+
+	if err := w.ctx.Err(); err != nil {
+		w.file.Close()
+		return err
+	}
+	if err := w.file.Sync(); err != nil {
+		w.file.Close()
+		return fmt.Errorf("error syncing checkpoint export file %q: %w", tmpPath, err)
+	}
+	if err := w.file.Close(); err != nil {
+		return fmt.Errorf("error closing checkpoint export file %q: %w", tmpPath, err)
+	}
+
+	if err := setCheckpointArchiveAttributes(w.ctx, tmpPath, w.opts); err != nil {
+		return err
+	}
+
+	if w.opts.Overwrite {
+		if err := os.Rename(tmpPath, w.target); err != nil {
+			return fmt.Errorf("error renaming checkpoint export file to %q: %w", w.target, err)
+		}
+		return nil
+	}
+
+	// Unlike rename, link fails if the target has been created in the meantime.
+	if err := linkFile(tmpPath, w.target); err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("%s: %w", w.target, ErrCheckpointArchiveExists)
+		}
+		// Not every file system supports hard links, copy the archive
+		// with the same semantics instead.
+		log.Debugf(w.ctx, "Unable to link checkpoint export file to %s, copying it: %v", w.target, err)
+		if err := copyCheckpointArchive(w.ctx, tmpPath, w.target, w.opts); err != nil {
+			return err
+		}
+	}
+	if err := os.Remove(tmpPath); err != nil {
+		log.Warnf(w.ctx, "Unable to remove temporary checkpoint archive %s: %v", tmpPath, err)
+	}
+	return nil
+}
@@ -0,0 +1,450 @@
+package lib
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cri-o/cri-o/internal/log"
+	libconfig "github.com/cri-o/cri-o/pkg/config"
+)
+
+const (
+	// s3PartSize is the size of the parts checkpoint archives are uploaded
+	// in. Archives up to this size are uploaded by a single request.
+	s3PartSize = 16 * 1024 * 1024
+
+	// s3UnsignedPayload is the payload hash of requests whose body is not
+	// signed, which avoids reading the parts twice.
+	s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+
+	// s3TimeFormat is the format of the request time of signed requests.
+	s3TimeFormat = "20060102T150405Z"
+)
+
+// s3Credentials are the credentials requests to the object store are signed
+// with.
+type s3Credentials struct {
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+}
+
+// s3CheckpointStore writes checkpoint archives to and restores them from an
+// S3-compatible object store, addressed as "s3://bucket/key".
+type s3CheckpointStore struct {
+	endpoint    *url.URL
+	region      string
+	credentials *s3Credentials
+	overwrite   bool
+	client      *http.Client
+	partSize    int
+}
+
+// newS3CheckpointStore returns the store for the object store configured in
+// config. Existing objects are only replaced if overwrite is set.
+func newS3CheckpointStore(config *libconfig.RuntimeConfig, overwrite bool) (*s3CheckpointStore, error) {
+	if config.CheckpointS3Endpoint == "" {
+		return nil, fmt.Errorf("%w: checkpoint locations in object stores require checkpoint_s3_endpoint", ErrCheckpointUnsupportedFeature)
+	}
+	endpoint, err := url.Parse(config.CheckpointS3Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid checkpoint_s3_endpoint: %w", err)
+	}
+	store := &s3CheckpointStore{
+		endpoint:  endpoint,
+		region:    config.CheckpointS3Region,
+		overwrite: overwrite,
+		client:    http.DefaultClient,
+		partSize:  s3PartSize,
+	}
+	if config.CheckpointS3CredentialsFile != "" {
+		if store.credentials, err = readS3Credentials(config.CheckpointS3CredentialsFile); err != nil {
+			return nil, err
+		}
+	}
+	return store, nil
+}
+
+// readS3Credentials reads the credentials of the "default" profile from the
+// AWS shared credentials file at path.
+func readS3Credentials(path string) (*s3Credentials, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint_s3_credentials_file: %w", err)
+	}
+	defer f.Close()
+
+	credentials := &s3Credentials{}
+	profile := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			profile = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || profile != "default" {
+			continue
+		}
+		switch strings.TrimSpace(key) {
+		case "aws_access_key_id":
+			credentials.accessKeyID = strings.TrimSpace(value)
+		case "aws_secret_access_key":
+			credentials.secretAccessKey = strings.TrimSpace(value)
+		case "aws_session_token":
+			credentials.sessionToken = strings.TrimSpace(value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint_s3_credentials_file: %w", err)
+	}
+	if credentials.accessKeyID == "" || credentials.secretAccessKey == "" {
+		return nil, fmt.Errorf("checkpoint_s3_credentials_file %s has no access key in the default profile", path)
+	}
+	return credentials, nil
+}
+
+// parseS3Location returns the bucket and the key of the checkpoint location
+// "s3://bucket/key".
+func parseS3Location(location string) (bucket, key string, err error) {
+	rest, ok := strings.CutPrefix(location, libconfig.CheckpointLocationSchemeS3+"://")
+	if !ok {
+		return "", "", fmt.Errorf("%s is not an object store location", location)
+	}
+	bucket, key, _ = strings.Cut(rest, "/")
+	if bucket == "" || key == "" || strings.HasSuffix(key, "/") {
+		return "", "", fmt.Errorf("object store location %s has to name a bucket and a key", location)
+	}
+	return bucket, key, nil
+}
+
+// Writer uploads the archive in parts while it is written. The object only
+// becomes visible once the writer is closed.
+func (s *s3CheckpointStore) Writer(ctx context.Context, location string) (io.WriteCloser, error) {
+	bucket, key, err := parseS3Location(location)
+	if err != nil {
+		return nil, err
+	}
+	return &s3CheckpointWriter{ctx: ctx, store: s, location: location, bucket: bucket, key: key}, nil
+}
+
+// Reader downloads the archive while it is read.
+func (s *s3CheckpointStore) Reader(ctx context.Context, location string) (io.ReadCloser, error) {
+	bucket, key, err := parseS3Location(location)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.do(ctx, http.MethodGet, bucket, key, nil, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open checkpoint archive %s: %w", location, err)
+	}
+	return resp.Body, nil
+}
+
+// Remove deletes the object, the object store does not report missing
+// objects.
+func (s *s3CheckpointStore) Remove(ctx context.Context, location string) error {
+	bucket, key, err := parseS3Location(location)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(ctx, http.MethodDelete, bucket, key, nil, nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to remove checkpoint archive %s: %w", location, err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// s3CheckpointWriter is a checkpoint archive being uploaded, see
+// s3CheckpointStore.Writer. The archive is uploaded by a single request if
+// it fits into one part, otherwise by a multipart upload.
+type s3CheckpointWriter struct {
+	ctx      context.Context
+	store    *s3CheckpointStore
+	location string
+	bucket   string
+	key      string
+	buf      bytes.Buffer
+	uploadID string
+	parts    []s3CompletedPart
+	err      error
+}
+
+func (w *s3CheckpointWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	w.buf.Write(p)
+	for w.buf.Len() >= w.store.partSize {
+		if w.err = w.uploadPart(w.buf.Next(w.store.partSize)); w.err != nil {
+			return 0, w.err
+		}
+	}
+	return len(p), nil
+}
+
+// Close completes the upload, or aborts it if the context has been
+// cancelled or a part could not be uploaded.
+func (w *s3CheckpointWriter) Close() error {
+	if w.err == nil {
+		w.err = w.ctx.Err()
+	}
+	if w.err != nil {
+		w.abort()
+		return w.err
+	}
+	if w.uploadID == "" {
+		if _, err := w.store.do(w.ctx, http.MethodPut, w.bucket, w.key, nil, w.conditionalHeader(), w.buf.Bytes()); err != nil {
+			return w.uploadError(err)
+		}
+		return nil
+	}
+	if w.buf.Len() > 0 {
+		if err := w.uploadPart(w.buf.Bytes()); err != nil {
+			w.abort()
+			return err
+		}
+	}
+	body, err := xml.Marshal(&s3CompleteMultipartUpload{Parts: w.parts})
+	if err != nil {
+		w.abort()
+		return err
+	}
+	if _, err := w.store.do(w.ctx, http.MethodPost, w.bucket, w.key, url.Values{"uploadId": {w.uploadID}}, w.conditionalHeader(), body); err != nil {
+		w.abort()
+		return w.uploadError(err)
+	}
+	return nil
+}
+
+// uploadPart uploads the next part of the archive, starting the multipart
+// upload with the first part.
+func (w *s3CheckpointWriter) uploadPart(part []byte) error {
+	if w.uploadID == "" {
+		resp, err := w.store.do(w.ctx, http.MethodPost, w.bucket, w.key, url.Values{"uploads": {""}}, nil, nil)
+		if err != nil {
+			return w.uploadError(err)
+		}
+		defer resp.Body.Close()
+		result := &s3InitiateMultipartUploadResult{}
+		if err := xml.NewDecoder(resp.Body).Decode(result); err != nil || result.UploadID == "" {
+			return fmt.Errorf("failed to start upload of checkpoint archive %s: invalid response: %w", w.location, err)
+		}
+		w.uploadID = result.UploadID
+	}
+	number := len(w.parts) + 1
+	query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {w.uploadID}}
+	resp, err := w.store.do(w.ctx, http.MethodPut, w.bucket, w.key, query, nil, part)
+	if err != nil {
+		return w.uploadError(err)
+	}
+	resp.Body.Close()
+	w.parts = append(w.parts, s3CompletedPart{PartNumber: number, ETag: resp.Header.Get("ETag")})
+	return nil
+}
+
+// abort removes the uploaded parts of an incomplete archive.
+func (w *s3CheckpointWriter) abort() {
+	if w.uploadID == "" {
+		return
+	}
+	// The upload has to be aborted even if the checkpoint was cancelled.
+	ctx := context.WithoutCancel(w.ctx)
+	if _, err := w.store.do(ctx, http.MethodDelete, w.bucket, w.key, url.Values{"uploadId": {w.uploadID}}, nil, nil); err != nil {
+		log.Warnf(ctx, "Unable to abort upload of checkpoint archive %s: %v", w.location, err)
+	}
+	w.uploadID = ""
+}
+
+// conditionalHeader prevents replacing an existing object unless the store
+// may overwrite archives.
+func (w *s3CheckpointWriter) conditionalHeader() http.Header {
+	if w.store.overwrite {
+		return nil
+	}
+	return http.Header{"If-None-Match": {"*"}}
+}
+
+// uploadError returns ErrCheckpointArchiveExists if the upload failed
+// because the object exists.
+func (w *s3CheckpointWriter) uploadError(err error) error {
+	var s3Err *s3Error
+	if errors.As(err, &s3Err) && s3Err.statusCode == http.StatusPreconditionFailed {
+		return fmt.Errorf("%s: %w", w.location, ErrCheckpointArchiveExists)
+	}
+	return fmt.Errorf("failed to upload checkpoint archive %s: %w", w.location, err)
+}
+
+type s3InitiateMultipartUploadResult struct {
+	UploadID string `xml:"UploadId"`
+}
+
+type s3CompleteMultipartUpload struct {
+	XMLName xml.Name          `xml:"CompleteMultipartUpload"`
+	Parts   []s3CompletedPart `xml:"Part"`
+}
+
+type s3CompletedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+// s3Error is the error response of the object store.
+type s3Error struct {
+	statusCode int
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (e *s3Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("object store returned status %d", e.statusCode)
+	}
+	return fmt.Sprintf("object store returned status %d: %s: %s", e.statusCode, e.Code, e.Message)
+}
+
+// do sends a signed request for the object key in bucket and returns the
+// response if it has been successful. The caller has to close the body of
+// the response. Missing objects are reported as os.ErrNotExist.
+func (s *s3CheckpointStore) do(ctx context.Context, method, bucket, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	u := *s.endpoint
+	u.RawPath = strings.TrimSuffix(u.EscapedPath(), "/") + "/" + s3Escape(bucket, false) + "/" + s3Escape(key, true)
+	u.Path, _ = url.PathUnescape(u.RawPath) //nolint:errcheck // the path has just been escaped
+	u.RawQuery = s3CanonicalQuery(query)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	s.sign(req, time.Now().UTC())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound && method == http.MethodGet {
+		return nil, fmt.Errorf("s3://%s/%s: %w", bucket, key, os.ErrNotExist)
+	}
+	s3Err := &s3Error{statusCode: resp.StatusCode}
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(s3Err); err != nil {
+		log.Debugf(ctx, "Unable to decode error response of the object store: %v", err)
+	}
+	return nil, s3Err
+}
+
+// sign signs the request with signature version 4 of AWS, the body is not
+// included in the signature.
+func (s *s3CheckpointStore) sign(req *http.Request, now time.Time) {
+	req.Header.Set("X-Amz-Content-Sha256", s3UnsignedPayload)
+	if s.credentials == nil {
+		return
+	}
+	amzDate := now.Format(s3TimeFormat)
+	req.Header.Set("X-Amz-Date", amzDate)
+	if s.credentials.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.credentials.sessionToken)
+	}
+
+	signedHeaders := []string{"host"}
+	for name := range req.Header {
+		if lower := strings.ToLower(name); strings.HasPrefix(lower, "x-amz-") {
+			signedHeaders = append(signedHeaders, lower)
+		}
+	}
+	sort.Strings(signedHeaders)
+	var canonicalHeaders strings.Builder
+	for _, name := range signedHeaders {
+		value := req.URL.Host
+		if name != "host" {
+			value = strings.TrimSpace(req.Header.Get(name))
+		}
+		canonicalHeaders.WriteString(name + ":" + value + "\n")
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		strings.Join(signedHeaders, ";"),
+		s3UnsignedPayload,
+	}, "\n")
+	scope := amzDate[:8] + "/" + s.region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hexSHA256([]byte(canonicalRequest))
+
+	key := []byte("AWS4" + s.credentials.secretAccessKey)
+	for _, part := range []string{amzDate[:8], s.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.credentials.accessKeyID, scope, strings.Join(signedHeaders, ";"), signature))
+}
+
+// s3Escape escapes s as required by the signature, keeping slashes if
+// keepSlash is set.
+func s3Escape(s string, keepSlash bool) string {
+	var b strings.Builder
+	for i := range len(s) {
+		c := s[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (keepSlash && c == '/') {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+// s3CanonicalQuery returns the query sorted and escaped as required by the
+// signature.
+func s3CanonicalQuery(query url.Values) string {
+	params := make([]string, 0, len(query))
+	for name, values := range query {
+		for _, value := range values {
+			params = append(params, s3Escape(name, false)+"="+s3Escape(value, false))
+		}
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
+
+func hexSHA256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
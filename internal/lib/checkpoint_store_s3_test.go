@@ -0,0 +1,310 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	libconfig "github.com/cri-o/cri-o/pkg/config"
+)
+
+// fakeS3 is an object store serving a single bucket with path-style
+// addressing, which supports the requests of s3CheckpointStore.
+type fakeS3 struct {
+	mutex   sync.Mutex
+	objects map[string][]byte
+	uploads map[string]map[int][]byte
+	aborted int
+	// puts are the keys of the objects uploaded by single requests,
+	// including failed ones.
+	puts []string
+	// fail returns the status of a failed request, if any, and whether the
+	// object has been stored before the failure.
+	fail func(r *http.Request) (status int, stored bool)
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=key-id/") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	key := r.URL.Path
+	query := r.URL.Query()
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if r.Method == http.MethodPut && !query.Has("partNumber") {
+		f.puts = append(f.puts, key)
+	}
+	if f.fail != nil {
+		if status, stored := f.fail(r); status != 0 {
+			if stored {
+				f.objects[key] = body
+			}
+			w.WriteHeader(status)
+			return
+		}
+	}
+	_, exists := f.objects[key]
+	precondition := r.Header.Get("If-None-Match") == "*" && exists
+
+	switch {
+	case r.Method == http.MethodGet:
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(f.objects[key]) //nolint:errcheck
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		id := strconv.Itoa(len(f.uploads))
+		f.uploads[id] = map[int][]byte{}
+		w.Write([]byte("<InitiateMultipartUploadResult><UploadId>" + id + "</UploadId></InitiateMultipartUploadResult>")) //nolint:errcheck
+	case r.Method == http.MethodPut && query.Has("partNumber"):
+		number, _ := strconv.Atoi(query.Get("partNumber")) //nolint:errcheck
+		f.uploads[query.Get("uploadId")][number] = body
+		w.Header().Set("ETag", `"etag-`+strconv.Itoa(number)+`"`)
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		if precondition {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		complete := &s3CompleteMultipartUpload{}
+		if err := xml.Unmarshal(body, complete); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var object []byte
+		for _, part := range complete.Parts {
+			object = append(object, f.uploads[query.Get("uploadId")][part.PartNumber]...)
+		}
+		f.objects[key] = object
+		delete(f.uploads, query.Get("uploadId"))
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		delete(f.uploads, query.Get("uploadId"))
+		f.aborted++
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut:
+		if precondition {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			w.Write([]byte("<Error><Code>PreconditionFailed</Code><Message>object exists</Message></Error>")) //nolint:errcheck
+			return
+		}
+		f.objects[key] = body
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func newTestS3CheckpointStore(overwrite bool) (*s3CheckpointStore, *fakeS3) {
+	fake := &fakeS3{objects: map[string][]byte{}, uploads: map[string]map[int][]byte{}}
+	server := httptest.NewServer(fake)
+	DeferCleanup(server.Close)
+
+	credentials := filepath.Join(GinkgoT().TempDir(), "credentials")
+	Expect(os.WriteFile(credentials, []byte("[other]\naws_access_key_id = other\n\n[default]\naws_access_key_id = key-id\naws_secret_access_key = secret\n"), 0o600)).To(Succeed())
+	store, err := newS3CheckpointStore(&libconfig.RuntimeConfig{
+		CheckpointS3Endpoint:        server.URL,
+		CheckpointS3Region:          "us-east-1",
+		CheckpointS3CredentialsFile: credentials,
+	}, overwrite)
+	Expect(err).ToNot(HaveOccurred())
+	store.partSize = 10
+	return store, fake
+}
+
+var _ = Describe("CheckpointStoreS3", func() {
+	var (
+		store *s3CheckpointStore
+		fake  *fakeS3
+	)
+
+	BeforeEach(func() {
+		store, fake = newTestS3CheckpointStore(false)
+	})
+
+	DescribeTable("should write and read archives",
+		func(content string) {
+			// Given
+			location := "s3://bucket/checkpoints/pod ctr.tar"
+
+			// When
+			Expect(writeCheckpointStoreArchive(context.Background(), store, location, strings.NewReader(content))).To(Succeed())
+
+			// Then
+			Expect(fake.objects).To(HaveKeyWithValue("/bucket/checkpoints/pod ctr.tar", BeEquivalentTo(content)))
+			reader, err := store.Reader(context.Background(), location)
+			Expect(err).ToNot(HaveOccurred())
+			defer reader.Close()
+			Expect(io.ReadAll(reader)).To(BeEquivalentTo(content))
+
+			err = writeCheckpointStoreArchive(context.Background(), store, location, strings.NewReader(content))
+			Expect(err).To(MatchError(ErrCheckpointArchiveExists))
+		},
+		Entry("single part", "small"),
+		Entry("multiple parts", "archive of three parts"),
+	)
+
+	It("should replace an existing archive if requested", func() {
+		// Given
+		store, fake = newTestS3CheckpointStore(true)
+		fake.objects["/bucket/cp.tar"] = []byte("old")
+
+		// When
+		Expect(writeCheckpointStoreArchive(context.Background(), store, "s3://bucket/cp.tar", strings.NewReader("new"))).To(Succeed())
+
+		// Then
+		Expect(fake.objects).To(HaveKeyWithValue("/bucket/cp.tar", BeEquivalentTo("new")))
+	})
+
+	It("should abort the upload if canceled", func() {
+		// Given
+		ctx, cancel := context.WithCancel(context.Background())
+		writer, err := store.Writer(ctx, "s3://bucket/cp.tar")
+		Expect(err).ToNot(HaveOccurred())
+		_, err = writer.Write(bytes.Repeat([]byte("x"), 25))
+		Expect(err).ToNot(HaveOccurred())
+
+		// When
+		cancel()
+		err = writer.Close()
+
+		// Then
+		Expect(err).To(MatchError(context.Canceled))
+		Expect(fake.objects).To(BeEmpty())
+		Expect(fake.uploads).To(BeEmpty())
+		Expect(fake.aborted).To(Equal(1))
+	})
+
+	It("should fail to read a missing archive", func() {
+		_, err := store.Reader(context.Background(), "s3://bucket/missing.tar")
+		Expect(err).To(MatchError(os.ErrNotExist))
+	})
+
+	Context("split archives", func() {
+		BeforeEach(func() {
+			DeferCleanup(func(delay time.Duration) { checkpointPartRetryDelay = delay }, checkpointPartRetryDelay)
+			checkpointPartRetryDelay = 0
+		})
+
+		It("should retry failed parts", func() {
+			// Given
+			// The first upload of the second part fails, the response to the
+			// first upload of the third part gets lost.
+			failed := map[string]bool{}
+			fake.fail = func(r *http.Request) (int, bool) {
+				for suffix, stored := range map[string]bool{".part-0001": false, ".part-0002": true} {
+					if r.Method == http.MethodPut && strings.HasSuffix(r.URL.Path, suffix) && !failed[suffix] {
+						failed[suffix] = true
+						return http.StatusInternalServerError, stored
+					}
+				}
+				return 0, false
+			}
+			location := "s3://bucket/dir/cp.tar"
+			content := "archive of four parts...."
+			opts := &ContainerCheckpointOptions{TargetFile: location, ArchivePartSize: 8, archiveFormatVersion: 2}
+
+			// When
+			Expect(writeSplitCheckpointArchive(context.Background(), store, location, strings.NewReader(content), opts)).To(Succeed())
+
+			// Then
+			// The manifest and 4 parts.
+			Expect(fake.objects).To(HaveLen(5))
+			// Only the part which has not been stored is uploaded again, the
+			// manifest is uploaded in parts.
+			Expect(fake.puts).To(HaveLen(5))
+			Expect(fake.puts[1]).To(HaveSuffix(".part-0001"))
+			Expect(fake.puts[2]).To(Equal(fake.puts[1]))
+
+			manifest, err := readCheckpointStoreManifest(context.Background(), store, location)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(manifest.MediaType).To(Equal(CheckpointManifestMediaType))
+			Expect(manifest.FormatVersion).To(Equal(2))
+			Expect(manifest.ChunkSize).To(BeEquivalentTo(8))
+			Expect(manifest.Parts).To(HaveLen(4))
+			reader, err := openCheckpointStoreArchive(context.Background(), store, location)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(io.ReadAll(reader)).To(BeEquivalentTo(content))
+			Expect(reader.Close()).To(Succeed())
+
+			// When
+			delete(fake.objects, "/bucket/dir/"+manifest.Parts[3].Name)
+
+			// Then
+			reader, err = openCheckpointStoreArchive(context.Background(), store, location)
+			Expect(err).ToNot(HaveOccurred())
+			defer reader.Close()
+			_, err = io.ReadAll(reader)
+			Expect(err).To(MatchError(ErrCheckpointPartMissing))
+		})
+
+		It("should remove the uploaded parts on failure", func() {
+			// Given
+			fake.fail = func(r *http.Request) (int, bool) {
+				if r.Method == http.MethodPut && strings.HasSuffix(r.URL.Path, ".part-0001") {
+					return http.StatusServiceUnavailable, false
+				}
+				return 0, false
+			}
+			location := "s3://bucket/cp.tar"
+			opts := &ContainerCheckpointOptions{TargetFile: location, ArchivePartSize: 8}
+
+			// When
+			err := writeSplitCheckpointArchive(context.Background(), store, location, strings.NewReader("archive of three"), opts)
+
+			// Then
+			Expect(err).To(HaveOccurred())
+			Expect(fake.puts).To(HaveLen(1 + checkpointPartAttempts))
+			Expect(fake.objects).To(BeEmpty())
+		})
+	})
+
+	It("should parse a location", func() {
+		bucket, key, err := parseS3Location("s3://bucket/dir/cp.tar")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(bucket).To(Equal("bucket"))
+		Expect(key).To(Equal("dir/cp.tar"))
+	})
+
+	DescribeTable("should reject invalid locations",
+		func(location string) {
+			_, _, err := parseS3Location(location)
+			Expect(err).To(HaveOccurred())
+		},
+		Entry("local path", "/var/lib/cp.tar"),
+		Entry("bucket only", "s3://bucket"),
+		Entry("empty key", "s3://bucket/"),
+		Entry("empty bucket", "s3:///cp.tar"),
+		Entry("directory", "s3://bucket/dir/"),
+	)
+
+	It("should encode the canonical query", func() {
+		query := s3CanonicalQuery(url.Values{"uploadId": {"a/b c"}, "partNumber": {"2"}, "uploads": {""}})
+		Expect(query).To(Equal("partNumber=2&uploadId=a%2Fb%20c&uploads="))
+	})
+
+	It("should fail if unconfigured", func() {
+		_, err := newS3CheckpointStore(&libconfig.RuntimeConfig{}, false)
+		Expect(err).To(MatchError(ErrCheckpointUnsupportedFeature))
+	})
+})
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
 
 	metadata "github.com/checkpoint-restore/checkpointctl/lib"
 	criu "github.com/checkpoint-restore/go-criu/v7/utils"
@@ -54,7 +55,36 @@ var _ = t.Describe("ContainerCheckpoint", func() {
 			// Then
 			Expect(err).To(HaveOccurred())
 			Expect(res).To(Equal(""))
-			Expect(err.Error()).To(Equal(`container containerID is not running`))
+			Expect(err).To(MatchError(lib.ErrCheckpointPrecondition))
+			Expect(err.Error()).To(ContainSubstring(`container containerID is not running`))
+		})
+	})
+	t.Describe("ContainerCheckpoint", func() {
+		It("should refuse to overwrite an existing archive", func() {
+			// Given
+			addContainerAndSandbox()
+			config := &metadata.ContainerConfig{
+				ID: containerID,
+			}
+			target := filepath.Join(t.MustTempDir("checkpoint"), "cp.tar")
+			Expect(os.WriteFile(target, []byte("existing"), 0o600)).To(Succeed())
+
+			myContainer.SetState(&oci.ContainerState{
+				State: specs.State{Status: oci.ContainerStateRunning},
+			})
+
+			// When
+			_, err := sut.ContainerCheckpoint(
+				context.Background(),
+				config,
+				&lib.ContainerCheckpointOptions{TargetFile: target},
+			)
+
+			// Then
+			Expect(err).To(MatchError(lib.ErrCheckpointArchiveExists))
+			content, err := os.ReadFile(target)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(content)).To(Equal("existing"))
 		})
 	})
 	t.Describe("ContainerCheckpoint", func() {
@@ -181,6 +211,52 @@ var _ = t.Describe("ContainerCheckpoint", func() {
 			Expect(res).To(ContainSubstring(config.ID))
 		})
 	})
+	t.Describe("ContainerCheckpoint", func() {
+		It("should write metadata readable by checkpointctl", func() {
+			// Given
+			addContainerAndSandbox()
+			config := &metadata.ContainerConfig{
+				ID: containerID,
+			}
+			tmpDir := t.MustTempDir("checkpoint")
+			opts := &lib.ContainerCheckpointOptions{
+				TargetFile: filepath.Join(tmpDir, "cp.tar"),
+			}
+
+			myContainer.SetState(&oci.ContainerState{
+				State: specs.State{Status: oci.ContainerStateRunning},
+			})
+			myContainer.SetSpec(&specs.Spec{Version: "1.0.0"})
+
+			gomock.InOrder(
+				storeMock.EXPECT().Container(gomock.Any()).Return(&cstorage.Container{}, nil),
+				storeMock.EXPECT().Changes(gomock.Any(), gomock.Any()).Return([]archive.Change{}, nil),
+				storeMock.EXPECT().Mount(gomock.Any(), gomock.Any()).Return("/tmp/", nil),
+				storeMock.EXPECT().Container(gomock.Any()).Return(&cstorage.Container{}, nil),
+				storeMock.EXPECT().Unmount(gomock.Any(), gomock.Any()).Return(true, nil),
+			)
+
+			// When
+			_, err := sut.ContainerCheckpoint(context.Background(), config, opts)
+			Expect(err).ToNot(HaveOccurred())
+
+			// Then
+			extracted := filepath.Join(tmpDir, "extracted")
+			Expect(archive.UntarPath(opts.TargetFile, extracted)).To(Succeed())
+
+			configDump, _, err := metadata.ReadContainerCheckpointConfigDump(extracted)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(configDump.ID).To(Equal(containerID))
+			Expect(configDump.CheckpointedAt).ToNot(BeZero())
+
+			specDump, _, err := metadata.ReadContainerCheckpointSpecDump(extracted)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(specDump.Annotations).To(HaveKeyWithValue(metadata.CheckpointAnnotationEngine, "CRI-O"))
+			Expect(specDump.Annotations).To(HaveKey(metadata.CheckpointAnnotationEngineVersion))
+			Expect(specDump.Annotations).ToNot(HaveKey(metadata.CheckpointAnnotationPodID))
+			Expect(specDump.Annotations).To(HaveKey(metadata.CheckpointAnnotationRuntimeName))
+		})
+	})
 	t.Describe("ContainerCheckpoint", func() {
 		It("should fail during unmount", func() {
 			// Given
@@ -210,6 +286,73 @@ var _ = t.Describe("ContainerCheckpoint", func() {
 			Expect(err.Error()).To(Equal(`failed to unmount container containerID: error`))
 		})
 	})
+	t.Describe("ContainerCheckpoint", func() {
+		DescribeTable("should remove the checkpoint files on failure",
+			func(prepare func(opts *lib.ContainerCheckpointOptions, cancel context.CancelFunc)) {
+				// Given
+				mockRuntimeInLibConfigDump()
+				addContainerAndSandbox()
+				config := &metadata.ContainerConfig{
+					ID: containerID,
+				}
+				opts := &lib.ContainerCheckpointOptions{
+					TargetFile:  filepath.Join(t.MustTempDir("checkpoint"), "cp.tar"),
+					KeepRunning: true,
+				}
+
+				myContainer.SetState(&oci.ContainerState{
+					State: specs.State{Status: oci.ContainerStateRunning},
+				})
+				myContainer.SetSpec(&specs.Spec{Version: "1.0.0"})
+
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+				prepare(opts, cancel)
+
+				// When
+				_, err := sut.ContainerCheckpoint(ctx, config, opts)
+
+				// Then
+				Expect(err).To(HaveOccurred())
+				for _, file := range []string{
+					metadata.CheckpointDirectory,
+					metadata.ConfigDumpFile,
+					metadata.SpecDumpFile,
+					metadata.RootFsDiffTar,
+				} {
+					Expect(filepath.Join(myContainer.Dir(), file)).ToNot(BeAnExistingFile())
+				}
+				Expect(myContainer.State().Status).To(BeEquivalentTo(oci.ContainerStateRunning))
+			},
+			Entry("with an invalid parent checkpoint", func(opts *lib.ContainerCheckpointOptions, _ context.CancelFunc) {
+				opts.ParentCheckpoint = filepath.Join(filepath.Dir(opts.TargetFile), "missing.tar")
+			}),
+			Entry("with a failing export", func(*lib.ContainerCheckpointOptions, context.CancelFunc) {
+				storeMock.EXPECT().Container(gomock.Any()).Return(nil, t.TestError)
+			}),
+			Entry("with a canceled context", func(_ *lib.ContainerCheckpointOptions, cancel context.CancelFunc) {
+				gomock.InOrder(
+					storeMock.EXPECT().Container(gomock.Any()).Return(&cstorage.Container{}, nil),
+					storeMock.EXPECT().Changes(gomock.Any(), gomock.Any()).DoAndReturn(
+						func(string, string) ([]archive.Change, error) {
+							cancel()
+							return nil, context.Canceled
+						},
+					),
+				)
+			}),
+			Entry("with a failing rename", func(opts *lib.ContainerCheckpointOptions, _ context.CancelFunc) {
+				// The archive cannot replace a directory which is not empty.
+				Expect(os.MkdirAll(filepath.Join(opts.TargetFile, "file"), 0o755)).To(Succeed())
+				opts.Overwrite = true
+				gomock.InOrder(
+					storeMock.EXPECT().Container(gomock.Any()).Return(&cstorage.Container{}, nil),
+					storeMock.EXPECT().Changes(gomock.Any(), gomock.Any()).Return([]archive.Change{}, nil),
+					storeMock.EXPECT().Mount(gomock.Any(), gomock.Any()).Return("/tmp/", nil),
+				)
+			}),
+		)
+	})
 })
 
 var _ = t.Describe("ContainerCheckpoint", func() {
@@ -258,3 +401,81 @@ var _ = t.Describe("ContainerCheckpoint", func() {
 		})
 	})
 })
+
+var _ = t.Describe("ReadCheckpointInfo", func() {
+	It("should treat archives without info file as version 1", func() {
+		// Given
+		dir := t.MustTempDir("checkpoint-info")
+
+		// When
+		info, err := lib.ReadCheckpointInfo(dir)
+
+		// Then
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.FormatVersion).To(Equal(1))
+		Expect(info.Diagnostic).To(BeFalse())
+	})
+
+	It("should read the diagnostic marker", func() {
+		// Given
+		dir := t.MustTempDir("checkpoint-info")
+		_, err := metadata.WriteJSONFile(&lib.CheckpointInfo{Diagnostic: true}, dir, lib.CheckpointInfoFile)
+		Expect(err).ToNot(HaveOccurred())
+
+		// When
+		info, err := lib.ReadCheckpointInfo(dir)
+
+		// Then
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.Diagnostic).To(BeTrue())
+	})
+
+	It("should fail on corrupt info file", func() {
+		// Given
+		dir := t.MustTempDir("checkpoint-info")
+		Expect(os.WriteFile(filepath.Join(dir, lib.CheckpointInfoFile), []byte("{"), 0o600)).To(Succeed())
+
+		// When
+		_, err := lib.ReadCheckpointInfo(dir)
+
+		// Then
+		Expect(err).To(MatchError(lib.ErrCorruptCheckpointMetadata))
+	})
+
+	It("should fail on archives from a newer format", func() {
+		// Given
+		dir := t.MustTempDir("checkpoint-info")
+		_, err := metadata.WriteJSONFile(
+			&lib.CheckpointInfo{FormatVersion: lib.CheckpointFormatVersion + 1},
+			dir, lib.CheckpointInfoFile,
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		// When
+		_, err = lib.ReadCheckpointInfo(dir)
+
+		// Then
+		Expect(err).To(MatchError(lib.ErrCheckpointFormatTooNew))
+	})
+
+	DescribeTable("should read fixture archives",
+		func(fixture string, version int) {
+			// Given
+			dir := t.MustTempDir("checkpoint-info")
+			Expect(archive.UntarPath(filepath.Join("testdata", fixture), dir)).To(Succeed())
+
+			// When
+			info, err := lib.ReadCheckpointInfo(dir)
+
+			// Then
+			Expect(err).ToNot(HaveOccurred())
+			Expect(info.FormatVersion).To(Equal(version))
+			Expect(info.Diagnostic).To(BeFalse())
+			config, _, err := metadata.ReadContainerCheckpointConfigDump(dir)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(config.Name).To(Equal("k8s_counter_counters_default_0"))
+		},
+		Entry("unversioned", "checkpoint-unversioned.tar", 1),
+		Entry("version 1", "checkpoint-v1.tar", 1),
+	)
+})
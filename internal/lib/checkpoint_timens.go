@@ -0,0 +1,50 @@
+package lib
+
+import (
+	"fmt"
+	"os"
+
+	criu "github.com/checkpoint-restore/go-criu/v7/utils"
+	rspec "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// timensCriuVersion is the minimum CRIU version required to checkpoint and
+// restore containers running in a time namespace.
+const timensCriuVersion = 31400
+
+// procTimeNamespace exists if the kernel supports time namespaces.
+var procTimeNamespace = "/proc/self/ns/time"
+
+// hasTimeNamespace returns true if the container of spec runs in its own
+// time namespace.
+func hasTimeNamespace(spec *rspec.Spec) bool {
+	if spec == nil || spec.Linux == nil {
+		return false
+	}
+	for _, ns := range spec.Linux.Namespaces {
+		if ns.Type == rspec.TimeNamespace {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckTimeNamespaceSupport fails if the kernel or the installed CRIU do not
+// support time namespaces. CRIU dumps the clock offsets of the time namespace
+// of a container and restores them, so that CLOCK_MONOTONIC and
+// CLOCK_BOOTTIME continue from the checkpoint on a host with another uptime.
+func CheckTimeNamespaceSupport() error {
+	if _, err := os.Stat(procTimeNamespace); err != nil {
+		return fmt.Errorf("%w: kernel does not support time namespaces (requires Linux 5.6 with CONFIG_TIME_NS): %w", ErrCheckpointUnsupportedFeature, err)
+	}
+	return checkTimensCriuVersion()
+}
+
+// checkTimensCriuVersion fails if the installed CRIU is too old to
+// checkpoint or restore containers in a time namespace.
+func checkTimensCriuVersion() error {
+	if err := criu.CheckForCriu(timensCriuVersion); err != nil {
+		return fmt.Errorf("%w: container uses a time namespace: %w", ErrCheckpointUnsupportedFeature, err)
+	}
+	return nil
+}
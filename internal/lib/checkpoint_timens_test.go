@@ -0,0 +1,35 @@
+package lib
+
+import (
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	rspec "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+var _ = Describe("CheckpointTimeNamespace", func() {
+	DescribeTable("hasTimeNamespace",
+		func(spec *rspec.Spec, expected bool) {
+			Expect(hasTimeNamespace(spec)).To(Equal(expected))
+		},
+		Entry("no spec", nil, false),
+		Entry("no linux section", &rspec.Spec{}, false),
+		Entry("other namespaces",
+			&rspec.Spec{Linux: &rspec.Linux{Namespaces: []rspec.LinuxNamespace{{Type: rspec.PIDNamespace}, {Type: rspec.MountNamespace}}}}, false),
+		Entry("time namespace",
+			&rspec.Spec{Linux: &rspec.Linux{Namespaces: []rspec.LinuxNamespace{{Type: rspec.PIDNamespace}, {Type: rspec.TimeNamespace}}}}, true),
+	)
+
+	It("should fail without kernel support", func() {
+		// Given
+		DeferCleanup(func(path string) { procTimeNamespace = path }, procTimeNamespace)
+		procTimeNamespace = filepath.Join(GinkgoT().TempDir(), "time")
+
+		// When
+		err := CheckTimeNamespaceSupport()
+
+		// Then
+		Expect(err).To(MatchError(ErrCheckpointUnsupportedFeature))
+	})
+})
@@ -0,0 +1,163 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/containers/storage/pkg/archive"
+	"github.com/containers/storage/pkg/chrootarchive"
+	rspec "github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
+
+	"github.com/cri-o/cri-o/internal/log"
+)
+
+// TmpfsCheckpointDirectory is the directory in the checkpoint archive holding
+// the contents of the tmpfs mounts of the container.
+const TmpfsCheckpointDirectory = "tmpfs"
+
+// CheckpointTmpfs is a tmpfs mount of the checkpointed container.
+type CheckpointTmpfs struct {
+	// Destination is the path of the mount in the container.
+	Destination string `json:"destination"`
+	// Archive is the name of the tar file in TmpfsCheckpointDirectory
+	// holding the contents of the mount. It is empty if the contents have
+	// not been included in the checkpoint.
+	Archive string `json:"archive,omitempty"`
+}
+
+// tmpfsMounts returns the destinations of the tmpfs mounts of the container.
+// /dev is set up by the runtime and left out.
+func tmpfsMounts(spec *rspec.Spec) []string {
+	var mounts []string
+	for _, m := range spec.Mounts {
+		if m.Type != "tmpfs" || filepath.Clean(m.Destination) == "/dev" {
+			continue
+		}
+		mounts = append(mounts, filepath.Clean(m.Destination))
+	}
+	return mounts
+}
+
+// tmpfsUsage returns the number of bytes used by the tmpfs mounted at path.
+func tmpfsUsage(path string) (int64, error) {
+	var stat unix.Statfs_t
+	if err := unix.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	return int64(stat.Blocks-stat.Bfree) * int64(stat.Bsize), nil //nolint:unconvert // Bsize is 32 bits on some platforms
+}
+
+// exportTmpfs writes the contents of the tmpfs mounts of the container,
+// whose root file system is at root, to TmpfsCheckpointDirectory in dir. The
+// contents are only recorded, but not written, if maxSize is 0. Mounts
+// holding more than maxSize bytes fail the checkpoint instead of being
+// truncated. The container has to be frozen, as the mounts only exist while
+// it is running.
+func exportTmpfs(dir, root string, mounts []string, maxSize int64) (_ []CheckpointTmpfs, retErr error) {
+	if len(mounts) == 0 {
+		return nil, nil
+	}
+	tmpfs := make([]CheckpointTmpfs, 0, len(mounts))
+	if maxSize == 0 {
+		for _, destination := range mounts {
+			tmpfs = append(tmpfs, CheckpointTmpfs{Destination: destination})
+		}
+		return tmpfs, nil
+	}
+
+	tmpfsDir := filepath.Join(dir, TmpfsCheckpointDirectory)
+	if err := os.MkdirAll(tmpfsDir, 0o700); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if retErr != nil {
+			os.RemoveAll(tmpfsDir)
+		}
+	}()
+	for i, destination := range mounts {
+		source := filepath.Join(root, destination)
+		usage, err := tmpfsUsage(source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to determine the size of tmpfs %s: %w", destination, err)
+		}
+		if usage > maxSize {
+			return nil, fmt.Errorf("%w: tmpfs %s holds %d bytes, more than checkpoint_tmpfs_max_size of %d bytes",
+				ErrCheckpointPrecondition, destination, usage, maxSize)
+		}
+		name := strconv.Itoa(i) + ".tar"
+		if err := writeTmpfsArchive(filepath.Join(tmpfsDir, name), source, root); err != nil {
+			return nil, fmt.Errorf("failed to export tmpfs %s: %w", destination, err)
+		}
+		tmpfs = append(tmpfs, CheckpointTmpfs{Destination: destination, Archive: name})
+	}
+	return tmpfs, nil
+}
+
+// writeTmpfsArchive writes the contents of source to the tar file at path.
+// The symbolic links in source are resolved in root, which is chrooted to.
+func writeTmpfsArchive(path, source, root string) (retErr error) {
+	input, err := chrootarchive.Tar(source, &archive.TarOptions{
+		Compression: archive.Uncompressed,
+	}, root)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := out.Close(); err != nil && retErr == nil {
+			retErr = err
+		}
+	}()
+	_, err = io.Copy(out, input)
+	return err
+}
+
+// restoreTmpfs extracts the contents of the tmpfs mounts of an imported
+// checkpoint in dir into the tmpfs mounts of the restored container, whose
+// root file system is at root. The mounts only exist once the runtime set up
+// the mount namespace of the container, so this runs right after the runtime
+// restore. A warning lists the mounts whose contents have not been included
+// in the checkpoint, which are only as complete as the runtime restored them.
+func restoreTmpfs(ctx context.Context, dir, root string, tmpfs []CheckpointTmpfs) error {
+	var lost []string
+	for _, t := range tmpfs {
+		if t.Archive == "" {
+			lost = append(lost, t.Destination)
+			continue
+		}
+		if err := extractTmpfsArchive(filepath.Join(dir, TmpfsCheckpointDirectory, filepath.Base(t.Archive)), filepath.Join(root, t.Destination), root); err != nil {
+			return fmt.Errorf("failed to restore tmpfs %s: %w", t.Destination, err)
+		}
+	}
+	if len(lost) > 0 {
+		log.Warnf(ctx, "The contents of the tmpfs mounts %s have not been included in the checkpoint and may be lost, set checkpoint_tmpfs_max_size to preserve them",
+			strings.Join(lost, ", "))
+	}
+	return nil
+}
+
+// extractTmpfsArchive extracts the tar file at path into dest, chrooted to
+// root.
+func extractTmpfsArchive(path, dest, root string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("%w: missing %s", ErrCorruptCheckpointMetadata, filepath.Base(path))
+		}
+		return err
+	}
+	defer f.Close()
+	return chrootarchive.UntarWithRoot(f, dest, &archive.TarOptions{}, root)
+}
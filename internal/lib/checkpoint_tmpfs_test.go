@@ -0,0 +1,65 @@
+package lib
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	rspec "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+var _ = Describe("CheckpointTmpfs", func() {
+	var dir string
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+	})
+
+	It("should find the tmpfs mounts", func() {
+		spec := &rspec.Spec{
+			Mounts: []rspec.Mount{
+				{Destination: "/proc", Type: "proc", Source: "proc"},
+				{Destination: "/dev", Type: "tmpfs", Source: "tmpfs"},
+				{Destination: "/tmp/", Type: "tmpfs", Source: "tmpfs"},
+				{Destination: "/var/cache", Type: "bind", Source: "/mnt/cache"},
+				{Destination: "/run", Type: "tmpfs", Source: "tmpfs"},
+			},
+		}
+		Expect(tmpfsMounts(spec)).To(Equal([]string{"/tmp", "/run"}))
+	})
+
+	It("should only record the mounts without contents", func() {
+		// When
+		tmpfs, err := exportTmpfs(dir, GinkgoT().TempDir(), []string{"/tmp", "/run"}, 0)
+
+		// Then
+		Expect(err).ToNot(HaveOccurred())
+		Expect(tmpfs).To(Equal([]CheckpointTmpfs{{Destination: "/tmp"}, {Destination: "/run"}}))
+		Expect(filepath.Join(dir, TmpfsCheckpointDirectory)).ToNot(BeAnExistingFile())
+	})
+
+	It("should fail for contents exceeding the maximum size", func() {
+		// Given
+		root := GinkgoT().TempDir()
+		Expect(os.Mkdir(filepath.Join(root, "tmp"), 0o755)).To(Succeed())
+
+		// When
+		// The file system of the test directory holds more than a byte.
+		_, err := exportTmpfs(dir, root, []string{"/tmp"}, 1)
+
+		// Then
+		Expect(err).To(MatchError(ErrCheckpointPrecondition))
+		Expect(filepath.Join(dir, TmpfsCheckpointDirectory)).ToNot(BeAnExistingFile())
+	})
+
+	It("should skip mounts without contents on restore", func() {
+		Expect(restoreTmpfs(context.Background(), dir, GinkgoT().TempDir(), []CheckpointTmpfs{{Destination: "/tmp"}})).To(Succeed())
+	})
+
+	It("should fail to restore a missing archive", func() {
+		err := restoreTmpfs(context.Background(), dir, GinkgoT().TempDir(), []CheckpointTmpfs{{Destination: "/tmp", Archive: "0.tar"}})
+		Expect(err).To(MatchError(ErrCorruptCheckpointMetadata))
+	})
+})
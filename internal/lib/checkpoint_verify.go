@@ -0,0 +1,105 @@
+package lib
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	rspec "github.com/opencontainers/runtime-spec/specs-go"
+
+	"github.com/cri-o/cri-o/internal/oci"
+)
+
+// ErrCheckpointVerificationFailed is returned if the test restore of a
+// checkpoint archive failed, which means that the archive cannot be
+// restored although it has been written successfully.
+var ErrCheckpointVerificationFailed = errors.New("test restore of the checkpoint failed")
+
+const (
+	// criuRestoreCheckSucceeded is logged by CRIU once a restore in
+	// check-only mode restored all processes, which it kills instead of
+	// resuming them.
+	criuRestoreCheckSucceeded = "Restore check was successful"
+
+	// criuVerifyConfig is the configuration file of CRIU for test
+	// restores, passed by the runtime through the oci.CriuConfigAnnotation.
+	criuVerifyConfig = "check-only\n"
+)
+
+// verificationSpec turns the spec of a checkpointed container into the spec
+// of the throwaway container id test-restoring it. The container gets the
+// root file system at rootfs, the network namespace at netnsPath and a
+// cgroup next to the one of the checkpointed container. It runs no hooks and
+// lets CRIU only check the restore, following the configuration file at
+// criuConfig.
+func verificationSpec(spec *rspec.Spec, id, rootfs, netnsPath, criuConfig string) {
+	spec.Root = &rspec.Root{Path: rootfs}
+	spec.Hooks = nil
+	if spec.Process != nil {
+		spec.Process.Terminal = false
+	}
+	annotations := make(map[string]string, len(spec.Annotations)+1)
+	for k, v := range spec.Annotations {
+		annotations[k] = v
+	}
+	annotations[oci.CriuConfigAnnotation] = criuConfig
+	spec.Annotations = annotations
+
+	if spec.Linux == nil {
+		spec.Linux = &rspec.Linux{}
+	}
+	spec.Linux.CgroupsPath = verificationCgroupsPath(spec.Linux.CgroupsPath, id)
+	hasNetwork := false
+	for i := range spec.Linux.Namespaces {
+		if spec.Linux.Namespaces[i].Type == rspec.NetworkNamespace {
+			spec.Linux.Namespaces[i].Path = netnsPath
+			hasNetwork = true
+		}
+	}
+	if !hasNetwork {
+		spec.Linux.Namespaces = append(spec.Linux.Namespaces, rspec.LinuxNamespace{
+			Type: rspec.NetworkNamespace,
+			Path: netnsPath,
+		})
+	}
+}
+
+// verificationCgroupsPath returns the cgroup of the throwaway container id,
+// next to the cgroup of the checkpointed container at path. Both the systemd
+// format "slice:prefix:name" and cgroupfs paths are supported.
+func verificationCgroupsPath(path, id string) string {
+	if path == "" {
+		return ""
+	}
+	if parts := strings.Split(path, ":"); len(parts) == 3 {
+		return parts[0] + ":" + parts[1] + ":" + id
+	}
+	return filepath.Join(filepath.Dir(path), "crio-"+id)
+}
+
+// restoreCheckResult returns whether the CRIU restore log at logPath reports
+// a successful restore check, or the first error logged otherwise, which
+// CRIU follows with the errors of unwinding the restore.
+func restoreCheckResult(logPath string) (succeeded bool, reason string) {
+	f, err := os.Open(logPath)
+	if err != nil {
+		return false, ""
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.Contains(line, criuRestoreCheckSucceeded) {
+			return true, ""
+		}
+		if reason == "" && strings.Contains(line, "Error (") {
+			if _, msg, ok := strings.Cut(line, "): "); ok {
+				reason = strings.TrimSpace(msg)
+			}
+		}
+	}
+	return false, reason
+}
@@ -0,0 +1,144 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	metadata "github.com/checkpoint-restore/checkpointctl/lib"
+	"github.com/containers/storage/pkg/archive"
+	rspec "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/opencontainers/selinux/go-selinux/label"
+	"golang.org/x/sys/unix"
+
+	"github.com/cri-o/cri-o/internal/config/nsmgr"
+	"github.com/cri-o/cri-o/internal/log"
+	"github.com/cri-o/cri-o/internal/oci"
+)
+
+// VerifyCheckpoint test-restores the checkpoint archive of ctr at archivePath
+// into a throwaway container, to prove that the archive can be restored. The
+// throwaway container runs in its own network namespace on an overlay of the
+// root file system of ctr, so that ctr has to be running. CRIU restores its
+// processes in check-only mode, which kills them before they are resumed,
+// and the container is removed right after. It returns
+// ErrCheckpointVerificationFailed if the restore fails.
+func (c *ContainerServer) VerifyCheckpoint(ctx context.Context, ctr *oci.Container, archivePath string) error {
+	if hasIDMappings(ctr.IDMappings()) {
+		return fmt.Errorf("%w: checkpoints of containers in a user namespace cannot be verified", ErrCheckpointUnsupportedFeature)
+	}
+	if ctr.MountPoint() == "" {
+		return fmt.Errorf("%w: root file system of container %s is not mounted", ErrCheckpointPrecondition, ctr.ID())
+	}
+
+	dir, err := os.MkdirTemp(ctr.Dir(), "verify-")
+	if err != nil {
+		return fmt.Errorf("failed to create directory for the test restore: %w", err)
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			log.Warnf(ctx, "Unable to remove directory %s of the test restore: %v", dir, err)
+		}
+	}()
+
+	importDir := filepath.Join(dir, "import")
+	if err := os.Mkdir(importDir, 0o700); err != nil {
+		return err
+	}
+	// The root file system of the container is used instead of the changes
+	// in the archive, which also still has the contents of /dev/shm.
+	if err := c.importCheckpointLocation(ctx, importDir, archivePath, &archive.TarOptions{
+		ExcludePatterns: []string{metadata.RootFsDiffTar, metadata.DevShmCheckpointTar, TmpfsCheckpointDirectory},
+	}); err != nil {
+		return err
+	}
+	info, err := ReadCheckpointInfo(importDir)
+	if err != nil {
+		return err
+	}
+	if info.Diagnostic {
+		return fmt.Errorf("%s: %w", archivePath, ErrDiagnosticCheckpoint)
+	}
+	if len(info.Parents) > 0 {
+		return fmt.Errorf("%w: incremental checkpoints cannot be verified", ErrCheckpointUnsupportedFeature)
+	}
+	spec := &rspec.Spec{}
+	if _, err := metadata.ReadJSONFile(spec, importDir, metadata.SpecDumpFile); err != nil {
+		return fmt.Errorf("%w: %w", ErrCorruptCheckpointMetadata, err)
+	}
+
+	rootfs, err := mountVerificationRootfs(dir, ctr.MountPoint(), spec)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := unix.Unmount(rootfs, unix.MNT_DETACH); err != nil {
+			log.Warnf(ctx, "Unable to unmount root file system %s of the test restore: %v", rootfs, err)
+		}
+	}()
+
+	namespaces, err := c.config.NamespaceManager().NewPodNamespaces(&nsmgr.PodNamespacesConfig{
+		Namespaces: []*nsmgr.PodNamespaceConfig{{Type: nsmgr.NETNS}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create network namespace for the test restore: %w", err)
+	}
+	defer func() {
+		for _, ns := range namespaces {
+			if err := ns.Remove(); err != nil {
+				log.Warnf(ctx, "Unable to remove namespace %s of the test restore: %v", ns.Path(), err)
+			}
+		}
+	}()
+
+	criuConfig := filepath.Join(dir, "criu.conf")
+	if err := os.WriteFile(criuConfig, []byte(criuVerifyConfig), 0o600); err != nil {
+		return err
+	}
+	id := ctr.ID() + "-verify"
+	verificationSpec(spec, id, rootfs, namespaces[0].Path(), criuConfig)
+	if _, err := metadata.WriteJSONFile(spec, dir, "config.json"); err != nil {
+		return err
+	}
+
+	log.Infof(ctx, "Verifying checkpoint %s of container %s by a test restore", archivePath, ctr.ID())
+	restoreErr := c.runtime.VerifyRestore(ctx, ctr, id, dir, filepath.Join(importDir, metadata.CheckpointDirectory))
+	// The runtime does not expect CRIU to kill the restored processes and
+	// may fail afterwards, so the log of CRIU is the result of the check.
+	succeeded, reason := restoreCheckResult(filepath.Join(dir, metadata.RestoreLogFile))
+	if succeeded {
+		return nil
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("test restore of checkpoint %s aborted: %w", archivePath, ctx.Err())
+	}
+	if reason == "" && restoreErr != nil {
+		reason = restoreErr.Error()
+	}
+	return fmt.Errorf("%w: %s", ErrCheckpointVerificationFailed, reason)
+}
+
+// mountVerificationRootfs mounts an overlay on top of the root file system
+// of the checkpointed container at lower to the rootfs directory in dir and
+// returns its path. Changes of the test restore, like files CRIU recreates,
+// end up in dir instead of the root file system of the container.
+func mountVerificationRootfs(dir, lower string, spec *rspec.Spec) (string, error) {
+	rootfs := filepath.Join(dir, "rootfs")
+	upper := filepath.Join(dir, "upper")
+	work := filepath.Join(dir, "work")
+	for _, d := range []string{rootfs, upper, work} {
+		if err := os.Mkdir(d, 0o700); err != nil {
+			return "", err
+		}
+	}
+	mountLabel := ""
+	if spec.Linux != nil {
+		mountLabel = spec.Linux.MountLabel
+	}
+	options := label.FormatMountLabel(fmt.Sprintf("lowerdir=%s,upperdir=%s,workdir=%s", lower, upper, work), mountLabel)
+	if err := unix.Mount("overlay", rootfs, "overlay", 0, options); err != nil {
+		return "", fmt.Errorf("failed to mount root file system for the test restore: %w", err)
+	}
+	return rootfs, nil
+}
@@ -0,0 +1,90 @@
+package lib
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	rspec "github.com/opencontainers/runtime-spec/specs-go"
+
+	"github.com/cri-o/cri-o/internal/oci"
+)
+
+var _ = Describe("CheckpointVerify", func() {
+	It("should derive the spec of the verification container", func() {
+		// Given
+		spec := &rspec.Spec{
+			Root:        &rspec.Root{Path: "/var/lib/containers/storage/overlay/abc/merged"},
+			Process:     &rspec.Process{Terminal: true},
+			Hooks:       &rspec.Hooks{Poststop: []rspec.Hook{{Path: "/usr/bin/hook"}}},
+			Annotations: map[string]string{"io.kubernetes.cri-o.Name": "ctr"},
+			Linux: &rspec.Linux{
+				CgroupsPath: "kubepods.slice:crio:ctr",
+				Namespaces: []rspec.LinuxNamespace{
+					{Type: rspec.PIDNamespace},
+					{Type: rspec.NetworkNamespace, Path: "/var/run/netns/pod"},
+				},
+			},
+		}
+		annotations := spec.Annotations
+
+		// When
+		verificationSpec(spec, "ctr-verify", "/verify/rootfs", "/var/run/netns/verify", "/verify/criu.conf")
+
+		// Then
+		Expect(spec.Root.Path).To(Equal("/verify/rootfs"))
+		Expect(spec.Hooks).To(BeNil())
+		Expect(spec.Process.Terminal).To(BeFalse())
+		Expect(spec.Annotations).To(And(
+			HaveKeyWithValue(oci.CriuConfigAnnotation, "/verify/criu.conf"),
+			HaveKeyWithValue("io.kubernetes.cri-o.Name", "ctr"),
+		))
+		// The annotations of the checkpointed container are left alone.
+		Expect(annotations).ToNot(HaveKey(oci.CriuConfigAnnotation))
+		Expect(spec.Linux.CgroupsPath).To(Equal("kubepods.slice:crio:ctr-verify"))
+		Expect(spec.Linux.Namespaces[1].Path).To(Equal("/var/run/netns/verify"))
+	})
+
+	It("should add a network namespace to the verification container", func() {
+		// Given
+		spec := &rspec.Spec{}
+
+		// When
+		verificationSpec(spec, "ctr-verify", "/verify/rootfs", "/var/run/netns/verify", "/verify/criu.conf")
+
+		// Then
+		Expect(spec.Linux.Namespaces).To(HaveLen(1))
+		Expect(spec.Linux.Namespaces[0].Path).To(Equal("/var/run/netns/verify"))
+	})
+
+	DescribeTable("verificationCgroupsPath",
+		func(path, expected string) {
+			Expect(verificationCgroupsPath(path, "abc-verify")).To(Equal(expected))
+		},
+		Entry("empty", "", ""),
+		Entry("systemd", "kubepods-pod1.slice:crio:abc", "kubepods-pod1.slice:crio:abc-verify"),
+		Entry("cgroupfs", "/kubepods/pod1/crio-abc", "/kubepods/pod1/crio-abc-verify"),
+	)
+
+	DescribeTable("restoreCheckResult",
+		func(log string, succeeded bool, reason string) {
+			path := filepath.Join(GinkgoT().TempDir(), "restore.log")
+			Expect(os.WriteFile(path, []byte(log), 0o600)).To(Succeed())
+			actualSucceeded, actualReason := restoreCheckResult(path)
+			Expect(actualSucceeded).To(Equal(succeeded))
+			Expect(actualReason).To(Equal(reason))
+		},
+		Entry("successful", "(00.012345) Restoring processes\n(00.023456) Restore check was successful.\n", true, ""),
+		Entry("failed",
+			"(00.012345) Error (criu/files-reg.c:1234): Can't open file tmp/data on restore: No such file or directory\n(00.012346) Error (criu/cr-restore.c:2345): Restoring FAILED.\n",
+			false, "Can't open file tmp/data on restore: No such file or directory"),
+		Entry("incomplete", "(00.012345) Restoring processes\n", false, ""),
+	)
+
+	It("should fail without reason for a missing log", func() {
+		succeeded, reason := restoreCheckResult(filepath.Join(GinkgoT().TempDir(), "missing.log"))
+		Expect(succeeded).To(BeFalse())
+		Expect(reason).To(BeEmpty())
+	})
+})
@@ -0,0 +1,16 @@
+//go:build !linux
+// +build !linux
+
+package lib
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cri-o/cri-o/internal/oci"
+)
+
+// VerifyCheckpoint is only supported on Linux.
+func (c *ContainerServer) VerifyCheckpoint(context.Context, *oci.Container, string) error {
+	return fmt.Errorf("%w: verifying checkpoints is not supported on this platform", ErrCheckpointUnsupportedFeature)
+}
@@ -0,0 +1,55 @@
+package lib
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/cri-o/cri-o/internal/log"
+	"github.com/cri-o/cri-o/internal/resourcestore"
+)
+
+// checkpointWorkDir tracks the files a checkpoint writes to the directory of
+// the container: the CRIU images and the files collected for the checkpoint
+// archive. They are removed when the checkpoint returns unless it has been
+// committed, so that no failed or aborted checkpoint leaves them behind.
+type checkpointWorkDir struct {
+	dir     string
+	cleaner *resourcestore.ResourceCleaner
+}
+
+func newCheckpointWorkDir(dir string) *checkpointWorkDir {
+	return &checkpointWorkDir{
+		dir:     dir,
+		cleaner: resourcestore.NewResourceCleaner(),
+	}
+}
+
+// add registers the removal of the files or directories names in the
+// directory of the container. It has to be called before they are created,
+// so that a partially written file is removed as well.
+func (w *checkpointWorkDir) add(ctx context.Context, names ...string) {
+	for _, name := range names {
+		path := filepath.Join(w.dir, name)
+		w.cleaner.Add(ctx, "remove checkpoint file "+path, func() error {
+			return os.RemoveAll(path)
+		})
+	}
+}
+
+// commit disarms the cleanup once the checkpoint is complete. The files which
+// are not part of its result are then removed by the checkpoint itself.
+func (w *checkpointWorkDir) commit() {
+	w.cleaner = nil
+}
+
+// cleanup removes the registered files unless the checkpoint has been
+// committed. It is meant to be deferred right after newCheckpointWorkDir.
+func (w *checkpointWorkDir) cleanup(ctx context.Context) {
+	if w.cleaner == nil {
+		return
+	}
+	if err := w.cleaner.Cleanup(); err != nil {
+		log.Warnf(ctx, "Unable to clean up the checkpoint files in %s: %v", w.dir, err)
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strconv"
+	"time"
 
 	metadata "github.com/checkpoint-restore/checkpointctl/lib"
 	"github.com/checkpoint-restore/go-criu/v7/stats"
@@ -25,6 +27,7 @@ func (c *ContainerServer) ContainerRestore(
 	config *metadata.ContainerConfig,
 	opts *ContainerCheckpointOptions,
 ) (string, error) {
+	start := time.Now()
 	var ctr *oci.Container
 	var err error
 	ctr, err = c.LookupContainer(ctx, config.ID)
@@ -45,6 +48,11 @@ func (c *ContainerServer) ContainerRestore(
 	if err != nil {
 		return "", err
 	}
+	if hasTimeNamespace(ctrSpec.Config) {
+		if err := CheckTimeNamespaceSupport(); err != nil {
+			return "", err
+		}
+	}
 	// During checkpointing the container is unmounted. This mounts the container again.
 	mountPoint, err := c.StorageImageServer().GetStore().Mount(ctr.ID(), ctrSpec.Config.Linux.MountLabel)
 	if err != nil {
@@ -59,6 +67,8 @@ func (c *ContainerServer) ContainerRestore(
 		return "", err
 	}
 
+	restoreCount := 0
+	var tmpfs []CheckpointTmpfs
 	if ctr.RestoreArchivePath() != "" || ctr.RestoreStorageImageID() != nil {
 		if ctr.RestoreStorageImageID() != nil {
 			log.Debugf(ctx, "Restoring from %v", ctr.RestoreStorageImageID())
@@ -76,18 +86,21 @@ func (c *ContainerServer) ContainerRestore(
 				}
 			}()
 
-			// Import all checkpoint files except ConfigDumpFile and SpecDumpFile. We
+			// Import all checkpoint files except ConfigDumpFile. We
 			// generate new container config files to enable to specifying a new
-			// container name.
+			// container name. SpecDumpFile is only compared with the new spec.
 			checkpoint := []string{
 				"artifacts",
+				metadata.SpecDumpFile,
 				metadata.CheckpointDirectory,
 				metadata.DevShmCheckpointTar,
+				TmpfsCheckpointDirectory,
 				metadata.RootFsDiffTar,
 				metadata.DeletedFilesFile,
 				metadata.PodOptionsFile,
 				metadata.PodDumpFile,
 				stats.StatsDump,
+				CheckpointInfoFile,
 				"bind.mounts",
 				annotations.LogPath,
 			}
@@ -98,14 +111,44 @@ func (c *ContainerServer) ContainerRestore(
 					logrus.Debugf("Can't import '%s' from checkpoint image", name)
 				}
 			}
+		} else if ctr.RestoreStaged() {
+			log.Debugf(ctx, "Restoring from staged checkpoint archive %s", ctr.RestoreArchivePath())
 		} else {
-			if err := crutils.CRImportCheckpointWithoutConfig(ctr.Dir(), ctr.RestoreArchivePath()); err != nil {
+			if err := c.importCheckpointLocation(ctx, ctr.Dir(), ctr.RestoreArchivePath(), &archive.TarOptions{
+				ExcludePatterns: []string{
+					// Import everything else besides the container config
+					metadata.ConfigDumpFile,
+				},
+			}); err != nil {
 				return "", err
 			}
 		}
+		if err := checkRestoreSpec(ctx, ctr.Dir(), ctrSpec.Config); err != nil {
+			return "", err
+		}
+		info, err := ReadCheckpointInfo(ctr.Dir())
+		if err != nil {
+			return "", err
+		}
+		restoreCount = info.RestoreCount
+		tmpfs = info.Tmpfs
+		ctr.SetRestoreShellJob(info.ShellJob)
+		ctr.SetRestoreManageCgroupsMode(ctrSpec.Config.Annotations[annotations.CheckpointAnnotationManageCgroupsMode])
+		if err := restoreCheckpointParents(ctr); err != nil {
+			return "", err
+		}
+		if err := c.shiftRestoredFileSystemChanges(ctr); err != nil {
+			return "", err
+		}
 		if err := c.restoreFileSystemChanges(ctr, mountPoint); err != nil {
 			return "", err
 		}
+		if err := restoreDevShm(ctr.Dir(), ctrSpec.Config); err != nil {
+			return "", err
+		}
+		if err := restoreFIFOs(ctr.Dir(), ctrSpec.Config); err != nil {
+			return "", err
+		}
 
 		_, err = os.Stat(filepath.Join(ctr.Dir(), annotations.LogPath))
 		if err == nil {
@@ -261,11 +304,23 @@ func (c *ContainerServer) ContainerRestore(
 
 	ctr.SetSandbox(ctr.Sandbox())
 
-	saveOptions := generate.ExportOptions{}
-	if err := ctrSpec.SaveToFile(filepath.Join(ctr.Dir(), "config.json"), saveOptions); err != nil {
-		return "", err
+	// CRIU writes ghost files and other state into the root file system,
+	// so a read-only one is restored writable and remounted read-only once
+	// the restore finished.
+	readOnlyRootfs := hasReadOnlyRootfs(ctrSpec.Config)
+	if readOnlyRootfs {
+		runtimeType, err := c.runtime.RuntimeType(sb.RuntimeHandler())
+		if err != nil {
+			return "", err
+		}
+		if err := checkReadOnlyRootfsRestore(ctrSpec.Config, runtimeType); err != nil {
+			return "", err
+		}
+		ctrSpec.Config.Root.Readonly = false
 	}
-	if err := ctrSpec.SaveToFile(filepath.Join(ctr.BundlePath(), "config.json"), saveOptions); err != nil {
+
+	saveOptions := generate.ExportOptions{}
+	if err := saveRestoreSpec(ctr, &ctrSpec, saveOptions); err != nil {
 		return "", err
 	}
 
@@ -275,8 +330,21 @@ func (c *ContainerServer) ContainerRestore(
 		sb.CgroupParent(),
 		sb.MountLabel(),
 	); err != nil {
+		return "", fmt.Errorf("failed to restore container %s: %w: %w", ctr.ID(), ErrCriuFailed, err)
+	}
+	if readOnlyRootfs {
+		if err := c.finishReadOnlyRootfsRestore(ctx, ctr); err != nil {
+			return "", err
+		}
+		ctrSpec.Config.Root.Readonly = true
+		if err := saveRestoreSpec(ctr, &ctrSpec, saveOptions); err != nil {
+			return "", err
+		}
+	}
+	if err := restoreTmpfs(ctx, ctr.Dir(), filepath.Join("/proc", strconv.Itoa(ctr.State().Pid), "root"), tmpfs); err != nil {
 		return "", fmt.Errorf("failed to restore container %s: %w", ctr.ID(), err)
 	}
+	ctr.SetRestored(restoreCount+1, time.Since(start))
 	if err := c.ContainerStateToDisk(ctx, ctr); err != nil {
 		log.Warnf(ctx, "Unable to write containers %s state to disk: %v", ctr.ID(), err)
 	}
@@ -290,6 +358,10 @@ func (c *ContainerServer) ContainerRestore(
 		if err != nil {
 			log.Debugf(ctx, "Non-fatal: removal of checkpoint directory (%s) failed: %v", ctr.CheckpointPath(), err)
 		}
+		removeCheckpointParents(ctx, ctr.Dir())
+		if err := os.RemoveAll(filepath.Join(ctr.Dir(), TmpfsCheckpointDirectory)); err != nil {
+			log.Debugf(ctx, "Non-fatal: removal of checkpoint directory (%s) failed: %v", TmpfsCheckpointDirectory, err)
+		}
 		cleanup := [...]string{
 			metadata.RestoreLogFile,
 			metadata.DumpLogFile,
@@ -298,6 +370,8 @@ func (c *ContainerServer) ContainerRestore(
 			metadata.NetworkStatusFile,
 			metadata.RootFsDiffTar,
 			metadata.DeletedFilesFile,
+			metadata.DevShmCheckpointTar,
+			metadata.SpecDumpFile,
 		}
 		for _, del := range cleanup {
 			var file string
@@ -321,6 +395,41 @@ func (c *ContainerServer) ContainerRestore(
 	return ctr.ID(), nil
 }
 
+// saveRestoreSpec writes the spec of the restored container ctr to both
+// copies of its config.json.
+func saveRestoreSpec(ctr *oci.Container, ctrSpec *generate.Generator, saveOptions generate.ExportOptions) error {
+	if err := ctrSpec.SaveToFile(filepath.Join(ctr.Dir(), "config.json"), saveOptions); err != nil {
+		return err
+	}
+	return ctrSpec.SaveToFile(filepath.Join(ctr.BundlePath(), "config.json"), saveOptions)
+}
+
+// shiftRestoredFileSystemChanges translates the owners of the imported root
+// file system diff to the host IDs of the restored container if the
+// checkpointed container was running in a user namespace.
+func (c *ContainerServer) shiftRestoredFileSystemChanges(ctr *oci.Container) error {
+	info, err := ReadCheckpointInfo(ctr.Dir())
+	if err != nil {
+		return err
+	}
+	mappings := ctr.IDMappings()
+	if hasIDMappings(mappings) {
+		if err := checkUsernsCriuVersion(); err != nil {
+			return err
+		}
+	}
+	if !info.IDMapped {
+		return nil
+	}
+	if !hasIDMappings(mappings) {
+		return fmt.Errorf("checkpoint of a container in a user namespace cannot be restored into container %s without user namespace", ctr.ID())
+	}
+	if err := shiftRootFsDiffToHost(ctr.Dir(), mappings); err != nil {
+		return fmt.Errorf("failed to map root file-system diff of %s: %w", ctr.ID(), err)
+	}
+	return nil
+}
+
 func (c *ContainerServer) restoreFileSystemChanges(ctr *oci.Container, mountPoint string) error {
 	if err := crutils.CRApplyRootFsDiffTar(ctr.Dir(), mountPoint); err != nil {
 		return err
@@ -0,0 +1,228 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	metadata "github.com/checkpoint-restore/checkpointctl/lib"
+	rspec "github.com/opencontainers/runtime-spec/specs-go"
+
+	"github.com/cri-o/cri-o/internal/log"
+	"github.com/cri-o/cri-o/pkg/annotations"
+)
+
+// ErrRestoreSpecMismatch is returned if the spec of the restored container
+// differs from the spec of the checkpointed container in a way the restore
+// cannot be expected to succeed with.
+var ErrRestoreSpecMismatch = errors.New("restored container does not match the checkpoint")
+
+// restoreSpecCategory is a part of the spec compared by diffRestoreSpec.
+type restoreSpecCategory string
+
+const (
+	restoreSpecMounts       restoreSpecCategory = "mounts"
+	restoreSpecDevices      restoreSpecCategory = "devices"
+	restoreSpecCapabilities restoreSpecCategory = "capabilities"
+	restoreSpecSysctls      restoreSpecCategory = "sysctls"
+	restoreSpecCgroup       restoreSpecCategory = "cgroup"
+)
+
+// tolerableRestoreSpecCategories are the categories whose differences do not
+// fail the restore if the container has the
+// CheckpointAnnotationTolerateSpecDrift annotation. The restored processes
+// keep working with other sysctls and cgroup settings, while a missing mount,
+// device or capability breaks them in ways which are hard to debug later.
+var tolerableRestoreSpecCategories = map[restoreSpecCategory]bool{
+	restoreSpecSysctls: true,
+	restoreSpecCgroup:  true,
+}
+
+// restoreSpecDifference is a setting differing between the spec of the
+// checkpointed container and the one of the restored container. An empty
+// value means the setting is not present.
+type restoreSpecDifference struct {
+	Category     restoreSpecCategory
+	Item         string
+	Checkpointed string
+	Target       string
+}
+
+func (d *restoreSpecDifference) String() string {
+	return fmt.Sprintf("%s %s: checkpoint %s, restore %s", d.Category, d.Item, diffValue(d.Checkpointed), diffValue(d.Target))
+}
+
+func diffValue(value string) string {
+	if value == "" {
+		return "<none>"
+	}
+	return strconv.Quote(value)
+}
+
+// restoreSpecDiff is the result of diffRestoreSpec.
+type restoreSpecDiff []restoreSpecDifference
+
+func (d restoreSpecDiff) String() string {
+	differences := make([]string, 0, len(d))
+	for i := range d {
+		differences = append(differences, d[i].String())
+	}
+	return strings.Join(differences, "; ")
+}
+
+// tolerable returns whether all differences are in a category of
+// tolerableRestoreSpecCategories.
+func (d restoreSpecDiff) tolerable() bool {
+	for i := range d {
+		if !tolerableRestoreSpecCategories[d[i].Category] {
+			return false
+		}
+	}
+	return true
+}
+
+// diffRestoreSpec compares the spec of the checkpointed container with the
+// spec generated for the restored container. Mounts are compared by their
+// destination and type only, as their sources are expected to change on
+// another node. The CPU and memory limits are not compared, as they can be
+// overridden on restore.
+func diffRestoreSpec(checkpointed, target *rspec.Spec) restoreSpecDiff {
+	var diff restoreSpecDiff
+	diff = append(diff, diffSettings(restoreSpecMounts, specMounts(checkpointed), specMounts(target))...)
+	diff = append(diff, diffSettings(restoreSpecDevices, specDevices(checkpointed), specDevices(target))...)
+	diff = append(diff, diffSettings(restoreSpecCapabilities, specCapabilities(checkpointed), specCapabilities(target))...)
+	diff = append(diff, diffSettings(restoreSpecSysctls, specSysctls(checkpointed), specSysctls(target))...)
+	diff = append(diff, diffSettings(restoreSpecCgroup, specCgroup(checkpointed), specCgroup(target))...)
+	return diff
+}
+
+// diffSettings returns the differences between the settings of a category,
+// sorted by item.
+func diffSettings(category restoreSpecCategory, checkpointed, target map[string]string) []restoreSpecDifference {
+	items := make([]string, 0, len(checkpointed)+len(target))
+	for item := range checkpointed {
+		items = append(items, item)
+	}
+	for item := range target {
+		if _, ok := checkpointed[item]; !ok {
+			items = append(items, item)
+		}
+	}
+	sort.Strings(items)
+
+	var diff []restoreSpecDifference
+	for _, item := range items {
+		if checkpointed[item] != target[item] {
+			diff = append(diff, restoreSpecDifference{
+				Category:     category,
+				Item:         item,
+				Checkpointed: checkpointed[item],
+				Target:       target[item],
+			})
+		}
+	}
+	return diff
+}
+
+func specMounts(spec *rspec.Spec) map[string]string {
+	mounts := make(map[string]string, len(spec.Mounts))
+	for _, m := range spec.Mounts {
+		mountType := m.Type
+		if mountType == "" {
+			mountType = "mounted"
+		}
+		mounts[filepath.Clean(m.Destination)] = mountType
+	}
+	return mounts
+}
+
+func specDevices(spec *rspec.Spec) map[string]string {
+	devices := map[string]string{}
+	if spec.Linux == nil {
+		return devices
+	}
+	for _, d := range spec.Linux.Devices {
+		devices[d.Path] = fmt.Sprintf("%s %d:%d", d.Type, d.Major, d.Minor)
+	}
+	return devices
+}
+
+func specCapabilities(spec *rspec.Spec) map[string]string {
+	capabilities := map[string]string{}
+	if spec.Process == nil || spec.Process.Capabilities == nil {
+		return capabilities
+	}
+	for set, caps := range map[string][]string{
+		"bounding":  spec.Process.Capabilities.Bounding,
+		"effective": spec.Process.Capabilities.Effective,
+		"permitted": spec.Process.Capabilities.Permitted,
+	} {
+		for _, c := range caps {
+			capabilities[set+" "+c] = "granted"
+		}
+	}
+	return capabilities
+}
+
+func specSysctls(spec *rspec.Spec) map[string]string {
+	if spec.Linux == nil {
+		return nil
+	}
+	return spec.Linux.Sysctl
+}
+
+func specCgroup(spec *rspec.Spec) map[string]string {
+	cgroup := map[string]string{}
+	if spec.Linux == nil || spec.Linux.Resources == nil {
+		return cgroup
+	}
+	resources := spec.Linux.Resources
+	if resources.CPU != nil {
+		cgroup["cpuset.cpus"] = resources.CPU.Cpus
+		cgroup["cpuset.mems"] = resources.CPU.Mems
+	}
+	if resources.Pids != nil && resources.Pids.Limit > 0 {
+		cgroup["pids.max"] = strconv.FormatInt(resources.Pids.Limit, 10)
+	}
+	for _, h := range resources.HugepageLimits {
+		cgroup["hugetlb."+h.Pagesize+".limit"] = strconv.FormatUint(h.Limit, 10)
+	}
+	return cgroup
+}
+
+// checkRestoreSpec compares the spec of the checkpointed container, imported
+// to dir, with the spec of the restored container before restoring its
+// processes, which otherwise fails with an error of CRIU that hardly tells
+// what is missing. Differences in tolerable categories only log a warning if
+// the restored container has the CheckpointAnnotationTolerateSpecDrift
+// annotation. Checkpoints without a spec are not checked.
+func checkRestoreSpec(ctx context.Context, dir string, target *rspec.Spec) error {
+	checkpointed := &rspec.Spec{}
+	if _, err := metadata.ReadJSONFile(checkpointed, dir, metadata.SpecDumpFile); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			log.Debugf(ctx, "Checkpoint has no %s, not comparing it with the restored container", metadata.SpecDumpFile)
+			return nil
+		}
+		return fmt.Errorf("%w: %w", ErrCorruptCheckpointMetadata, err)
+	}
+	diff := diffRestoreSpec(checkpointed, target)
+	if len(diff) == 0 {
+		return nil
+	}
+	if target.Annotations[annotations.CheckpointAnnotationTolerateSpecDrift] == "true" && diff.tolerable() {
+		log.Warnf(ctx, "Restoring container although it differs from the checkpoint: %s", diff)
+		return nil
+	}
+	categories := []string{}
+	for category := range tolerableRestoreSpecCategories {
+		categories = append(categories, string(category))
+	}
+	sort.Strings(categories)
+	return fmt.Errorf("%w: %s (differences of %s are tolerated with the %s annotation)",
+		ErrRestoreSpecMismatch, diff, strings.Join(categories, " and "), annotations.CheckpointAnnotationTolerateSpecDrift)
+}
@@ -0,0 +1,127 @@
+package lib
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	metadata "github.com/checkpoint-restore/checkpointctl/lib"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	rspec "github.com/opencontainers/runtime-spec/specs-go"
+
+	"github.com/cri-o/cri-o/pkg/annotations"
+)
+
+func restoreDiffSpec() *rspec.Spec {
+	return &rspec.Spec{
+		Process: &rspec.Process{
+			Capabilities: &rspec.LinuxCapabilities{
+				Bounding:  []string{"CAP_CHOWN", "CAP_NET_BIND_SERVICE"},
+				Effective: []string{"CAP_CHOWN"},
+			},
+		},
+		Mounts: []rspec.Mount{
+			{Destination: "/proc", Type: "proc", Source: "proc"},
+			{Destination: "/data", Type: "bind", Source: "/mnt/node-a"},
+		},
+		Linux: &rspec.Linux{
+			Devices: []rspec.LinuxDevice{{Path: "/dev/fuse", Type: "c", Major: 10, Minor: 229}},
+			Sysctl:  map[string]string{"net.core.somaxconn": "1024"},
+			Resources: &rspec.LinuxResources{
+				CPU:    &rspec.LinuxCPU{Cpus: "0-3"},
+				Memory: &rspec.LinuxMemory{},
+			},
+		},
+	}
+}
+
+var _ = Describe("RestoreDiff", func() {
+	DescribeTable("diffRestoreSpec",
+		func(modify func(*rspec.Spec), expected restoreSpecDiff) {
+			target := restoreDiffSpec()
+			modify(target)
+			Expect(diffRestoreSpec(restoreDiffSpec(), target)).To(Equal(expected))
+		},
+		Entry("equal", func(spec *rspec.Spec) {
+			// Mount sources and memory limits change on restore.
+			spec.Mounts[1].Source = "/mnt/node-b"
+			limit := int64(1 << 30)
+			spec.Linux.Resources.Memory.Limit = &limit
+		}, restoreSpecDiff(nil)),
+		Entry("mounts", func(spec *rspec.Spec) {
+			spec.Mounts = spec.Mounts[:1]
+			spec.Mounts = append(spec.Mounts, rspec.Mount{Destination: "/cache/", Type: "tmpfs"})
+		}, restoreSpecDiff{
+			{Category: restoreSpecMounts, Item: "/cache", Target: "tmpfs"},
+			{Category: restoreSpecMounts, Item: "/data", Checkpointed: "bind"},
+		}),
+		Entry("devices", func(spec *rspec.Spec) {
+			spec.Linux.Devices = nil
+		}, restoreSpecDiff{
+			{Category: restoreSpecDevices, Item: "/dev/fuse", Checkpointed: "c 10:229"},
+		}),
+		Entry("capabilities", func(spec *rspec.Spec) {
+			spec.Process.Capabilities.Bounding = []string{"CAP_CHOWN", "CAP_SYS_ADMIN"}
+		}, restoreSpecDiff{
+			{Category: restoreSpecCapabilities, Item: "bounding CAP_NET_BIND_SERVICE", Checkpointed: "granted"},
+			{Category: restoreSpecCapabilities, Item: "bounding CAP_SYS_ADMIN", Target: "granted"},
+		}),
+		Entry("sysctls and cgroup", func(spec *rspec.Spec) {
+			spec.Linux.Sysctl["net.core.somaxconn"] = "4096"
+			spec.Linux.Resources.CPU.Cpus = "0-1"
+			spec.Linux.Resources.Pids = &rspec.LinuxPids{Limit: 100}
+		}, restoreSpecDiff{
+			{Category: restoreSpecSysctls, Item: "net.core.somaxconn", Checkpointed: "1024", Target: "4096"},
+			{Category: restoreSpecCgroup, Item: "cpuset.cpus", Checkpointed: "0-3", Target: "0-1"},
+			{Category: restoreSpecCgroup, Item: "pids.max", Target: "100"},
+		}),
+	)
+
+	Context("checkRestoreSpec", func() {
+		var dir string
+
+		BeforeEach(func() {
+			dir = GinkgoT().TempDir()
+		})
+
+		It("should restore checkpoints without spec", func() {
+			Expect(checkRestoreSpec(context.Background(), dir, restoreDiffSpec())).To(Succeed())
+		})
+
+		It("should fail for a corrupt spec", func() {
+			Expect(os.WriteFile(filepath.Join(dir, metadata.SpecDumpFile), []byte("{"), 0o644)).To(Succeed())
+			Expect(checkRestoreSpec(context.Background(), dir, restoreDiffSpec())).To(MatchError(ErrCorruptCheckpointMetadata))
+		})
+
+		DescribeTable("should compare the checkpointed spec",
+			func(tolerate bool, modify func(*rspec.Spec), expected error) {
+				// Given
+				_, err := metadata.WriteJSONFile(restoreDiffSpec(), dir, metadata.SpecDumpFile)
+				Expect(err).ToNot(HaveOccurred())
+				target := restoreDiffSpec()
+				modify(target)
+				if tolerate {
+					target.Annotations = map[string]string{annotations.CheckpointAnnotationTolerateSpecDrift: "true"}
+				}
+
+				// When
+				err = checkRestoreSpec(context.Background(), dir, target)
+
+				// Then
+				if expected == nil {
+					Expect(err).ToNot(HaveOccurred())
+				} else {
+					Expect(err).To(MatchError(expected))
+				}
+			},
+			Entry("equal", false, func(*rspec.Spec) {}, nil),
+			Entry("sysctls", false, func(spec *rspec.Spec) { spec.Linux.Sysctl = nil }, ErrRestoreSpecMismatch),
+			Entry("tolerated sysctls", true, func(spec *rspec.Spec) { spec.Linux.Sysctl = nil }, nil),
+			Entry("devices", true, func(spec *rspec.Spec) {
+				spec.Linux.Sysctl = nil
+				spec.Linux.Devices = nil
+			}, ErrRestoreSpecMismatch),
+		)
+	})
+})
@@ -0,0 +1,61 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	rspec "github.com/opencontainers/runtime-spec/specs-go"
+
+	"github.com/cri-o/cri-o/internal/log"
+	"github.com/cri-o/cri-o/internal/oci"
+	libconfig "github.com/cri-o/cri-o/pkg/config"
+)
+
+// ErrReadOnlyRootfsRestore is returned if a container with a read-only root
+// file system cannot be restored, as its root file system cannot be made
+// writable for CRIU and read-only again afterwards.
+var ErrReadOnlyRootfsRestore = errors.New("cannot restore container with read-only root file system")
+
+// hasReadOnlyRootfs returns whether the root file system of spec is read-only.
+func hasReadOnlyRootfs(spec *rspec.Spec) bool {
+	return spec.Root != nil && spec.Root.Readonly
+}
+
+// checkReadOnlyRootfsRestore checks that the read-only root file system of
+// the container with spec of a runtime of runtimeType can be restored
+// writable and remounted read-only afterwards. This requires the container
+// to have its own mount namespace on the host, which the root file system
+// can be remounted in.
+func checkReadOnlyRootfsRestore(spec *rspec.Spec, runtimeType string) error {
+	if runtimeType == libconfig.RuntimeTypeVM {
+		return fmt.Errorf("%w: the root file system of containers of VM runtimes cannot be remounted", ErrReadOnlyRootfsRestore)
+	}
+	if spec.Linux != nil {
+		for _, ns := range spec.Linux.Namespaces {
+			if ns.Type != rspec.MountNamespace {
+				continue
+			}
+			if ns.Path != "" {
+				return fmt.Errorf("%w: the container joins the mount namespace %s", ErrReadOnlyRootfsRestore, ns.Path)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: the container has no mount namespace of its own", ErrReadOnlyRootfsRestore)
+}
+
+// finishReadOnlyRootfsRestore remounts the root file system of the restored
+// container ctr read-only. If that fails, the container is stopped instead of
+// being left running with a writable root file system.
+func (c *ContainerServer) finishReadOnlyRootfsRestore(ctx context.Context, ctr *oci.Container) error {
+	err := remountRootfsReadOnly(ctr.State().Pid)
+	if err == nil {
+		log.Debugf(ctx, "Remounted root file system of restored container %s read-only", ctr.ID())
+		return nil
+	}
+	if stopErr := c.runtime.StopContainer(ctx, ctr, 0); stopErr != nil {
+		log.Errorf(ctx, "Unable to stop container %s with writable root file system: %v", ctr.ID(), stopErr)
+	}
+	return fmt.Errorf("%w: remounting root file system of container %s read-only: %w", ErrReadOnlyRootfsRestore, ctr.ID(), err)
+}
@@ -0,0 +1,67 @@
+package lib
+
+import (
+	"fmt"
+	"runtime"
+
+	"golang.org/x/sys/unix"
+)
+
+// remountRootfsReadOnly remounts the root file system of the process pid
+// read-only in its mount namespace, keeping its other mount flags.
+func remountRootfsReadOnly(pid int) error {
+	errChan := make(chan error, 1)
+	go func() {
+		// The thread joins the mount namespace of the container, so it
+		// is never unlocked and exits with the goroutine instead of
+		// being reused.
+		runtime.LockOSThread()
+		errChan <- remountRootfsReadOnlyInNamespace(pid)
+	}()
+	return <-errChan
+}
+
+// remountRootfsReadOnlyInNamespace joins the mount namespace and the root
+// of the process pid with the calling thread and remounts its root read-only.
+func remountRootfsReadOnlyInNamespace(pid int) error {
+	// The root has to be opened before joining the namespace, in which
+	// the /proc of the host may not be visible.
+	root, err := unix.Open(fmt.Sprintf("/proc/%d/root", pid), unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("opening root of process %d: %w", pid, err)
+	}
+	defer unix.Close(root)
+	ns, err := unix.Open(fmt.Sprintf("/proc/%d/ns/mnt", pid), unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("opening mount namespace of process %d: %w", pid, err)
+	}
+	defer unix.Close(ns)
+
+	// Joining a mount namespace requires not sharing the root and working
+	// directory with the other threads.
+	if err := unix.Unshare(unix.CLONE_FS); err != nil {
+		return fmt.Errorf("unsharing file system attributes: %w", err)
+	}
+	if err := unix.Setns(ns, unix.CLONE_NEWNS); err != nil {
+		return fmt.Errorf("joining mount namespace of process %d: %w", pid, err)
+	}
+	if err := unix.Fchdir(root); err != nil {
+		return fmt.Errorf("changing to root of process %d: %w", pid, err)
+	}
+	if err := unix.Chroot("."); err != nil {
+		return fmt.Errorf("changing root to root of process %d: %w", pid, err)
+	}
+
+	// A bind remount replaces all per-mount flags, the ones which are set
+	// have to be kept.
+	var stat unix.Statfs_t
+	if err := unix.Statfs("/", &stat); err != nil {
+		return fmt.Errorf("getting mount flags of root file system: %w", err)
+	}
+	keep := uintptr(unix.MS_NOSUID | unix.MS_NODEV | unix.MS_NOEXEC | unix.MS_NOATIME | unix.MS_NODIRATIME | unix.MS_RELATIME)
+	flags := uintptr(unix.MS_BIND|unix.MS_REMOUNT|unix.MS_RDONLY) | uintptr(stat.Flags)&keep
+	if err := unix.Mount("", "/", "", flags, ""); err != nil {
+		return fmt.Errorf("remounting root file system read-only: %w", err)
+	}
+	return nil
+}
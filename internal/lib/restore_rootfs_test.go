@@ -0,0 +1,51 @@
+package lib
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	rspec "github.com/opencontainers/runtime-spec/specs-go"
+
+	libconfig "github.com/cri-o/cri-o/pkg/config"
+)
+
+var _ = Describe("RestoreRootfs", func() {
+	var (
+		ownNamespace = &rspec.Spec{Linux: &rspec.Linux{Namespaces: []rspec.LinuxNamespace{
+			{Type: rspec.PIDNamespace},
+			{Type: rspec.MountNamespace},
+		}}}
+		joinedNamespace = &rspec.Spec{Linux: &rspec.Linux{Namespaces: []rspec.LinuxNamespace{
+			{Type: rspec.MountNamespace, Path: "/proc/1/ns/mnt"},
+		}}}
+		noNamespace = &rspec.Spec{Linux: &rspec.Linux{Namespaces: []rspec.LinuxNamespace{
+			{Type: rspec.PIDNamespace},
+		}}}
+	)
+
+	DescribeTable("hasReadOnlyRootfs",
+		func(spec *rspec.Spec, expected bool) {
+			Expect(hasReadOnlyRootfs(spec)).To(Equal(expected))
+		},
+		Entry("without root", &rspec.Spec{}, false),
+		Entry("writable root", &rspec.Spec{Root: &rspec.Root{Path: "rootfs"}}, false),
+		Entry("read-only root", &rspec.Spec{Root: &rspec.Root{Path: "rootfs", Readonly: true}}, true),
+	)
+
+	DescribeTable("should restore read-only root file systems",
+		func(spec *rspec.Spec, runtimeType string) {
+			Expect(checkReadOnlyRootfsRestore(spec, runtimeType)).To(Succeed())
+		},
+		Entry("own mount namespace", ownNamespace, libconfig.DefaultRuntimeType),
+		Entry("pod runtime", ownNamespace, libconfig.RuntimeTypePod),
+	)
+
+	DescribeTable("should not restore read-only root file systems",
+		func(spec *rspec.Spec, runtimeType string) {
+			Expect(checkReadOnlyRootfsRestore(spec, runtimeType)).To(MatchError(ErrReadOnlyRootfsRestore))
+		},
+		Entry("VM runtime", ownNamespace, libconfig.RuntimeTypeVM),
+		Entry("joined mount namespace", joinedNamespace, libconfig.DefaultRuntimeType),
+		Entry("without mount namespace", noNamespace, libconfig.DefaultRuntimeType),
+		Entry("without namespaces", &rspec.Spec{}, libconfig.DefaultRuntimeType),
+	)
+})
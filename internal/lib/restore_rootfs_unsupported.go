@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package lib
+
+import "fmt"
+
+// remountRootfsReadOnly is only supported on Linux.
+func remountRootfsReadOnly(int) error {
+	return fmt.Errorf("%w: remounting the root file system is not supported on this platform", ErrCheckpointUnsupportedFeature)
+}
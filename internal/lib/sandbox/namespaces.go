@@ -91,6 +91,23 @@ func (s *Sandbox) NamespacePaths() []*ManagedNamespace {
 	return typesAndPaths
 }
 
+// ManagedNamespacePaths returns the paths of the namespaces managed by the
+// sandbox. Unlike NamespacePaths, namespaces of the infra container are left
+// out.
+func (s *Sandbox) ManagedNamespacePaths() []*ManagedNamespace {
+	typesAndPaths := make([]*ManagedNamespace, 0, nsmgr.ManagedNamespacesNum)
+	for _, ns := range []nsmgr.Namespace{s.utsns, s.ipcns, s.netns, s.userns} {
+		if ns == nil || ns.Path() == "" {
+			continue
+		}
+		typesAndPaths = append(typesAndPaths, &ManagedNamespace{
+			nsType: ns.Type(),
+			nsPath: ns.Path(),
+		})
+	}
+	return typesAndPaths
+}
+
 // RemoveManagedNamespaces removes the formerly mounted namespace.
 // Must be stopped first or this will fail.
 func (s *Sandbox) RemoveManagedNamespaces() error {
@@ -4,6 +4,7 @@ import (
 	"context"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -215,6 +216,24 @@ func mockRuntimeInLibConfigCheckpoint() {
 	}
 }
 
+// mockRuntimeInLibConfigDump mocks a runtime which writes a checkpoint image
+// to the image path, like CRIU.
+func mockRuntimeInLibConfigDump() {
+	runtimePath := filepath.Join(t.MustTempDir("runtime"), "runtime")
+	script := `#!/bin/sh
+while [ $# -gt 0 ]; do
+	if [ "$1" = --image-path ]; then
+		mkdir -p "$2" && touch "$2/pages-1.img"
+	fi
+	shift
+done
+`
+	Expect(os.WriteFile(runtimePath, []byte(script), 0o755)).To(Succeed())
+	config.Runtimes[config.DefaultRuntime] = &libconfig.RuntimeHandler{
+		RuntimePath: runtimePath,
+	}
+}
+
 func mockRuntimeToFalseInLibConfig() {
 	falseCMD, err := exec.LookPath("false")
 	Expect(err).NotTo(HaveOccurred())
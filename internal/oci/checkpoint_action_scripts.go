@@ -0,0 +1,101 @@
+package oci
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/opencontainers/runtime-tools/generate"
+)
+
+// CriuConfigAnnotation is the annotation runc and crun read the path of an
+// additional CRIU configuration file from.
+const CriuConfigAnnotation = "org.criu.config"
+
+// criuConfigFile is the CRIU configuration file in the run directory of a
+// container, see SetCriuConfig.
+const criuConfigFile = "criu.conf"
+
+// CriuOptionTCPClose lets CRIU restore connected TCP sockets in closed
+// state, for restores with other IPs than the checkpoint.
+const CriuOptionTCPClose = "tcp-close"
+
+// criuOptionGhostLimit is the CRIU option limiting the size of the files
+// deleted while still open which are included in a checkpoint.
+const criuOptionGhostLimit = "ghost-limit"
+
+// The environment identifying the container to the checkpoint action
+// scripts. CRIU sets the phase as CRTOOLS_SCRIPT_ACTION.
+const (
+	ActionScriptEnvContainerID   = "CRIO_CONTAINER_ID"
+	ActionScriptEnvContainerName = "CRIO_CONTAINER_NAME"
+	ActionScriptEnvSandboxID     = "CRIO_SANDBOX_ID"
+)
+
+// SetCriuConfig lets CRIU run the action scripts and use the additional
+// options, like CriuOptionTCPClose, when the container of specgen is
+// checkpointed or restored. A CRIU configuration file with them is written to
+// the run directory runDir of the container, and the runtime is pointed to
+// it. It replaces the default CRIU configuration file of the runtime, like
+// /etc/criu/runc.conf.
+func SetCriuConfig(specgen *generate.Generator, runDir string, scripts, options []string) error {
+	if len(scripts) == 0 && len(options) == 0 {
+		return nil
+	}
+	var config strings.Builder
+	for _, script := range scripts {
+		fmt.Fprintf(&config, "action-script %s\n", script)
+	}
+	for _, option := range options {
+		fmt.Fprintln(&config, option)
+	}
+	path := filepath.Join(runDir, criuConfigFile)
+	if err := os.WriteFile(path, []byte(config.String()), 0o600); err != nil {
+		return fmt.Errorf("write CRIU configuration: %w", err)
+	}
+	specgen.AddAnnotation(CriuConfigAnnotation, path)
+	return nil
+}
+
+// CriuGhostLimitOption returns the CRIU option for SetCriuConfig which lets
+// CRIU checkpoint files deleted while still open of up to limit bytes.
+func CriuGhostLimitOption(limit int64) string {
+	return fmt.Sprintf("%s %d", criuOptionGhostLimit, limit)
+}
+
+// SetCriuGhostLimit replaces the ghost file limit in the CRIU configuration
+// file at path, as written by SetCriuConfig, with limit bytes. The limit is
+// removed if zero, so that the default of CRIU applies. CRIU reads the file
+// for every checkpoint, which allows changing the limit of a single one.
+func SetCriuGhostLimit(path string, limit int64) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read CRIU configuration: %w", err)
+	}
+	var config strings.Builder
+	for _, line := range strings.SplitAfter(string(content), "\n") {
+		if line == "" || strings.HasPrefix(line, criuOptionGhostLimit+" ") {
+			continue
+		}
+		config.WriteString(line)
+	}
+	if limit > 0 {
+		fmt.Fprintln(&config, CriuGhostLimitOption(limit))
+	}
+	if err := os.WriteFile(path, []byte(config.String()), 0o600); err != nil {
+		return fmt.Errorf("write CRIU configuration: %w", err)
+	}
+	return nil
+}
+
+// checkpointActionScriptEnv returns the environment identifying the
+// container c to the checkpoint action scripts, which CRIU inherits from the
+// runtime.
+func checkpointActionScriptEnv(c *Container) []string {
+	return []string{
+		ActionScriptEnvContainerID + "=" + c.ID(),
+		ActionScriptEnvContainerName + "=" + c.Name(),
+		ActionScriptEnvSandboxID + "=" + c.Sandbox(),
+	}
+}
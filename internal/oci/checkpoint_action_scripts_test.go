@@ -0,0 +1,89 @@
+package oci
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/runtime-tools/generate"
+	types "k8s.io/cri-api/pkg/apis/runtime/v1"
+)
+
+var _ = Describe("CheckpointActionScripts", func() {
+	var specgen generate.Generator
+
+	BeforeEach(func() {
+		var err error
+		specgen, err = generate.New("linux")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	Describe("SetCriuConfig", func() {
+		It("should not configure CRIU without action scripts and options", func() {
+			// When
+			Expect(SetCriuConfig(&specgen, GinkgoT().TempDir(), nil, nil)).To(Succeed())
+
+			// Then
+			Expect(specgen.Config.Annotations).NotTo(HaveKey(CriuConfigAnnotation))
+		})
+
+		It("should write the CRIU configuration to the run directory", func() {
+			// Given
+			runDir := GinkgoT().TempDir()
+
+			// When
+			Expect(SetCriuConfig(&specgen, runDir, []string{"/usr/libexec/quiesce", "/usr/libexec/fixup"}, []string{CriuOptionTCPClose})).To(Succeed())
+
+			// Then
+			path := specgen.Config.Annotations[CriuConfigAnnotation]
+			Expect(path).To(Equal(filepath.Join(runDir, criuConfigFile)))
+			content, err := os.ReadFile(path)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(content)).To(Equal("action-script /usr/libexec/quiesce\naction-script /usr/libexec/fixup\ntcp-close\n"))
+		})
+	})
+
+	Describe("SetCriuGhostLimit", func() {
+		var path string
+
+		BeforeEach(func() {
+			Expect(SetCriuConfig(&specgen, GinkgoT().TempDir(), []string{"/usr/libexec/quiesce"}, []string{CriuGhostLimitOption(1024)})).To(Succeed())
+			path = specgen.Config.Annotations[CriuConfigAnnotation]
+		})
+
+		DescribeTable("should replace the ghost limit",
+			func(limit int64, expected string) {
+				Expect(SetCriuGhostLimit(path, limit)).To(Succeed())
+				content, err := os.ReadFile(path)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(content)).To(Equal(expected))
+			},
+			Entry("with a new limit", int64(4096), "action-script /usr/libexec/quiesce\nghost-limit 4096\n"),
+			Entry("without a limit", int64(0), "action-script /usr/libexec/quiesce\n"),
+		)
+	})
+
+	Describe("runtimeCmdContextStarted", func() {
+		It("should pass the action script environment to the runtime", func() {
+			// Given
+			dir := GinkgoT().TempDir()
+			envFile := filepath.Join(dir, "env")
+			r := newFakeRuntimeOCI(dir, "#!/bin/sh\necho \"$"+ActionScriptEnvContainerID+" $"+ActionScriptEnvSandboxID+" $PATH\" > "+envFile+"\n")
+			ctr, err := NewContainer("ctr", "name", "", "", nil, nil, nil, "", nil, nil, "", &types.ContainerMetadata{}, "sandbox", false, false, false, "", "", time.Now(), "")
+			Expect(err).ToNot(HaveOccurred())
+
+			// When
+			_, err = r.runtimeCmdContextStarted(context.Background(), nil, checkpointActionScriptEnv(ctr), "checkpoint", "ctr")
+
+			// Then
+			Expect(err).ToNot(HaveOccurred())
+			content, err := os.ReadFile(envFile)
+			Expect(err).ToNot(HaveOccurred())
+			// The runtime keeps the environment of CRI-O, CRIU is found in PATH.
+			Expect(string(content)).To(Equal("ctr sandbox " + os.Getenv("PATH") + "\n"))
+		})
+	})
+})
@@ -72,11 +72,15 @@ type Container struct {
 	pidns                 nsmgr.Namespace
 	restore               bool
 	restoreArchivePath    string
+	restoreStaged         bool
 	restoreStorageImageID *storage.StorageImageID
 	resources             *types.ContainerResources
 	runtimePath           string // runtime path for a given platform
 	execPIDs              map[int]bool
 	runtimeUser           *types.ContainerUser
+	criuUsage             *CriuResourceUsage
+	restoreShellJob       bool
+	restoreCgroupsMode    string
 }
 
 func (c *Container) CRIAttributes() *types.ContainerAttributes {
@@ -116,6 +120,12 @@ type ContainerState struct {
 	InitStartTime string `json:"initStartTime,omitempty"`
 	// Checkpoint/Restore related states
 	CheckpointedAt time.Time `json:"checkpointedTime,omitempty"`
+	// RestoreCount is the number of restores of the container, including
+	// those of the containers it has been checkpointed from.
+	RestoreCount int `json:"restoreCount,omitempty"`
+	// LastRestoreDuration is the time the last restore of the container
+	// took until its processes were running again.
+	LastRestoreDuration time.Duration `json:"lastRestoreDuration,omitempty"`
 }
 
 // NewContainer creates a container object.
@@ -332,6 +342,59 @@ func (c *Container) SetCheckpointedAt(checkpointedAt time.Time) {
 	c.state.CheckpointedAt = checkpointedAt
 }
 
+// RestoreCount returns the number of restores of the container.
+func (c *Container) RestoreCount() int {
+	return c.state.RestoreCount
+}
+
+// LastRestoreDuration returns the time the last restore of the container
+// took.
+func (c *Container) LastRestoreDuration() time.Duration {
+	return c.state.LastRestoreDuration
+}
+
+// SetRestored records a restore of the container which took duration and
+// made it the count-th restore.
+func (c *Container) SetRestored(count int, duration time.Duration) {
+	c.state.RestoreCount = count
+	c.state.LastRestoreDuration = duration
+}
+
+// ShellJob returns whether CRIU has to dump and restore the processes of the
+// container as shell job, as they are attached to a terminal whose session
+// is outside of the container. This is the case for containers with a tty
+// and for containers restored from a checkpoint of one.
+func (c *Container) ShellJob() bool {
+	return c.terminal || c.restoreShellJob
+}
+
+// SetRestoreShellJob sets whether the checkpoint the container is restored
+// from has been dumped as shell job.
+func (c *Container) SetRestoreShellJob(shellJob bool) {
+	c.restoreShellJob = shellJob
+}
+
+// RestoreManageCgroupsMode returns the manage-cgroups mode of CRIU the
+// container is restored with, or an empty string for the default of the
+// runtime.
+func (c *Container) RestoreManageCgroupsMode() string {
+	return c.restoreCgroupsMode
+}
+
+// SetRestoreManageCgroupsMode sets the manage-cgroups mode of CRIU the
+// container is restored with.
+func (c *Container) SetRestoreManageCgroupsMode(mode string) {
+	c.restoreCgroupsMode = mode
+}
+
+// CriuUsage returns the resource usage of CRIU during the last checkpoint
+// of the container, or nil if it has not been sampled.
+func (c *Container) CriuUsage() *CriuResourceUsage {
+	c.opLock.RLock()
+	defer c.opLock.RUnlock()
+	return c.criuUsage
+}
+
 // Name returns the name of the container.
 func (c *Container) Name() string {
 	return c.name
@@ -410,6 +473,17 @@ func (c *Container) CheckpointPath() string {
 	return filepath.Join(c.dir, metadata.CheckpointDirectory)
 }
 
+// CheckpointParentDirectory is the directory next to the checkpoint images
+// which holds the images of the parent of an incremental checkpoint.
+const CheckpointParentDirectory = "checkpoint-parent"
+
+// CheckpointParentPath returns the path to the directory containing the
+// images of the parent checkpoint. The runtime writes an incremental
+// checkpoint if this directory exists.
+func (c *Container) CheckpointParentPath() string {
+	return filepath.Join(c.dir, CheckpointParentDirectory, metadata.CheckpointDirectory)
+}
+
 // Metadata returns the metadata of the container.
 func (c *Container) Metadata() *types.ContainerMetadata {
 	return c.criContainer.Metadata
@@ -687,6 +761,18 @@ func (c *Container) SetRestoreArchivePath(restoreArchivePath string) {
 	c.restoreArchivePath = restoreArchivePath
 }
 
+// RestoreStaged returns if the content of the archive at RestoreArchivePath
+// has already been moved into the directory of the container, because the
+// archive has been staged ahead of the restore.
+func (c *Container) RestoreStaged() bool {
+	return c.restoreStaged
+}
+
+// SetRestoreStaged marks the archive at RestoreArchivePath as staged.
+func (c *Container) SetRestoreStaged(staged bool) {
+	c.restoreStaged = staged
+}
+
 // If Restore(), and the container is being restored from a container image, restoreStorageImageID returns the ID of that image.
 func (c *Container) RestoreStorageImageID() *storage.StorageImageID {
 	return c.restoreStorageImageID
@@ -9,6 +9,7 @@ import (
 
 	"github.com/containers/storage/pkg/idtools"
 	"github.com/containers/storage/pkg/unshare"
+	json "github.com/json-iterator/go"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/opencontainers/runtime-spec/specs-go"
@@ -407,6 +408,23 @@ var _ = t.Describe("Container", func() {
 			Expect(sutState.InitPid).To(Equal(0))
 		})
 
+		It("should keep the restore statistics across restarts", func() {
+			// Given
+			sut.SetRestored(2, 1500*time.Millisecond)
+			state, err := json.Marshal(sut.State())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(os.WriteFile(path.Join(sut.Dir(), "state.json"), state, 0o644)).To(Succeed())
+			sut.SetState(&oci.ContainerState{})
+
+			// When
+			err = sut.FromDisk()
+
+			// Then
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sut.RestoreCount()).To(Equal(2))
+			Expect(sut.LastRestoreDuration()).To(Equal(1500 * time.Millisecond))
+		})
+
 		It("should fail to get the state from disk if invalid json", func() {
 			// Given
 			Expect(os.WriteFile(path.Join(sut.Dir(), "state.json"),
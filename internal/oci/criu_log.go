@@ -0,0 +1,44 @@
+package oci
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// criuProcessTreeMessages are parts of the messages CRIU logs if it refuses
+// to dump processes whose session or process group leader is outside of the
+// dumped process tree.
+var criuProcessTreeMessages = []string{
+	"session leader",
+	"--shell-job",
+	"dangling tty",
+}
+
+// criuProcessTreeError returns the error CRIU logged to the dump log at
+// logPath if it refused to dump the process tree, or an empty string if it
+// failed for another reason or the log cannot be read.
+func criuProcessTreeError(logPath string) string {
+	f, err := os.Open(logPath)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		for _, message := range criuProcessTreeMessages {
+			if !strings.Contains(line, message) {
+				continue
+			}
+			// Strip the time stamp and the source of the message,
+			// like "(00.004) Error (criu/cr-dump.c:1363): ".
+			if _, msg, ok := strings.Cut(line, "): "); ok {
+				line = msg
+			}
+			return strings.TrimSpace(line)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,40 @@
+package oci
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CriuLog", func() {
+	var dir string
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+	})
+
+	DescribeTable("criuProcessTreeError",
+		func(log, expected string) {
+			path := filepath.Join(dir, "dump.log")
+			Expect(os.WriteFile(path, []byte(log), 0o644)).To(Succeed())
+			Expect(criuProcessTreeError(path)).To(Equal(expected))
+		},
+		Entry("should report a session leader",
+			"(00.001) Seized task 4242, state 1\n"+
+				"(00.004) Error (criu/cr-dump.c:1363): The root process 4242 is not a session leader. Consider using --shell-job option\n"+
+				"(00.004) Error (criu/cr-dump.c:2111): Dumping FAILED.\n",
+			"The root process 4242 is not a session leader. Consider using --shell-job option",
+		),
+		Entry("should not report other failures",
+			"(00.002) Error (criu/sk-inet.c:188): inet: Connected TCP socket, consider using --tcp-established option.\n"+
+				"(00.002) Error (criu/cr-dump.c:2111): Dumping FAILED.\n",
+			"",
+		),
+	)
+
+	It("should not report an error for a missing log", func() {
+		Expect(criuProcessTreeError(filepath.Join(dir, "missing.log"))).To(BeEmpty())
+	})
+})
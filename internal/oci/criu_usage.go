@@ -0,0 +1,220 @@
+package oci
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// criuUsageSampleInterval is the interval in which the resource usage
+	// of CRIU is sampled during a checkpoint.
+	criuUsageSampleInterval = 100 * time.Millisecond
+
+	// userHZ is the unit of the CPU times in /proc/<pid>/stat. It is 100 on
+	// all architectures supported by Linux.
+	userHZ = 100
+)
+
+// CriuResourceUsage is the resource usage of CRIU while checkpointing a
+// container. It is sampled from /proc and therefore best-effort, short-lived
+// CRIU processes may not be accounted at all.
+type CriuResourceUsage struct {
+	// PeakRSSBytes is the highest resident set size of a CRIU process.
+	PeakRSSBytes uint64 `json:"peakRSSBytes,omitempty"`
+	// CPUTime is the user and system CPU time consumed by the CRIU
+	// processes.
+	CPUTime time.Duration `json:"cpuTime,omitempty"`
+}
+
+// criuUsageSampler periodically samples the resource usage of the CRIU
+// processes spawned by the runtime.
+type criuUsageSampler struct {
+	procPath string
+	pid      int
+
+	mutex sync.Mutex
+	usage CriuResourceUsage
+	// cpuTimes holds the last sampled CPU time of every CRIU process.
+	cpuTimes map[int]time.Duration
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// startCriuUsageSampler starts sampling the CRIU processes among the
+// descendants of the runtime process pid until Stop is called.
+func startCriuUsageSampler(pid int, interval time.Duration) *criuUsageSampler {
+	s := &criuUsageSampler{
+		procPath: "/proc",
+		pid:      pid,
+		cpuTimes: make(map[int]time.Duration),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go s.run(interval)
+	return s
+}
+
+func (s *criuUsageSampler) run(interval time.Duration) {
+	defer close(s.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		s.sample()
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Stop stops the sampling and returns the resource usage of CRIU.
+func (s *criuUsageSampler) Stop() CriuResourceUsage {
+	close(s.stop)
+	<-s.done
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.usage
+}
+
+// sample records the resource usage of the CRIU processes currently running.
+// Processes which exit while being sampled are skipped.
+func (s *criuUsageSampler) sample() {
+	for _, pid := range descendantProcesses(s.procPath, s.pid) {
+		dir := filepath.Join(s.procPath, strconv.Itoa(pid))
+		comm, err := os.ReadFile(filepath.Join(dir, "comm"))
+		if err != nil || strings.TrimSpace(string(comm)) != "criu" {
+			continue
+		}
+		peakRSS, err := readPeakRSS(dir)
+		if err != nil {
+			continue
+		}
+		cpuTime, err := readCPUTime(dir)
+		if err != nil {
+			continue
+		}
+
+		s.mutex.Lock()
+		s.usage.PeakRSSBytes = max(s.usage.PeakRSSBytes, peakRSS)
+		s.usage.CPUTime += cpuTime - s.cpuTimes[pid]
+		s.cpuTimes[pid] = cpuTime
+		s.mutex.Unlock()
+	}
+}
+
+// DescendantProcesses returns the pids of all descendants of the process pid.
+// Processes spawned or exiting while the process tree is walked may be
+// missed.
+func DescendantProcesses(pid int) []int {
+	return descendantProcesses("/proc", pid)
+}
+
+// descendantProcesses returns the pids of all descendants of pid.
+func descendantProcesses(procPath string, pid int) []int {
+	var descendants []int
+	queue := []int{pid}
+	for len(queue) > 0 {
+		parent := queue[0]
+		queue = queue[1:]
+		// Every thread has its own children, the runtime may spawn CRIU
+		// from any of them.
+		tasks, err := os.ReadDir(filepath.Join(procPath, strconv.Itoa(parent), "task"))
+		if err != nil {
+			continue
+		}
+		for _, task := range tasks {
+			children, err := os.ReadFile(filepath.Join(procPath, strconv.Itoa(parent), "task", task.Name(), "children"))
+			if err != nil {
+				continue
+			}
+			for _, field := range strings.Fields(string(children)) {
+				child, err := strconv.Atoi(field)
+				if err != nil {
+					continue
+				}
+				descendants = append(descendants, child)
+				queue = append(queue, child)
+			}
+		}
+	}
+	return descendants
+}
+
+// readPeakRSS returns the peak resident set size of the process in dir.
+func readPeakRSS(dir string) (uint64, error) {
+	f, err := os.Open(filepath.Join(dir, "status"))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return parsePeakRSS(f)
+}
+
+// parsePeakRSS returns the VmHWM field of the content of a
+// /proc/<pid>/status file in bytes.
+func parsePeakRSS(r io.Reader) (uint64, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		value, found := strings.CutPrefix(scanner.Text(), "VmHWM:")
+		if !found {
+			continue
+		}
+		fields := strings.Fields(value)
+		if len(fields) != 2 || fields[1] != "kB" {
+			return 0, errors.New("unexpected format of VmHWM")
+		}
+		kb, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return kb * 1024, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, errors.New("VmHWM not found")
+}
+
+// readCPUTime returns the CPU time consumed by the process in dir.
+func readCPUTime(dir string) (time.Duration, error) {
+	stat, err := os.ReadFile(filepath.Join(dir, "stat"))
+	if err != nil {
+		return 0, err
+	}
+	return parseCPUTime(string(stat))
+}
+
+// parseCPUTime returns the sum of the utime and stime fields of the content
+// of a /proc/<pid>/stat file.
+func parseCPUTime(stat string) (time.Duration, error) {
+	// The command name may contain spaces and parentheses, the fields
+	// following it start after its last closing parenthesis.
+	end := strings.LastIndexByte(stat, ')')
+	if end < 0 {
+		return 0, errors.New("unexpected format of stat")
+	}
+	// The fields start with the state, which is field 3. utime and stime
+	// are fields 14 and 15.
+	fields := strings.Fields(stat[end+1:])
+	if len(fields) < 13 {
+		return 0, errors.New("unexpected format of stat")
+	}
+	var ticks uint64
+	for _, field := range fields[11:13] {
+		value, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		ticks += value
+	}
+	return time.Duration(ticks) * time.Second / userHZ, nil
+}
@@ -0,0 +1,97 @@
+package oci
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// writeFakeProcess creates the /proc entries of a process below procPath.
+func writeFakeProcess(procPath, pid, comm, children, peakRSSKB, utime string) {
+	dir := filepath.Join(procPath, pid)
+	Expect(os.MkdirAll(filepath.Join(dir, "task", pid), 0o755)).To(Succeed())
+	for name, content := range map[string]string{
+		"comm":                                 comm + "\n",
+		filepath.Join("task", pid, "children"): children,
+		"status":                               "Name:\t" + comm + "\nVmHWM:\t" + peakRSSKB + " kB\n",
+		"stat":                                 pid + " (" + comm + ") S 1 1 1 0 -1 0 0 0 0 0 " + utime + " 0 0 0 20 0 1 0 100 0 0",
+	} {
+		Expect(os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644)).To(Succeed())
+	}
+}
+
+var _ = Describe("CriuUsage", func() {
+	It("should parse the peak RSS", func() {
+		// When
+		peakRSS, err := parsePeakRSS(strings.NewReader("Name:\tcriu\nVmPeak:\t  204800 kB\nVmHWM:\t   51200 kB\nVmRSS:\t   40960 kB\n"))
+
+		// Then
+		Expect(err).ToNot(HaveOccurred())
+		Expect(peakRSS).To(BeEquivalentTo(51200 * 1024))
+	})
+
+	It("should fail to parse the peak RSS of kernel threads", func() {
+		// When
+		_, err := parsePeakRSS(strings.NewReader("Name:\tkthreadd\n"))
+
+		// Then
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should parse the CPU time", func() {
+		// When
+		cpuTime, err := parseCPUTime("4242 (criu (dump)) S 4241 4241 4241 0 -1 4194560 1234 0 0 0 150 50 0 0 20 0 1 0 100 0 0")
+
+		// Then
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cpuTime).To(Equal(2 * time.Second))
+	})
+
+	It("should fail to parse a truncated stat", func() {
+		// When
+		_, err := parseCPUTime("4242 (criu) S 4241")
+
+		// Then
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should sample the CRIU descendants of the runtime", func() {
+		// Given
+		procPath := GinkgoT().TempDir()
+		// The runtime spawns CRIU, which spawns another CRIU process.
+		writeFakeProcess(procPath, "100", "runc", "200 ", "8000", "500")
+		writeFakeProcess(procPath, "200", "criu", "300", "1000", "100")
+		writeFakeProcess(procPath, "300", "criu", "", "3000", "50")
+		s := &criuUsageSampler{
+			procPath: procPath,
+			pid:      100,
+			cpuTimes: make(map[int]time.Duration),
+		}
+
+		// When
+		s.sample()
+		// CPU time is accounted only once across samples.
+		writeFakeProcess(procPath, "200", "criu", "300", "1000", "200")
+		s.sample()
+
+		// Then
+		Expect(s.usage.PeakRSSBytes).To(BeEquivalentTo(3000 * 1024))
+		Expect(s.usage.CPUTime).To(Equal(2500 * time.Millisecond))
+	})
+
+	It("should report no usage without CRIU descendants", func() {
+		// Given
+		s := startCriuUsageSampler(os.Getpid(), time.Millisecond)
+		time.Sleep(5 * time.Millisecond)
+
+		// When
+		usage := s.Stop()
+
+		// Then
+		Expect(usage).To(BeZero())
+	})
+})
@@ -44,6 +44,15 @@ const (
 	maxExecSyncSize = 16 * 1024 * 1024
 )
 
+// ErrCheckpointRestoreUnsupported is returned if checkpoint/restore is not
+// available for a container, because CRIU is missing or too old or the
+// runtime of the container does not support it.
+var ErrCheckpointRestoreUnsupported = errors.New("checkpoint/restore not supported")
+
+// ErrCheckpointProcessTree is returned if CRIU refuses to dump the processes
+// of a container because of their session or process group.
+var ErrCheckpointProcessTree = errors.New("CRIU cannot dump the process tree of the container")
+
 // Runtime is the generic structure holding both global and specific
 // information about the runtime.
 type Runtime struct {
@@ -79,7 +88,9 @@ type RuntimeImpl interface {
 		int32, io.ReadWriteCloser) error
 	ReopenContainerLog(context.Context, *Container) error
 	CheckpointContainer(context.Context, *Container, *rspec.Spec, bool) error
+	CheckpointRestoreSupported(*Container) error
 	RestoreContainer(context.Context, *Container, string, string) error
+	VerifyRestore(context.Context, *Container, string, string, string) error
 }
 
 // New creates a new Runtime with options provided.
@@ -485,6 +496,17 @@ func (r *Runtime) CheckpointContainer(ctx context.Context, c *Container, specgen
 	return impl.CheckpointContainer(ctx, c, specgen, leaveRunning)
 }
 
+// CheckpointRestoreSupported returns an error if the runtime of the
+// container is not able to checkpoint and restore it.
+func (r *Runtime) CheckpointRestoreSupported(c *Container) error {
+	impl, err := r.RuntimeImpl(c)
+	if err != nil {
+		return err
+	}
+
+	return impl.CheckpointRestoreSupported(c)
+}
+
 // RestoreContainer restores a container.
 func (r *Runtime) RestoreContainer(ctx context.Context, c *Container, cgroupParent, mountLabel string) error {
 	impl, err := r.RuntimeImpl(c)
@@ -494,3 +516,14 @@ func (r *Runtime) RestoreContainer(ctx context.Context, c *Container, cgroupPare
 
 	return impl.RestoreContainer(ctx, c, cgroupParent, mountLabel)
 }
+
+// VerifyRestore test-restores the checkpoint images of c at imagePath into
+// the throwaway container id of the bundle at bundlePath.
+func (r *Runtime) VerifyRestore(ctx context.Context, c *Container, id, bundlePath, imagePath string) error {
+	impl, err := r.RuntimeImpl(c)
+	if err != nil {
+		return err
+	}
+
+	return impl.VerifyRestore(ctx, c, id, bundlePath, imagePath)
+}
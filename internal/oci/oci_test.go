@@ -229,7 +229,8 @@ var _ = t.Describe("Oci", func() {
 
 			// Then
 			Expect(err).To(HaveOccurred())
-			Expect(err.Error()).To(Equal("configured runtime does not support checkpoint/restore"))
+			Expect(err).To(MatchError(oci.ErrCheckpointRestoreUnsupported))
+			Expect(err.Error()).To(ContainSubstring("configured runtime does not support checkpoint/restore"))
 		})
 		It("RestoreContainer should fail with destination sandbox detection", func() {
 			if err := criu.CheckForCriu(criu.PodCriuVersion); err != nil {
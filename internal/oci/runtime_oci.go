@@ -179,6 +179,12 @@ func (r *runtimeOCI) CreateContainer(ctx context.Context, c *Container, cgroupPa
 				"--lsm-mount-context="+c.Spec().Linux.MountLabel,
 			)
 		}
+		if c.ShellJob() {
+			args = append(args, "--runtime-opt", "--shell-job")
+		}
+		if mode := c.RestoreManageCgroupsMode(); mode != "" {
+			args = append(args, "--runtime-opt", "--manage-cgroups-mode="+mode)
+		}
 	}
 
 	log.WithFields(ctx, logrus.Fields{
@@ -208,6 +214,11 @@ func (r *runtimeOCI) CreateContainer(ctx context.Context, c *Container, cgroupPa
 		if v, found := os.LookupEnv("PATH"); found {
 			cmd.Env = append(cmd.Env, "PATH="+v)
 		}
+		// conmon passes its environment on to the runtime, and CRIU
+		// on to the action scripts.
+		if len(r.config.CheckpointActionScripts) > 0 {
+			cmd.Env = append(cmd.Env, checkpointActionScriptEnv(c)...)
+		}
 	}
 
 	err = cmd.Start()
@@ -1406,7 +1417,105 @@ func (c *Container) conmonPidFilePath() string {
 // with an error, if any.
 func (r *runtimeOCI) runtimeCmd(args ...string) (string, error) {
 	runtimeArgs := append(r.defaultRuntimeArgs(), args...)
-	cmd := cmdrunner.Command(r.handler.RuntimePath, runtimeArgs...)
+	return r.runRuntimeCmd(cmdrunner.Command(r.handler.RuntimePath, runtimeArgs...), runtimeArgs, nil)
+}
+
+// runtimeCmdContext is like runtimeCmd, but runs the runtime in its own
+// process group and kills the whole group if the context is done before the
+// runtime exits. This includes helpers like CRIU spawned by the runtime,
+// which are waited for before returning.
+func (r *runtimeOCI) runtimeCmdContext(ctx context.Context, args ...string) (string, error) {
+	return r.runtimeCmdContextStarted(ctx, nil, nil, args...)
+}
+
+// runtimeCmdContextStarted is like runtimeCmdContext, but calls started with
+// the pid of the runtime once it is running, if not nil. The runtime gets env
+// in addition to the environment of CRI-O.
+func (r *runtimeOCI) runtimeCmdContextStarted(ctx context.Context, started func(pid int), env []string, args ...string) (string, error) {
+	runtimeArgs := append(r.defaultRuntimeArgs(), args...)
+	cmd := cmdrunner.CommandContext(ctx, r.handler.RuntimePath, runtimeArgs...)
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	killProcessGroupOnCancel(cmd)
+	out, err := r.runRuntimeCmd(cmd, runtimeArgs, started)
+	if err != nil && ctx.Err() != nil {
+		if cmd.Process != nil {
+			if waitErr := waitForProcessGroup(cmd.Process.Pid, processGroupExitTimeout); waitErr != nil {
+				err = errors.Join(err, waitErr)
+			}
+		}
+		return "", fmt.Errorf("%w: %w", ctx.Err(), err)
+	}
+	return out, err
+}
+
+// processGroupExitTimeout is the time to wait for the processes of a killed
+// process group to exit.
+const processGroupExitTimeout = 10 * time.Second
+
+// killProcessGroupOnCancel starts cmd in a new process group and kills the
+// whole group instead of only cmd if its context is done.
+func killProcessGroupOnCancel(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+	cmd.Cancel = func() error {
+		return unix.Kill(-cmd.Process.Pid, unix.SIGKILL)
+	}
+}
+
+// waitForProcessGroup waits until all processes of the process group pgid
+// exited. Processes which already exited but have not been reaped by their
+// parent yet are not taken into account.
+func waitForProcessGroup(pgid int, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for processGroupAlive(pgid) {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("processes of process group %d still running after %v", pgid, timeout)
+		}
+		// The group has been killed, it only takes the kernel a
+		// moment to tear the processes down.
+		time.Sleep(10 * time.Millisecond)
+	}
+	return nil
+}
+
+// processGroupAlive checks if a process of the process group pgid is running.
+func processGroupAlive(pgid int) bool {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		// Fall back to signaling the group, which also succeeds for
+		// zombie processes.
+		return unix.Kill(-pgid, 0) == nil
+	}
+	for _, entry := range entries {
+		if _, err := strconv.Atoi(entry.Name()); err != nil {
+			continue
+		}
+		stat, err := os.ReadFile(filepath.Join("/proc", entry.Name(), "stat"))
+		if err != nil {
+			continue
+		}
+		// The command name in parentheses may contain spaces, the
+		// fields following it are state, ppid and pgrp.
+		idx := bytes.LastIndexByte(stat, ')')
+		if idx < 0 {
+			continue
+		}
+		fields := strings.Fields(string(stat[idx+1:]))
+		if len(fields) < 3 || fields[0] == "Z" || fields[0] == "X" {
+			continue
+		}
+		if pgrp, err := strconv.Atoi(fields[2]); err == nil && pgrp == pgid {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *runtimeOCI) runRuntimeCmd(cmd *exec.Cmd, runtimeArgs []string, started func(pid int)) (string, error) {
 	var stdout bytes.Buffer
 	var stderr bytes.Buffer
 	cmd.Stdout = &stdout
@@ -1415,7 +1524,13 @@ func (r *runtimeOCI) runtimeCmd(args ...string) (string, error) {
 		cmd.Env = append(cmd.Env, "XDG_RUNTIME_DIR="+v)
 	}
 
-	err := cmd.Run()
+	err := cmd.Start()
+	if err == nil {
+		if started != nil {
+			started(cmd.Process.Pid)
+		}
+		err = cmd.Wait()
+	}
 	if err != nil {
 		stdErrStr := stderr.String()
 		switch {
@@ -1484,11 +1599,52 @@ func (r *runtimeOCI) CheckpointContainer(ctx context.Context, c *Container, spec
 	if leaveRunning {
 		args = append(args, "--leave-running")
 	}
+	// The processes of containers with a tty are in a session whose leader,
+	// conmon, is outside of the container.
+	if c.ShellJob() {
+		args = append(args, "--shell-job")
+	}
+	// CRIU only dumps the memory pages changed since the parent
+	// checkpoint. The path has to be relative to the image path.
+	if _, err := os.Stat(c.CheckpointParentPath()); err == nil {
+		parentPath, err := filepath.Rel(imagePath, c.CheckpointParentPath())
+		if err != nil {
+			return err
+		}
+		args = append(args, "--parent-path", parentPath)
+	}
 
 	args = append(args, c.ID())
 
-	_, err := r.runtimeCmd(args...)
+	// CRIU passes the environment of the runtime on to the action scripts.
+	var env []string
+	if len(r.config.CheckpointActionScripts) > 0 {
+		env = checkpointActionScriptEnv(c)
+	}
+
+	// Sampling the resource usage of CRIU is best-effort and never fails
+	// the checkpoint.
+	var sampler *criuUsageSampler
+	_, err := r.runtimeCmdContextStarted(ctx, func(pid int) {
+		sampler = startCriuUsageSampler(pid, criuUsageSampleInterval)
+	}, env, args...)
+	if sampler != nil {
+		usage := sampler.Stop()
+		log.Debugf(ctx, "CRIU used a peak RSS of %d bytes and %v of CPU time checkpointing container %s",
+			usage.PeakRSSBytes, usage.CPUTime, c.ID())
+		c.criuUsage = &usage
+	}
 	if err != nil {
+		if ctx.Err() != nil {
+			// The checkpoint has been aborted, CRIU leaves a partial
+			// image behind which cannot be used.
+			if err := os.RemoveAll(imagePath); err != nil {
+				log.Warnf(ctx, "Unable to remove partial checkpoint %s: %v", imagePath, err)
+			}
+		}
+		if reason := criuProcessTreeError(filepath.Join(workPath, metadata.DumpLogFile)); reason != "" {
+			return fmt.Errorf("%w: %s", ErrCheckpointProcessTree, reason)
+		}
 		return fmt.Errorf("running %q %q failed: %w", runtimePath, args, err)
 	}
 
@@ -1568,12 +1724,51 @@ func (r *runtimeOCI) RestoreContainer(ctx context.Context, c *Container, cgroupP
 	return nil
 }
 
+// VerifyRestore restores the checkpoint images at imagePath into the
+// throwaway container id, whose bundle at bundlePath has been prepared from
+// the checkpoint of c, and removes it again. The restore log is written to
+// bundlePath. The processes of c are not touched.
+func (r *runtimeOCI) VerifyRestore(ctx context.Context, c *Container, id, bundlePath, imagePath string) error {
+	if err := r.checkpointRestoreSupported(c.RuntimePathForPlatform(r)); err != nil {
+		return err
+	}
+	args := []string{
+		"restore",
+		"--detach",
+		"--bundle",
+		bundlePath,
+		"--image-path",
+		imagePath,
+		"--work-path",
+		bundlePath,
+	}
+	if c.ShellJob() {
+		args = append(args, "--shell-job")
+	}
+	args = append(args, id)
+
+	_, err := r.runtimeCmdContext(ctx, args...)
+	if _, deleteErr := r.runtimeCmd("delete", "--force", id); deleteErr != nil {
+		log.Debugf(ctx, "Unable to delete throwaway container %s: %v", id, deleteErr)
+	}
+	if err != nil {
+		return fmt.Errorf("running %q %q failed: %w", r.handler.RuntimePath, args, err)
+	}
+	return nil
+}
+
+// CheckpointRestoreSupported checks if CRIU and the runtime of the container
+// support checkpoint/restore.
+func (r *runtimeOCI) CheckpointRestoreSupported(c *Container) error {
+	return r.checkpointRestoreSupported(c.RuntimePathForPlatform(r))
+}
+
 func (r *runtimeOCI) checkpointRestoreSupported(runtimePath string) error {
 	if err := criu.CheckForCriu(criu.PodCriuVersion); err != nil {
-		return fmt.Errorf("check for CRIU %w", err)
+		return fmt.Errorf("%w: check for CRIU %w", ErrCheckpointRestoreUnsupported, err)
 	}
 	if !crutils.CRRuntimeSupportsCheckpointRestore(runtimePath) {
-		return errors.New("configured runtime does not support checkpoint/restore")
+		return fmt.Errorf("%w: configured runtime does not support checkpoint/restore", ErrCheckpointRestoreUnsupported)
 	}
 	return nil
 }
@@ -0,0 +1,109 @@
+package oci
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/cri-o/cri-o/pkg/config"
+)
+
+// newFakeRuntimeOCI returns a runtime in dir whose runtime binary is the
+// given shell script.
+func newFakeRuntimeOCI(dir, script string) *runtimeOCI {
+	cfg, err := config.DefaultConfig()
+	Expect(err).ToNot(HaveOccurred())
+	cfg.ContainerAttachSocketDir = GinkgoT().TempDir()
+	rt, err := New(cfg)
+	Expect(err).ToNot(HaveOccurred())
+
+	runtimePath := filepath.Join(dir, "runtime")
+	Expect(os.WriteFile(runtimePath, []byte(script), 0o755)).To(Succeed())
+	return &runtimeOCI{
+		Runtime: rt,
+		root:    dir,
+		handler: &config.RuntimeHandler{RuntimePath: runtimePath},
+	}
+}
+
+// processRunning checks if pid exists and has not exited yet.
+func processRunning(pid int) bool {
+	stat, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return false
+	}
+	fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+	return len(fields) > 0 && fields[0] != "Z" && fields[0] != "X"
+}
+
+var _ = Describe("RuntimeOCICheckpoint", func() {
+	Describe("runtimeCmdContext", func() {
+		It("should kill the process group of the runtime on cancel", func() {
+			// Given
+			// The container keeps running outside of the process group of
+			// the runtime.
+			container := exec.Command("sleep", "60")
+			Expect(container.Start()).To(Succeed())
+			DeferCleanup(func() {
+				container.Process.Kill() //nolint:errcheck
+				container.Wait()         //nolint:errcheck
+			})
+
+			// The fake runtime spawns a long running helper like runc
+			// spawns CRIU and blocks until the checkpoint is canceled.
+			dir := GinkgoT().TempDir()
+			pidFile := filepath.Join(dir, "helper.pid")
+			r := newFakeRuntimeOCI(dir, "#!/bin/sh\nsleep 60 &\necho $! > "+pidFile+".tmp\nmv "+pidFile+".tmp "+pidFile+"\nwait\n")
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go func() {
+				for {
+					if _, err := os.Stat(pidFile); err == nil {
+						cancel()
+						return
+					}
+					time.Sleep(10 * time.Millisecond)
+				}
+			}()
+
+			// When
+			_, err := r.runtimeCmdContext(ctx, "checkpoint", "ctr")
+
+			// Then
+			Expect(err).To(MatchError(context.Canceled))
+			content, err := os.ReadFile(pidFile)
+			Expect(err).ToNot(HaveOccurred())
+			helper, err := strconv.Atoi(strings.TrimSpace(string(content)))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(processRunning(helper)).To(BeFalse())
+			Expect(processRunning(container.Process.Pid)).To(BeTrue())
+		})
+	})
+
+	Describe("processGroupAlive", func() {
+		It("should not count the zombie of a killed process group", func() {
+			// Given
+			cmd := exec.CommandContext(context.Background(), "sleep", "60")
+			killProcessGroupOnCancel(cmd)
+			Expect(cmd.Start()).To(Succeed())
+			pgid := cmd.Process.Pid
+			Expect(processGroupAlive(pgid)).To(BeTrue())
+
+			// When
+			Expect(cmd.Process.Kill()).To(Succeed())
+
+			// Then
+			// Not reaped yet, the zombie does not count as running.
+			Expect(waitForProcessGroup(pgid, 10*time.Second)).To(Succeed())
+			cmd.Wait() //nolint:errcheck
+		})
+	})
+})
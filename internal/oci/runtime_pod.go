@@ -163,6 +163,14 @@ func (r *runtimePod) CheckpointContainer(
 	return r.oci.CheckpointContainer(ctx, c, specgen, leaveRunning)
 }
 
+func (r *runtimePod) CheckpointRestoreSupported(c *Container) error {
+	return r.oci.CheckpointRestoreSupported(c)
+}
+
+func (r *runtimePod) VerifyRestore(ctx context.Context, c *Container, id, bundlePath, imagePath string) error {
+	return r.oci.VerifyRestore(ctx, c, id, bundlePath, imagePath)
+}
+
 func (r *runtimePod) RestoreContainer(
 	ctx context.Context,
 	c *Container,
@@ -1255,7 +1255,12 @@ func (r *runtimeVM) CheckpointContainer(ctx context.Context, c *Container, specg
 	log.Debugf(ctx, "RuntimeVM.CheckpointContainer() start")
 	defer log.Debugf(ctx, "RuntimeVM.CheckpointContainer() end")
 
-	return errors.New("checkpointing not implemented for runtimeVM")
+	return fmt.Errorf("%w: checkpointing not implemented for runtimeVM", ErrCheckpointRestoreUnsupported)
+}
+
+// CheckpointRestoreSupported always fails for runtimeVM.
+func (r *runtimeVM) CheckpointRestoreSupported(*Container) error {
+	return fmt.Errorf("%w: checkpointing not implemented for runtimeVM", ErrCheckpointRestoreUnsupported)
 }
 
 // RestoreContainer not implemented for runtimeVM.
@@ -1263,7 +1268,12 @@ func (r *runtimeVM) RestoreContainer(ctx context.Context, c *Container, cgroupPa
 	log.Debugf(ctx, "RuntimeVM.RestoreContainer() start")
 	defer log.Debugf(ctx, "RuntimeVM.RestoreContainer() end")
 
-	return errors.New("restoring not implemented for runtimeVM")
+	return fmt.Errorf("%w: restoring not implemented for runtimeVM", ErrCheckpointRestoreUnsupported)
+}
+
+// VerifyRestore not implemented for runtimeVM.
+func (r *runtimeVM) VerifyRestore(context.Context, *Container, string, string, string) error {
+	return fmt.Errorf("%w: restoring not implemented for runtimeVM", ErrCheckpointRestoreUnsupported)
 }
 
 func EncodeKataVirtualVolumeToBase64(ctx context.Context, volume *katavolume.KataVirtualVolume) (string, error) {
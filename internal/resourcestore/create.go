@@ -0,0 +1,131 @@
+package resourcestore
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+
+	"github.com/sirupsen/logrus"
+)
+
+// StageCreating is the stage of a creation started by Create.
+const StageCreating = "creating"
+
+// creation is a creation of a resource in flight, started by Create. done is
+// closed once it finished, id and err hold its outcome.
+type creation struct {
+	done chan struct{}
+	id   string
+	err  error
+}
+
+// CreateFunc creates a resource for Create, adding the steps releasing it to
+// cleaner. The cleaner runs if the creation fails or panics, and if the
+// resource is never retrieved.
+type CreateFunc func(cleaner *ResourceCleaner) (IdentifiableCreatable, error)
+
+// Create returns the ID of the resource with the given name in the namespace, running
+// createFn to create it unless it is already in the store or being created.
+// createFn runs at most once per name at a time: concurrent callers for the
+// same name wait for the creation in flight and all receive its outcome,
+// either the ID of the resource or the error of createFn.
+// The creation is not bound to ctx. If ctx is done before the creation
+// finished, Create returns the error of ctx, while the creation continues
+// and the resource is Put into the store, so that a retried Create returns
+// it. Like Get, the first caller receiving the resource retrieves it from
+// the store and sets it as created.
+func (rc *ResourceStore) Create(ctx context.Context, namespace, name string, createFn CreateFunc) (string, error) {
+	key := resourceKey{namespace, name}
+	rc.creationsMutex.Lock()
+	c, inFlight := rc.creations[key]
+	if !inFlight {
+		if id, state := rc.GetResult(namespace, name); state == Retrieved {
+			rc.creationsMutex.Unlock()
+			return id, nil
+		}
+		c = &creation{done: make(chan struct{})}
+		if rc.creations == nil {
+			rc.creations = make(map[resourceKey]*creation)
+		}
+		rc.creations[key] = c
+		rc.SetStageForResource(ctx, namespace, name, StageCreating)
+		go rc.runCreation(key, c, createFn)
+	}
+	rc.creationsMutex.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case <-c.done:
+	}
+	if c.err != nil {
+		return "", c.err
+	}
+	if rc.retrieveCreated(key, c.id) {
+		rc.retrieved(key, c.id)
+	}
+	return c.id, nil
+}
+
+// runCreation runs createFn for the creation c of the resource with the
+// given key and Puts the resource into the store, or fails the creation.
+// A panic of createFn fails the creation like an error.
+// The waiting callers are notified once the creation has been removed from
+// the creations in flight.
+func (rc *ResourceStore) runCreation(key resourceKey, c *creation, createFn CreateFunc) {
+	cleaner := NewResourceCleaner()
+	resource, err := rc.callCreateFunc(key, createFn, cleaner)
+	if err == nil {
+		err = rc.Put(key.namespace, key.name, resource, cleaner)
+	}
+	if err != nil {
+		// Nobody is able to retrieve the resource.
+		if cleanupErr := cleaner.Cleanup(); cleanupErr != nil {
+			logrus.Errorf(rc.logFormat("Unable to clean up resource %s which failed to be created: %v"), key, cleanupErr)
+		}
+		rc.Fail(key.namespace, key.name, err)
+		c.err = err
+	} else {
+		c.id = resource.ID()
+	}
+
+	rc.creationsMutex.Lock()
+	delete(rc.creations, key)
+	rc.creationsMutex.Unlock()
+	close(c.done)
+}
+
+// callCreateFunc calls createFn with cleaner, returning a panic of createFn
+// as error.
+func (rc *ResourceStore) callCreateFunc(key resourceKey, createFn CreateFunc, cleaner *ResourceCleaner) (resource IdentifiableCreatable, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			logrus.Errorf(rc.logFormat("Creation of resource %s panicked: %v\n%s"), key, r, debug.Stack())
+			resource, err = nil, fmt.Errorf("creation of resource %s panicked: %v", key, r)
+		}
+	}()
+	return createFn(cleaner)
+}
+
+// retrieveCreated retrieves the resource with the given key from the store
+// like Get, if it is still the resource with the given ID. The resource may
+// already have been retrieved by another caller, and a later creation may
+// have Put another resource under the same name in the meantime. It returns
+// whether the resource has been retrieved.
+func (rc *ResourceStore) retrieveCreated(key resourceKey, id string) bool {
+	shard := rc.shardFor(key)
+	shard.mutex.Lock()
+	r, ok := shard.resources[key]
+	if !ok || !r.wasPut() || r.resource.ID() != id {
+		shard.mutex.Unlock()
+		return false
+	}
+	rc.removeResource(shard, key, r)
+	rc.recordRetrieval(r)
+	// no need to hold the lock when removing the manifest
+	shard.mutex.Unlock()
+
+	rc.removeManifest(r)
+	r.resource.SetCreated()
+	return true
+}
@@ -0,0 +1,78 @@
+package resourcestore
+
+import "time"
+
+const (
+	// ResourceKindPut are resources which have been Put into the store.
+	ResourceKindPut = "put"
+	// ResourceKindPlaceholder are entries of the store which only exist
+	// for watchers, labels or the stage of an in-flight creation.
+	ResourceKindPlaceholder = "placeholder"
+)
+
+// Metrics receives the instrumentation of a ResourceStore. It is implemented
+// by the metrics of the server, which keeps this package free of the
+// metrics registry.
+type Metrics interface {
+	// ResourcesAdd adjusts the number of entries of the given kind
+	// (ResourceKindPut or ResourceKindPlaceholder) in the namespace of the
+	// store by delta.
+	ResourcesAdd(namespace, kind string, delta int)
+	// PutInc counts a resource Put into the store.
+	PutInc()
+	// GetInc counts a Get, which is a hit if the resource was retrieved.
+	GetInc(hit bool)
+	// WatcherAddedInc counts a watcher registered for a resource.
+	WatcherAddedInc()
+	// StaleCleanupInc counts a run of the cleaner of a stale resource.
+	StaleCleanupInc()
+	// CleanupFailureInc counts a stale resource the store gave up
+	// cleaning up.
+	CleanupFailureInc()
+	// ResourceAgeAtGet observes the time a resource spent in the store
+	// until it has been retrieved by Get.
+	ResourceAgeAtGet(age time.Duration)
+	// WatchersAtPut observes the number of watchers waiting for a
+	// resource when it is Put.
+	WatchersAtPut(watchers int)
+	// RejectionInc counts an entry of the given kind which has not been
+	// added because the store is full.
+	RejectionInc(kind string)
+	// WatcherWaitDuration observes the time a watcher waited between being
+	// registered and being notified.
+	WatcherWaitDuration(wait time.Duration)
+	// CleanupBacklog sets the number of stale resources whose cleanup has
+	// been deferred to the next cycle of the cleanup routine.
+	CleanupBacklog(deferred int)
+	// RetrievalWait observes the time between a resource being Put and
+	// its retrieval by Get, and whether it had been marked as stale before.
+	RetrievalWait(wait time.Duration, wasStale bool)
+	// MaxLifetimeReapInc counts an entry of the given kind which has been
+	// reaped because it exceeded the max lifetime of the store.
+	MaxLifetimeReapInc(kind string)
+}
+
+// noopMetrics discards all instrumentation.
+type noopMetrics struct{}
+
+func (noopMetrics) ResourcesAdd(string, string, int)  {}
+func (noopMetrics) PutInc()                           {}
+func (noopMetrics) GetInc(bool)                       {}
+func (noopMetrics) WatcherAddedInc()                  {}
+func (noopMetrics) StaleCleanupInc()                  {}
+func (noopMetrics) CleanupFailureInc()                {}
+func (noopMetrics) ResourceAgeAtGet(time.Duration)    {}
+func (noopMetrics) WatchersAtPut(int)                 {}
+func (noopMetrics) RejectionInc(string)               {}
+func (noopMetrics) WatcherWaitDuration(time.Duration) {}
+func (noopMetrics) CleanupBacklog(int)                {}
+func (noopMetrics) RetrievalWait(time.Duration, bool) {}
+func (noopMetrics) MaxLifetimeReapInc(string)         {}
+
+// resourceKind returns the kind of the entry r for the metrics.
+func resourceKind(r *Resource) string {
+	if r.wasPut() {
+		return ResourceKindPut
+	}
+	return ResourceKindPlaceholder
+}
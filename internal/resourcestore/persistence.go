@@ -0,0 +1,235 @@
+package resourcestore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/renameio"
+
+	"github.com/cri-o/cri-o/internal/log"
+)
+
+const (
+	// manifestSuffix is the file name suffix of cleanup manifests.
+	manifestSuffix = ".json"
+
+	// corruptManifestSuffix is appended to the name of cleanup manifests
+	// which cannot be decoded, to move them out of the way of the replay.
+	corruptManifestSuffix = ".corrupt"
+)
+
+// CleanupManifest describes a resource which has been Put with enough
+// detail to clean it up after CRI-O has been restarted, when its
+// ResourceCleaner is gone.
+type CleanupManifest struct {
+	// Name is the name of the resource in the store.
+	Name string `json:"name"`
+	// Namespace is the namespace of the resource in the store.
+	Namespace string `json:"namespace,omitempty"`
+	// Type selects the CleanupHandler replaying the manifest.
+	Type string `json:"type"`
+	// IDs are the identifiers needed to reconstruct the cleanup, like the
+	// storage ID or the network namespace path.
+	IDs map[string]string `json:"ids,omitempty"`
+}
+
+// CleanupHandler cleans up the resource described by a manifest left over
+// by a previous run of CRI-O.
+type CleanupHandler func(ctx context.Context, manifest *CleanupManifest) error
+
+// SetManifest describes the resource cleaned up by the ResourceCleaner for
+// the persistence of the ResourceStore. Once the resource has been Put into
+// a store with a state directory, a cleanup manifest of the given type and
+// with the given IDs is kept on disk until the resource leaves the store.
+func (r *ResourceCleaner) SetManifest(typ string, ids map[string]string) {
+	r.manifest = &CleanupManifest{Type: typ, IDs: ids}
+}
+
+// manifestPath returns the path of the cleanup manifest of the resource
+// with the given key. Names are chosen by the client, so they are hashed.
+// Only the name is hashed in the DefaultNamespace, which keeps the paths of
+// manifests written before namespaces existed.
+func (rc *ResourceStore) manifestPath(key resourceKey) string {
+	hashed := key.name
+	if key.namespace != DefaultNamespace {
+		hashed = key.namespace + "\x00" + key.name
+	}
+	sum := sha256.Sum256([]byte(hashed))
+	return filepath.Join(rc.stateDir, hex.EncodeToString(sum[:])+manifestSuffix)
+}
+
+// encodeManifest returns the encoded cleanup manifest of the Put resource
+// r, or nil if the store or its cleaner do not support it. The shard of r
+// has to be locked by the caller.
+func (rc *ResourceStore) encodeManifest(r *Resource) []byte {
+	if rc.stateDir == "" || r.cleaner == nil || r.cleaner.manifest == nil {
+		return nil
+	}
+	manifest := *r.cleaner.manifest
+	manifest.Name = r.key.name
+	manifest.Namespace = r.key.namespace
+	content, err := json.Marshal(&manifest)
+	if err != nil {
+		log.Warnf(context.Background(), rc.logFormat("Unable to persist cleanup of resource %s: %v"), r.key, err)
+		return nil
+	}
+	return content
+}
+
+// persistManifest writes the encoded cleanup manifest of the Put resource r
+// in shard. The shard is not locked while writing, so that other requests
+// are not blocked on the disk. If r leaves the store in the meantime, the
+// manifest is not written or removed again. Failures are logged, the
+// resource is then only cleaned up as long as CRI-O keeps running.
+func (rc *ResourceStore) persistManifest(shard *resourceShard, r *Resource, content []byte) {
+	rc.manifestMutex.Lock()
+	defer rc.manifestMutex.Unlock()
+	if !rc.inShard(shard, r) {
+		return
+	}
+
+	path := rc.manifestPath(r.key)
+	err := os.MkdirAll(rc.stateDir, 0o700)
+	if err == nil {
+		err = renameio.WriteFile(path, content, 0o600)
+	}
+	if err != nil {
+		log.Warnf(context.Background(), rc.logFormat("Unable to persist cleanup of resource %s: %v"), r.key, err)
+		return
+	}
+
+	shard.mutex.Lock()
+	current := shard.resources[r.key] == r
+	if current {
+		r.persisted = true
+	}
+	shard.mutex.Unlock()
+	if !current {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Warnf(context.Background(), rc.logFormat("Unable to remove cleanup manifest of resource %s: %v"), r.key, err)
+		}
+	}
+}
+
+// inShard returns whether r is still the entry of its key in shard.
+func (rc *ResourceStore) inShard(shard *resourceShard, r *Resource) bool {
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+	return shard.resources[r.key] == r
+}
+
+// removeManifest removes the cleanup manifest of r once the resource left
+// the store without needing a cleanup, or has been cleaned up.
+func (rc *ResourceStore) removeManifest(r *Resource) {
+	if !r.persisted {
+		return
+	}
+	if err := os.Remove(rc.manifestPath(r.key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Warnf(context.Background(), rc.logFormat("Unable to remove cleanup manifest of resource %s: %v"), r.key, err)
+		return
+	}
+	r.persisted = false
+}
+
+// RegisterCleanupHandler registers the handler replaying the cleanup
+// manifests of the given type, see ReplayCleanupManifests.
+func (rc *ResourceStore) RegisterCleanupHandler(typ string, handler CleanupHandler) {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	if rc.cleanupHandlers == nil {
+		rc.cleanupHandlers = make(map[string]CleanupHandler)
+	}
+	rc.cleanupHandlers[typ] = handler
+}
+
+// ReplayCleanupManifests cleans up the resources whose cleanup manifests
+// have been left in the state directory by a previous run, which exited
+// before the resources left the store. Every manifest is passed to the
+// handler registered for its type and removed once the handler succeeded.
+// Manifests of failing handlers or of unknown types are kept for the next
+// replay. Manifests which cannot be decoded are logged and moved aside.
+func (rc *ResourceStore) ReplayCleanupManifests(ctx context.Context) {
+	if rc.stateDir == "" {
+		return
+	}
+	entries, err := os.ReadDir(rc.stateDir)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Warnf(ctx, rc.logFormat("Unable to read cleanup manifests: %v"), err)
+		}
+		return
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), manifestSuffix) {
+			continue
+		}
+		path := filepath.Join(rc.stateDir, entry.Name())
+		manifest, err := readManifest(path)
+		if err != nil {
+			log.Errorf(ctx, rc.logFormat("Moving aside corrupt cleanup manifest %s: %v"), path, err)
+			if err := os.Rename(path, path+corruptManifestSuffix); err != nil {
+				log.Warnf(ctx, rc.logFormat("Unable to move aside corrupt cleanup manifest %s: %v"), path, err)
+			}
+			continue
+		}
+		rc.replayManifest(ctx, path, manifest)
+	}
+}
+
+// replayManifest runs the cleanup handler for the manifest at path.
+func (rc *ResourceStore) replayManifest(ctx context.Context, path string, manifest *CleanupManifest) {
+	key := resourceKey{manifest.Namespace, manifest.Name}
+	rc.mutex.Lock()
+	handler, ok := rc.cleanupHandlers[manifest.Type]
+	rc.mutex.Unlock()
+	if !ok {
+		log.Warnf(ctx, rc.logFormat("No cleanup handler for resource %s of type %q, keeping its manifest"), key, manifest.Type)
+		return
+	}
+
+	log.Infof(ctx, rc.logFormat("Cleaning up resource %s left over by a previous run"), key)
+	if err := handler(ctx, manifest); err != nil {
+		log.Errorf(ctx, rc.logFormat("Unable to clean up resource %s left over by a previous run: %v"), key, err)
+		return
+	}
+
+	// The manifest belongs to a new resource if one with the same name has
+	// been Put in the meantime. Manifests of resources Put later are only
+	// written once the manifest has been removed.
+	rc.manifestMutex.Lock()
+	defer rc.manifestMutex.Unlock()
+	shard := rc.shardFor(key)
+	shard.mutex.Lock()
+	r, ok := shard.resources[key]
+	persisted := ok && r.persisted
+	shard.mutex.Unlock()
+	if persisted {
+		return
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Warnf(ctx, rc.logFormat("Unable to remove cleanup manifest %s: %v"), path, err)
+	}
+}
+
+// readManifest reads and validates the cleanup manifest at path.
+func readManifest(path string) (*CleanupManifest, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	manifest := &CleanupManifest{}
+	if err := json.Unmarshal(content, manifest); err != nil {
+		return nil, err
+	}
+	if manifest.Name == "" || manifest.Type == "" {
+		return nil, fmt.Errorf("manifest without name or type: %s", content)
+	}
+	return manifest, nil
+}
@@ -2,6 +2,7 @@ package resourcestore
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -12,22 +13,29 @@ import (
 
 // ResourceCleaner is a structure that tracks
 // how to cleanup a resource.
-// CleanupFuncs can be added to it, and it can be told to
+// Named cleanup steps can be added to it, and it can be told to
 // Cleanup the resource.
 type ResourceCleaner struct {
-	funcs []cleanupFunc
+	steps []cleanupStep
+	// manifest describes the resource for the persistence of the
+	// ResourceStore, see SetManifest.
+	manifest *CleanupManifest
 }
 
-// A cleanupFunc is a function that cleans up one piece of
+// A cleanupStep is a function that cleans up one piece of
 // the associated resource.
-type cleanupFunc func() error
+type cleanupStep struct {
+	description string
+	fn          func() error
+}
 
 // NewResourceCleaner creates a new ResourceCleaner.
 func NewResourceCleaner() *ResourceCleaner {
 	return &ResourceCleaner{}
 }
 
-// Add adds a new CleanupFunc to the ResourceCleaner.
+// Add adds a new cleanup step to the ResourceCleaner. The description names
+// the step in the logs and in the error returned by Cleanup.
 func (r *ResourceCleaner) Add(ctx context.Context, description string, fn func() error) {
 	// Create a retry task on top of the provided function
 	task := func() error {
@@ -37,23 +45,34 @@ func (r *ResourceCleaner) Add(ctx context.Context, description string, fn func()
 				"Retried cleanup function %q too often, giving up",
 				description,
 			)
+			return err
 		}
-		return err
+		log.Debugf(ctx, "Cleanup step %q succeeded", description)
+		return nil
 	}
 
 	// Prepend reverse iterate by default
-	r.funcs = append([]cleanupFunc{task}, r.funcs...)
+	r.steps = append([]cleanupStep{{description: description, fn: task}}, r.steps...)
 }
 
-// Cleanup cleans up the resource, running
-// the cleanup funcs in opposite chronological order.
+// Cleanup cleans up the resource, running the cleanup steps in opposite
+// chronological order. A failing step does not stop the cleanup, the errors
+// of all failed steps are returned together, each naming its step. The
+// steps which succeeded are dropped, so that calling Cleanup again only
+// retries the failed ones.
 func (r *ResourceCleaner) Cleanup() error {
-	for _, f := range r.funcs {
-		if err := f(); err != nil {
-			return err
+	var (
+		failed []cleanupStep
+		errs   []error
+	)
+	for _, step := range r.steps {
+		if err := step.fn(); err != nil {
+			failed = append(failed, step)
+			errs = append(errs, fmt.Errorf("cleanup step %q failed: %w", step.description, err))
 		}
 	}
-	return nil
+	r.steps = failed
+	return errors.Join(errs...)
 }
 
 // retry attempts to execute fn up to defaultRetryTimes if its failure meets
@@ -65,17 +84,19 @@ func retry(ctx context.Context, description string, fn func() error) error {
 		Steps:    defaultRetryTimes,
 	}
 
+	var lastErr error
 	waitErr := wait.ExponentialBackoff(backoff, func() (bool, error) {
 		log.Infof(ctx, "%s", description)
 		if err := fn(); err != nil {
 			log.Errorf(ctx, "Failed to cleanup (probably retrying): %v", err)
+			lastErr = err
 			return false, nil
 		}
 		return true, nil
 	})
 
 	if waitErr != nil {
-		return fmt.Errorf("wait on retry: %w", waitErr)
+		return fmt.Errorf("wait on retry: %w: %w", waitErr, lastErr)
 	}
 
 	return nil
@@ -80,4 +80,82 @@ var _ = t.Describe("ResourceCleaner", func() {
 		Expect(err).To(HaveOccurred())
 		Expect(failureCnt).To(Equal(3))
 	})
+
+	It("should resume with the failed cleanup function", func() {
+		// Given
+		sut := resourcestore.NewResourceCleaner()
+		called2 := 0
+		failing := true
+		sut.Add(context.Background(), "test1", func() error {
+			if failing {
+				return errors.New("")
+			}
+			return nil
+		})
+		sut.Add(context.Background(), "test2", func() error {
+			called2++
+			return nil
+		})
+		Expect(sut.Cleanup()).NotTo(Succeed())
+
+		// When
+		failing = false
+		err := sut.Cleanup()
+
+		// Then
+		Expect(err).ToNot(HaveOccurred())
+		Expect(called2).To(Equal(1))
+	})
+
+	It("should run the cleanup steps in reverse order", func() {
+		// Given
+		sut := resourcestore.NewResourceCleaner()
+		order := []string{}
+		for _, step := range []string{"remove storage", "delete netns", "umount shm"} {
+			sut.Add(context.Background(), step, func() error {
+				order = append(order, step)
+				return nil
+			})
+		}
+
+		// When
+		err := sut.Cleanup()
+
+		// Then
+		Expect(err).ToNot(HaveOccurred())
+		Expect(order).To(Equal([]string{"umount shm", "delete netns", "remove storage"}))
+	})
+
+	It("should continue past failed steps and name them", func() {
+		// Given
+		sut := resourcestore.NewResourceCleaner()
+		order := []string{}
+		errNetns := errors.New("netns busy")
+		errShm := errors.New("shm busy")
+		sut.Add(context.Background(), "remove storage", func() error {
+			order = append(order, "remove storage")
+			return nil
+		})
+		sut.Add(context.Background(), "delete netns", func() error {
+			order = append(order, "delete netns")
+			return errNetns
+		})
+		sut.Add(context.Background(), "umount shm", func() error {
+			order = append(order, "umount shm")
+			return errShm
+		})
+
+		// When
+		err := sut.Cleanup()
+
+		// Then
+		Expect(err).To(HaveOccurred())
+		Expect(errors.Is(err, errNetns)).To(BeTrue())
+		Expect(errors.Is(err, errShm)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring(`cleanup step "umount shm" failed`))
+		Expect(err.Error()).To(ContainSubstring(`cleanup step "delete netns" failed`))
+		Expect(err.Error()).NotTo(ContainSubstring("remove storage"))
+		Expect(order).To(HaveLen(7))
+		Expect(order[6]).To(Equal("remove storage"))
+	})
 })
@@ -2,8 +2,12 @@ package resourcestore
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"hash/fnv"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -11,9 +15,61 @@ import (
 	"github.com/cri-o/cri-o/internal/log"
 )
 
+// ErrResourceRemoved is sent to the watchers of a resource which is removed
+// from the store before it has been created.
+var ErrResourceRemoved = errors.New("resource removed from store before it was created")
+
+// ErrStoreClosed is sent to the watchers of a resource which has not been
+// created yet when the store is shut down.
+var ErrStoreClosed = errors.New("resource store closed")
+
+// ErrStoreFull is returned if a resource cannot be added because the
+// ResourceStore holds the maximum number of entries of its kind.
+var ErrStoreFull = errors.New("resource store is full")
+
+// ErrResourceNotFound is returned by AddCleanup if the store holds no
+// resource which has been Put under the given name, for example because it
+// has already been retrieved or cleaned up. It is also sent to the watchers
+// of a resource which is retrieved or cleaned up during the notify delay.
+var ErrResourceNotFound = errors.New("resource not found in store")
+
+// ErrCreationAbandoned is sent to the watchers of a resource whose creation
+// has been claimed, but which has not been Put, failed or deleted before the
+// claim expired.
+var ErrCreationAbandoned = errors.New("creation abandoned before the resource was created")
+
+// ErrMaxLifetimeExceeded is sent to the watchers of a resource which has not
+// been created within the max lifetime of the store.
+var ErrMaxLifetimeExceeded = errors.New("resource exceeded the max lifetime of the store")
+
 const (
 	sleepTimeBeforeCleanup = 1 * time.Minute
 	StageUnknown           = "unknown"
+
+	// shardCount is the number of independently locked sub-maps of the
+	// ResourceStore. Operations on names in different shards do not contend
+	// on the same lock.
+	shardCount = 32
+
+	// placeholderCyclesBeforeReap is the number of cleanup cycles a
+	// placeholder without watchers survives before it is removed.
+	placeholderCyclesBeforeReap = 3
+
+	// maxCleanupAttempts is the number of times the cleaner of a stale
+	// resource is run before giving up on it.
+	maxCleanupAttempts = 5
+
+	// defaultCleanupWorkers is the number of cleaners of stale resources
+	// run in parallel by default.
+	defaultCleanupWorkers = 4
+
+	// defaultCleanupLogThreshold is the number of stale resources cleaned up
+	// by a cycle up to which each of them is logged at info level.
+	defaultCleanupLogThreshold = 10
+
+	// defaultClaimExpiry is the time a claimed creation may go without
+	// progress before it is considered abandoned, see Claim.
+	defaultClaimExpiry = 10 * time.Minute
 )
 
 // ResourceStore is a structure that saves information about a recently created resource.
@@ -22,12 +78,95 @@ const (
 // them if they're already stale, then sleeps for `timeout`.
 // Thus, it takes between `timeout` and `2*timeout` for unrequested resources to be cleaned up.
 // Another routine can request a watcher for a resource by calling WatcherForResource.
-// All watchers will be notified when the resource has successfully been created.
+// All watchers will be notified when the resource has successfully been created,
+// or with the cause if its creation failed.
+// The resources are distributed over several shards by the hash of their name,
+// so that operations on different names can proceed in parallel.
 type ResourceStore struct {
-	resources map[string]*Resource
-	timeout   time.Duration
+	// name tells stores holding different kinds of resources apart in the
+	// logs and metrics. It is empty for stores created without a name.
+	name   string
+	shards [shardCount]*resourceShard
+	// timeout is the staleness timeout, see SetTimeout.
+	timeout   atomic.Int64
 	closeChan chan struct{}
-	closed    bool
+	// deadlineChan wakes up the cleanup routine when a resource with its
+	// own timeout has been Put or an entry has been added to a store with a
+	// max lifetime, as its deadline may be before the next cleanup, or when
+	// the timeout of the store changed.
+	deadlineChan chan struct{}
+	closed       bool
+	mutex        sync.Mutex
+	// cleanupRetries are the stale resources whose cleanup failed and
+	// is retried, cleanupFailures those whose cleanup has been given up.
+	// They are no longer part of the shards.
+	cleanupRetries  []*Resource
+	cleanupFailures []*Resource
+	// cleanupBacklog are the stale resources which exceeded the limit of
+	// cleanups of a cycle, they are cleaned up first in the next cycle.
+	cleanupBacklog []*Resource
+	cleanupMutex   sync.Mutex
+	// maxCleanupsPerCycle limits the cleanups of a cycle if set,
+	// cleanupWorkers of them run in parallel.
+	maxCleanupsPerCycle int
+	cleanupWorkers      int
+	// cleanupLogThreshold is the number of cleanups of a cycle up to which
+	// each of them is logged at info level.
+	cleanupLogThreshold int
+	metrics             Metrics
+	// notifyDelay is the time between a resource being Put and its
+	// watchers being notified.
+	notifyDelay time.Duration
+	// resources and placeholders count the entries of the store by kind,
+	// maxResources and maxPlaceholders limit them if set.
+	resources       atomic.Int64
+	placeholders    atomic.Int64
+	maxResources    int
+	maxPlaceholders int
+	// stateDir holds the cleanup manifests of the resources which have
+	// been Put, cleanupHandlers replay them after a restart. The manifests
+	// are written and replayed outside of the shard locks, manifestMutex
+	// orders these writes and removals per store.
+	stateDir        string
+	cleanupHandlers map[string]CleanupHandler
+	manifestMutex   sync.Mutex
+	// claimExpiry is the expiry of claimed creations.
+	claimExpiry time.Duration
+	// maxLifetime is the time after which entries are reaped regardless
+	// of their staleness, see Options.MaxLifetime.
+	maxLifetime time.Duration
+	// onRetrieved is the hook called for retrieved resources.
+	onRetrieved func(namespace, name, id string)
+	// creations are the creations in flight started by Create.
+	creations      map[resourceKey]*creation
+	creationsMutex sync.Mutex
+}
+
+// DefaultNamespace is the namespace of the resources of callers which do not
+// need to isolate their resources from those of others.
+const DefaultNamespace = ""
+
+// resourceKey identifies an entry of the ResourceStore. Names are chosen by
+// the clients, entries of different namespaces with the same name are
+// independent of each other.
+type resourceKey struct {
+	namespace string
+	name      string
+}
+
+// String returns the name of the entry, prefixed with its namespace unless
+// it is in the DefaultNamespace.
+func (k resourceKey) String() string {
+	if k.namespace == DefaultNamespace {
+		return k.name
+	}
+	return k.namespace + "/" + k.name
+}
+
+// resourceShard is a subset of the resources of a ResourceStore,
+// guarded by its own lock.
+type resourceShard struct {
+	resources map[resourceKey]*Resource
 	mutex     sync.Mutex
 }
 
@@ -37,10 +176,64 @@ type ResourceStore struct {
 type Resource struct {
 	resource IdentifiableCreatable
 	cleaner  *ResourceCleaner
-	watchers []chan struct{}
+	watchers []*resourceWatcher
 	stale    bool
-	name     string
+	key      resourceKey
 	stage    string
+	labels   map[string]string
+	// addedAt is the time the entry has been added to the store, putAt
+	// the time the resource has been Put.
+	addedAt time.Time
+	putAt   time.Time
+	// firstWatcherAt is the time the first watcher has been registered,
+	// it is zero if the resource never had a watcher.
+	firstWatcherAt time.Time
+	// wasStale is set once the resource has been marked as stale, even if
+	// it has been touched since.
+	wasStale bool
+	// deadline is the time after which the resource is cleaned up if it
+	// has been Put with its own timeout. Resources without a deadline are
+	// cleaned up after being marked as stale.
+	deadline time.Time
+	// timeout is the timeout the resource has been Put with.
+	timeout time.Duration
+	// idleCycles counts the cleanup cycles a placeholder went without
+	// watchers.
+	idleCycles int
+	// cleanupAttempts counts the failed cleanups of a stale resource,
+	// nextCleanupAttempt is the time of the next one and cleanupErr the
+	// cause of the last failure.
+	cleanupAttempts    int
+	nextCleanupAttempt time.Time
+	cleanupErr         error
+	// persisted is set while the cleanup manifest of the resource is on
+	// disk.
+	persisted bool
+	// notified is set once the watchers have been notified about the
+	// resource being Put.
+	notified bool
+	// claimedUntil is the time the claim of the creation of a placeholder
+	// expires, see Claim. It is zero if the creation has not been claimed.
+	claimedUntil time.Time
+}
+
+// setLabels adds the labels to the resource, overwriting existing keys.
+func (r *Resource) setLabels(labels map[string]string) {
+	if len(labels) == 0 {
+		return
+	}
+	if r.labels == nil {
+		r.labels = make(map[string]string, len(labels))
+	}
+	for k, v := range labels {
+		r.labels[k] = v
+	}
+}
+
+// hasLabel checks whether the resource has the label key set to value.
+func (r *Resource) hasLabel(key, value string) bool {
+	v, ok := r.labels[key]
+	return ok && v == value
 }
 
 // wasPut checks that a resource has been fully defined yet.
@@ -49,6 +242,27 @@ func (r *Resource) wasPut() bool {
 	return r != nil && r.resource != nil
 }
 
+// isAbandoned checks whether a placeholder has no watchers left and no
+// creation in progress. Placeholders with a stage are owned by an in-flight
+// creation, which either Puts or Deletes them. If the creation has been
+// claimed, the placeholder is removed once the claim expired instead.
+func (r *Resource) isAbandoned() bool {
+	return len(r.watchers) == 0 && r.stage == ""
+}
+
+// resourceWatcher is notified about the creation of a resource.
+type resourceWatcher struct {
+	ch chan error
+	// registeredAt is the time the watcher has been requested, to measure
+	// how long it waited for the notification.
+	registeredAt time.Time
+}
+
+// newWatcher returns a watcher registered now.
+func newWatcher() *resourceWatcher {
+	return &resourceWatcher{ch: make(chan error, 1), registeredAt: time.Now()}
+}
+
 // IdentifiableCreatable are the qualities needed by the caller of the resource.
 // Once a resource is retrieved, SetCreated() will be called, indicating to the server
 // that resource is ready to be listed and operated upon, and ID() will be used to identify the
@@ -58,23 +272,257 @@ type IdentifiableCreatable interface {
 	SetCreated()
 }
 
+// Options configure a ResourceStore created by NewWithOptions or NewNamed.
+type Options struct {
+	// Timeout is the time between two runs of the cleanup routine.
+	// It defaults to one minute.
+	Timeout time.Duration
+	// Metrics receives the instrumentation of the store. It defaults to
+	// discarding it.
+	Metrics Metrics
+	// NotifyDelay delays notifying the watchers of a resource after it has
+	// been Put, which gives the creator time to finalize its own state
+	// before retried requests pick up the resource. It defaults to
+	// notifying them immediately.
+	NotifyDelay time.Duration
+	// MaxResources limits the number of resources which have been Put and
+	// are kept in the store. Put fails with ErrStoreFull for new names once
+	// the limit is reached. It defaults to no limit.
+	MaxResources int
+	// MaxPlaceholders limits the number of placeholders of watchers kept in
+	// the store. WatcherForResource declines to watch new names once the
+	// limit is reached. It defaults to no limit.
+	MaxPlaceholders int
+	// StateDir is the directory the cleanup manifests of the resources
+	// which have been Put are written to, see ResourceCleaner.SetManifest
+	// and ReplayCleanupManifests. They are not persisted if empty.
+	StateDir string
+	// MaxCleanupsPerCycle limits the number of stale resources cleaned up
+	// by one cycle of the cleanup routine, the oldest resources are cleaned
+	// up first. The remaining ones are carried over to the next cycle,
+	// which starts right away. It defaults to no limit.
+	MaxCleanupsPerCycle int
+	// CleanupWorkers is the number of stale resources cleaned up in
+	// parallel. It defaults to four.
+	CleanupWorkers int
+	// CleanupLogThreshold is the number of stale resources cleaned up by one
+	// cycle of the cleanup routine up to which each of them is logged at
+	// info level. Cycles cleaning up more resources only log a summary at
+	// info level, and the individual resources at debug level. A negative
+	// value always logs the individual resources at debug level. It
+	// defaults to ten.
+	CleanupLogThreshold int
+	// ClaimExpiry is the time a creation claimed with Claim may go without
+	// progress before it is considered abandoned. It defaults to ten
+	// minutes.
+	ClaimExpiry time.Duration
+	// MaxLifetime is the time after being added to the store after which an
+	// entry is reaped by the next cleanup cycle, even if it is not stale,
+	// has its own timeout or a creation in progress. It is a safety net
+	// against entries being kept alive indefinitely. It defaults to no
+	// limit.
+	MaxLifetime time.Duration
+	// OnRetrieved is called with the namespace, name and ID of every
+	// resource which has been retrieved and set as created, after the store
+	// released its locks. It runs on the goroutine retrieving the resource.
+	OnRetrieved func(namespace, name, id string)
+}
+
 // New creates a new ResourceStore, with a default timeout, and starts the cleanup function.
 func New() *ResourceStore {
 	return NewWithTimeout(sleepTimeBeforeCleanup)
 }
 
+// NewWithMetrics is like New, but reports the instrumentation of the store
+// to metrics.
+func NewWithMetrics(metrics Metrics) *ResourceStore {
+	return NewWithOptions(Options{Metrics: metrics})
+}
+
 // NewWithTimeout is used for testing purposes. It allows the caller to set the timeout, allowing for faster tests.
 // Most callers should use New instead.
 func NewWithTimeout(timeout time.Duration) *ResourceStore {
+	return NewWithOptions(Options{Timeout: timeout})
+}
+
+// NewWithOptions creates a new ResourceStore configured by opts, and starts
+// the cleanup function.
+func NewWithOptions(opts Options) *ResourceStore {
+	return NewNamed("", opts)
+}
+
+// NewNamed is like NewWithOptions, but names the store. Stores holding
+// different kinds of resources, like sandboxes and containers, can be
+// configured independently, and their log messages are prefixed with their
+// name.
+func NewNamed(name string, opts Options) *ResourceStore {
+	if opts.Timeout <= 0 {
+		opts.Timeout = sleepTimeBeforeCleanup
+	}
+	if opts.Metrics == nil {
+		opts.Metrics = noopMetrics{}
+	}
+	if opts.CleanupWorkers <= 0 {
+		opts.CleanupWorkers = defaultCleanupWorkers
+	}
+	if opts.CleanupLogThreshold == 0 {
+		opts.CleanupLogThreshold = defaultCleanupLogThreshold
+	}
+	if opts.ClaimExpiry <= 0 {
+		opts.ClaimExpiry = defaultClaimExpiry
+	}
 	rc := &ResourceStore{
-		resources: make(map[string]*Resource),
-		closeChan: make(chan struct{}, 1),
-		timeout:   timeout,
+		name:            name,
+		closeChan:       make(chan struct{}, 1),
+		deadlineChan:    make(chan struct{}, 1),
+		metrics:         opts.Metrics,
+		notifyDelay:     opts.NotifyDelay,
+		maxResources:    opts.MaxResources,
+		maxPlaceholders: opts.MaxPlaceholders,
+		stateDir:        opts.StateDir,
+
+		maxCleanupsPerCycle: opts.MaxCleanupsPerCycle,
+		cleanupWorkers:      opts.CleanupWorkers,
+		cleanupLogThreshold: opts.CleanupLogThreshold,
+		claimExpiry:         opts.ClaimExpiry,
+		maxLifetime:         opts.MaxLifetime,
+		onRetrieved:         opts.OnRetrieved,
+	}
+	rc.timeout.Store(int64(opts.Timeout))
+	for i := range rc.shards {
+		rc.shards[i] = &resourceShard{
+			resources: make(map[resourceKey]*Resource),
+		}
 	}
 	go rc.cleanupStaleResources()
 	return rc
 }
 
+// Name returns the name of the store, which is empty if it has been
+// created without one.
+func (rc *ResourceStore) Name() string {
+	return rc.name
+}
+
+// Timeout returns the staleness timeout of the store.
+func (rc *ResourceStore) Timeout() time.Duration {
+	return time.Duration(rc.timeout.Load())
+}
+
+// SetTimeout changes the staleness timeout of the store, or resets it to the
+// default timeout if d is not positive. The cleanup routine is woken up, so
+// that the next cleanup cycle is due the new timeout after the last one
+// instead of after the old timeout. Resources Put with their own timeout
+// keep it.
+func (rc *ResourceStore) SetTimeout(d time.Duration) {
+	if d <= 0 {
+		d = sleepTimeBeforeCleanup
+	}
+	if old := time.Duration(rc.timeout.Swap(int64(d))); old == d {
+		return
+	}
+	logrus.Infof(rc.logFormat("Set staleness timeout to %v"), d)
+	rc.wakeCleanup()
+}
+
+// wakeCleanup wakes up the cleanup routine, so that it recomputes when its
+// next run is due. It does not block if a wakeup is already pending.
+func (rc *ResourceStore) wakeCleanup() {
+	select {
+	case rc.deadlineChan <- struct{}{}:
+	default:
+	}
+}
+
+// logFormat prefixes the format of a log message with the name of the
+// store, if it has one.
+func (rc *ResourceStore) logFormat(format string) string {
+	if rc.name == "" {
+		return format
+	}
+	return rc.name + " store: " + format
+}
+
+// shardFor returns the shard responsible for the resource with the given key.
+func (rc *ResourceStore) shardFor(key resourceKey) *resourceShard {
+	h := fnv.New32a()
+	// Write on a hash never fails.
+	_, _ = h.Write([]byte(key.namespace))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(key.name))
+	return rc.shards[h.Sum32()%shardCount]
+}
+
+// count returns the counter of the entries of the given kind.
+func (rc *ResourceStore) count(kind string) *atomic.Int64 {
+	if kind == ResourceKindPut {
+		return &rc.resources
+	}
+	return &rc.placeholders
+}
+
+// limit returns the maximum number of entries of the given kind, or zero
+// if they are not limited.
+func (rc *ResourceStore) limit(kind string) int {
+	if kind == ResourceKindPut {
+		return rc.maxResources
+	}
+	return rc.maxPlaceholders
+}
+
+// resourcesAdd adjusts the number of entries of the given kind in the
+// namespace by delta.
+func (rc *ResourceStore) resourcesAdd(namespace, kind string, delta int) {
+	rc.count(kind).Add(int64(delta))
+	rc.metrics.ResourcesAdd(namespace, kind, delta)
+}
+
+// addResource adds r to the shard, which has to be locked by the caller.
+func (rc *ResourceStore) addResource(shard *resourceShard, key resourceKey, r *Resource) {
+	r.addedAt = time.Now()
+	shard.resources[key] = r
+	rc.resourcesAdd(key.namespace, resourceKind(r), 1)
+	if rc.maxLifetime > 0 {
+		// wake up the cleanup routine, the entry may exceed the max
+		// lifetime before its next run
+		rc.wakeCleanup()
+	}
+}
+
+// tryAddResource is like addResource, but declines to add r and returns
+// false if the store already holds the maximum number of entries of its kind.
+func (rc *ResourceStore) tryAddResource(shard *resourceShard, key resourceKey, r *Resource) bool {
+	kind := resourceKind(r)
+	limit := rc.limit(kind)
+	if limit <= 0 {
+		rc.addResource(shard, key, r)
+		return true
+	}
+	// Count the entry before checking the limit, so that concurrent
+	// additions to other shards cannot exceed it.
+	count := rc.count(kind)
+	if count.Add(1) > int64(limit) {
+		count.Add(-1)
+		rc.metrics.RejectionInc(kind)
+		return false
+	}
+	r.addedAt = time.Now()
+	shard.resources[key] = r
+	rc.metrics.ResourcesAdd(key.namespace, kind, 1)
+	if rc.maxLifetime > 0 {
+		// wake up the cleanup routine, the entry may exceed the max
+		// lifetime before its next run
+		rc.wakeCleanup()
+	}
+	return true
+}
+
+// removeResource removes r from the shard, which has to be locked by the caller.
+func (rc *ResourceStore) removeResource(shard *resourceShard, key resourceKey, r *Resource) {
+	delete(shard.resources, key)
+	rc.resourcesAdd(key.namespace, resourceKind(r), -1)
+}
+
 func (rc *ResourceStore) Close() {
 	rc.mutex.Lock()
 	defer rc.mutex.Unlock()
@@ -85,22 +533,466 @@ func (rc *ResourceStore) Close() {
 	rc.closed = true
 }
 
+// Shutdown closes the store for a graceful shutdown of the server. Unlike
+// Close, it also drains the store: the watchers of in-flight creations are
+// notified with ErrStoreClosed, so that blocked requests return promptly,
+// and the cleaners of the resources which have been Put or are waiting for
+// a cleanup retry or in the backlog are run in the order of sortForCleanup.
+// If ctx has a deadline, every cleaner gets an even share of the time left.
+// Cleaners which do not finish in time are abandoned, and once ctx is done
+// the remaining cleaners are skipped. The errors of all cleaners which failed
+// or did not run are returned together.
+// Shutdown may be called more than once, later calls find the store empty.
+func (rc *ResourceStore) Shutdown(ctx context.Context) error {
+	rc.Close()
+
+	resourcesToClean := []*Resource{}
+	for _, shard := range rc.shards {
+		shard.mutex.Lock()
+		for key, r := range shard.resources {
+			rc.removeResource(shard, key, r)
+			if r.wasPut() {
+				resourcesToClean = append(resourcesToClean, r)
+				continue
+			}
+			rc.notifyAll(r, ErrStoreClosed)
+		}
+		shard.mutex.Unlock()
+	}
+
+	rc.cleanupMutex.Lock()
+	resourcesToClean = append(resourcesToClean, rc.cleanupRetries...)
+	resourcesToClean = append(resourcesToClean, rc.cleanupBacklog...)
+	rc.cleanupRetries = nil
+	rc.cleanupBacklog = nil
+	rc.cleanupMutex.Unlock()
+	sortForCleanup(resourcesToClean)
+
+	var errs []error
+	for i, r := range resourcesToClean {
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, fmt.Errorf("cleanup %s skipped: %w", r.key, err))
+			continue
+		}
+		logrus.Infof(rc.logFormat("Cleaning up resource %s on shutdown"), r.key)
+		if err := rc.cleanupBefore(ctx, r, len(resourcesToClean)-i); err != nil {
+			errs = append(errs, fmt.Errorf("cleanup %s: %w", r.key, err))
+			continue
+		}
+		rc.removeManifest(r)
+	}
+	return errors.Join(errs...)
+}
+
+// cleanupBefore runs the cleaner of r, giving up on it once ctx is done or
+// its share of the time left until the deadline of ctx has passed, which is
+// shared by the cleaners of left resources.
+func (rc *ResourceStore) cleanupBefore(ctx context.Context, r *Resource, left int) error {
+	if deadline, ok := ctx.Deadline(); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Until(deadline)/time.Duration(left))
+		defer cancel()
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- r.cleaner.Cleanup()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("cleanup abandoned: %w", ctx.Err())
+	}
+}
+
 // cleanupStaleResources is responsible for cleaning up resources that haven't been gotten
 // from the store.
 // It runs on a loop, sleeping `sleepTimeBeforeCleanup` between each loop.
 // A resource will first be marked as stale before being cleaned up.
 // This means a resource will stay in the store between `sleepTimeBeforeCleanup` and `2*sleepTimeBeforeCleanup`.
+// Resources Put with their own timeout are instead cleaned up once their deadline has passed,
+// the loop wakes up early if a deadline is due before the next cleanup.
 // When a resource is cleaned up, it's removed from the store and the cleanup funcs in its cleaner are called.
+// The cleaners run in parallel and are started in the order of sortForCleanup.
+// If a cycle exceeds `maxCleanupsPerCycle`, the remaining resources are carried over to the next cycle,
+// which starts right away.
+// If they fail, the cleanup is retried with exponential backoff up to `maxCleanupAttempts` times.
+// Placeholders which have lost all their watchers are removed after `placeholderCyclesBeforeReap` loops.
 func (rc *ResourceStore) cleanupStaleResources() {
+	lastCleanup := time.Now()
 	for {
+		nextCleanup := lastCleanup.Add(rc.Timeout())
+		wait := time.Until(nextCleanup)
+		if deadline, ok := rc.nextDeadline(); ok && time.Until(deadline) < wait {
+			wait = time.Until(deadline)
+		}
+		if retry, ok := rc.nextCleanupRetry(); ok && time.Until(retry) < wait {
+			wait = time.Until(retry)
+		}
+		if rc.hasCleanupBacklog() {
+			wait = 0
+		}
 		select {
 		case <-rc.closeChan:
 			return
-		case <-time.After(rc.timeout):
+		case <-rc.deadlineChan:
+			continue
+		case <-time.After(wait):
+		}
+
+		now := time.Now()
+		cleanup := !now.Before(nextCleanup)
+		if cleanup {
+			lastCleanup = now
 		}
-		resourcesToReap := []*Resource{}
-		rc.mutex.Lock()
-		for name, r := range rc.resources {
+		rc.cleanupCycle(rc.dueCleanupRetries(now), rc.collectStaleResources(now, cleanup))
+	}
+}
+
+// cleanupCycle cleans up the resources whose cleanup is retried and the
+// stale resources, together with the backlog of the previous cycle. The
+// oldest resources are cleaned up first, those exceeding the limit of a
+// cycle make up the next backlog.
+func (rc *ResourceStore) cleanupCycle(retries, stale []*Resource) {
+	rc.cleanupMutex.Lock()
+	resources := append(rc.cleanupBacklog, retries...)
+	rc.cleanupBacklog = nil
+	rc.cleanupMutex.Unlock()
+	resources = append(resources, stale...)
+	if len(resources) == 0 {
+		return
+	}
+
+	sortForCleanup(resources)
+	var backlog []*Resource
+	if rc.maxCleanupsPerCycle > 0 && len(resources) > rc.maxCleanupsPerCycle {
+		backlog = resources[rc.maxCleanupsPerCycle:]
+		resources = resources[:rc.maxCleanupsPerCycle]
+	}
+	rc.cleanupMutex.Lock()
+	rc.cleanupBacklog = backlog
+	rc.cleanupMutex.Unlock()
+	rc.metrics.CleanupBacklog(len(backlog))
+	if len(backlog) > 0 {
+		logrus.Infof(rc.logFormat("Cleaning up %d stale resources, deferring %d to the next cycle"), len(resources), len(backlog))
+	} else {
+		logrus.Infof(rc.logFormat("Cleaning up %d stale resources"), len(resources))
+	}
+	if counts := countByNamespace(resources); len(counts) > 1 || counts[DefaultNamespace] == 0 {
+		logrus.Infof(rc.logFormat("Stale resources per namespace: %v"), counts)
+	}
+	// Reaping many resources at once would flood the log.
+	logf := logrus.Debugf
+	if len(resources) <= rc.cleanupLogThreshold {
+		logf = logrus.Infof
+	}
+
+	queue := make(chan *Resource)
+	var wg sync.WaitGroup
+	for range min(rc.cleanupWorkers, len(resources)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r := range queue {
+				if r.cleanupAttempts > 0 {
+					logf(rc.logFormat("Retrying cleanup of stale resource %s, attempt %d"), r.key, r.cleanupAttempts+1)
+				} else {
+					logf(rc.logFormat("Cleaning up stale resource %s"), r.key)
+				}
+				rc.cleanupResource(r)
+			}
+		}()
+	}
+	for _, r := range resources {
+		queue <- r
+	}
+	close(queue)
+	wg.Wait()
+}
+
+// countByNamespace returns the number of resources per namespace.
+func countByNamespace(resources []*Resource) map[string]int {
+	counts := make(map[string]int)
+	for _, r := range resources {
+		counts[r.key.namespace]++
+	}
+	return counts
+}
+
+// sortForCleanup sorts the resources to clean up in the order they have been
+// Put, oldest first, and by name if they have been Put at the same time.
+// Resources are collected from the shards in random order, cleaning them up
+// in this order instead makes the cleanup predictable.
+func sortForCleanup(resources []*Resource) {
+	sort.Slice(resources, func(i, j int) bool {
+		if !resources[i].putAt.Equal(resources[j].putAt) {
+			return resources[i].putAt.Before(resources[j].putAt)
+		}
+		return resources[i].key.String() < resources[j].key.String()
+	})
+}
+
+// hasCleanupBacklog checks whether stale resources have been deferred to
+// the next cleanup cycle.
+func (rc *ResourceStore) hasCleanupBacklog() bool {
+	rc.cleanupMutex.Lock()
+	defer rc.cleanupMutex.Unlock()
+	return len(rc.cleanupBacklog) > 0
+}
+
+// cleanupResource runs the cleaner of the stale resource r. If it fails, the
+// resource is queued for another attempt after a backoff doubling with every
+// attempt, until the store gives up on it after maxCleanupAttempts.
+func (rc *ResourceStore) cleanupResource(r *Resource) {
+	rc.metrics.StaleCleanupInc()
+	if r.cleanupAttempts == 0 && !r.firstWatcherAt.IsZero() {
+		// A client has been waiting for the resource, but did not come
+		// back for it before it became stale.
+		logrus.Warnf(rc.logFormat("Cleaning up stale resource %s which had watchers, the first one registered %v ago; the timeout of %v may be too short"), r.key, time.Since(r.firstWatcherAt).Round(time.Millisecond), rc.Timeout())
+	}
+	err := r.cleaner.Cleanup()
+	if err == nil {
+		rc.removeManifest(r)
+		return
+	}
+	rc.cleanupMutex.Lock()
+	defer rc.cleanupMutex.Unlock()
+	r.cleanupAttempts++
+	r.cleanupErr = err
+	if r.cleanupAttempts >= maxCleanupAttempts {
+		logrus.Errorf(rc.logFormat("Unable to cleanup stale resource %s after %d attempts, giving up: %v"), r.key, r.cleanupAttempts, err)
+		rc.metrics.CleanupFailureInc()
+		r.nextCleanupAttempt = time.Time{}
+		rc.cleanupFailures = append(rc.cleanupFailures, r)
+		return
+	}
+	backoff := rc.Timeout() << (r.cleanupAttempts - 1)
+	logrus.Warnf(rc.logFormat("Unable to cleanup stale resource %s, retrying in %v: %v"), r.key, backoff, err)
+	r.nextCleanupAttempt = time.Now().Add(backoff)
+	rc.cleanupRetries = append(rc.cleanupRetries, r)
+}
+
+// nextCleanupRetry returns the earliest time a failed cleanup is retried.
+func (rc *ResourceStore) nextCleanupRetry() (next time.Time, ok bool) {
+	rc.cleanupMutex.Lock()
+	defer rc.cleanupMutex.Unlock()
+	for _, r := range rc.cleanupRetries {
+		if !ok || r.nextCleanupAttempt.Before(next) {
+			next = r.nextCleanupAttempt
+			ok = true
+		}
+	}
+	return next, ok
+}
+
+// dueCleanupRetries removes the resources whose cleanup is due to be retried
+// at now from the retry queue and returns them.
+func (rc *ResourceStore) dueCleanupRetries(now time.Time) []*Resource {
+	rc.cleanupMutex.Lock()
+	defer rc.cleanupMutex.Unlock()
+	due := []*Resource{}
+	pending := rc.cleanupRetries[:0]
+	for _, r := range rc.cleanupRetries {
+		if now.Before(r.nextCleanupAttempt) {
+			pending = append(pending, r)
+			continue
+		}
+		due = append(due, r)
+	}
+	rc.cleanupRetries = pending
+	return due
+}
+
+// CleanupFailure describes a stale resource whose cleanup failed.
+type CleanupFailure struct {
+	// Name is the name of the resource.
+	Name string `json:"name"`
+	// Namespace is the namespace of the resource.
+	Namespace string `json:"namespace,omitempty"`
+	// Store is the name of the store holding the resource.
+	Store string `json:"store,omitempty"`
+	// Attempts is the number of failed cleanups.
+	Attempts int `json:"attempts"`
+	// NextAttempt is the time the cleanup is retried. It is not set if
+	// the store gave up cleaning up the resource.
+	NextAttempt *time.Time `json:"nextAttempt,omitempty"`
+	// Error is the cause of the last failed cleanup.
+	Error string `json:"error"`
+}
+
+// CleanupFailures returns the stale resources whose cleanup failed, both
+// those which are retried and those the store gave up on.
+func (rc *ResourceStore) CleanupFailures() []CleanupFailure {
+	rc.cleanupMutex.Lock()
+	defer rc.cleanupMutex.Unlock()
+	failures := []CleanupFailure{}
+	for _, r := range rc.cleanupRetries {
+		next := r.nextCleanupAttempt
+		failures = append(failures, CleanupFailure{
+			Name:        r.key.name,
+			Namespace:   r.key.namespace,
+			Store:       rc.name,
+			Attempts:    r.cleanupAttempts,
+			NextAttempt: &next,
+			Error:       r.cleanupErr.Error(),
+		})
+	}
+	for _, r := range rc.cleanupFailures {
+		failures = append(failures, CleanupFailure{
+			Name:      r.key.name,
+			Namespace: r.key.namespace,
+			Store:     rc.name,
+			Attempts:  r.cleanupAttempts,
+			Error:     r.cleanupErr.Error(),
+		})
+	}
+	return failures
+}
+
+// ResourceInfo describes an entry of the ResourceStore.
+type ResourceInfo struct {
+	// Name is the name of the resource.
+	Name string `json:"name"`
+	// Namespace is the namespace of the resource.
+	Namespace string `json:"namespace,omitempty"`
+	// Store is the name of the store holding the resource.
+	Store string `json:"store,omitempty"`
+	// Age is the time since the entry has been added to the store.
+	Age time.Duration `json:"age"`
+	// Put is set if the resource has been Put, otherwise the entry is a
+	// placeholder of an in-flight creation or of its watchers.
+	Put bool `json:"put"`
+	// Stale is set if the resource is cleaned up by the next cleanup cycle.
+	Stale bool `json:"stale"`
+	// Watchers is the number of watchers waiting for the resource.
+	Watchers int `json:"watchers"`
+	// Stage is the stage of an in-flight creation.
+	Stage string `json:"stage,omitempty"`
+}
+
+// List returns information about all entries of the store. Every shard is
+// only locked while its entries are copied.
+func (rc *ResourceStore) List() []ResourceInfo {
+	now := time.Now()
+	infos := []ResourceInfo{}
+	for _, shard := range rc.shards {
+		shard.mutex.Lock()
+		for key, r := range shard.resources {
+			infos = append(infos, ResourceInfo{
+				Name:      key.name,
+				Namespace: key.namespace,
+				Store:     rc.name,
+				Age:       now.Sub(r.addedAt),
+				Put:       r.wasPut(),
+				Stale:     r.stale,
+				Watchers:  len(r.watchers),
+				Stage:     r.stage,
+			})
+		}
+		shard.mutex.Unlock()
+	}
+	return infos
+}
+
+// StoreStats are aggregate numbers about the entries of a ResourceStore.
+type StoreStats struct {
+	// Entries is the number of entries of the store.
+	Entries int `json:"entries"`
+	// Put is the number of resources which have been Put.
+	Put int `json:"put"`
+	// Placeholders is the number of entries of in-flight creations or of
+	// their watchers.
+	Placeholders int `json:"placeholders"`
+	// Stale is the number of entries cleaned up by the next cleanup cycle.
+	Stale int `json:"stale"`
+	// Watchers is the number of watchers of all entries.
+	Watchers int `json:"watchers"`
+	// Namespaces is the number of entries per namespace, for the
+	// namespaces with entries.
+	Namespaces map[string]int `json:"namespaces,omitempty"`
+}
+
+// Stats returns aggregate numbers about the entries of the store. Unlike
+// List, it does not copy the entries and is cheap enough to be called on
+// every metrics scrape.
+func (rc *ResourceStore) Stats() StoreStats {
+	stats := StoreStats{Namespaces: map[string]int{}}
+	for _, shard := range rc.shards {
+		shard.mutex.Lock()
+		for key, r := range shard.resources {
+			stats.Entries++
+			stats.Namespaces[key.namespace]++
+			if r.wasPut() {
+				stats.Put++
+			} else {
+				stats.Placeholders++
+			}
+			if r.stale {
+				stats.Stale++
+			}
+			stats.Watchers += len(r.watchers)
+		}
+		shard.mutex.Unlock()
+	}
+	return stats
+}
+
+// nextDeadline returns the earliest deadline of all resources in the store
+// which have been Put with their own timeout, or of the claims of creations,
+// or the earliest time an entry exceeds the max lifetime.
+func (rc *ResourceStore) nextDeadline() (next time.Time, ok bool) {
+	for _, shard := range rc.shards {
+		shard.mutex.Lock()
+		for _, r := range shard.resources {
+			deadline := r.deadline
+			if !r.wasPut() {
+				deadline = r.claimedUntil
+			}
+			if expiry, expires := rc.lifetimeExpiry(r); expires && (deadline.IsZero() || expiry.Before(deadline)) {
+				deadline = expiry
+			}
+			if !deadline.IsZero() && (!ok || deadline.Before(next)) {
+				next = deadline
+				ok = true
+			}
+		}
+		shard.mutex.Unlock()
+	}
+	return next, ok
+}
+
+// lifetimeExpiry returns the time r exceeds the max lifetime of the store,
+// if it has one.
+func (rc *ResourceStore) lifetimeExpiry(r *Resource) (expiry time.Time, ok bool) {
+	if rc.maxLifetime <= 0 {
+		return time.Time{}, false
+	}
+	return r.addedAt.Add(rc.maxLifetime), true
+}
+
+// collectStaleResources removes the resources whose deadline passed before
+// now from the store and returns them. If cleanup is set, it additionally
+// runs a cleanup cycle for the resources without a deadline: stale resources
+// are removed and the remaining ones are marked as stale. Entries exceeding
+// the max lifetime are removed in any case, placeholders notify their
+// watchers with ErrMaxLifetimeExceeded.
+func (rc *ResourceStore) collectStaleResources(now time.Time, cleanup bool) []*Resource {
+	resourcesToReap := []*Resource{}
+	for _, shard := range rc.shards {
+		shard.mutex.Lock()
+		for key, r := range shard.resources {
+			if expiry, ok := rc.lifetimeExpiry(r); ok && !now.Before(expiry) {
+				kind := resourceKind(r)
+				logrus.Warnf(rc.logFormat("Reaping %s resource %s, it exceeded the max lifetime of %v"), kind, key, rc.maxLifetime)
+				rc.metrics.MaxLifetimeReapInc(kind)
+				rc.removeResource(shard, key, r)
+				if r.wasPut() {
+					resourcesToReap = append(resourcesToReap, r)
+				} else {
+					rc.notifyAll(r, ErrMaxLifetimeExceeded)
+				}
+				continue
+			}
 			// this resource shouldn't be marked as stale if it
 			// hasn't yet been added to the store.
 			// This can happen if a creation is in progress, and a watcher is added
@@ -108,85 +1000,528 @@ func (rc *ResourceStore) cleanupStaleResources() {
 			// If this resource isn't skipped from being marked as stale,
 			// we risk segfaulting in the Cleanup() step.
 			if !r.wasPut() {
+				if !r.claimedUntil.IsZero() && !now.Before(r.claimedUntil) {
+					// The creation neither Put, failed nor deleted
+					// the resource, nobody else is going to.
+					logrus.Warnf(rc.logFormat("Creation of resource %s at stage %q abandoned, notifying %d watchers"), key, r.stage, len(r.watchers))
+					rc.removeResource(shard, key, r)
+					rc.notifyAll(r, ErrCreationAbandoned)
+					continue
+				}
+				if !cleanup {
+					continue
+				}
+				if !r.isAbandoned() {
+					r.idleCycles = 0
+					continue
+				}
+				r.idleCycles++
+				if r.idleCycles >= placeholderCyclesBeforeReap {
+					logrus.Debugf(rc.logFormat("Removing abandoned placeholder for resource %s"), key)
+					rc.removeResource(shard, key, r)
+				}
+				continue
+			}
+			if !r.deadline.IsZero() {
+				if !now.Before(r.deadline) {
+					resourcesToReap = append(resourcesToReap, r)
+					rc.removeResource(shard, key, r)
+				}
+				continue
+			}
+			if !cleanup {
 				continue
 			}
 			if r.stale {
 				resourcesToReap = append(resourcesToReap, r)
-				delete(rc.resources, name)
+				rc.removeResource(shard, key, r)
 			}
 			r.stale = true
+			r.wasStale = true
 		}
 		// no need to hold the lock when running the cleanup functions
-		rc.mutex.Unlock()
+		shard.mutex.Unlock()
+	}
+	return resourcesToReap
+}
 
-		for _, r := range resourcesToReap {
-			logrus.Infof("Cleaning up stale resource %s", r.name)
-			if err := r.cleaner.Cleanup(); err != nil {
-				logrus.Errorf("Unable to cleanup: %v", err)
-			}
-		}
+// GetState describes the outcome of GetResult.
+type GetState int
+
+const (
+	// NotFound means that the store knows nothing about the name.
+	NotFound GetState = iota
+	// Pending means that the name is only known as placeholder of
+	// watchers or of a creation in progress, the resource has not been Put yet.
+	Pending
+	// Retrieved means that the resource has been Put and is now
+	// removed from the store and set as created.
+	Retrieved
+)
+
+// String returns the name of the state.
+func (s GetState) String() string {
+	switch s {
+	case NotFound:
+		return "NotFound"
+	case Pending:
+		return "Pending"
+	case Retrieved:
+		return "Retrieved"
 	}
+	return fmt.Sprintf("GetState(%d)", int(s))
 }
 
 // Get attempts to look up a resource by its name.
 // If it's found, it's removed from the store, and it is set as created.
 // Get returns an empty ID if the resource is not found,
 // and returns the value of the Resource's ID() method if it is.
-func (rc *ResourceStore) Get(name string) string {
-	rc.mutex.Lock()
-	defer rc.mutex.Unlock()
+// Use GetResult to tell a missing resource from one not yet Put,
+// or GetResource to retrieve the resource itself and its cleaner.
+func (rc *ResourceStore) Get(namespace, name string) string {
+	id, _ := rc.GetResult(namespace, name)
+	return id
+}
+
+// GetResult looks up a resource by its name like Get, but also reports
+// whether the name is unknown (NotFound), only has a placeholder which has
+// not been Put yet (Pending), or the resource has been retrieved (Retrieved).
+// The ID is only set for Retrieved.
+func (rc *ResourceStore) GetResult(namespace, name string) (id string, state GetState) {
+	r, state := rc.getResource(resourceKey{namespace, name})
+	if state != Retrieved {
+		return "", state
+	}
+	return r.resource.ID(), state
+}
+
+// GetResource looks up a resource by its name like Get, but returns the
+// resource which has been Put instead of its ID, together with its cleaner.
+// The resource is removed from the store and set as created. From then on
+// the store does not clean it up anymore: the caller owns the cleaner and
+// may run it, or add steps to it and hand it on, for work deferred past the
+// retrieval. It returns false and no cleaner if the resource is not found or
+// has not been Put yet, which includes a resource already retrieved, removed
+// or reaped, so a cleaner is never run by both the store and the caller.
+func (rc *ResourceStore) GetResource(namespace, name string) (IdentifiableCreatable, *ResourceCleaner, bool) {
+	r, state := rc.getResource(resourceKey{namespace, name})
+	if state != Retrieved {
+		return nil, nil, false
+	}
+	return r.resource, r.cleaner, true
+}
+
+func (rc *ResourceStore) getResource(key resourceKey) (*Resource, GetState) {
+	r, state := rc.takeResource(key)
+	if state == Retrieved {
+		rc.retrieved(key, r.resource.ID())
+	}
+	return r, state
+}
 
-	r, ok := rc.resources[name]
+// takeResource removes the resource with the given name from the store and
+// sets it as created if it has been Put.
+func (rc *ResourceStore) takeResource(key resourceKey) (*Resource, GetState) {
+	shard := rc.shardFor(key)
+	shard.mutex.Lock()
+	r, ok := shard.resources[key]
 	if !ok {
-		return ""
+		rc.metrics.GetInc(false)
+		shard.mutex.Unlock()
+		return nil, NotFound
 	}
 	// It is possible there are existing watchers,
 	// but no resource created yet
 	if !r.wasPut() {
-		return ""
+		rc.metrics.GetInc(false)
+		shard.mutex.Unlock()
+		return nil, Pending
 	}
-	delete(rc.resources, name)
+	rc.removeResource(shard, key, r)
+	rc.recordRetrieval(r)
+	// no need to hold the lock when removing the manifest
+	shard.mutex.Unlock()
+
+	rc.removeManifest(r)
 	r.resource.SetCreated()
-	return r.resource.ID()
+	return r, Retrieved
+}
+
+// retrieved calls the OnRetrieved hook of the store, if set, for the
+// retrieved resource with the given key and ID. The caller must not hold
+// any lock of the store, so that a slow hook cannot block it.
+func (rc *ResourceStore) retrieved(key resourceKey, id string) {
+	if rc.onRetrieved != nil {
+		rc.onRetrieved(key.namespace, key.name, id)
+	}
+}
+
+// recordRetrieval records the metrics of the retrieval of the Put resource r
+// and logs how long it waited for it.
+func (rc *ResourceStore) recordRetrieval(r *Resource) {
+	wait := time.Since(r.putAt)
+	rc.metrics.GetInc(true)
+	rc.metrics.ResourceAgeAtGet(wait)
+	rc.metrics.RetrievalWait(wait, r.wasStale)
+	if r.firstWatcherAt.IsZero() {
+		logrus.Debugf(rc.logFormat("Resource %s retrieved %v after it has been put (stale before: %v)"), r.key, wait, r.wasStale)
+		return
+	}
+	logrus.Debugf(rc.logFormat("Resource %s retrieved %v after it has been put and %v after its first watcher registered (stale before: %v)"), r.key, wait, time.Since(r.firstWatcherAt), r.wasStale)
+}
+
+// Peek looks up a resource by its name, like Get, but leaves it in the store
+// and does not set it as created. This allows several requests to observe
+// the same resource until it is cleaned up as stale.
+// Peek returns an empty ID if the resource is not found or has not been Put yet.
+func (rc *ResourceStore) Peek(namespace, name string) string {
+	resource, ok := rc.PeekResource(namespace, name)
+	if !ok {
+		return ""
+	}
+	return resource.ID()
+}
+
+// PeekResource looks up a resource by its name like Peek, but returns the
+// resource which has been Put instead of its ID. It returns false if the
+// resource is not found or has not been Put yet.
+func (rc *ResourceStore) PeekResource(namespace, name string) (IdentifiableCreatable, bool) {
+	key := resourceKey{namespace, name}
+	shard := rc.shardFor(key)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	r, ok := shard.resources[key]
+	if !ok || !r.wasPut() {
+		return nil, false
+	}
+	return r.resource, true
+}
+
+// PeekState reports whether an entry for the resource with the given name
+// exists and whether its creation has finished, which is the case once the
+// resource has been Put, together with the time since the entry has been
+// added. Unlike Get, it neither removes the resource nor sets it as created,
+// so status requests can tell an in-flight creation from a missing resource.
+func (rc *ResourceStore) PeekState(namespace, name string) (exists, created bool, age time.Duration) {
+	key := resourceKey{namespace, name}
+	shard := rc.shardFor(key)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	r, ok := shard.resources[key]
+	if !ok {
+		return false, false, 0
+	}
+	return true, r.wasPut(), time.Since(r.addedAt)
 }
 
 // Put takes a unique resource name (retrieved from the client request, not generated by the server),
 // a newly created resource, and functions to clean up that newly created resource.
 // It adds the Resource to the ResourceStore. It expects name to be unique, and
 // returns an error if a duplicate name is detected.
-func (rc *ResourceStore) Put(name string, resource IdentifiableCreatable, cleaner *ResourceCleaner) error {
-	rc.mutex.Lock()
-	defer rc.mutex.Unlock()
+func (rc *ResourceStore) Put(namespace, name string, resource IdentifiableCreatable, cleaner *ResourceCleaner) error {
+	return rc.PutWithLabels(namespace, name, resource, cleaner, nil)
+}
 
-	r, ok := rc.resources[name]
-	// if we don't already have a resource, create it
-	if !ok {
-		r = &Resource{}
-		rc.resources[name] = r
+// PutWithLabels is like Put, but additionally attaches the labels to the
+// Resource. Labels allow operating on groups of resources, for example all
+// resources belonging to one pod sandbox, via ListByLabel and RemoveByLabel.
+func (rc *ResourceStore) PutWithLabels(namespace, name string, resource IdentifiableCreatable, cleaner *ResourceCleaner, labels map[string]string) error {
+	return rc.put(resourceKey{namespace, name}, resource, cleaner, labels, 0)
+}
+
+// PutWithTimeout is like Put, but cleans up the resource once timeout has
+// passed without it being retrieved, instead of after the timeout of the
+// store. This allows keeping resources which are slow to be requested again,
+// for example sandboxes with a long image pull, for longer, while releasing
+// others sooner.
+func (rc *ResourceStore) PutWithTimeout(namespace, name string, resource IdentifiableCreatable, cleaner *ResourceCleaner, timeout time.Duration) error {
+	if err := rc.put(resourceKey{namespace, name}, resource, cleaner, nil, timeout); err != nil {
+		return err
 	}
+	// wake up the cleanup routine, the deadline may be before its next run
+	rc.wakeCleanup()
+	return nil
+}
+
+// put adds the resource to the store. A non-zero timeout sets the deadline
+// of the resource.
+func (rc *ResourceStore) put(key resourceKey, resource IdentifiableCreatable, cleaner *ResourceCleaner, labels map[string]string, timeout time.Duration) error {
+	shard := rc.shardFor(key)
+	r, manifest, err := rc.addPut(shard, key, resource, cleaner, labels, timeout)
+	if err != nil {
+		return err
+	}
+	if manifest != nil {
+		rc.persistManifest(shard, r, manifest)
+	}
+	return nil
+}
+
+// addPut adds the resource to the locked shard like put, returning the
+// encoded cleanup manifest to persist, if any.
+func (rc *ResourceStore) addPut(shard *resourceShard, key resourceKey, resource IdentifiableCreatable, cleaner *ResourceCleaner, labels map[string]string, timeout time.Duration) (*Resource, []byte, error) {
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	r, ok := shard.resources[key]
 	// make sure the resource hasn't already been added to the store
 	if ok && r.wasPut() {
-		return fmt.Errorf("failed to add entry %s to ResourceStore; entry already exists", name)
+		return nil, nil, fmt.Errorf("failed to add entry %s to ResourceStore; entry already exists", key)
+	}
+	if ok {
+		// Creations which are already known to the store are not limited,
+		// so that they cannot be starved by other names.
+		rc.resourcesAdd(key.namespace, ResourceKindPlaceholder, -1)
+		rc.resourcesAdd(key.namespace, ResourceKindPut, 1)
+	} else {
+		// if we don't already have a resource, create it
+		r = &Resource{resource: resource}
+		if !rc.tryAddResource(shard, key, r) {
+			return nil, nil, fmt.Errorf("failed to add entry %s to ResourceStore: %w", key, ErrStoreFull)
+		}
 	}
 
 	r.resource = resource
 	r.cleaner = cleaner
-	r.name = name
+	r.key = key
+	r.claimedUntil = time.Time{}
+	r.setLabels(labels)
+	r.putAt = time.Now()
+	if timeout > 0 {
+		r.timeout = timeout
+		r.deadline = r.putAt.Add(timeout)
+	}
+	manifest := rc.encodeManifest(r)
+
+	rc.metrics.PutInc()
+	rc.metrics.WatchersAtPut(len(r.watchers))
 
 	// now the resource is created, notify the watchers
+	if rc.notifyDelay > 0 {
+		go rc.notifyWatchersAfterDelay(shard, r)
+		return r, manifest, nil
+	}
+	rc.notifyWatchers(r)
+	return r, manifest, nil
+}
+
+// notifyWatchers notifies the watchers of the Put resource r, whose shard
+// has to be locked by the caller.
+func (rc *ResourceStore) notifyWatchers(r *Resource) {
+	r.notified = true
+	rc.notifyAll(r, nil)
+}
+
+// notifyAll notifies the watchers of r with err and drops them, as every
+// watcher is notified only once. The shard of r has to be locked by the
+// caller.
+func (rc *ResourceStore) notifyAll(r *Resource, err error) {
 	for _, w := range r.watchers {
-		w <- struct{}{}
+		rc.notify(r.key, w, err)
 	}
-	return nil
+	r.watchers = nil
+}
+
+// notify sends err to the watcher w of the resource with the given key
+// without blocking, and records how long w waited. Watchers are buffered for
+// a single notification, a full buffer means that w has already been
+// notified. Blocking on it would block the whole shard, whose lock is held.
+func (rc *ResourceStore) notify(key resourceKey, w *resourceWatcher, err error) {
+	select {
+	case w.ch <- err:
+	default:
+		logrus.Debugf(rc.logFormat("Dropping notification of a watcher of resource %s which has already been notified"), key)
+		return
+	}
+	wait := time.Since(w.registeredAt)
+	rc.metrics.WatcherWaitDuration(wait)
+	logrus.Debugf(rc.logFormat("Watcher of resource %s notified after waiting %v: %v"), key, wait, err)
+}
+
+// notifyWatchersAfterDelay notifies the watchers of the Put resource r once
+// the notify delay has passed, or immediately if the store is closed in the
+// meantime. Watchers unregistered during the delay are not notified, those
+// registered during the delay are. If r has been retrieved or removed from
+// the store during the delay, a retry would not find it anymore, so the
+// watchers are notified with ErrResourceNotFound instead.
+func (rc *ResourceStore) notifyWatchersAfterDelay(shard *resourceShard, r *Resource) {
+	timer := time.NewTimer(rc.notifyDelay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-rc.closeChan:
+	}
+
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+	if shard.resources[r.key] != r {
+		rc.notifyAll(r, ErrResourceNotFound)
+		return
+	}
+	rc.notifyWatchers(r)
+}
+
+// Fail marks the creation of the resource with the given name as failed.
+// All watchers are notified with err, so that retried requests fail with
+// the original cause instead of waiting for their deadline, and the
+// placeholder is removed from the store. Resources which have already been
+// Put are left untouched, as their creation succeeded.
+func (rc *ResourceStore) Fail(namespace, name string, err error) {
+	key := resourceKey{namespace, name}
+	shard := rc.shardFor(key)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	r, ok := shard.resources[key]
+	if !ok || r.wasPut() {
+		return
+	}
+	rc.removeResource(shard, key, r)
+	rc.notifyAll(r, err)
 }
 
 // Delete deletes the specified resource from the store.
 // Any resource that has a stage set, but was never Put should have Delete called, or else it will leak.
-func (rc *ResourceStore) Delete(name string) {
-	rc.mutex.Lock()
-	defer rc.mutex.Unlock()
+// The watchers of a resource which has not been Put yet are notified with
+// ErrResourceRemoved, like with Remove.
+func (rc *ResourceStore) Delete(namespace, name string) {
+	key := resourceKey{namespace, name}
+	shard := rc.shardFor(key)
+	shard.mutex.Lock()
+	r, ok := shard.resources[key]
+	if !ok {
+		shard.mutex.Unlock()
+		return
+	}
+	rc.removeResource(shard, key, r)
+	if !r.wasPut() {
+		rc.notifyAll(r, ErrResourceRemoved)
+	}
+	// no need to hold the lock when removing the manifest
+	shard.mutex.Unlock()
 
-	delete(rc.resources, name)
+	rc.removeManifest(r)
+}
+
+// Remove removes the resource with the given name from the store and runs
+// its cleaner immediately, instead of waiting for it to become stale. This
+// allows abandoning a resource, for example if its pod has been deleted.
+// The watchers of a resource which has not been Put yet are notified with
+// ErrResourceRemoved. All cleanup funcs are run, even if some of them fail,
+// and their errors are returned together. Removing an unknown name is a no-op.
+func (rc *ResourceStore) Remove(namespace, name string) error {
+	key := resourceKey{namespace, name}
+	shard := rc.shardFor(key)
+	shard.mutex.Lock()
+	r, ok := shard.resources[key]
+	if !ok {
+		shard.mutex.Unlock()
+		return nil
+	}
+	rc.removeResource(shard, key, r)
+	if !r.wasPut() {
+		rc.notifyAll(r, ErrResourceRemoved)
+		shard.mutex.Unlock()
+		return nil
+	}
+	// no need to hold the lock when running the cleanup functions
+	shard.mutex.Unlock()
+
+	logrus.Infof(rc.logFormat("Cleaning up removed resource %s"), key)
+	if err := r.cleaner.Cleanup(); err != nil {
+		return fmt.Errorf("cleanup %s: %w", key, err)
+	}
+	rc.removeManifest(r)
+	return nil
+}
+
+// AddCleanup adds a cleanup step to the cleaner of the resource with the given
+// name which has already been Put, for cleanup obligations which are only
+// learned afterwards. The step runs before those added so far, like with
+// ResourceCleaner.Add, whenever the resource is cleaned up by the store.
+// The shard of the resource stays locked while the step is added, so it
+// cannot race with a cleanup, which only starts once the resource has been
+// removed from the store. AddCleanup returns ErrResourceNotFound if the
+// resource is unknown, has not been Put yet, or has already been retrieved
+// or removed; the caller is then responsible for the cleanup itself.
+func (rc *ResourceStore) AddCleanup(ctx context.Context, namespace, name, description string, fn func() error) error {
+	key := resourceKey{namespace, name}
+	shard := rc.shardFor(key)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	r, ok := shard.resources[key]
+	if !ok || !r.wasPut() {
+		return fmt.Errorf("add cleanup step %q to %s: %w", description, key, ErrResourceNotFound)
+	}
+	r.cleaner.Add(ctx, description, fn)
+	return nil
+}
+
+// Touch protects the entry with the given name from the cleanup routine
+// for another cycle: a resource which has been Put loses its stale mark and
+// its own deadline starts over, a placeholder starts over counting the cycles
+// without watchers. Callers doing long-running work for an entry should Touch
+// it periodically. Touch returns false if the entry is no longer in the store.
+func (rc *ResourceStore) Touch(namespace, name string) bool {
+	key := resourceKey{namespace, name}
+	shard := rc.shardFor(key)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	r, ok := shard.resources[key]
+	if !ok {
+		return false
+	}
+	r.stale = false
+	r.idleCycles = 0
+	if r.timeout > 0 {
+		r.deadline = time.Now().Add(r.timeout)
+	}
+	rc.renewClaim(r)
+	return true
+}
+
+// Claim marks the creation of the resource with the given name as started
+// by the caller, who is responsible for Putting the resource, or calling
+// Fail or Delete. If none of them happens before the claim expires, for
+// example because the creation returned early or panicked, the creation is
+// considered abandoned: the cleanup routine notifies the watchers with
+// ErrCreationAbandoned and removes the placeholder. Setting a stage for the
+// resource and Touch renew the claim, so that creations which make progress
+// do not expire. Claiming a resource which has already been Put is a no-op,
+// as is claiming an unknown name while the store holds the maximum number of
+// placeholders.
+func (rc *ResourceStore) Claim(namespace, name string) {
+	key := resourceKey{namespace, name}
+	shard := rc.shardFor(key)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	r, ok := shard.resources[key]
+	if !ok {
+		r = &Resource{watchers: []*resourceWatcher{}, key: key}
+		if !rc.tryAddResource(shard, key, r) {
+			return
+		}
+	}
+	if r.wasPut() {
+		return
+	}
+	r.claimedUntil = time.Now().Add(rc.claimExpiry)
+	// wake up the cleanup routine, the claim may expire before its next run
+	rc.wakeCleanup()
+}
+
+// renewClaim extends the claim of the creation of the placeholder r, if it
+// has been claimed. The shard of r has to be locked by the caller.
+func (rc *ResourceStore) renewClaim(r *Resource) {
+	if r.wasPut() || r.claimedUntil.IsZero() {
+		return
+	}
+	r.claimedUntil = time.Now().Add(rc.claimExpiry)
 }
 
 // WatcherForResource looks up a Resource by name, and gives it a watcher.
@@ -196,35 +1531,268 @@ func (rc *ResourceStore) Delete(name string) {
 // This is useful for situations where clients retry requests quickly after they "fail" because
 // they've taken too long. Adding a watcher allows the server to slow down the client, but still
 // return the resource in a timely manner once it's actually created.
-func (rc *ResourceStore) WatcherForResource(name string) (watcher chan struct{}, stage string) {
-	rc.mutex.Lock()
-	defer rc.mutex.Unlock()
-	watcher = make(chan struct{}, 1)
-	r, ok := rc.resources[name]
+// The watcher receives nil once the resource has been Put and can be retrieved with Get,
+// or the error passed to Fail if its creation failed. It receives a single notification,
+// immediately if the resource can already be retrieved. Notified watchers are dropped
+// from the store, so that repeated calls do not accumulate them.
+// If the store already holds the maximum number of placeholders, no placeholder
+// is created for an unknown name and the returned watcher is nil.
+func (rc *ResourceStore) WatcherForResource(namespace, name string) (watcher chan error, stage string) {
+	watcher, stage, _ = rc.watcherForResource(resourceKey{namespace, name}, false)
+	return watcher, stage
+}
+
+// watcherForResource registers a watcher for the resource with the given
+// key like WatcherForResource. If pending is set, no watcher is registered
+// for a resource which has already been Put, which is reported as ready.
+func (rc *ResourceStore) watcherForResource(key resourceKey, pending bool) (watcher chan error, stage string, ready bool) {
+	shard := rc.shardFor(key)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+	r, ok := shard.resources[key]
+	if pending && ok && r.wasPut() {
+		return nil, r.stage, true
+	}
+	w := newWatcher()
 	if !ok {
-		rc.resources[name] = &Resource{
-			watchers: []chan struct{}{watcher},
-			name:     name,
+		if !rc.tryAddResource(shard, key, &Resource{
+			watchers:       []*resourceWatcher{w},
+			key:            key,
+			firstWatcherAt: w.registeredAt,
+		}) {
+			return nil, StageUnknown, false
 		}
-		return watcher, StageUnknown
+		rc.metrics.WatcherAddedInc()
+		return w.ch, StageUnknown, false
+	}
+	rc.metrics.WatcherAddedInc()
+	if r.firstWatcherAt.IsZero() {
+		r.firstWatcherAt = w.registeredAt
+	}
+	if r.notified {
+		// The resource can be retrieved already.
+		rc.notify(key, w, nil)
+		return w.ch, r.stage, false
 	}
-	r.watchers = append(r.watchers, watcher)
-	return watcher, r.stage
+	r.watchers = append(r.watchers, w)
+	return w.ch, r.stage, false
 }
 
-func (rc *ResourceStore) SetStageForResource(ctx context.Context, name, stage string) {
-	rc.mutex.Lock()
-	defer rc.mutex.Unlock()
-	r, ok := rc.resources[name]
+// WatcherForResourceWithContext is like WatcherForResource, but unregisters
+// the watcher once ctx is done. Placeholders created for a watcher which has
+// been unregistered are eventually removed by the cleanup routine.
+func (rc *ResourceStore) WatcherForResourceWithContext(ctx context.Context, namespace, name string) (watcher chan error, stage string) {
+	watcher, stage = rc.WatcherForResource(namespace, name)
+	if watcher == nil {
+		return nil, stage
+	}
+	context.AfterFunc(ctx, func() {
+		rc.removeWatcher(resourceKey{namespace, name}, watcher)
+	})
+	return watcher, stage
+}
+
+// WatcherForPendingResource is like WatcherForResourceWithContext, but only
+// registers a watcher while the resource has not been Put yet. For a resource
+// which has already been Put, it returns a nil watcher and no error, the
+// resource can then be retrieved with Get right away, even if its watchers
+// are only notified after the NotifyDelay. Unlike WatcherForResource, it
+// fails with ErrStoreFull if no placeholder can be created, so that a nil
+// watcher always means that the resource is ready.
+func (rc *ResourceStore) WatcherForPendingResource(ctx context.Context, namespace, name string) (watcher chan error, stage string, err error) {
+	key := resourceKey{namespace, name}
+	watcher, stage, ready := rc.watcherForResource(key, true)
+	if ready {
+		return nil, stage, nil
+	}
+	if watcher == nil {
+		return nil, stage, ErrStoreFull
+	}
+	context.AfterFunc(ctx, func() {
+		rc.removeWatcher(key, watcher)
+	})
+	return watcher, stage, nil
+}
+
+// removeWatcher unregisters the watcher from the resource with the given key.
+func (rc *ResourceStore) removeWatcher(key resourceKey, watcher chan error) {
+	shard := rc.shardFor(key)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+	r, ok := shard.resources[key]
+	if !ok {
+		return
+	}
+	for i, w := range r.watchers {
+		if w.ch == watcher {
+			r.watchers = append(r.watchers[:i], r.watchers[i+1:]...)
+			return
+		}
+	}
+}
+
+// SetLabelsForResource attaches the labels to the resource with the given
+// name, overwriting existing keys. If the resource is not in the store yet,
+// a placeholder is created, so that in-flight creations can be labeled before
+// they are Put. The labels are dropped if the store already holds the maximum
+// number of placeholders.
+func (rc *ResourceStore) SetLabelsForResource(namespace, name string, labels map[string]string) {
+	key := resourceKey{namespace, name}
+	shard := rc.shardFor(key)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+	r, ok := shard.resources[key]
+	if !ok {
+		r = &Resource{
+			watchers: []*resourceWatcher{},
+			key:      key,
+		}
+		if !rc.tryAddResource(shard, key, r) {
+			return
+		}
+	}
+	r.setLabels(labels)
+}
+
+// ListByLabel returns the names of all resources of the namespace with the
+// label key set to value, including in-flight creations which have not been
+// Put yet.
+func (rc *ResourceStore) ListByLabel(namespace, key, value string) []string {
+	names := []string{}
+	for _, shard := range rc.shards {
+		shard.mutex.Lock()
+		for k, r := range shard.resources {
+			if k.namespace == namespace && r.hasLabel(key, value) {
+				names = append(names, k.name)
+			}
+		}
+		shard.mutex.Unlock()
+	}
+	return names
+}
+
+// RemoveByLabel removes all resources of the namespace with the label key set
+// to value from the store and runs the cleaners of those which have already been Put.
+// The watchers of in-flight creations are notified with ErrResourceRemoved.
+// All cleaners are run, even if some of them fail, and their errors are
+// returned together.
+func (rc *ResourceStore) RemoveByLabel(namespace, key, value string) error {
+	resourcesToClean := []*Resource{}
+	for _, shard := range rc.shards {
+		shard.mutex.Lock()
+		for k, r := range shard.resources {
+			if k.namespace != namespace || !r.hasLabel(key, value) {
+				continue
+			}
+			rc.removeResource(shard, k, r)
+			if r.wasPut() {
+				resourcesToClean = append(resourcesToClean, r)
+				continue
+			}
+			// The watchers of resources which were Put have already
+			// been notified.
+			rc.notifyAll(r, ErrResourceRemoved)
+		}
+		// no need to hold the lock when running the cleanup functions
+		shard.mutex.Unlock()
+	}
+	sortForCleanup(resourcesToClean)
+
+	var errs []error
+	for _, r := range resourcesToClean {
+		logrus.Infof(rc.logFormat("Cleaning up resource %s with label %s=%s"), r.key, key, value)
+		if err := r.cleaner.Cleanup(); err != nil {
+			errs = append(errs, fmt.Errorf("cleanup %s: %w", r.key, err))
+			continue
+		}
+		rc.removeManifest(r)
+	}
+	return errors.Join(errs...)
+}
+
+// Reset returns the store to an empty state: all entries are removed, the
+// cleaners of the resources which have been Put or whose cleanup is pending
+// a retry or in the backlog are run, and the watchers of in-flight creations are notified with
+// ErrResourceRemoved. The record of given up cleanups is cleared as well.
+// Unlike Close, the store remains usable and its cleanup routine keeps
+// running. All cleaners are run, even if some of them fail, and their errors
+// are returned together.
+func (rc *ResourceStore) Reset() error {
+	resourcesToClean := []*Resource{}
+	for _, shard := range rc.shards {
+		shard.mutex.Lock()
+		for key, r := range shard.resources {
+			rc.removeResource(shard, key, r)
+			if r.wasPut() {
+				resourcesToClean = append(resourcesToClean, r)
+				continue
+			}
+			rc.notifyAll(r, ErrResourceRemoved)
+		}
+		// no need to hold the lock when running the cleanup functions
+		shard.mutex.Unlock()
+	}
+
+	rc.cleanupMutex.Lock()
+	resourcesToClean = append(resourcesToClean, rc.cleanupRetries...)
+	resourcesToClean = append(resourcesToClean, rc.cleanupBacklog...)
+	rc.cleanupRetries = nil
+	rc.cleanupBacklog = nil
+	rc.cleanupFailures = nil
+	rc.cleanupMutex.Unlock()
+	sortForCleanup(resourcesToClean)
+
+	var errs []error
+	for _, r := range resourcesToClean {
+		logrus.Infof(rc.logFormat("Cleaning up resource %s on reset"), r.key)
+		if err := r.cleaner.Cleanup(); err != nil {
+			errs = append(errs, fmt.Errorf("cleanup %s: %w", r.key, err))
+			continue
+		}
+		rc.removeManifest(r)
+	}
+	return errors.Join(errs...)
+}
+
+// WatcherCounts returns the number of watchers registered for each resource
+// in the store, keyed by the name prefixed with the namespace unless it is
+// the DefaultNamespace. Many watchers for a single resource indicate that the client
+// is retrying aggressively because the creation is slow.
+func (rc *ResourceStore) WatcherCounts() map[string]int {
+	counts := make(map[string]int)
+	for _, shard := range rc.shards {
+		shard.mutex.Lock()
+		for key, r := range shard.resources {
+			counts[key.String()] = len(r.watchers)
+		}
+		shard.mutex.Unlock()
+	}
+	return counts
+}
+
+// SetStageForResource sets the stage of the creation of the resource with
+// the given name and renews its claim. If the resource is not in the store
+// yet, a placeholder is created, unless the store already holds the maximum
+// number of placeholders.
+func (rc *ResourceStore) SetStageForResource(ctx context.Context, namespace, name, stage string) {
+	key := resourceKey{namespace, name}
+	shard := rc.shardFor(key)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+	r, ok := shard.resources[key]
 	if !ok {
-		log.Debugf(ctx, "Initializing stage for resource %s to %s", name, stage)
-		rc.resources[name] = &Resource{
-			watchers: []chan struct{}{},
-			name:     name,
+		if !rc.tryAddResource(shard, key, &Resource{
+			watchers: []*resourceWatcher{},
+			key:      key,
 			stage:    stage,
+		}) {
+			log.Debugf(ctx, rc.logFormat("Not tracking the stage %s of resource %s, the store is full"), stage, key)
+			return
 		}
+		log.Debugf(ctx, rc.logFormat("Initializing stage for resource %s to %s"), key, stage)
 		return
 	}
-	log.Debugf(ctx, "Setting stage for resource %s from %s to %s", name, r.stage, stage)
+	log.Debugf(ctx, rc.logFormat("Setting stage for resource %s from %s to %s"), key, r.stage, stage)
 	r.stage = stage
+	rc.renewClaim(r)
 }
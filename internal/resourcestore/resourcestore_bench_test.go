@@ -0,0 +1,47 @@
+package resourcestore_test
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/cri-o/cri-o/internal/resourcestore"
+)
+
+// BenchmarkParallelPutGetDistinctNames measures Put/Get throughput when all
+// goroutines operate on different names, which spreads the operations over
+// the shards of the store.
+func BenchmarkParallelPutGetDistinctNames(b *testing.B) {
+	sut := resourcestore.New()
+	defer sut.Close()
+
+	var counter atomic.Int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			name := "name-" + strconv.FormatInt(counter.Add(1), 10)
+			if err := sut.Put("", name, &entry{id: name}, resourcestore.NewResourceCleaner()); err != nil {
+				b.Fatal(err)
+			}
+			if id := sut.Get("", name); id != name {
+				b.Fatalf("unexpected id %q for %q", id, name)
+			}
+		}
+	})
+}
+
+// BenchmarkParallelStageSameName measures the fully contended case where all
+// goroutines operate on the same name and therefore on the same shard.
+func BenchmarkParallelStageSameName(b *testing.B) {
+	sut := resourcestore.New()
+	defer sut.Close()
+
+	ctx := context.Background()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			sut.SetStageForResource(ctx, "", testName, "stage")
+		}
+	})
+}
@@ -1,10 +1,20 @@
 package resourcestore_test
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
 	"golang.org/x/net/context"
 
 	"github.com/cri-o/cri-o/internal/resourcestore"
@@ -28,6 +38,169 @@ func (e *entry) SetCreated() {
 	e.created = true
 }
 
+// syncBuffer is a bytes.Buffer which can be written by the cleanup routine
+// while the test reads it.
+type syncBuffer struct {
+	mutex sync.Mutex
+	buf   bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.String()
+}
+
+// fakeMetrics records the instrumentation of a ResourceStore.
+type fakeMetrics struct {
+	mutex         sync.Mutex
+	resources     map[string]int
+	namespaces    map[string]int
+	puts          int
+	hits          int
+	misses        int
+	watchers      int
+	staleCleanups int
+	failures      int
+	ages          []time.Duration
+	rejections    map[string]int
+	waits         []time.Duration
+	backlogs      []int
+	retrievals    []bool
+	reaps         map[string]int
+}
+
+func newFakeMetrics() *fakeMetrics {
+	return &fakeMetrics{resources: make(map[string]int), namespaces: make(map[string]int), rejections: make(map[string]int), reaps: make(map[string]int)}
+}
+
+func (m *fakeMetrics) ResourcesAdd(namespace, kind string, delta int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.resources[kind] += delta
+	m.namespaces[namespace] += delta
+}
+
+func (m *fakeMetrics) PutInc() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.puts++
+}
+
+func (m *fakeMetrics) GetInc(hit bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if hit {
+		m.hits++
+	} else {
+		m.misses++
+	}
+}
+
+func (m *fakeMetrics) WatcherAddedInc() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.watchers++
+}
+
+func (m *fakeMetrics) StaleCleanupInc() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.staleCleanups++
+}
+
+func (m *fakeMetrics) CleanupFailureInc() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.failures++
+}
+
+func (m *fakeMetrics) ResourceAgeAtGet(age time.Duration) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.ages = append(m.ages, age)
+}
+
+func (m *fakeMetrics) WatchersAtPut(int) {}
+
+func (m *fakeMetrics) RejectionInc(kind string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.rejections[kind]++
+}
+
+func (m *fakeMetrics) WatcherWaitDuration(wait time.Duration) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.waits = append(m.waits, wait)
+}
+
+func (m *fakeMetrics) CleanupBacklog(deferred int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.backlogs = append(m.backlogs, deferred)
+}
+
+func (m *fakeMetrics) RetrievalWait(_ time.Duration, wasStale bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.retrievals = append(m.retrievals, wasStale)
+}
+
+func (m *fakeMetrics) MaxLifetimeReapInc(kind string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.reaps[kind]++
+}
+
+func (m *fakeMetrics) reaped(kind string) int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.reaps[kind]
+}
+
+func (m *fakeMetrics) retrievedStale() []bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return append([]bool(nil), m.retrievals...)
+}
+
+func (m *fakeMetrics) cleanupBacklogs() []int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return append([]int(nil), m.backlogs...)
+}
+
+func (m *fakeMetrics) rejected(kind string) int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.rejections[kind]
+}
+
+func (m *fakeMetrics) stored(kind string) int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.resources[kind]
+}
+
+func (m *fakeMetrics) storedInNamespace(namespace string) int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.namespaces[namespace]
+}
+
+func (m *fakeMetrics) staleCleanupCount() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.staleCleanups
+}
+
 // The actual test suite.
 var _ = t.Describe("ResourceStore", func() {
 	// Setup the test
@@ -51,58 +224,481 @@ var _ = t.Describe("ResourceStore", func() {
 			// Given
 
 			// When
-			Expect(sut.Put(testName, e, cleaner)).To(Succeed())
+			Expect(sut.Put("", testName, e, cleaner)).To(Succeed())
 
 			// Then
-			id := sut.Get(testName)
+			id := sut.Get("", testName)
 			Expect(id).To(Equal(e.id))
 
-			id = sut.Get(testName)
+			id = sut.Get("", testName)
+			Expect(id).To(BeEmpty())
+		})
+		It("GetResult should distinguish missing and pending resources", func() {
+			// Given
+			id, state := sut.GetResult("", testName)
+			Expect(id).To(BeEmpty())
+			Expect(state).To(Equal(resourcestore.NotFound))
+
+			// When
+			sut.WatcherForResource("", testName)
+
+			// Then
+			id, state = sut.GetResult("", testName)
 			Expect(id).To(BeEmpty())
+			Expect(state).To(Equal(resourcestore.Pending))
+
+			Expect(sut.Put("", testName, e, cleaner)).To(Succeed())
+			id, state = sut.GetResult("", testName)
+			Expect(id).To(Equal(e.id))
+			Expect(state).To(Equal(resourcestore.Retrieved))
+			Expect(e.created).To(BeTrue())
+
+			_, state = sut.GetResult("", testName)
+			Expect(state).To(Equal(resourcestore.NotFound))
 		})
 		It("Put should fail to readd resource", func() {
 			// Given
 
 			// When
-			Expect(sut.Put(testName, e, cleaner)).To(Succeed())
+			Expect(sut.Put("", testName, e, cleaner)).To(Succeed())
+
+			// Then
+			Expect(sut.Put("", testName, e, cleaner)).NotTo(Succeed())
+		})
+		It("Peek should not remove the resource", func() {
+			// Given
+			Expect(sut.Peek("", testName)).To(BeEmpty())
+			sut.WatcherForResource("", testName)
+			Expect(sut.Peek("", testName)).To(BeEmpty())
+
+			// When
+			Expect(sut.Put("", testName, e, cleaner)).To(Succeed())
+
+			// Then
+			Expect(sut.Peek("", testName)).To(Equal(e.id))
+			Expect(sut.Peek("", testName)).To(Equal(e.id))
+			Expect(e.created).To(BeFalse())
+			Expect(sut.Get("", testName)).To(Equal(e.id))
+		})
+		It("PeekState should not change the store", func() {
+			// Given
+			exists, created, _ := sut.PeekState("", testName)
+			Expect(exists).To(BeFalse())
+			Expect(created).To(BeFalse())
+			sut.SetStageForResource(context.Background(), "", testName, "creating")
+
+			// When
+			exists, created, age := sut.PeekState("", testName)
+
+			// Then
+			Expect(exists).To(BeTrue())
+			Expect(created).To(BeFalse())
+			Expect(age).To(BeNumerically(">=", 0))
+
+			Expect(sut.Put("", testName, e, cleaner)).To(Succeed())
+			exists, created, _ = sut.PeekState("", testName)
+			Expect(exists).To(BeTrue())
+			Expect(created).To(BeTrue())
+			Expect(e.created).To(BeFalse())
+			Expect(sut.Get("", testName)).To(Equal(e.id))
+
+			exists, _, _ = sut.PeekState("", testName)
+			Expect(exists).To(BeFalse())
+		})
+		It("GetResource should return the resource", func() {
+			// Given
+			_, _, ok := sut.GetResource("", testName)
+			Expect(ok).To(BeFalse())
+			sut.WatcherForResource("", testName)
+			_, ok = sut.PeekResource("", testName)
+			Expect(ok).To(BeFalse())
+			_, retrievedCleaner, ok := sut.GetResource("", testName)
+			Expect(ok).To(BeFalse())
+			Expect(retrievedCleaner).To(BeNil())
+
+			// When
+			Expect(sut.Put("", testName, e, cleaner)).To(Succeed())
+
+			// Then
+			resource, ok := sut.PeekResource("", testName)
+			Expect(ok).To(BeTrue())
+			Expect(resource).To(BeIdenticalTo(e))
+			Expect(e.created).To(BeFalse())
+
+			resource, retrievedCleaner, ok = sut.GetResource("", testName)
+			Expect(ok).To(BeTrue())
+			Expect(resource).To(BeIdenticalTo(e))
+			Expect(retrievedCleaner).To(BeIdenticalTo(cleaner))
+			Expect(e.created).To(BeTrue())
+
+			_, retrievedCleaner, ok = sut.GetResource("", testName)
+			Expect(ok).To(BeFalse())
+			Expect(retrievedCleaner).To(BeNil())
+		})
+		It("GetResource should hand the cleaner over to the caller", func() {
+			// Given
+			cleaned := 0
+			cleaner.Add(context.Background(), "test", func() error {
+				cleaned++
+				return nil
+			})
+			Expect(sut.Put("", testName, e, cleaner)).To(Succeed())
+
+			// When
+			_, retrievedCleaner, ok := sut.GetResource("", testName)
+			Expect(ok).To(BeTrue())
+
+			// Then
+			Expect(sut.Remove("", testName)).To(Succeed())
+			Expect(sut.Shutdown(context.Background())).To(Succeed())
+			Expect(cleaned).To(BeZero())
+			Expect(retrievedCleaner.Cleanup()).To(Succeed())
+			Expect(cleaned).To(Equal(1))
+		})
+		It("GetResource should not return the cleaner of a removed resource", func() {
+			// Given
+			cleaned := 0
+			cleaner.Add(context.Background(), "test", func() error {
+				cleaned++
+				return nil
+			})
+			Expect(sut.Put("", testName, e, cleaner)).To(Succeed())
+			Expect(sut.Remove("", testName)).To(Succeed())
+
+			// When
+			resource, retrievedCleaner, ok := sut.GetResource("", testName)
+
+			// Then
+			Expect(ok).To(BeFalse())
+			Expect(resource).To(BeNil())
+			Expect(retrievedCleaner).To(BeNil())
+			Expect(e.created).To(BeFalse())
+			Expect(cleaned).To(Equal(1))
+		})
+		It("List should describe placeholders and put resources", func() {
+			// Given
+			_, _ = sut.WatcherForResource("", "placeholder")
+			_, _ = sut.WatcherForResource("", "placeholder")
+			sut.SetStageForResource(context.Background(), "", "placeholder", "creating")
+			Expect(sut.Put("", testName, e, cleaner)).To(Succeed())
+
+			// When
+			infos := sut.List()
+
+			// Then
+			Expect(infos).To(ConsistOf(
+				And(
+					HaveField("Name", "placeholder"),
+					HaveField("Put", BeFalse()),
+					HaveField("Stale", BeFalse()),
+					HaveField("Watchers", 2),
+					HaveField("Stage", "creating"),
+					HaveField("Age", BeNumerically(">=", 0)),
+				),
+				And(
+					HaveField("Name", testName),
+					HaveField("Put", BeTrue()),
+					HaveField("Stale", BeFalse()),
+					HaveField("Watchers", 0),
+					HaveField("Stage", ""),
+					HaveField("Age", BeNumerically(">=", 0)),
+				),
+			))
+		})
+		It("Stats should count placeholders, put resources and watchers", func() {
+			// Given
+			_, _ = sut.WatcherForResource("", "placeholder")
+			_, _ = sut.WatcherForResource("", "placeholder")
+			_, _ = sut.WatcherForResource("", "other")
+			Expect(sut.Put("", testName, e, cleaner)).To(Succeed())
+
+			// When
+			stats := sut.Stats()
 
 			// Then
-			Expect(sut.Put(testName, e, cleaner)).NotTo(Succeed())
+			Expect(stats).To(Equal(resourcestore.StoreStats{
+				Entries:      3,
+				Put:          1,
+				Placeholders: 2,
+				Watchers:     3,
+				Namespaces:   map[string]int{"": 3},
+			}))
 		})
 		It("Get should call SetCreated", func() {
 			// When
-			Expect(sut.Put(testName, e, cleaner)).To(Succeed())
+			Expect(sut.Put("", testName, e, cleaner)).To(Succeed())
 
 			// Then
-			id := sut.Get(testName)
+			id := sut.Get("", testName)
 			Expect(id).To(Equal(e.id))
 			Expect(e.created).To(BeTrue())
 		})
 		It("Should not fail to Get after retrieving Watcher", func() {
 			// When
-			_, stage := sut.WatcherForResource(testName)
+			_, stage := sut.WatcherForResource("", testName)
 
 			// Then
-			id := sut.Get(testName)
+			id := sut.Get("", testName)
 			Expect(id).To(BeEmpty())
 			Expect(stage).To(Equal(resourcestore.StageUnknown))
 		})
 		It("Should be able to get multiple Watchers", func() {
 			// Given
-			watcher1, _ := sut.WatcherForResource(testName)
-			watcher2, _ := sut.WatcherForResource(testName)
+			watcher1, _ := sut.WatcherForResource("", testName)
+			watcher2, _ := sut.WatcherForResource("", testName)
 
-			waitWatcherSet := func(watcher chan struct{}) bool {
-				<-watcher
-				return true
+			waitWatcherSet := func(watcher chan error) bool {
+				return <-watcher == nil
 			}
 
 			// When
-			Expect(sut.Put(testName, e, cleaner)).To(Succeed())
+			Expect(sut.Put("", testName, e, cleaner)).To(Succeed())
 			// Then
 			Expect(waitWatcherSet(watcher1)).To(BeTrue())
 			Expect(waitWatcherSet(watcher2)).To(BeTrue())
 		})
+		It("Put should not block on a watcher which has already been notified", func() {
+			// Given
+			watcher, _ := sut.WatcherForResource("", testName)
+			// Fill the buffer of the watcher, like a second notification
+			// would.
+			watcher <- errors.New("already notified")
+			done := make(chan error, 1)
+
+			// When
+			go func() {
+				done <- sut.Put("", testName, e, cleaner)
+			}()
+
+			// Then
+			Eventually(done).Should(Receive(BeNil()))
+			Expect(sut.Get("", testName)).To(Equal(testID))
+		})
+		It("should notify watchers of resources which have already been Put", func() {
+			// Given
+			first, _ := sut.WatcherForResource("", testName)
+			Expect(sut.Put("", testName, e, cleaner)).To(Succeed())
+			Expect(<-first).To(Succeed())
+
+			// When
+			second, _ := sut.WatcherForResource("", testName)
+			third, _ := sut.WatcherForResource("", testName)
+
+			// Then
+			Expect(second).To(Receive(BeNil()))
+			Expect(third).To(Receive(BeNil()))
+			// Notified watchers do not accumulate.
+			Expect(sut.WatcherCounts()).To(HaveKeyWithValue(testName, 0))
+		})
+		It("Fail should notify watchers with the error", func() {
+			// Given
+			sut.SetStageForResource(context.Background(), "", testName, "creating")
+			watcher1, _ := sut.WatcherForResource("", testName)
+			watcher2, _ := sut.WatcherForResource("", testName)
+			createErr := errors.New("creation failed")
+
+			// When
+			sut.Fail("", testName, createErr)
+
+			// Then
+			Expect(<-watcher1).To(MatchError(createErr))
+			Expect(<-watcher2).To(MatchError(createErr))
+			Expect(sut.WatcherCounts()).NotTo(HaveKey(testName))
+			Expect(sut.Get("", testName)).To(BeEmpty())
+		})
+		It("Fail should not remove a resource which was put", func() {
+			// Given
+			Expect(sut.Put("", testName, e, cleaner)).To(Succeed())
+
+			// When
+			sut.Fail("", testName, errors.New("creation failed"))
+
+			// Then
+			Expect(sut.Get("", testName)).To(Equal(e.id))
+		})
+		It("Remove should run the cleaner immediately", func() {
+			// Given
+			called := 0
+			cleaner.Add(context.Background(), "first", func() error {
+				called++
+				return errors.New("first failed")
+			})
+			cleaner.Add(context.Background(), "second", func() error {
+				called++
+				return errors.New("second failed")
+			})
+			Expect(sut.Put("", testName, e, cleaner)).To(Succeed())
+
+			// When
+			err := sut.Remove("", testName)
+
+			// Then
+			Expect(err).To(HaveOccurred())
+			// both funcs have been retried until giving up
+			Expect(strings.Count(err.Error(), "wait on retry")).To(Equal(2))
+			Expect(called).To(Equal(6))
+			Expect(sut.Get("", testName)).To(BeEmpty())
+			Expect(sut.WatcherCounts()).NotTo(HaveKey(testName))
+		})
+		It("Remove should notify the watchers of a placeholder", func() {
+			// Given
+			watcher, _ := sut.WatcherForResource("", testName)
+
+			// When
+			Expect(sut.Remove("", testName)).To(Succeed())
+
+			// Then
+			Expect(<-watcher).To(MatchError(resourcestore.ErrResourceRemoved))
+			Expect(sut.WatcherCounts()).NotTo(HaveKey(testName))
+		})
+		It("Delete should notify the watchers of a placeholder", func() {
+			// Given
+			watcher, _ := sut.WatcherForResource("", testName)
+
+			// When
+			sut.Delete("", testName)
+
+			// Then
+			Expect(<-watcher).To(MatchError(resourcestore.ErrResourceRemoved))
+			Expect(sut.WatcherCounts()).NotTo(HaveKey(testName))
+		})
+		It("Remove should ignore unknown names", func() {
+			Expect(sut.Remove("", testName)).To(Succeed())
+		})
+		It("AddCleanup should run the added steps first on cleanup", func() {
+			// Given
+			steps := []string{}
+			cleaner.Add(context.Background(), "initial", func() error {
+				steps = append(steps, "initial")
+				return nil
+			})
+			Expect(sut.Put("", testName, e, cleaner)).To(Succeed())
+
+			// When
+			Expect(sut.AddCleanup(context.Background(), "", testName, "late", func() error {
+				steps = append(steps, "late")
+				return nil
+			})).To(Succeed())
+			Expect(sut.Remove("", testName)).To(Succeed())
+
+			// Then
+			Expect(steps).To(Equal([]string{"late", "initial"}))
+		})
+		It("AddCleanup should fail for resources which are not in the store", func() {
+			// Given
+			_, _ = sut.WatcherForResource("", testName)
+			noop := func() error { return nil }
+
+			// When
+			placeholderErr := sut.AddCleanup(context.Background(), "", testName, "placeholder", noop)
+			Expect(sut.Put("", testName, e, cleaner)).To(Succeed())
+			Expect(sut.Get("", testName)).To(Equal(e.id))
+			retrievedErr := sut.AddCleanup(context.Background(), "", testName, "retrieved", noop)
+
+			// Then
+			Expect(placeholderErr).To(MatchError(resourcestore.ErrResourceNotFound))
+			Expect(retrievedErr).To(MatchError(resourcestore.ErrResourceNotFound))
+		})
+		It("Reset should clean up all entries and keep the store usable", func() {
+			// Given
+			cleaned := false
+			cleaner.Add(context.Background(), "test", func() error {
+				cleaned = true
+				return nil
+			})
+			Expect(sut.Put("", "created", e, cleaner)).To(Succeed())
+			watcher, _ := sut.WatcherForResource("", testName)
+
+			// When
+			Expect(sut.Reset()).To(Succeed())
+
+			// Then
+			Expect(cleaned).To(BeTrue())
+			Expect(<-watcher).To(MatchError(resourcestore.ErrResourceRemoved))
+			Expect(sut.List()).To(BeEmpty())
+			Expect(sut.WatcherCounts()).To(BeEmpty())
+
+			Expect(sut.Put("", "created", e, resourcestore.NewResourceCleaner())).To(Succeed())
+			Expect(sut.Get("", "created")).To(Equal(testID))
+			watcher, _ = sut.WatcherForResource("", testName)
+			Expect(sut.Put("", testName, &entry{id: testName}, resourcestore.NewResourceCleaner())).To(Succeed())
+			Expect(<-watcher).To(Succeed())
+			Expect(sut.Get("", testName)).To(Equal(testName))
+		})
+		It("should count watchers per resource", func() {
+			// Given
+			sut.WatcherForResource("", testName)
+			sut.WatcherForResource("", testName)
+			sut.WatcherForResource("", "other")
+			Expect(sut.Put("", "created", e, cleaner)).To(Succeed())
+
+			// When
+			counts := sut.WatcherCounts()
+
+			// Then
+			Expect(counts).To(Equal(map[string]int{
+				testName:  2,
+				"other":   1,
+				"created": 0,
+			}))
+		})
+	})
+	Context("concurrency", func() {
+		BeforeEach(func() {
+			sut = resourcestore.New()
+		})
+		AfterEach(func() {
+			sut.Close()
+		})
+		It("should Put and Get distinct names in parallel", func() {
+			// Given
+			const count = 100
+			var wg sync.WaitGroup
+
+			// When
+			for i := 0; i < count; i++ {
+				wg.Add(1)
+				go func(name string) {
+					defer GinkgoRecover()
+					defer wg.Done()
+					Expect(sut.Put("", name, &entry{id: name}, resourcestore.NewResourceCleaner())).To(Succeed())
+				}(fmt.Sprintf("name-%d", i))
+			}
+			wg.Wait()
+
+			// Then
+			for i := 0; i < count; i++ {
+				name := fmt.Sprintf("name-%d", i)
+				Expect(sut.Get("", name)).To(Equal(name))
+			}
+		})
+		It("should Reset while resources are Put, retrieved and cleaned up", func() {
+			// Given
+			sut = resourcestore.NewWithTimeout(10 * time.Millisecond)
+			const count = 100
+			var wg sync.WaitGroup
+
+			// When
+			for i := 0; i < count; i++ {
+				wg.Add(1)
+				go func(name string) {
+					defer GinkgoRecover()
+					defer wg.Done()
+					Expect(sut.Put("", name, &entry{id: name}, resourcestore.NewResourceCleaner())).To(Succeed())
+					sut.Get("", name)
+				}(fmt.Sprintf("name-%d", i))
+				if i%10 == 0 {
+					Expect(sut.Reset()).To(Succeed())
+				}
+			}
+			wg.Wait()
+			Expect(sut.Reset()).To(Succeed())
+
+			// Then
+			Expect(sut.List()).To(BeEmpty())
+			Expect(sut.Put("", testName, &entry{id: testID}, resourcestore.NewResourceCleaner())).To(Succeed())
+			Expect(sut.Get("", testName)).To(Equal(testID))
+		})
 	})
 	Context("with timeout", func() {
 		BeforeEach(func() {
@@ -130,28 +726,46 @@ var _ = t.Describe("ResourceStore", func() {
 			}()
 
 			// When
-			Expect(sut.Put(testName, e, cleaner)).To(Succeed())
+			Expect(sut.Put("", testName, e, cleaner)).To(Succeed())
 
 			// Then
 			didStoreCallTimeoutFunc := <-timedOutChan
 			Expect(didStoreCallTimeoutFunc).To(BeTrue())
 
-			id := sut.Get(testName)
+			id := sut.Get("", testName)
 			Expect(id).To(BeEmpty())
 		})
+		It("SetTimeout should apply the new timeout immediately", func() {
+			// Given
+			sut = resourcestore.NewWithTimeout(time.Hour)
+			cleaned := make(chan struct{})
+			cleaner.Add(context.Background(), "test", func() error {
+				close(cleaned)
+				return nil
+			})
+			Expect(sut.Put("", testName, e, cleaner)).To(Succeed())
+
+			// When
+			sut.SetTimeout(100 * time.Millisecond)
+
+			// Then
+			Expect(sut.Timeout()).To(Equal(100 * time.Millisecond))
+			Eventually(cleaned, 5*time.Second).Should(BeClosed())
+			Expect(sut.Get("", testName)).To(BeEmpty())
+		})
 		It("should not call cleanup until after resource is put", func() {
 			// Given
 			timeout := 2 * time.Second
 			sut = resourcestore.NewWithTimeout(timeout)
 
-			_, _ = sut.WatcherForResource(testName)
+			_, _ = sut.WatcherForResource("", testName)
 
 			timedOutChan := make(chan bool)
 
 			// When
 			go func() {
 				time.Sleep(timeout * 6)
-				Expect(sut.Put(testName, e, cleaner)).To(Succeed())
+				Expect(sut.Put("", testName, e, cleaner)).To(Succeed())
 				timedOutChan <- true
 			}()
 
@@ -159,51 +773,1444 @@ var _ = t.Describe("ResourceStore", func() {
 			didStoreWaitForPut := <-timedOutChan
 			Expect(didStoreWaitForPut).To(BeTrue())
 		})
-	})
-	Context("Stages", func() {
-		ctx := context.Background()
-		BeforeEach(func() {
-			sut = resourcestore.New()
-			cleaner = resourcestore.NewResourceCleaner()
-			e = &entry{
-				id: testID,
+		It("PutWithTimeout should clean up each resource after its own timeout", func() {
+			// Given
+			timeout := 2 * time.Second
+			sut = resourcestore.NewWithTimeout(timeout)
+
+			cleanedUp := make(chan string, 3)
+			newCleaner := func(name string) *resourcestore.ResourceCleaner {
+				c := resourcestore.NewResourceCleaner()
+				c.Add(context.Background(), name, func() error {
+					cleanedUp <- name
+					return nil
+				})
+				return c
 			}
+
+			// When
+			start := time.Now()
+			Expect(sut.PutWithTimeout("", "short", &entry{id: "short"}, newCleaner("short"), 100*time.Millisecond)).To(Succeed())
+			Expect(sut.PutWithTimeout("", "long", &entry{id: "long"}, newCleaner("long"), time.Hour)).To(Succeed())
+			Expect(sut.Put("", "default", &entry{id: "default"}, newCleaner("default"))).To(Succeed())
+
+			// Then
+			Eventually(cleanedUp, timeout).Should(Receive(Equal("short")))
+			Expect(time.Since(start)).To(BeNumerically("<", timeout))
+			Expect(sut.Peek("", "default")).To(Equal("default"))
+
+			Eventually(cleanedUp, 3*timeout).Should(Receive(Equal("default")))
+			Expect(time.Since(start)).To(BeNumerically(">=", timeout))
+			Expect(sut.Peek("", "long")).To(Equal("long"))
+			Consistently(cleanedUp, timeout).ShouldNot(Receive())
 		})
-		AfterEach(func() {
-			sut.Close()
-		})
-		It("should have stage unknown if watcher requested", func() {
+		It("List should report stale resources", func() {
 			// Given
-			_, stage := sut.WatcherForResource(testName)
+			timeout := 100 * time.Millisecond
+			sut = resourcestore.NewWithTimeout(timeout)
+
+			// When
+			Expect(sut.Put("", testName, e, cleaner)).To(Succeed())
 
 			// Then
-			Expect(stage).To(Equal(resourcestore.StageUnknown))
+			Eventually(sut.List, 2*timeout).Should(ConsistOf(And(
+				HaveField("Name", testName),
+				HaveField("Stale", BeTrue()),
+				HaveField("Age", BeNumerically(">=", timeout)),
+			)))
 		})
-		It("should add resource if not present", func() {
+		It("Stats should count stale resources", func() {
 			// Given
-			testStage := "test stage"
-			sut.SetStageForResource(ctx, testName, testStage)
+			timeout := 100 * time.Millisecond
+			sut = resourcestore.NewWithTimeout(timeout)
 
-			// when
-			_, stage := sut.WatcherForResource(testName)
+			// When
+			Expect(sut.Put("", testName, e, cleaner)).To(Succeed())
 
 			// Then
-			Expect(stage).To(Equal(testStage))
+			Eventually(sut.Stats, 2*timeout).Should(HaveField("Stale", 1))
 		})
-		It("should update stage", func() {
+		It("Touch should protect a resource from the cleanup", func() {
 			// Given
-			stage1 := "test stage"
+			timeout := 200 * time.Millisecond
+			sut = resourcestore.NewWithTimeout(timeout)
+
+			cleanedUp := make(chan string, 3)
+			newCleaner := func(name string) *resourcestore.ResourceCleaner {
+				c := resourcestore.NewResourceCleaner()
+				c.Add(context.Background(), name, func() error {
+					cleanedUp <- name
+					return nil
+				})
+				return c
+			}
+			Expect(sut.Touch("", "touched")).To(BeFalse())
+			Expect(sut.Put("", "touched", &entry{id: "touched"}, newCleaner("touched"))).To(Succeed())
+			Expect(sut.PutWithTimeout("", "touched-deadline", &entry{id: "touched-deadline"}, newCleaner("touched-deadline"), timeout)).To(Succeed())
+			Expect(sut.Put("", "untouched", &entry{id: "untouched"}, newCleaner("untouched"))).To(Succeed())
+
+			// When
+			for end := time.Now().Add(3 * timeout); time.Now().Before(end); {
+				Expect(sut.Touch("", "touched")).To(BeTrue())
+				Expect(sut.Touch("", "touched-deadline")).To(BeTrue())
+				time.Sleep(timeout / 4)
+			}
+
+			// Then
+			Expect(cleanedUp).To(Receive(Equal("untouched")))
+			Expect(cleanedUp).NotTo(Receive())
+			Expect(sut.Peek("", "touched")).To(Equal("touched"))
+			Expect(sut.Peek("", "touched-deadline")).To(Equal("touched-deadline"))
+		})
+		It("should retry failed cleanups", func() {
+			// Given
+			timeout := time.Second
+			sut = resourcestore.NewWithTimeout(timeout)
+
+			var mutex sync.Mutex
+			calls := 0
+			cleaner.Add(context.Background(), "test", func() error {
+				mutex.Lock()
+				defer mutex.Unlock()
+				calls++
+				// fail the whole first cleanup, including its retries
+				if calls <= 3 {
+					return errors.New("device busy")
+				}
+				return nil
+			})
+
+			// When
+			Expect(sut.Put("", testName, e, cleaner)).To(Succeed())
+
+			// Then
+			Eventually(sut.CleanupFailures, 10*time.Second).Should(ConsistOf(
+				And(
+					HaveField("Name", testName),
+					HaveField("Attempts", 1),
+					HaveField("NextAttempt", Not(BeNil())),
+				),
+			))
+			Eventually(sut.CleanupFailures, 10*time.Second).Should(BeEmpty())
+			mutex.Lock()
+			Expect(calls).To(Equal(4))
+			mutex.Unlock()
+			Expect(sut.Get("", testName)).To(BeEmpty())
+		})
+		It("should give up on cleanups failing too often", func() {
+			// Given
+			timeout := 100 * time.Millisecond
+			sut = resourcestore.NewWithTimeout(timeout)
+			cleaner.Add(context.Background(), "test", func() error {
+				return errors.New("device busy")
+			})
+
+			// When
+			Expect(sut.Put("", testName, e, cleaner)).To(Succeed())
+
+			// Then
+			Eventually(sut.CleanupFailures, 30*time.Second).Should(ConsistOf(
+				And(
+					HaveField("Name", testName),
+					HaveField("Attempts", 5),
+					HaveField("NextAttempt", BeNil()),
+					HaveField("Error", ContainSubstring("wait on retry")),
+				),
+			))
+		})
+		It("named stores should clean up after their own timeouts", func() {
+			// Given
+			timeout := 200 * time.Millisecond
+			short := resourcestore.NewNamed("short", resourcestore.Options{Timeout: timeout})
+			defer short.Close()
+			sut = resourcestore.NewNamed("long", resourcestore.Options{Timeout: time.Hour})
+
+			cleanedUp := make(chan string, 2)
+			for _, store := range []*resourcestore.ResourceStore{short, sut} {
+				c := resourcestore.NewResourceCleaner()
+				c.Add(context.Background(), store.Name(), func() error {
+					cleanedUp <- store.Name()
+					return nil
+				})
+				Expect(store.Put("", testName, &entry{id: testID}, c)).To(Succeed())
+			}
+
+			// When
+			Expect(sut.List()).To(ConsistOf(HaveField("Store", "long")))
+			Expect(short.List()).To(ConsistOf(HaveField("Store", "short")))
+
+			// Then
+			Eventually(cleanedUp, 5*timeout).Should(Receive(Equal("short")))
+			Consistently(cleanedUp, 2*timeout).ShouldNot(Receive())
+			Expect(sut.Peek("", testName)).To(Equal(testID))
+		})
+		It("should clean up the oldest resources first and defer the rest", func() {
+			// Given
+			timeout := 200 * time.Millisecond
+			m := newFakeMetrics()
+			sut = resourcestore.NewWithOptions(resourcestore.Options{
+				Timeout:             timeout,
+				MaxCleanupsPerCycle: 2,
+				CleanupWorkers:      1,
+				Metrics:             m,
+			})
+
+			cleanedUp := make(chan string, 5)
+			for i := range 5 {
+				name := fmt.Sprintf("resource-%d", i)
+				c := resourcestore.NewResourceCleaner()
+				c.Add(context.Background(), name, func() error {
+					cleanedUp <- name
+					return nil
+				})
+				Expect(sut.Put("", name, &entry{id: name}, c)).To(Succeed())
+				time.Sleep(time.Millisecond)
+			}
+
+			// When
+			var order []string
+			for range 5 {
+				var name string
+				Eventually(cleanedUp, 5*timeout).Should(Receive(&name))
+				order = append(order, name)
+			}
+
+			// Then
+			Expect(order).To(Equal([]string{"resource-0", "resource-1", "resource-2", "resource-3", "resource-4"}))
+			Expect(m.staleCleanupCount()).To(Equal(5))
+			Expect(m.cleanupBacklogs()).To(Equal([]int{3, 1, 0}))
+			Expect(sut.List()).To(BeEmpty())
+		})
+		It("should reap resources by put time, then by name", func() {
+			// Given
+			timeout := 200 * time.Millisecond
+			sut = resourcestore.NewWithOptions(resourcestore.Options{
+				Timeout:        timeout,
+				CleanupWorkers: 1,
+			})
+
+			cleanedUp := make(chan string, 4)
+			putAt := time.Now()
+			for _, name := range []string{"c", "a", "oldest", "b"} {
+				c := resourcestore.NewResourceCleaner()
+				c.Add(context.Background(), name, func() error {
+					cleanedUp <- name
+					return nil
+				})
+				Expect(sut.Put("", name, &entry{id: name}, c)).To(Succeed())
+				sut.SetPutTimeForResource("", name, putAt)
+			}
+			sut.SetPutTimeForResource("", "oldest", putAt.Add(-time.Second))
+
+			// When
+			var order []string
+			for range 4 {
+				var name string
+				Eventually(cleanedUp, 5*timeout).Should(Receive(&name))
+				order = append(order, name)
+			}
+
+			// Then
+			Expect(order).To(Equal([]string{"oldest", "a", "b", "c"}))
+		})
+		It("should run the cleanups of a cycle in parallel", func() {
+			// Given
+			timeout := 200 * time.Millisecond
+			sut = resourcestore.NewWithOptions(resourcestore.Options{
+				Timeout:        timeout,
+				CleanupWorkers: 3,
+			})
+
+			started := make(chan string, 3)
+			release := make(chan struct{})
+			for i := range 3 {
+				name := fmt.Sprintf("resource-%d", i)
+				c := resourcestore.NewResourceCleaner()
+				c.Add(context.Background(), name, func() error {
+					started <- name
+					<-release
+					return nil
+				})
+				Expect(sut.Put("", name, &entry{id: name}, c)).To(Succeed())
+			}
+
+			// When
+			for range 3 {
+				Eventually(started, 5*timeout).Should(Receive())
+			}
+
+			// Then
+			close(release)
+			Eventually(sut.List, timeout).Should(BeEmpty())
+		})
+	})
+	Context("watchers with context", func() {
+		AfterEach(func() {
+			sut.Close()
+		})
+		It("should unregister the watcher on cancellation", func() {
+			// Given
+			sut = resourcestore.New()
+			ctx, cancel := context.WithCancel(context.Background())
+			_, _ = sut.WatcherForResourceWithContext(ctx, "", testName)
+			_, _ = sut.WatcherForResource("", testName)
+			Expect(sut.WatcherCounts()).To(HaveKeyWithValue(testName, 2))
+
+			// When
+			cancel()
+
+			// Then
+			Eventually(sut.WatcherCounts).Should(HaveKeyWithValue(testName, 1))
+		})
+		It("should reap placeholders of canceled watchers", func() {
+			// Given
+			timeout := 100 * time.Millisecond
+			sut = resourcestore.NewWithTimeout(timeout)
+			const count = 1000
+
+			// When
+			for i := 0; i < count; i++ {
+				ctx, cancel := context.WithCancel(context.Background())
+				_, _ = sut.WatcherForResourceWithContext(ctx, "", fmt.Sprintf("name-%d", i))
+				cancel()
+			}
+
+			// Then
+			Eventually(sut.WatcherCounts, 10*timeout).Should(BeEmpty())
+		})
+		It("should not reap placeholders with a stage", func() {
+			// Given
+			timeout := 100 * time.Millisecond
+			sut = resourcestore.NewWithTimeout(timeout)
+			ctx, cancel := context.WithCancel(context.Background())
+			_, _ = sut.WatcherForResourceWithContext(ctx, "", testName)
+			sut.SetStageForResource(context.Background(), "", testName, "creating")
+
+			// When
+			cancel()
+
+			// Then
+			Consistently(sut.WatcherCounts, 10*timeout).Should(HaveKey(testName))
+		})
+	})
+	Context("pending watchers", func() {
+		BeforeEach(func() {
+			sut = resourcestore.NewWithOptions(resourcestore.Options{NotifyDelay: time.Hour})
+			cleaner = resourcestore.NewResourceCleaner()
+			e = &entry{
+				id: testID,
+			}
+		})
+		AfterEach(func() {
+			sut.Close()
+		})
+		It("should return a nil watcher for a resource which has been Put", func() {
+			// Given
+			Expect(sut.Put("", testName, e, cleaner)).To(Succeed())
+
+			// When
+			watcher, _, err := sut.WatcherForPendingResource(context.Background(), "", testName)
+
+			// Then
+			Expect(err).NotTo(HaveOccurred())
+			Expect(watcher).To(BeNil())
+			Expect(sut.WatcherCounts()).To(HaveKeyWithValue(testName, 0))
+			Expect(sut.Get("", testName)).To(Equal(e.id))
+		})
+		It("should register a watcher for a resource which has not been Put", func() {
+			// Given
+			sut.SetStageForResource(context.Background(), "", testName, "creating")
+
+			// When
+			watcher, stage, err := sut.WatcherForPendingResource(context.Background(), "", testName)
+
+			// Then
+			Expect(err).NotTo(HaveOccurred())
+			Expect(watcher).NotTo(BeNil())
+			Expect(stage).To(Equal("creating"))
+			Expect(sut.WatcherCounts()).To(HaveKeyWithValue(testName, 1))
+		})
+		It("should register a watcher for an unknown resource", func() {
+			// When
+			watcher, stage, err := sut.WatcherForPendingResource(context.Background(), "", testName)
+
+			// Then
+			Expect(err).NotTo(HaveOccurred())
+			Expect(watcher).NotTo(BeNil())
+			Expect(stage).To(Equal(resourcestore.StageUnknown))
+		})
+		It("should unregister the watcher on cancellation", func() {
+			// Given
+			ctx, cancel := context.WithCancel(context.Background())
+			_, _, err := sut.WatcherForPendingResource(ctx, "", testName)
+			Expect(err).NotTo(HaveOccurred())
+
+			// When
+			cancel()
+
+			// Then
+			Eventually(sut.WatcherCounts).Should(HaveKeyWithValue(testName, 0))
+		})
+		It("should fail if no placeholder can be created", func() {
+			// Given
+			sut.Close()
+			sut = resourcestore.NewWithOptions(resourcestore.Options{MaxPlaceholders: 1})
+			_, _ = sut.WatcherForResource("", "first")
+
+			// When
+			watcher, _, err := sut.WatcherForPendingResource(context.Background(), "", testName)
+
+			// Then
+			Expect(err).To(MatchError(resourcestore.ErrStoreFull))
+			Expect(watcher).To(BeNil())
+		})
+	})
+	Context("notify delay", func() {
+		const delay = 200 * time.Millisecond
+		BeforeEach(func() {
+			sut = resourcestore.NewWithOptions(resourcestore.Options{NotifyDelay: delay})
+			cleaner = resourcestore.NewResourceCleaner()
+			e = &entry{
+				id: testID,
+			}
+		})
+		AfterEach(func() {
+			sut.Close()
+		})
+		It("should notify watchers after the delay", func() {
+			// Given
+			watcher, _ := sut.WatcherForResource("", testName)
+
+			// When
+			Expect(sut.Put("", testName, e, cleaner)).To(Succeed())
+
+			// Then
+			Consistently(watcher, delay/2).ShouldNot(Receive())
+			Eventually(watcher, 2*delay).Should(Receive(BeNil()))
+			Expect(sut.Get("", testName)).To(Equal(e.id))
+		})
+		It("should not hold the lock during the delay", func() {
+			// Given
+			_, _ = sut.WatcherForResource("", testName)
+
+			// When
+			Expect(sut.Put("", testName, e, cleaner)).To(Succeed())
+
+			// Then
+			done := make(chan string, 1)
+			go func() {
+				done <- sut.Peek("", testName)
+			}()
+			Eventually(done, delay/2).Should(Receive(Equal(e.id)))
+		})
+		It("should not notify watchers unregistered during the delay", func() {
+			// Given
+			ctx, cancel := context.WithCancel(context.Background())
+			canceled, _ := sut.WatcherForResourceWithContext(ctx, "", testName)
+			watcher, _ := sut.WatcherForResource("", testName)
+
+			// When
+			Expect(sut.Put("", testName, e, cleaner)).To(Succeed())
+			cancel()
+
+			// Then
+			Eventually(watcher, 2*delay).Should(Receive(BeNil()))
+			Expect(canceled).NotTo(Receive())
+		})
+		It("should not report a resource retrieved during the delay as ready", func() {
+			// Given
+			watcher, _ := sut.WatcherForResource("", testName)
+			Expect(sut.Put("", testName, e, cleaner)).To(Succeed())
+
+			// When
+			Expect(sut.Get("", testName)).To(Equal(e.id))
+
+			// Then
+			Eventually(watcher, 2*delay).Should(Receive(MatchError(resourcestore.ErrResourceNotFound)))
+		})
+		It("should notify watchers immediately on Close", func() {
+			// Given
+			sut.Close()
+			sut = resourcestore.NewWithOptions(resourcestore.Options{NotifyDelay: time.Hour})
+			watcher, _ := sut.WatcherForResource("", testName)
+			Expect(sut.Put("", testName, e, cleaner)).To(Succeed())
+
+			// When
+			sut.Close()
+
+			// Then
+			Eventually(watcher).Should(Receive(BeNil()))
+		})
+	})
+	Context("Labels", func() {
+		BeforeEach(func() {
+			sut = resourcestore.New()
+		})
+		AfterEach(func() {
+			sut.Close()
+		})
+		It("should list resources by label", func() {
+			// Given
+			Expect(sut.PutWithLabels("", "ctr1", &entry{id: "1"}, resourcestore.NewResourceCleaner(),
+				map[string]string{"sandbox": "sb1"})).To(Succeed())
+			Expect(sut.PutWithLabels("", "ctr2", &entry{id: "2"}, resourcestore.NewResourceCleaner(),
+				map[string]string{"sandbox": "sb2"})).To(Succeed())
+			Expect(sut.Put("", "ctr3", &entry{id: "3"}, resourcestore.NewResourceCleaner())).To(Succeed())
+			sut.SetLabelsForResource("", "ctr4", map[string]string{"sandbox": "sb1"})
+
+			// When
+			names := sut.ListByLabel("", "sandbox", "sb1")
+
+			// Then
+			Expect(names).To(ConsistOf("ctr1", "ctr4"))
+		})
+		It("should keep labels set before Put", func() {
+			// Given
+			sut.SetLabelsForResource("", testName, map[string]string{"sandbox": "sb1"})
+
+			// When
+			Expect(sut.Put("", testName, &entry{id: testID}, resourcestore.NewResourceCleaner())).To(Succeed())
+
+			// Then
+			Expect(sut.ListByLabel("", "sandbox", "sb1")).To(ConsistOf(testName))
+		})
+		It("should remove resources by label and run their cleaners", func() {
+			// Given
+			cleaned := []string{}
+			for _, name := range []string{"ctr1", "ctr2"} {
+				c := resourcestore.NewResourceCleaner()
+				c.Add(context.Background(), "test", func() error {
+					cleaned = append(cleaned, name)
+					return nil
+				})
+				Expect(sut.PutWithLabels("", name, &entry{id: name}, c,
+					map[string]string{"sandbox": "sb1"})).To(Succeed())
+			}
+			Expect(sut.Put("", "ctr3", &entry{id: "ctr3"}, resourcestore.NewResourceCleaner())).To(Succeed())
+			sut.SetLabelsForResource("", "ctr4", map[string]string{"sandbox": "sb1"})
+
+			// When
+			Expect(sut.RemoveByLabel("", "sandbox", "sb1")).To(Succeed())
+
+			// Then
+			Expect(cleaned).To(ConsistOf("ctr1", "ctr2"))
+			Expect(sut.ListByLabel("", "sandbox", "sb1")).To(BeEmpty())
+			Expect(sut.Get("", "ctr1")).To(BeEmpty())
+			Expect(sut.Get("", "ctr3")).To(Equal("ctr3"))
+		})
+		It("should notify watchers of resources removed by label", func() {
+			// Given
+			sut.SetLabelsForResource("", testName, map[string]string{"sandbox": "sb1"})
+			sut.SetStageForResource(context.Background(), "", testName, "creating")
+			watcher, _ := sut.WatcherForResource("", testName)
+			Expect(sut.PutWithLabels("", "ctr1", &entry{id: "ctr1"}, resourcestore.NewResourceCleaner(),
+				map[string]string{"sandbox": "sb1"})).To(Succeed())
+			putWatcher, _ := sut.WatcherForResource("", "ctr1")
+
+			// When
+			Expect(sut.RemoveByLabel("", "sandbox", "sb1")).To(Succeed())
+
+			// Then
+			Expect(<-watcher).To(MatchError(resourcestore.ErrResourceRemoved))
+			// The watcher of the Put resource is only notified about its
+			// creation.
+			Expect(putWatcher).To(Receive(BeNil()))
+			Consistently(putWatcher).ShouldNot(Receive())
+			Expect(sut.WatcherCounts()).To(BeEmpty())
+		})
+	})
+	Context("Stages", func() {
+		ctx := context.Background()
+		BeforeEach(func() {
+			sut = resourcestore.New()
+			cleaner = resourcestore.NewResourceCleaner()
+			e = &entry{
+				id: testID,
+			}
+		})
+		AfterEach(func() {
+			sut.Close()
+		})
+		It("should have stage unknown if watcher requested", func() {
+			// Given
+			_, stage := sut.WatcherForResource("", testName)
+
+			// Then
+			Expect(stage).To(Equal(resourcestore.StageUnknown))
+		})
+		It("should add resource if not present", func() {
+			// Given
+			testStage := "test stage"
+			sut.SetStageForResource(ctx, "", testName, testStage)
+
+			// when
+			_, stage := sut.WatcherForResource("", testName)
+
+			// Then
+			Expect(stage).To(Equal(testStage))
+		})
+		It("should update stage", func() {
+			// Given
+			stage1 := "test stage"
 			stage2 := "test stage2"
-			sut.SetStageForResource(ctx, testName, stage1)
-			_, stage := sut.WatcherForResource(testName)
+			sut.SetStageForResource(ctx, "", testName, stage1)
+			_, stage := sut.WatcherForResource("", testName)
 			Expect(stage).To(Equal(stage1))
 
 			// when
-			sut.SetStageForResource(ctx, testName, stage2)
-			_, stage = sut.WatcherForResource(testName)
+			sut.SetStageForResource(ctx, "", testName, stage2)
+			_, stage = sut.WatcherForResource("", testName)
 
 			// Then
 			Expect(stage).To(Equal(stage2))
 		})
 	})
+	Context("capacity", func() {
+		var m *fakeMetrics
+		BeforeEach(func() {
+			m = newFakeMetrics()
+			sut = resourcestore.NewWithOptions(resourcestore.Options{
+				Metrics:         m,
+				MaxResources:    2,
+				MaxPlaceholders: 2,
+			})
+		})
+		AfterEach(func() {
+			sut.Close()
+		})
+		It("Put should fail for new names when full", func() {
+			// Given
+			Expect(sut.Put("", "first", &entry{id: "first"}, resourcestore.NewResourceCleaner())).To(Succeed())
+			Expect(sut.Put("", "second", &entry{id: "second"}, resourcestore.NewResourceCleaner())).To(Succeed())
+
+			// When
+			err := sut.Put("", "third", &entry{id: "third"}, resourcestore.NewResourceCleaner())
+
+			// Then
+			Expect(err).To(MatchError(resourcestore.ErrStoreFull))
+			Expect(sut.Peek("", "third")).To(BeEmpty())
+			Expect(m.rejected(resourcestore.ResourceKindPut)).To(Equal(1))
+
+			Expect(sut.Get("", "first")).To(Equal("first"))
+			Expect(sut.Put("", "third", &entry{id: "third"}, resourcestore.NewResourceCleaner())).To(Succeed())
+		})
+		It("WatcherForResource should not create placeholders when full", func() {
+			// Given
+			first, _ := sut.WatcherForResource("", "first")
+			Expect(first).NotTo(BeNil())
+			second, _ := sut.WatcherForResource("", "second")
+			Expect(second).NotTo(BeNil())
+
+			// When
+			third, stage := sut.WatcherForResourceWithContext(context.Background(), "", "third")
+
+			// Then
+			Expect(third).To(BeNil())
+			Expect(stage).To(Equal(resourcestore.StageUnknown))
+			Expect(sut.WatcherCounts()).NotTo(HaveKey("third"))
+			Expect(m.rejected(resourcestore.ResourceKindPlaceholder)).To(Equal(1))
+
+			// Existing names can still be watched.
+			another, _ := sut.WatcherForResource("", "first")
+			Expect(another).NotTo(BeNil())
+			Expect(sut.WatcherCounts()).To(HaveKeyWithValue("first", 2))
+		})
+		It("should not create placeholders for stages, labels and claims when full", func() {
+			// Given
+			_, _ = sut.WatcherForResource("", "first")
+			sut.SetStageForResource(context.Background(), "", "second", "creating")
+
+			// When
+			sut.SetStageForResource(context.Background(), "", "third", "creating")
+			sut.SetLabelsForResource("", "fourth", map[string]string{"key": "value"})
+			sut.Claim("", "fifth")
+
+			// Then
+			Expect(sut.WatcherCounts()).To(HaveLen(2))
+			Expect(sut.ListByLabel("", "key", "value")).To(BeEmpty())
+			Expect(m.stored(resourcestore.ResourceKindPlaceholder)).To(Equal(2))
+			Expect(m.rejected(resourcestore.ResourceKindPlaceholder)).To(Equal(3))
+
+			// Existing placeholders can still be updated.
+			sut.SetLabelsForResource("", "second", map[string]string{"key": "value"})
+			Expect(sut.ListByLabel("", "key", "value")).To(ConsistOf("second"))
+		})
+		It("should not starve creations by watchers", func() {
+			// Given
+			_, _ = sut.WatcherForResource("", "first")
+			_, _ = sut.WatcherForResource("", "second")
+
+			// When
+			Expect(sut.Put("", "creation", &entry{id: "creation"}, resourcestore.NewResourceCleaner())).To(Succeed())
+
+			// Then
+			// Watched creations are always accepted.
+			Expect(sut.Put("", "first", &entry{id: "first"}, resourcestore.NewResourceCleaner())).To(Succeed())
+			Expect(sut.Put("", "second", &entry{id: "second"}, resourcestore.NewResourceCleaner())).To(Succeed())
+			Expect(m.stored(resourcestore.ResourceKindPut)).To(Equal(3))
+			Expect(m.stored(resourcestore.ResourceKindPlaceholder)).To(BeZero())
+		})
+	})
+	Context("shutdown", func() {
+		BeforeEach(func() {
+			sut = resourcestore.New()
+		})
+		It("should run the cleaners and wake the watchers", func() {
+			// Given
+			cleaned := []string{}
+			for _, name := range []string{"first", "second"} {
+				cleaner := resourcestore.NewResourceCleaner()
+				cleaner.Add(context.Background(), name, func() error {
+					cleaned = append(cleaned, name)
+					return nil
+				})
+				Expect(sut.Put("", name, &entry{id: name}, cleaner)).To(Succeed())
+			}
+			watcher, _ := sut.WatcherForResource("", testName)
+
+			// When
+			Expect(sut.Shutdown(context.Background())).To(Succeed())
+
+			// Then
+			Expect(cleaned).To(ConsistOf("first", "second"))
+			Expect(<-watcher).To(MatchError(resourcestore.ErrStoreClosed))
+			Expect(sut.List()).To(BeEmpty())
+		})
+		It("should run the cleaners by put time, then by name", func() {
+			// Given
+			cleaned := []string{}
+			putAt := time.Now()
+			for _, name := range []string{"second", "third", "first"} {
+				cleaner := resourcestore.NewResourceCleaner()
+				cleaner.Add(context.Background(), name, func() error {
+					cleaned = append(cleaned, name)
+					return nil
+				})
+				Expect(sut.Put("", name, &entry{id: name}, cleaner)).To(Succeed())
+				sut.SetPutTimeForResource("", name, putAt)
+			}
+			sut.SetPutTimeForResource("", "third", putAt.Add(time.Second))
+
+			// When
+			Expect(sut.Shutdown(context.Background())).To(Succeed())
+
+			// Then
+			Expect(cleaned).To(Equal([]string{"first", "second", "third"}))
+		})
+		It("should abandon cleaners exceeding their share of the deadline", func() {
+			// Given
+			block := make(chan struct{})
+			defer close(block)
+			blocking := resourcestore.NewResourceCleaner()
+			blocking.Add(context.Background(), "blocking", func() error {
+				<-block
+				return nil
+			})
+			Expect(sut.Put("", "blocking", &entry{id: "blocking"}, blocking)).To(Succeed())
+			cleaned := false
+			other := resourcestore.NewResourceCleaner()
+			other.Add(context.Background(), "other", func() error {
+				cleaned = true
+				return nil
+			})
+			Expect(sut.Put("", "other", &entry{id: "other"}, other)).To(Succeed())
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			// When
+			start := time.Now()
+			err := sut.Shutdown(ctx)
+
+			// Then
+			Expect(err).To(MatchError(context.DeadlineExceeded))
+			Expect(err.Error()).To(ContainSubstring("blocking"))
+			Expect(err.Error()).NotTo(ContainSubstring("other"))
+			Expect(cleaned).To(BeTrue())
+			Expect(time.Since(start)).To(BeNumerically("<", 2*time.Second))
+		})
+		It("should skip the cleaners once ctx is done", func() {
+			// Given
+			called := false
+			cleaner := resourcestore.NewResourceCleaner()
+			cleaner.Add(context.Background(), "test", func() error {
+				called = true
+				return nil
+			})
+			Expect(sut.Put("", testName, &entry{id: testID}, cleaner)).To(Succeed())
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			// When
+			err := sut.Shutdown(ctx)
+
+			// Then
+			Expect(err).To(MatchError(context.Canceled))
+			Expect(called).To(BeFalse())
+		})
+		It("should be safe to call twice and after Close", func() {
+			// Given
+			called := 0
+			cleaner := resourcestore.NewResourceCleaner()
+			cleaner.Add(context.Background(), "test", func() error {
+				called++
+				return nil
+			})
+			Expect(sut.Put("", testName, &entry{id: testID}, cleaner)).To(Succeed())
+			sut.Close()
+
+			// When
+			Expect(sut.Shutdown(context.Background())).To(Succeed())
+			Expect(sut.Shutdown(context.Background())).To(Succeed())
+			sut.Close()
+
+			// Then
+			Expect(called).To(Equal(1))
+		})
+		It("should clean up each resource once when closed during a sweep", func() {
+			// Given
+			sut = resourcestore.NewWithTimeout(10 * time.Millisecond)
+			const count = 50
+			var mutex sync.Mutex
+			calls := map[string]int{}
+			for i := 0; i < count; i++ {
+				name := fmt.Sprintf("name-%d", i)
+				cleaner := resourcestore.NewResourceCleaner()
+				cleaner.Add(context.Background(), name, func() error {
+					time.Sleep(time.Millisecond)
+					mutex.Lock()
+					defer mutex.Unlock()
+					calls[name]++
+					return nil
+				})
+				Expect(sut.Put("", name, &entry{id: name}, cleaner)).To(Succeed())
+			}
+
+			// When
+			// The resources become stale after the first sweep and are
+			// cleaned up by the second one.
+			time.Sleep(25 * time.Millisecond)
+			Expect(sut.Shutdown(context.Background())).To(Succeed())
+
+			// Then
+			Eventually(func() int {
+				mutex.Lock()
+				defer mutex.Unlock()
+				return len(calls)
+			}).Should(Equal(count))
+			Consistently(func() map[string]int {
+				mutex.Lock()
+				defer mutex.Unlock()
+				return calls
+			}, 100*time.Millisecond).Should(HaveEach(1))
+		})
+	})
+	Context("persistence", func() {
+		var stateDir string
+		manifestCleaner := func(ids map[string]string) *resourcestore.ResourceCleaner {
+			cleaner := resourcestore.NewResourceCleaner()
+			cleaner.SetManifest("sandbox", ids)
+			return cleaner
+		}
+		manifests := func() []string {
+			entries, err := os.ReadDir(stateDir)
+			Expect(err).NotTo(HaveOccurred())
+			names := []string{}
+			for _, entry := range entries {
+				names = append(names, entry.Name())
+			}
+			return names
+		}
+		BeforeEach(func() {
+			stateDir = GinkgoT().TempDir()
+			sut = resourcestore.NewWithOptions(resourcestore.Options{StateDir: stateDir})
+		})
+		AfterEach(func() {
+			sut.Close()
+		})
+		It("should keep the manifest until the resource is retrieved", func() {
+			// Given
+			Expect(sut.Put("", testName, &entry{id: testID}, manifestCleaner(map[string]string{"id": testID}))).To(Succeed())
+			Expect(sut.Put("", "unpersisted", &entry{id: "other"}, resourcestore.NewResourceCleaner())).To(Succeed())
+			Expect(manifests()).To(HaveLen(1))
+
+			// When
+			Expect(sut.Get("", testName)).To(Equal(testID))
+
+			// Then
+			Expect(manifests()).To(BeEmpty())
+		})
+		It("should remove the manifest once the resource has been cleaned up", func() {
+			// Given
+			failing := true
+			cleaner := manifestCleaner(nil)
+			cleaner.Add(context.Background(), "test", func() error {
+				if failing {
+					return errors.New("busy")
+				}
+				return nil
+			})
+			Expect(sut.PutWithLabels("", testName, &entry{id: testID}, cleaner, map[string]string{"sandbox": "sb"})).To(Succeed())
+
+			// When
+			Expect(sut.RemoveByLabel("", "sandbox", "sb")).NotTo(Succeed())
+
+			// Then
+			Expect(manifests()).To(HaveLen(1))
+
+			// A new store replays the manifest of the failed cleanup.
+			replayed := []*resourcestore.CleanupManifest{}
+			next := resourcestore.NewWithOptions(resourcestore.Options{StateDir: stateDir})
+			defer next.Close()
+			next.RegisterCleanupHandler("sandbox", func(_ context.Context, manifest *resourcestore.CleanupManifest) error {
+				replayed = append(replayed, manifest)
+				return nil
+			})
+			next.ReplayCleanupManifests(context.Background())
+			Expect(replayed).To(HaveLen(1))
+			Expect(replayed[0].Name).To(Equal(testName))
+			Expect(replayed[0].Type).To(Equal("sandbox"))
+			Expect(manifests()).To(BeEmpty())
+		})
+		It("should replay leftover manifests through their handlers", func() {
+			// Given
+			Expect(sut.Put("", "first", &entry{id: "first"}, manifestCleaner(map[string]string{"id": "first", "netns": "/run/netns/first"}))).To(Succeed())
+			Expect(sut.Put("", "second", &entry{id: "second"}, manifestCleaner(map[string]string{"id": "second"}))).To(Succeed())
+			unknown := resourcestore.NewResourceCleaner()
+			unknown.SetManifest("unknown", nil)
+			Expect(sut.Put("", "third", &entry{id: "third"}, unknown)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(stateDir, "corrupt.json"), []byte("{"), 0o600)).To(Succeed())
+
+			// When
+			next := resourcestore.NewWithOptions(resourcestore.Options{StateDir: stateDir})
+			defer next.Close()
+			cleaned := map[string]string{}
+			next.RegisterCleanupHandler("sandbox", func(_ context.Context, manifest *resourcestore.CleanupManifest) error {
+				if manifest.Name == "second" {
+					return errors.New("busy")
+				}
+				cleaned[manifest.Name] = manifest.IDs["netns"]
+				return nil
+			})
+			next.ReplayCleanupManifests(context.Background())
+
+			// Then
+			Expect(cleaned).To(Equal(map[string]string{"first": "/run/netns/first"}))
+			// The manifests of the failed handler and of the unknown type
+			// are kept, the corrupt one is moved aside.
+			Expect(manifests()).To(HaveLen(3))
+			Expect(manifests()).To(ContainElement("corrupt.json.corrupt"))
+		})
+	})
+	Context("retrieval hook", func() {
+		var retrieved []string
+		BeforeEach(func() {
+			retrieved = nil
+			sut = resourcestore.NewWithOptions(resourcestore.Options{
+				OnRetrieved: func(namespace, name, id string) {
+					// The hook may use the store, as its locks are released.
+					Expect(sut.Peek(namespace, name)).To(BeEmpty())
+					retrieved = append(retrieved, name+"="+id)
+				},
+			})
+		})
+		AfterEach(func() {
+			sut.Close()
+		})
+		It("should be called for retrieved resources only", func() {
+			// Given
+			Expect(sut.Put("", testName, &entry{id: testID}, resourcestore.NewResourceCleaner())).To(Succeed())
+			sut.SetStageForResource(context.Background(), "", "pending", "creating")
+
+			// When
+			Expect(sut.Get("", "pending")).To(BeEmpty())
+			Expect(sut.Peek("", testName)).To(Equal(testID))
+			Expect(sut.Get("", testName)).To(Equal(testID))
+			Expect(sut.Get("", testName)).To(BeEmpty())
+
+			// Then
+			Expect(retrieved).To(Equal([]string{testName + "=" + testID}))
+		})
+	})
+	Context("cleanup logging", func() {
+		var (
+			output   *syncBuffer
+			previous io.Writer
+			level    logrus.Level
+		)
+		BeforeEach(func() {
+			output = &syncBuffer{}
+			previous = logrus.StandardLogger().Out
+			level = logrus.GetLevel()
+			logrus.SetOutput(output)
+			logrus.SetLevel(logrus.InfoLevel)
+		})
+		AfterEach(func() {
+			sut.Close()
+			logrus.SetOutput(previous)
+			logrus.SetLevel(level)
+		})
+		// cleanUp puts resources with the given names and waits for the
+		// cleanup routine to reap them.
+		cleanUp := func(timeout time.Duration, names ...string) {
+			var wg sync.WaitGroup
+			for _, name := range names {
+				wg.Add(1)
+				c := resourcestore.NewResourceCleaner()
+				c.Add(context.Background(), name, func() error {
+					wg.Done()
+					return nil
+				})
+				Expect(sut.Put("", name, &entry{id: name}, c)).To(Succeed())
+			}
+			done := make(chan struct{})
+			go func() {
+				wg.Wait()
+				close(done)
+			}()
+			Eventually(done, 5*timeout).Should(BeClosed())
+		}
+		It("should only log a summary of cycles reaping many resources", func() {
+			// Given
+			timeout := 200 * time.Millisecond
+			sut = resourcestore.NewNamed("logging", resourcestore.Options{Timeout: timeout, CleanupLogThreshold: 2})
+
+			// When
+			cleanUp(timeout, "a", "b", "c")
+
+			// Then
+			Expect(output.String()).To(ContainSubstring("logging store: Cleaning up 3 stale resources"))
+			Expect(output.String()).NotTo(ContainSubstring("logging store: Cleaning up stale resource"))
+		})
+		It("should log each resource of small cycles", func() {
+			// Given
+			timeout := 200 * time.Millisecond
+			sut = resourcestore.NewNamed("logging", resourcestore.Options{Timeout: timeout})
+
+			// When
+			cleanUp(timeout, "a")
+
+			// Then
+			Expect(output.String()).To(ContainSubstring("logging store: Cleaning up 1 stale resources"))
+			Expect(output.String()).To(ContainSubstring("logging store: Cleaning up stale resource a"))
+		})
+	})
+	Context("claims", func() {
+		BeforeEach(func() {
+			sut = resourcestore.NewWithOptions(resourcestore.Options{ClaimExpiry: 100 * time.Millisecond})
+		})
+		AfterEach(func() {
+			sut.Close()
+		})
+		It("should wake watchers of abandoned creations", func() {
+			// Given
+			sut.SetStageForResource(context.Background(), "", testName, "creating")
+			sut.Claim("", testName)
+			watcher, stage := sut.WatcherForResource("", testName)
+			Expect(stage).To(Equal("creating"))
+
+			// When
+			var err error
+			Eventually(watcher, 5*time.Second).Should(Receive(&err))
+
+			// Then
+			Expect(err).To(MatchError(resourcestore.ErrCreationAbandoned))
+			Expect(sut.WatcherCounts()).NotTo(HaveKey(testName))
+		})
+		It("should not expire creations making progress", func() {
+			// Given
+			sut.Claim("", testName)
+			watcher, _ := sut.WatcherForResource("", testName)
+
+			// When
+			for range 4 {
+				time.Sleep(50 * time.Millisecond)
+				sut.SetStageForResource(context.Background(), "", testName, "progressing")
+			}
+			Expect(sut.Put("", testName, &entry{id: testID}, resourcestore.NewResourceCleaner())).To(Succeed())
+
+			// Then
+			var err error
+			Expect(watcher).To(Receive(&err))
+			Expect(err).ToNot(HaveOccurred())
+			Consistently(func() string { return sut.Peek("", testName) }, 300*time.Millisecond).Should(Equal(testID))
+		})
+		It("should not affect resources already put", func() {
+			// Given
+			Expect(sut.Put("", testName, &entry{id: testID}, resourcestore.NewResourceCleaner())).To(Succeed())
+
+			// When
+			sut.Claim("", testName)
+
+			// Then
+			Consistently(func() string { return sut.Peek("", testName) }, 300*time.Millisecond).Should(Equal(testID))
+		})
+	})
+	Context("max lifetime", func() {
+		var m *fakeMetrics
+		BeforeEach(func() {
+			m = newFakeMetrics()
+			sut = resourcestore.NewWithOptions(resourcestore.Options{
+				Metrics:     m,
+				MaxLifetime: 200 * time.Millisecond,
+			})
+		})
+		AfterEach(func() {
+			sut.Close()
+		})
+		It("should reap resources which are not stale yet", func() {
+			// Given
+			cleaned := make(chan struct{})
+			cleaner := resourcestore.NewResourceCleaner()
+			cleaner.Add(context.Background(), "reap", func() error {
+				close(cleaned)
+				return nil
+			})
+
+			// When
+			Expect(sut.PutWithTimeout("", testName, &entry{id: testID}, cleaner, time.Hour)).To(Succeed())
+
+			// Then
+			Eventually(cleaned, 5*time.Second).Should(BeClosed())
+			Expect(sut.Peek("", testName)).To(BeEmpty())
+			Expect(m.reaped(resourcestore.ResourceKindPut)).To(Equal(1))
+		})
+		It("should reap resources despite being touched", func() {
+			// Given
+			Expect(sut.Put("", testName, &entry{id: testID}, resourcestore.NewResourceCleaner())).To(Succeed())
+
+			// When
+			Eventually(func() bool {
+				sut.Touch("", testName)
+				return sut.Peek("", testName) == ""
+			}, 5*time.Second, 20*time.Millisecond).Should(BeTrue())
+
+			// Then
+			Expect(m.reaped(resourcestore.ResourceKindPut)).To(Equal(1))
+		})
+		It("should wake the watchers of creations in progress", func() {
+			// Given
+			sut.SetStageForResource(context.Background(), "", testName, "creating")
+			watcher, _ := sut.WatcherForResource("", testName)
+
+			// When
+			var err error
+			Eventually(watcher, 5*time.Second).Should(Receive(&err))
+
+			// Then
+			Expect(err).To(MatchError(resourcestore.ErrMaxLifetimeExceeded))
+			Expect(sut.WatcherCounts()).NotTo(HaveKey(testName))
+			Expect(m.reaped(resourcestore.ResourceKindPlaceholder)).To(Equal(1))
+		})
+		It("should measure the lifetime from the registration", func() {
+			// Given
+			watcher, _ := sut.WatcherForResource("", testName)
+			time.Sleep(150 * time.Millisecond)
+
+			// When
+			Expect(sut.Put("", testName, &entry{id: testID}, resourcestore.NewResourceCleaner())).To(Succeed())
+
+			// Then
+			Expect(watcher).To(Receive(BeNil()))
+			Eventually(func() string { return sut.Peek("", testName) }, time.Second).Should(BeEmpty())
+			Expect(m.reaped(resourcestore.ResourceKindPut)).To(Equal(1))
+		})
+	})
+	Context("Create", func() {
+		BeforeEach(func() {
+			sut = resourcestore.New()
+		})
+		AfterEach(func() {
+			sut.Close()
+		})
+		It("should run a single creation for concurrent callers", func() {
+			// Given
+			var calls atomic.Int32
+			release := make(chan struct{})
+			created := &entry{id: testID}
+			createFn := func(*resourcestore.ResourceCleaner) (resourcestore.IdentifiableCreatable, error) {
+				calls.Add(1)
+				<-release
+				return created, nil
+			}
+
+			// When
+			ids := make(chan string, 5)
+			var started, wg sync.WaitGroup
+			for range 5 {
+				started.Add(1)
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					defer GinkgoRecover()
+					started.Done()
+					id, err := sut.Create(context.Background(), "", testName, createFn)
+					Expect(err).NotTo(HaveOccurred())
+					ids <- id
+				}()
+			}
+			started.Wait()
+			// Let all callers join the creation in flight.
+			time.Sleep(100 * time.Millisecond)
+			close(release)
+			wg.Wait()
+			close(ids)
+
+			// Then
+			Expect(calls.Load()).To(BeEquivalentTo(1))
+			for id := range ids {
+				Expect(id).To(Equal(testID))
+			}
+			Expect(created.created).To(BeTrue())
+			Expect(sut.List()).To(BeEmpty())
+		})
+		It("should report the error of the creation to all callers", func() {
+			// Given
+			createErr := errors.New("creation failed")
+			release := make(chan struct{})
+			createFn := func(*resourcestore.ResourceCleaner) (resourcestore.IdentifiableCreatable, error) {
+				<-release
+				return nil, createErr
+			}
+			errs := make(chan error, 2)
+			for range 2 {
+				go func() {
+					_, err := sut.Create(context.Background(), "", testName, createFn)
+					errs <- err
+				}()
+			}
+
+			// When
+			close(release)
+
+			// Then
+			for range 2 {
+				Eventually(errs).Should(Receive(MatchError(createErr)))
+			}
+			Expect(sut.List()).To(BeEmpty())
+		})
+		It("should fail the creation and clean up if it panics", func() {
+			// Given
+			cleaned := make(chan bool, 1)
+			createFn := func(cleaner *resourcestore.ResourceCleaner) (resourcestore.IdentifiableCreatable, error) {
+				cleaner.Add(context.Background(), "test", func() error {
+					cleaned <- true
+					return nil
+				})
+				panic("creation panicked")
+			}
+			watcher, _ := sut.WatcherForResource("", testName)
+
+			// When
+			_, err := sut.Create(context.Background(), "", testName, createFn)
+
+			// Then
+			Expect(err).To(MatchError(ContainSubstring("creation panicked")))
+			Expect(cleaned).To(Receive())
+			Expect(watcher).To(Receive(MatchError(err)))
+			Expect(sut.List()).To(BeEmpty())
+		})
+		It("should keep creating for a retry if the caller gave up", func() {
+			// Given
+			var calls atomic.Int32
+			release := make(chan struct{})
+			created := &entry{id: testID}
+			createFn := func(*resourcestore.ResourceCleaner) (resourcestore.IdentifiableCreatable, error) {
+				calls.Add(1)
+				<-release
+				return created, nil
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			// When
+			_, err := sut.Create(ctx, "", testName, createFn)
+			close(release)
+
+			// Then
+			Expect(err).To(MatchError(context.Canceled))
+			Eventually(func() string { return sut.Peek("", testName) }).Should(Equal(testID))
+			Expect(created.created).To(BeFalse())
+
+			id, err := sut.Create(context.Background(), "", testName, createFn)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(id).To(Equal(testID))
+			Expect(calls.Load()).To(BeEquivalentTo(1))
+			Expect(created.created).To(BeTrue())
+		})
+	})
+	Context("metrics", func() {
+		var m *fakeMetrics
+		BeforeEach(func() {
+			m = newFakeMetrics()
+		})
+		AfterEach(func() {
+			sut.Close()
+		})
+		It("should count resources, puts, gets and watchers", func() {
+			// Given
+			sut = resourcestore.NewWithTimeoutAndMetrics(time.Minute, m)
+
+			// When
+			sut.WatcherForResource("", testName)
+			sut.WatcherForResource("", testName)
+			sut.SetStageForResource(context.Background(), "", "other", "stage")
+
+			// Then
+			Expect(m.stored(resourcestore.ResourceKindPlaceholder)).To(Equal(2))
+			Expect(m.stored(resourcestore.ResourceKindPut)).To(BeZero())
+			Expect(m.watchers).To(Equal(2))
+			Expect(sut.Get("", testName)).To(BeEmpty())
+
+			Expect(sut.Put("", testName, &entry{id: testID}, resourcestore.NewResourceCleaner())).To(Succeed())
+			Expect(m.stored(resourcestore.ResourceKindPlaceholder)).To(Equal(1))
+			Expect(m.stored(resourcestore.ResourceKindPut)).To(Equal(1))
+
+			Expect(sut.Get("", testName)).To(Equal(testID))
+			Expect(sut.Get("", testName)).To(BeEmpty())
+			sut.Delete("", "other")
+
+			Expect(m.stored(resourcestore.ResourceKindPlaceholder)).To(BeZero())
+			Expect(m.stored(resourcestore.ResourceKindPut)).To(BeZero())
+			Expect(m.puts).To(Equal(1))
+			Expect(m.hits).To(Equal(1))
+			Expect(m.misses).To(Equal(2))
+			Expect(m.ages).To(HaveLen(1))
+		})
+		It("should observe the time watchers waited until notified", func() {
+			// Given
+			sut = resourcestore.NewWithTimeoutAndMetrics(time.Minute, m)
+			notified, _ := sut.WatcherForResource("", testName)
+			failed, _ := sut.WatcherForResource("", "failed")
+			ctx, cancel := context.WithCancel(context.Background())
+			_, _ = sut.WatcherForResourceWithContext(ctx, "", "canceled")
+			cancel()
+			time.Sleep(10 * time.Millisecond)
+
+			// When
+			Expect(sut.Put("", testName, &entry{id: testID}, resourcestore.NewResourceCleaner())).To(Succeed())
+			sut.Fail("", "failed", errors.New("creation failed"))
+
+			// Then
+			Expect(notified).To(Receive(BeNil()))
+			Expect(failed).To(Receive(HaveOccurred()))
+			m.mutex.Lock()
+			defer m.mutex.Unlock()
+			// Watchers which stopped waiting are not observed.
+			Expect(m.waits).To(HaveLen(2))
+			Expect(m.waits).To(HaveEach(BeNumerically(">=", 10*time.Millisecond)))
+		})
+		It("should count stale cleanups", func() {
+			// Given
+			sut = resourcestore.NewWithTimeoutAndMetrics(100*time.Millisecond, m)
+
+			// When
+			Expect(sut.PutWithTimeout("", testName, &entry{id: testID}, resourcestore.NewResourceCleaner(), time.Millisecond)).To(Succeed())
+
+			// Then
+			Eventually(m.staleCleanupCount).Should(Equal(1))
+			Expect(m.stored(resourcestore.ResourceKindPut)).To(BeZero())
+		})
+		It("should observe whether retrieved resources had been stale", func() {
+			// Given
+			sut = resourcestore.NewWithTimeoutAndMetrics(200*time.Millisecond, m)
+			Expect(sut.Put("", "fresh", &entry{id: "fresh"}, resourcestore.NewResourceCleaner())).To(Succeed())
+			Expect(sut.Put("", testName, &entry{id: testID}, resourcestore.NewResourceCleaner())).To(Succeed())
+			Expect(sut.Get("", "fresh")).To(Equal("fresh"))
+			Eventually(func() bool {
+				infos := sut.List()
+				return len(infos) == 1 && infos[0].Stale
+			}).Should(BeTrue())
+
+			// When
+			// Touching the resource does not hide that it had been stale.
+			Expect(sut.Touch("", testName)).To(BeTrue())
+			Expect(sut.Get("", testName)).To(Equal(testID))
+
+			// Then
+			Expect(m.retrievedStale()).To(Equal([]bool{false, true}))
+		})
+	})
+	Context("namespaces", func() {
+		var m *fakeMetrics
+		BeforeEach(func() {
+			m = newFakeMetrics()
+			sut = resourcestore.NewWithTimeoutAndMetrics(time.Minute, m)
+		})
+		AfterEach(func() {
+			sut.Close()
+		})
+		It("should keep resources with the same name in different namespaces apart", func() {
+			// Given
+			Expect(sut.Put("tenant-a", testName, &entry{id: "a"}, resourcestore.NewResourceCleaner())).To(Succeed())
+			watcher, _ := sut.WatcherForResource("tenant-b", testName)
+
+			// When
+			Expect(sut.Put("tenant-b", testName, &entry{id: "b"}, resourcestore.NewResourceCleaner())).To(Succeed())
+
+			// Then
+			Expect(watcher).To(Receive(BeNil()))
+			Expect(sut.Peek("", testName)).To(BeEmpty())
+			Expect(sut.Get("tenant-a", testName)).To(Equal("a"))
+			Expect(sut.Get("tenant-a", testName)).To(BeEmpty())
+			Expect(sut.Get("tenant-b", testName)).To(Equal("b"))
+		})
+		It("should only operate on the labels of the namespace", func() {
+			// Given
+			labels := map[string]string{"sandbox": "sb1"}
+			Expect(sut.PutWithLabels("tenant-a", "ctr", &entry{id: "a"}, resourcestore.NewResourceCleaner(), labels)).To(Succeed())
+			Expect(sut.PutWithLabels("tenant-b", "ctr", &entry{id: "b"}, resourcestore.NewResourceCleaner(), labels)).To(Succeed())
+
+			// When
+			Expect(sut.RemoveByLabel("tenant-a", "sandbox", "sb1")).To(Succeed())
+
+			// Then
+			Expect(sut.ListByLabel("tenant-a", "sandbox", "sb1")).To(BeEmpty())
+			Expect(sut.ListByLabel("tenant-b", "sandbox", "sb1")).To(ConsistOf("ctr"))
+		})
+		It("should report the namespaces of the entries", func() {
+			// Given
+			Expect(sut.Put("tenant-a", testName, &entry{id: "a"}, resourcestore.NewResourceCleaner())).To(Succeed())
+			Expect(sut.Put("tenant-a", "other", &entry{id: "other"}, resourcestore.NewResourceCleaner())).To(Succeed())
+			_, _ = sut.WatcherForResource("", testName)
+
+			// When
+			infos := sut.List()
+			stats := sut.Stats()
+
+			// Then
+			Expect(infos).To(ContainElement(And(HaveField("Name", testName), HaveField("Namespace", "tenant-a"))))
+			Expect(infos).To(ContainElement(And(HaveField("Name", testName), HaveField("Namespace", ""))))
+			Expect(stats.Namespaces).To(Equal(map[string]int{"tenant-a": 2, "": 1}))
+			Expect(sut.WatcherCounts()).To(Equal(map[string]int{"tenant-a/" + testName: 0, "tenant-a/other": 0, testName: 1}))
+			Expect(m.storedInNamespace("tenant-a")).To(Equal(2))
+			Expect(m.storedInNamespace("")).To(Equal(1))
+
+			Expect(sut.Get("tenant-a", testName)).To(Equal("a"))
+			Expect(m.storedInNamespace("tenant-a")).To(Equal(1))
+		})
+		It("should replay the manifests of namespaced resources", func() {
+			// Given
+			stateDir := GinkgoT().TempDir()
+			store := resourcestore.NewWithOptions(resourcestore.Options{StateDir: stateDir})
+			for _, namespace := range []string{"", "tenant-a"} {
+				cleaner := resourcestore.NewResourceCleaner()
+				cleaner.SetManifest("sandbox", nil)
+				Expect(store.Put(namespace, testName, &entry{id: testID}, cleaner)).To(Succeed())
+			}
+			store.Close()
+
+			// When
+			replayed := []string{}
+			next := resourcestore.NewWithOptions(resourcestore.Options{StateDir: stateDir})
+			defer next.Close()
+			next.RegisterCleanupHandler("sandbox", func(_ context.Context, manifest *resourcestore.CleanupManifest) error {
+				replayed = append(replayed, manifest.Namespace+"/"+manifest.Name)
+				return nil
+			})
+			next.ReplayCleanupManifests(context.Background())
+
+			// Then
+			Expect(replayed).To(ConsistOf("/"+testName, "tenant-a/"+testName))
+		})
+	})
 })
@@ -0,0 +1,27 @@
+//go:build test
+// +build test
+
+// All *_inject.go files are meant to be used by tests only. Purpose of this
+// files is to provide a way to inject mocked data into the current setup.
+
+package resourcestore
+
+import "time"
+
+// NewWithTimeoutAndMetrics creates a new ResourceStore with the given timeout
+// reporting to metrics.
+func NewWithTimeoutAndMetrics(timeout time.Duration, metrics Metrics) *ResourceStore {
+	return NewWithOptions(Options{Timeout: timeout, Metrics: metrics})
+}
+
+// SetPutTimeForResource overrides the time the resource with the given name
+// in the namespace has been Put, which orders its cleanup.
+func (rc *ResourceStore) SetPutTimeForResource(namespace, name string, putAt time.Time) {
+	key := resourceKey{namespace, name}
+	shard := rc.shardFor(key)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+	if r, ok := shard.resources[key]; ok {
+		r.putAt = putAt
+	}
+}
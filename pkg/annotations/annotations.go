@@ -83,6 +83,16 @@ const (
 
 	// DisableFIPSAnnotation is used to disable FIPS mode for a pod within a FIPS-enabled Kubernetes cluster.
 	DisableFIPSAnnotation = "io.kubernetes.cri-o.DisableFIPS"
+
+	// CheckpointOnOOMAnnotation opts a container into forensic checkpoints written to the
+	// configured crash_dump_dir when the container is about to run out of memory
+	// or one of its processes crashes.
+	CheckpointOnOOMAnnotation = "io.kubernetes.cri-o.CheckpointOnOOM"
+
+	// CheckpointTimeNamespaceAnnotation runs a container in its own time namespace,
+	// so that its monotonic and boot time clocks are preserved across checkpoint
+	// and restore.
+	CheckpointTimeNamespaceAnnotation = "io.kubernetes.cri-o.CheckpointTimeNamespace"
 )
 
 var AllAllowedAnnotations = []string{
@@ -107,6 +117,8 @@ var AllAllowedAnnotations = []string{
 	CPUSharedAnnotation,
 	SeccompProfileAnnotation,
 	DisableFIPSAnnotation,
+	CheckpointOnOOMAnnotation,
+	CheckpointTimeNamespaceAnnotation,
 	// Keep in sync with
 	// https://github.com/opencontainers/runc/blob/3db0871f1cf25c7025861ba0d51d25794cb21623/features.go#L67
 	// Once runc 1.2 is released, we can use the `runc features` command to get this programmatically,
@@ -29,4 +29,75 @@ const (
 	// creating a checkpoint image to specify the version of CRIU used on the
 	// host where the checkpoint was created.
 	CheckpointAnnotationCriuVersion = "io.kubernetes.cri-o.annotations.checkpoint.criu.version"
+
+	// CheckpointAnnotationIgnoreBaseImageMismatch can be set to "true" on a
+	// container restored from a checkpoint to restore it on a different
+	// version of its base image if the original version cannot be pulled.
+	CheckpointAnnotationIgnoreBaseImageMismatch = "io.kubernetes.cri-o.annotations.checkpoint.ignoreBaseImageMismatch"
+
+	// CheckpointAnnotationMountRemap can be set on a container restored from
+	// a checkpoint to a JSON object mapping the host paths of the checkpointed
+	// mounts to host paths on the restoring node. If set, every mount of the
+	// checkpoint which is not part of the restore request needs an entry,
+	// host paths which stay the same are mapped to themselves. Entries for
+	// host paths the checkpoint does not mount are rejected.
+	CheckpointAnnotationMountRemap = "io.kubernetes.cri-o.annotations.checkpoint.mountRemap"
+
+	// CheckpointAnnotationPullAuth can be set on a pod to the base64 encoded
+	// "username:password" credentials used to pull the checkpoint image and
+	// the base image of a checkpoint restored into the pod.
+	CheckpointAnnotationPullAuth = "io.kubernetes.cri-o.annotations.checkpoint.pullAuth"
+
+	// CheckpointAnnotationDiagnosticOnly can be set to "true" on a container
+	// to only dump the memory of its processes when checkpointing it, for
+	// debugging purposes. The container keeps running and the checkpoint
+	// cannot be restored.
+	CheckpointAnnotationDiagnosticOnly = "io.kubernetes.cri-o.annotations.checkpoint.diagnosticOnly"
+
+	// CheckpointAnnotationCPULimit can be set on a container restored from a
+	// checkpoint to a CPU quantity, like "1500m", overriding the CPU limit of
+	// the restore request, for example to fit a differently sized node.
+	CheckpointAnnotationCPULimit = "io.kubernetes.cri-o.annotations.checkpoint.cpuLimit"
+
+	// CheckpointAnnotationMemoryLimit can be set on a container restored from
+	// a checkpoint to a memory quantity, like "512Mi", overriding the memory
+	// limit of the restore request. Limits below the memory of the
+	// checkpointed processes are rejected.
+	CheckpointAnnotationMemoryLimit = "io.kubernetes.cri-o.annotations.checkpoint.memoryLimit"
+
+	// CheckpointAnnotationTolerateSpecDrift can be set to "true" on a
+	// container restored from a checkpoint to restore it although its sysctls
+	// or cgroup settings differ from the checkpointed container. Differences
+	// of mounts, devices and capabilities always fail the restore.
+	CheckpointAnnotationTolerateSpecDrift = "io.kubernetes.cri-o.annotations.checkpoint.tolerateSpecDrift"
+
+	// CheckpointAnnotationManageCgroupsMode can be set on a container
+	// restored from a checkpoint to the manage-cgroups mode of CRIU, "soft",
+	// "full" or "ignore". Checkpoints of a node with another cgroup version
+	// are restored in mode "ignore" by default and fail to restore in other
+	// modes.
+	CheckpointAnnotationManageCgroupsMode = "io.kubernetes.cri-o.annotations.checkpoint.manageCgroupsMode"
+
+	// CheckpointAnnotationIPMismatch can be set on a container restored from
+	// a checkpoint to the handling of a sandbox without the checkpointed
+	// IPs, "fail", "tcp-close" or "secondary-ip". Overrides the
+	// checkpoint_restore_ip_mismatch option.
+	CheckpointAnnotationIPMismatch = "io.kubernetes.cri-o.annotations.checkpoint.ipMismatch"
+
+	// CheckpointAnnotationIPDivergence is set by CRI-O on a container
+	// restored into a sandbox without the checkpointed IPs. It holds the
+	// removed and added IPs and the applied handling as JSON object.
+	CheckpointAnnotationIPDivergence = "io.kubernetes.cri-o.annotations.checkpoint.ipDivergence"
+
+	// CheckpointAnnotationRestoreMode can be set to "cold" on a container
+	// restored from a checkpoint to create the container fresh from the
+	// spec of the checkpoint, with the overrides of the restore request,
+	// instead of restoring its processes. CRI-O sets it on the restored
+	// container to the applied mode, "restore" or "cold".
+	CheckpointAnnotationRestoreMode = "io.kubernetes.cri-o.annotations.checkpoint.restoreMode"
+
+	// CheckpointAnnotationEnvOverrides is set by CRI-O on a container
+	// restored from a checkpoint to the JSON list of the environment
+	// variables of the restore request which override the checkpoint.
+	CheckpointAnnotationEnvOverrides = "io.kubernetes.cri-o.annotations.checkpoint.envOverrides"
 )
@@ -7,11 +7,13 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
 	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -67,6 +69,17 @@ const (
 	tasksetBinary                 = "taskset"
 	MonitorExecCgroupDefault      = ""
 	MonitorExecCgroupContainer    = "container"
+	defaultCheckpointArchiveMode  = "0600"
+	defaultCrashDumpInterval      = 300 // seconds
+	minResourceStoreTimeout       = 10  // seconds
+
+	defaultCheckpointFailureThreshold = 5
+	defaultCheckpointFailureWindow    = 300 // seconds
+	defaultCheckpointStagingTTL       = 600 // seconds
+
+	// defaultCheckpointLocation is the directory the kubelet writes
+	// checkpoint archives to.
+	defaultCheckpointLocation = "/var/lib/kubelet/checkpoints"
 )
 
 // Config represents the entire set of configuration values that can be set for
@@ -110,6 +123,35 @@ const (
 	// ImageVolumesBind option is for using bind mounted volumes.
 )
 
+const (
+	// CheckpointArchiveFormatNative is the tar archive of the checkpoint
+	// directory, as written by CRI-O and Podman.
+	CheckpointArchiveFormatNative = "crio-native"
+	// CheckpointArchiveFormatOCI is an OCI image layout archive holding the
+	// native archive as its single layer, annotated with the checkpointctl
+	// metadata, which other container engines can import and restore.
+	CheckpointArchiveFormatOCI = "interoperable-oci"
+)
+
+const (
+	// CheckpointRestoreIPMismatchFail fails the restore of a container into
+	// a sandbox which does not have the IPs of the checkpointed sandbox.
+	CheckpointRestoreIPMismatchFail = "fail"
+	// CheckpointRestoreIPMismatchTCPClose restores the container, with
+	// its connected TCP sockets in closed state.
+	CheckpointRestoreIPMismatchTCPClose = "tcp-close"
+	// CheckpointRestoreIPMismatchSecondaryIP restores the container after
+	// adding the IPs of the checkpointed sandbox as secondary addresses to
+	// the interfaces of the sandbox whose subnets contain them. The restore
+	// falls back to CheckpointRestoreIPMismatchTCPClose if the CNI result
+	// of the sandbox has no such interface.
+	CheckpointRestoreIPMismatchSecondaryIP = "secondary-ip"
+)
+
+// CheckpointLocationSchemeS3 is the URL scheme of checkpoint locations in an
+// S3-compatible object store, like "s3://bucket/key".
+const CheckpointLocationSchemeS3 = "s3"
+
 const (
 	// DefaultPidsLimit is the default value for maximum number of processes
 	// allowed inside a container.
@@ -178,6 +220,29 @@ type RootConfig struct {
 	// that checks whether we've had time to sync before shutting down
 	CleanShutdownFile string `toml:"clean_shutdown_file"`
 
+	// ResourceCleanupDir is the directory CRI-O persists the cleanup of
+	// sandboxes and containers to, whose creation timed out and which are
+	// kept for a retry of the kubelet, so that they are cleaned up after a
+	// crash of CRI-O. The cleanup is not persisted if empty.
+	ResourceCleanupDir string `toml:"resource_cleanup_dir"`
+
+	// ResourceCleanupMaxPerCycle is the maximum number of stale sandboxes
+	// and containers cleaned up in a single cleanup cycle. The remaining
+	// ones are deferred to the next cycle. Unlimited if 0.
+	ResourceCleanupMaxPerCycle int `toml:"resource_cleanup_max_per_cycle"`
+
+	// ResourceStoreTimeout is the time in seconds after which sandboxes and
+	// containers whose creation timed out and which have not been retrieved
+	// by a retry of the kubelet are considered stale. The built-in timeouts
+	// of the sandbox and container stores are used if 0. It can be changed
+	// by reloading the configuration.
+	ResourceStoreTimeout int64 `toml:"resource_store_timeout"`
+
+	// ResourceStoreMaxLifetime is the time in seconds after which sandboxes
+	// and containers kept for a retry of the kubelet are cleaned up, even
+	// if they are not stale yet. Unlimited if 0.
+	ResourceStoreMaxLifetime int64 `toml:"resource_store_max_lifetime"`
+
 	// InternalWipe is whether CRI-O should wipe containers and images after a reboot when the server starts.
 	// If set to false, one must use the external command `crio wipe` to wipe the containers and images in these situations.
 	// The option InternalWipe is deprecated, and will be removed in a future release.
@@ -426,6 +491,135 @@ type RuntimeConfig struct {
 	// to checkpoint and restore containers
 	EnableCriuSupport bool `toml:"enable_criu_support"`
 
+	// CheckpointArchiveMode is the octal file mode applied to checkpoint
+	// archives written by CRI-O.
+	CheckpointArchiveMode string `toml:"checkpoint_archive_mode"`
+
+	// CheckpointArchiveUID is the owning user ID of checkpoint archives.
+	// A value of -1 keeps the owner of the CRI-O process.
+	CheckpointArchiveUID int `toml:"checkpoint_archive_uid"`
+
+	// CheckpointArchiveGID is the owning group ID of checkpoint archives.
+	// A value of -1 keeps the group of the CRI-O process.
+	CheckpointArchiveGID int `toml:"checkpoint_archive_gid"`
+
+	// CheckpointArchiveSELinuxLabel is the SELinux label applied to
+	// checkpoint archives. If empty, the archive keeps the default label.
+	CheckpointArchiveSELinuxLabel string `toml:"checkpoint_archive_selinux_label"`
+
+	// CheckpointArchiveOverwrite allows checkpoints to replace an existing
+	// archive at the target location. If false, such checkpoints fail.
+	CheckpointArchiveOverwrite bool `toml:"checkpoint_archive_overwrite"`
+
+	// CheckpointArchivePartSize splits checkpoint archives into parts of at
+	// most this many bytes, tied together by a manifest at the target
+	// location. Parts which cannot be written to an object store are sent
+	// again. A value of 0 writes a single archive.
+	CheckpointArchivePartSize int64 `toml:"checkpoint_archive_part_size"`
+
+	// CheckpointArchiveFormat is the format of checkpoint archives, either
+	// CheckpointArchiveFormatNative or CheckpointArchiveFormatOCI.
+	CheckpointArchiveFormat string `toml:"checkpoint_archive_format"`
+
+	// CheckpointRestorePullImage enables pulling checkpoint images which are
+	// not available locally before restoring from them.
+	CheckpointRestorePullImage bool `toml:"checkpoint_restore_pull_image"`
+
+	// CheckpointRestoreEnvAllowlist are the names of the environment
+	// variables of a checkpoint which may be overridden by the restore
+	// request. A trailing "*" matches all names with the prefix before it.
+	CheckpointRestoreEnvAllowlist []string `toml:"checkpoint_restore_env_allowlist"`
+
+	// CheckpointDeviceBlocklist are the glob patterns of the device paths
+	// which prevent checkpointing a container they are assigned to, as CRIU
+	// cannot dump their state. Patterns can be removed for devices handled
+	// by a CRIU plugin.
+	CheckpointDeviceBlocklist []string `toml:"checkpoint_device_blocklist"`
+
+	// CheckpointLocationAllowlist are the directories checkpoint archives
+	// may be written to and restored from. Locations with template
+	// variables are rejected if empty, other locations are not restricted.
+	CheckpointLocationAllowlist []string `toml:"checkpoint_location_allowlist"`
+
+	// CheckpointDir is the directory relative checkpoint locations are
+	// resolved against. The oldest checkpoint archives in it are removed
+	// once CheckpointDirMaxCount or CheckpointDirMaxSize is exceeded.
+	CheckpointDir string `toml:"checkpoint_dir"`
+
+	// CheckpointDirMaxCount is the maximum number of checkpoint archives
+	// kept in CheckpointDir. Unlimited if 0.
+	CheckpointDirMaxCount int `toml:"checkpoint_dir_max_count"`
+
+	// CheckpointDirMaxSize is the maximum size in bytes of the checkpoint
+	// archives kept in CheckpointDir. Unlimited if 0.
+	CheckpointDirMaxSize int64 `toml:"checkpoint_dir_max_size"`
+
+	// CheckpointTmpfsMaxSize is the maximum size in bytes of the contents of
+	// each tmpfs mount of a container included in its checkpoint archive.
+	// The contents are not included if 0, checkpoints of tmpfs mounts
+	// holding more fail.
+	CheckpointTmpfsMaxSize int64 `toml:"checkpoint_tmpfs_max_size"`
+
+	// CheckpointGhostLimit is the maximum size in bytes of files which have
+	// been deleted while still open that CRIU includes in a checkpoint. CRIU
+	// refuses to checkpoint larger ones. CRIU's default limit applies if 0.
+	CheckpointGhostLimit int64 `toml:"checkpoint_ghost_limit"`
+
+	// CheckpointS3Endpoint is the URL of the S3-compatible object store
+	// checkpoint locations with the CheckpointLocationSchemeS3 scheme are
+	// written to and restored from. Such locations are rejected if empty.
+	CheckpointS3Endpoint string `toml:"checkpoint_s3_endpoint"`
+
+	// CheckpointS3Region is the region of CheckpointS3Endpoint requests
+	// are signed for.
+	CheckpointS3Region string `toml:"checkpoint_s3_region"`
+
+	// CheckpointS3CredentialsFile is the path of the file holding the
+	// credentials for CheckpointS3Endpoint, in the format of the AWS shared
+	// credentials file. Requests are not signed if empty.
+	CheckpointS3CredentialsFile string `toml:"checkpoint_s3_credentials_file"`
+
+	// CheckpointVerifyMaxConcurrent is the maximum number of checkpoint
+	// archives verified by a test restore at the same time, on request of
+	// the client. Verification is disabled if 0.
+	CheckpointVerifyMaxConcurrent int `toml:"checkpoint_verify_max_concurrent"`
+
+	// CheckpointFailureThreshold is the number of consecutive failed
+	// checkpoints of a container within CheckpointFailureWindow after which
+	// further checkpoints of it are rejected until the window expires.
+	// Checkpoints are never rejected if 0.
+	CheckpointFailureThreshold int `toml:"checkpoint_failure_threshold"`
+
+	// CheckpointFailureWindow is the time in seconds within which failed
+	// checkpoints of a container are counted, and for which its checkpoints
+	// are rejected once CheckpointFailureThreshold has been reached.
+	CheckpointFailureWindow int `toml:"checkpoint_failure_window"`
+
+	// CheckpointStagingTTL is the time in seconds a checkpoint archive
+	// staged ahead of its restore is kept before the staged data is
+	// removed. Staging is disabled if 0.
+	CheckpointStagingTTL int64 `toml:"checkpoint_staging_ttl"`
+
+	// CheckpointActionScripts are the paths of the executables CRIU runs at
+	// the phases of checkpointing and restoring containers, like pre-dump
+	// and post-restore.
+	CheckpointActionScripts []string `toml:"checkpoint_action_scripts"`
+
+	// CheckpointRestoreIPMismatch is the handling of a restore into a
+	// sandbox which does not have the IPs of the checkpointed sandbox,
+	// CheckpointRestoreIPMismatchFail, CheckpointRestoreIPMismatchTCPClose
+	// or CheckpointRestoreIPMismatchSecondaryIP.
+	CheckpointRestoreIPMismatch string `toml:"checkpoint_restore_ip_mismatch"`
+
+	// CrashDumpDir is the directory where forensic checkpoints of containers
+	// opted in via the CheckpointOnOOM annotation are written to.
+	// Crash dumps are disabled if empty.
+	CrashDumpDir string `toml:"crash_dump_dir"`
+
+	// CrashDumpInterval is the minimum number of seconds between two crash
+	// dumps of the same container.
+	CrashDumpInterval int `toml:"crash_dump_interval"`
+
 	// Runtimes defines a list of OCI compatible runtimes. The runtime to
 	// use is picked based on the runtime_handler provided by the CRI. If
 	// no runtime_handler is provided, the runtime will be picked based on
@@ -498,6 +692,10 @@ type RuntimeConfig struct {
 	// namespaceManager is the internal NamespaceManager configuration
 	namespaceManager *nsmgr.NamespaceManager
 
+	// checkpointRestoreCapabilities are the checkpoint/restore capabilities
+	// detected during validation
+	checkpointRestoreCapabilities *CheckpointRestoreCapabilities
+
 	// Whether SELinux should be disabled within a pod,
 	// when it is running in the host network namespace
 	// https://github.com/cri-o/cri-o/issues/5501
@@ -936,6 +1134,25 @@ func DefaultConfig() (*Config, error) {
 			HostNetworkDisableSELinux:   true,
 			DisableHostPortMapping:      false,
 			EnableCriuSupport:           true,
+			CheckpointArchiveMode:       defaultCheckpointArchiveMode,
+			CheckpointArchiveUID:        -1,
+			CheckpointArchiveGID:        -1,
+			CheckpointArchiveFormat:     CheckpointArchiveFormatNative,
+			CheckpointDeviceBlocklist: []string{
+				"/dev/nvidia*",
+				"/dev/dri/*",
+				"/dev/kfd",
+				"/dev/vfio/*",
+				"/dev/fuse",
+			},
+			CheckpointLocationAllowlist:   []string{defaultCheckpointLocation},
+			CheckpointS3Region:            "us-east-1",
+			CheckpointVerifyMaxConcurrent: 1,
+			CheckpointFailureThreshold:    defaultCheckpointFailureThreshold,
+			CheckpointFailureWindow:       defaultCheckpointFailureWindow,
+			CheckpointStagingTTL:          defaultCheckpointStagingTTL,
+			CheckpointRestoreIPMismatch:   CheckpointRestoreIPMismatchTCPClose,
+			CrashDumpInterval:             defaultCrashDumpInterval,
 		},
 		ImageConfig: ImageConfig{
 			DefaultTransport:   "docker://",
@@ -1061,6 +1278,16 @@ func RemoveUnusedSocket(path string) error {
 // execution checks. It returns an `error` on validation failure, otherwise
 // `nil`.
 func (c *RootConfig) Validate(onExecution bool) error {
+	if c.ResourceCleanupMaxPerCycle < 0 {
+		return fmt.Errorf("resource_cleanup_max_per_cycle %d must not be negative", c.ResourceCleanupMaxPerCycle)
+	}
+	if err := validateResourceStoreTimeout(c.ResourceStoreTimeout); err != nil {
+		return err
+	}
+	if c.ResourceStoreMaxLifetime < 0 {
+		return fmt.Errorf("resource_store_max_lifetime %d must not be negative", c.ResourceStoreMaxLifetime)
+	}
+
 	if onExecution {
 		if !filepath.IsAbs(c.LogDir) {
 			return errors.New("log_dir is not an absolute path")
@@ -1086,6 +1313,16 @@ func (c *RootConfig) Validate(onExecution bool) error {
 	return nil
 }
 
+// validateResourceStoreTimeout checks that the resource store timeout is
+// either unset or not below minResourceStoreTimeout, as the stores would
+// otherwise clean up resources before the kubelet is able to retry.
+func validateResourceStoreTimeout(timeout int64) error {
+	if timeout != 0 && timeout < minResourceStoreTimeout {
+		return fmt.Errorf("resource_store_timeout %d must be 0 or at least %d seconds", timeout, minResourceStoreTimeout)
+	}
+	return nil
+}
+
 func (c *RootConfig) CleanShutdownSupportedFileName() string {
 	return c.CleanShutdownFile + ".supported"
 }
@@ -1151,6 +1388,103 @@ func (c *RuntimeConfig) Validate(systemContext *types.SystemContext, onExecution
 		return fmt.Errorf("workloads validation: %w", err)
 	}
 
+	if _, err := c.CheckpointArchiveFileMode(); err != nil {
+		return fmt.Errorf("invalid checkpoint_archive_mode: %w", err)
+	}
+
+	if c.CheckpointArchiveUID < -1 {
+		return fmt.Errorf("invalid checkpoint_archive_uid: %d", c.CheckpointArchiveUID)
+	}
+
+	if c.CheckpointArchiveGID < -1 {
+		return fmt.Errorf("invalid checkpoint_archive_gid: %d", c.CheckpointArchiveGID)
+	}
+
+	if c.CheckpointArchivePartSize < 0 {
+		return fmt.Errorf("invalid checkpoint_archive_part_size: %d", c.CheckpointArchivePartSize)
+	}
+
+	switch c.CheckpointArchiveFormat {
+	case CheckpointArchiveFormatNative:
+	case CheckpointArchiveFormatOCI:
+		if c.CheckpointArchivePartSize > 0 {
+			return fmt.Errorf("checkpoint_archive_format %q cannot be split, checkpoint_archive_part_size has to be 0", c.CheckpointArchiveFormat)
+		}
+	default:
+		return fmt.Errorf("invalid checkpoint_archive_format %q, has to be %q or %q", c.CheckpointArchiveFormat, CheckpointArchiveFormatNative, CheckpointArchiveFormatOCI)
+	}
+
+	for _, pattern := range c.CheckpointDeviceBlocklist {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid checkpoint_device_blocklist pattern %q: %w", pattern, err)
+		}
+	}
+
+	for _, dir := range c.CheckpointLocationAllowlist {
+		if strings.HasPrefix(dir, CheckpointLocationSchemeS3+"://") {
+			continue
+		}
+		if !filepath.IsAbs(dir) {
+			return fmt.Errorf("checkpoint_location_allowlist entry %q is not an absolute path", dir)
+		}
+	}
+
+	if c.CheckpointS3Endpoint != "" {
+		endpoint, err := url.Parse(c.CheckpointS3Endpoint)
+		if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+			return fmt.Errorf("checkpoint_s3_endpoint %q is not an http or https URL", c.CheckpointS3Endpoint)
+		}
+		if c.CheckpointS3Region == "" {
+			return errors.New("checkpoint_s3_region must be set with checkpoint_s3_endpoint")
+		}
+	}
+	if c.CheckpointS3CredentialsFile != "" && !filepath.IsAbs(c.CheckpointS3CredentialsFile) {
+		return fmt.Errorf("checkpoint_s3_credentials_file %q is not an absolute path", c.CheckpointS3CredentialsFile)
+	}
+
+	if c.CheckpointDir != "" {
+		if !filepath.IsAbs(c.CheckpointDir) {
+			return fmt.Errorf("checkpoint_dir %q is not an absolute path", c.CheckpointDir)
+		}
+		if len(c.CheckpointLocationAllowlist) > 0 && !c.checkpointDirAllowed() {
+			return fmt.Errorf("checkpoint_dir %q is not in checkpoint_location_allowlist", c.CheckpointDir)
+		}
+	}
+	if c.CheckpointDirMaxCount < 0 {
+		return fmt.Errorf("checkpoint_dir_max_count must not be negative: %d", c.CheckpointDirMaxCount)
+	}
+	if c.CheckpointDirMaxSize < 0 {
+		return fmt.Errorf("checkpoint_dir_max_size must not be negative: %d", c.CheckpointDirMaxSize)
+	}
+	if c.CheckpointTmpfsMaxSize < 0 {
+		return fmt.Errorf("checkpoint_tmpfs_max_size must not be negative: %d", c.CheckpointTmpfsMaxSize)
+	}
+	if err := ValidateCheckpointGhostLimit(c.CheckpointGhostLimit); err != nil {
+		return fmt.Errorf("invalid checkpoint_ghost_limit: %w", err)
+	}
+	if c.CheckpointVerifyMaxConcurrent < 0 {
+		return fmt.Errorf("checkpoint_verify_max_concurrent must not be negative: %d", c.CheckpointVerifyMaxConcurrent)
+	}
+	if c.CheckpointFailureThreshold < 0 {
+		return fmt.Errorf("checkpoint_failure_threshold must not be negative: %d", c.CheckpointFailureThreshold)
+	}
+	if c.CheckpointFailureThreshold > 0 && c.CheckpointFailureWindow <= 0 {
+		return fmt.Errorf("checkpoint_failure_window must be positive: %d", c.CheckpointFailureWindow)
+	}
+	if c.CheckpointStagingTTL < 0 {
+		return fmt.Errorf("checkpoint_staging_ttl must not be negative: %d", c.CheckpointStagingTTL)
+	}
+	if err := validateCheckpointActionScripts(c.CheckpointActionScripts, onExecution); err != nil {
+		return fmt.Errorf("checkpoint_action_scripts: %w", err)
+	}
+	if err := ValidateCheckpointRestoreIPMismatch(c.CheckpointRestoreIPMismatch); err != nil {
+		return fmt.Errorf("invalid checkpoint_restore_ip_mismatch: %w", err)
+	}
+
+	if c.CrashDumpInterval < 0 {
+		return fmt.Errorf("crash_dump_interval must not be negative: %d", c.CrashDumpInterval)
+	}
+
 	// check for validation on execution
 	if onExecution {
 		// First, configure cgroup manager so the values of the Runtime.MonitorCgroup can be validated
@@ -1205,16 +1539,7 @@ func (c *RuntimeConfig) Validate(systemContext *types.SystemContext, onExecution
 			return fmt.Errorf("initialize nsmgr: %w", err)
 		}
 
-		if c.EnableCriuSupport {
-			if err := validateCriuInPath(); err != nil {
-				c.EnableCriuSupport = false
-				logrus.Infof("Checkpoint/restore support disabled: CRIU binary not found int $PATH")
-			} else {
-				logrus.Infof("Checkpoint/restore support enabled")
-			}
-		} else {
-			logrus.Infof("Checkpoint/restore support disabled via configuration")
-		}
+		c.validateCheckpointRestore()
 
 		if err := c.seccompConfig.LoadProfile(c.SeccompProfile); err != nil {
 			if !errors.Is(err, os.ErrNotExist) {
@@ -1479,6 +1804,35 @@ func (c *RuntimeConfig) CheckpointRestore() bool {
 	return c.EnableCriuSupport
 }
 
+// CheckpointArchiveFileMode returns the parsed file mode for checkpoint
+// archives.
+func (c *RuntimeConfig) CheckpointArchiveFileMode() (os.FileMode, error) {
+	if c.CheckpointArchiveMode == "" {
+		return 0o600, nil
+	}
+	mode, err := strconv.ParseUint(c.CheckpointArchiveMode, 8, 32)
+	if err != nil {
+		return 0, err
+	}
+	if mode&^uint64(os.ModePerm) != 0 {
+		return 0, fmt.Errorf("mode %q contains non permission bits", c.CheckpointArchiveMode)
+	}
+	return os.FileMode(mode), nil
+}
+
+// checkpointDirAllowed returns whether CheckpointDir is one of the
+// directories of CheckpointLocationAllowlist or below one of them.
+func (c *RuntimeConfig) checkpointDirAllowed() bool {
+	dir := filepath.Clean(c.CheckpointDir)
+	for _, allowed := range c.CheckpointLocationAllowlist {
+		rel, err := filepath.Rel(filepath.Clean(allowed), dir)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
 func validateExecutablePath(executable, currentPath string) (string, error) {
 	if currentPath == "" {
 		path, err := exec.LookPath(executable)
@@ -2,6 +2,7 @@ package config_test
 
 import (
 	"context"
+	"errors"
 	"os"
 	"os/exec"
 	"path"
@@ -273,6 +274,43 @@ var _ = t.Describe("Config", func() {
 			Expect(sut.HooksDir).To(HaveLen(1))
 		})
 
+		It("should disable checkpoint/restore if its prerequisites are not met", func() {
+			// Given
+			sut = runtimeValidConfig()
+			sut.EnableCriuSupport = true
+			fakeCriuInPath()
+			DeferCleanup(config.SetCheckpointRestoreCapabilitiesDetector(func() (*config.CheckpointRestoreCapabilities, error) {
+				return nil, errors.New("checkpoint/restore requires at least CRIU 31600, current version is 31500")
+			}))
+
+			// When
+			err := sut.RuntimeConfig.Validate(nil, true)
+
+			// Then
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sut.CheckpointRestore()).To(BeFalse())
+			Expect(sut.CheckpointRestoreCapabilities()).To(BeNil())
+		})
+
+		It("should record the detected checkpoint/restore capabilities", func() {
+			// Given
+			sut = runtimeValidConfig()
+			sut.EnableCriuSupport = true
+			fakeCriuInPath()
+			capabilities := &config.CheckpointRestoreCapabilities{CriuVersion: 31700, MemTrack: true}
+			DeferCleanup(config.SetCheckpointRestoreCapabilitiesDetector(func() (*config.CheckpointRestoreCapabilities, error) {
+				return capabilities, nil
+			}))
+
+			// When
+			err := sut.RuntimeConfig.Validate(nil, true)
+
+			// Then
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sut.CheckpointRestore()).To(BeTrue())
+			Expect(sut.CheckpointRestoreCapabilities()).To(Equal(capabilities))
+		})
+
 		It("should fail on invalid conmon path", func() {
 			// Given
 			sut.Runtimes[config.DefaultRuntime] = &config.RuntimeHandler{RuntimePath: validFilePath}
@@ -421,6 +459,279 @@ var _ = t.Describe("Config", func() {
 			Expect(sut.DefaultRuntime).To(Equal(config.DefaultRuntime))
 		})
 
+		It("should fail on invalid checkpoint_archive_mode", func() {
+			// Given
+			sut.CheckpointArchiveMode = "0999"
+
+			// When
+			err := sut.RuntimeConfig.Validate(nil, false)
+
+			// Then
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should fail on checkpoint_archive_mode with non permission bits", func() {
+			// Given
+			sut.CheckpointArchiveMode = "4755"
+
+			// When
+			err := sut.RuntimeConfig.Validate(nil, false)
+
+			// Then
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should fail on checkpoint_archive_uid below -1", func() {
+			// Given
+			sut.CheckpointArchiveUID = -2
+
+			// When
+			err := sut.RuntimeConfig.Validate(nil, false)
+
+			// Then
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should fail on checkpoint_archive_gid below -1", func() {
+			// Given
+			sut.CheckpointArchiveGID = -2
+
+			// When
+			err := sut.RuntimeConfig.Validate(nil, false)
+
+			// Then
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should fail on invalid checkpoint_archive_format", func() {
+			// Given
+			sut.CheckpointArchiveFormat = "containerd"
+
+			// When
+			err := sut.RuntimeConfig.Validate(nil, false)
+
+			// Then
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should fail on split interoperable-oci checkpoint archives", func() {
+			// Given
+			sut.CheckpointArchiveFormat = config.CheckpointArchiveFormatOCI
+			sut.CheckpointArchivePartSize = 1024
+
+			// When
+			err := sut.RuntimeConfig.Validate(nil, false)
+
+			// Then
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should fail on invalid checkpoint_device_blocklist pattern", func() {
+			// Given
+			sut.CheckpointDeviceBlocklist = []string{"/dev/[nvidia"}
+
+			// When
+			err := sut.RuntimeConfig.Validate(nil, false)
+
+			// Then
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should fail on relative checkpoint_location_allowlist entry", func() {
+			// Given
+			sut.CheckpointLocationAllowlist = []string{"checkpoints"}
+
+			// When
+			err := sut.RuntimeConfig.Validate(nil, false)
+
+			// Then
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should fail on checkpoint_dir outside of checkpoint_location_allowlist", func() {
+			// Given
+			sut.CheckpointLocationAllowlist = []string{"/var/lib/checkpoints"}
+			sut.CheckpointDir = "/var/lib/checkpoints-other"
+
+			// When
+			err := sut.RuntimeConfig.Validate(nil, false)
+
+			// Then
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should succeed with checkpoint_dir in checkpoint_location_allowlist", func() {
+			// Given
+			sut.CheckpointLocationAllowlist = []string{"/var/lib/checkpoints"}
+			sut.CheckpointDir = "/var/lib/checkpoints"
+			sut.CheckpointDirMaxCount = 10
+
+			// When
+			err := sut.RuntimeConfig.Validate(nil, false)
+
+			// Then
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("should fail on negative checkpoint_dir_max_size", func() {
+			// Given
+			sut.CheckpointDirMaxSize = -1
+
+			// When
+			err := sut.RuntimeConfig.Validate(nil, false)
+
+			// Then
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should fail on a checkpoint_ghost_limit CRIU does not accept", func() {
+			for _, limit := range []int64{-1, 1 << 32} {
+				// Given
+				sut.CheckpointGhostLimit = limit
+
+				// When
+				err := sut.RuntimeConfig.Validate(nil, false)
+
+				// Then
+				Expect(err).To(HaveOccurred())
+			}
+		})
+		It("should fail on negative checkpoint_tmpfs_max_size", func() {
+			// Given
+			sut.CheckpointTmpfsMaxSize = -1
+
+			// When
+			err := sut.RuntimeConfig.Validate(nil, false)
+
+			// Then
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should succeed with an object store in checkpoint_location_allowlist", func() {
+			// Given
+			sut.CheckpointLocationAllowlist = []string{"/var/lib/checkpoints", "s3://bucket/checkpoints"}
+			sut.CheckpointS3Endpoint = "https://s3.example.com"
+
+			// When
+			err := sut.RuntimeConfig.Validate(nil, false)
+
+			// Then
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("should fail on invalid checkpoint_s3_endpoint", func() {
+			// Given
+			sut.CheckpointS3Endpoint = "s3.example.com"
+
+			// When
+			err := sut.RuntimeConfig.Validate(nil, false)
+
+			// Then
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should fail on relative checkpoint_s3_credentials_file", func() {
+			// Given
+			sut.CheckpointS3CredentialsFile = "credentials"
+
+			// When
+			err := sut.RuntimeConfig.Validate(nil, false)
+
+			// Then
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should fail on negative checkpoint_verify_max_concurrent", func() {
+			// Given
+			sut.CheckpointVerifyMaxConcurrent = -1
+
+			// When
+			err := sut.RuntimeConfig.Validate(nil, false)
+
+			// Then
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should fail on negative checkpoint_failure_threshold", func() {
+			// Given
+			sut.CheckpointFailureThreshold = -1
+
+			// When
+			err := sut.RuntimeConfig.Validate(nil, false)
+
+			// Then
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should fail on a checkpoint_failure_window which is not positive", func() {
+			// Given
+			sut.CheckpointFailureWindow = 0
+
+			// When
+			err := sut.RuntimeConfig.Validate(nil, false)
+
+			// Then
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should fail on negative checkpoint_staging_ttl", func() {
+			// Given
+			sut.CheckpointStagingTTL = -1
+
+			// When
+			err := sut.RuntimeConfig.Validate(nil, false)
+
+			// Then
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should fail on invalid checkpoint_restore_ip_mismatch", func() {
+			// Given
+			sut.CheckpointRestoreIPMismatch = "ignore"
+
+			// When
+			err := sut.RuntimeConfig.Validate(nil, false)
+
+			// Then
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should fail on relative checkpoint_action_scripts", func() {
+			// Given
+			sut.CheckpointActionScripts = []string{"pre-dump.sh"}
+
+			// When
+			err := sut.RuntimeConfig.Validate(nil, false)
+
+			// Then
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should fail on checkpoint_action_scripts which are not executable", func() {
+			// Given
+			script := filepath.Join(t.MustTempDir("action-scripts"), "pre-dump.sh")
+			Expect(os.WriteFile(script, []byte("#!/bin/sh\n"), 0o644)).To(Succeed())
+			sut.CheckpointActionScripts = []string{script}
+
+			// When
+			err := sut.RuntimeConfig.Validate(nil, true)
+
+			// Then
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("is not executable"))
+		})
+
+		It("should fail on negative crash_dump_interval", func() {
+			// Given
+			sut.CrashDumpInterval = -1
+
+			// When
+			err := sut.RuntimeConfig.Validate(nil, false)
+
+			// Then
+			Expect(err).To(HaveOccurred())
+		})
+
 		It("should fail on invalid default_sysctls", func() {
 			// Given
 			sut.DefaultSysctls = []string{invalid}
@@ -996,6 +1307,39 @@ var _ = t.Describe("Config", func() {
 			Expect(err).ToNot(HaveOccurred())
 		})
 
+		It("should fail on negative resource_cleanup_max_per_cycle", func() {
+			// Given
+			sut.RootConfig.ResourceCleanupMaxPerCycle = -1
+
+			// When
+			err := sut.RootConfig.Validate(false)
+
+			// Then
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should fail on negative resource_store_max_lifetime", func() {
+			// Given
+			sut.RootConfig.ResourceStoreMaxLifetime = -1
+
+			// When
+			err := sut.RootConfig.Validate(false)
+
+			// Then
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should fail on resource store timeout below the minimum", func() {
+			// Given
+			sut.RootConfig.ResourceStoreTimeout = 5
+
+			// When
+			err := sut.RootConfig.Validate(false)
+
+			// Then
+			Expect(err).To(HaveOccurred())
+		})
+
 		It("should fail on invalid LogDir", func() {
 			// Given
 			sut.RootConfig.LogDir = "/dev/null"
@@ -32,3 +32,14 @@ func (c *Config) SetNamespaceManager(nsMgr *nsmgr.NamespaceManager) {
 func (c *RuntimeConfig) SetCheckpointRestore(cr bool) {
 	c.EnableCriuSupport = cr
 }
+
+// SetCheckpointRestoreCapabilitiesDetector replaces the detection of the
+// checkpoint/restore capabilities for testing. The returned function restores
+// the original detection.
+func SetCheckpointRestoreCapabilitiesDetector(detect func() (*CheckpointRestoreCapabilities, error)) func() {
+	original := detectCheckpointRestoreCapabilities
+	detectCheckpointRestoreCapabilities = detect
+	return func() {
+		detectCheckpointRestoreCapabilities = original
+	}
+}
@@ -0,0 +1,142 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/checkpoint-restore/go-criu/v7"
+	"github.com/checkpoint-restore/go-criu/v7/rpc"
+	criuutils "github.com/checkpoint-restore/go-criu/v7/utils"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/proto"
+)
+
+// CheckpointRestoreCapabilities describes the checkpoint/restore support of
+// the host, as detected when validating the configuration.
+type CheckpointRestoreCapabilities struct {
+	// CriuVersion is the version of CRIU, for example 31600 for 3.16.
+	CriuVersion int `json:"criuVersion"`
+	// MemTrack is set if the kernel supports tracking memory changes,
+	// which is required for pre-dumps.
+	MemTrack bool `json:"memTrack"`
+	// LazyPages is set if the kernel supports lazy migration of memory.
+	LazyPages bool `json:"lazyPages"`
+	// PidfdStore is set if CRIU supports pidfd based PID reuse detection.
+	PidfdStore bool `json:"pidfdStore"`
+}
+
+// detectCheckpointRestoreCapabilities probes the installed CRIU and the
+// kernel features it relies on. It fails if CRIU cannot be used to
+// checkpoint containers at all, while missing optional features are only
+// reported in the returned capabilities.
+var detectCheckpointRestoreCapabilities = func() (*CheckpointRestoreCapabilities, error) {
+	c := criu.MakeCriu()
+	version, err := c.GetCriuVersion()
+	if err != nil {
+		return nil, fmt.Errorf("failed to check for CRIU version: %w", err)
+	}
+	if version < criuutils.PodCriuVersion {
+		return nil, fmt.Errorf("checkpoint/restore requires at least CRIU %d, current version is %d", criuutils.PodCriuVersion, version)
+	}
+
+	capabilities := &CheckpointRestoreCapabilities{CriuVersion: version}
+	features, err := c.FeatureCheck(&rpc.CriuFeatures{
+		MemTrack:   proto.Bool(true),
+		LazyPages:  proto.Bool(true),
+		PidfdStore: proto.Bool(true),
+	})
+	if err != nil {
+		logrus.Warnf("Unable to check for CRIU features: %v", err)
+		return capabilities, nil
+	}
+	capabilities.MemTrack = features.GetMemTrack()
+	capabilities.LazyPages = features.GetLazyPages()
+	capabilities.PidfdStore = features.GetPidfdStore()
+	return capabilities, nil
+}
+
+// validateCheckpointActionScripts checks that the action scripts are
+// absolute paths which can be written to a CRIU configuration file. On
+// execution, they also have to be executable files.
+func validateCheckpointActionScripts(scripts []string, onExecution bool) error {
+	for _, script := range scripts {
+		if !filepath.IsAbs(script) {
+			return fmt.Errorf("%q is not an absolute path", script)
+		}
+		if strings.ContainsAny(script, " \t\n\"'") {
+			return fmt.Errorf("%q contains whitespace or quotes", script)
+		}
+		if !onExecution {
+			continue
+		}
+		info, err := os.Stat(script)
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return fmt.Errorf("%s is not a regular file", script)
+		}
+		if info.Mode().Perm()&0o111 == 0 {
+			return fmt.Errorf("%s is not executable", script)
+		}
+	}
+	return nil
+}
+
+// validateCheckpointRestore runs the checkpoint/restore self-test if support
+// is enabled. Support is disabled if its prerequisites are not met, so that
+// it is not advertised and checkpoints fail early with a clear error.
+func (c *RuntimeConfig) validateCheckpointRestore() {
+	if !c.EnableCriuSupport {
+		logrus.Infof("Checkpoint/restore support disabled via configuration")
+		return
+	}
+	if err := validateCriuInPath(); err != nil {
+		c.EnableCriuSupport = false
+		logrus.Infof("Checkpoint/restore support disabled: CRIU binary not found int $PATH")
+		return
+	}
+
+	capabilities, err := detectCheckpointRestoreCapabilities()
+	if err != nil {
+		c.EnableCriuSupport = false
+		logrus.Warnf("Checkpoint/restore support disabled: %v", err)
+		return
+	}
+	c.checkpointRestoreCapabilities = capabilities
+	logrus.Infof("Checkpoint/restore support enabled using CRIU %d", capabilities.CriuVersion)
+	if !capabilities.MemTrack {
+		logrus.Warnf("Checkpoint/restore: the kernel does not support memory tracking, pre-dumps are not available")
+	}
+}
+
+// CheckpointRestoreCapabilities returns the detected checkpoint/restore
+// capabilities of the host, or nil if checkpoint/restore is disabled.
+func (c *RuntimeConfig) CheckpointRestoreCapabilities() *CheckpointRestoreCapabilities {
+	if !c.EnableCriuSupport {
+		return nil
+	}
+	return c.checkpointRestoreCapabilities
+}
+
+// ValidateCheckpointRestoreIPMismatch checks that mode is one of the
+// handlings of a restore into a sandbox without the checkpointed IPs.
+func ValidateCheckpointRestoreIPMismatch(mode string) error {
+	switch mode {
+	case CheckpointRestoreIPMismatchFail, CheckpointRestoreIPMismatchTCPClose, CheckpointRestoreIPMismatchSecondaryIP:
+		return nil
+	}
+	return fmt.Errorf("%q has to be %q, %q or %q", mode, CheckpointRestoreIPMismatchFail, CheckpointRestoreIPMismatchTCPClose, CheckpointRestoreIPMismatchSecondaryIP)
+}
+
+// ValidateCheckpointGhostLimit checks that limit is a ghost file limit CRIU
+// accepts, 0 selecting the default of CRIU.
+func ValidateCheckpointGhostLimit(limit int64) error {
+	if limit < 0 || limit > math.MaxUint32 {
+		return fmt.Errorf("%d has to be between 0 and %d bytes", limit, uint32(math.MaxUint32))
+	}
+	return nil
+}
@@ -74,6 +74,9 @@ func (c *Config) Reload(ctx context.Context) error {
 	if err := c.ReloadRuntimes(newConfig); err != nil {
 		return err
 	}
+	if err := c.ReloadResourceStoreTimeout(newConfig); err != nil {
+		return err
+	}
 	if err := cdi.Configure(cdi.WithSpecDirs(newConfig.CDISpecDirs...)); err != nil {
 		return err
 	}
@@ -291,3 +294,18 @@ func (c *Config) ReloadRuntimes(newConfig *Config) error {
 
 	return nil
 }
+
+// ReloadResourceStoreTimeout updates the ResourceStoreTimeout with the
+// provided `newConfig`. It errors if the timeout is below the minimum. The
+// caller is responsible for applying it to the resource stores.
+func (c *Config) ReloadResourceStoreTimeout(newConfig *Config) error {
+	if c.ResourceStoreTimeout == newConfig.ResourceStoreTimeout {
+		return nil
+	}
+	if err := validateResourceStoreTimeout(newConfig.ResourceStoreTimeout); err != nil {
+		return err
+	}
+	c.ResourceStoreTimeout = newConfig.ResourceStoreTimeout
+	logConfig("resource_store_timeout", strconv.FormatInt(c.ResourceStoreTimeout, 10))
+	return nil
+}
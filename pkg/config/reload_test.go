@@ -447,4 +447,33 @@ var _ = t.Describe("Config", func() {
 			Expect(sut.PinnedImages).To(Equal([]string{"image1", "image2", "image3"}))
 		})
 	})
+
+	t.Describe("ReloadResourceStoreTimeout", func() {
+		It("should update the timeout", func() {
+			// Given
+			newConfig := &config.Config{}
+			newConfig.ResourceStoreTimeout = 600
+
+			// When
+			err := sut.ReloadResourceStoreTimeout(newConfig)
+
+			// Then
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sut.ResourceStoreTimeout).To(BeEquivalentTo(600))
+		})
+
+		It("should fail and keep the timeout if it is below the minimum", func() {
+			// Given
+			sut.ResourceStoreTimeout = 600
+			newConfig := &config.Config{}
+			newConfig.ResourceStoreTimeout = 1
+
+			// When
+			err := sut.ReloadResourceStoreTimeout(newConfig)
+
+			// Then
+			Expect(err).To(HaveOccurred())
+			Expect(sut.ResourceStoreTimeout).To(BeEquivalentTo(600))
+		})
+	})
 })
@@ -2,7 +2,9 @@ package config_test
 
 import (
 	"errors"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"testing"
 
 	. "github.com/onsi/ginkgo/v2"
@@ -38,6 +40,14 @@ func validConmonPath() string {
 	return conmonPath
 }
 
+// fakeCriuInPath provides a criu executable in $PATH for the duration of
+// the test, the actual checks of CRIU are replaced by the tests.
+func fakeCriuInPath() {
+	dir := t.MustTempDir("criu")
+	Expect(os.WriteFile(filepath.Join(dir, "criu"), []byte("#!/bin/sh\n"), 0o755)).To(Succeed())
+	GinkgoT().Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
 var _ = BeforeSuite(func() {
 	t = NewTestFramework(NilFunc, NilFunc)
 	t.Setup()
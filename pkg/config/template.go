@@ -160,6 +160,26 @@ func initCrioTemplateConfig(c *Config) ([]*templateConfigValue, error) {
 			group:          crioRootConfig,
 			isDefaultValue: simpleEqual(dc.CleanShutdownFile, c.CleanShutdownFile),
 		},
+		{
+			templateString: templateStringCrioResourceCleanupDir,
+			group:          crioRootConfig,
+			isDefaultValue: simpleEqual(dc.ResourceCleanupDir, c.ResourceCleanupDir),
+		},
+		{
+			templateString: templateStringCrioResourceCleanupMaxPerCycle,
+			group:          crioRootConfig,
+			isDefaultValue: simpleEqual(dc.ResourceCleanupMaxPerCycle, c.ResourceCleanupMaxPerCycle),
+		},
+		{
+			templateString: templateStringCrioResourceStoreTimeout,
+			group:          crioRootConfig,
+			isDefaultValue: simpleEqual(dc.ResourceStoreTimeout, c.ResourceStoreTimeout),
+		},
+		{
+			templateString: templateStringCrioResourceStoreMaxLifetime,
+			group:          crioRootConfig,
+			isDefaultValue: simpleEqual(dc.ResourceStoreMaxLifetime, c.ResourceStoreMaxLifetime),
+		},
 		{
 			templateString: templateStringCrioAPIListen,
 			group:          crioAPIConfig,
@@ -440,6 +460,141 @@ func initCrioTemplateConfig(c *Config) ([]*templateConfigValue, error) {
 			group:          crioRuntimeConfig,
 			isDefaultValue: simpleEqual(dc.EnableCriuSupport, c.EnableCriuSupport),
 		},
+		{
+			templateString: templateStringCrioRuntimeCheckpointArchiveMode,
+			group:          crioRuntimeConfig,
+			isDefaultValue: simpleEqual(dc.CheckpointArchiveMode, c.CheckpointArchiveMode),
+		},
+		{
+			templateString: templateStringCrioRuntimeCheckpointArchiveUID,
+			group:          crioRuntimeConfig,
+			isDefaultValue: simpleEqual(dc.CheckpointArchiveUID, c.CheckpointArchiveUID),
+		},
+		{
+			templateString: templateStringCrioRuntimeCheckpointArchiveGID,
+			group:          crioRuntimeConfig,
+			isDefaultValue: simpleEqual(dc.CheckpointArchiveGID, c.CheckpointArchiveGID),
+		},
+		{
+			templateString: templateStringCrioRuntimeCheckpointArchiveSELinuxLabel,
+			group:          crioRuntimeConfig,
+			isDefaultValue: simpleEqual(dc.CheckpointArchiveSELinuxLabel, c.CheckpointArchiveSELinuxLabel),
+		},
+		{
+			templateString: templateStringCrioRuntimeCheckpointArchiveOverwrite,
+			group:          crioRuntimeConfig,
+			isDefaultValue: simpleEqual(dc.CheckpointArchiveOverwrite, c.CheckpointArchiveOverwrite),
+		},
+		{
+			templateString: templateStringCrioRuntimeCheckpointArchivePartSize,
+			group:          crioRuntimeConfig,
+			isDefaultValue: simpleEqual(dc.CheckpointArchivePartSize, c.CheckpointArchivePartSize),
+		},
+		{
+			templateString: templateStringCrioRuntimeCheckpointArchiveFormat,
+			group:          crioRuntimeConfig,
+			isDefaultValue: simpleEqual(dc.CheckpointArchiveFormat, c.CheckpointArchiveFormat),
+		},
+		{
+			templateString: templateStringCrioRuntimeCheckpointRestorePullImage,
+			group:          crioRuntimeConfig,
+			isDefaultValue: simpleEqual(dc.CheckpointRestorePullImage, c.CheckpointRestorePullImage),
+		},
+		{
+			templateString: templateStringCrioRuntimeCheckpointRestoreEnvAllowlist,
+			group:          crioRuntimeConfig,
+			isDefaultValue: stringSliceEqual(dc.CheckpointRestoreEnvAllowlist, c.CheckpointRestoreEnvAllowlist),
+		},
+		{
+			templateString: templateStringCrioRuntimeCheckpointDeviceBlocklist,
+			group:          crioRuntimeConfig,
+			isDefaultValue: stringSliceEqual(dc.CheckpointDeviceBlocklist, c.CheckpointDeviceBlocklist),
+		},
+		{
+			templateString: templateStringCrioRuntimeCheckpointLocationAllowlist,
+			group:          crioRuntimeConfig,
+			isDefaultValue: stringSliceEqual(dc.CheckpointLocationAllowlist, c.CheckpointLocationAllowlist),
+		},
+		{
+			templateString: templateStringCrioRuntimeCheckpointDir,
+			group:          crioRuntimeConfig,
+			isDefaultValue: simpleEqual(dc.CheckpointDir, c.CheckpointDir),
+		},
+		{
+			templateString: templateStringCrioRuntimeCheckpointDirMaxCount,
+			group:          crioRuntimeConfig,
+			isDefaultValue: simpleEqual(dc.CheckpointDirMaxCount, c.CheckpointDirMaxCount),
+		},
+		{
+			templateString: templateStringCrioRuntimeCheckpointDirMaxSize,
+			group:          crioRuntimeConfig,
+			isDefaultValue: simpleEqual(dc.CheckpointDirMaxSize, c.CheckpointDirMaxSize),
+		},
+		{
+			templateString: templateStringCrioRuntimeCheckpointTmpfsMaxSize,
+			group:          crioRuntimeConfig,
+			isDefaultValue: simpleEqual(dc.CheckpointTmpfsMaxSize, c.CheckpointTmpfsMaxSize),
+		},
+		{
+			templateString: templateStringCrioRuntimeCheckpointGhostLimit,
+			group:          crioRuntimeConfig,
+			isDefaultValue: simpleEqual(dc.CheckpointGhostLimit, c.CheckpointGhostLimit),
+		},
+		{
+			templateString: templateStringCrioRuntimeCheckpointS3Endpoint,
+			group:          crioRuntimeConfig,
+			isDefaultValue: simpleEqual(dc.CheckpointS3Endpoint, c.CheckpointS3Endpoint),
+		},
+		{
+			templateString: templateStringCrioRuntimeCheckpointS3Region,
+			group:          crioRuntimeConfig,
+			isDefaultValue: simpleEqual(dc.CheckpointS3Region, c.CheckpointS3Region),
+		},
+		{
+			templateString: templateStringCrioRuntimeCheckpointS3CredentialsFile,
+			group:          crioRuntimeConfig,
+			isDefaultValue: simpleEqual(dc.CheckpointS3CredentialsFile, c.CheckpointS3CredentialsFile),
+		},
+		{
+			templateString: templateStringCrioRuntimeCheckpointVerifyMaxConcurrent,
+			group:          crioRuntimeConfig,
+			isDefaultValue: simpleEqual(dc.CheckpointVerifyMaxConcurrent, c.CheckpointVerifyMaxConcurrent),
+		},
+		{
+			templateString: templateStringCrioRuntimeCheckpointFailureThreshold,
+			group:          crioRuntimeConfig,
+			isDefaultValue: simpleEqual(dc.CheckpointFailureThreshold, c.CheckpointFailureThreshold),
+		},
+		{
+			templateString: templateStringCrioRuntimeCheckpointFailureWindow,
+			group:          crioRuntimeConfig,
+			isDefaultValue: simpleEqual(dc.CheckpointFailureWindow, c.CheckpointFailureWindow),
+		},
+		{
+			templateString: templateStringCrioRuntimeCheckpointStagingTTL,
+			group:          crioRuntimeConfig,
+			isDefaultValue: simpleEqual(dc.CheckpointStagingTTL, c.CheckpointStagingTTL),
+		},
+		{
+			templateString: templateStringCrioRuntimeCheckpointActionScripts,
+			group:          crioRuntimeConfig,
+			isDefaultValue: stringSliceEqual(dc.CheckpointActionScripts, c.CheckpointActionScripts),
+		},
+		{
+			templateString: templateStringCrioRuntimeCheckpointRestoreIPMismatch,
+			group:          crioRuntimeConfig,
+			isDefaultValue: simpleEqual(dc.CheckpointRestoreIPMismatch, c.CheckpointRestoreIPMismatch),
+		},
+		{
+			templateString: templateStringCrioRuntimeCrashDumpDir,
+			group:          crioRuntimeConfig,
+			isDefaultValue: simpleEqual(dc.CrashDumpDir, c.CrashDumpDir),
+		},
+		{
+			templateString: templateStringCrioRuntimeCrashDumpInterval,
+			group:          crioRuntimeConfig,
+			isDefaultValue: simpleEqual(dc.CrashDumpInterval, c.CrashDumpInterval),
+		},
 		{
 			templateString: templateStringCrioRuntimeEnablePodEvents,
 			group:          crioRuntimeConfig,
@@ -803,6 +958,36 @@ const templateStringCrioCleanShutdownFile = `# Location for CRI-O to lay down th
 
 `
 
+const templateStringCrioResourceCleanupDir = `# Directory in which CRI-O persists the cleanup of sandboxes and containers
+# whose creation timed out and which are kept for a retry of the kubelet.
+# Leftovers are cleaned up when CRI-O starts after a crash.
+# The cleanup is not persisted if empty.
+{{ $.Comment }}resource_cleanup_dir = "{{ .ResourceCleanupDir }}"
+
+`
+
+const templateStringCrioResourceCleanupMaxPerCycle = `# Maximum number of stale sandboxes and containers cleaned up in a single
+# cleanup cycle, oldest first. The remaining ones are deferred to the next
+# cycle. Unlimited if 0.
+{{ $.Comment }}resource_cleanup_max_per_cycle = {{ .ResourceCleanupMaxPerCycle }}
+
+`
+
+const templateStringCrioResourceStoreTimeout = `# Time in seconds after which sandboxes and containers whose creation timed
+# out and which have not been retrieved by a retry of the kubelet are cleaned
+# up. The built-in timeouts are used if 0, otherwise it must be at least 10
+# seconds. It is applied when the configuration is reloaded.
+{{ $.Comment }}resource_store_timeout = {{ .ResourceStoreTimeout }}
+
+`
+
+const templateStringCrioResourceStoreMaxLifetime = `# Time in seconds after which sandboxes and containers kept for a retry of the
+# kubelet are cleaned up, even if they have not become stale yet. Unlimited
+# if 0.
+{{ $.Comment }}resource_store_max_lifetime = {{ .ResourceStoreMaxLifetime }}
+
+`
+
 const templateStringCrioInternalWipe = `# InternalWipe is whether CRI-O should wipe containers and images after a reboot when the server starts.
 # If set to false, one must use the external command 'crio wipe' to wipe the containers and images in these situations.
 {{ $.Comment }}internal_wipe = {{ .InternalWipe }}
@@ -1199,6 +1384,217 @@ const templateStringCrioRuntimeEnableCriuSupport = `# Globally enable/disable CR
 
 `
 
+const templateStringCrioRuntimeCheckpointArchiveMode = `# Octal file mode of checkpoint archives written by CRI-O.
+{{ $.Comment }}checkpoint_archive_mode = "{{ .CheckpointArchiveMode }}"
+
+`
+
+const templateStringCrioRuntimeCheckpointArchiveUID = `# Owning user ID of checkpoint archives. -1 keeps the user of the CRI-O process.
+{{ $.Comment }}checkpoint_archive_uid = {{ .CheckpointArchiveUID }}
+
+`
+
+const templateStringCrioRuntimeCheckpointArchiveGID = `# Owning group ID of checkpoint archives. -1 keeps the group of the CRI-O process.
+{{ $.Comment }}checkpoint_archive_gid = {{ .CheckpointArchiveGID }}
+
+`
+
+const templateStringCrioRuntimeCheckpointArchiveSELinuxLabel = `# SELinux label of checkpoint archives. If empty, the default label is kept.
+# Labeling failures on file systems without xattr support are only logged.
+{{ $.Comment }}checkpoint_archive_selinux_label = "{{ .CheckpointArchiveSELinuxLabel }}"
+
+`
+
+const templateStringCrioRuntimeCheckpointArchiveOverwrite = `# Replace existing files at the checkpoint target location. If false,
+# checkpointing to an existing file fails.
+{{ $.Comment }}checkpoint_archive_overwrite = {{ .CheckpointArchiveOverwrite }}
+
+`
+
+const templateStringCrioRuntimeCheckpointArchivePartSize = `# Split checkpoint archives into parts of at most this many bytes, for
+# transports with a size limit per object. The parts are written next to the
+# target location, which holds a manifest listing them. Restoring from the
+# manifest reassembles the parts. Exports to object stores resume after a
+# failed part by sending only that part again. If 0, a single archive is
+# written.
+{{ $.Comment }}checkpoint_archive_part_size = {{ .CheckpointArchivePartSize }}
+
+`
+
+const templateStringCrioRuntimeCheckpointArchiveFormat = `# Format of checkpoint archives:
+# - "crio-native": tar archive of the checkpoint directory, restorable by
+#   CRI-O and Podman.
+# - "interoperable-oci": OCI image layout archive holding the native archive as
+#   its single layer, annotated with the "org.criu.checkpoint.*" metadata of
+#   checkpointctl. It can be imported as a checkpoint image by other container
+#   engines, like containerd, and restored from directly by CRI-O. It cannot be
+#   split with checkpoint_archive_part_size.
+# Restoring requires a CRIU version at least as new as the one which wrote the
+# checkpoint, and CRI-O specific checkpoint metadata up to format version 3.
+{{ $.Comment }}checkpoint_archive_format = "{{ .CheckpointArchiveFormat }}"
+
+`
+
+const templateStringCrioRuntimeCheckpointRestorePullImage = `# Pull checkpoint images which are not available locally before restoring
+# from them. The pull uses the regular image pull configuration and credentials,
+# or the credentials of the pod annotation
+# "io.kubernetes.cri-o.annotations.checkpoint.pullAuth" if set.
+{{ $.Comment }}checkpoint_restore_pull_image = {{ .CheckpointRestorePullImage }}
+
+`
+
+const templateStringCrioRuntimeCheckpointRestoreEnvAllowlist = `# Environment variables of a checkpoint which are overridden by the values of
+# the restore request, like the node name or the pod IP. A trailing "*" matches
+# all variables with the prefix before it. All other variables keep the value
+# of the checkpoint. The overrides only change the configuration of the
+# container, which applies to exec sessions and restarts. The restored
+# processes keep the environment CRIU restored into their memory.
+{{ $.Comment }}checkpoint_restore_env_allowlist = [
+{{ range $env := .CheckpointRestoreEnvAllowlist }}{{ $.Comment }}{{ printf "\t%q,\n" $env }}{{ end }}{{ $.Comment }}]
+
+`
+
+const templateStringCrioRuntimeCheckpointDeviceBlocklist = `# Glob patterns of device paths which prevent checkpointing the containers they
+# are assigned to, as CRIU cannot dump the state of the devices. Checkpointing
+# such a container fails early with an error naming the device. Remove the
+# pattern of a device whose state is handled by a CRIU plugin.
+{{ $.Comment }}checkpoint_device_blocklist = [
+{{ range $device := .CheckpointDeviceBlocklist }}{{ $.Comment }}{{ printf "\t%q,\n" $device }}{{ end }}{{ $.Comment }}]
+
+`
+
+const templateStringCrioRuntimeCheckpointLocationAllowlist = `# Directories checkpoint archives may be written to and restored from. Other
+# locations, also those reached by symbolic links or "..", are rejected.
+# Locations may have template variables, like
+# "/var/lib/checkpoints/{{"{{"}}.PodName{{"}}"}}-{{"{{"}}.Timestamp{{"}}"}}.tar". The variables
+# PodName, ContainerName, ContainerID and Timestamp are available. If the list
+# is empty, templated locations are rejected and other locations are not
+# restricted.
+{{ $.Comment }}checkpoint_location_allowlist = [
+{{ range $dir := .CheckpointLocationAllowlist }}{{ $.Comment }}{{ printf "\t%q,\n" $dir }}{{ end }}{{ $.Comment }}]
+
+`
+
+const templateStringCrioRuntimeCheckpointDir = `# Directory relative checkpoint locations are resolved against. It has to be
+# in checkpoint_location_allowlist, unless the list is empty. The oldest
+# checkpoint archives in it are removed periodically once
+# checkpoint_dir_max_count or checkpoint_dir_max_size is exceeded.
+{{ $.Comment }}checkpoint_dir = "{{ .CheckpointDir }}"
+
+`
+
+const templateStringCrioRuntimeCheckpointDirMaxCount = `# Maximum number of checkpoint archives kept in checkpoint_dir. Unlimited if 0.
+{{ $.Comment }}checkpoint_dir_max_count = {{ .CheckpointDirMaxCount }}
+
+`
+
+const templateStringCrioRuntimeCheckpointDirMaxSize = `# Maximum size in bytes of the checkpoint archives kept in checkpoint_dir.
+# Unlimited if 0.
+{{ $.Comment }}checkpoint_dir_max_size = {{ .CheckpointDirMaxSize }}
+
+`
+
+const templateStringCrioRuntimeCheckpointTmpfsMaxSize = `# Maximum size in bytes of the contents of each tmpfs mount of a container
+# included in its checkpoint archive. The contents are not included if 0, which
+# is logged on restore. Checkpoints of tmpfs mounts holding more fail.
+{{ $.Comment }}checkpoint_tmpfs_max_size = {{ .CheckpointTmpfsMaxSize }}
+
+`
+
+const templateStringCrioRuntimeCheckpointGhostLimit = `# Maximum size in bytes of files deleted while still open which CRIU includes in
+# checkpoints. Their contents are copied into the checkpoint archive. CRIU's
+# default limit applies if 0. The "checkpoint-ghost-limit" gRPC metadata of
+# CheckpointContainer overrides it for a checkpoint.
+{{ $.Comment }}checkpoint_ghost_limit = {{ .CheckpointGhostLimit }}
+
+`
+
+const templateStringCrioRuntimeCheckpointS3Endpoint = `# URL of the S3-compatible object store checkpoint locations like
+# "s3://bucket/key" are written to and restored from, addressing buckets by
+# path. Such locations are rejected if empty. checkpoint_location_allowlist
+# restricts them by entries like "s3://bucket/prefix".
+{{ $.Comment }}checkpoint_s3_endpoint = "{{ .CheckpointS3Endpoint }}"
+
+`
+
+const templateStringCrioRuntimeCheckpointS3Region = `# Region requests to checkpoint_s3_endpoint are signed for.
+{{ $.Comment }}checkpoint_s3_region = "{{ .CheckpointS3Region }}"
+
+`
+
+const templateStringCrioRuntimeCheckpointS3CredentialsFile = `# Path of the file holding the credentials for checkpoint_s3_endpoint, in the
+# format of the AWS shared credentials file. The "default" profile is used,
+# the file is read for every checkpoint and restore. Requests are not signed
+# if empty.
+{{ $.Comment }}checkpoint_s3_credentials_file = "{{ .CheckpointS3CredentialsFile }}"
+
+`
+
+const templateStringCrioRuntimeCheckpointVerifyMaxConcurrent = `# Maximum number of checkpoint archives verified by a test restore at the same
+# time. Clients request the verification with the "checkpoint-verify: true"
+# gRPC metadata of CheckpointContainer. Disabled if 0.
+{{ $.Comment }}checkpoint_verify_max_concurrent = {{ .CheckpointVerifyMaxConcurrent }}
+
+`
+
+const templateStringCrioRuntimeCheckpointFailureThreshold = `# Number of consecutive failed checkpoints of a container within
+# checkpoint_failure_window after which further checkpoints of it are
+# rejected with "Unavailable" until the window expires. Checkpoints are never
+# rejected if 0.
+{{ $.Comment }}checkpoint_failure_threshold = {{ .CheckpointFailureThreshold }}
+
+`
+
+const templateStringCrioRuntimeCheckpointFailureWindow = `# Time in seconds within which failed checkpoints of a container are counted,
+# and for which its checkpoints are rejected once checkpoint_failure_threshold
+# has been reached.
+{{ $.Comment }}checkpoint_failure_window = {{ .CheckpointFailureWindow }}
+
+`
+
+const templateStringCrioRuntimeCheckpointStagingTTL = `# Time in seconds a checkpoint archive staged ahead of its restore through the
+# inspect API is kept extracted, before the staged data is removed. Staging is
+# disabled if 0.
+{{ $.Comment }}checkpoint_staging_ttl = {{ .CheckpointStagingTTL }}
+
+`
+
+const templateStringCrioRuntimeCheckpointActionScripts = `# Executables CRIU runs at the phases of checkpointing and restoring containers,
+# like pre-dump and post-restore. The phase is passed as CRTOOLS_SCRIPT_ACTION,
+# the container as CRIO_CONTAINER_ID, CRIO_CONTAINER_NAME and CRIO_SANDBOX_ID.
+# A failing script fails the checkpoint or restore. The scripts replace the
+# default CRIU configuration file of the runtime, like /etc/criu/runc.conf.
+{{ $.Comment }}checkpoint_action_scripts = [
+{{ range $script := .CheckpointActionScripts }}{{ $.Comment }}{{ printf "\t%q,\n" $script }}{{ end }}{{ $.Comment }}]
+
+`
+
+const templateStringCrioRuntimeCheckpointRestoreIPMismatch = `# Handling of a restore into a sandbox which does not have the IPs of the
+# checkpointed sandbox:
+# - "fail": fail the restore.
+# - "tcp-close": restore connected TCP sockets in closed state.
+# - "secondary-ip": add the checkpointed IPs as secondary addresses to the
+#   interfaces of the sandbox whose subnets contain them, falling back to
+#   "tcp-close" if the CNI result of the sandbox has no such interface.
+# Can be overridden per container with the annotation
+# "io.kubernetes.cri-o.annotations.checkpoint.ipMismatch".
+{{ $.Comment }}checkpoint_restore_ip_mismatch = "{{ .CheckpointRestoreIPMismatch }}"
+
+`
+
+const templateStringCrioRuntimeCrashDumpDir = `# Directory for forensic checkpoints of containers annotated with
+# "io.kubernetes.cri-o.CheckpointOnOOM" which are taken when the container
+# hits its memory.high threshold or an OOM event, or when one of its processes
+# is killed by a fatal signal. Disabled if empty.
+{{ $.Comment }}crash_dump_dir = "{{ .CrashDumpDir }}"
+
+`
+
+const templateStringCrioRuntimeCrashDumpInterval = `# Minimum number of seconds between two crash dumps of the same container.
+{{ $.Comment }}crash_dump_interval = {{ .CrashDumpInterval }}
+
+`
+
 const templateStringCrioRuntimeEnablePodEvents = `# Enable/disable the generation of the container,
 # sandbox lifecycle events to be sent to the Kubelet to optimize the PLEG
 {{ $.Comment }}enable_pod_events = {{ .EnablePodEvents }}
@@ -1272,6 +1668,8 @@ const templateStringCrioRuntimeRuntimesRuntimeHandler = `# The "crio.runtime.run
 #     For images, the plain annotation "seccomp-profile.kubernetes.cri-o.io"
 #     can be used without the required "/POD" suffix or a container name.
 #   "io.kubernetes.cri-o.DisableFIPS" for disabling FIPS mode in a Kubernetes pod within a FIPS-enabled cluster.
+#   "io.kubernetes.cri-o.CheckpointOnOOM" for writing a forensic checkpoint to crash_dump_dir when the container is about to run out of memory.
+#   "io.kubernetes.cri-o.CheckpointTimeNamespace" for preserving the monotonic and boot time clocks of a container across checkpoint and restore.
 # - monitor_path (optional, string): The path of the monitor binary. Replaces
 #   deprecated option "conmon".
 # - monitor_cgroup (optional, string): The cgroup the container monitor process will be put in.
@@ -1,46 +1,379 @@
 package server
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"time"
 
 	metadata "github.com/checkpoint-restore/checkpointctl/lib"
-	"golang.org/x/net/context"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	types "k8s.io/cri-api/pkg/apis/runtime/v1"
 
 	"github.com/cri-o/cri-o/internal/lib"
 	"github.com/cri-o/cri-o/internal/log"
+	"github.com/cri-o/cri-o/internal/oci"
+	"github.com/cri-o/cri-o/internal/resourcestore"
+	"github.com/cri-o/cri-o/pkg/annotations"
 )
 
 // CheckpointContainer checkpoints a container.
 func (s *Server) CheckpointContainer(ctx context.Context, req *types.CheckpointContainerRequest) (*types.CheckpointContainerResponse, error) {
-	if !s.config.RuntimeConfig.CheckpointRestore() {
-		return nil, errors.New("checkpoint/restore support not available")
+	if err := s.checkCheckpointRestoreEnabled(); err != nil {
+		return nil, err
 	}
 
-	_, err := s.GetContainerFromShortID(ctx, req.ContainerId)
+	ctr, err := s.resolveContainer(ctx, req.ContainerId)
 	if err != nil {
-		return nil, status.Errorf(codes.NotFound, "could not find container %q: %v", req.ContainerId, err)
+		return nil, err
+	}
+	if err := s.checkCheckpointBreaker(ctr.ID()); err != nil {
+		return nil, err
 	}
 
-	log.Infof(ctx, "Checkpointing container: %s", req.ContainerId)
+	log.Infof(ctx, "Checkpointing container: %s", ctr.ID())
 	config := &metadata.ContainerConfig{
-		ID: req.ContainerId,
+		ID: ctr.ID(),
 	}
-	opts := &lib.ContainerCheckpointOptions{
-		TargetFile: req.Location,
-		// For the forensic container checkpointing use case we
-		// keep the container running after checkpointing it.
-		KeepRunning: true,
+	opts, err := s.checkpointArchiveOptions(ctr, req.Location)
+	if err != nil {
+		return nil, checkpointStatusError(err)
+	}
+	// For the forensic container checkpointing use case we
+	// keep the container running after checkpointing it.
+	opts.KeepRunning = true
+	if limit, ok, err := checkpointGhostLimitRequested(ctx); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	} else if ok {
+		opts.GhostLimit = limit
 	}
 
-	_, err = s.ContainerServer.ContainerCheckpoint(ctx, config, opts)
+	// The location is expanded by the attempt writing the checkpoint, so
+	// that retries of a templated location return the same archive.
+	target, err := s.checkpointOnce(ctx, ctr.ID(), req.Location, func() (string, error) {
+		target, err := s.expandCheckpointLocation(req.Location, s.newCheckpointLocationVars(ctx, ctr, time.Now()))
+		if err != nil {
+			return "", err
+		}
+		opts.TargetFile = target
+		op := s.startCheckpointOperation(ctx, ctr.ID(), target)
+		checkpointCtx, done, err := s.checkpointContext(ctx, ctr.ID(), true)
+		if err != nil {
+			op.finish(err)
+			return "", err
+		}
+		defer done()
+		opts.Progress = op.progress
+		_, err = s.ContainerServer.ContainerCheckpoint(checkpointCtx, config, opts)
+		s.recordCheckpointResult(ctx, ctr.ID(), err)
+		op.finish(err)
+		return target, err
+	})
 	if err != nil {
-		return nil, err
+		return nil, checkpointStatusError(err)
 	}
+	setCheckpointLocationHeader(ctx, target)
+
+	log.Infof(ctx, "Checkpointed container %s to %s", ctr.ID(), target)
 
-	log.Infof(ctx, "Checkpointed container: %s", req.ContainerId)
+	if checkpointVerifyRequested(ctx) {
+		s.verifyCheckpoint(ctx, ctr, target)
+	}
 
 	return &types.CheckpointContainerResponse{}, nil
 }
+
+// checkpointStatusError maps an error of checkpointing or restoring a
+// container to a gRPC status, so that clients can branch on the class of
+// the failure. Errors which already carry a status and errors of unknown
+// class are returned unchanged.
+func checkpointStatusError(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	var code codes.Code
+	switch {
+	case errors.Is(err, oci.ErrCheckpointRestoreUnsupported),
+		errors.Is(err, lib.ErrCheckpointUnsupportedFeature),
+		errors.Is(err, lib.ErrFreezerUnavailable):
+		code = codes.Unimplemented
+	case errors.Is(err, lib.ErrCheckpointArchiveExists):
+		code = codes.AlreadyExists
+	case errors.Is(err, lib.ErrCorruptCheckpointMetadata),
+		errors.Is(err, lib.ErrInvalidOCICheckpointArchive),
+		errors.Is(err, errInvalidCheckpointLocation):
+		code = codes.InvalidArgument
+	case errors.Is(err, errCheckpointLocationNotAllowed):
+		code = codes.PermissionDenied
+	case errors.Is(err, lib.ErrCheckpointPrecondition),
+		errors.Is(err, lib.ErrDiagnosticCheckpoint),
+		errors.Is(err, lib.ErrCheckpointFormatTooNew),
+		errors.Is(err, lib.ErrCheckpointCriuTooOld),
+		errors.Is(err, lib.ErrIncompatibleCheckpointParent),
+		errors.Is(err, errCheckpointBaseImageMismatch),
+		errors.Is(err, errCheckpointMountNotRemapped),
+		errors.Is(err, errCheckpointMountRemapUnknown),
+		errors.Is(err, errCheckpointMemoryLimitTooLow),
+		errors.Is(err, lib.ErrRestoreSpecMismatch),
+		errors.Is(err, oci.ErrCheckpointProcessTree),
+		errors.Is(err, lib.ErrIncompatibleCgroupMode),
+		errors.Is(err, lib.ErrReadOnlyRootfsRestore),
+		errors.Is(err, errCheckpointSandboxIPChanged):
+		code = codes.FailedPrecondition
+	case errors.Is(err, errCheckpointInProgress):
+		code = codes.Aborted
+	case errors.Is(err, lib.ErrCriuFailed):
+		code = codes.Internal
+	case errors.Is(err, context.Canceled):
+		code = codes.Canceled
+	case errors.Is(err, context.DeadlineExceeded):
+		code = codes.DeadlineExceeded
+	default:
+		return err
+	}
+	return status.Error(code, err.Error())
+}
+
+// checkpointArchiveOptions returns the checkpoint options for writing an
+// archive of ctr to location as configured for the runtime and the container.
+// The CheckpointContainerRequest of the CRI has no field to request replacing
+// an existing archive, so Overwrite follows checkpoint_archive_overwrite for
+// every request, while callers of ContainerCheckpoint set it per call.
+func (s *Server) checkpointArchiveOptions(ctr *oci.Container, location string) (*lib.ContainerCheckpointOptions, error) {
+	archiveMode, err := s.config.RuntimeConfig.CheckpointArchiveFileMode()
+	if err != nil {
+		return nil, fmt.Errorf("invalid checkpoint archive mode: %w", err)
+	}
+	opts := &lib.ContainerCheckpointOptions{
+		TargetFile:          location,
+		ArchiveFileMode:     archiveMode,
+		ArchiveSELinuxLabel: s.config.RuntimeConfig.CheckpointArchiveSELinuxLabel,
+		Overwrite:           s.config.RuntimeConfig.CheckpointArchiveOverwrite,
+		ArchivePartSize:     s.config.RuntimeConfig.CheckpointArchivePartSize,
+		DeviceBlocklist:     s.config.RuntimeConfig.CheckpointDeviceBlocklist,
+		TmpfsMaxSize:        s.config.RuntimeConfig.CheckpointTmpfsMaxSize,
+		GhostLimit:          s.config.RuntimeConfig.CheckpointGhostLimit,
+		ArchiveFormat:       s.config.RuntimeConfig.CheckpointArchiveFormat,
+		DiagnosticOnly:      ctr.Annotations()[annotations.CheckpointAnnotationDiagnosticOnly] == "true",
+	}
+	if uid := s.config.RuntimeConfig.CheckpointArchiveUID; uid != -1 {
+		opts.ArchiveUID = &uid
+	}
+	if gid := s.config.RuntimeConfig.CheckpointArchiveGID; gid != -1 {
+		opts.ArchiveGID = &gid
+	}
+	return opts, nil
+}
+
+// checkpointResult is the ResourceStore entry recorded for a completed
+// checkpoint. Its ID is the location the checkpoint was written to, which
+// differs from the requested location if it has template variables.
+type checkpointResult struct {
+	location string
+}
+
+func (r *checkpointResult) ID() string {
+	return r.location
+}
+
+func (r *checkpointResult) SetCreated() {}
+
+// checkpointResourceName returns the ResourceStore name used as idempotency
+// key for checkpointing the container ctrID to the requested location.
+func checkpointResourceName(ctrID, location string) string {
+	return "checkpoint/" + ctrID + "/" + location
+}
+
+// checkpointOnce runs checkpoint unless a checkpoint of the same container to
+// the same location is already in flight or has recently completed, and
+// returns the location the checkpoint has been written to, as returned by
+// checkpoint.
+// The kubelet retries CheckpointContainer on deadline, so a retry waits for
+// an in-flight attempt instead of dumping a second time, and a retry arriving
+// after completion (within the ResourceStore staleness window) succeeds
+// immediately. The completed checkpoint stays recorded for the whole window,
+// so that every retry observes it, while a failed attempt is reported to all
+// waiting retries and is not recorded.
+func (s *Server) checkpointOnce(ctx context.Context, ctrID, location string, checkpoint func() (string, error)) (string, error) {
+	name := checkpointResourceName(ctrID, location)
+	if target, ok := s.completedCheckpoint(ctx, ctrID, name); ok {
+		return target, nil
+	}
+
+	watcher, stage := s.containerStore.WatcherForResourceWithContext(ctx, resourcestore.DefaultNamespace, name)
+	if stage != resourcestore.StageUnknown {
+		// The checkpoint may have completed between the Peek above and
+		// registering the watcher, in which case the watcher never fires.
+		if target, ok := s.completedCheckpoint(ctx, ctrID, name); ok {
+			return target, nil
+		}
+		log.Infof(ctx, "Checkpoint of container %s to %q already in progress at stage %v, waiting for it to finish", ctrID, location, stage)
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("waiting for in-flight checkpoint of container %s: %w", ctrID, ctx.Err())
+		case err := <-watcher:
+			if err != nil {
+				return "", fmt.Errorf("in-flight checkpoint of container %s failed: %w", ctrID, err)
+			}
+			if target, ok := s.completedCheckpoint(ctx, ctrID, name); ok {
+				return target, nil
+			}
+			return location, nil
+		}
+	}
+
+	s.containerStore.SetStageForResource(ctx, resourcestore.DefaultNamespace, name, "container checkpointing")
+	target, err := checkpoint()
+	if err != nil {
+		s.containerStore.Fail(resourcestore.DefaultNamespace, name, err)
+		return "", err
+	}
+	if err := s.containerStore.Put(resourcestore.DefaultNamespace, name, &checkpointResult{location: target}, resourcestore.NewResourceCleaner()); err != nil {
+		log.Warnf(ctx, "Unable to record checkpoint of container %s: %v", ctrID, err)
+	}
+	return target, nil
+}
+
+// completedCheckpoint returns the location of the checkpoint of the
+// container ctrID recorded as name in the ResourceStore, and true if it has
+// already been written.
+func (s *Server) completedCheckpoint(ctx context.Context, ctrID, name string) (string, bool) {
+	resource, ok := s.containerStore.PeekResource(resourcestore.DefaultNamespace, name)
+	if !ok {
+		return "", false
+	}
+	result, ok := resource.(*checkpointResult)
+	if !ok {
+		return "", false
+	}
+	log.Infof(ctx, "Checkpoint of container %s to %q already completed, not checkpointing again", ctrID, result.location)
+	return result.location, true
+}
+
+// checkpointCancel is the handle to abort the in-flight checkpoint of a
+// container.
+type checkpointCancel struct {
+	cancel context.CancelFunc
+}
+
+// errCheckpointInProgress is returned if another checkpoint of the same
+// container is running and the caller does not want to wait for it.
+var errCheckpointInProgress = errors.New("checkpoint of container already in progress")
+
+// acquireCheckpointSlot takes the slot of the container ctrID, which is held
+// by its checkpoints and restores, as well as its stop and removal, so that
+// none of them run at the same time. If wait is set, the call blocks until
+// the slot is free, otherwise it fails with errCheckpointInProgress. The
+// returned function releases the slot.
+func (s *Server) acquireCheckpointSlot(ctx context.Context, ctrID string, wait bool) (func(), error) {
+	value, _ := s.checkpointSlots.LoadOrStore(ctrID, make(chan struct{}, 1))
+	slot, ok := value.(chan struct{})
+	if !ok {
+		return nil, fmt.Errorf("invalid checkpoint slot for container %s", ctrID)
+	}
+	if wait {
+		select {
+		case slot <- struct{}{}:
+		case <-ctx.Done():
+			return nil, fmt.Errorf("waiting for running checkpoint of container %s: %w", ctrID, ctx.Err())
+		}
+	} else {
+		select {
+		case slot <- struct{}{}:
+		default:
+			return nil, fmt.Errorf("%w: %s", errCheckpointInProgress, ctrID)
+		}
+	}
+	return func() { <-slot }, nil
+}
+
+// waitingForCheckpointSlot is called when a stop or removal of the container
+// ctrID has to wait for its checkpoint or restore. Tests replace it to drive
+// the interleaving.
+var waitingForCheckpointSlot = func(ctx context.Context, ctrID string) {}
+
+// holdCheckpointSlot takes the slot of the container ctrID for the operation,
+// a stop or removal of the container, which must not run while the container
+// is checkpointed or restored. An in-flight checkpoint or restore is waited
+// for until ctx is done. The checkpoint is then aborted, so that a retry of
+// the operation does not have to wait for it again, and the operation fails.
+func (s *Server) holdCheckpointSlot(ctx context.Context, ctrID, operation string) (func(), error) {
+	if release, err := s.acquireCheckpointSlot(ctx, ctrID, false); err == nil {
+		return release, nil
+	}
+	log.Infof(ctx, "Waiting for the checkpoint or restore of container %s to finish before its %s", ctrID, operation)
+	waitingForCheckpointSlot(ctx, ctrID)
+	release, err := s.acquireCheckpointSlot(ctx, ctrID, true)
+	if err != nil {
+		if s.cancelCheckpoint(ctrID) {
+			log.Warnf(ctx, "Aborted the checkpoint of container %s for its %s", ctrID, operation)
+		}
+		return nil, status.Errorf(status.FromContextError(ctx.Err()).Code(), "%s of container %s: %v", operation, ctrID, err)
+	}
+	return release, nil
+}
+
+// checkpointContext returns the context for checkpointing the container ctrID
+// and a function to release it once the checkpoint is done.
+// Only one checkpoint of a container runs at a time, see
+// acquireCheckpointSlot. If wait is set, the call blocks until a running
+// checkpoint is done, otherwise it fails with errCheckpointInProgress.
+// The context does not inherit the deadline of ctx, as a request retried by
+// the kubelet waits for the in-flight checkpoint (see checkpointOnce). It is
+// cancelled if the client cancels ctx or if CancelCheckpoint is called.
+func (s *Server) checkpointContext(ctx context.Context, ctrID string, wait bool) (context.Context, func(), error) {
+	release, err := s.acquireCheckpointSlot(ctx, ctrID, wait)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	checkpointCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	entry := &checkpointCancel{cancel: cancel}
+	s.checkpointCancels.Store(ctrID, entry)
+	stop := context.AfterFunc(ctx, func() {
+		if errors.Is(ctx.Err(), context.Canceled) {
+			cancel()
+		}
+	})
+	return checkpointCtx, func() {
+		stop()
+		s.checkpointCancels.CompareAndDelete(ctrID, entry)
+		cancel()
+		release()
+	}, nil
+}
+
+// forgetCheckpoints drops the checkpoint bookkeeping of a removed container.
+func (s *Server) forgetCheckpoints(ctrID string) {
+	s.checkpointSlots.Delete(ctrID)
+	s.checkpointBreakers.reset(ctrID)
+}
+
+// CancelCheckpoint aborts the in-flight checkpoint of a container. The
+// checkpointing process is killed and the container keeps running.
+func (s *Server) CancelCheckpoint(ctx context.Context, containerID string) error {
+	if err := s.checkCheckpointRestoreEnabled(); err != nil {
+		return err
+	}
+	ctr, err := s.resolveContainer(ctx, containerID)
+	if err != nil {
+		return err
+	}
+	if !s.cancelCheckpoint(ctr.ID()) {
+		return status.Errorf(codes.FailedPrecondition, "no checkpoint of container %s in progress", ctr.ID())
+	}
+	log.Infof(ctx, "Cancelled checkpoint of container %s", ctr.ID())
+	return nil
+}
+
+// cancelCheckpoint cancels the in-flight checkpoint of the container ctrID.
+// It returns false if there is none.
+func (s *Server) cancelCheckpoint(ctrID string) bool {
+	entry, ok := s.checkpointCancels.Load(ctrID)
+	if !ok {
+		return false
+	}
+	entry.(*checkpointCancel).cancel()
+	return true
+}
@@ -0,0 +1,191 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/cri-o/cri-o/internal/log"
+)
+
+// checkpointBreaker is the failure history of the checkpoints of a
+// container.
+type checkpointBreaker struct {
+	// failures are the times of the consecutive failed checkpoints within
+	// the failure window, lastErr the cause of the last one.
+	failures []time.Time
+	lastErr  string
+	// rejectedUntil is the time until which checkpoints of the container
+	// are rejected, it is zero while they are accepted.
+	rejectedUntil time.Time
+}
+
+// checkpointBreakers are the circuit breakers of the checkpoints of the
+// containers by their ID, see checkpoint_failure_threshold.
+type checkpointBreakers struct {
+	mutex    sync.Mutex
+	breakers map[string]*checkpointBreaker
+}
+
+// checkpointFailureInfo is the failure history of the checkpoints of a
+// container in its verbose status.
+type checkpointFailureInfo struct {
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	LastError           string     `json:"lastError,omitempty"`
+	RejectedUntil       *time.Time `json:"rejectedUntil,omitempty"`
+}
+
+// check returns the breaker of the container ctrID and the time left until
+// its checkpoints are accepted again, if they are rejected at now. A breaker
+// whose rejection expired is closed, and its failures are forgotten.
+func (b *checkpointBreakers) check(ctrID string, now time.Time) (breaker checkpointBreaker, retryAfter time.Duration, rejected bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	entry, ok := b.breakers[ctrID]
+	if !ok || entry.rejectedUntil.IsZero() {
+		return checkpointBreaker{}, 0, false
+	}
+	if !now.Before(entry.rejectedUntil) {
+		delete(b.breakers, ctrID)
+		return checkpointBreaker{}, 0, false
+	}
+	return *entry, entry.rejectedUntil.Sub(now), true
+}
+
+// record adds the outcome of a checkpoint of the container ctrID at now to
+// its history. A success forgets the failures, a failure rejects further
+// checkpoints for the window once threshold failures happened within it.
+// It returns whether the failure started rejecting checkpoints.
+func (b *checkpointBreakers) record(ctrID string, checkpointErr error, now time.Time, threshold int, window time.Duration) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if checkpointErr == nil {
+		delete(b.breakers, ctrID)
+		return false
+	}
+	if b.breakers == nil {
+		b.breakers = make(map[string]*checkpointBreaker)
+	}
+	entry, ok := b.breakers[ctrID]
+	if !ok {
+		entry = &checkpointBreaker{}
+		b.breakers[ctrID] = entry
+	}
+	recent := entry.failures[:0]
+	for _, failure := range entry.failures {
+		if now.Sub(failure) < window {
+			recent = append(recent, failure)
+		}
+	}
+	entry.failures = append(recent, now)
+	entry.lastErr = checkpointErr.Error()
+	if len(entry.failures) < threshold || !entry.rejectedUntil.IsZero() {
+		return false
+	}
+	entry.rejectedUntil = now.Add(window)
+	return true
+}
+
+// reset forgets the failures of the container ctrID and accepts its
+// checkpoints again.
+func (b *checkpointBreakers) reset(ctrID string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	delete(b.breakers, ctrID)
+}
+
+// info returns the failure history of the checkpoints of the container
+// ctrID at now for its verbose status, or nil if there is none.
+func (b *checkpointBreakers) info(ctrID string, now time.Time) *checkpointFailureInfo {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	entry, ok := b.breakers[ctrID]
+	if !ok {
+		return nil
+	}
+	info := &checkpointFailureInfo{
+		ConsecutiveFailures: len(entry.failures),
+		LastError:           entry.lastErr,
+	}
+	if !entry.rejectedUntil.IsZero() && now.Before(entry.rejectedUntil) {
+		rejectedUntil := entry.rejectedUntil
+		info.RejectedUntil = &rejectedUntil
+	}
+	return info
+}
+
+// checkpointFailureWindow returns the window of checkpoint_failure_window.
+func (s *Server) checkpointFailureWindow() time.Duration {
+	return time.Duration(s.config.CheckpointFailureWindow) * time.Second
+}
+
+// checkCheckpointBreaker fails with Unavailable if checkpoints of the
+// container ctrID are rejected after repeated failures. The error carries
+// the time left until they are accepted again as RetryInfo.
+func (s *Server) checkCheckpointBreaker(ctrID string) error {
+	breaker, retryAfter, rejected := s.checkpointBreakers.check(ctrID, time.Now())
+	if !rejected {
+		return nil
+	}
+	retryAfter = time.Duration(math.Ceil(retryAfter.Seconds())) * time.Second
+	st := status.Newf(
+		codes.Unavailable,
+		"checkpoints of container %s are rejected after %d consecutive failures, retry after %v: %s",
+		ctrID, len(breaker.failures), retryAfter, breaker.lastErr,
+	)
+	if detailed, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(retryAfter)}); err == nil {
+		st = detailed
+	}
+	return st.Err()
+}
+
+// recordCheckpointResult adds the outcome of a checkpoint of the container
+// ctrID to its failure history, unless checkpoint_failure_threshold is 0.
+// Cancelled checkpoints are not counted as failures.
+func (s *Server) recordCheckpointResult(ctx context.Context, ctrID string, checkpointErr error) {
+	threshold := s.config.CheckpointFailureThreshold
+	if threshold <= 0 || errors.Is(checkpointErr, context.Canceled) {
+		return
+	}
+	window := s.checkpointFailureWindow()
+	if s.checkpointBreakers.record(ctrID, checkpointErr, time.Now(), threshold, window) {
+		log.Warnf(ctx, "Rejecting checkpoints of container %s for %v after %d consecutive failures", ctrID, window, threshold)
+	}
+}
+
+// ResetCheckpointBreaker forgets the failed checkpoints of a container, so
+// that its checkpoints are accepted again.
+func (s *Server) ResetCheckpointBreaker(ctx context.Context, containerID string) error {
+	if err := s.checkCheckpointRestoreEnabled(); err != nil {
+		return err
+	}
+	ctr, err := s.resolveContainer(ctx, containerID)
+	if err != nil {
+		return err
+	}
+	s.checkpointBreakers.reset(ctr.ID())
+	log.Infof(ctx, "Reset the checkpoint failures of container %s", ctr.ID())
+	return nil
+}
+
+// checkpointRetryAfter returns the retry delay of an error returned by
+// checkCheckpointBreaker.
+func checkpointRetryAfter(err error) (time.Duration, bool) {
+	st, ok := status.FromError(err)
+	if !ok {
+		return 0, false
+	}
+	for _, detail := range st.Details() {
+		if retryInfo, ok := detail.(*errdetails.RetryInfo); ok {
+			return retryInfo.GetRetryDelay().AsDuration(), true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var _ = Describe("CheckpointBreaker", func() {
+	var (
+		breakers *checkpointBreakers
+		now      time.Time
+	)
+	failure := errors.New("criu failed")
+
+	BeforeEach(func() {
+		breakers = &checkpointBreakers{}
+		now = time.Now()
+	})
+
+	It("should not count failures outside of the window", func() {
+		// Given
+		breakers.record("ctr", failure, now, 3, time.Minute)
+		breakers.record("ctr", failure, now.Add(2*time.Minute), 3, time.Minute)
+
+		// When
+		opened := breakers.record("ctr", failure, now.Add(2*time.Minute+time.Second), 3, time.Minute)
+
+		// Then
+		Expect(opened).To(BeFalse())
+		info := breakers.info("ctr", now)
+		Expect(info).ToNot(BeNil())
+		Expect(info.ConsecutiveFailures).To(Equal(2))
+		Expect(info.RejectedUntil).To(BeNil())
+	})
+
+	It("should reset the failures on success", func() {
+		// Given
+		breakers.record("ctr", failure, now, 3, time.Minute)
+
+		// When
+		breakers.record("ctr", nil, now, 3, time.Minute)
+
+		// Then
+		Expect(breakers.info("ctr", now)).To(BeNil())
+	})
+
+	It("should reject checkpoints within the window once the threshold is reached", func() {
+		// Given
+		for i := range 2 {
+			breakers.record("ctr", failure, now.Add(time.Duration(i)*time.Second), 3, time.Minute)
+		}
+		_, _, rejected := breakers.check("ctr", now.Add(2*time.Second))
+		Expect(rejected).To(BeFalse())
+
+		// When
+		opened := breakers.record("ctr", failure, now.Add(2*time.Second), 3, time.Minute)
+
+		// Then
+		Expect(opened).To(BeTrue())
+		breaker, retryAfter, rejected := breakers.check("ctr", now.Add(12*time.Second))
+		Expect(rejected).To(BeTrue())
+		Expect(retryAfter).To(Equal(50 * time.Second))
+		Expect(breaker.failures).To(HaveLen(3))
+		Expect(breaker.lastErr).To(Equal(failure.Error()))
+		info := breakers.info("ctr", now.Add(12*time.Second))
+		Expect(info).ToNot(BeNil())
+		Expect(info.RejectedUntil).ToNot(BeNil())
+
+		// Checkpoints are accepted again once the window expired.
+		_, _, rejected = breakers.check("ctr", now.Add(62*time.Second))
+		Expect(rejected).To(BeFalse())
+		Expect(breakers.info("ctr", now.Add(62*time.Second))).To(BeNil())
+	})
+
+	It("should accept checkpoints after a reset", func() {
+		// Given
+		breakers.record("ctr", failure, now, 1, time.Minute)
+		_, _, rejected := breakers.check("ctr", now)
+		Expect(rejected).To(BeTrue())
+
+		// When
+		breakers.reset("ctr")
+
+		// Then
+		_, _, rejected = breakers.check("ctr", now)
+		Expect(rejected).To(BeFalse())
+	})
+
+	It("should reject checkpoints of the failing container", func() {
+		// Given
+		s := &Server{}
+		s.config.CheckpointFailureThreshold = 2
+		s.config.CheckpointFailureWindow = 60
+		s.recordCheckpointResult(context.Background(), "ctr", context.Canceled)
+		s.recordCheckpointResult(context.Background(), "ctr", failure)
+		// Cancelled checkpoints are not counted.
+		Expect(s.checkCheckpointBreaker("ctr")).To(Succeed())
+
+		// When
+		s.recordCheckpointResult(context.Background(), "ctr", failure)
+
+		// Then
+		err := s.checkCheckpointBreaker("ctr")
+		Expect(status.Code(err)).To(Equal(codes.Unavailable))
+		retryAfter, ok := checkpointRetryAfter(err)
+		Expect(ok).To(BeTrue())
+		Expect(retryAfter).To(Equal(time.Minute))
+		Expect(s.checkCheckpointBreaker("other")).To(Succeed())
+	})
+})
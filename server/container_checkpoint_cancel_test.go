@@ -0,0 +1,206 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	types "k8s.io/cri-api/pkg/apis/runtime/v1"
+
+	"github.com/cri-o/cri-o/internal/oci"
+	"github.com/cri-o/cri-o/pkg/annotations"
+)
+
+// holdCheckpointSlotAsync runs holdCheckpointSlot for the removal of the
+// container "ctr" and returns the channel its result is sent to.
+func holdCheckpointSlotAsync(ctx context.Context, s *Server) chan error {
+	result := make(chan error, 1)
+	go func() {
+		release, err := s.holdCheckpointSlot(ctx, "ctr", "removal")
+		if err == nil {
+			defer release()
+			// The removal holds the slot, no checkpoint can start.
+			if _, _, err := s.checkpointContext(context.Background(), "ctr", false); !errors.Is(err, errCheckpointInProgress) {
+				result <- fmt.Errorf("expected checkpoint to be rejected during removal, got %w", err)
+				return
+			}
+		}
+		result <- err
+	}()
+	return result
+}
+
+// injectCheckpointSlotWait replaces waitingForCheckpointSlot by hook for the
+// spec.
+func injectCheckpointSlotWait(hook func(context.Context, string)) {
+	previous := waitingForCheckpointSlot
+	waitingForCheckpointSlot = hook
+	DeferCleanup(func() { waitingForCheckpointSlot = previous })
+}
+
+var _ = Describe("ContainerCheckpointCancel", func() {
+	var s *Server
+
+	BeforeEach(func() {
+		s = &Server{}
+	})
+
+	It("should cancel a running checkpoint", func() {
+		// Given
+		Expect(s.cancelCheckpoint("ctr")).To(BeFalse())
+		ctx, done, err := s.checkpointContext(context.Background(), "ctr", true)
+		Expect(err).ToNot(HaveOccurred())
+
+		// When
+		cancelled := s.cancelCheckpoint("ctr")
+
+		// Then
+		Expect(cancelled).To(BeTrue())
+		Expect(ctx.Err()).To(MatchError(context.Canceled))
+		done()
+		Expect(s.cancelCheckpoint("ctr")).To(BeFalse())
+	})
+
+	It("should continue the checkpoint after the request deadline", func() {
+		// Given
+		// The kubelet retries the request and waits for the result.
+		reqCtx, cancelReq := context.WithTimeout(context.Background(), time.Millisecond)
+		DeferCleanup(cancelReq)
+
+		// When
+		ctx, done, err := s.checkpointContext(reqCtx, "ctr", true)
+		Expect(err).ToNot(HaveOccurred())
+		DeferCleanup(done)
+
+		// Then
+		Eventually(reqCtx.Done()).Should(BeClosed())
+		Consistently(ctx.Done()).WithTimeout(10 * time.Millisecond).ShouldNot(BeClosed())
+	})
+
+	It("should abort the checkpoint if the request is cancelled", func() {
+		// Given
+		reqCtx, cancelReq := context.WithCancel(context.Background())
+		ctx, done, err := s.checkpointContext(reqCtx, "ctr", true)
+		Expect(err).ToNot(HaveOccurred())
+		DeferCleanup(done)
+
+		// When
+		cancelReq()
+
+		// Then
+		Eventually(ctx.Done()).WithTimeout(time.Second).Should(BeClosed())
+	})
+
+	It("should serialize the checkpoints of a container", func() {
+		// Given
+		_, done, err := s.checkpointContext(context.Background(), "ctr", true)
+		Expect(err).ToNot(HaveOccurred())
+
+		// A crash dump does not wait for a running checkpoint.
+		Expect(s.checkpointContext(context.Background(), "ctr", false)).Error().To(MatchError(errCheckpointInProgress))
+
+		// When
+		acquired := make(chan func(), 1)
+		go func() {
+			defer GinkgoRecover()
+			_, secondDone, err := s.checkpointContext(context.Background(), "ctr", true)
+			Expect(err).ToNot(HaveOccurred())
+			acquired <- secondDone
+		}()
+
+		// Then
+		Consistently(acquired).WithTimeout(50 * time.Millisecond).ShouldNot(Receive())
+		done()
+		var secondDone func()
+		Eventually(acquired).WithTimeout(time.Second).Should(Receive(&secondDone))
+		secondDone()
+
+		// Checkpoints of other containers are not blocked.
+		_, otherDone, err := s.checkpointContext(context.Background(), "other", false)
+		Expect(err).ToNot(HaveOccurred())
+		otherDone()
+	})
+
+	DescribeTable("should set the diagnostic only archive option from the annotation",
+		func(value string, expected bool) {
+			// Given
+			s.config.CheckpointArchiveUID = -1
+			s.config.CheckpointArchiveGID = -1
+			ctr, err := oci.NewContainer("id", "name", "", "", nil, nil,
+				map[string]string{annotations.CheckpointAnnotationDiagnosticOnly: value},
+				"image", nil, nil, "", &types.ContainerMetadata{}, "sandbox",
+				false, false, false, "", "", time.Now(), "")
+			Expect(err).ToNot(HaveOccurred())
+
+			// When
+			opts, err := s.checkpointArchiveOptions(ctr, "/tmp/checkpoint.tar")
+
+			// Then
+			Expect(err).ToNot(HaveOccurred())
+			Expect(opts.DiagnosticOnly).To(Equal(expected))
+		},
+		Entry("true", "true", true),
+		Entry("false", "false", false),
+		Entry("empty", "", false),
+	)
+
+	Context("holdCheckpointSlot", func() {
+		It("should wait for a running checkpoint", func() {
+			// Given
+			waiting := make(chan struct{})
+			injectCheckpointSlotWait(func(context.Context, string) { close(waiting) })
+			checkpointCtx, done, err := s.checkpointContext(context.Background(), "ctr", true)
+			Expect(err).ToNot(HaveOccurred())
+
+			// When
+			result := holdCheckpointSlotAsync(context.Background(), s)
+
+			// Then
+			<-waiting
+			Expect(result).ToNot(Receive())
+			Expect(checkpointCtx.Err()).ToNot(HaveOccurred())
+			done()
+			Expect(<-result).To(Succeed())
+			// The removal released the slot again.
+			_, done, err = s.checkpointContext(context.Background(), "ctr", false)
+			Expect(err).ToNot(HaveOccurred())
+			done()
+		})
+
+		It("should abort the checkpoint if the removal gives up", func() {
+			// Given
+			removeCtx, cancelRemove := context.WithCancel(context.Background())
+			DeferCleanup(cancelRemove)
+			injectCheckpointSlotWait(func(context.Context, string) { cancelRemove() })
+			checkpointCtx, done, err := s.checkpointContext(context.Background(), "ctr", true)
+			Expect(err).ToNot(HaveOccurred())
+			DeferCleanup(done)
+
+			// When
+			err = <-holdCheckpointSlotAsync(removeCtx, s)
+
+			// Then
+			Expect(status.Code(err)).To(Equal(codes.Canceled))
+			Expect(checkpointCtx.Err()).To(MatchError(context.Canceled))
+		})
+
+		It("should not wait without a running checkpoint", func() {
+			// Given
+			injectCheckpointSlotWait(func(context.Context, string) {
+				Fail("expected the removal not to wait")
+			})
+
+			// When
+			release, err := s.holdCheckpointSlot(context.Background(), "ctr", "removal")
+
+			// Then
+			Expect(err).ToNot(HaveOccurred())
+			release()
+		})
+	})
+})
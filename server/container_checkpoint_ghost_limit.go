@@ -0,0 +1,37 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	grpcmetadata "google.golang.org/grpc/metadata"
+
+	libconfig "github.com/cri-o/cri-o/pkg/config"
+)
+
+// checkpointGhostLimitMetadata is the gRPC request metadata by which clients
+// override checkpoint_ghost_limit for a checkpoint.
+const checkpointGhostLimitMetadata = "checkpoint-ghost-limit"
+
+// checkpointGhostLimitRequested returns the ghost file limit the client asked
+// for in the metadata of the request, if any. It fails if the limit is not a
+// number of bytes CRIU accepts.
+func checkpointGhostLimitRequested(ctx context.Context) (limit int64, ok bool, err error) {
+	md, ok := grpcmetadata.FromIncomingContext(ctx)
+	if !ok {
+		return 0, false, nil
+	}
+	values := md.Get(checkpointGhostLimitMetadata)
+	if len(values) == 0 {
+		return 0, false, nil
+	}
+	limit, err = strconv.ParseInt(values[0], 10, 64)
+	if err == nil {
+		err = libconfig.ValidateCheckpointGhostLimit(limit)
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid %s metadata %q: %w", checkpointGhostLimitMetadata, values[0], err)
+	}
+	return limit, true, nil
+}
@@ -0,0 +1,34 @@
+package server
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	grpcmetadata "google.golang.org/grpc/metadata"
+)
+
+var _ = Describe("ContainerCheckpointGhostLimit", func() {
+	DescribeTable("checkpointGhostLimitRequested",
+		func(md grpcmetadata.MD, expectedLimit int64, expectedOK bool) {
+			limit, ok, err := checkpointGhostLimitRequested(metadataContext(md))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(limit).To(Equal(expectedLimit))
+			Expect(ok).To(Equal(expectedOK))
+		},
+		Entry("without metadata", nil, int64(0), false),
+		Entry("other metadata", grpcmetadata.Pairs("other", "1024"), int64(0), false),
+		Entry("limit", grpcmetadata.Pairs(checkpointGhostLimitMetadata, "1048576"), int64(1048576), true),
+		Entry("zero", grpcmetadata.Pairs(checkpointGhostLimitMetadata, "0"), int64(0), true),
+	)
+
+	DescribeTable("should reject invalid limits",
+		func(value string) {
+			limit, ok, err := checkpointGhostLimitRequested(metadataContext(grpcmetadata.Pairs(checkpointGhostLimitMetadata, value)))
+			Expect(err).To(HaveOccurred())
+			Expect(limit).To(BeZero())
+			Expect(ok).To(BeFalse())
+		},
+		Entry("negative", "-1"),
+		Entry("too large", "4294967296"),
+		Entry("with unit", "1M"),
+	)
+})
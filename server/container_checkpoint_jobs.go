@@ -0,0 +1,224 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/containers/storage/pkg/stringid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	types "k8s.io/cri-api/pkg/apis/runtime/v1"
+
+	"github.com/cri-o/cri-o/internal/log"
+)
+
+const (
+	// maxCheckpointJobs is the maximum number of checkpoint jobs kept in
+	// the job table, including the completed ones which are retained.
+	maxCheckpointJobs = 256
+
+	// checkpointJobWorkers is the number of checkpoint jobs run at once.
+	checkpointJobWorkers = 4
+
+	// checkpointJobRetention is the time a completed checkpoint job is kept
+	// for GetCheckpointStatus.
+	checkpointJobRetention = time.Hour
+)
+
+// CheckpointJobState is the state of an asynchronous checkpoint job.
+type CheckpointJobState string
+
+const (
+	// CheckpointJobQueued jobs wait for a free worker.
+	CheckpointJobQueued CheckpointJobState = "queued"
+	// CheckpointJobRunning jobs are checkpointing their container.
+	CheckpointJobRunning CheckpointJobState = "running"
+	// CheckpointJobSucceeded jobs wrote the checkpoint.
+	CheckpointJobSucceeded CheckpointJobState = "succeeded"
+	// CheckpointJobFailed jobs failed, the cause is in their error.
+	CheckpointJobFailed CheckpointJobState = "failed"
+)
+
+// CheckpointJob describes a checkpoint submitted by SubmitCheckpoint.
+type CheckpointJob struct {
+	// ID identifies the job for GetCheckpointStatus.
+	ID string `json:"id"`
+	// ContainerID is the full ID of the checkpointed container.
+	ContainerID string `json:"containerId"`
+	// Location is the location of the checkpoint archive.
+	Location string `json:"location"`
+	// State is the current state of the job.
+	State CheckpointJobState `json:"state"`
+	// Error is the cause of a failed job.
+	Error string `json:"error,omitempty"`
+	// SubmittedAt, StartedAt and FinishedAt are the times the job has been
+	// submitted, started running and completed.
+	SubmittedAt time.Time  `json:"submittedAt"`
+	StartedAt   *time.Time `json:"startedAt,omitempty"`
+	FinishedAt  *time.Time `json:"finishedAt,omitempty"`
+}
+
+// done checks whether the job has completed.
+func (j *CheckpointJob) done() bool {
+	return j.State == CheckpointJobSucceeded || j.State == CheckpointJobFailed
+}
+
+// checkpointJobs is the bounded table of the asynchronous checkpoint jobs.
+// Its zero value is ready to use.
+type checkpointJobs struct {
+	mutex sync.Mutex
+	jobs  map[string]*CheckpointJob
+	// queue are the queued jobs in the order of their submission, running
+	// the number of jobs running.
+	queue   []*queuedCheckpointJob
+	running int
+}
+
+// queuedCheckpointJob is a job waiting for a free worker.
+type queuedCheckpointJob struct {
+	job        *CheckpointJob
+	checkpoint func(context.Context) error
+}
+
+// SubmitCheckpoint queues a checkpoint of the container of the request and
+// returns the ID of the job immediately, see GetCheckpointStatus.
+// Submitting fails with ResourceExhausted if the job table is full. The
+// location is validated like by CheckpointContainer before the job is
+// queued, so that a location outside of checkpoint_location_allowlist is
+// rejected right away.
+func (s *Server) SubmitCheckpoint(ctx context.Context, req *types.CheckpointContainerRequest) (string, error) {
+	if err := s.checkCheckpointRestoreEnabled(); err != nil {
+		return "", err
+	}
+	ctr, err := s.resolveContainer(ctx, req.ContainerId)
+	if err != nil {
+		return "", err
+	}
+	if err := s.checkCheckpointBreaker(ctr.ID()); err != nil {
+		return "", err
+	}
+	if _, err := s.expandCheckpointLocation(req.Location, s.newCheckpointLocationVars(ctx, ctr, time.Now())); err != nil {
+		return "", checkpointStatusError(err)
+	}
+	jobReq := &types.CheckpointContainerRequest{
+		ContainerId: ctr.ID(),
+		Location:    req.Location,
+		Timeout:     req.Timeout,
+	}
+	id, err := s.submitCheckpointJob(ctr.ID(), req.Location, func(jobCtx context.Context) error {
+		_, err := s.CheckpointContainer(jobCtx, jobReq)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	log.Infof(ctx, "Queued checkpoint job %s of container %s", id, ctr.ID())
+	return id, nil
+}
+
+// GetCheckpointStatus returns the job with the given ID submitted by
+// SubmitCheckpoint. Completed jobs are only kept for a limited time.
+func (s *Server) GetCheckpointStatus(jobID string) (*CheckpointJob, error) {
+	if err := s.checkCheckpointRestoreEnabled(); err != nil {
+		return nil, err
+	}
+	jobs := &s.checkpointJobs
+	jobs.mutex.Lock()
+	defer jobs.mutex.Unlock()
+	jobs.prune(time.Now())
+	job, ok := jobs.jobs[jobID]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "could not find checkpoint job %q", jobID)
+	}
+	jobCopy := *job
+	return &jobCopy, nil
+}
+
+// submitCheckpointJob adds a job for the checkpoint of the container ctrID to
+// location to the table and runs checkpoint for it once a worker is free.
+func (s *Server) submitCheckpointJob(ctrID, location string, checkpoint func(context.Context) error) (string, error) {
+	jobs := &s.checkpointJobs
+	jobs.mutex.Lock()
+	defer jobs.mutex.Unlock()
+	if jobs.jobs == nil {
+		jobs.jobs = make(map[string]*CheckpointJob)
+	}
+	now := time.Now()
+	jobs.prune(now)
+	if len(jobs.jobs) >= maxCheckpointJobs && !jobs.dropOldestDone() {
+		return "", status.Errorf(codes.ResourceExhausted, "too many checkpoint jobs in progress (%d)", len(jobs.jobs))
+	}
+
+	job := &CheckpointJob{
+		ID:          stringid.GenerateNonCryptoID(),
+		ContainerID: ctrID,
+		Location:    location,
+		State:       CheckpointJobQueued,
+		SubmittedAt: now,
+	}
+	jobs.jobs[job.ID] = job
+	jobs.queue = append(jobs.queue, &queuedCheckpointJob{job: job, checkpoint: checkpoint})
+	jobs.dispatch()
+	return job.ID, nil
+}
+
+// dispatch starts the queued jobs in the order of their submission while
+// workers are free. The caller has to hold the mutex.
+func (j *checkpointJobs) dispatch() {
+	for len(j.queue) > 0 && j.running < checkpointJobWorkers {
+		next := j.queue[0]
+		j.queue = j.queue[1:]
+		j.running++
+		started := time.Now()
+		next.job.State = CheckpointJobRunning
+		next.job.StartedAt = &started
+		go j.run(next)
+	}
+}
+
+// run runs the checkpoint of the started job and dispatches the next one.
+func (j *checkpointJobs) run(next *queuedCheckpointJob) {
+	err := next.checkpoint(context.Background())
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	job := next.job
+	finished := time.Now()
+	job.FinishedAt = &finished
+	if err != nil {
+		job.State = CheckpointJobFailed
+		job.Error = err.Error()
+	} else {
+		job.State = CheckpointJobSucceeded
+	}
+	j.running--
+	j.dispatch()
+}
+
+// prune removes the completed jobs whose retention expired. The caller has
+// to hold the mutex.
+func (j *checkpointJobs) prune(now time.Time) {
+	for id, job := range j.jobs {
+		if job.done() && now.Sub(*job.FinishedAt) > checkpointJobRetention {
+			delete(j.jobs, id)
+		}
+	}
+}
+
+// dropOldestDone removes the completed job which finished first to make room
+// for a new one. It returns false if no job has completed. The caller has to
+// hold the mutex.
+func (j *checkpointJobs) dropOldestDone() bool {
+	var oldest *CheckpointJob
+	for _, job := range j.jobs {
+		if job.done() && (oldest == nil || job.FinishedAt.Before(*oldest.FinishedAt)) {
+			oldest = job
+		}
+	}
+	if oldest == nil {
+		return false
+	}
+	delete(j.jobs, oldest.ID)
+	return true
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var _ = Describe("ContainerCheckpointJobs", func() {
+	var s *Server
+
+	BeforeEach(func() {
+		s = &Server{}
+		s.config.EnableCriuSupport = true
+	})
+
+	// waitCheckpointJob waits until the job id reaches state.
+	waitCheckpointJob := func(id string, state CheckpointJobState) *CheckpointJob {
+		var job *CheckpointJob
+		Eventually(func(g Gomega) CheckpointJobState {
+			var err error
+			job, err = s.GetCheckpointStatus(id)
+			g.Expect(err).ToNot(HaveOccurred())
+			return job.State
+		}).WithTimeout(10 * time.Second).WithPolling(time.Millisecond).Should(Equal(state))
+		return job
+	}
+
+	It("should report the states of a job", func() {
+		// Given
+		release := make(chan struct{})
+
+		// When
+		id, err := s.submitCheckpointJob("ctr", "/tmp/cp.tar", func(context.Context) error {
+			<-release
+			return nil
+		})
+
+		// Then
+		Expect(err).ToNot(HaveOccurred())
+		job := waitCheckpointJob(id, CheckpointJobRunning)
+		Expect(job.ContainerID).To(Equal("ctr"))
+		Expect(job.Location).To(Equal("/tmp/cp.tar"))
+		Expect(job.StartedAt).ToNot(BeNil())
+		Expect(job.FinishedAt).To(BeNil())
+		close(release)
+		job = waitCheckpointJob(id, CheckpointJobSucceeded)
+		Expect(job.FinishedAt).ToNot(BeNil())
+		Expect(job.Error).To(BeEmpty())
+	})
+
+	It("should report the cause of a failed job", func() {
+		// When
+		id, err := s.submitCheckpointJob("ctr", "/tmp/cp.tar", func(context.Context) error {
+			return errors.New("criu failed")
+		})
+
+		// Then
+		Expect(err).ToNot(HaveOccurred())
+		Expect(waitCheckpointJob(id, CheckpointJobFailed).Error).To(Equal("criu failed"))
+	})
+
+	It("should fail for an unknown job", func() {
+		_, err := s.GetCheckpointStatus("unknown")
+		Expect(status.Code(err)).To(Equal(codes.NotFound))
+	})
+
+	It("should queue jobs exceeding the workers", func() {
+		// Given
+		release := make(chan struct{})
+		DeferCleanup(func() { close(release) })
+		blocked := func(context.Context) error {
+			<-release
+			return nil
+		}
+		submit := func() string {
+			id, err := s.submitCheckpointJob("ctr", "/tmp/cp.tar", blocked)
+			Expect(err).ToNot(HaveOccurred())
+			return id
+		}
+
+		// When
+		ids := []string{}
+		for range checkpointJobWorkers + 1 {
+			ids = append(ids, submit())
+		}
+
+		// Then
+		for _, id := range ids[:checkpointJobWorkers] {
+			waitCheckpointJob(id, CheckpointJobRunning)
+		}
+		job, err := s.GetCheckpointStatus(ids[checkpointJobWorkers])
+		Expect(err).ToNot(HaveOccurred())
+		Expect(job.State).To(Equal(CheckpointJobQueued))
+
+		for len(ids) < maxCheckpointJobs {
+			ids = append(ids, submit())
+		}
+		_, err = s.submitCheckpointJob("ctr", "/tmp/cp.tar", blocked)
+		Expect(status.Code(err)).To(Equal(codes.ResourceExhausted))
+	})
+
+	It("should remove expired jobs", func() {
+		// Given
+		id, err := s.submitCheckpointJob("ctr", "/tmp/cp.tar", func(context.Context) error { return nil })
+		Expect(err).ToNot(HaveOccurred())
+		waitCheckpointJob(id, CheckpointJobSucceeded)
+
+		// When
+		s.checkpointJobs.mutex.Lock()
+		finished := time.Now().Add(-checkpointJobRetention - time.Second)
+		s.checkpointJobs.jobs[id].FinishedAt = &finished
+		s.checkpointJobs.mutex.Unlock()
+
+		// Then
+		_, err = s.GetCheckpointStatus(id)
+		Expect(status.Code(err)).To(Equal(codes.NotFound))
+	})
+})
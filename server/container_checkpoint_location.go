@@ -0,0 +1,198 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"google.golang.org/grpc"
+	grpcmetadata "google.golang.org/grpc/metadata"
+
+	"github.com/cri-o/cri-o/internal/lib"
+	"github.com/cri-o/cri-o/internal/log"
+	"github.com/cri-o/cri-o/internal/oci"
+	"github.com/cri-o/cri-o/pkg/config"
+)
+
+// checkpointLocationHeader is the gRPC response header holding the location
+// a checkpoint has been written to.
+const checkpointLocationHeader = "checkpoint-location"
+
+// checkpointTimestampFormat is the format of the Timestamp variable of
+// checkpoint locations, which is safe to use in file names.
+const checkpointTimestampFormat = "20060102T150405Z"
+
+var (
+	// errInvalidCheckpointLocation is returned if a checkpoint location
+	// template cannot be expanded.
+	errInvalidCheckpointLocation = errors.New("invalid checkpoint location")
+
+	// errCheckpointLocationNotAllowed is returned if a checkpoint location
+	// is outside of checkpoint_location_allowlist.
+	errCheckpointLocationNotAllowed = errors.New("checkpoint location not allowed")
+)
+
+// checkpointLocationVars are the variables available in checkpoint location
+// templates.
+type checkpointLocationVars struct {
+	PodName       string
+	ContainerName string
+	ContainerID   string
+	Timestamp     string
+}
+
+// isCheckpointLocationTemplate returns whether the checkpoint location has
+// template variables to expand.
+func isCheckpointLocationTemplate(location string) bool {
+	return strings.Contains(location, "{{")
+}
+
+// newCheckpointLocationVars returns the variables of the checkpoint location
+// of ctr written at now.
+func (s *Server) newCheckpointLocationVars(ctx context.Context, ctr *oci.Container, now time.Time) *checkpointLocationVars {
+	vars := &checkpointLocationVars{
+		ContainerID: ctr.ID(),
+		Timestamp:   now.UTC().Format(checkpointTimestampFormat),
+	}
+	if md := ctr.Metadata(); md != nil {
+		vars.ContainerName = md.Name
+	}
+	if sb := s.getSandbox(ctx, ctr.Sandbox()); sb != nil && sb.Metadata() != nil {
+		vars.PodName = sb.Metadata().Name
+	}
+	return vars
+}
+
+// expandCheckpointLocation expands the template variables of the checkpoint
+// location, resolves it against checkpoint_dir if it is relative and
+// validates it with validateCheckpointLocation. Templated locations require
+// checkpoint_location_allowlist.
+func (s *Server) expandCheckpointLocation(location string, vars *checkpointLocationVars) (string, error) {
+	if !isCheckpointLocationTemplate(location) {
+		return s.validateCheckpointLocation(s.resolveCheckpointLocation(location))
+	}
+	if len(s.config.RuntimeConfig.CheckpointLocationAllowlist) == 0 {
+		return "", fmt.Errorf("%w: templated locations require checkpoint_location_allowlist", errCheckpointLocationNotAllowed)
+	}
+
+	tmpl, err := template.New("location").Option("missingkey=error").Parse(location)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", errInvalidCheckpointLocation, err)
+	}
+	for _, value := range []string{vars.PodName, vars.ContainerName, vars.ContainerID} {
+		if strings.ContainsRune(value, filepath.Separator) || value == ".." {
+			return "", fmt.Errorf("%w: variable value %q is not a valid file name", errInvalidCheckpointLocation, value)
+		}
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, vars); err != nil {
+		return "", fmt.Errorf("%w: %w", errInvalidCheckpointLocation, err)
+	}
+	return s.validateCheckpointLocation(s.resolveCheckpointLocation(buf.String()))
+}
+
+// resolveCheckpointLocation returns the relative location below
+// checkpoint_dir, if configured.
+func (s *Server) resolveCheckpointLocation(location string) string {
+	dir := s.config.RuntimeConfig.CheckpointDir
+	if location == "" || dir == "" || filepath.IsAbs(location) || lib.IsRemoteCheckpointLocation(location) {
+		return location
+	}
+	return filepath.Join(dir, location)
+}
+
+// validateCheckpointLocation returns the canonical path of the location a
+// checkpoint archive is written to or restored from. As the request chooses
+// the path, it has to be below one of the directories of
+// checkpoint_location_allowlist, also after resolving its symbolic links.
+// Locations are not restricted if the list is empty.
+func (s *Server) validateCheckpointLocation(location string) (string, error) {
+	if lib.IsRemoteCheckpointLocation(location) {
+		return s.validateRemoteCheckpointLocation(location)
+	}
+	allowlist := s.config.RuntimeConfig.CheckpointLocationAllowlist
+	if location == "" || len(allowlist) == 0 {
+		return location, nil
+	}
+	if !filepath.IsAbs(location) {
+		return "", fmt.Errorf("%w: %q is not an absolute path", errCheckpointLocationNotAllowed, location)
+	}
+	target := filepath.Clean(location)
+	resolved, err := resolveExistingPath(target)
+	if err != nil {
+		return "", fmt.Errorf("%w: resolving %q: %w", errCheckpointLocationNotAllowed, target, err)
+	}
+	for _, dir := range allowlist {
+		if !isBelowDir(dir, target) {
+			continue
+		}
+		resolvedDir, err := resolveExistingPath(filepath.Clean(dir))
+		if err == nil && isBelowDir(resolvedDir, resolved) {
+			return target, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %q is not below a directory of checkpoint_location_allowlist", errCheckpointLocationNotAllowed, target)
+}
+
+// validateRemoteCheckpointLocation returns the checkpoint location in an
+// object store, like "s3://bucket/key". Its key has to be below the prefix of
+// an object store entry of checkpoint_location_allowlist, like
+// "s3://bucket/prefix". Locations are not restricted if the list is empty.
+func (s *Server) validateRemoteCheckpointLocation(location string) (string, error) {
+	scheme := config.CheckpointLocationSchemeS3 + "://"
+	object := strings.TrimPrefix(location, scheme)
+	bucket, key, _ := strings.Cut(object, "/")
+	if bucket == "" || key == "" || path.Clean("/"+key) != "/"+key {
+		return "", fmt.Errorf("%w: %q has to name a bucket and a clean key", errInvalidCheckpointLocation, location)
+	}
+	allowlist := s.config.RuntimeConfig.CheckpointLocationAllowlist
+	if len(allowlist) == 0 {
+		return location, nil
+	}
+	for _, entry := range allowlist {
+		prefix, ok := strings.CutPrefix(entry, scheme)
+		if ok && strings.HasPrefix(object, strings.TrimSuffix(prefix, "/")+"/") {
+			return location, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %q is not below an object store entry of checkpoint_location_allowlist", errCheckpointLocationNotAllowed, location)
+}
+
+// resolveExistingPath resolves the symbolic links of the longest existing
+// prefix of the absolute, clean path and appends the remaining elements.
+func resolveExistingPath(path string) (string, error) {
+	existing, rest := path, ""
+	for {
+		resolved, err := filepath.EvalSymlinks(existing)
+		if err == nil {
+			return filepath.Join(resolved, rest), nil
+		}
+		parent := filepath.Dir(existing)
+		if !errors.Is(err, os.ErrNotExist) || parent == existing {
+			return "", err
+		}
+		rest = filepath.Join(filepath.Base(existing), rest)
+		existing = parent
+	}
+}
+
+// isBelowDir returns whether path is a descendant of dir.
+func isBelowDir(dir, path string) bool {
+	rel, err := filepath.Rel(filepath.Clean(dir), path)
+	return err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// setCheckpointLocationHeader returns the location a checkpoint has been
+// written to in the response header.
+func setCheckpointLocationHeader(ctx context.Context, location string) {
+	if err := grpc.SetHeader(ctx, grpcmetadata.Pairs(checkpointLocationHeader, location)); err != nil {
+		log.Debugf(ctx, "Unable to set checkpoint location header: %v", err)
+	}
+}
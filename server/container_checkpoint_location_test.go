@@ -0,0 +1,196 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var _ = Describe("ContainerCheckpointLocation", func() {
+	var (
+		s                *Server
+		allowed, outside string
+	)
+
+	BeforeEach(func() {
+		s = &Server{}
+		allowed = GinkgoT().TempDir()
+		outside = GinkgoT().TempDir()
+		Expect(os.Symlink(outside, filepath.Join(allowed, "link"))).To(Succeed())
+	})
+
+	Context("expandCheckpointLocation", func() {
+		vars := &checkpointLocationVars{
+			PodName:       "pod",
+			ContainerName: "ctr",
+			ContainerID:   "0123",
+			Timestamp:     time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC).Format(checkpointTimestampFormat),
+		}
+
+		BeforeEach(func() {
+			s.config.RuntimeConfig.CheckpointLocationAllowlist = []string{allowed}
+		})
+
+		// The table entries take functions as the directories are created
+		// per spec.
+		DescribeTable("should expand allowed locations",
+			func(location, expected func() string) {
+				Expect(s.expandCheckpointLocation(location(), vars)).To(Equal(expected()))
+			},
+			Entry("with variables",
+				func() string {
+					return filepath.Join(allowed, "{{.PodName}}-{{.ContainerName}}-{{.ContainerID}}-{{.Timestamp}}.tar")
+				},
+				func() string { return filepath.Join(allowed, "pod-ctr-0123-20240506T070809Z.tar") },
+			),
+			Entry("without variables",
+				func() string { return filepath.Join(allowed, "cp.tar") },
+				func() string { return filepath.Join(allowed, "cp.tar") },
+			),
+		)
+
+		DescribeTable("should reject locations",
+			func(location func() string, expected error) {
+				Expect(s.expandCheckpointLocation(location(), vars)).Error().To(MatchError(expected))
+			},
+			Entry("outside of the allowlist", func() string { return filepath.Join(outside, "cp.tar") }, errCheckpointLocationNotAllowed),
+			Entry("leaving the allowlist", func() string { return filepath.Join(allowed, "../{{.PodName}}.tar") }, errCheckpointLocationNotAllowed),
+			Entry("with variables outside of the allowlist", func() string { return filepath.Join(outside, "{{.PodName}}.tar") }, errCheckpointLocationNotAllowed),
+			Entry("through a symbolic link", func() string { return filepath.Join(allowed, "link", "{{.PodName}}.tar") }, errCheckpointLocationNotAllowed),
+			Entry("relative", func() string { return "{{.PodName}}.tar" }, errCheckpointLocationNotAllowed),
+			Entry("with an unknown variable", func() string { return filepath.Join(allowed, "{{.Unknown}}.tar") }, errInvalidCheckpointLocation),
+			Entry("with an invalid template", func() string { return filepath.Join(allowed, "{{.PodName") }, errInvalidCheckpointLocation),
+		)
+
+		It("should reject an invalid value of a variable", func() {
+			s.config.RuntimeConfig.CheckpointLocationAllowlist = []string{"/tmp"}
+			_, err := s.expandCheckpointLocation("/tmp/{{.PodName}}/cp.tar", &checkpointLocationVars{PodName: ".."})
+			Expect(err).To(MatchError(errInvalidCheckpointLocation))
+		})
+
+		It("should restrict locations with variables without allowlist", func() {
+			// Given
+			s.config.RuntimeConfig.CheckpointLocationAllowlist = nil
+
+			// When
+			_, err := s.expandCheckpointLocation("/tmp/{{.PodName}}.tar", &checkpointLocationVars{PodName: "pod"})
+
+			// Then
+			Expect(err).To(MatchError(errCheckpointLocationNotAllowed))
+			// Locations without variables are not restricted.
+			for _, location := range []string{"/etc/cp.tar", "cp.tar", ""} {
+				Expect(s.expandCheckpointLocation(location, &checkpointLocationVars{})).To(Equal(location))
+			}
+		})
+
+		It("should expand locations relative to the checkpoint directory", func() {
+			// Given
+			s.config.RuntimeConfig.CheckpointDir = allowed
+
+			// When
+			// Then
+			for location, expected := range map[string]string{
+				"cp.tar":                          filepath.Join(allowed, "cp.tar"),
+				"{{.PodName}}.tar":                filepath.Join(allowed, "pod.tar"),
+				filepath.Join(allowed, "abs.tar"): filepath.Join(allowed, "abs.tar"),
+			} {
+				Expect(s.expandCheckpointLocation(location, &checkpointLocationVars{PodName: "pod"})).To(Equal(expected), location)
+			}
+			Expect(s.expandCheckpointLocation("../cp.tar", &checkpointLocationVars{})).Error().To(MatchError(errCheckpointLocationNotAllowed))
+		})
+	})
+
+	Context("with a remote allowlist", func() {
+		vars := &checkpointLocationVars{PodName: "pod", ContainerName: "ctr"}
+
+		BeforeEach(func() {
+			s.config.RuntimeConfig.CheckpointLocationAllowlist = []string{"/var/lib/checkpoints", "s3://bucket/checkpoints/"}
+			s.config.RuntimeConfig.CheckpointDir = "/var/lib/checkpoints"
+		})
+
+		DescribeTable("should expand allowed locations",
+			func(location, expected string) {
+				Expect(s.expandCheckpointLocation(location, vars)).To(Equal(expected))
+			},
+			Entry("with variables", "s3://bucket/checkpoints/{{.PodName}}/{{.ContainerName}}.tar", "s3://bucket/checkpoints/pod/ctr.tar"),
+			Entry("without variables", "s3://bucket/checkpoints/cp.tar", "s3://bucket/checkpoints/cp.tar"),
+		)
+
+		DescribeTable("should reject locations",
+			func(location string, expected error) {
+				Expect(s.expandCheckpointLocation(location, vars)).Error().To(MatchError(expected))
+			},
+			Entry("of another prefix", "s3://bucket/other/cp.tar", errCheckpointLocationNotAllowed),
+			Entry("sharing the prefix", "s3://bucket/checkpoints-other/cp.tar", errCheckpointLocationNotAllowed),
+			Entry("of another bucket", "s3://other/checkpoints/cp.tar", errCheckpointLocationNotAllowed),
+			Entry("leaving the prefix", "s3://bucket/checkpoints/../cp.tar", errInvalidCheckpointLocation),
+			Entry("without object", "s3://bucket/checkpoints/", errInvalidCheckpointLocation),
+			Entry("without key", "s3://bucket", errInvalidCheckpointLocation),
+		)
+	})
+
+	Context("validateCheckpointLocation", func() {
+		BeforeEach(func() {
+			s.config.RuntimeConfig.CheckpointLocationAllowlist = []string{allowed}
+			// An existing archive which is a symbolic link to a file outside.
+			Expect(os.WriteFile(filepath.Join(outside, "secret"), nil, 0o600)).To(Succeed())
+			Expect(os.Symlink(filepath.Join(outside, "secret"), filepath.Join(allowed, "cp.tar"))).To(Succeed())
+		})
+
+		It("should clean allowed locations", func() {
+			for location, expected := range map[string]string{
+				filepath.Join(allowed, "new.tar"):              filepath.Join(allowed, "new.tar"),
+				filepath.Join(allowed, "sub", "..", "new.tar"): filepath.Join(allowed, "new.tar"),
+				filepath.Join(allowed, "missing", "new.tar"):   filepath.Join(allowed, "missing", "new.tar"),
+			} {
+				Expect(s.validateCheckpointLocation(location)).To(Equal(expected), location)
+			}
+		})
+
+		It("should reject locations outside of the allowlist", func() {
+			for _, location := range []string{
+				filepath.Join(allowed, "..", filepath.Base(outside), "new.tar"),
+				filepath.Join(allowed, "link", "new.tar"),
+				filepath.Join(allowed, "link", "missing", "new.tar"),
+				filepath.Join(allowed, "cp.tar"),
+				allowed,
+				"new.tar",
+				"/etc/passwd",
+			} {
+				Expect(s.validateCheckpointLocation(location)).Error().To(MatchError(errCheckpointLocationNotAllowed), location)
+			}
+		})
+	})
+
+	It("should report a location outside of the allowlist as permission denied", func() {
+		err := checkpointStatusError(fmt.Errorf("%w: /etc/passwd", errCheckpointLocationNotAllowed))
+		Expect(status.Code(err)).To(Equal(codes.PermissionDenied))
+	})
+
+	It("should not repeat a checkpoint to a templated location", func() {
+		// Given
+		s = newTestServer()
+		var calls int
+		checkpoint := func() (string, error) {
+			calls++
+			return "/tmp/cp-" + time.Now().Format(time.RFC3339Nano) + ".tar", nil
+		}
+		first, err := s.checkpointOnce(context.Background(), "ctr", "/tmp/cp-{{.Timestamp}}.tar", checkpoint)
+		Expect(err).ToNot(HaveOccurred())
+
+		// When
+		retry, err := s.checkpointOnce(context.Background(), "ctr", "/tmp/cp-{{.Timestamp}}.tar", checkpoint)
+
+		// Then
+		Expect(err).ToNot(HaveOccurred())
+		Expect(calls).To(Equal(1))
+		Expect(retry).To(Equal(first))
+	})
+})
@@ -0,0 +1,224 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	grpcmetadata "google.golang.org/grpc/metadata"
+
+	"github.com/cri-o/cri-o/internal/log"
+)
+
+// checkpointOperationHeader is the gRPC response header holding the ID of the
+// checkpoint operation started by CheckpointContainer, which keys its
+// messages of WatchCheckpointOperations.
+const checkpointOperationHeader = "checkpoint-operation"
+
+// maxPendingCheckpointProgress is the number of progress messages buffered
+// for a watcher of the checkpoint operations which does not keep up.
+// Further progress messages are dropped until it catches up.
+const maxPendingCheckpointProgress = 64
+
+// CheckpointOperationEventType is the type of a message of
+// WatchCheckpointOperations.
+type CheckpointOperationEventType string
+
+const (
+	// CheckpointOperationStarted is sent when the operation starts.
+	CheckpointOperationStarted CheckpointOperationEventType = "started"
+	// CheckpointOperationProgress is sent when the export of the checkpoint
+	// archive progressed. It may be dropped for slow watchers.
+	CheckpointOperationProgress CheckpointOperationEventType = "progress"
+	// CheckpointOperationSucceeded is sent when the checkpoint is written.
+	CheckpointOperationSucceeded CheckpointOperationEventType = "succeeded"
+	// CheckpointOperationFailed is sent when the operation failed, the
+	// cause is in the error of the message.
+	CheckpointOperationFailed CheckpointOperationEventType = "failed"
+)
+
+// CheckpointOperationEvent is a message of WatchCheckpointOperations.
+type CheckpointOperationEvent struct {
+	// Operation is the ID of the checkpoint operation.
+	Operation string `json:"operation"`
+	// Type is the type of the message.
+	Type CheckpointOperationEventType `json:"type"`
+	// ContainerID is the full ID of the checkpointed container.
+	ContainerID string `json:"containerId"`
+	// Location is the location of the checkpoint archive.
+	Location string `json:"location,omitempty"`
+	// ExportPercent is the percentage of the checkpoint archive written,
+	// for progress messages.
+	ExportPercent int `json:"exportPercent,omitempty"`
+	// Error is the cause of a failed operation.
+	Error string `json:"error,omitempty"`
+	// Time is the time the message has been sent.
+	Time time.Time `json:"time"`
+}
+
+// checkpointOperationWatchers are the watchers of the checkpoint operations.
+// Its zero value is ready to use.
+type checkpointOperationWatchers struct {
+	mutex    sync.Mutex
+	watchers map[*checkpointOperationWatcher]struct{}
+}
+
+// checkpointOperationWatcher buffers the messages for a watcher of the
+// checkpoint operations. Sending never blocks: the messages which have not
+// been taken yet are kept in pending, where progress messages of the same
+// operation replace each other and further progress messages are dropped
+// once maxPendingCheckpointProgress are pending. Other messages are always
+// kept.
+type checkpointOperationWatcher struct {
+	mutex    sync.Mutex
+	pending  []*CheckpointOperationEvent
+	progress int
+	notify   chan struct{}
+}
+
+func (w *checkpointOperationWatcher) send(event *CheckpointOperationEvent) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if event.Type == CheckpointOperationProgress {
+		replaced := false
+		for i, pending := range w.pending {
+			if pending.Type == CheckpointOperationProgress && pending.Operation == event.Operation {
+				w.pending[i] = event
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			if w.progress >= maxPendingCheckpointProgress {
+				return
+			}
+			w.pending = append(w.pending, event)
+			w.progress++
+		}
+	} else {
+		w.pending = append(w.pending, event)
+	}
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+}
+
+// take returns the pending messages in the order they have been sent.
+func (w *checkpointOperationWatcher) take() []*CheckpointOperationEvent {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	pending := w.pending
+	w.pending = nil
+	w.progress = 0
+	return pending
+}
+
+func (c *checkpointOperationWatchers) add() *checkpointOperationWatcher {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.watchers == nil {
+		c.watchers = make(map[*checkpointOperationWatcher]struct{})
+	}
+	w := &checkpointOperationWatcher{notify: make(chan struct{}, 1)}
+	c.watchers[w] = struct{}{}
+	return w
+}
+
+func (c *checkpointOperationWatchers) remove(w *checkpointOperationWatcher) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.watchers, w)
+}
+
+// send sends the message to all watchers without blocking.
+func (c *checkpointOperationWatchers) send(event *CheckpointOperationEvent) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for w := range c.watchers {
+		w.send(event)
+	}
+}
+
+// WatchCheckpointOperations returns the channel the messages about the
+// checkpoint operations started from now on are sent to, until ctx is done.
+// A watcher which does not keep up misses progress messages, but no others.
+func (s *Server) WatchCheckpointOperations(ctx context.Context) <-chan *CheckpointOperationEvent {
+	w := s.checkpointOperations.add()
+	events := make(chan *CheckpointOperationEvent)
+	go func() {
+		defer close(events)
+		defer s.checkpointOperations.remove(w)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-w.notify:
+			}
+			for _, event := range w.take() {
+				select {
+				case <-ctx.Done():
+					return
+				case events <- event:
+				}
+			}
+		}
+	}()
+	return events
+}
+
+// checkpointOperation is a checkpoint reported to WatchCheckpointOperations.
+type checkpointOperation struct {
+	id          string
+	containerID string
+	location    string
+	watchers    *checkpointOperationWatchers
+}
+
+// startCheckpointOperation reports the start of the checkpoint of the
+// container ctrID to location, and returns the ID of the operation in the
+// response header of the request of ctx.
+func (s *Server) startCheckpointOperation(ctx context.Context, ctrID, location string) *checkpointOperation {
+	op := &checkpointOperation{
+		id:          uuid.New().String(),
+		containerID: ctrID,
+		location:    location,
+		watchers:    &s.checkpointOperations,
+	}
+	if err := grpc.SetHeader(ctx, grpcmetadata.Pairs(checkpointOperationHeader, op.id)); err != nil {
+		log.Debugf(ctx, "Unable to set checkpoint operation header: %v", err)
+	}
+	op.send(CheckpointOperationStarted, 0, nil)
+	return op
+}
+
+func (o *checkpointOperation) send(eventType CheckpointOperationEventType, percent int, err error) {
+	event := &CheckpointOperationEvent{
+		Operation:     o.id,
+		Type:          eventType,
+		ContainerID:   o.containerID,
+		Location:      o.location,
+		ExportPercent: percent,
+		Time:          time.Now(),
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	o.watchers.send(event)
+}
+
+// progress reports the percentage of the checkpoint archive written.
+func (o *checkpointOperation) progress(percent int) {
+	o.send(CheckpointOperationProgress, percent, nil)
+}
+
+// finish reports the end of the operation, which failed if err is set.
+func (o *checkpointOperation) finish(err error) {
+	if err != nil {
+		o.send(CheckpointOperationFailed, 0, err)
+		return
+	}
+	o.send(CheckpointOperationSucceeded, 100, nil)
+}
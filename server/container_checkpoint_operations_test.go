@@ -0,0 +1,86 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ContainerCheckpointOperations", func() {
+	It("should send the events of the operations to watchers", func() {
+		// Given
+		s := &Server{}
+		ctx, cancel := context.WithCancel(context.Background())
+		events := s.WatchCheckpointOperations(ctx)
+
+		// When
+		op := s.startCheckpointOperation(context.Background(), "ctr", "/cp.tar")
+		op.progress(42)
+		op.finish(nil)
+		failed := s.startCheckpointOperation(context.Background(), "ctr", "/other.tar")
+		failed.finish(errors.New("CRIU failed"))
+
+		// Then
+		Expect(op.id).ToNot(Equal(failed.id))
+		for _, expected := range []CheckpointOperationEvent{
+			{Operation: op.id, Type: CheckpointOperationStarted, Location: "/cp.tar"},
+			{Operation: op.id, Type: CheckpointOperationProgress, Location: "/cp.tar", ExportPercent: 42},
+			{Operation: op.id, Type: CheckpointOperationSucceeded, Location: "/cp.tar", ExportPercent: 100},
+			{Operation: failed.id, Type: CheckpointOperationStarted, Location: "/other.tar"},
+			{Operation: failed.id, Type: CheckpointOperationFailed, Location: "/other.tar", Error: "CRIU failed"},
+		} {
+			var event *CheckpointOperationEvent
+			Eventually(events).WithTimeout(time.Second).Should(Receive(&event))
+			event.Time = time.Time{}
+			expected.ContainerID = "ctr"
+			Expect(*event).To(Equal(expected))
+		}
+
+		cancel()
+		Eventually(events).WithTimeout(time.Second).Should(BeClosed())
+		Expect(s.checkpointOperations.watchers).To(BeEmpty())
+	})
+
+	It("should not block operations on a slow watcher", func() {
+		// Given
+		// Nothing is taken while the operations run.
+		w := &checkpointOperationWatcher{notify: make(chan struct{}, 1)}
+		watchers := &checkpointOperationWatchers{watchers: map[*checkpointOperationWatcher]struct{}{w: {}}}
+		ops := make([]*checkpointOperation, 2*maxPendingCheckpointProgress)
+
+		// When
+		for i := range ops {
+			ops[i] = &checkpointOperation{id: fmt.Sprint(i), containerID: "ctr", watchers: watchers}
+			ops[i].send(CheckpointOperationStarted, 0, nil)
+			for percent := 1; percent <= 99; percent++ {
+				ops[i].progress(percent)
+			}
+		}
+		for _, op := range ops {
+			op.finish(nil)
+		}
+
+		// Then
+		started, succeeded, progress := 0, 0, 0
+		for _, event := range w.take() {
+			switch event.Type {
+			case CheckpointOperationStarted:
+				started++
+			case CheckpointOperationSucceeded:
+				succeeded++
+			case CheckpointOperationProgress:
+				progress++
+				// Only the latest progress of an operation is kept.
+				Expect(event.ExportPercent).To(Equal(99))
+			}
+		}
+		Expect(started).To(Equal(len(ops)))
+		Expect(succeeded).To(Equal(len(ops)))
+		Expect(progress).To(Equal(maxPendingCheckpointProgress))
+		Expect(w.take()).To(BeEmpty())
+	})
+})
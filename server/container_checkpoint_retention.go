@@ -0,0 +1,48 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/cri-o/cri-o/internal/lib"
+	"github.com/cri-o/cri-o/internal/log"
+	"github.com/cri-o/cri-o/server/metrics"
+)
+
+// checkpointRetentionInterval is the interval the retention of
+// checkpoint_dir is enforced in.
+const checkpointRetentionInterval = time.Minute
+
+// startCheckpointRetention periodically removes the oldest checkpoint
+// archives in checkpoint_dir exceeding its retention, until the monitors are
+// stopped.
+func (s *Server) startCheckpointRetention(ctx context.Context) {
+	if s.config.RuntimeConfig.CheckpointDir == "" {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(checkpointRetentionInterval)
+		defer ticker.Stop()
+		for {
+			s.enforceCheckpointRetention(ctx)
+			select {
+			case <-s.monitorsChan:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// enforceCheckpointRetention removes the oldest checkpoint archives in
+// checkpoint_dir exceeding its retention and reports the size of the
+// remaining ones.
+func (s *Server) enforceCheckpointRetention(ctx context.Context) {
+	dir := s.config.RuntimeConfig.CheckpointDir
+	usage, err := lib.EnforceCheckpointRetention(ctx, dir,
+		s.config.RuntimeConfig.CheckpointDirMaxCount, s.config.RuntimeConfig.CheckpointDirMaxSize)
+	if err != nil {
+		log.Warnf(ctx, "Unable to enforce the retention of checkpoint directory %s: %v", dir, err)
+	}
+	metrics.Instance().MetricCheckpointDirBytes(usage)
+}
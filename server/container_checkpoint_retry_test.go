@@ -0,0 +1,157 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/cri-o/cri-o/internal/resourcestore"
+)
+
+// newTestServer returns a server with a container store which is closed
+// when the spec finishes.
+func newTestServer() *Server {
+	s := &Server{containerStore: resourcestore.New()}
+	DeferCleanup(s.containerStore.Close)
+	return s
+}
+
+var _ = Describe("CheckpointOnce", func() {
+	var (
+		s     *Server
+		calls int32
+	)
+
+	BeforeEach(func() {
+		s = newTestServer()
+		calls = 0
+	})
+
+	checkpointOnce := func(checkpoint func() (string, error)) <-chan error {
+		errs := make(chan error, 1)
+		go func() {
+			_, err := s.checkpointOnce(context.Background(), "ctr", "/tmp/cp.tar", checkpoint)
+			errs <- err
+		}()
+		return errs
+	}
+
+	It("should not repeat a successful checkpoint", func() {
+		// Given
+		checkpoint := func() (string, error) {
+			atomic.AddInt32(&calls, 1)
+			return "/tmp/cp.tar", nil
+		}
+		Expect(s.checkpointOnce(context.Background(), "ctr", "/tmp/cp.tar", checkpoint)).Error().ToNot(HaveOccurred())
+
+		// When
+		_, err := s.checkpointOnce(context.Background(), "ctr", "/tmp/cp.tar", checkpoint)
+
+		// Then
+		Expect(err).ToNot(HaveOccurred())
+		Expect(atomic.LoadInt32(&calls)).To(BeEquivalentTo(1))
+
+		// A different location is a different request.
+		Expect(s.checkpointOnce(context.Background(), "ctr", "/tmp/other.tar", checkpoint)).Error().ToNot(HaveOccurred())
+		Expect(atomic.LoadInt32(&calls)).To(BeEquivalentTo(2))
+	})
+
+	It("should wait for a checkpoint in flight", func() {
+		// Given
+		started := make(chan struct{})
+		release := make(chan struct{})
+		checkpoint := func() (string, error) {
+			atomic.AddInt32(&calls, 1)
+			close(started)
+			<-release
+			return "/tmp/cp.tar", nil
+		}
+		firstErr := checkpointOnce(checkpoint)
+		<-started
+
+		// When
+		retryErr := checkpointOnce(checkpoint)
+
+		// Then
+		Consistently(retryErr).WithTimeout(100 * time.Millisecond).ShouldNot(Receive())
+		close(release)
+		Expect(<-firstErr).To(Succeed())
+		Expect(<-retryErr).To(Succeed())
+		Expect(atomic.LoadInt32(&calls)).To(BeEquivalentTo(1))
+	})
+
+	It("should retry a failed checkpoint", func() {
+		// Given
+		failure := errors.New("checkpoint failed")
+		checkpoint := func() (string, error) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				return "", failure
+			}
+			return "/tmp/cp.tar", nil
+		}
+		Expect(s.checkpointOnce(context.Background(), "ctr", "/tmp/cp.tar", checkpoint)).Error().To(MatchError(failure))
+
+		// When
+		_, err := s.checkpointOnce(context.Background(), "ctr", "/tmp/cp.tar", checkpoint)
+
+		// Then
+		Expect(err).ToNot(HaveOccurred())
+		Expect(atomic.LoadInt32(&calls)).To(BeEquivalentTo(2))
+	})
+
+	DescribeTable("should report the result of the first attempt to concurrent retries",
+		func(result error, expectedCalls int) {
+			// Given
+			started := make(chan struct{})
+			release := make(chan struct{})
+			checkpoint := func() (string, error) {
+				if atomic.AddInt32(&calls, 1) == 1 {
+					close(started)
+					<-release
+				}
+				return "/tmp/cp.tar", result
+			}
+			firstErr := checkpointOnce(checkpoint)
+			<-started
+
+			// When
+			const retries = 2
+			retryErrs := []<-chan error{}
+			for i := 0; i < retries; i++ {
+				retryErrs = append(retryErrs, checkpointOnce(checkpoint))
+			}
+			// Wait until both retries are waiting for the first attempt,
+			// the first attempt holds a watcher itself.
+			Eventually(func() int {
+				return s.containerStore.WatcherCounts()[checkpointResourceName("ctr", "/tmp/cp.tar")]
+			}).WithTimeout(10 * time.Second).Should(Equal(retries + 1))
+			close(release)
+
+			// Then
+			Expect(<-firstErr).To(matchCheckpointResult(result))
+			for _, retryErr := range retryErrs {
+				Eventually(retryErr).WithTimeout(10 * time.Second).Should(Receive(matchCheckpointResult(result)))
+			}
+			Expect(atomic.LoadInt32(&calls)).To(BeEquivalentTo(1))
+
+			// A later retry within the window observes the recorded
+			// result, a failed attempt is not recorded and runs again.
+			_, err := s.checkpointOnce(context.Background(), "ctr", "/tmp/cp.tar", checkpoint)
+			Expect(err).To(matchCheckpointResult(result))
+			Expect(atomic.LoadInt32(&calls)).To(BeEquivalentTo(expectedCalls))
+		},
+		Entry("success", nil, 1),
+		Entry("failure", errors.New("checkpoint failed"), 2),
+	)
+})
+
+func matchCheckpointResult(result error) OmegaMatcher {
+	if result == nil {
+		return BeNil()
+	}
+	return MatchError(result)
+}
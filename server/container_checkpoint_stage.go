@@ -0,0 +1,162 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/cri-o/cri-o/internal/log"
+	"github.com/cri-o/cri-o/internal/resourcestore"
+)
+
+// checkpointStagingDir is the directory below the run root of the storage
+// checkpoint archives are staged in. Being on the same file system as the
+// directories of the containers, the staged data is moved instead of copied
+// on restore.
+const checkpointStagingDir = "staged-checkpoints"
+
+// stagedCheckpoint is a checkpoint archive extracted into dir ahead of its
+// restore, see StageCheckpoint.
+type stagedCheckpoint struct {
+	location  string
+	dir       string
+	baseImage string
+	expiresAt time.Time
+}
+
+func (c *stagedCheckpoint) ID() string {
+	return c.dir
+}
+
+func (c *stagedCheckpoint) SetCreated() {}
+
+// StagedCheckpointInfo describes a checkpoint archive staged by
+// StageCheckpoint.
+type StagedCheckpointInfo struct {
+	Location  string    `json:"location"`
+	BaseImage string    `json:"baseImage,omitempty"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+func (c *stagedCheckpoint) info() *StagedCheckpointInfo {
+	return &StagedCheckpointInfo{
+		Location:  c.location,
+		BaseImage: c.baseImage,
+		ExpiresAt: c.expiresAt,
+	}
+}
+
+// stagedCheckpointResourceName returns the ResourceStore name of the
+// checkpoint archive at location once it has been staged.
+func stagedCheckpointResourceName(location string) string {
+	return "staged-checkpoint/" + location
+}
+
+// StageCheckpoint prepares the restore of the checkpoint archive at location
+// ahead of time. The archive is verified and extracted, and the base image of
+// the checkpoint is pulled. The staged data is kept in the ResourceStore for
+// checkpoint_staging_ttl, a restore from the same location within that time
+// uses it instead of the archive. Staging an archive which is already staged
+// returns the staged archive.
+func (s *Server) StageCheckpoint(ctx context.Context, location string) (*StagedCheckpointInfo, error) {
+	if err := s.checkCheckpointRestoreEnabled(); err != nil {
+		return nil, err
+	}
+	ttl := time.Duration(s.config.CheckpointStagingTTL) * time.Second
+	if ttl <= 0 {
+		return nil, status.Error(codes.Unimplemented, "checkpoint staging is disabled")
+	}
+	if location == "" {
+		return nil, status.Error(codes.InvalidArgument, "location of the checkpoint archive missing")
+	}
+	// Do not read arbitrary files of the host as archive.
+	if _, err := s.validateCheckpointLocation(location); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	name := stagedCheckpointResourceName(location)
+	if staged := s.peekStagedCheckpoint(name); staged != nil {
+		log.Infof(ctx, "Checkpoint archive %s already staged", location)
+		return staged.info(), nil
+	}
+
+	root := filepath.Join(s.Store().RunRoot(), checkpointStagingDir)
+	if err := os.MkdirAll(root, 0o700); err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp(root, "checkpoint")
+	if err != nil {
+		return nil, err
+	}
+	removeDir := func() error {
+		return os.RemoveAll(dir)
+	}
+	checkpoint, err := s.ContainerServer.StageCheckpoint(ctx, dir, location)
+	if err != nil {
+		if err := removeDir(); err != nil {
+			log.Errorf(ctx, "Could not recursively remove %s: %q", dir, err)
+		}
+		return nil, fmt.Errorf("failed to stage checkpoint archive %s: %w", location, err)
+	}
+	staged := &stagedCheckpoint{
+		location:  location,
+		dir:       dir,
+		expiresAt: time.Now().Add(ttl),
+	}
+	// The restore pulls the base image again if it is still missing, and
+	// decides whether a different version of it may be used.
+	if staged.baseImage, err = s.checkpointBaseImage(ctx, checkpoint.Config, checkpoint.Info, nil, nil); err != nil {
+		log.Warnf(ctx, "Unable to pull base image of staged checkpoint archive %s: %v", location, err)
+	}
+
+	cleaner := resourcestore.NewResourceCleaner()
+	cleaner.Add(ctx, "StageCheckpoint: removing staged checkpoint archive "+location, removeDir)
+	cleaner.SetManifest(cleanupManifestStagedCheckpoint, map[string]string{cleanupManifestDir: dir})
+	if err := s.containerStore.PutWithTimeout(resourcestore.DefaultNamespace, name, staged, cleaner, ttl); err != nil {
+		if err := removeDir(); err != nil {
+			log.Errorf(ctx, "Could not recursively remove %s: %q", dir, err)
+		}
+		// The archive has been staged concurrently.
+		if existing := s.peekStagedCheckpoint(name); existing != nil {
+			return existing.info(), nil
+		}
+		return nil, err
+	}
+	log.Infof(ctx, "Staged checkpoint archive %s in %s until %v", location, dir, staged.expiresAt)
+	return staged.info(), nil
+}
+
+// peekStagedCheckpoint returns the staged checkpoint archive kept as name
+// in the ResourceStore, or nil if there is none.
+func (s *Server) peekStagedCheckpoint(name string) *stagedCheckpoint {
+	resource, ok := s.containerStore.PeekResource(resourcestore.DefaultNamespace, name)
+	if !ok {
+		return nil
+	}
+	staged, ok := resource.(*stagedCheckpoint)
+	if !ok {
+		return nil
+	}
+	return staged
+}
+
+// takeStagedCheckpoint removes the checkpoint archive at location from the
+// ResourceStore and returns it, or nil if it has not been staged. The caller
+// has to remove the staged data with the returned cleaner once it is done
+// with it.
+func (s *Server) takeStagedCheckpoint(ctx context.Context, location string) (*stagedCheckpoint, *resourcestore.ResourceCleaner) {
+	resource, cleaner, ok := s.containerStore.GetResource(resourcestore.DefaultNamespace, stagedCheckpointResourceName(location))
+	if !ok {
+		return nil, nil
+	}
+	staged, ok := resource.(*stagedCheckpoint)
+	if !ok {
+		return nil, nil
+	}
+	log.Infof(ctx, "Restoring from checkpoint archive %s staged in %s", location, staged.dir)
+	return staged, cleaner
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/cri-o/cri-o/internal/resourcestore"
+)
+
+var _ = Describe("ContainerCheckpointStage", func() {
+	var s *Server
+
+	BeforeEach(func() {
+		s = newTestServer()
+	})
+
+	// putStagedCheckpoint adds staged to the container store of the server.
+	putStagedCheckpoint := func(staged *stagedCheckpoint, cleaner *resourcestore.ResourceCleaner) {
+		Expect(s.containerStore.PutWithTimeout("", stagedCheckpointResourceName(staged.location), staged, cleaner, time.Minute)).To(Succeed())
+	}
+
+	Context("StageCheckpoint", func() {
+		It("should fail without checkpoint/restore support", func() {
+			_, err := s.StageCheckpoint(context.Background(), "/cp.tar")
+			Expect(status.Code(err)).To(Equal(codes.Unimplemented))
+		})
+
+		It("should fail with staging disabled", func() {
+			s.config.EnableCriuSupport = true
+			_, err := s.StageCheckpoint(context.Background(), "/cp.tar")
+			Expect(status.Code(err)).To(Equal(codes.Unimplemented))
+		})
+
+		It("should fail without location", func() {
+			s.config.EnableCriuSupport = true
+			s.config.CheckpointStagingTTL = 60
+			_, err := s.StageCheckpoint(context.Background(), "")
+			Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+		})
+
+		It("should return an already staged archive", func() {
+			// Given
+			s.config.EnableCriuSupport = true
+			s.config.CheckpointStagingTTL = 60
+			staged := &stagedCheckpoint{location: "/cp.tar", dir: GinkgoT().TempDir(), expiresAt: time.Now().Add(time.Minute)}
+			putStagedCheckpoint(staged, resourcestore.NewResourceCleaner())
+
+			// When
+			info, err := s.StageCheckpoint(context.Background(), "/cp.tar")
+
+			// Then
+			Expect(err).ToNot(HaveOccurred())
+			Expect(info.Location).To(Equal("/cp.tar"))
+			Expect(info.ExpiresAt).To(BeTemporally("==", staged.expiresAt))
+		})
+	})
+
+	It("should hand a staged archive to a single restore", func() {
+		// Given
+		staged := &stagedCheckpoint{location: "/cp.tar", dir: GinkgoT().TempDir()}
+		cleaner := resourcestore.NewResourceCleaner()
+		cleaner.Add(context.Background(), "remove staged checkpoint", func() error {
+			return os.RemoveAll(staged.dir)
+		})
+		putStagedCheckpoint(staged, cleaner)
+		taken, _ := s.takeStagedCheckpoint(context.Background(), "/other.tar")
+		Expect(taken).To(BeNil())
+
+		// When
+		taken, takenCleaner := s.takeStagedCheckpoint(context.Background(), "/cp.tar")
+
+		// Then
+		Expect(taken).To(BeIdenticalTo(staged))
+		Expect(takenCleaner).To(BeIdenticalTo(cleaner))
+		taken, _ = s.takeStagedCheckpoint(context.Background(), "/cp.tar")
+		Expect(taken).To(BeNil())
+
+		// The restore owns the staged data once it has been taken.
+		Expect(takenCleaner.Cleanup()).To(Succeed())
+		Expect(staged.dir).ToNot(BeAnExistingFile())
+	})
+
+	It("should remove leftover staged data", func() {
+		// Given
+		dir := filepath.Join(GinkgoT().TempDir(), "checkpoint")
+		Expect(os.MkdirAll(filepath.Join(dir, "checkpoint"), 0o700)).To(Succeed())
+		manifest := &resourcestore.CleanupManifest{
+			Type: cleanupManifestStagedCheckpoint,
+			IDs:  map[string]string{cleanupManifestDir: dir},
+		}
+
+		// When
+		err := cleanupLeftoverStagedCheckpoint(context.Background(), manifest)
+
+		// Then
+		Expect(err).ToNot(HaveOccurred())
+		Expect(dir).ToNot(BeAnExistingFile())
+	})
+})
@@ -0,0 +1,45 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/cri-o/cri-o/internal/lib"
+	"github.com/cri-o/cri-o/internal/oci"
+)
+
+var _ = Describe("ContainerCheckpointStatus", func() {
+	DescribeTable("checkpointStatusError",
+		func(err error, expected codes.Code) {
+			statusErr := checkpointStatusError(err)
+			Expect(status.Code(statusErr)).To(Equal(expected))
+			Expect(status.Convert(statusErr).Message()).To(Equal(status.Convert(err).Message()))
+		},
+		Entry("unsupported runtime", fmt.Errorf("failed to checkpoint container ctr: %w", oci.ErrCheckpointRestoreUnsupported), codes.Unimplemented),
+		Entry("unsupported feature", fmt.Errorf("%w: container uses a user namespace", lib.ErrCheckpointUnsupportedFeature), codes.Unimplemented),
+		Entry("freezer unavailable", fmt.Errorf("%w: freezer controller not enabled", lib.ErrFreezerUnavailable), codes.Unimplemented),
+		Entry("precondition", fmt.Errorf("%w: container ctr is not running", lib.ErrCheckpointPrecondition), codes.FailedPrecondition),
+		Entry("diagnostic checkpoint", fmt.Errorf("archive.tar: %w", lib.ErrDiagnosticCheckpoint), codes.FailedPrecondition),
+		Entry("mount not remapped", fmt.Errorf("%w: /data", errCheckpointMountNotRemapped), codes.FailedPrecondition),
+		Entry("incompatible parent", fmt.Errorf("parent.tar: %w: archive has been modified", lib.ErrIncompatibleCheckpointParent), codes.FailedPrecondition),
+		Entry("archive exists", fmt.Errorf("archive.tar: %w", lib.ErrCheckpointArchiveExists), codes.AlreadyExists),
+		Entry("corrupt metadata", fmt.Errorf("checkpoint.json: %w", lib.ErrCorruptCheckpointMetadata), codes.InvalidArgument),
+		Entry("CRIU failure", fmt.Errorf("failed to restore container ctr: %w: %w", lib.ErrCriuFailed, errors.New("exit status 1")), codes.Internal),
+		Entry("process tree", fmt.Errorf("failed to checkpoint container ctr: %w: %w: root process is not a session leader", lib.ErrCriuFailed, oci.ErrCheckpointProcessTree), codes.FailedPrecondition),
+		Entry("incompatible cgroup mode", fmt.Errorf("%w: checkpoint has been created with cgroup v1", lib.ErrIncompatibleCgroupMode), codes.FailedPrecondition),
+		Entry("in progress", fmt.Errorf("%w: ctr", errCheckpointInProgress), codes.Aborted),
+		Entry("canceled", fmt.Errorf("checkpoint of container ctr aborted: %w", context.Canceled), codes.Canceled),
+		Entry("status", status.Error(codes.Unavailable, "unable to pull checkpoint image"), codes.Unavailable),
+	)
+
+	It("should return errors of unknown class unchanged", func() {
+		unknown := errors.New("unknown")
+		Expect(checkpointStatusError(unknown)).To(BeIdenticalTo(unknown))
+	})
+})
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	libconfig "github.com/cri-o/cri-o/pkg/config"
+)
+
+// errCheckpointRestoreDisabled is returned by all checkpoint/restore entry
+// points if checkpoint/restore support is not enabled.
+var errCheckpointRestoreDisabled = status.Error(codes.Unimplemented, "checkpoint/restore support not available")
+
+// CheckpointRestoreSupport describes whether containers can be checkpointed
+// and restored.
+type CheckpointRestoreSupport struct {
+	// Enabled is set if checkpoint/restore support is enabled.
+	Enabled bool `json:"enabled"`
+	// Capabilities are the detected capabilities of the host, if enabled.
+	Capabilities *libconfig.CheckpointRestoreCapabilities `json:"capabilities,omitempty"`
+}
+
+// CheckpointRestoreEnabled returns true if checkpoint/restore support is
+// enabled, so that checkpoint and restore requests are not rejected with
+// codes.Unimplemented.
+func (s *Server) CheckpointRestoreEnabled() bool {
+	return s.config.RuntimeConfig.CheckpointRestore()
+}
+
+// CheckpointRestoreSupport returns whether checkpoint/restore support is
+// enabled, with the capabilities of the host.
+func (s *Server) CheckpointRestoreSupport() *CheckpointRestoreSupport {
+	return &CheckpointRestoreSupport{
+		Enabled:      s.CheckpointRestoreEnabled(),
+		Capabilities: s.config.RuntimeConfig.CheckpointRestoreCapabilities(),
+	}
+}
+
+// checkCheckpointRestoreEnabled returns errCheckpointRestoreDisabled if
+// checkpoint/restore support is not enabled.
+func (s *Server) checkCheckpointRestoreEnabled() error {
+	if !s.CheckpointRestoreEnabled() {
+		return errCheckpointRestoreDisabled
+	}
+	return nil
+}
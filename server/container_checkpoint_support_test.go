@@ -0,0 +1,57 @@
+package server
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	types "k8s.io/cri-api/pkg/apis/runtime/v1"
+)
+
+var _ = Describe("ContainerCheckpointSupport", func() {
+	var s *Server
+
+	BeforeEach(func() {
+		s = &Server{}
+	})
+
+	It("should be disabled by default", func() {
+		Expect(s.CheckpointRestoreEnabled()).To(BeFalse())
+	})
+
+	DescribeTable("should fail if disabled",
+		func(call func(ctx context.Context) error) {
+			err := call(context.Background())
+			Expect(status.Code(err)).To(Equal(codes.Unimplemented))
+			Expect(status.Convert(err).Message()).To(Equal("checkpoint/restore support not available"))
+		},
+		Entry("CheckpointContainer", func(ctx context.Context) error {
+			_, err := s.CheckpointContainer(ctx, &types.CheckpointContainerRequest{ContainerId: "ctr"})
+			return err
+		}),
+		Entry("SubmitCheckpoint", func(ctx context.Context) error {
+			_, err := s.SubmitCheckpoint(ctx, &types.CheckpointContainerRequest{ContainerId: "ctr"})
+			return err
+		}),
+		Entry("GetCheckpointStatus", func(context.Context) error {
+			_, err := s.GetCheckpointStatus("job")
+			return err
+		}),
+		Entry("CancelCheckpoint", func(ctx context.Context) error {
+			return s.CancelCheckpoint(ctx, "ctr")
+		}),
+		Entry("ResetCheckpointBreaker", func(ctx context.Context) error {
+			return s.ResetCheckpointBreaker(ctx, "ctr")
+		}),
+		Entry("StageCheckpoint", func(ctx context.Context) error {
+			_, err := s.StageCheckpoint(ctx, "/cp.tar")
+			return err
+		}),
+		Entry("CRImportCheckpoint", func(ctx context.Context) error {
+			_, err := s.CRImportCheckpoint(ctx, &types.ContainerConfig{}, "sandbox", &types.PodSandboxConfig{})
+			return err
+		}),
+	)
+})
@@ -3,12 +3,16 @@ package server_test
 import (
 	"context"
 	"os"
+	"time"
 
 	criu "github.com/checkpoint-restore/go-criu/v7/utils"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	types "k8s.io/cri-api/pkg/apis/runtime/v1"
+	kubetypes "k8s.io/kubelet/pkg/types"
 
 	"github.com/cri-o/cri-o/internal/oci"
 )
@@ -56,6 +60,39 @@ var _ = t.Describe("ContainerCheckpoint", func() {
 			Expect(err).ToNot(HaveOccurred())
 		})
 
+		It("should succeed with Kubernetes names", func() {
+			// Given
+			testContainer, err := oci.NewContainer(containerID, "", "", "",
+				map[string]string{
+					kubetypes.KubernetesPodNamespaceLabel:  "default",
+					kubetypes.KubernetesPodNameLabel:       "pod",
+					kubetypes.KubernetesContainerNameLabel: "ctr",
+				}, nil, nil, "pauseImage", nil, nil, "",
+				&types.ContainerMetadata{}, sandboxID, false, false,
+				false, "", "", time.Now(), "")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sut.AddSandbox(context.Background(), testSandbox)).To(Succeed())
+			sut.AddContainer(context.Background(), testContainer)
+			Expect(sut.CtrIDIndex().Add(testContainer.ID())).To(Succeed())
+			testContainer.SetCreated()
+
+			testContainer.SetState(&oci.ContainerState{
+				State: specs.State{Status: oci.ContainerStateRunning},
+			})
+			testContainer.SetSpec(&specs.Spec{Version: "1.0.0"})
+
+			// When
+			_, err = sut.CheckpointContainer(
+				context.Background(),
+				&types.CheckpointContainerRequest{
+					ContainerId: "default/pod/ctr",
+				},
+			)
+
+			// Then
+			Expect(err).ToNot(HaveOccurred())
+		})
+
 		It("should fail with invalid container id", func() {
 			// Given
 			// When
@@ -72,6 +109,103 @@ var _ = t.Describe("ContainerCheckpoint", func() {
 	})
 })
 
+var _ = t.Describe("ContainerCheckpoint with short container IDs", func() {
+	// Prepare the sut
+	BeforeEach(func() {
+		beforeEach()
+		createDummyConfig()
+		mockRuntimeInLibConfig()
+		serverConfig.SetCheckpointRestore(true)
+		setupSUT()
+	})
+
+	AfterEach(afterEach)
+
+	t.Describe("ContainerCheckpoint", func() {
+		It("should fail with InvalidArgument on ambiguous prefix", func() {
+			// Given
+			Expect(sut.CtrIDIndex().Add("abc123")).To(Succeed())
+			Expect(sut.CtrIDIndex().Add("abc456")).To(Succeed())
+
+			// When
+			_, err := sut.CheckpointContainer(
+				context.Background(),
+				&types.CheckpointContainerRequest{
+					ContainerId: "abc",
+				},
+			)
+
+			// Then
+			Expect(err).To(HaveOccurred())
+			Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+			Expect(err.Error()).To(ContainSubstring("abc123"))
+			Expect(err.Error()).To(ContainSubstring("abc456"))
+		})
+
+		It("should fail with InvalidArgument on ambiguous Kubernetes names", func() {
+			// Given
+			labels := map[string]string{
+				kubetypes.KubernetesPodNamespaceLabel:  "default",
+				kubetypes.KubernetesPodNameLabel:       "pod",
+				kubetypes.KubernetesContainerNameLabel: "ctr",
+			}
+			Expect(sut.AddSandbox(context.Background(), testSandbox)).To(Succeed())
+			for _, id := range []string{"abc123", "abc456"} {
+				ctr, err := oci.NewContainer(id, "k8s_ctr_"+id, "", "", labels, nil, nil, "", nil, nil, "",
+					&types.ContainerMetadata{}, testSandbox.ID(), false, false, false, "", "", time.Now(), "")
+				Expect(err).ToNot(HaveOccurred())
+				sut.AddContainer(context.Background(), ctr)
+			}
+
+			// When
+			_, err := sut.CheckpointContainer(
+				context.Background(),
+				&types.CheckpointContainerRequest{
+					ContainerId: "default/pod/ctr",
+				},
+			)
+
+			// Then
+			Expect(err).To(HaveOccurred())
+			Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+			Expect(err.Error()).To(ContainSubstring("abc123"))
+			Expect(err.Error()).To(ContainSubstring("abc456"))
+		})
+
+		It("should fail with NotFound on unknown Kubernetes names", func() {
+			// Given
+			// When
+			_, err := sut.CheckpointContainer(
+				context.Background(),
+				&types.CheckpointContainerRequest{
+					ContainerId: "default/pod/ctr",
+				},
+			)
+
+			// Then
+			Expect(err).To(HaveOccurred())
+			Expect(status.Code(err)).To(Equal(codes.NotFound))
+		})
+
+		It("should fail with NotFound on unknown ID", func() {
+			// Given
+			Expect(sut.CtrIDIndex().Add("abc123")).To(Succeed())
+
+			// When
+			_, err := sut.CheckpointContainer(
+				context.Background(),
+				&types.CheckpointContainerRequest{
+					ContainerId: "def",
+				},
+			)
+
+			// Then
+			Expect(err).To(HaveOccurred())
+			Expect(status.Code(err)).To(Equal(codes.NotFound))
+		})
+	})
+})
+
 var _ = t.Describe("ContainerCheckpoint with CheckpointRestore set to false", func() {
 	// Prepare the sut
 	BeforeEach(func() {
@@ -96,7 +230,8 @@ var _ = t.Describe("ContainerCheckpoint with CheckpointRestore set to false", fu
 			)
 
 			// Then
-			Expect(err.Error()).To(Equal(`checkpoint/restore support not available`))
+			Expect(status.Code(err)).To(Equal(codes.Unimplemented))
+			Expect(status.Convert(err).Message()).To(Equal(`checkpoint/restore support not available`))
 		})
 	})
 })
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"google.golang.org/grpc"
+	grpcmetadata "google.golang.org/grpc/metadata"
+
+	"github.com/cri-o/cri-o/internal/log"
+	"github.com/cri-o/cri-o/internal/oci"
+)
+
+const (
+	// checkpointVerifyMetadata is the gRPC request metadata by which clients
+	// ask for the verification of the checkpoint by a test restore.
+	checkpointVerifyMetadata = "checkpoint-verify"
+
+	// checkpointVerificationHeader is the gRPC response header holding the
+	// outcome of the verification of a checkpoint.
+	checkpointVerificationHeader = "checkpoint-verification"
+
+	// checkpointVerificationErrorHeader is the gRPC response header holding
+	// the reason of a failed verification.
+	checkpointVerificationErrorHeader = "checkpoint-verification-error"
+)
+
+// Outcomes of the verification of a checkpoint returned in the
+// checkpointVerificationHeader.
+const (
+	checkpointVerificationPassed   = "passed"
+	checkpointVerificationFailed   = "failed"
+	checkpointVerificationDisabled = "disabled"
+)
+
+// checkpointVerifyRequested returns whether the client asked for the
+// verification of the checkpoint in the metadata of the request.
+func checkpointVerifyRequested(ctx context.Context) bool {
+	md, ok := grpcmetadata.FromIncomingContext(ctx)
+	if !ok {
+		return false
+	}
+	values := md.Get(checkpointVerifyMetadata)
+	if len(values) == 0 {
+		return false
+	}
+	verify, err := strconv.ParseBool(values[0])
+	return err == nil && verify
+}
+
+// verifyCheckpoint test-restores the checkpoint archive of ctr at target and
+// returns the outcome in the response header. A failed verification does not
+// fail the checkpoint, which has been written already. At most
+// checkpoint_verify_max_concurrent verifications run at the same time, and
+// only one checkpoint or verification of a container.
+func (s *Server) verifyCheckpoint(ctx context.Context, ctr *oci.Container, target string) {
+	if cap(s.checkpointVerifySlots) == 0 {
+		log.Infof(ctx, "Not verifying checkpoint of container %s, checkpoint_verify_max_concurrent is 0", ctr.ID())
+		setCheckpointVerificationHeader(ctx, checkpointVerificationDisabled, nil)
+		return
+	}
+	err := s.runCheckpointVerification(ctx, ctr, target)
+	if err != nil {
+		log.Warnf(ctx, "Verification of checkpoint %s of container %s failed: %v", target, ctr.ID(), err)
+		setCheckpointVerificationHeader(ctx, checkpointVerificationFailed, err)
+		return
+	}
+	log.Infof(ctx, "Verified checkpoint %s of container %s", target, ctr.ID())
+	setCheckpointVerificationHeader(ctx, checkpointVerificationPassed, nil)
+}
+
+// runCheckpointVerification waits for a free verification slot and runs the
+// test restore of the checkpoint archive of ctr at target.
+func (s *Server) runCheckpointVerification(ctx context.Context, ctr *oci.Container, target string) error {
+	select {
+	case s.checkpointVerifySlots <- struct{}{}:
+	case <-ctx.Done():
+		return fmt.Errorf("waiting for a free checkpoint verification slot: %w", ctx.Err())
+	}
+	defer func() { <-s.checkpointVerifySlots }()
+
+	verifyCtx, done, err := s.checkpointContext(ctx, ctr.ID(), true)
+	if err != nil {
+		return err
+	}
+	defer done()
+	return s.ContainerServer.VerifyCheckpoint(verifyCtx, ctr, target)
+}
+
+// setCheckpointVerificationHeader returns the outcome of the verification of
+// a checkpoint and the reason of a failure in the response header.
+func setCheckpointVerificationHeader(ctx context.Context, outcome string, verifyErr error) {
+	md := grpcmetadata.Pairs(checkpointVerificationHeader, outcome)
+	if verifyErr != nil {
+		md.Set(checkpointVerificationErrorHeader, verifyErr.Error())
+	}
+	if err := grpc.SetHeader(ctx, md); err != nil {
+		log.Debugf(ctx, "Unable to set checkpoint verification header: %v", err)
+	}
+}
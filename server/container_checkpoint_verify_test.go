@@ -0,0 +1,31 @@
+package server
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	grpcmetadata "google.golang.org/grpc/metadata"
+)
+
+// metadataContext returns a context of an incoming request with md.
+func metadataContext(md grpcmetadata.MD) context.Context {
+	if md == nil {
+		return context.Background()
+	}
+	return grpcmetadata.NewIncomingContext(context.Background(), md)
+}
+
+var _ = Describe("ContainerCheckpointVerify", func() {
+	DescribeTable("checkpointVerifyRequested",
+		func(md grpcmetadata.MD, expected bool) {
+			Expect(checkpointVerifyRequested(metadataContext(md))).To(Equal(expected))
+		},
+		Entry("without metadata", nil, false),
+		Entry("other metadata", grpcmetadata.Pairs("other", "true"), false),
+		Entry("requested", grpcmetadata.Pairs(checkpointVerifyMetadata, "true"), true),
+		Entry("requested in other case", grpcmetadata.Pairs("Checkpoint-Verify", "1"), true),
+		Entry("not requested", grpcmetadata.Pairs(checkpointVerifyMetadata, "false"), false),
+		Entry("invalid", grpcmetadata.Pairs(checkpointVerifyMetadata, "yes"), false),
+	)
+})
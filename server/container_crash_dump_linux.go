@@ -0,0 +1,308 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	metadata "github.com/checkpoint-restore/checkpointctl/lib"
+	"github.com/fsnotify/fsnotify"
+	"golang.org/x/sys/unix"
+
+	"github.com/cri-o/cri-o/internal/config/node"
+	"github.com/cri-o/cri-o/internal/log"
+	"github.com/cri-o/cri-o/internal/oci"
+	"github.com/cri-o/cri-o/pkg/annotations"
+)
+
+// crashDumpWatcher tracks a single container opted into crash dumps.
+type crashDumpWatcher struct {
+	cancel context.CancelFunc
+	// cgroupDir is the memory cgroup of the container, used to attribute
+	// crashing processes to the container.
+	cgroupDir string
+	limiter   crashDumpLimiter
+}
+
+// crashDumpLimiter rate-limits the crash dumps of a single container.
+type crashDumpLimiter struct {
+	mutex    sync.Mutex
+	interval time.Duration
+	lastDump time.Time
+}
+
+// allow reports whether a crash dump may be written at now. If so, now is
+// recorded as the time of the last dump.
+func (l *crashDumpLimiter) allow(now time.Time) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if !l.lastDump.IsZero() && now.Sub(l.lastDump) < l.interval {
+		return false
+	}
+	l.lastDump = now
+	return true
+}
+
+// startCrashDumpWatcher starts watching the container for crashes if it
+// opted into crash dumps via the CheckpointOnOOMAnnotation.
+// A checkpoint is taken when the kernel reports memory pressure or an OOM
+// event for the container, before the OOM killer tears the container down,
+// and when a process of the container is killed by a fatal signal while the
+// container keeps running. A crash of the container's init process ends the
+// container and cannot be dumped anymore.
+func (s *Server) startCrashDumpWatcher(ctx context.Context, c *oci.Container) {
+	if c.Annotations()[annotations.CheckpointOnOOMAnnotation] != "true" {
+		return
+	}
+	if !s.CheckpointRestoreEnabled() {
+		log.Warnf(ctx, "Not watching container %s for crash dumps: checkpoint/restore support not available", c.ID())
+		return
+	}
+	if s.config.CrashDumpDir == "" {
+		log.Warnf(ctx, "Not watching container %s for crash dumps: no crash_dump_dir configured", c.ID())
+		return
+	}
+
+	sb := s.getSandbox(ctx, c.Sandbox())
+	if sb == nil {
+		return
+	}
+	cgMgr, err := s.config.CgroupManager().ContainerCgroupManager(sb.CgroupParent(), c.ID())
+	if err != nil {
+		log.Warnf(ctx, "Not watching container %s for crash dumps: %v", c.ID(), err)
+		return
+	}
+
+	watchCtx, cancel := context.WithCancel(context.Background())
+	watcher := &crashDumpWatcher{
+		cancel: cancel,
+		limiter: crashDumpLimiter{
+			interval: time.Duration(s.config.CrashDumpInterval) * time.Second,
+		},
+	}
+	trigger := func(reason string) {
+		s.crashDump(watchCtx, c, watcher, reason)
+	}
+	if node.CgroupIsV2() {
+		watcher.cgroupDir = cgMgr.Path("")
+		eventsFile := filepath.Join(watcher.cgroupDir, "memory.events")
+		log.Infof(ctx, "Watching container %s for crash dumps using %s", c.ID(), eventsFile)
+		go func() {
+			if err := watchMemoryEvents(watchCtx, eventsFile, trigger); err != nil {
+				log.Warnf(ctx, "Stopped watching memory events of container %s: %v", c.ID(), err)
+			}
+		}()
+	} else {
+		watcher.cgroupDir = cgMgr.Path("memory")
+		log.Infof(ctx, "Watching container %s for crash dumps using %s", c.ID(), watcher.cgroupDir)
+		go func() {
+			if err := watchOOMControl(watchCtx, watcher.cgroupDir, trigger); err != nil {
+				log.Warnf(ctx, "Stopped watching OOM events of container %s: %v", c.ID(), err)
+			}
+		}()
+	}
+
+	if old, loaded := s.crashDumpWatchers.Swap(c.ID(), watcher); loaded {
+		if oldWatcher, ok := old.(*crashDumpWatcher); ok {
+			oldWatcher.cancel()
+		}
+	}
+	s.startFatalSignalMonitor(ctx)
+}
+
+// removeCrashDumpWatcher stops the crash dump watcher of the container, if any.
+func (s *Server) removeCrashDumpWatcher(c *oci.Container) {
+	if watcher, ok := s.crashDumpWatchers.LoadAndDelete(c.ID()); ok {
+		if w, ok := watcher.(*crashDumpWatcher); ok {
+			w.cancel()
+		}
+	}
+}
+
+// startCrashDumpWatchers re-establishes the crash dump watchers of all
+// running containers, for example after CRI-O has been restarted.
+func (s *Server) startCrashDumpWatchers(ctx context.Context) {
+	containers, err := s.ContainerServer.ListContainers()
+	if err != nil {
+		log.Warnf(ctx, "Unable to list containers to watch for crash dumps: %v", err)
+		return
+	}
+	for _, c := range containers {
+		if c.State().Status == oci.ContainerStateRunning {
+			s.startCrashDumpWatcher(ctx, c)
+		}
+	}
+}
+
+// watchMemoryEvents calls trigger whenever the cgroup v2 memory.events file
+// reports a new memory.high or OOM event. The kernel notifies inotify
+// watchers of the file on every change.
+func watchMemoryEvents(ctx context.Context, eventsFile string, trigger func(reason string)) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+	if err := watcher.Add(eventsFile); err != nil {
+		return err
+	}
+
+	previous, err := readMemoryEvents(eventsFile)
+	if err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-watcher.Errors:
+			return err
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Op&fsnotify.Write != fsnotify.Write {
+				continue
+			}
+		}
+
+		current, err := readMemoryEvents(eventsFile)
+		if err != nil {
+			// The cgroup is gone, the container exited.
+			return nil
+		}
+		if reason := memoryEventsReason(previous, current); reason != "" {
+			trigger(reason)
+		}
+		previous = current
+	}
+}
+
+// memoryEventsReason returns why a crash dump is due when the memory events
+// changed from previous to current, or an empty string if none is.
+func memoryEventsReason(previous, current map[string]uint64) string {
+	switch {
+	case current["oom"] > previous["oom"]:
+		return "out of memory"
+	case current["high"] > previous["high"]:
+		return "memory pressure"
+	}
+	return ""
+}
+
+// watchOOMControl calls trigger whenever the kernel reports an OOM event
+// for the cgroup v1 memory cgroup in dir. The notification is delivered
+// through an eventfd registered for memory.oom_control.
+func watchOOMControl(ctx context.Context, dir string, trigger func(reason string)) error {
+	oomControl, err := os.Open(filepath.Join(dir, "memory.oom_control"))
+	if err != nil {
+		return err
+	}
+	defer oomControl.Close()
+
+	fd, err := unix.Eventfd(0, unix.EFD_CLOEXEC|unix.EFD_NONBLOCK)
+	if err != nil {
+		return fmt.Errorf("failed to create eventfd: %w", err)
+	}
+	eventFile := os.NewFile(uintptr(fd), "oom-eventfd")
+	defer eventFile.Close()
+
+	registration := fmt.Sprintf("%d %d", fd, oomControl.Fd())
+	if err := os.WriteFile(filepath.Join(dir, "cgroup.event_control"), []byte(registration), 0o200); err != nil {
+		return fmt.Errorf("failed to register OOM notification: %w", err)
+	}
+
+	// Closing the eventfd unblocks the pending read.
+	stop := context.AfterFunc(ctx, func() {
+		eventFile.Close()
+	})
+	defer stop()
+
+	buf := make([]byte, 8)
+	for {
+		if _, err := eventFile.Read(buf); err != nil {
+			if ctx.Err() != nil || errors.Is(err, os.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		// The eventfd also fires when the cgroup is removed.
+		if _, err := os.Stat(filepath.Join(dir, "memory.oom_control")); err != nil {
+			return nil
+		}
+		trigger("out of memory")
+	}
+}
+
+// crashDump checkpoints the container into the configured crash dump
+// directory, rate-limited to once per crash_dump_interval.
+func (s *Server) crashDump(ctx context.Context, c *oci.Container, watcher *crashDumpWatcher, reason string) {
+	now := time.Now()
+	if !watcher.limiter.allow(now) {
+		log.Debugf(ctx, "Skipping crash dump of container %s on %s: rate limited", c.ID(), reason)
+		return
+	}
+
+	if err := os.MkdirAll(s.config.CrashDumpDir, 0o700); err != nil {
+		log.Errorf(ctx, "Unable to create crash dump directory %s: %v", s.config.CrashDumpDir, err)
+		return
+	}
+	target := filepath.Join(
+		s.config.CrashDumpDir,
+		fmt.Sprintf("%s-%d.tar", c.ID(), now.Unix()),
+	)
+	opts, err := s.checkpointArchiveOptions(c, target)
+	if err != nil {
+		log.Errorf(ctx, "Unable to write crash dump of container %s: %v", c.ID(), err)
+		return
+	}
+	opts.KeepRunning = true
+
+	log.Infof(ctx, "Container %s reported %s, writing crash dump to %s", c.ID(), reason, target)
+	if _, err := s.checkpointOnce(ctx, c.ID(), target, func() (string, error) {
+		// Do not queue up behind a running checkpoint, it already
+		// captures the state of the container.
+		checkpointCtx, done, err := s.checkpointContext(ctx, c.ID(), false)
+		if err != nil {
+			return "", err
+		}
+		defer done()
+		_, err = s.ContainerServer.ContainerCheckpoint(checkpointCtx, &metadata.ContainerConfig{ID: c.ID()}, opts)
+		return target, err
+	}); err != nil {
+		log.Errorf(ctx, "Unable to write crash dump of container %s: %v", c.ID(), err)
+		return
+	}
+	log.Infof(ctx, "Wrote crash dump of container %s to %s", c.ID(), target)
+}
+
+// readMemoryEvents parses a cgroup v2 memory.events file.
+func readMemoryEvents(path string) (map[string]uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	events := make(map[string]uint64)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		events[fields[0]] = value
+	}
+	return events, scanner.Err()
+}
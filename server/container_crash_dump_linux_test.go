@@ -0,0 +1,165 @@
+package server
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"golang.org/x/sys/unix"
+)
+
+var _ = Describe("ContainerCrashDump", func() {
+	var path string
+
+	BeforeEach(func() {
+		path = filepath.Join(GinkgoT().TempDir(), "memory.events")
+	})
+
+	It("should read the memory events", func() {
+		// Given
+		content := "low 0\nhigh 12\nmax 3\noom 1\noom_kill 1\ninvalid\nbroken x\n"
+		Expect(os.WriteFile(path, []byte(content), 0o644)).To(Succeed())
+
+		// When
+		events, err := readMemoryEvents(path)
+
+		// Then
+		Expect(err).ToNot(HaveOccurred())
+		Expect(events).To(Equal(map[string]uint64{"low": 0, "high": 12, "max": 3, "oom": 1, "oom_kill": 1}))
+	})
+
+	It("should fail to read missing memory events", func() {
+		_, err := readMemoryEvents(path)
+		Expect(err).To(HaveOccurred())
+	})
+
+	DescribeTable("memoryEventsReason",
+		func(previous, current map[string]uint64, expected string) {
+			Expect(memoryEventsReason(previous, current)).To(Equal(expected))
+		},
+		Entry("unchanged", map[string]uint64{"high": 1}, map[string]uint64{"high": 1}, ""),
+		Entry("memory pressure", map[string]uint64{"high": 1}, map[string]uint64{"high": 2}, "memory pressure"),
+		Entry("out of memory", map[string]uint64{"oom": 0}, map[string]uint64{"oom": 1, "high": 2}, "out of memory"),
+		Entry("other events", map[string]uint64{}, map[string]uint64{"max": 5, "low": 1}, ""),
+	)
+
+	It("should rate limit the dumps", func() {
+		limiter := crashDumpLimiter{interval: time.Minute}
+		now := time.Now()
+
+		Expect(limiter.allow(now)).To(BeTrue())
+		Expect(limiter.allow(now.Add(30 * time.Second))).To(BeFalse())
+		Expect(limiter.allow(now.Add(time.Minute))).To(BeTrue())
+		// The interval restarts with the last dump.
+		Expect(limiter.allow(now.Add(time.Minute + time.Second))).To(BeFalse())
+	})
+
+	It("should not rate limit without interval", func() {
+		unlimited := crashDumpLimiter{}
+		now := time.Now()
+		Expect(unlimited.allow(now)).To(BeTrue())
+		Expect(unlimited.allow(now)).To(BeTrue())
+	})
+
+	It("should watch the memory events", func() {
+		// Given
+		Expect(os.WriteFile(path, []byte("high 0\noom 0\n"), 0o644)).To(Succeed())
+		ctx, cancel := context.WithCancel(context.Background())
+		reasons := make(chan string, 10)
+		done := make(chan error)
+		go func() {
+			done <- watchMemoryEvents(ctx, path, func(reason string) {
+				reasons <- reason
+			})
+		}()
+
+		// Then
+		// The watch is established asynchronously, keep updating the
+		// counters until the first notification arrives.
+		i := 0
+		Eventually(func(g Gomega) string {
+			i++
+			g.Expect(os.WriteFile(path, []byte(fmt.Sprintf("high 0\noom %d\n", i)), 0o644)).To(Succeed())
+			select {
+			case reason := <-reasons:
+				return reason
+			case <-time.After(100 * time.Millisecond):
+				return ""
+			}
+		}).WithTimeout(10 * time.Second).Should(Equal("out of memory"))
+
+		// When
+		cancel()
+
+		// Then
+		Eventually(done).WithTimeout(10 * time.Second).Should(Receive(BeNil()))
+	})
+
+	It("should parse exit events", func() {
+		// Given
+		buf := make([]byte, cnMsgHeaderLen+procEventHeaderLen+procExitEventLen)
+		event := buf[cnMsgHeaderLen:]
+		binary.NativeEndian.PutUint32(event[0:4], procEventExit)
+		data := event[procEventHeaderLen:]
+		binary.NativeEndian.PutUint32(data[0:4], 42)
+		binary.NativeEndian.PutUint32(data[4:8], 42)
+		binary.NativeEndian.PutUint32(data[8:12], uint32(unix.SIGSEGV)|0x80)
+		binary.NativeEndian.PutUint32(data[20:24], 7)
+
+		// When
+		exit, err := parseProcExitEvent(buf)
+
+		// Then
+		Expect(err).ToNot(HaveOccurred())
+		Expect(exit).ToNot(BeNil())
+		Expect(exit.pid).To(BeEquivalentTo(42))
+		Expect(exit.tgid).To(BeEquivalentTo(42))
+		Expect(exit.parentTgid).To(BeEquivalentTo(7))
+		Expect(exit.signal()).To(Equal(unix.SIGSEGV))
+
+		// When
+		binary.NativeEndian.PutUint32(event[0:4], 0x1)
+
+		// Then
+		// Other events are ignored.
+		Expect(parseProcExitEvent(buf)).To(BeNil())
+		Expect(parseProcExitEvent(buf[:cnMsgHeaderLen])).Error().To(HaveOccurred())
+		binary.NativeEndian.PutUint32(event[0:4], procEventExit)
+		Expect(parseProcExitEvent(buf[:cnMsgHeaderLen+procEventHeaderLen+4])).Error().To(HaveOccurred())
+	})
+
+	DescribeTable("isFatalSignal",
+		func(sig unix.Signal, expected bool) {
+			Expect(isFatalSignal(sig)).To(Equal(expected))
+		},
+		Entry("SIGSEGV", unix.SIGSEGV, true),
+		Entry("SIGBUS", unix.SIGBUS, true),
+		Entry("SIGILL", unix.SIGILL, true),
+		Entry("SIGFPE", unix.SIGFPE, true),
+		Entry("SIGABRT", unix.SIGABRT, true),
+		Entry("SIGSYS", unix.SIGSYS, true),
+		Entry("SIGTRAP", unix.SIGTRAP, true),
+		Entry("no signal", unix.Signal(0), false),
+		Entry("SIGTERM", unix.SIGTERM, false),
+		Entry("SIGKILL", unix.SIGKILL, false),
+		Entry("SIGINT", unix.SIGINT, false),
+		Entry("SIGHUP", unix.SIGHUP, false),
+	)
+
+	DescribeTable("cgroupsContain",
+		func(cgroups string, expected bool) {
+			Expect(cgroupsContain(cgroups, "/sys/fs/cgroup/kubepods.slice/pod.slice/crio-abc.scope")).To(Equal(expected))
+		},
+		Entry("cgroup of the container", "0::/kubepods.slice/pod.slice/crio-abc.scope\n", true),
+		Entry("child cgroup", "0::/kubepods.slice/pod.slice/crio-abc.scope/child\n", true),
+		Entry("cgroup with the same prefix", "0::/kubepods.slice/pod.slice/crio-abcd.scope\n", false),
+		Entry("parent cgroup", "0::/kubepods.slice/pod.slice\n", false),
+		Entry("root cgroup", "0::/\n", false),
+		Entry("cgroup v1", "12:freezer:/other\n4:memory:/kubepods.slice/pod.slice/crio-abc.scope\n", true),
+	)
+})
@@ -0,0 +1,190 @@
+package server
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/cri-o/cri-o/internal/log"
+)
+
+// Constants of the kernel process events connector, see
+// include/uapi/linux/cn_proc.h and include/uapi/linux/connector.h.
+const (
+	cnIdxProc          = 0x1
+	cnValProc          = 0x1
+	procCnMcastListen  = 0x1
+	procEventExit      = 0x80000000
+	cnMsgHeaderLen     = 20
+	procEventHeaderLen = 16
+	procExitEventLen   = 24
+)
+
+// procExitEvent is an exit notification of the process events connector.
+type procExitEvent struct {
+	pid        uint32
+	tgid       uint32
+	exitCode   uint32
+	parentTgid uint32
+}
+
+// signal returns the signal which terminated the process, or 0 if it
+// exited normally.
+func (e *procExitEvent) signal() unix.Signal {
+	return unix.Signal(e.exitCode & 0x7f)
+}
+
+// isFatalSignal reports whether a process terminated by sig crashed.
+func isFatalSignal(sig unix.Signal) bool {
+	switch sig {
+	case unix.SIGSEGV, unix.SIGBUS, unix.SIGILL, unix.SIGFPE, unix.SIGABRT, unix.SIGSYS, unix.SIGTRAP:
+		return true
+	}
+	return false
+}
+
+// parseProcExitEvent parses the payload of a process events connector
+// message following the netlink header. It returns nil for events other
+// than process exits.
+func parseProcExitEvent(buf []byte) (*procExitEvent, error) {
+	if len(buf) < cnMsgHeaderLen+procEventHeaderLen {
+		return nil, fmt.Errorf("short process event of %d bytes", len(buf))
+	}
+	event := buf[cnMsgHeaderLen:]
+	if binary.NativeEndian.Uint32(event[0:4]) != procEventExit {
+		return nil, nil
+	}
+	data := event[procEventHeaderLen:]
+	if len(data) < procExitEventLen {
+		return nil, fmt.Errorf("short process exit event of %d bytes", len(data))
+	}
+	return &procExitEvent{
+		pid:        binary.NativeEndian.Uint32(data[0:4]),
+		tgid:       binary.NativeEndian.Uint32(data[4:8]),
+		exitCode:   binary.NativeEndian.Uint32(data[8:12]),
+		parentTgid: binary.NativeEndian.Uint32(data[20:24]),
+	}, nil
+}
+
+// startFatalSignalMonitor starts listening for processes killed by fatal
+// signals once the first container opted into crash dumps.
+func (s *Server) startFatalSignalMonitor(ctx context.Context) {
+	s.fatalSignalMonitor.Do(func() {
+		sock, err := openProcConnector()
+		if err != nil {
+			log.Warnf(ctx, "Not watching containers for fatal signals: %v", err)
+			return
+		}
+		go s.monitorFatalSignals(context.WithoutCancel(ctx), sock)
+	})
+}
+
+// openProcConnector subscribes to the process events of the kernel.
+// This requires CAP_NET_ADMIN in the initial user namespace.
+func openProcConnector() (int, error) {
+	sock, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, unix.NETLINK_CONNECTOR)
+	if err != nil {
+		return -1, fmt.Errorf("failed to open process connector: %w", err)
+	}
+	if err := unix.Bind(sock, &unix.SockaddrNetlink{
+		Family: unix.AF_NETLINK,
+		Groups: cnIdxProc,
+		Pid:    uint32(os.Getpid()),
+	}); err != nil {
+		unix.Close(sock)
+		return -1, fmt.Errorf("failed to bind process connector: %w", err)
+	}
+
+	msg := make([]byte, unix.NLMSG_HDRLEN+cnMsgHeaderLen+4)
+	binary.NativeEndian.PutUint32(msg[0:4], uint32(len(msg)))
+	binary.NativeEndian.PutUint16(msg[4:6], unix.NLMSG_DONE)
+	binary.NativeEndian.PutUint32(msg[12:16], uint32(os.Getpid()))
+	cn := msg[unix.NLMSG_HDRLEN:]
+	binary.NativeEndian.PutUint32(cn[0:4], cnIdxProc)
+	binary.NativeEndian.PutUint32(cn[4:8], cnValProc)
+	binary.NativeEndian.PutUint16(cn[16:18], 4)
+	binary.NativeEndian.PutUint32(cn[cnMsgHeaderLen:], procCnMcastListen)
+	if err := unix.Sendto(sock, msg, 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		unix.Close(sock)
+		return -1, fmt.Errorf("failed to subscribe to process events: %w", err)
+	}
+	return sock, nil
+}
+
+// monitorFatalSignals dumps the containers whose processes are killed by a
+// fatal signal. The process is gone by the time the exit event arrives, so
+// the container is identified by the cgroup of its parent.
+func (s *Server) monitorFatalSignals(ctx context.Context, sock int) {
+	defer unix.Close(sock)
+	buf := make([]byte, os.Getpagesize())
+	for {
+		n, _, err := unix.Recvfrom(sock, buf, 0)
+		if err != nil {
+			if errors.Is(err, unix.EINTR) || errors.Is(err, unix.ENOBUFS) {
+				continue
+			}
+			log.Warnf(ctx, "Stopped watching containers for fatal signals: %v", err)
+			return
+		}
+		msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			continue
+		}
+		for _, msg := range msgs {
+			event, err := parseProcExitEvent(msg.Data)
+			if err != nil || event == nil {
+				continue
+			}
+			if event.pid != event.tgid || !isFatalSignal(event.signal()) {
+				continue
+			}
+			s.fatalSignal(ctx, event)
+		}
+	}
+}
+
+// fatalSignal writes a crash dump of the container of the parent of the
+// crashed process, if it is watched for crash dumps.
+func (s *Server) fatalSignal(ctx context.Context, event *procExitEvent) {
+	cgroups, err := os.ReadFile(fmt.Sprintf("/proc/%d/cgroup", event.parentTgid))
+	if err != nil {
+		return
+	}
+	s.crashDumpWatchers.Range(func(key, value any) bool {
+		watcher, ok := value.(*crashDumpWatcher)
+		if !ok || watcher.cgroupDir == "" || !cgroupsContain(string(cgroups), watcher.cgroupDir) {
+			return true
+		}
+		c := s.GetContainer(ctx, key.(string))
+		if c == nil {
+			return false
+		}
+		reason := fmt.Sprintf("process %d killed by %s", event.pid, unix.SignalName(event.signal()))
+		go s.crashDump(ctx, c, watcher, reason)
+		return false
+	})
+}
+
+// cgroupsContain reports whether one of the cgroups of a /proc/<pid>/cgroup
+// file is the absolute cgroup directory dir or one of its children.
+func cgroupsContain(cgroups, dir string) bool {
+	for _, line := range strings.Split(cgroups, "\n") {
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		for p := parts[2]; p != "/" && p != "."; p = filepath.Dir(p) {
+			if strings.HasSuffix(dir, p) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+// +build !linux
+
+package server
+
+import (
+	"context"
+
+	"github.com/cri-o/cri-o/internal/oci"
+)
+
+func (s *Server) startCrashDumpWatcher(ctx context.Context, c *oci.Container) {
+}
+
+func (s *Server) removeCrashDumpWatcher(c *oci.Container) {
+}
+
+func (s *Server) startCrashDumpWatchers(ctx context.Context) {
+}
@@ -19,6 +19,7 @@ import (
 	types "k8s.io/cri-api/pkg/apis/runtime/v1"
 
 	"github.com/cri-o/cri-o/internal/factory/container"
+	"github.com/cri-o/cri-o/internal/lib"
 	"github.com/cri-o/cri-o/internal/lib/sandbox"
 	"github.com/cri-o/cri-o/internal/log"
 	"github.com/cri-o/cri-o/internal/resourcestore"
@@ -30,6 +31,10 @@ import (
 // sync with https://github.com/containers/storage/blob/7fe03f6c765f2adbc75a5691a1fb4f19e56e7071/pkg/truncindex/truncindex.go#L92
 const noSuchID = "no such id"
 
+// resourceLabelSandboxID labels the ResourceStore entries of container
+// creations with the ID of their pod sandbox.
+const resourceLabelSandboxID = "sandbox-id"
+
 type orderedMounts []rspec.Mount
 
 // Len returns the number of mounts. Used in sorting.
@@ -359,7 +364,7 @@ func (s *Server) CreateContainer(ctx context.Context, req *types.CreateContainer
 
 	// Check if image is a file. If it is a file it might be a checkpoint archive.
 	checkpointImage, err := func() (bool, error) {
-		if !s.config.CheckpointRestore() {
+		if !s.CheckpointRestoreEnabled() {
 			// If CRIU support is not enabled return from
 			// this check as early as possible.
 			return false, nil
@@ -372,10 +377,14 @@ func (s *Server) CreateContainer(ctx context.Context, req *types.CreateContainer
 			)
 			return true, nil
 		}
+		if lib.IsRemoteCheckpointLocation(req.Config.Image.Image) {
+			log.Debugf(ctx, "%q is in an object store, assuming it is a checkpoint archive", req.Config.Image.Image)
+			return true, nil
+		}
 		// Check if this is an OCI checkpoint image
-		imageID, err := s.checkIfCheckpointOCIImage(ctx, req.Config.Image.Image)
+		imageID, err := s.checkpointImageForCreate(ctx, req.Config.Image.Image, req.SandboxConfig)
 		if err != nil {
-			return false, fmt.Errorf("failed to check if this is a checkpoint image: %w", err)
+			return false, err
 		}
 
 		return imageID != nil, nil
@@ -391,10 +400,10 @@ func (s *Server) CreateContainer(ctx context.Context, req *types.CreateContainer
 			ctx,
 			req.Config,
 			req.PodSandboxId,
-			req.SandboxConfig.Metadata.Uid,
+			req.SandboxConfig,
 		)
 		if err != nil {
-			return nil, err
+			return nil, checkpointStatusError(err)
 		}
 		log.Debugf(ctx, "Prepared %s for restore\n", ctrID)
 
@@ -452,14 +461,22 @@ func (s *Server) CreateContainer(ctx context.Context, req *types.CreateContainer
 		if reservedCtr := s.GetContainer(ctx, reservedID); reservedCtr != nil && reservedCtr.Created() {
 			return &types.CreateContainerResponse{ContainerId: reservedID}, nil
 		}
-		cachedID, resourceErr := s.getResourceOrWait(ctx, ctr.Name(), "container")
+		cached, resourceErr := s.getResourceOrWait(ctx, s.containerStore, ctr.Name(), "container")
 		if resourceErr == nil {
-			return &types.CreateContainerResponse{ContainerId: cachedID}, nil
+			return &types.CreateContainerResponse{ContainerId: cached.ID()}, nil
 		}
 		return nil, fmt.Errorf("%w: %w", resourceErr, err)
 	}
 
-	s.resourceStore.SetStageForResource(ctx, ctr.Name(), "container creating")
+	s.containerStore.SetStageForResource(ctx, resourcestore.DefaultNamespace, ctr.Name(), "container creating")
+	s.containerStore.Claim(resourcestore.DefaultNamespace, ctr.Name())
+	s.containerStore.SetLabelsForResource(resourcestore.DefaultNamespace, ctr.Name(), map[string]string{resourceLabelSandboxID: sb.ID()})
+	defer func() {
+		// Let retried requests waiting for this creation fail with its cause.
+		if retErr != nil && !isContextError(retErr) {
+			s.containerStore.Fail(resourcestore.DefaultNamespace, ctr.Name(), retErr)
+		}
+	}()
 
 	resourceCleaner.Add(ctx, "createCtr: releasing container name "+ctr.Name(), func() error {
 		s.ReleaseContainerName(ctx, ctr.Name())
@@ -498,7 +515,7 @@ func (s *Server) CreateContainer(ctx context.Context, req *types.CreateContainer
 		return nil, err
 	}
 
-	s.resourceStore.SetStageForResource(ctx, ctr.Name(), "container runtime creation")
+	s.containerStore.SetStageForResource(ctx, resourcestore.DefaultNamespace, ctr.Name(), "container runtime creation")
 	if err := s.createContainerPlatform(ctx, newContainer, sb.CgroupParent(), mappings); err != nil {
 		return nil, err
 	}
@@ -514,7 +531,8 @@ func (s *Server) CreateContainer(ctx context.Context, req *types.CreateContainer
 	}
 
 	if isContextError(ctx.Err()) {
-		if err := s.resourceStore.Put(ctr.Name(), newContainer, resourceCleaner); err != nil {
+		setContainerCleanupManifest(resourceCleaner, newContainer.ID())
+		if err := s.containerStore.Put(resourcestore.DefaultNamespace, ctr.Name(), newContainer, resourceCleaner); err != nil {
 			log.Errorf(ctx, "CreateCtr: failed to save progress of container %s: %v", newContainer.ID(), err)
 		}
 		log.Infof(ctx, "CreateCtr: context was either canceled or the deadline was exceeded: %v", ctx.Err())
@@ -522,7 +540,7 @@ func (s *Server) CreateContainer(ctx context.Context, req *types.CreateContainer
 	}
 
 	// Since it's not a context error, we can delete the resource from the store, it will be tracked in the server from now on.
-	s.resourceStore.Delete(ctr.Name())
+	s.containerStore.Delete(resourcestore.DefaultNamespace, ctr.Name())
 
 	newContainer.SetCreated()
 
@@ -0,0 +1,246 @@
+package server
+
+import (
+	"context"
+	"errors"
+
+	metadata "github.com/checkpoint-restore/checkpointctl/lib"
+	"github.com/containers/image/v5/docker/reference"
+	istorage "github.com/containers/image/v5/storage"
+	imageTypes "github.com/containers/image/v5/types"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+	"go.uber.org/mock/gomock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	types "k8s.io/cri-api/pkg/apis/runtime/v1"
+
+	"github.com/cri-o/cri-o/internal/lib"
+	"github.com/cri-o/cri-o/internal/storage"
+	"github.com/cri-o/cri-o/internal/storage/references"
+	"github.com/cri-o/cri-o/pkg/annotations"
+	criostoragemock "github.com/cri-o/cri-o/test/mocks/criostorage"
+)
+
+const checkpointTestImage = "quay.io/crio/checkpoint:latest"
+
+// newCheckpointImageTestServer returns a server using a mocked image
+// storage which resolves checkpointTestImage to a single candidate.
+func newCheckpointImageTestServer(pull bool) (*Server, *criostoragemock.MockImageServer, references.RegistryImageReference) {
+	imageServer := criostoragemock.NewMockImageServer(gomock.NewController(GinkgoT()))
+
+	s := &Server{
+		ContainerServer:          &lib.ContainerServer{},
+		pullOperationsInProgress: make(map[pullArguments]*pullOperation),
+	}
+	s.SetStorageImageServer(imageServer)
+	s.config.SystemContext = &imageTypes.SystemContext{}
+	s.config.CheckpointRestorePullImage = pull
+
+	name, err := references.ParseRegistryImageReferenceFromOutOfProcessData(checkpointTestImage)
+	Expect(err).ToNot(HaveOccurred())
+	imageServer.EXPECT().HeuristicallyTryResolvingStringAsIDPrefix(gomock.Any()).Return(nil).AnyTimes()
+	imageServer.EXPECT().CandidatesForPotentiallyShortImageName(gomock.Any(), checkpointTestImage).
+		Return([]references.RegistryImageReference{name}, nil).AnyTimes()
+	return s, imageServer, name
+}
+
+func checkpointTestImageResult(checkpoint bool) *storage.ImageResult {
+	id, err := storage.ParseStorageImageIDFromOutOfProcessData("8a788232037eaf17794408ff3df6b922a1aedf9ef8de36afdae3ed0b0381907b")
+	Expect(err).ToNot(HaveOccurred())
+	result := &storage.ImageResult{ID: id}
+	if checkpoint {
+		result.Annotations = map[string]string{annotations.CheckpointAnnotationName: "ctr"}
+	}
+	return result
+}
+
+// expectPodCredentials returns a PullImage action which checks that the
+// credentials of sandboxConfig are used and returns the result of pull.
+func expectPodCredentials(pull func(references.RegistryImageReference) (reference.Canonical, error)) func(context.Context, references.RegistryImageReference, *storage.ImageCopyOptions) (imageTypes.ImageReference, reference.Canonical, error) {
+	return func(_ context.Context, name references.RegistryImageReference, options *storage.ImageCopyOptions) (imageTypes.ImageReference, reference.Canonical, error) {
+		defer GinkgoRecover()
+		auth := options.SourceCtx.DockerAuthConfig
+		Expect(auth).ToNot(BeNil())
+		Expect(auth.Username).To(Equal("user"))
+		Expect(auth.Password).To(Equal("secret"))
+		canonical, err := pull(name)
+		return nil, canonical, err
+	}
+}
+
+var _ = Describe("ContainerCreateCheckpoint", func() {
+	sandboxConfig := &types.PodSandboxConfig{
+		Metadata: &types.PodSandboxMetadata{Namespace: "default"},
+		Annotations: map[string]string{
+			// "user:secret"
+			annotations.CheckpointAnnotationPullAuth: "dXNlcjpzZWNyZXQ=",
+		},
+	}
+
+	Context("checkpointImageForCreate", func() {
+		It("should use a local checkpoint image", func() {
+			// Given
+			s, imageServer, name := newCheckpointImageTestServer(true)
+			result := checkpointTestImageResult(true)
+			imageServer.EXPECT().ImageStatusByName(gomock.Any(), name).Return(result, nil)
+
+			// When
+			id, err := s.checkpointImageForCreate(context.Background(), checkpointTestImage, &types.PodSandboxConfig{})
+
+			// Then
+			Expect(err).ToNot(HaveOccurred())
+			Expect(id).To(HaveValue(Equal(result.ID)))
+		})
+
+		It("should not pull a local image which is no checkpoint", func() {
+			// Given
+			s, imageServer, name := newCheckpointImageTestServer(true)
+			// The mock fails the spec on any call to PullImage.
+			imageServer.EXPECT().ImageStatusByName(gomock.Any(), name).Return(checkpointTestImageResult(false), nil)
+
+			// When
+			id, err := s.checkpointImageForCreate(context.Background(), checkpointTestImage, &types.PodSandboxConfig{})
+
+			// Then
+			Expect(err).ToNot(HaveOccurred())
+			Expect(id).To(BeNil())
+		})
+
+		It("should ignore an empty image name", func() {
+			// Given
+			imageServer := criostoragemock.NewMockImageServer(gomock.NewController(GinkgoT()))
+			s := &Server{ContainerServer: &lib.ContainerServer{}}
+			s.SetStorageImageServer(imageServer)
+			s.config.CheckpointRestorePullImage = true
+
+			// When
+			// The mock fails the spec on any lookup or pull of the image.
+			id, err := s.checkpointImageForCreate(context.Background(), "", &types.PodSandboxConfig{})
+
+			// Then
+			Expect(err).ToNot(HaveOccurred())
+			Expect(id).To(BeNil())
+		})
+
+		It("should not pull a missing image if disabled", func() {
+			// Given
+			s, imageServer, name := newCheckpointImageTestServer(false)
+			imageServer.EXPECT().ImageStatusByName(gomock.Any(), name).Return(nil, istorage.ErrNoSuchImage)
+
+			// When
+			id, err := s.checkpointImageForCreate(context.Background(), checkpointTestImage, sandboxConfig)
+
+			// Then
+			Expect(err).ToNot(HaveOccurred())
+			Expect(id).To(BeNil())
+		})
+
+		It("should pull a missing image with the credentials of the pod", func() {
+			// Given
+			s, imageServer, name := newCheckpointImageTestServer(true)
+			result := checkpointTestImageResult(true)
+			gomock.InOrder(
+				imageServer.EXPECT().ImageStatusByName(gomock.Any(), name).Return(nil, istorage.ErrNoSuchImage),
+				imageServer.EXPECT().PullImage(gomock.Any(), name, gomock.Any()).DoAndReturn(
+					expectPodCredentials(func(name references.RegistryImageReference) (reference.Canonical, error) {
+						return reference.WithDigest(name.Raw(), digest.FromString("checkpoint"))
+					})),
+				imageServer.EXPECT().ImageStatusByName(gomock.Any(), name).Return(result, nil),
+			)
+
+			// When
+			id, err := s.checkpointImageForCreate(context.Background(), checkpointTestImage, sandboxConfig)
+
+			// Then
+			Expect(err).ToNot(HaveOccurred())
+			Expect(id).To(HaveValue(Equal(result.ID)))
+		})
+
+		It("should report a pull failure as unavailable", func() {
+			// Given
+			s, imageServer, name := newCheckpointImageTestServer(true)
+			gomock.InOrder(
+				imageServer.EXPECT().ImageStatusByName(gomock.Any(), name).Return(nil, istorage.ErrNoSuchImage),
+				imageServer.EXPECT().PullImage(gomock.Any(), name, gomock.Any()).Return(nil, nil, errors.New("registry error")),
+			)
+
+			// When
+			_, err := s.checkpointImageForCreate(context.Background(), checkpointTestImage, sandboxConfig)
+
+			// Then
+			Expect(status.Code(err)).To(Equal(codes.Unavailable))
+		})
+	})
+
+	Context("checkpointBaseImage", func() {
+		baseImageDigest := digest.FromString("base image")
+		config := &metadata.ContainerConfig{RootfsImageName: checkpointTestImage}
+		info := &lib.CheckpointInfo{BaseImageDigest: baseImageDigest.String()}
+		pinned := "quay.io/crio/checkpoint@" + baseImageDigest.String()
+
+		// expectPull expects the base image to be pulled by digest using the
+		// credentials of the pod.
+		expectPull := func(imageServer *criostoragemock.MockImageServer, pullErr error) *gomock.Call {
+			name, err := references.ParseRegistryImageReferenceFromOutOfProcessData(pinned)
+			Expect(err).ToNot(HaveOccurred())
+			imageServer.EXPECT().CandidatesForPotentiallyShortImageName(gomock.Any(), pinned).
+				Return([]references.RegistryImageReference{name}, nil)
+			return imageServer.EXPECT().PullImage(gomock.Any(), name, gomock.Any()).DoAndReturn(
+				expectPodCredentials(func(name references.RegistryImageReference) (reference.Canonical, error) {
+					if pullErr != nil {
+						return nil, pullErr
+					}
+					return reference.WithDigest(name.Raw(), baseImageDigest)
+				}))
+		}
+
+		It("should use a local image with the digest", func() {
+			// Given
+			s, imageServer, name := newCheckpointImageTestServer(false)
+			result := checkpointTestImageResult(false)
+			result.Digest = baseImageDigest
+			// The mock fails the spec on any call to PullImage.
+			imageServer.EXPECT().ImageStatusByName(gomock.Any(), name).Return(result, nil)
+
+			// When
+			image, err := s.checkpointBaseImage(context.Background(), config, info, &types.ContainerConfig{}, sandboxConfig)
+
+			// Then
+			Expect(err).ToNot(HaveOccurred())
+			Expect(image).To(Equal(checkpointTestImage))
+		})
+
+		It("should reject a local image with another digest", func() {
+			// Given
+			s, imageServer, name := newCheckpointImageTestServer(false)
+			result := checkpointTestImageResult(false)
+			result.Digest = digest.FromString("other image")
+			imageServer.EXPECT().ImageStatusByName(gomock.Any(), name).Return(result, nil).Times(2)
+			expectPull(imageServer, errors.New("registry error"))
+
+			// When
+			_, err := s.checkpointBaseImage(context.Background(), config, info, &types.ContainerConfig{}, sandboxConfig)
+
+			// Then
+			Expect(err).To(MatchError(errCheckpointBaseImageMismatch))
+		})
+
+		It("should pull a missing image by digest", func() {
+			// Given
+			s, imageServer, name := newCheckpointImageTestServer(false)
+			gomock.InOrder(
+				imageServer.EXPECT().ImageStatusByName(gomock.Any(), name).Return(nil, istorage.ErrNoSuchImage),
+				expectPull(imageServer, nil),
+			)
+
+			// When
+			image, err := s.checkpointBaseImage(context.Background(), config, info, &types.ContainerConfig{}, sandboxConfig)
+
+			// Then
+			Expect(err).ToNot(HaveOccurred())
+			Expect(image).To(Equal(pinned))
+		})
+	})
+})
@@ -32,10 +32,12 @@ import (
 	"github.com/cri-o/cri-o/internal/config/node"
 	"github.com/cri-o/cri-o/internal/config/rdt"
 	ctrfactory "github.com/cri-o/cri-o/internal/factory/container"
+	"github.com/cri-o/cri-o/internal/lib"
 	"github.com/cri-o/cri-o/internal/lib/sandbox"
 	"github.com/cri-o/cri-o/internal/linklogs"
 	"github.com/cri-o/cri-o/internal/log"
 	oci "github.com/cri-o/cri-o/internal/oci"
+	"github.com/cri-o/cri-o/internal/resourcestore"
 	"github.com/cri-o/cri-o/internal/runtimehandlerhooks"
 	"github.com/cri-o/cri-o/internal/storage"
 	"github.com/cri-o/cri-o/internal/storage/references"
@@ -283,7 +285,7 @@ func (s *Server) createSandboxContainer(ctx context.Context, ctr ctrfactory.Cont
 
 	metadata := containerConfig.Metadata
 
-	s.resourceStore.SetStageForResource(ctx, ctr.Name(), "container storage creation")
+	s.containerStore.SetStageForResource(ctx, resourcestore.DefaultNamespace, ctr.Name(), "container storage creation")
 	containerInfo, err := s.StorageRuntimeServer().CreateContainer(s.config.SystemContext,
 		sb.Name(), sb.ID(),
 		userRequestedImage, imageID,
@@ -348,7 +350,7 @@ func (s *Server) createSandboxContainer(ctx context.Context, ctr ctrfactory.Cont
 
 	cgroup2RW := node.CgroupIsV2() && sb.Annotations()[crioann.Cgroup2RWAnnotation] == "true"
 
-	s.resourceStore.SetStageForResource(ctx, ctr.Name(), "container volume configuration")
+	s.containerStore.SetStageForResource(ctx, resourcestore.DefaultNamespace, ctr.Name(), "container volume configuration")
 	idMapSupport := s.Runtime().RuntimeSupportsIDMap(sb.RuntimeHandler())
 	rroSupport := s.Runtime().RuntimeSupportsRROMounts(sb.RuntimeHandler())
 	containerVolumes, ociMounts, err := s.addOCIBindMounts(ctx, ctr, mountLabel, s.config.RuntimeConfig.BindMountPrefix, s.config.AbsentMountSourcesToReject, maybeRelabel, skipRelabel, cgroup2RW, idMapSupport, rroSupport, s.Config().Root)
@@ -356,7 +358,7 @@ func (s *Server) createSandboxContainer(ctx context.Context, ctr ctrfactory.Cont
 		return nil, err
 	}
 
-	s.resourceStore.SetStageForResource(ctx, ctr.Name(), "container device creation")
+	s.containerStore.SetStageForResource(ctx, resourcestore.DefaultNamespace, ctr.Name(), "container device creation")
 	configuredDevices := s.config.Devices()
 
 	privilegedWithoutHostDevices, err := s.Runtime().PrivilegedWithoutHostDevices(sb.RuntimeHandler())
@@ -373,7 +375,7 @@ func (s *Server) createSandboxContainer(ctx context.Context, ctr ctrfactory.Cont
 		return nil, err
 	}
 
-	s.resourceStore.SetStageForResource(ctx, ctr.Name(), "container storage start")
+	s.containerStore.SetStageForResource(ctx, resourcestore.DefaultNamespace, ctr.Name(), "container storage start")
 	mountPoint, err := s.StorageRuntimeServer().StartContainer(containerID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to mount container %s(%s): %w", containerName, containerID, err)
@@ -388,7 +390,7 @@ func (s *Server) createSandboxContainer(ctx context.Context, ctr ctrfactory.Cont
 		}
 	}()
 
-	s.resourceStore.SetStageForResource(ctx, ctr.Name(), "container spec configuration")
+	s.containerStore.SetStageForResource(ctx, resourcestore.DefaultNamespace, ctr.Name(), "container spec configuration")
 
 	labels := containerConfig.Labels
 
@@ -605,6 +607,18 @@ func (s *Server) createSandboxContainer(ctx context.Context, ctr ctrfactory.Cont
 		}
 	}
 
+	// A container in its own time namespace keeps its clocks across
+	// checkpoint and restore, as CRIU restores the clock offsets of the
+	// namespace.
+	if ctr.Config().Annotations[crioann.CheckpointTimeNamespaceAnnotation] == "true" {
+		if err := lib.CheckTimeNamespaceSupport(); err != nil {
+			return nil, fmt.Errorf("cannot run container %s in a time namespace: %w", containerID, err)
+		}
+		if err := specgen.AddOrReplaceLinuxNamespace(string(rspec.TimeNamespace), ""); err != nil {
+			return nil, err
+		}
+	}
+
 	ctr.SpecAddMount(rspec.Mount{
 		Destination: "/dev/shm",
 		Type:        "bind",
@@ -723,6 +737,19 @@ func (s *Server) createSandboxContainer(ctx context.Context, ctr ctrfactory.Cont
 		return nil, err
 	}
 
+	if s.CheckpointRestoreEnabled() {
+		var criuOptions []string
+		if ctr.Restore() {
+			criuOptions = restoreCriuOptions(ctr.Config().Annotations)
+		}
+		if limit := s.config.CheckpointGhostLimit; limit > 0 {
+			criuOptions = append(criuOptions, oci.CriuGhostLimitOption(limit))
+		}
+		if err := oci.SetCriuConfig(specgen, containerInfo.RunDir, s.config.CheckpointActionScripts, criuOptions); err != nil {
+			return nil, err
+		}
+	}
+
 	// First add any configured environment variables from crio config.
 	// They will get overridden if specified in the image or container config.
 	specgen.AddMultipleProcessEnv(s.Config().DefaultEnv)
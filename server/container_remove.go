@@ -36,6 +36,13 @@ func (s *Server) RemoveContainer(ctx context.Context, req *types.RemoveContainer
 		return nil, status.Errorf(codes.NotFound, "could not find container %q: %v", req.ContainerId, err)
 	}
 
+	// Tearing down the storage would corrupt a running checkpoint.
+	release, err := s.holdCheckpointSlot(ctx, c.ID(), "removal")
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
 	sb := s.getSandbox(ctx, c.Sandbox())
 
 	if err := s.removeContainerInPod(ctx, sb, c); err != nil {
@@ -43,6 +50,8 @@ func (s *Server) RemoveContainer(ctx context.Context, req *types.RemoveContainer
 	}
 
 	s.removeSeccompNotifier(ctx, c)
+	s.removeCrashDumpWatcher(c)
+	s.forgetCheckpoints(c.ID())
 
 	s.generateCRIEvent(ctx, c, types.ContainerEventType_CONTAINER_DELETED_EVENT)
 	log.Infof(ctx, "Removed container %s: %s", c.ID(), c.Description())
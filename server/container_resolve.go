@@ -0,0 +1,95 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/containers/storage/pkg/truncindex"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	kubetypes "k8s.io/kubelet/pkg/types"
+
+	"github.com/cri-o/cri-o/internal/oci"
+)
+
+// resolveContainer returns the container referenced by ref, which is either
+// a full container name, a full or partial container ID, or a
+// "<namespace>/<pod>/<container>" triple of the Kubernetes names of the
+// container. It fails with NotFound if no container matches, and with
+// InvalidArgument listing the candidates if more than one does.
+func (s *Server) resolveContainer(ctx context.Context, ref string) (*oci.Container, error) {
+	if namespace, pod, name, ok := parseContainerTriple(ref); ok {
+		matches, err := s.ContainerServer.ListContainers(kubernetesNameFilter(namespace, pod, name))
+		if err != nil {
+			return nil, err
+		}
+		switch len(matches) {
+		case 0:
+			return nil, status.Errorf(codes.NotFound, "could not find container %q", ref)
+		case 1:
+			return matches[0], nil
+		}
+		ids := make([]string, 0, len(matches))
+		for _, ctr := range matches {
+			ids = append(ids, ctr.ID())
+		}
+		return nil, ambiguousContainerError(ref, ids)
+	}
+
+	ctr, err := s.LookupContainer(ctx, ref)
+	if err != nil {
+		var ambiguousErr truncindex.ErrAmbiguousPrefix
+		if errors.As(err, &ambiguousErr) {
+			return nil, ambiguousContainerError(ref, s.containerIDsWithPrefix(ref))
+		}
+		return nil, status.Errorf(codes.NotFound, "could not find container %q: %v", ref, err)
+	}
+	return ctr, nil
+}
+
+// parseContainerTriple splits ref into the namespace, pod and container names
+// of a "<namespace>/<pod>/<container>" triple. Container names and IDs never
+// contain a slash.
+func parseContainerTriple(ref string) (namespace, pod, name string, ok bool) {
+	parts := strings.Split(ref, "/")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return "", "", "", false
+	}
+	return parts[0], parts[1], parts[2], true
+}
+
+// kubernetesNameFilter returns a filter for ListContainers matching the
+// containers with the Kubernetes namespace, pod and container names.
+func kubernetesNameFilter(namespace, pod, name string) func(*oci.Container) bool {
+	return func(ctr *oci.Container) bool {
+		labels := ctr.Labels()
+		return labels[kubetypes.KubernetesPodNamespaceLabel] == namespace &&
+			labels[kubetypes.KubernetesPodNameLabel] == pod &&
+			labels[kubetypes.KubernetesContainerNameLabel] == name
+	}
+}
+
+// ambiguousContainerError returns the InvalidArgument error for ref matching
+// the containers ids.
+func ambiguousContainerError(ref string, ids []string) error {
+	sort.Strings(ids)
+	return status.Errorf(
+		codes.InvalidArgument,
+		"container reference %q is ambiguous, it matches %d containers: %s",
+		ref, len(ids), strings.Join(ids, ", "),
+	)
+}
+
+// containerIDsWithPrefix returns all known container IDs starting with the
+// provided prefix.
+func (s *Server) containerIDsWithPrefix(prefix string) []string {
+	matches := []string{}
+	s.CtrIDIndex().Iterate(func(id string) {
+		if strings.HasPrefix(id, prefix) {
+			matches = append(matches, id)
+		}
+	})
+	return matches
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	types "k8s.io/cri-api/pkg/apis/runtime/v1"
+	kubetypes "k8s.io/kubelet/pkg/types"
+
+	"github.com/cri-o/cri-o/internal/oci"
+)
+
+var _ = Describe("ContainerResolve", func() {
+	It("should parse a container triple", func() {
+		namespace, pod, name, ok := parseContainerTriple("default/pod/ctr")
+		Expect(ok).To(BeTrue())
+		Expect(namespace).To(Equal("default"))
+		Expect(pod).To(Equal("pod"))
+		Expect(name).To(Equal("ctr"))
+	})
+
+	DescribeTable("should reject references which are no triple",
+		func(ref string) {
+			_, _, _, ok := parseContainerTriple(ref)
+			Expect(ok).To(BeFalse())
+		},
+		Entry("kubelet name", "k8s_ctr_pod_default_uid_0"),
+		Entry("ID", "0123abc"),
+		Entry("too short", "default/pod"),
+		Entry("empty pod", "default//ctr"),
+		Entry("too long", "default/pod/ctr/extra"),
+	)
+
+	Context("kubernetesNameFilter", func() {
+		var ctr *oci.Container
+
+		BeforeEach(func() {
+			var err error
+			ctr, err = oci.NewContainer("0123", "k8s_ctr_pod_default_uid_0", "", "", map[string]string{
+				kubetypes.KubernetesPodNamespaceLabel:  "default",
+				kubetypes.KubernetesPodNameLabel:       "pod",
+				kubetypes.KubernetesContainerNameLabel: "ctr",
+			}, nil, nil, "", nil, nil, "", &types.ContainerMetadata{}, "sandbox", false, false, false, "", "", time.Now(), "")
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("should match the names of the container", func() {
+			Expect(kubernetesNameFilter("default", "pod", "ctr")(ctr)).To(BeTrue())
+		})
+
+		DescribeTable("should not match other names",
+			func(namespace, pod, name string) {
+				Expect(kubernetesNameFilter(namespace, pod, name)(ctr)).To(BeFalse())
+			},
+			Entry("namespace", "other", "pod", "ctr"),
+			Entry("pod", "default", "other", "ctr"),
+			Entry("container", "default", "pod", "other"),
+		)
+	})
+})
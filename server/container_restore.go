@@ -1,32 +1,45 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 
 	metadata "github.com/checkpoint-restore/checkpointctl/lib"
+	"github.com/containers/image/v5/docker/reference"
 	"github.com/containers/storage/pkg/archive"
+	"github.com/opencontainers/go-digest"
 	spec "github.com/opencontainers/runtime-spec/specs-go"
-	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/apimachinery/pkg/api/resource"
 	types "k8s.io/cri-api/pkg/apis/runtime/v1"
 	kubetypes "k8s.io/kubelet/pkg/types"
 
 	"github.com/cri-o/cri-o/internal/factory/container"
+	"github.com/cri-o/cri-o/internal/lib"
 	"github.com/cri-o/cri-o/internal/lib/sandbox"
 	"github.com/cri-o/cri-o/internal/log"
+	"github.com/cri-o/cri-o/internal/oci"
+	"github.com/cri-o/cri-o/internal/resourcestore"
 	"github.com/cri-o/cri-o/internal/storage"
+	"github.com/cri-o/cri-o/internal/storage/references"
 	"github.com/cri-o/cri-o/pkg/annotations"
 )
 
 // checkIfCheckpointOCIImage returns checks if the input refers to a checkpoint image.
-// It returns the StorageImageID of the image the input resolves to, nil otherwise.
+// It returns the StorageImageID of the image the input refers to if the input
+// is a checkpoint image. Otherwise, it returns nil.
 func (s *Server) checkIfCheckpointOCIImage(ctx context.Context, input string) (*storage.StorageImageID, error) {
 	if input == "" {
 		return nil, nil
 	}
-	if _, err := os.Stat(input); err == nil {
+	if _, err := os.Stat(input); err == nil || lib.IsRemoteCheckpointLocation(input) {
 		return nil, nil
 	}
 	status, err := s.storageImageStatus(ctx, types.ImageSpec{
@@ -36,26 +49,347 @@ func (s *Server) checkIfCheckpointOCIImage(ctx context.Context, input string) (*
 		return nil, err
 	}
 
+	return checkpointImageID(ctx, input, status), nil
+}
+
+// checkpointImageID returns the StorageImageID of the image if it is a
+// checkpoint image, nil otherwise.
+func checkpointImageID(ctx context.Context, input string, status *storage.ImageResult) *storage.StorageImageID {
 	if status == nil || status.Annotations == nil {
-		return nil, nil
+		return nil
 	}
 
+	// Checkpoint images of other container engines only carry the
+	// annotation of checkpointctl.
 	ann, ok := status.Annotations[annotations.CheckpointAnnotationName]
 	if !ok {
-		return nil, nil
+		ann, ok = status.Annotations[metadata.CheckpointAnnotationName]
+	}
+	if !ok {
+		return nil
 	}
 
 	log.Debugf(ctx, "Found checkpoint of container %v in %v", ann, input)
 
-	return &status.ID, nil
+	return &status.ID
+}
+
+// errCheckpointImagePull is returned if the checkpoint image to restore
+// from could not be pulled.
+var errCheckpointImagePull = errors.New("unable to pull checkpoint image")
+
+// checkpointImageForCreate checks if the image of a create request is a
+// checkpoint image. Images which are not available locally are pulled if
+// checkpoint_restore_pull_image is enabled, images available locally are
+// never pulled.
+func (s *Server) checkpointImageForCreate(ctx context.Context, input string, sandboxConfig *types.PodSandboxConfig) (*storage.StorageImageID, error) {
+	if input == "" {
+		return nil, nil
+	}
+	status, err := s.storageImageStatus(ctx, types.ImageSpec{Image: input})
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if this is a checkpoint image: %w", err)
+	}
+	if status == nil && s.config.CheckpointRestorePullImage {
+		status, err = s.pullCheckpointImage(ctx, input, sandboxConfig)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return checkpointImageID(ctx, input, status), nil
+}
+
+// pullCheckpointImage pulls the input image using the regular image pull
+// machinery and returns its status. Pull failures are reported with
+// codes.Unavailable to distinguish them from failures of the restore.
+func (s *Server) pullCheckpointImage(ctx context.Context, input string, sandboxConfig *types.PodSandboxConfig) (*storage.ImageResult, error) {
+	log.Infof(ctx, "Image %s not found locally, pulling it as potential checkpoint image", input)
+	if _, err := s.PullImage(ctx, &types.PullImageRequest{
+		Image:         &types.ImageSpec{Image: input},
+		Auth:          checkpointPullAuth(sandboxConfig),
+		SandboxConfig: sandboxConfig,
+	}); err != nil {
+		return nil, status.Errorf(codes.Unavailable, "%v %s: %v", errCheckpointImagePull, input, err)
+	}
+	return s.storageImageStatus(ctx, types.ImageSpec{Image: input})
+}
+
+// checkpointPullAuth returns the credentials of the pod to pull the images
+// needed to restore a checkpoint, or nil to use the configured credentials.
+func checkpointPullAuth(sandboxConfig *types.PodSandboxConfig) *types.AuthConfig {
+	auth := sandboxConfig.GetAnnotations()[annotations.CheckpointAnnotationPullAuth]
+	if auth == "" {
+		return nil
+	}
+	return &types.AuthConfig{Auth: auth}
+}
+
+// errCheckpointBaseImageMismatch is returned if the base image of a
+// checkpoint is not available and only a different version of it exists
+// locally.
+var errCheckpointBaseImageMismatch = errors.New("checkpoint base image mismatch")
+
+// checkpointBaseImage returns the image the checkpointed container is
+// restored on. If the checkpoint recorded the digest of its base image, the
+// local image is verified against it and pulled by digest if it is missing.
+func (s *Server) checkpointBaseImage(
+	ctx context.Context,
+	config *metadata.ContainerConfig,
+	info *lib.CheckpointInfo,
+	createConfig *types.ContainerConfig,
+	sandboxConfig *types.PodSandboxConfig,
+) (string, error) {
+	// Newer checkpoints archives have RootfsImageRef set
+	// and using it for the restore is more correct.
+	// For the Kubernetes use case the output of 'crictl ps'
+	// contains for the original container under 'IMAGE' something
+	// like 'registry/path/container@sha256:123444444...'.
+	// The restored container was, however, only displaying something
+	// like 'registry/path/container'.
+	// This had two problems, first, the output from the restored
+	// container was different, but the bigger problem was, that
+	// CRI-O might pull the wrong image from the registry.
+	// If the container in the registry was updated (new latest tag)
+	// all of a sudden the wrong base image would be downloaded.
+	rootFSImage := config.RootfsImageName
+	if config.RootfsImageRef != "" {
+		id, err := storage.ParseStorageImageIDFromOutOfProcessData(config.RootfsImageRef)
+		if err != nil {
+			return "", fmt.Errorf("invalid RootfsImageRef %q: %w", config.RootfsImageRef, err)
+		}
+		// This is not quite out-of-process consumption, but types.ContainerConfig is at least
+		// a cross-process API, and this value is correct in that API.
+		rootFSImage = id.IDStringForOutOfProcessConsumptionOnly()
+	}
+
+	// Older archives do not contain the digest, keep the previous behavior.
+	if info.BaseImageDigest == "" {
+		return rootFSImage, nil
+	}
+	baseImageDigest, err := digest.Parse(info.BaseImageDigest)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w: invalid base image digest: %w", lib.CheckpointInfoFile, lib.ErrCorruptCheckpointMetadata, err)
+	}
+
+	status, err := s.storageImageStatus(ctx, types.ImageSpec{Image: rootFSImage})
+	if err != nil {
+		return "", err
+	}
+	if status != nil && (config.RootfsImageRef != "" || imageHasDigest(status, baseImageDigest)) {
+		// Image IDs are derived from the image content,
+		// finding the image by ID means it is the same image.
+		return rootFSImage, nil
+	}
+
+	name, err := references.ParseRegistryImageReferenceFromOutOfProcessData(config.RootfsImageName)
+	if err != nil {
+		return "", fmt.Errorf("invalid RootfsImageName %q: %w", config.RootfsImageName, err)
+	}
+	pinned, err := reference.WithDigest(reference.TrimNamed(name.Raw()), baseImageDigest)
+	if err != nil {
+		return "", fmt.Errorf("invalid base image %s@%s: %w", config.RootfsImageName, baseImageDigest, err)
+	}
+
+	log.Infof(ctx, "Base image %s of checkpoint not found locally, pulling it", pinned)
+	_, pullErr := s.PullImage(ctx, &types.PullImageRequest{
+		Image:         &types.ImageSpec{Image: pinned.String()},
+		Auth:          checkpointPullAuth(sandboxConfig),
+		SandboxConfig: sandboxConfig,
+	})
+	if pullErr == nil {
+		return pinned.String(), nil
+	}
+
+	// The original image is not available, check if the checkpoint could
+	// be restored on a different version of it.
+	local, err := s.storageImageStatus(ctx, types.ImageSpec{Image: config.RootfsImageName})
+	if err != nil || local == nil {
+		return "", fmt.Errorf("failed to pull base image %s of checkpoint: %w", pinned, pullErr)
+	}
+	if createConfig.GetAnnotations()[annotations.CheckpointAnnotationIgnoreBaseImageMismatch] != "true" {
+		return "", fmt.Errorf(
+			"%w: checkpoint was created from %s but local image %s has digest %s and pulling the original image failed: %w",
+			errCheckpointBaseImageMismatch, pinned, config.RootfsImageName, local.Digest, pullErr,
+		)
+	}
+	log.Warnf(ctx, "Restoring checkpoint created from %s on %s with digest %s", pinned, config.RootfsImageName, local.Digest)
+
+	return local.ID.IDStringForOutOfProcessConsumptionOnly(), nil
+}
+
+// imageHasDigest checks if the image has been pulled with the manifest digest.
+func imageHasDigest(status *storage.ImageResult, dgst digest.Digest) bool {
+	if status.Digest == dgst {
+		return true
+	}
+	for _, repoDigest := range status.RepoDigests {
+		if strings.HasSuffix(repoDigest, "@"+dgst.String()) {
+			return true
+		}
+	}
+	return false
+}
+
+// errCheckpointMountNotRemapped is returned if a mount remapping table is
+// passed to the restore, but does not cover all mounts of the checkpoint.
+var errCheckpointMountNotRemapped = errors.New("no remapping for host path of checkpointed mount")
+
+// errCheckpointMountRemapUnknown is returned if the mount remapping table
+// passed to the restore contains host paths the checkpoint does not mount.
+var errCheckpointMountRemapUnknown = errors.New("remapping for host path not mounted by checkpoint")
+
+// checkpointMountRemap returns the table to remap the host paths of the
+// checkpointed mounts to the host paths on the restoring node, or nil if the
+// restore request does not contain one. Host paths which stay the same need
+// to be mapped to themselves.
+func checkpointMountRemap(createAnnotations map[string]string) (map[string]string, error) {
+	value, ok := createAnnotations[annotations.CheckpointAnnotationMountRemap]
+	if !ok {
+		return nil, nil
+	}
+	remap := make(map[string]string)
+	if err := json.Unmarshal([]byte(value), &remap); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %w", annotations.CheckpointAnnotationMountRemap, err)
+	}
+	for source, hostPath := range remap {
+		if !filepath.IsAbs(hostPath) {
+			return nil, fmt.Errorf("invalid %s annotation: host path %q for %q is not absolute", annotations.CheckpointAnnotationMountRemap, hostPath, source)
+		}
+	}
+	return remap, nil
+}
+
+// errCheckpointMemoryLimitTooLow is returned if the memory limit of a restore
+// is below the memory of the checkpointed processes, which cannot fit.
+var errCheckpointMemoryLimitTooLow = errors.New("memory limit below the memory of the checkpoint")
+
+// defaultCPUPeriod is the CFS period in microseconds used for the CPU limit
+// override if the restore request does not set one.
+const defaultCPUPeriod = 100000
+
+// checkpointResourceOverrides returns the resources of a container restored
+// from a checkpoint, with the CPU and memory limits of the restore request
+// overridden by the CheckpointAnnotationCPULimit and
+// CheckpointAnnotationMemoryLimit annotations. memoryBytes is the memory of
+// the checkpointed processes, which has to fit into the memory limit, or 0 if
+// it is unknown. The resources of the request are not modified.
+func checkpointResourceOverrides(createAnnotations map[string]string, resources *types.LinuxContainerResources, memoryBytes int64) (*types.LinuxContainerResources, error) {
+	cpuValue, cpuOK := createAnnotations[annotations.CheckpointAnnotationCPULimit]
+	memoryValue, memoryOK := createAnnotations[annotations.CheckpointAnnotationMemoryLimit]
+	if !cpuOK && !memoryOK {
+		return resources, nil
+	}
+	overridden := &types.LinuxContainerResources{}
+	if resources != nil {
+		copied := *resources
+		overridden = &copied
+	}
+
+	if cpuOK {
+		cpu, err := resource.ParseQuantity(cpuValue)
+		if err != nil || cpu.Sign() <= 0 {
+			return nil, fmt.Errorf("invalid %s annotation %q: must be a positive CPU quantity", annotations.CheckpointAnnotationCPULimit, cpuValue)
+		}
+		if overridden.CpuPeriod == 0 {
+			overridden.CpuPeriod = defaultCPUPeriod
+		}
+		overridden.CpuQuota = cpu.MilliValue() * overridden.CpuPeriod / 1000
+	}
+
+	if memoryOK {
+		memory, err := resource.ParseQuantity(memoryValue)
+		if err != nil || memory.Sign() <= 0 {
+			return nil, fmt.Errorf("invalid %s annotation %q: must be a positive memory quantity", annotations.CheckpointAnnotationMemoryLimit, memoryValue)
+		}
+		limit := memory.Value()
+		if memoryBytes > 0 && limit < memoryBytes {
+			return nil, fmt.Errorf("%w: limit of %d bytes, checkpoint holds %d bytes", errCheckpointMemoryLimitTooLow, limit, memoryBytes)
+		}
+		overridden.MemoryLimitInBytes = limit
+		// A swap limit of the request is adjusted, as it cannot be
+		// lower than the memory limit.
+		if overridden.MemorySwapLimitInBytes > 0 {
+			overridden.MemorySwapLimitInBytes = limit
+		}
+	}
+	return overridden, nil
+}
+
+// checkpointEnvs returns the environment of a container restored from a
+// checkpoint with the environment checkpointEnv. The variables of the
+// restore request override those of the checkpoint, or are added to them, if
+// their names match the allowlist. The restored processes keep the
+// environment CRIU restores into their memory, the result only applies to
+// the configuration of the container. The names of the overriding variables
+// are returned as well.
+func checkpointEnvs(ctx context.Context, checkpointEnv []string, requestEnvs []*types.KeyValue, allowlist []string) (envs []*types.KeyValue, overridden []string) {
+	envs = make([]*types.KeyValue, 0, len(checkpointEnv))
+	index := make(map[string]int, len(checkpointEnv))
+	for _, env := range checkpointEnv {
+		key, value, _ := strings.Cut(env, "=")
+		if key == "" {
+			continue
+		}
+		if i, ok := index[key]; ok {
+			envs[i].Value = value
+			continue
+		}
+		index[key] = len(envs)
+		envs = append(envs, &types.KeyValue{Key: key, Value: value})
+	}
+
+	for _, env := range requestEnvs {
+		if env.GetKey() == "" {
+			continue
+		}
+		i, ok := index[env.GetKey()]
+		if ok && envs[i].Value == env.GetValue() {
+			continue
+		}
+		if !envAllowed(env.GetKey(), allowlist) {
+			log.Infof(ctx, "Keeping the checkpointed environment, variable %s of the restore request is not in checkpoint_restore_env_allowlist", env.GetKey())
+			continue
+		}
+		log.Debugf(ctx, "Overriding environment variable %s of the checkpoint", env.GetKey())
+		overridden = append(overridden, env.GetKey())
+		if ok {
+			envs[i].Value = env.GetValue()
+			continue
+		}
+		index[env.GetKey()] = len(envs)
+		envs = append(envs, &types.KeyValue{Key: env.GetKey(), Value: env.GetValue()})
+	}
+	return envs, overridden
+}
+
+// envAllowed checks whether the environment variable name matches an entry
+// of the allowlist. A trailing "*" matches all names with its prefix.
+func envAllowed(name string, allowlist []string) bool {
+	for _, allowed := range allowlist {
+		if prefix, ok := strings.CutSuffix(allowed, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+			continue
+		}
+		if name == allowed {
+			return true
+		}
+	}
+	return false
 }
 
 // taken from Podman.
 func (s *Server) CRImportCheckpoint(
 	ctx context.Context,
 	createConfig *types.ContainerConfig,
-	sbID, sandboxUID string,
+	sbID string,
+	requestSandboxConfig *types.PodSandboxConfig,
 ) (ctrID string, retErr error) {
+	if err := s.checkCheckpointRestoreEnabled(); err != nil {
+		return "", err
+	}
 	var mountPoint string
 
 	// Ensure that the image to restore the checkpoint from has been provided.
@@ -63,6 +397,11 @@ func (s *Server) CRImportCheckpoint(
 		return "", errors.New(`attribute "image" missing from container definition`)
 	}
 
+	restoreMode, err := checkpointRestoreMode(createConfig.Annotations)
+	if err != nil {
+		return "", err
+	}
+
 	inputImage := createConfig.Image.Image
 	createMounts := createConfig.Mounts
 	createAnnotations := createConfig.Annotations
@@ -74,6 +413,7 @@ func (s *Server) CRImportCheckpoint(
 	}
 
 	var restoreArchivePath string
+	var staged *stagedCheckpoint
 	if restoreStorageImageID != nil {
 		log.Debugf(ctx, "Restoring from oci image %s", inputImage)
 
@@ -92,44 +432,68 @@ func (s *Server) CRImportCheckpoint(
 			}
 		}()
 	} else {
-		// First get the container definition from the
-		// tarball to a temporary directory
-		archiveFile, err := os.Open(inputImage)
-		if err != nil {
-			return "", fmt.Errorf("failed to open checkpoint archive %s for import: %w", inputImage, err)
-		}
-		defer func(f *os.File) {
-			if err := f.Close(); err != nil {
-				log.Errorf(ctx, "Unable to close file %s: %q", f.Name(), err)
-			}
-		}(archiveFile)
-
-		restoreArchivePath = inputImage
-		options := &archive.TarOptions{
-			// Here we only need the files config.dump and spec.dump
-			ExcludePatterns: []string{
-				"artifacts",
-				"ctr.log",
-				metadata.RootFsDiffTar,
-				metadata.NetworkStatusFile,
-				metadata.DeletedFilesFile,
-				metadata.CheckpointDirectory,
-			},
-		}
-		mountPoint, err = os.MkdirTemp("", "checkpoint")
-		if err != nil {
+		// Do not read arbitrary files of the host as archive.
+		if _, err := s.validateCheckpointLocation(inputImage); err != nil {
 			return "", err
 		}
-		defer func() {
-			if err := os.RemoveAll(mountPoint); err != nil {
-				log.Errorf(ctx, "Could not recursively remove %s: %q", mountPoint, err)
+		restoreArchivePath = inputImage
+		var stagedCleaner *resourcestore.ResourceCleaner
+		if staged, stagedCleaner = s.takeStagedCheckpoint(ctx, inputImage); staged != nil {
+			// The staged data is moved into the directory of the restored
+			// container, it only remains if the restore fails before.
+			mountPoint = staged.dir
+			defer func() {
+				if err := stagedCleaner.Cleanup(); err != nil {
+					log.Errorf(ctx, "Could not remove staged checkpoint archive %s: %v", inputImage, err)
+				}
+			}()
+		} else {
+			// First get the container definition from the
+			// tarball to a temporary directory
+			archiveFile, err := s.ContainerServer.OpenCheckpointLocation(ctx, inputImage)
+			if err != nil {
+				return "", fmt.Errorf("failed to open checkpoint archive %s for import: %w", inputImage, err)
 			}
-		}()
-		err = archive.Untar(archiveFile, mountPoint, options)
-		if err != nil {
-			return "", fmt.Errorf("unpacking of checkpoint archive %s failed: %w", mountPoint, err)
+			defer func() {
+				if err := archiveFile.Close(); err != nil {
+					log.Errorf(ctx, "Unable to close file %s: %q", inputImage, err)
+				}
+			}()
+
+			options := &archive.TarOptions{
+				// Here we only need the files config.dump and spec.dump
+				ExcludePatterns: []string{
+					"artifacts",
+					"ctr.log",
+					metadata.RootFsDiffTar,
+					metadata.NetworkStatusFile,
+					metadata.DeletedFilesFile,
+					metadata.CheckpointDirectory,
+				},
+			}
+			mountPoint, err = os.MkdirTemp("", "checkpoint")
+			if err != nil {
+				return "", err
+			}
+			defer func() {
+				if err := os.RemoveAll(mountPoint); err != nil {
+					log.Errorf(ctx, "Could not recursively remove %s: %q", mountPoint, err)
+				}
+			}()
+			err = archive.Untar(archiveFile, mountPoint, options)
+			if err != nil {
+				return "", fmt.Errorf("unpacking of checkpoint archive %s failed: %w", mountPoint, err)
+			}
+			log.Debugf(ctx, "Unpacked checkpoint in %s", mountPoint)
 		}
-		log.Debugf(ctx, "Unpacked checkpoint in %s", mountPoint)
+	}
+
+	info, err := lib.ReadCheckpointInfo(mountPoint)
+	if err != nil {
+		return "", err
+	}
+	if info.Diagnostic {
+		return "", fmt.Errorf("%s: %w", inputImage, lib.ErrDiagnosticCheckpoint)
 	}
 
 	// Load spec.dump from temporary directory
@@ -138,6 +502,13 @@ func (s *Server) CRImportCheckpoint(
 		return "", fmt.Errorf("failed to read %q: %w", metadata.SpecDumpFile, err)
 	}
 
+	// A cold restore does not need CRIU.
+	if restoreMode == checkpointRestoreModeRestore {
+		if err := lib.CheckCheckpointCriuVersion(dumpSpec.Annotations); err != nil {
+			return "", err
+		}
+	}
+
 	// Load config.dump from temporary directory
 	config := new(metadata.ContainerConfig)
 	if _, err := metadata.ReadJSONFile(config, mountPoint, metadata.ConfigDumpFile); err != nil {
@@ -174,7 +545,7 @@ func (s *Server) CRImportCheckpoint(
 		if err := json.Unmarshal([]byte(dumpSpec.Annotations[annotations.Labels]), &originalLabels); err != nil {
 			return "", fmt.Errorf("failed to read %q: %w", annotations.Labels, err)
 		}
-		if sandboxUID != "" {
+		if sandboxUID := requestSandboxConfig.GetMetadata().GetUid(); sandboxUID != "" {
 			if _, ok := originalLabels[kubetypes.KubernetesPodUIDLabel]; ok {
 				originalLabels[kubetypes.KubernetesPodUIDLabel] = sandboxUID
 			}
@@ -217,6 +588,27 @@ func (s *Server) CRImportCheckpoint(
 			}
 		}
 	}
+	// The specs of the checkpointed and the restored container are compared
+	// on start, where only the annotations of the restored container are
+	// available.
+	if value, ok := createAnnotations[annotations.CheckpointAnnotationTolerateSpecDrift]; ok {
+		originalAnnotations[annotations.CheckpointAnnotationTolerateSpecDrift] = value
+	}
+	// The manage-cgroups mode is decided here to fail before the container
+	// is created if the checkpoint cannot be restored on this node.
+	var manageCgroupsMode string
+	if restoreMode == checkpointRestoreModeRestore {
+		manageCgroupsMode, err = lib.RestoreManageCgroupsMode(info, createAnnotations[annotations.CheckpointAnnotationManageCgroupsMode], lib.HostCgroupMode())
+		if err != nil {
+			return "", err
+		}
+	}
+	originalAnnotations[annotations.CheckpointAnnotationRestoreMode] = restoreMode
+	if manageCgroupsMode != "" {
+		originalAnnotations[annotations.CheckpointAnnotationManageCgroupsMode] = manageCgroupsMode
+	} else {
+		delete(originalAnnotations, annotations.CheckpointAnnotationManageCgroupsMode)
+	}
 
 	sb, err := s.getPodSandboxFromRequest(ctx, sbID)
 	if err != nil {
@@ -226,6 +618,25 @@ func (s *Server) CRImportCheckpoint(
 		return "", fmt.Errorf("specified sandbox not found: %s: %w", sbID, err)
 	}
 
+	// The changed IPs are part of the status of the restored container,
+	// and with it of the container events of the restore. The processes of
+	// a cold restore do not use the checkpointed IPs.
+	var ipDivergence *checkpointIPDivergence
+	if restoreMode == checkpointRestoreModeRestore {
+		ipDivergence, err = s.checkpointIPDivergence(ctx, info, sb, createAnnotations)
+		if err != nil {
+			return "", err
+		}
+	}
+	delete(originalAnnotations, annotations.CheckpointAnnotationIPDivergence)
+	if ipDivergence != nil {
+		value, err := json.Marshal(ipDivergence)
+		if err != nil {
+			return "", err
+		}
+		originalAnnotations[annotations.CheckpointAnnotationIPDivergence] = string(value)
+	}
+
 	systemCtx, err := s.contextForNamespace(sb.Metadata().Namespace)
 	if err != nil {
 		return "", fmt.Errorf("get context for namespace: %w", err)
@@ -235,39 +646,14 @@ func (s *Server) CRImportCheckpoint(
 		return "", fmt.Errorf("namespaced signature policy %s defined for pods in namespace %s; signature validation is not supported for container restore", systemCtx.SignaturePolicyPath, sb.Metadata().Namespace)
 	}
 
-	stopMutex := sb.StopMutex()
-	stopMutex.RLock()
-	defer stopMutex.RUnlock()
-	if sb.Stopped() {
-		return "", fmt.Errorf("CreateContainer failed as the sandbox was stopped: %s", sb.ID())
-	}
-
 	ctr, err := container.New()
 	if err != nil {
 		return "", fmt.Errorf("failed to create container: %w", err)
 	}
 
-	// Newer checkpoints archives have RootfsImageRef set
-	// and using it for the restore is more correct.
-	// For the Kubernetes use case the output of 'crictl ps'
-	// contains for the original container under 'IMAGE' something
-	// like 'registry/path/container@sha256:123444444...'.
-	// The restored container was, however, only displaying something
-	// like 'registry/path/container'.
-	// This had two problems, first, the output from the restored
-	// container was different, but the bigger problem was, that
-	// CRI-O might pull the wrong image from the registry.
-	// If the container in the registry was updated (new latest tag)
-	// all of a sudden the wrong base image would be downloaded.
-	rootFSImage := config.RootfsImageName
-	if config.RootfsImageRef != "" {
-		id, err := storage.ParseStorageImageIDFromOutOfProcessData(config.RootfsImageRef)
-		if err != nil {
-			return "", fmt.Errorf("invalid RootfsImageRef %q: %w", config.RootfsImageRef, err)
-		}
-		// This is not quite out-of-process consumption, but types.ContainerConfig is at least
-		// a cross-process API, and this value is correct in that API.
-		rootFSImage = id.IDStringForOutOfProcessConsumptionOnly()
+	rootFSImage, err := s.checkpointBaseImage(ctx, config, info, createConfig, requestSandboxConfig)
+	if err != nil {
+		return "", err
 	}
 	containerConfig := &types.ContainerConfig{
 		Metadata: &types.ContainerMetadata{
@@ -284,6 +670,21 @@ func (s *Server) CRImportCheckpoint(
 		Annotations: originalAnnotations,
 		Labels:      originalLabels,
 	}
+	delete(containerConfig.Annotations, annotations.CheckpointAnnotationEnvOverrides)
+	if dumpSpec.Process != nil {
+		var overridden []string
+		containerConfig.Envs, overridden = checkpointEnvs(ctx, dumpSpec.Process.Env, createConfig.GetEnvs(), s.config.CheckpointRestoreEnvAllowlist)
+		if len(overridden) > 0 {
+			value, err := json.Marshal(overridden)
+			if err != nil {
+				return "", err
+			}
+			containerConfig.Annotations[annotations.CheckpointAnnotationEnvOverrides] = string(value)
+		}
+	}
+	if restoreMode == checkpointRestoreModeCold {
+		coldRestoreProcess(containerConfig, createConfig, dumpSpec.Process)
+	}
 
 	if createConfig.Linux != nil {
 		if createConfig.Linux.Resources != nil {
@@ -294,6 +695,12 @@ func (s *Server) CRImportCheckpoint(
 			containerConfig.Linux.SecurityContext = createConfig.Linux.SecurityContext
 		}
 	}
+	// The overrides end up in the cgroup configuration of the restored
+	// container, which is set up before CRIU restores its processes.
+	containerConfig.Linux.Resources, err = checkpointResourceOverrides(createConfig.GetAnnotations(), containerConfig.Linux.Resources, info.MemoryBytes)
+	if err != nil {
+		return "", err
+	}
 
 	if dumpSpec.Linux != nil {
 		if dumpSpec.Linux.MaskedPaths != nil {
@@ -319,6 +726,13 @@ func (s *Server) CRImportCheckpoint(
 		"/run/.containerenv": true,
 	}
 
+	mountRemap, err := checkpointMountRemap(createConfig.GetAnnotations())
+	if err != nil {
+		return "", err
+	}
+	unmappedMounts := []string{}
+	checkpointSources := make(map[string]bool)
+
 	for _, m := range dumpSpec.Mounts {
 		// Following mounts are ignored as they might point to the
 		// wrong location and if ignored the mounts will correctly
@@ -326,15 +740,26 @@ func (s *Server) CRImportCheckpoint(
 		if ignoreMounts[m.Destination] {
 			continue
 		}
+		checkpointSources[m.Source] = true
 		mount := &types.Mount{
 			ContainerPath: m.Destination,
 			HostPath:      m.Source,
 		}
 
+		remapped := false
 		for _, createMount := range createMounts {
 			if createMount.ContainerPath == m.Destination {
 				mount.HostPath = createMount.HostPath
+				remapped = true
+			}
+		}
+		if !remapped && mountRemap != nil {
+			hostPath, ok := mountRemap[m.Source]
+			if !ok {
+				unmappedMounts = append(unmappedMounts, m.Source)
+				continue
 			}
+			mount.HostPath = hostPath
 		}
 
 		for _, opt := range m.Options {
@@ -362,6 +787,21 @@ func (s *Server) CRImportCheckpoint(
 		log.Debugf(ctx, "Adding mounts %#v", mount)
 		containerConfig.Mounts = append(containerConfig.Mounts, mount)
 	}
+	if len(unmappedMounts) > 0 {
+		return "", fmt.Errorf("%w: %s", errCheckpointMountNotRemapped, strings.Join(unmappedMounts, ", "))
+	}
+	// A remapping for a host path the checkpoint does not mount is most
+	// likely a mistake in the restore request.
+	unknownRemaps := []string{}
+	for source := range mountRemap {
+		if !checkpointSources[source] {
+			unknownRemaps = append(unknownRemaps, source)
+		}
+	}
+	if len(unknownRemaps) > 0 {
+		sort.Strings(unknownRemaps)
+		return "", fmt.Errorf("%w: %s", errCheckpointMountRemapUnknown, strings.Join(unknownRemaps, ", "))
+	}
 	sandboxConfig := &types.PodSandboxConfig{
 		Metadata: &types.PodSandboxMetadata{
 			Name:      sb.Metadata().Name,
@@ -379,63 +819,111 @@ func (s *Server) CRImportCheckpoint(
 	if err := ctr.SetNameAndID(ctrID); err != nil {
 		return "", fmt.Errorf("setting container name and ID: %w", err)
 	}
-
-	if _, err = s.ReserveContainerName(ctr.ID(), ctr.Name()); err != nil {
-		return "", fmt.Errorf("kubelet may be retrying requests that are timing out in CRI-O due to system load: %w", err)
+	// A cold restored container is started like a newly created one.
+	ctr.SetRestore(restoreMode == checkpointRestoreModeRestore)
+	if restoreMode == checkpointRestoreModeCold {
+		log.Infof(ctx, "Creating container %s from the spec of checkpoint %s without restoring its processes", ctr.Name(), inputImage)
 	}
+	setCheckpointRestoreModeHeader(ctx, restoreMode)
+
+	return s.restoreOnce(ctx, ctr.Name(), func(ctx context.Context, resourceCleaner *resourcestore.ResourceCleaner) (*oci.Container, error) {
+		stopMutex := sb.StopMutex()
+		stopMutex.RLock()
+		defer stopMutex.RUnlock()
+		if sb.Stopped() {
+			return nil, fmt.Errorf("CreateContainer failed as the sandbox was stopped: %s", sb.ID())
+		}
+		s.containerStore.SetLabelsForResource(resourcestore.DefaultNamespace, ctr.Name(), map[string]string{resourceLabelSandboxID: sb.ID()})
 
-	defer func() {
-		if retErr != nil {
-			log.Infof(ctx, "RestoreCtr: releasing container name %s", ctr.Name())
-			s.ReleaseContainerName(ctx, ctr.Name())
+		newContainer, err := s.restoreContainer(ctx, ctr, sb, resourceCleaner)
+		if err != nil {
+			return nil, err
+		}
+		if restoreMode == checkpointRestoreModeCold {
+			return newContainer, nil
+		}
+		if ipDivergence != nil && len(ipDivergence.secondaryIPs) > 0 {
+			if err := addSandboxSecondaryIPs(ctx, sb.NetNsPath(), ipDivergence.secondaryIPs, resourceCleaner); err != nil {
+				return nil, err
+			}
+		}
+		if staged != nil {
+			if err := lib.MoveStagedCheckpoint(staged.dir, newContainer.Dir()); err != nil {
+				return nil, err
+			}
+			newContainer.SetRestoreStaged(true)
 		}
-	}()
-	ctr.SetRestore(true)
+		newContainer.SetRestore(true)
+		newContainer.SetRestoreArchivePath(restoreArchivePath)
+		newContainer.SetRestoreStorageImageID(restoreStorageImageID)
+		newContainer.SetCheckpointedAt(config.CheckpointedAt)
+		return newContainer, nil
+	})
+}
+
+// restoreContainer prepares the storage and the server state of the restored
+// container ctr in the sandbox sb, adding the steps releasing them to
+// resourceCleaner.
+func (s *Server) restoreContainer(ctx context.Context, ctr container.Container, sb *sandbox.Sandbox, resourceCleaner *resourcestore.ResourceCleaner) (*oci.Container, error) {
+	if _, err := s.ReserveContainerName(ctr.ID(), ctr.Name()); err != nil {
+		return nil, fmt.Errorf("kubelet may be retrying requests that are timing out in CRI-O due to system load: %w", err)
+	}
+	resourceCleaner.Add(ctx, "RestoreCtr: releasing container name "+ctr.Name(), func() error {
+		s.ReleaseContainerName(ctx, ctr.Name())
+		return nil
+	})
 
 	newContainer, err := s.createSandboxContainer(ctx, ctr, sb)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	defer func() {
-		if retErr != nil {
-			log.Infof(ctx, "RestoreCtr: deleting container %s from storage", ctr.ID())
-			err2 := s.StorageRuntimeServer().DeleteContainer(ctx, ctr.ID())
-			if err2 != nil {
-				log.Warnf(ctx, "Failed to cleanup container directory: %v", err2)
-			}
+	resourceCleaner.Add(ctx, "RestoreCtr: deleting container "+ctr.ID()+" from storage", func() error {
+		if err := s.StorageRuntimeServer().DeleteContainer(ctx, ctr.ID()); err != nil {
+			return fmt.Errorf("failed to cleanup container storage: %w", err)
 		}
-	}()
+		return nil
+	})
 
 	s.addContainer(ctx, newContainer)
-
-	defer func() {
-		if retErr != nil {
-			log.Infof(ctx, "RestoreCtr: removing container %s", newContainer.ID())
-			s.removeContainer(ctx, newContainer)
-		}
-	}()
+	resourceCleaner.Add(ctx, "RestoreCtr: removing container "+newContainer.ID(), func() error {
+		s.removeContainer(ctx, newContainer)
+		return nil
+	})
 
 	if err := s.CtrIDIndex().Add(ctr.ID()); err != nil {
-		return "", err
+		return nil, err
 	}
-	defer func() {
-		if retErr != nil {
-			log.Infof(ctx, "RestoreCtr: deleting container ID %s from idIndex", ctr.ID())
-			if err := s.CtrIDIndex().Delete(ctr.ID()); err != nil {
-				log.Warnf(ctx, "Couldn't delete ctr id %s from idIndex", ctr.ID())
-			}
+	resourceCleaner.Add(ctx, "RestoreCtr: deleting container ID "+ctr.ID()+" from idIndex", func() error {
+		if err := s.CtrIDIndex().Delete(ctr.ID()); err != nil && !strings.Contains(err.Error(), noSuchID) {
+			return err
 		}
-	}()
-
-	newContainer.SetCreated()
-	newContainer.SetRestore(true)
-	newContainer.SetRestoreArchivePath(restoreArchivePath)
-	newContainer.SetRestoreStorageImageID(restoreStorageImageID)
-	newContainer.SetCheckpointedAt(config.CheckpointedAt)
+		return nil
+	})
+	return newContainer, nil
+}
 
-	if isContextError(ctx.Err()) {
-		log.Infof(ctx, "RestoreCtr: context was either canceled or the deadline was exceeded: %v", ctx.Err())
-		return "", ctx.Err()
-	}
-	return ctr.ID(), nil
+// restoreFunc restores a container for restoreOnce, adding the steps
+// releasing it to resourceCleaner. The cleaner runs if the restore fails.
+type restoreFunc func(ctx context.Context, resourceCleaner *resourcestore.ResourceCleaner) (*oci.Container, error)
+
+// restoreOnce runs restore for the container name unless a restore of the
+// same name is already in flight. Restoring a large archive takes longer
+// than the CreateContainer timeout of the kubelet, which then retries while
+// the first attempt is still preparing the storage of the container. Instead
+// of starting a second restore against the same storage, a retry waits for
+// the attempt in flight and returns the ID of the restored container.
+// The restore is not bound to ctx. If ctx is done first, the restored
+// container is kept in the containerStore for a retry to pick it up, and its
+// cleaner removes it again if no retry arrives before it becomes stale.
+func (s *Server) restoreOnce(ctx context.Context, name string, restore restoreFunc) (string, error) {
+	restoreCtx := context.WithoutCancel(ctx)
+	return s.containerStore.Create(ctx, resourcestore.DefaultNamespace, name, func(resourceCleaner *resourcestore.ResourceCleaner) (resourcestore.IdentifiableCreatable, error) {
+		s.containerStore.SetStageForResource(restoreCtx, resourcestore.DefaultNamespace, name, "container restoring")
+		newContainer, err := restore(restoreCtx, resourceCleaner)
+		if err != nil {
+			return nil, err
+		}
+		setContainerCleanupManifest(resourceCleaner, newContainer.ID())
+		return newContainer, nil
+	})
 }
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	types "k8s.io/cri-api/pkg/apis/runtime/v1"
+)
+
+var _ = Describe("ContainerRestoreEnv", func() {
+	checkpointEnv := []string{
+		"PATH=/usr/bin",
+		"NODE_NAME=old-node",
+		"POD_IP=10.0.0.1",
+		"SECRET=checkpointed",
+	}
+	requestEnvs := []*types.KeyValue{
+		{Key: "NODE_NAME", Value: "new-node"},
+		{Key: "POD_IP", Value: "10.0.0.2"},
+		{Key: "POD_IPS", Value: "10.0.0.2"},
+		{Key: "SECRET", Value: "changed"},
+		{Key: "PATH", Value: "/usr/bin"},
+		{Key: "", Value: "ignored"},
+	}
+
+	It("should override the allowed variables", func() {
+		// When
+		envs, overridden := checkpointEnvs(context.Background(), checkpointEnv, requestEnvs, []string{"NODE_NAME", "POD_IP*"})
+
+		// Then
+		Expect(envs).To(Equal([]*types.KeyValue{
+			{Key: "PATH", Value: "/usr/bin"},
+			{Key: "NODE_NAME", Value: "new-node"},
+			{Key: "POD_IP", Value: "10.0.0.2"},
+			{Key: "SECRET", Value: "checkpointed"},
+			{Key: "POD_IPS", Value: "10.0.0.2"},
+		}))
+		Expect(overridden).To(Equal([]string{"NODE_NAME", "POD_IP", "POD_IPS"}))
+	})
+
+	It("should keep the checkpointed environment without allowlist", func() {
+		// When
+		envs, overridden := checkpointEnvs(context.Background(), checkpointEnv, requestEnvs, nil)
+
+		// Then
+		Expect(envs).To(HaveLen(len(checkpointEnv)))
+		Expect(envs[1].Value).To(Equal("old-node"))
+		Expect(overridden).To(BeNil())
+	})
+})
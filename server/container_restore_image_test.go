@@ -0,0 +1,24 @@
+package server
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+
+	"github.com/cri-o/cri-o/internal/storage"
+)
+
+var _ = Describe("ContainerRestoreImage", func() {
+	dgst := digest.FromString("manifest")
+	other := digest.FromString("other")
+
+	DescribeTable("imageHasDigest",
+		func(status *storage.ImageResult, expected bool) {
+			Expect(imageHasDigest(status, dgst)).To(Equal(expected))
+		},
+		Entry("manifest digest", &storage.ImageResult{Digest: dgst}, true),
+		Entry("repo digest", &storage.ImageResult{Digest: other, RepoDigests: []string{"quay.io/crio/image@" + dgst.String()}}, true),
+		Entry("different digest", &storage.ImageResult{Digest: other, RepoDigests: []string{"quay.io/crio/image@" + other.String()}}, false),
+		Entry("no digest", &storage.ImageResult{}, false),
+	)
+})
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"context"
+	"fmt"
+
+	spec "github.com/opencontainers/runtime-spec/specs-go"
+	"google.golang.org/grpc"
+	grpcmetadata "google.golang.org/grpc/metadata"
+	types "k8s.io/cri-api/pkg/apis/runtime/v1"
+
+	"github.com/cri-o/cri-o/internal/log"
+	"github.com/cri-o/cri-o/pkg/annotations"
+)
+
+// checkpointRestoreModeHeader is the gRPC response header of CreateContainer
+// holding the mode a container is restored from a checkpoint with.
+const checkpointRestoreModeHeader = "checkpoint-restore-mode"
+
+// The modes of the CheckpointAnnotationRestoreMode annotation.
+const (
+	// checkpointRestoreModeRestore restores the checkpointed processes.
+	checkpointRestoreModeRestore = "restore"
+	// checkpointRestoreModeCold creates the container fresh from the spec
+	// of the checkpoint, its processes start anew from the base image.
+	checkpointRestoreModeCold = "cold"
+)
+
+// checkpointRestoreMode returns the mode to restore a container with the
+// annotations of the restore request with.
+func checkpointRestoreMode(createAnnotations map[string]string) (string, error) {
+	mode, ok := createAnnotations[annotations.CheckpointAnnotationRestoreMode]
+	if !ok {
+		return checkpointRestoreModeRestore, nil
+	}
+	switch mode {
+	case checkpointRestoreModeRestore, checkpointRestoreModeCold:
+		return mode, nil
+	}
+	return "", fmt.Errorf("invalid %s annotation %q: has to be %q or %q", annotations.CheckpointAnnotationRestoreMode, mode, checkpointRestoreModeRestore, checkpointRestoreModeCold)
+}
+
+// setCheckpointRestoreModeHeader returns the mode a container is restored
+// with in the response header.
+func setCheckpointRestoreModeHeader(ctx context.Context, mode string) {
+	if err := grpc.SetHeader(ctx, grpcmetadata.Pairs(checkpointRestoreModeHeader, mode)); err != nil {
+		log.Debugf(ctx, "Unable to set checkpoint restore mode header: %v", err)
+	}
+}
+
+// coldRestoreProcess sets the command and working directory of the
+// containerConfig of a cold restore to those of the checkpointed process,
+// unless the restore request createConfig overrides them.
+func coldRestoreProcess(containerConfig, createConfig *types.ContainerConfig, process *spec.Process) {
+	if len(createConfig.GetCommand()) > 0 || len(createConfig.GetArgs()) > 0 {
+		containerConfig.Command = createConfig.GetCommand()
+		containerConfig.Args = createConfig.GetArgs()
+	} else if process != nil {
+		containerConfig.Command = process.Args
+	}
+	containerConfig.WorkingDir = createConfig.GetWorkingDir()
+	if containerConfig.WorkingDir == "" && process != nil {
+		containerConfig.WorkingDir = process.Cwd
+	}
+}
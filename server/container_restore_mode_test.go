@@ -0,0 +1,50 @@
+package server
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	spec "github.com/opencontainers/runtime-spec/specs-go"
+	types "k8s.io/cri-api/pkg/apis/runtime/v1"
+
+	"github.com/cri-o/cri-o/pkg/annotations"
+)
+
+var _ = Describe("ContainerRestoreMode", func() {
+	DescribeTable("checkpointRestoreMode",
+		func(value, expected string) {
+			createAnnotations := map[string]string{}
+			if value != "" {
+				createAnnotations[annotations.CheckpointAnnotationRestoreMode] = value
+			}
+			Expect(checkpointRestoreMode(createAnnotations)).To(Equal(expected))
+		},
+		Entry("default", "", checkpointRestoreModeRestore),
+		Entry("restore", checkpointRestoreModeRestore, checkpointRestoreModeRestore),
+		Entry("cold", checkpointRestoreModeCold, checkpointRestoreModeCold),
+	)
+
+	It("should reject an invalid mode", func() {
+		_, err := checkpointRestoreMode(map[string]string{annotations.CheckpointAnnotationRestoreMode: "warm"})
+		Expect(err).To(HaveOccurred())
+	})
+
+	Context("coldRestoreProcess", func() {
+		process := &spec.Process{Args: []string{"/app", "--serve"}, Cwd: "/srv"}
+
+		It("should start the checkpointed process", func() {
+			containerConfig := &types.ContainerConfig{}
+			coldRestoreProcess(containerConfig, &types.ContainerConfig{}, process)
+			Expect(containerConfig.Command).To(Equal(process.Args))
+			Expect(containerConfig.Args).To(BeNil())
+			Expect(containerConfig.WorkingDir).To(Equal("/srv"))
+		})
+
+		It("should apply the overrides of the request", func() {
+			containerConfig := &types.ContainerConfig{}
+			coldRestoreProcess(containerConfig, &types.ContainerConfig{Args: []string{"--migrate"}, WorkingDir: "/tmp"}, process)
+			Expect(containerConfig.Command).To(BeNil())
+			Expect(containerConfig.Args).To(Equal([]string{"--migrate"}))
+			Expect(containerConfig.WorkingDir).To(Equal("/tmp"))
+		})
+	})
+})
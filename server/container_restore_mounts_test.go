@@ -0,0 +1,31 @@
+package server
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/cri-o/cri-o/pkg/annotations"
+)
+
+var _ = Describe("ContainerRestoreMounts", func() {
+	It("should not remap without annotation", func() {
+		Expect(checkpointMountRemap(map[string]string{})).To(BeNil())
+	})
+
+	It("should remap the mounts of the annotation", func() {
+		remap, err := checkpointMountRemap(map[string]string{
+			annotations.CheckpointAnnotationMountRemap: `{"/data/source":"/data/target","/etc/config":"/etc/config"}`,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(remap).To(Equal(map[string]string{"/data/source": "/data/target", "/etc/config": "/etc/config"}))
+	})
+
+	DescribeTable("should reject invalid annotations",
+		func(value string) {
+			_, err := checkpointMountRemap(map[string]string{annotations.CheckpointAnnotationMountRemap: value})
+			Expect(err).To(HaveOccurred())
+		},
+		Entry("not JSON", `not json`),
+		Entry("relative target", `{"/data/source":"relative"}`),
+	)
+})
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+
+	cnicurrent "github.com/containernetworking/cni/pkg/types/100"
+
+	"github.com/cri-o/cri-o/internal/lib"
+	"github.com/cri-o/cri-o/internal/lib/sandbox"
+	"github.com/cri-o/cri-o/internal/log"
+	"github.com/cri-o/cri-o/internal/oci"
+	"github.com/cri-o/cri-o/pkg/annotations"
+	libconfig "github.com/cri-o/cri-o/pkg/config"
+)
+
+// errCheckpointSandboxIPChanged is returned if a container is restored into
+// a sandbox without the checkpointed IPs and the restore has to fail.
+var errCheckpointSandboxIPChanged = errors.New("sandbox IPs differ from the checkpoint")
+
+// checkpointIPDivergence describes a restore into a sandbox without the IPs of
+// the checkpointed sandbox. It is recorded as the
+// CheckpointAnnotationIPDivergence annotation of the restored container.
+type checkpointIPDivergence struct {
+	// Mismatch is the applied checkpoint_restore_ip_mismatch handling.
+	Mismatch string `json:"mismatch"`
+	// Removed are the checkpointed IPs the sandbox does not have, Added
+	// the IPs of the sandbox which have not been checkpointed.
+	Removed []string `json:"removed"`
+	Added   []string `json:"added,omitempty"`
+
+	secondaryIPs []sandboxSecondaryIP
+}
+
+// sandboxSecondaryIP is a checkpointed IP added to the interface iface of the
+// sandbox for CheckpointRestoreIPMismatchSecondaryIP.
+type sandboxSecondaryIP struct {
+	iface   string
+	address net.IPNet
+}
+
+// checkpointIPDivergence compares the IPs of the checkpointed sandbox in info
+// with the IPs of the sandbox sb the container is restored into. It returns
+// nil if the sandbox has all checkpointed IPs, or if they are unknown. The
+// handling of other IPs is checkpoint_restore_ip_mismatch, or the
+// CheckpointAnnotationIPMismatch annotation of the restore request.
+func (s *Server) checkpointIPDivergence(ctx context.Context, info *lib.CheckpointInfo, sb *sandbox.Sandbox, createAnnotations map[string]string) (*checkpointIPDivergence, error) {
+	mismatch := s.config.CheckpointRestoreIPMismatch
+	if value, ok := createAnnotations[annotations.CheckpointAnnotationIPMismatch]; ok {
+		if err := libconfig.ValidateCheckpointRestoreIPMismatch(value); err != nil {
+			return nil, fmt.Errorf("invalid %s annotation: %w", annotations.CheckpointAnnotationIPMismatch, err)
+		}
+		mismatch = value
+	}
+
+	divergence := &checkpointIPDivergence{Mismatch: mismatch}
+	for _, ip := range info.SandboxIPs {
+		if !slices.Contains(sb.IPs(), ip) {
+			divergence.Removed = append(divergence.Removed, ip)
+		}
+	}
+	if len(divergence.Removed) == 0 {
+		return nil, nil
+	}
+	for _, ip := range sb.IPs() {
+		if !slices.Contains(info.SandboxIPs, ip) {
+			divergence.Added = append(divergence.Added, ip)
+		}
+	}
+
+	switch mismatch {
+	case libconfig.CheckpointRestoreIPMismatchFail:
+		return nil, fmt.Errorf("%w: checkpointed %v, restoring into %v", errCheckpointSandboxIPChanged, info.SandboxIPs, sb.IPs())
+	case libconfig.CheckpointRestoreIPMismatchSecondaryIP:
+		var cniResult string
+		if infra := sb.InfraContainer(); infra != nil {
+			cniResult = infra.Spec().Annotations[annotations.CNIResult]
+		}
+		secondaryIPs, err := sandboxSecondaryIPs(cniResult, divergence.Removed)
+		if err != nil {
+			log.Warnf(ctx, "Unable to add the checkpointed IPs to sandbox %s, restoring with %s: %v", sb.ID(), libconfig.CheckpointRestoreIPMismatchTCPClose, err)
+			divergence.Mismatch = libconfig.CheckpointRestoreIPMismatchTCPClose
+			break
+		}
+		divergence.secondaryIPs = secondaryIPs
+	}
+	log.Warnf(ctx, "Sandbox %s does not have the checkpointed IPs %v, new IPs %v, restoring with %s", sb.ID(), divergence.Removed, divergence.Added, divergence.Mismatch)
+	return divergence, nil
+}
+
+// sandboxSecondaryIPs returns the IPs to add as secondary addresses to the
+// interfaces of a sandbox with the CNI result cniResult. Each IP is added to
+// the interface of the sandbox whose subnet contains it, with the mask of the
+// subnet. It fails if an IP is not in the subnet of an interface.
+func sandboxSecondaryIPs(cniResult string, ips []string) ([]sandboxSecondaryIP, error) {
+	if cniResult == "" {
+		return nil, errors.New("no CNI result")
+	}
+	result := &cnicurrent.Result{}
+	if err := json.Unmarshal([]byte(cniResult), result); err != nil {
+		return nil, fmt.Errorf("parse CNI result: %w", err)
+	}
+
+	secondaryIPs := make([]sandboxSecondaryIP, 0, len(ips))
+	for _, value := range ips {
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid checkpointed IP %q", value)
+		}
+		found := false
+		for _, config := range result.IPs {
+			// Only interfaces in the network namespace of the sandbox.
+			if config.Interface == nil || *config.Interface < 0 || *config.Interface >= len(result.Interfaces) {
+				continue
+			}
+			iface := result.Interfaces[*config.Interface]
+			if iface.Sandbox == "" || !config.Address.Contains(ip) {
+				continue
+			}
+			secondaryIPs = append(secondaryIPs, sandboxSecondaryIP{
+				iface:   iface.Name,
+				address: net.IPNet{IP: ip, Mask: config.Address.Mask},
+			})
+			found = true
+			break
+		}
+		if !found {
+			return nil, fmt.Errorf("checkpointed IP %s is not in the subnet of an interface of the sandbox", value)
+		}
+	}
+	return secondaryIPs, nil
+}
+
+// restoreCriuOptions returns the additional CRIU options for the restore of a
+// container with the annotations of the restore request.
+func restoreCriuOptions(ctrAnnotations map[string]string) []string {
+	value, ok := ctrAnnotations[annotations.CheckpointAnnotationIPDivergence]
+	if !ok {
+		return nil
+	}
+	divergence := &checkpointIPDivergence{}
+	if err := json.Unmarshal([]byte(value), divergence); err != nil {
+		return nil
+	}
+	if divergence.Mismatch == libconfig.CheckpointRestoreIPMismatchTCPClose {
+		return []string{oci.CriuOptionTCPClose}
+	}
+	return nil
+}
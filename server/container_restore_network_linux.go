@@ -0,0 +1,48 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+
+	"github.com/cri-o/cri-o/internal/log"
+	"github.com/cri-o/cri-o/internal/resourcestore"
+)
+
+// addSandboxSecondaryIPs adds the IPs as secondary addresses to the
+// interfaces in the network namespace netNsPath of a sandbox, adding the steps
+// removing them again to resourceCleaner. IPs the interfaces already have,
+// like those added for another container restored into the sandbox, are kept.
+func addSandboxSecondaryIPs(ctx context.Context, netNsPath string, ips []sandboxSecondaryIP, resourceCleaner *resourcestore.ResourceCleaner) error {
+	return ns.WithNetNSPath(netNsPath, func(_ ns.NetNS) error {
+		for _, ip := range ips {
+			link, err := netlink.LinkByName(ip.iface)
+			if err != nil {
+				return fmt.Errorf("find interface %s of the sandbox: %w", ip.iface, err)
+			}
+			addr := &netlink.Addr{IPNet: &ip.address}
+			if ip.address.IP.To4() == nil {
+				// The address is in use by the restored processes, there
+				// is no need to wait for duplicate address detection.
+				addr.Flags = unix.IFA_F_NODAD
+			}
+			if err := netlink.AddrAdd(link, addr); err != nil {
+				if errors.Is(err, unix.EEXIST) {
+					continue
+				}
+				return fmt.Errorf("add %s to interface %s of the sandbox: %w", ip.address.String(), ip.iface, err)
+			}
+			log.Infof(ctx, "Added checkpointed IP %s to interface %s of the sandbox", ip.address.String(), ip.iface)
+			resourceCleaner.Add(ctx, "RestoreCtr: removing checkpointed IP "+ip.address.String(), func() error {
+				return ns.WithNetNSPath(netNsPath, func(_ ns.NetNS) error {
+					return netlink.AddrDel(link, addr)
+				})
+			})
+		}
+		return nil
+	})
+}
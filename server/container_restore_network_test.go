@@ -0,0 +1,125 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	types "k8s.io/cri-api/pkg/apis/runtime/v1"
+
+	"github.com/cri-o/cri-o/internal/hostport"
+	"github.com/cri-o/cri-o/internal/lib"
+	"github.com/cri-o/cri-o/internal/lib/sandbox"
+	"github.com/cri-o/cri-o/internal/oci"
+	"github.com/cri-o/cri-o/pkg/annotations"
+	libconfig "github.com/cri-o/cri-o/pkg/config"
+)
+
+const testCNIResult = `{
+	"cniVersion": "1.0.0",
+	"interfaces": [
+		{"name": "cni0"},
+		{"name": "eth0", "sandbox": "/var/run/netns/test"}
+	],
+	"ips": [
+		{"interface": 1, "address": "10.88.0.7/16"},
+		{"interface": 0, "address": "192.168.0.1/24"}
+	]
+}`
+
+var _ = Describe("ContainerRestoreNetwork", func() {
+	Context("checkpointIPDivergence", func() {
+		var (
+			s    *Server
+			sb   *sandbox.Sandbox
+			info *lib.CheckpointInfo
+		)
+
+		BeforeEach(func() {
+			var err error
+			sb, err = sandbox.New("sandbox", "", "", "", ".", map[string]string{}, map[string]string{}, "", "",
+				&types.PodSandboxMetadata{}, "", "", false, "", "", "", []*hostport.PortMapping{}, false, time.Now(), "", nil, nil)
+			Expect(err).ToNot(HaveOccurred())
+			sb.AddIPs([]string{"10.88.0.7", "fd00::7"})
+			s = &Server{}
+			s.config.CheckpointRestoreIPMismatch = libconfig.CheckpointRestoreIPMismatchTCPClose
+			info = &lib.CheckpointInfo{SandboxIPs: []string{"10.88.0.5", "fd00::7"}}
+		})
+
+		DescribeTable("should not report a divergence",
+			func(ips []string) {
+				Expect(s.checkpointIPDivergence(context.Background(), &lib.CheckpointInfo{SandboxIPs: ips}, sb, nil)).To(BeNil())
+			},
+			Entry("without checkpointed IPs", nil),
+			Entry("for a subset of the IPs", []string{"10.88.0.7"}),
+		)
+
+		It("should report the changed IPs", func() {
+			// When
+			divergence, err := s.checkpointIPDivergence(context.Background(), info, sb, nil)
+
+			// Then
+			Expect(err).ToNot(HaveOccurred())
+			Expect(divergence.Mismatch).To(Equal(libconfig.CheckpointRestoreIPMismatchTCPClose))
+			Expect(divergence.Removed).To(Equal([]string{"10.88.0.5"}))
+			Expect(divergence.Added).To(Equal([]string{"10.88.0.7"}))
+		})
+
+		It("should fail if requested by the annotation", func() {
+			createAnnotations := map[string]string{annotations.CheckpointAnnotationIPMismatch: libconfig.CheckpointRestoreIPMismatchFail}
+			Expect(s.checkpointIPDivergence(context.Background(), info, sb, createAnnotations)).Error().To(MatchError(errCheckpointSandboxIPChanged))
+		})
+
+		It("should fail for an invalid annotation", func() {
+			createAnnotations := map[string]string{annotations.CheckpointAnnotationIPMismatch: "ignore"}
+			Expect(s.checkpointIPDivergence(context.Background(), info, sb, createAnnotations)).Error().To(HaveOccurred())
+		})
+
+		It("should fall back to closing TCP connections without CNI result", func() {
+			// Given
+			// Without CNI result the checkpointed IPs cannot be added.
+			createAnnotations := map[string]string{annotations.CheckpointAnnotationIPMismatch: libconfig.CheckpointRestoreIPMismatchSecondaryIP}
+
+			// When
+			divergence, err := s.checkpointIPDivergence(context.Background(), info, sb, createAnnotations)
+
+			// Then
+			Expect(err).ToNot(HaveOccurred())
+			Expect(divergence.Mismatch).To(Equal(libconfig.CheckpointRestoreIPMismatchTCPClose))
+		})
+	})
+
+	It("should add the checkpointed IPs to the interface of their subnet", func() {
+		secondaryIPs, err := sandboxSecondaryIPs(testCNIResult, []string{"10.88.0.5"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(secondaryIPs).To(HaveLen(1))
+		Expect(secondaryIPs[0].iface).To(Equal("eth0"))
+		Expect(secondaryIPs[0].address.String()).To(Equal("10.88.0.5/16"))
+	})
+
+	DescribeTable("should not add secondary IPs",
+		func(result string, ips []string) {
+			Expect(sandboxSecondaryIPs(result, ips)).Error().To(HaveOccurred())
+		},
+		Entry("not in a subnet of the sandbox", testCNIResult, []string{"10.89.0.5"}),
+		Entry("only in the subnet of an interface outside of the sandbox", testCNIResult, []string{"192.168.0.5"}),
+		Entry("invalid", testCNIResult, []string{"invalid"}),
+		Entry("without CNI result", "", []string{"10.88.0.5"}),
+	)
+
+	DescribeTable("restoreCriuOptions",
+		func(mismatch string, expected []string) {
+			value, err := json.Marshal(&checkpointIPDivergence{Mismatch: mismatch, Removed: []string{"10.88.0.5"}})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(restoreCriuOptions(map[string]string{annotations.CheckpointAnnotationIPDivergence: string(value)})).To(Equal(expected))
+		},
+		Entry("closing TCP connections", libconfig.CheckpointRestoreIPMismatchTCPClose, []string{oci.CriuOptionTCPClose}),
+		Entry("adding secondary IPs", libconfig.CheckpointRestoreIPMismatchSecondaryIP, nil),
+	)
+
+	It("should not set CRIU options without divergence", func() {
+		Expect(restoreCriuOptions(map[string]string{})).To(BeNil())
+	})
+})
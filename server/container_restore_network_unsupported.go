@@ -0,0 +1,15 @@
+//go:build !linux
+// +build !linux
+
+package server
+
+import (
+	"context"
+	"errors"
+
+	"github.com/cri-o/cri-o/internal/resourcestore"
+)
+
+func addSandboxSecondaryIPs(ctx context.Context, netNsPath string, ips []sandboxSecondaryIP, resourceCleaner *resourcestore.ResourceCleaner) error {
+	return errors.New("adding secondary IPs to the sandbox is not supported")
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	types "k8s.io/cri-api/pkg/apis/runtime/v1"
+
+	"github.com/cri-o/cri-o/pkg/annotations"
+)
+
+var _ = Describe("ContainerRestoreResources", func() {
+	var requested *types.LinuxContainerResources
+
+	BeforeEach(func() {
+		requested = &types.LinuxContainerResources{
+			CpuShares:              512,
+			MemoryLimitInBytes:     1 << 30,
+			MemorySwapLimitInBytes: 1 << 30,
+		}
+	})
+
+	It("should keep the requested resources without overrides", func() {
+		Expect(checkpointResourceOverrides(map[string]string{}, requested, 0)).To(BeIdenticalTo(requested))
+	})
+
+	It("should override the limits", func() {
+		// When
+		resources, err := checkpointResourceOverrides(map[string]string{
+			annotations.CheckpointAnnotationCPULimit:    "1500m",
+			annotations.CheckpointAnnotationMemoryLimit: "512Mi",
+		}, requested, 256<<20)
+
+		// Then
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resources.CpuPeriod).To(BeEquivalentTo(defaultCPUPeriod))
+		Expect(resources.CpuQuota).To(BeEquivalentTo(150000))
+		Expect(resources.MemoryLimitInBytes).To(BeEquivalentTo(512 << 20))
+		Expect(resources.MemorySwapLimitInBytes).To(BeEquivalentTo(512 << 20))
+		Expect(resources.CpuShares).To(BeEquivalentTo(512))
+		// The requested resources are left alone.
+		Expect(requested.MemoryLimitInBytes).To(BeEquivalentTo(1 << 30))
+		Expect(requested.CpuQuota).To(BeZero())
+	})
+
+	It("should reject a memory limit below the checkpoint", func() {
+		_, err := checkpointResourceOverrides(map[string]string{
+			annotations.CheckpointAnnotationMemoryLimit: "128Mi",
+		}, requested, 256<<20)
+		Expect(err).To(MatchError(errCheckpointMemoryLimitTooLow))
+	})
+
+	DescribeTable("should reject invalid overrides",
+		func(overrides map[string]string) {
+			_, err := checkpointResourceOverrides(overrides, requested, 0)
+			Expect(err).To(HaveOccurred())
+		},
+		Entry("invalid CPU limit", map[string]string{annotations.CheckpointAnnotationCPULimit: "lots"}),
+		Entry("zero CPU limit", map[string]string{annotations.CheckpointAnnotationCPULimit: "0"}),
+		Entry("negative memory limit", map[string]string{annotations.CheckpointAnnotationMemoryLimit: "-1Gi"}),
+	)
+})
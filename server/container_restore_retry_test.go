@@ -0,0 +1,137 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	types "k8s.io/cri-api/pkg/apis/runtime/v1"
+
+	"github.com/cri-o/cri-o/internal/oci"
+	"github.com/cri-o/cri-o/internal/resourcestore"
+)
+
+// fakeRestoreStorage records the storage prepared by a restoreFunc which has
+// not been released again.
+type fakeRestoreStorage struct {
+	mutex      sync.Mutex
+	containers map[string]bool
+	restores   int32
+}
+
+// restore returns a restoreFunc preparing storage for the container id, after
+// waiting for release.
+func (f *fakeRestoreStorage) restore(id string, release <-chan struct{}) restoreFunc {
+	return func(ctx context.Context, cleaner *resourcestore.ResourceCleaner) (*oci.Container, error) {
+		f.mutex.Lock()
+		atomic.AddInt32(&f.restores, 1)
+		if f.containers[id] {
+			f.mutex.Unlock()
+			return nil, errors.New("storage of container " + id + " already exists")
+		}
+		f.containers[id] = true
+		f.mutex.Unlock()
+
+		cleaner.Add(ctx, "deleting container "+id+" from storage", func() error {
+			f.mutex.Lock()
+			defer f.mutex.Unlock()
+			delete(f.containers, id)
+			return nil
+		})
+		<-release
+
+		ctr, err := oci.NewContainer(id, "name", "", "", nil, nil, nil,
+			"image", nil, nil, "", &types.ContainerMetadata{}, "sandbox",
+			false, false, false, "", "", time.Now(), "")
+		if err != nil {
+			return nil, err
+		}
+		return ctr, nil
+	}
+}
+
+func (f *fakeRestoreStorage) stored() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return len(f.containers)
+}
+
+var _ = Describe("ContainerRestoreRetry", func() {
+	var (
+		s       *Server
+		storage *fakeRestoreStorage
+		release chan struct{}
+	)
+
+	BeforeEach(func() {
+		s = newTestServer()
+		storage = &fakeRestoreStorage{containers: make(map[string]bool)}
+		release = make(chan struct{})
+	})
+
+	It("should restore a container once for concurrent attempts", func() {
+		// Given
+		ids := make(chan string, 2)
+		for _, id := range []string{"first", "second"} {
+			go func() {
+				defer GinkgoRecover()
+				ctrID, err := s.restoreOnce(context.Background(), "ctr", storage.restore(id, release))
+				Expect(err).ToNot(HaveOccurred())
+				ids <- ctrID
+			}()
+		}
+
+		// When
+		// Let both attempts reach the store before the restore finishes.
+		time.Sleep(100 * time.Millisecond)
+		close(release)
+
+		// Then
+		first, second := <-ids, <-ids
+		Expect(first).To(Equal(second))
+		Expect(atomic.LoadInt32(&storage.restores)).To(BeEquivalentTo(1))
+		Expect(storage.stored()).To(Equal(1))
+		exists, _, _ := s.containerStore.PeekState("", "ctr")
+		Expect(exists).To(BeFalse())
+	})
+
+	It("should return the restored container to a retry after a timeout", func() {
+		// Given
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		DeferCleanup(cancel)
+		Expect(s.restoreOnce(ctx, "ctr", storage.restore("first", release))).Error().To(MatchError(context.DeadlineExceeded))
+		close(release)
+
+		// When
+		ctrID, err := s.restoreOnce(context.Background(), "ctr", storage.restore("second", release))
+
+		// Then
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ctrID).To(Equal("first"))
+		Expect(atomic.LoadInt32(&storage.restores)).To(BeEquivalentTo(1))
+		Expect(storage.stored()).To(Equal(1))
+	})
+
+	It("should clean up a restore without retry", func() {
+		// Given
+		s.containerStore = resourcestore.NewWithTimeout(100 * time.Millisecond)
+		DeferCleanup(s.containerStore.Close)
+		close(release)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		// When
+		_, err := s.restoreOnce(ctx, "ctr", storage.restore("first", release))
+
+		// Then
+		Expect(err).To(MatchError(context.Canceled))
+		Eventually(func(g Gomega) {
+			g.Expect(atomic.LoadInt32(&storage.restores)).ToNot(BeZero())
+			g.Expect(storage.stored()).To(BeZero())
+		}).WithTimeout(10 * time.Second).Should(Succeed())
+	})
+})
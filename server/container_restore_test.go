@@ -34,6 +34,8 @@ var _ = t.Describe("ContainerRestore", func() {
 		createDummyConfig()
 		mockRuntimeInLibConfig()
 		serverConfig.SetCheckpointRestore(true)
+		// The archives of the tests are relative to the working directory.
+		serverConfig.CheckpointLocationAllowlist = nil
 		setupSUT()
 	})
 
@@ -78,7 +80,7 @@ var _ = t.Describe("ContainerRestore", func() {
 				context.Background(),
 				containerConfig,
 				"",
-				"",
+				nil,
 			)
 
 			// Then
@@ -102,7 +104,7 @@ var _ = t.Describe("ContainerRestore", func() {
 				context.Background(),
 				containerConfig,
 				"",
-				"",
+				nil,
 			)
 			// Then
 			Expect(err.Error()).To(ContainSubstring(`failed to read "spec.dump": open `))
@@ -124,7 +126,7 @@ var _ = t.Describe("ContainerRestore", func() {
 				context.Background(),
 				containerConfig,
 				"",
-				"",
+				nil,
 			)
 			// Then
 			Expect(err.Error()).To(ContainSubstring(`unpacking of checkpoint archive`))
@@ -158,7 +160,7 @@ var _ = t.Describe("ContainerRestore", func() {
 				context.Background(),
 				containerConfig,
 				"",
-				"",
+				nil,
 			)
 			// Then
 			Expect(err.Error()).To(ContainSubstring(`failed to read "spec.dump": failed to unmarshal `))
@@ -195,7 +197,7 @@ var _ = t.Describe("ContainerRestore", func() {
 				context.Background(),
 				containerConfig,
 				"",
-				"",
+				nil,
 			)
 
 			// Then
@@ -234,7 +236,7 @@ var _ = t.Describe("ContainerRestore", func() {
 				context.Background(),
 				containerConfig,
 				"",
-				"",
+				nil,
 			)
 
 			// Then
@@ -279,7 +281,7 @@ var _ = t.Describe("ContainerRestore", func() {
 				context.Background(),
 				containerConfig,
 				"",
-				"",
+				nil,
 			)
 
 			// Then
@@ -327,7 +329,7 @@ var _ = t.Describe("ContainerRestore", func() {
 				context.Background(),
 				containerConfig,
 				"",
-				"",
+				nil,
 			)
 
 			// Then
@@ -378,7 +380,7 @@ var _ = t.Describe("ContainerRestore", func() {
 				context.Background(),
 				containerConfig,
 				"",
-				"",
+				nil,
 			)
 
 			// Then
@@ -430,13 +432,83 @@ var _ = t.Describe("ContainerRestore", func() {
 				context.Background(),
 				containerConfig,
 				"",
-				"",
+				nil,
 			)
 
 			// Then
 			Expect(err.Error()).To(Equal(`PodSandboxId should not be empty`))
 		})
 	})
+	t.Describe("ContainerRestore from archive into new pod", func() {
+		remaps := []struct {
+			remap    string
+			expected string
+		}{
+			{`{}`, "no remapping for host path of checkpointed mount: /data"},
+			{
+				`{"/data":"/new/data","/unknown":"/new/unknown"}`,
+				"remapping for host path not mounted by checkpoint: /unknown",
+			},
+		}
+		for _, remap := range remaps {
+			It(fmt.Sprintf("should fail with mount remapping %s", remap.remap), func() {
+				// Given
+				addContainerAndSandbox()
+				testContainer.SetStateAndSpoofPid(&oci.ContainerState{
+					State: specs.State{Status: oci.ContainerStateRunning},
+				})
+
+				err := os.WriteFile(
+					"spec.dump",
+					[]byte(`{"annotations":{"io.kubernetes.cri-o.Metadata"`+
+						`:"{\"name\":\"container-to-restore\"}",`+
+						`"io.kubernetes.cri-o.Annotations": "{\"name\":\"NAME\"}",`+
+						`"io.kubernetes.cri-o.Labels": "{\"io.kubernetes.container.name\":\"counter\"}",`+
+						`"io.kubernetes.cri-o.SandboxID": "sandboxID"},`+
+						`"mounts": [{"destination": "/proc"},`+
+						`{"destination":"/data","source":"/data","options":["rw","rbind"]}]}`),
+					0o644,
+				)
+				Expect(err).ToNot(HaveOccurred())
+				defer os.RemoveAll("spec.dump")
+				err = os.WriteFile("config.dump", []byte(`{"rootfsImageName": "image"}`), 0o644)
+				Expect(err).ToNot(HaveOccurred())
+				defer os.RemoveAll("config.dump")
+				outFile, err := os.Create("archive.tar")
+				Expect(err).ToNot(HaveOccurred())
+				defer outFile.Close()
+				input, err := archive.TarWithOptions(".", &archive.TarOptions{
+					Compression:      archive.Uncompressed,
+					IncludeSourceDir: true,
+					IncludeFiles:     []string{"spec.dump", "config.dump"},
+				})
+				Expect(err).ToNot(HaveOccurred())
+				defer os.RemoveAll("archive.tar")
+				_, err = io.Copy(outFile, input)
+				Expect(err).ToNot(HaveOccurred())
+				containerConfig := &types.ContainerConfig{
+					Image: &types.ImageSpec{
+						Image: "archive.tar",
+					},
+					Annotations: map[string]string{
+						crioann.CheckpointAnnotationMountRemap: remap.remap,
+					},
+				}
+
+				// When
+				_, err = sut.CRImportCheckpoint(
+					context.Background(),
+					containerConfig,
+					"",
+					&types.PodSandboxConfig{},
+				)
+
+				// Then
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(Equal(remap.expected))
+			})
+		}
+	})
 	t.Describe("ContainerRestore from archive into new pod", func() {
 		images := []struct {
 			config string
@@ -575,7 +647,9 @@ var _ = t.Describe("ContainerRestore", func() {
 					context.Background(),
 					containerConfig,
 					"",
-					"new-sandbox-id",
+					&types.PodSandboxConfig{
+						Metadata: &types.PodSandboxMetadata{Uid: "new-sandbox-id"},
+					},
 				)
 
 				// Then
@@ -623,7 +697,7 @@ var _ = t.Describe("ContainerRestore", func() {
 				context.Background(),
 				containerConfig,
 				"",
-				"",
+				nil,
 			)
 
 			// Then
@@ -31,6 +31,14 @@ func (s *Server) StartContainer(ctx context.Context, req *types.StartContainerRe
 		// into the restore code.
 		log.Debugf(ctx, "Restoring container %q", req.ContainerId)
 
+		// The container is neither stopped nor removed while it is
+		// restored.
+		release, err := s.acquireCheckpointSlot(ctx, c.ID(), true)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+
 		ctr, err := s.ContainerServer.ContainerRestore(
 			ctx,
 			&metadata.ContainerConfig{
@@ -49,10 +57,11 @@ func (s *Server) StartContainer(ctx context.Context, req *types.StartContainerRe
 				log.Warnf(ctx, "Failed to cleanup container directory: %v", err2)
 			}
 			s.removeContainer(ctx, ociContainer)
-			return nil, err
+			return nil, checkpointStatusError(err)
 		}
 
-		log.Infof(ctx, "Restored container: %s", ctr)
+		s.generateCRIEvent(ctx, c, types.ContainerEventType_CONTAINER_STARTED_EVENT)
+		log.Infof(ctx, "Restored container: %s (restore %d, took %s)", ctr, c.RestoreCount(), c.LastRestoreDuration())
 		return &types.StartContainerResponse{}, nil
 	}
 
@@ -106,6 +115,7 @@ func (s *Server) StartContainer(ctx context.Context, req *types.StartContainerRe
 		return nil, fmt.Errorf("failed to start container %s: %w", c.ID(), err)
 	}
 	s.generateCRIEvent(ctx, c, types.ContainerEventType_CONTAINER_STARTED_EVENT)
+	s.startCrashDumpWatcher(ctx, c)
 
 	if err := s.nri.postStartContainer(ctx, sandbox, c); err != nil {
 		log.Warnf(ctx, "NRI post-start failed for container %q: %v", c.ID(), err)
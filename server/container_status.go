@@ -14,6 +14,7 @@ import (
 	"github.com/cri-o/cri-o/internal/log"
 	oci "github.com/cri-o/cri-o/internal/oci"
 	"github.com/cri-o/cri-o/internal/storage"
+	"github.com/cri-o/cri-o/pkg/annotations"
 )
 
 const (
@@ -29,6 +30,9 @@ func (s *Server) ContainerStatus(ctx context.Context, req *types.ContainerStatus
 	defer span.End()
 	c, err := s.GetContainerFromShortID(ctx, req.ContainerId)
 	if err != nil {
+		if inProgressErr := s.containerCreationInProgressError(ctx, req.ContainerId); inProgressErr != nil {
+			return nil, inProgressErr
+		}
 		return nil, status.Errorf(codes.NotFound, "could not find container %q: %v", req.ContainerId, err)
 	}
 
@@ -144,8 +148,12 @@ type containerInfo struct {
 }
 
 type containerInfoCheckpointRestore struct {
-	CheckpointedAt time.Time `json:"checkpointedAt"`
-	Restored       bool      `json:"restored"`
+	CheckpointedAt     time.Time              `json:"checkpointedAt"`
+	Restored           bool                   `json:"restored"`
+	RestoreMode        string                 `json:"restoreMode,omitempty"`
+	RestoreCount       int                    `json:"restoreCount,omitempty"`
+	LastRestoreSeconds float64                `json:"lastRestoreSeconds,omitempty"`
+	CheckpointFailures *checkpointFailureInfo `json:"checkpointFailures,omitempty"`
 }
 
 func (s *Server) createContainerInfo(container *oci.Container) (map[string]string, error) {
@@ -162,10 +170,14 @@ func (s *Server) createContainerInfo(container *oci.Container) (map[string]strin
 			Privileged:  metadata.Privileged,
 		}
 
-		if s.config.CheckpointRestore() {
+		if s.CheckpointRestoreEnabled() {
 			localContainerInfoCheckpointRestore := containerInfoCheckpointRestore{
-				CheckpointedAt: container.CheckpointedAt(),
-				Restored:       container.Restore(),
+				CheckpointedAt:     container.CheckpointedAt(),
+				Restored:           container.Restore(),
+				RestoreMode:        container.Annotations()[annotations.CheckpointAnnotationRestoreMode],
+				RestoreCount:       container.RestoreCount(),
+				LastRestoreSeconds: container.LastRestoreDuration().Seconds(),
+				CheckpointFailures: s.checkpointBreakers.info(container.ID(), time.Now()),
 			}
 			info := struct {
 				containerInfo
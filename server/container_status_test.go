@@ -3,6 +3,7 @@ package server_test
 import (
 	"context"
 	"errors"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -88,6 +89,34 @@ var _ = t.Describe("ContainerStatus", func() {
 			}, types.ContainerState_CONTAINER_EXITED, false),
 		)
 
+		It("should include the restore statistics in the verbose info", func() {
+			// Given
+			serverConfig.SetCheckpointRestore(true)
+			setupSUT()
+			addContainerAndSandbox()
+			testContainer.SetStateAndSpoofPid(&oci.ContainerState{
+				State: specs.State{Status: oci.ContainerStateRunning},
+			})
+			testContainer.SetRestored(3, 2*time.Second)
+			testContainer.SetSpec(&specs.Spec{Version: "1.0.0"})
+
+			gomock.InOrder(
+				runtimeServerMock.EXPECT().GetContainerMetadata(gomock.Any()).
+					Return(storage.RuntimeContainerMetadata{}, nil),
+			)
+			// When
+			response, err := sut.ContainerStatus(context.Background(),
+				&types.ContainerStatusRequest{
+					Verbose:     true,
+					ContainerId: testContainer.ID(),
+				})
+
+			// Then
+			Expect(err).ToNot(HaveOccurred())
+			Expect(response.Info["info"]).To(ContainSubstring(`"restoreCount":3`))
+			Expect(response.Info["info"]).To(ContainSubstring(`"lastRestoreSeconds":2`))
+		})
+
 		It("should fail with invalid container ID", func() {
 			// Given
 			// When
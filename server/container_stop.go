@@ -31,6 +31,12 @@ func (s *Server) StopContainer(ctx context.Context, req *types.StopContainerRequ
 		return nil, status.Errorf(codes.NotFound, "could not find container %q: %v", req.ContainerId, err)
 	}
 
+	release, err := s.holdCheckpointSlot(ctx, c.ID(), "stop")
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
 	if err := s.stopContainer(ctx, c, req.Timeout); err != nil {
 		return nil, err
 	}
@@ -3,19 +3,25 @@ package server
 import (
 	"errors"
 	"fmt"
+	"maps"
 	"math"
 	"net/http"
 	"net/http/pprof"
+	"strconv"
 
 	"github.com/containers/storage/pkg/idtools"
 	"github.com/go-chi/chi/v5"
 	json "github.com/json-iterator/go"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	cri "k8s.io/cri-api/pkg/apis/runtime/v1"
 
 	"github.com/cri-o/cri-o/internal/lib/sandbox"
 	"github.com/cri-o/cri-o/internal/log"
 	"github.com/cri-o/cri-o/internal/oci"
+	"github.com/cri-o/cri-o/internal/resourcestore"
 	"github.com/cri-o/cri-o/pkg/types"
 )
 
@@ -124,6 +130,22 @@ const (
 	InspectInfoEndpoint       = "/info"
 	InspectPauseEndpoint      = "/pause"
 	InspectUnpauseEndpoint    = "/unpause"
+
+	InspectCancelCheckpointEndpoint = "/cancel-checkpoint"
+	InspectResourceWatchersEndpoint = "/resource-watchers"
+
+	InspectResetCheckpointBreakerEndpoint = "/reset-checkpoint-breaker"
+
+	InspectResourceCleanupFailuresEndpoint = "/resource-cleanup-failures"
+	InspectResourcesEndpoint               = "/resources"
+
+	InspectCheckpointJobsEndpoint = "/checkpoint-jobs"
+
+	InspectStageCheckpointEndpoint = "/stage-checkpoint"
+
+	InspectCheckpointOperationsEndpoint = "/checkpoint-operations"
+
+	InspectCheckpointRestoreEndpoint = "/checkpoint-restore"
 )
 
 // GetExtendInterfaceMux returns the mux used to serve extend interface requests.
@@ -244,6 +266,224 @@ func (s *Server) GetExtendInterfaceMux(enableProfile bool) *chi.Mux {
 		}
 	}))
 
+	mux.Get(InspectCancelCheckpointEndpoint+"/{id}", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		containerID := chi.URLParam(req, "id")
+		if err := s.CancelCheckpoint(req.Context(), containerID); err != nil {
+			switch status.Code(err) {
+			case codes.NotFound:
+				http.Error(w, "can't find the container with id "+containerID, http.StatusNotFound)
+			case codes.FailedPrecondition:
+				http.Error(w, err.Error(), http.StatusConflict)
+			case codes.Unimplemented:
+				http.Error(w, err.Error(), http.StatusNotImplemented)
+			default:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		if _, err := w.Write([]byte("200 OK")); err != nil {
+			logrus.Errorf("Unable to write response JSON: %v", err)
+		}
+	}))
+
+	mux.Get(InspectResetCheckpointBreakerEndpoint+"/{id}", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		containerID := chi.URLParam(req, "id")
+		if err := s.ResetCheckpointBreaker(req.Context(), containerID); err != nil {
+			switch status.Code(err) {
+			case codes.NotFound:
+				http.Error(w, "can't find the container with id "+containerID, http.StatusNotFound)
+			case codes.Unimplemented:
+				http.Error(w, err.Error(), http.StatusNotImplemented)
+			default:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		if _, err := w.Write([]byte("200 OK")); err != nil {
+			logrus.Errorf("Unable to write response JSON: %v", err)
+		}
+	}))
+
+	mux.Post(InspectCheckpointJobsEndpoint, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		checkpointReq := &cri.CheckpointContainerRequest{}
+		if err := json.NewDecoder(req.Body).Decode(checkpointReq); err != nil {
+			http.Error(w, "invalid checkpoint request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		id, err := s.SubmitCheckpoint(req.Context(), checkpointReq)
+		if err != nil {
+			switch status.Code(err) {
+			case codes.NotFound:
+				http.Error(w, "can't find the container with id "+checkpointReq.ContainerId, http.StatusNotFound)
+			case codes.InvalidArgument:
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			case codes.PermissionDenied:
+				http.Error(w, err.Error(), http.StatusForbidden)
+			case codes.ResourceExhausted:
+				http.Error(w, err.Error(), http.StatusTooManyRequests)
+			case codes.Unimplemented:
+				http.Error(w, err.Error(), http.StatusNotImplemented)
+			case codes.Unavailable:
+				if retryAfter, ok := checkpointRetryAfter(err); ok {
+					w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+				}
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			default:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+		js, err := json.Marshal(map[string]string{"id": id})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		if _, err := w.Write(js); err != nil {
+			logrus.Errorf("Unable to write response JSON: %v", err)
+		}
+	}))
+
+	mux.Get(InspectCheckpointJobsEndpoint+"/{id}", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		jobID := chi.URLParam(req, "id")
+		job, err := s.GetCheckpointStatus(jobID)
+		if err != nil {
+			if status.Code(err) == codes.Unimplemented {
+				http.Error(w, err.Error(), http.StatusNotImplemented)
+				return
+			}
+			http.Error(w, "can't find the checkpoint job with id "+jobID, http.StatusNotFound)
+			return
+		}
+		js, err := json.Marshal(job)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := w.Write(js); err != nil {
+			logrus.Errorf("Unable to write response JSON: %v", err)
+		}
+	}))
+
+	mux.Post(InspectStageCheckpointEndpoint, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		stageReq := &struct {
+			Location string `json:"location"`
+		}{}
+		if err := json.NewDecoder(req.Body).Decode(stageReq); err != nil {
+			http.Error(w, "invalid stage request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		staged, err := s.StageCheckpoint(req.Context(), stageReq.Location)
+		if err != nil {
+			switch status.Code(err) {
+			case codes.InvalidArgument:
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			case codes.Unimplemented:
+				http.Error(w, err.Error(), http.StatusNotImplemented)
+			default:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+		js, err := json.Marshal(staged)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := w.Write(js); err != nil {
+			logrus.Errorf("Unable to write response JSON: %v", err)
+		}
+	}))
+
+	mux.Get(InspectCheckpointOperationsEndpoint, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if err := s.checkCheckpointRestoreEnabled(); err != nil {
+			http.Error(w, err.Error(), http.StatusNotImplemented)
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming not supported", http.StatusInternalServerError)
+			return
+		}
+		// One JSON message per line, until the client disconnects.
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+		encoder := json.NewEncoder(w)
+		for event := range s.WatchCheckpointOperations(req.Context()) {
+			if err := encoder.Encode(event); err != nil {
+				logrus.Errorf("Unable to write checkpoint operation JSON: %v", err)
+				return
+			}
+			flusher.Flush()
+		}
+	}))
+
+	mux.Get(InspectCheckpointRestoreEndpoint, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		js, err := json.Marshal(s.CheckpointRestoreSupport())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := w.Write(js); err != nil {
+			logrus.Errorf("Unable to write response JSON: %v", err)
+		}
+	}))
+
+	mux.Get(InspectResourceWatchersEndpoint, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		counts := make(map[string]int)
+		for _, store := range s.resourceStores() {
+			maps.Copy(counts, store.WatcherCounts())
+		}
+		js, err := json.Marshal(counts)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := w.Write(js); err != nil {
+			logrus.Errorf("Unable to write response JSON: %v", err)
+		}
+	}))
+
+	mux.Get(InspectResourceCleanupFailuresEndpoint, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		failures := []resourcestore.CleanupFailure{}
+		for _, store := range s.resourceStores() {
+			failures = append(failures, store.CleanupFailures()...)
+		}
+		js, err := json.Marshal(failures)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := w.Write(js); err != nil {
+			logrus.Errorf("Unable to write response JSON: %v", err)
+		}
+	}))
+
+	mux.Get(InspectResourcesEndpoint, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		infos := []resourcestore.ResourceInfo{}
+		for _, store := range s.resourceStores() {
+			infos = append(infos, store.List()...)
+		}
+		js, err := json.Marshal(infos)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := w.Write(js); err != nil {
+			logrus.Errorf("Unable to write response JSON: %v", err)
+		}
+	}))
+
 	// Add pprof handlers
 	if enableProfile {
 		mux.Get("/debug/pprof/cmdline", http.HandlerFunc(pprof.Cmdline))
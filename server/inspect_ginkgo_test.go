@@ -1,16 +1,21 @@
 package server_test
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
 
 	"github.com/go-chi/chi/v5"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/opencontainers/runtime-spec/specs-go"
+	types "k8s.io/cri-api/pkg/apis/runtime/v1"
 
 	"github.com/cri-o/cri-o/internal/oci"
+	"github.com/cri-o/cri-o/server"
 )
 
 var _ = t.Describe("Inspect", func() {
@@ -257,3 +262,49 @@ var _ = t.Describe("Inspect", func() {
 		})
 	})
 })
+
+var _ = t.Describe("Inspect checkpoint jobs", func() {
+	var (
+		recorder *httptest.ResponseRecorder
+		mux      *chi.Mux
+		allowed  string
+	)
+
+	// Prepare the sut
+	BeforeEach(func() {
+		beforeEach()
+		mockRuntimeInLibConfig()
+		serverConfig.SetCheckpointRestore(true)
+		allowed = t.MustTempDir("checkpoints")
+		serverConfig.CheckpointLocationAllowlist = []string{allowed}
+		setupSUT()
+
+		recorder = httptest.NewRecorder()
+		mux = sut.GetExtendInterfaceMux(false)
+		Expect(mux).NotTo(BeNil())
+	})
+	AfterEach(afterEach)
+
+	DescribeTable("should reject checkpoint jobs to locations outside of the allowlist",
+		func(location func() string) {
+			// Given
+			addContainerAndSandbox()
+			body, err := json.Marshal(&types.CheckpointContainerRequest{
+				ContainerId: testContainer.ID(),
+				Location:    location(),
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			// When
+			request, err := http.NewRequest(http.MethodPost, server.InspectCheckpointJobsEndpoint, bytes.NewReader(body))
+			Expect(err).ToNot(HaveOccurred())
+			mux.ServeHTTP(recorder, request)
+
+			// Then
+			Expect(recorder.Code).To(BeEquivalentTo(http.StatusForbidden))
+		},
+		Entry("with an absolute path", func() string { return filepath.Join(t.MustTempDir("outside"), "cp.tar") }),
+		Entry("leaving the allowlist", func() string { return filepath.Join(allowed, "..", "cp.tar") }),
+		Entry("with a relative path", func() string { return "cp.tar" }),
+	)
+})
@@ -2,7 +2,10 @@ package server
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
@@ -11,6 +14,7 @@ import (
 
 	"github.com/cri-o/cri-o/internal/lib/sandbox"
 	"github.com/cri-o/cri-o/internal/oci"
+	"github.com/cri-o/cri-o/internal/resourcestore"
 	"github.com/cri-o/cri-o/internal/storage"
 	"github.com/cri-o/cri-o/internal/storage/references"
 	"github.com/cri-o/cri-o/pkg/config"
@@ -248,3 +252,136 @@ func TestGetContainerInfoSandboxNotFound(t *testing.T) {
 		t.Fatalf("expected errSandboxNotFound error, got %v", err)
 	}
 }
+
+func TestResourceWatchersEndpoint(t *testing.T) {
+	s := &Server{sandboxStore: resourcestore.New(), containerStore: resourcestore.New()}
+	defer s.sandboxStore.Close()
+	defer s.containerStore.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.sandboxStore.WatcherForResourceWithContext(ctx, "", "pod")
+	s.sandboxStore.WatcherForResourceWithContext(ctx, "", "pod")
+
+	recorder := httptest.NewRecorder()
+	s.GetExtendInterfaceMux(false).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, InspectResourceWatchersEndpoint, http.NoBody))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", recorder.Code)
+	}
+	counts := map[string]int{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &counts); err != nil {
+		t.Fatal(err)
+	}
+	if len(counts) != 1 || counts["pod"] != 2 {
+		t.Fatalf("expected two watchers for pod, got %v", counts)
+	}
+}
+
+func TestResourceCleanupFailuresEndpoint(t *testing.T) {
+	s := &Server{sandboxStore: resourcestore.New(), containerStore: resourcestore.New()}
+	defer s.sandboxStore.Close()
+	defer s.containerStore.Close()
+
+	recorder := httptest.NewRecorder()
+	s.GetExtendInterfaceMux(false).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, InspectResourceCleanupFailuresEndpoint, http.NoBody))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", recorder.Code)
+	}
+	failures := []resourcestore.CleanupFailure{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &failures); err != nil {
+		t.Fatal(err)
+	}
+	if len(failures) != 0 {
+		t.Fatalf("expected no cleanup failures, got %v", failures)
+	}
+}
+
+func TestResourcesEndpoint(t *testing.T) {
+	s := &Server{
+		sandboxStore:   resourcestore.NewNamed(sandboxStoreName, resourcestore.Options{}),
+		containerStore: resourcestore.NewNamed(containerStoreName, resourcestore.Options{}),
+	}
+	defer s.sandboxStore.Close()
+	defer s.containerStore.Close()
+	s.sandboxStore.SetStageForResource(context.Background(), "", "pod", "sandbox network ready")
+	s.containerStore.SetStageForResource(context.Background(), "", "ctr", "container creating")
+
+	recorder := httptest.NewRecorder()
+	s.GetExtendInterfaceMux(false).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, InspectResourcesEndpoint, http.NoBody))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", recorder.Code)
+	}
+	resources := []resourcestore.ResourceInfo{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &resources); err != nil {
+		t.Fatal(err)
+	}
+	if len(resources) != 2 {
+		t.Fatalf("expected the in-flight creations of pod and ctr, got %+v", resources)
+	}
+	stages := map[string]string{}
+	for _, resource := range resources {
+		if resource.Put {
+			t.Fatalf("expected only in-flight creations, got %+v", resource)
+		}
+		stages[resource.Store+"/"+resource.Name] = resource.Stage
+	}
+	if stages["sandbox/pod"] != "sandbox network ready" || stages["container/ctr"] != "container creating" {
+		t.Fatalf("expected the in-flight creations of pod and ctr by store, got %+v", resources)
+	}
+}
+
+func TestCheckpointOperationsEndpoint(t *testing.T) {
+	s := &Server{}
+	s.config.EnableCriuSupport = true
+	server := httptest.NewServer(s.GetExtendInterfaceMux(false))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + InspectCheckpointOperationsEndpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+	// The header is written once the watcher is registered.
+	op := s.startCheckpointOperation(context.Background(), "ctr", "/cp.tar")
+	op.finish(nil)
+
+	decoder := json.NewDecoder(resp.Body)
+	for _, expected := range []CheckpointOperationEventType{CheckpointOperationStarted, CheckpointOperationSucceeded} {
+		event := &CheckpointOperationEvent{}
+		if err := decoder.Decode(event); err != nil {
+			t.Fatal(err)
+		}
+		if event.Operation != op.id || event.Type != expected {
+			t.Fatalf("expected %s message of %s, got %+v", expected, op.id, event)
+		}
+	}
+}
+
+func TestCheckpointRestoreEndpoint(t *testing.T) {
+	s := &Server{}
+	for _, enabled := range []bool{false, true} {
+		s.config.EnableCriuSupport = enabled
+		recorder := httptest.NewRecorder()
+		s.GetExtendInterfaceMux(false).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, InspectCheckpointRestoreEndpoint, http.NoBody))
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", recorder.Code)
+		}
+		support := &CheckpointRestoreSupport{}
+		if err := json.Unmarshal(recorder.Body.Bytes(), support); err != nil {
+			t.Fatal(err)
+		}
+		if support.Enabled != enabled {
+			t.Fatalf("expected enabled %v, got %+v", enabled, support)
+		}
+	}
+
+	s.config.EnableCriuSupport = false
+	recorder := httptest.NewRecorder()
+	s.GetExtendInterfaceMux(false).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, InspectCheckpointJobsEndpoint+"/job", http.NoBody))
+	if recorder.Code != http.StatusNotImplemented {
+		t.Fatalf("expected status 501 without checkpoint/restore support, got %d", recorder.Code)
+	}
+}
@@ -84,6 +84,20 @@ type Metrics struct {
 	metricContainersOOMCountTotal             *prometheus.CounterVec
 	metricContainersSeccompNotifierCountTotal *prometheus.CounterVec
 	metricResourcesStalledAtStage             *prometheus.CounterVec
+	metricResourceWatchersAtPut               *prometheus.HistogramVec
+	metricResourceCleanupFailuresTotal        *prometheus.CounterVec
+	metricResourcesStored                     *prometheus.GaugeVec
+	metricResourcePutsTotal                   *prometheus.CounterVec
+	metricResourceGetsTotal                   *prometheus.CounterVec
+	metricResourceWatchersTotal               *prometheus.CounterVec
+	metricResourceStaleCleanupsTotal          *prometheus.CounterVec
+	metricResourceAgeAtGetSeconds             *prometheus.HistogramVec
+	metricResourceRejectionsTotal             *prometheus.CounterVec
+	metricResourceWatcherWaitSeconds          *prometheus.HistogramVec
+	metricResourceCleanupBacklog              *prometheus.GaugeVec
+	metricResourceRetrievalWaitSeconds        *prometheus.HistogramVec
+	metricCheckpointDirBytes                  prometheus.Gauge
+	metricResourceMaxLifetimeReapsTotal       *prometheus.CounterVec
 }
 
 var instance *Metrics
@@ -240,6 +254,121 @@ func New(config *libconfig.MetricsConfig) *Metrics {
 			},
 			[]string{"stage"},
 		),
+		metricResourceWatchersAtPut: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Subsystem: collectors.Subsystem,
+				Name:      collectors.ResourceWatchersAtPut.String(),
+				Help:      "Number of retried requests waiting for a pod, container or checkpoint when its creation finishes.",
+				Buckets:   []float64{0, 1, 2, 5, 10, 20, 50},
+			},
+			[]string{"store"},
+		),
+		metricResourceCleanupFailuresTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Subsystem: collectors.Subsystem,
+				Name:      collectors.ResourceCleanupFailuresTotal.String(),
+				Help:      "Amount of stale pods, containers or checkpoints whose cleanup failed after retrying.",
+			},
+			[]string{"store"},
+		),
+		metricResourcesStored: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Subsystem: collectors.Subsystem,
+				Name:      collectors.ResourcesStored.String(),
+				Help:      "Number of pods, containers or checkpoints kept in the resource store per namespace, split into put resources and placeholders of watchers.",
+			},
+			[]string{"store", "namespace", "kind"},
+		),
+		metricResourcePutsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Subsystem: collectors.Subsystem,
+				Name:      collectors.ResourcePutsTotal.String(),
+				Help:      "Amount of pods, containers or checkpoints put into the resource store.",
+			},
+			[]string{"store"},
+		),
+		metricResourceGetsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Subsystem: collectors.Subsystem,
+				Name:      collectors.ResourceGetsTotal.String(),
+				Help:      "Amount of lookups of pods, containers or checkpoints in the resource store by result.",
+			},
+			[]string{"store", "result"},
+		),
+		metricResourceWatchersTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Subsystem: collectors.Subsystem,
+				Name:      collectors.ResourceWatchersTotal.String(),
+				Help:      "Amount of retried requests waiting for a pod, container or checkpoint in the resource store.",
+			},
+			[]string{"store"},
+		),
+		metricResourceStaleCleanupsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Subsystem: collectors.Subsystem,
+				Name:      collectors.ResourceStaleCleanupsTotal.String(),
+				Help:      "Amount of cleanups of stale pods, containers or checkpoints in the resource store.",
+			},
+			[]string{"store"},
+		),
+		metricResourceAgeAtGetSeconds: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Subsystem: collectors.Subsystem,
+				Name:      collectors.ResourceAgeAtGetSeconds.String(),
+				Help:      "Time in seconds pods, containers or checkpoints spent in the resource store until retrieved.",
+				Buckets:   []float64{0.1, 0.5, 1, 5, 10, 30, 60, 120},
+			},
+			[]string{"store"},
+		),
+		metricResourceRejectionsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Subsystem: collectors.Subsystem,
+				Name:      collectors.ResourceRejectionsTotal.String(),
+				Help:      "Amount of pods, containers or checkpoints and placeholders of watchers not added to the full resource store.",
+			},
+			[]string{"store", "kind"},
+		),
+		metricResourceWatcherWaitSeconds: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Subsystem: collectors.Subsystem,
+				Name:      collectors.ResourceWatcherWaitSeconds.String(),
+				Help:      "Time in seconds retried requests waited for the creation of a pod, container or checkpoint until notified.",
+				Buckets:   []float64{0.1, 0.5, 1, 5, 10, 30, 60, 120, 240},
+			},
+			[]string{"store"},
+		),
+		metricResourceCleanupBacklog: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Subsystem: collectors.Subsystem,
+				Name:      collectors.ResourceCleanupBacklog.String(),
+				Help:      "Number of stale pods, containers or checkpoints whose cleanup has been deferred to the next cleanup cycle.",
+			},
+			[]string{"store"},
+		),
+		metricResourceRetrievalWaitSeconds: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Subsystem: collectors.Subsystem,
+				Name:      collectors.ResourceRetrievalWaitSeconds.String(),
+				Help:      "Time in seconds pods, containers or checkpoints waited in the resource store after their creation until retrieved, by whether they had been marked as stale.",
+				Buckets:   []float64{0.1, 0.5, 1, 5, 10, 30, 60, 120, 240, 480},
+			},
+			[]string{"store", "stale"},
+		),
+		metricCheckpointDirBytes: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Subsystem: collectors.Subsystem,
+				Name:      collectors.CheckpointDirBytes.String(),
+				Help:      "Size in bytes of the checkpoint archives in the checkpoint directory.",
+			},
+		),
+		metricResourceMaxLifetimeReapsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Subsystem: collectors.Subsystem,
+				Name:      collectors.ResourceMaxLifetimeReapsTotal.String(),
+				Help:      "Amount of pods, containers or checkpoints and placeholders of watchers reaped because they exceeded the max lifetime of the resource store.",
+			},
+			[]string{"store", "kind"},
+		),
 	}
 	return Instance()
 }
@@ -402,6 +531,127 @@ func (m *Metrics) MetricResourcesStalledAtStage(stage string) {
 	c.Inc()
 }
 
+func (m *Metrics) MetricResourceWatchersAtPut(store string, watchers int) {
+	h, err := m.metricResourceWatchersAtPut.GetMetricWithLabelValues(store)
+	if err != nil {
+		logrus.Warnf("Unable to write resource watchers at put metric: %v", err)
+		return
+	}
+	h.Observe(float64(watchers))
+}
+
+func (m *Metrics) MetricResourceCleanupFailuresInc(store string) {
+	c, err := m.metricResourceCleanupFailuresTotal.GetMetricWithLabelValues(store)
+	if err != nil {
+		logrus.Warnf("Unable to write resource cleanup failures metric: %v", err)
+		return
+	}
+	c.Inc()
+}
+
+func (m *Metrics) MetricResourcesStoredAdd(store, namespace, kind string, delta int) {
+	g, err := m.metricResourcesStored.GetMetricWithLabelValues(store, namespace, kind)
+	if err != nil {
+		logrus.Warnf("Unable to write resources stored metric: %v", err)
+		return
+	}
+	g.Add(float64(delta))
+}
+
+func (m *Metrics) MetricResourcePutsInc(store string) {
+	c, err := m.metricResourcePutsTotal.GetMetricWithLabelValues(store)
+	if err != nil {
+		logrus.Warnf("Unable to write resource puts metric: %v", err)
+		return
+	}
+	c.Inc()
+}
+
+func (m *Metrics) MetricResourceGetsInc(store, result string) {
+	c, err := m.metricResourceGetsTotal.GetMetricWithLabelValues(store, result)
+	if err != nil {
+		logrus.Warnf("Unable to write resource gets metric: %v", err)
+		return
+	}
+	c.Inc()
+}
+
+func (m *Metrics) MetricResourceWatchersInc(store string) {
+	c, err := m.metricResourceWatchersTotal.GetMetricWithLabelValues(store)
+	if err != nil {
+		logrus.Warnf("Unable to write resource watchers metric: %v", err)
+		return
+	}
+	c.Inc()
+}
+
+func (m *Metrics) MetricResourceStaleCleanupsInc(store string) {
+	c, err := m.metricResourceStaleCleanupsTotal.GetMetricWithLabelValues(store)
+	if err != nil {
+		logrus.Warnf("Unable to write resource stale cleanups metric: %v", err)
+		return
+	}
+	c.Inc()
+}
+
+func (m *Metrics) MetricResourceAgeAtGet(store string, age time.Duration) {
+	h, err := m.metricResourceAgeAtGetSeconds.GetMetricWithLabelValues(store)
+	if err != nil {
+		logrus.Warnf("Unable to write resource age at get metric: %v", err)
+		return
+	}
+	h.Observe(age.Seconds())
+}
+
+func (m *Metrics) MetricResourceRejectionsInc(store, kind string) {
+	c, err := m.metricResourceRejectionsTotal.GetMetricWithLabelValues(store, kind)
+	if err != nil {
+		logrus.Warnf("Unable to write resource rejections metric: %v", err)
+		return
+	}
+	c.Inc()
+}
+
+func (m *Metrics) MetricResourceWatcherWait(store string, wait time.Duration) {
+	h, err := m.metricResourceWatcherWaitSeconds.GetMetricWithLabelValues(store)
+	if err != nil {
+		logrus.Warnf("Unable to write resource watcher wait metric: %v", err)
+		return
+	}
+	h.Observe(wait.Seconds())
+}
+
+func (m *Metrics) MetricResourceCleanupBacklog(store string, deferred int) {
+	g, err := m.metricResourceCleanupBacklog.GetMetricWithLabelValues(store)
+	if err != nil {
+		logrus.Warnf("Unable to write resource cleanup backlog metric: %v", err)
+		return
+	}
+	g.Set(float64(deferred))
+}
+
+func (m *Metrics) MetricResourceRetrievalWait(store string, wait time.Duration, wasStale bool) {
+	h, err := m.metricResourceRetrievalWaitSeconds.GetMetricWithLabelValues(store, strconv.FormatBool(wasStale))
+	if err != nil {
+		logrus.Warnf("Unable to write resource retrieval wait metric: %v", err)
+		return
+	}
+	h.Observe(wait.Seconds())
+}
+
+func (m *Metrics) MetricCheckpointDirBytes(size int64) {
+	m.metricCheckpointDirBytes.Set(float64(size))
+}
+
+func (m *Metrics) MetricResourceMaxLifetimeReapsInc(store, kind string) {
+	c, err := m.metricResourceMaxLifetimeReapsTotal.GetMetricWithLabelValues(store, kind)
+	if err != nil {
+		logrus.Warnf("Unable to write resource max lifetime reaps metric: %v", err)
+		return
+	}
+	c.Inc()
+}
+
 // createEndpoint creates a /metrics endpoint for prometheus monitoring.
 func (m *Metrics) createEndpoint() (*http.ServeMux, error) {
 	for collector, metric := range map[collectors.Collector]prometheus.Collector{
@@ -421,6 +671,20 @@ func (m *Metrics) createEndpoint() (*http.ServeMux, error) {
 		collectors.OperationsTotal:                     m.metricOperationsTotal,
 		collectors.ProcessesDefunct:                    m.metricProcessesDefunct,
 		collectors.ResourcesStalledAtStage:             m.metricResourcesStalledAtStage,
+		collectors.ResourceWatchersAtPut:               m.metricResourceWatchersAtPut,
+		collectors.ResourceCleanupFailuresTotal:        m.metricResourceCleanupFailuresTotal,
+		collectors.ResourcesStored:                     m.metricResourcesStored,
+		collectors.ResourcePutsTotal:                   m.metricResourcePutsTotal,
+		collectors.ResourceGetsTotal:                   m.metricResourceGetsTotal,
+		collectors.ResourceWatchersTotal:               m.metricResourceWatchersTotal,
+		collectors.ResourceStaleCleanupsTotal:          m.metricResourceStaleCleanupsTotal,
+		collectors.ResourceAgeAtGetSeconds:             m.metricResourceAgeAtGetSeconds,
+		collectors.ResourceRejectionsTotal:             m.metricResourceRejectionsTotal,
+		collectors.ResourceWatcherWaitSeconds:          m.metricResourceWatcherWaitSeconds,
+		collectors.ResourceCleanupBacklog:              m.metricResourceCleanupBacklog,
+		collectors.ResourceRetrievalWaitSeconds:        m.metricResourceRetrievalWaitSeconds,
+		collectors.CheckpointDirBytes:                  m.metricCheckpointDirBytes,
+		collectors.ResourceMaxLifetimeReapsTotal:       m.metricResourceMaxLifetimeReapsTotal,
 	} {
 		if m.config.MetricsCollectors.Contains(collector) {
 			logrus.Debugf("Enabling metric: %s", collector.Stripped())
@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/cri-o/cri-o/internal/resourcestore"
+)
+
+// resourceStoreMetrics reports the instrumentation of a ResourceStore to the
+// current metrics instance, which may be replaced after the store has been
+// created. The metrics are labeled with the name of the store.
+type resourceStoreMetrics struct {
+	store string
+}
+
+// ResourceStore returns the metrics for the ResourceStore with the given name.
+func ResourceStore(store string) resourcestore.Metrics {
+	return resourceStoreMetrics{store: store}
+}
+
+func (r resourceStoreMetrics) ResourcesAdd(namespace, kind string, delta int) {
+	Instance().MetricResourcesStoredAdd(r.store, namespace, kind, delta)
+}
+
+func (r resourceStoreMetrics) PutInc() {
+	Instance().MetricResourcePutsInc(r.store)
+}
+
+func (r resourceStoreMetrics) GetInc(hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	Instance().MetricResourceGetsInc(r.store, result)
+}
+
+func (r resourceStoreMetrics) WatcherAddedInc() {
+	Instance().MetricResourceWatchersInc(r.store)
+}
+
+func (r resourceStoreMetrics) StaleCleanupInc() {
+	Instance().MetricResourceStaleCleanupsInc(r.store)
+}
+
+func (r resourceStoreMetrics) CleanupFailureInc() {
+	Instance().MetricResourceCleanupFailuresInc(r.store)
+}
+
+func (r resourceStoreMetrics) ResourceAgeAtGet(age time.Duration) {
+	Instance().MetricResourceAgeAtGet(r.store, age)
+}
+
+func (r resourceStoreMetrics) WatchersAtPut(watchers int) {
+	Instance().MetricResourceWatchersAtPut(r.store, watchers)
+}
+
+func (r resourceStoreMetrics) RejectionInc(kind string) {
+	Instance().MetricResourceRejectionsInc(r.store, kind)
+}
+
+func (r resourceStoreMetrics) WatcherWaitDuration(wait time.Duration) {
+	Instance().MetricResourceWatcherWait(r.store, wait)
+}
+
+func (r resourceStoreMetrics) CleanupBacklog(deferred int) {
+	Instance().MetricResourceCleanupBacklog(r.store, deferred)
+}
+
+func (r resourceStoreMetrics) RetrievalWait(wait time.Duration, wasStale bool) {
+	Instance().MetricResourceRetrievalWait(r.store, wait, wasStale)
+}
+
+func (r resourceStoreMetrics) MaxLifetimeReapInc(kind string) {
+	Instance().MetricResourceMaxLifetimeReapsInc(r.store, kind)
+}
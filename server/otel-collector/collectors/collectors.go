@@ -63,6 +63,48 @@ const (
 
 	// ResourcesStalledAtStage is the key for the resources stalled at different stages in container and pod creation.
 	ResourcesStalledAtStage Collector = crioPrefix + "resources_stalled_at_stage"
+
+	// ResourceWatchersAtPut is the key for the number of watchers waiting for a resource when its creation finishes.
+	ResourceWatchersAtPut Collector = crioPrefix + "resource_watchers_at_put"
+
+	// ResourceCleanupFailuresTotal is the key for the stale resources whose cleanup failed permanently.
+	ResourceCleanupFailuresTotal Collector = crioPrefix + "resource_cleanup_failures_total"
+
+	// ResourcesStored is the key for the pods, containers and checkpoints currently kept in the resource store.
+	ResourcesStored Collector = crioPrefix + "resources_stored"
+
+	// ResourcePutsTotal is the key for the resources put into the resource store.
+	ResourcePutsTotal Collector = crioPrefix + "resource_puts_total"
+
+	// ResourceGetsTotal is the key for the lookups of resources in the resource store.
+	ResourceGetsTotal Collector = crioPrefix + "resource_gets_total"
+
+	// ResourceWatchersTotal is the key for the watchers registered for resources in the resource store.
+	ResourceWatchersTotal Collector = crioPrefix + "resource_watchers_total"
+
+	// ResourceStaleCleanupsTotal is the key for the cleanups of stale resources in the resource store.
+	ResourceStaleCleanupsTotal Collector = crioPrefix + "resource_stale_cleanups_total"
+
+	// ResourceAgeAtGetSeconds is the key for the time resources spent in the resource store until retrieved.
+	ResourceAgeAtGetSeconds Collector = crioPrefix + "resource_age_at_get_seconds"
+
+	// ResourceRejectionsTotal is the key for the resources not added to the full resource store.
+	ResourceRejectionsTotal Collector = crioPrefix + "resource_rejections_total"
+
+	// ResourceWatcherWaitSeconds is the key for the time retried requests waited for the creation of a resource.
+	ResourceWatcherWaitSeconds Collector = crioPrefix + "resource_watcher_wait_seconds"
+
+	// ResourceCleanupBacklog is the key for the stale resources whose cleanup has been deferred to the next cycle.
+	ResourceCleanupBacklog Collector = crioPrefix + "resource_cleanup_backlog"
+
+	// ResourceRetrievalWaitSeconds is the key for the time resources waited in the resource store until retrieved, by whether they had been stale.
+	ResourceRetrievalWaitSeconds Collector = crioPrefix + "resource_retrieval_wait_seconds"
+
+	// CheckpointDirBytes is the key for the size of the checkpoint archives in the checkpoint directory.
+	CheckpointDirBytes Collector = crioPrefix + "checkpoint_dir_bytes"
+
+	// ResourceMaxLifetimeReapsTotal is the key for the entries of the resource store reaped because they exceeded its max lifetime.
+	ResourceMaxLifetimeReapsTotal Collector = crioPrefix + "resource_max_lifetime_reaps_total"
 )
 
 // FromSlice converts a string slice to a Collectors type.
@@ -101,6 +143,20 @@ func All() Collectors {
 		ContainersOOMCountTotal.Stripped(),
 		ContainersSeccompNotifierCountTotal.Stripped(),
 		ResourcesStalledAtStage.Stripped(),
+		ResourceWatchersAtPut.Stripped(),
+		ResourceCleanupFailuresTotal.Stripped(),
+		ResourcesStored.Stripped(),
+		ResourcePutsTotal.Stripped(),
+		ResourceGetsTotal.Stripped(),
+		ResourceWatchersTotal.Stripped(),
+		ResourceStaleCleanupsTotal.Stripped(),
+		ResourceAgeAtGetSeconds.Stripped(),
+		ResourceRejectionsTotal.Stripped(),
+		ResourceWatcherWaitSeconds.Stripped(),
+		ResourceCleanupBacklog.Stripped(),
+		ResourceRetrievalWaitSeconds.Stripped(),
+		CheckpointDirBytes.Stripped(),
+		ResourceMaxLifetimeReapsTotal.Stripped(),
 	}
 }
 
@@ -53,11 +53,25 @@ var _ = t.Describe("Collectors", func() {
 				collectors.ContainersOOMCountTotal,
 				collectors.ContainersSeccompNotifierCountTotal,
 				collectors.ResourcesStalledAtStage,
+				collectors.ResourceWatchersAtPut,
+				collectors.ResourceCleanupFailuresTotal,
+				collectors.ResourcesStored,
+				collectors.ResourcePutsTotal,
+				collectors.ResourceGetsTotal,
+				collectors.ResourceWatchersTotal,
+				collectors.ResourceStaleCleanupsTotal,
+				collectors.ResourceAgeAtGetSeconds,
+				collectors.ResourceRejectionsTotal,
+				collectors.ResourceWatcherWaitSeconds,
+				collectors.ResourceCleanupBacklog,
+				collectors.ResourceRetrievalWaitSeconds,
+				collectors.CheckpointDirBytes,
+				collectors.ResourceMaxLifetimeReapsTotal,
 			} {
 				Expect(all.Contains(collector)).To(BeTrue())
 			}
 
-			Expect(all).To(HaveLen(16))
+			Expect(all).To(HaveLen(30))
 		})
 	})
 
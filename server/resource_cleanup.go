@@ -0,0 +1,126 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	storageTypes "github.com/containers/storage/types"
+	types "k8s.io/cri-api/pkg/apis/runtime/v1"
+
+	"github.com/cri-o/cri-o/internal/config/nsmgr"
+	"github.com/cri-o/cri-o/internal/lib/sandbox"
+	"github.com/cri-o/cri-o/internal/log"
+	"github.com/cri-o/cri-o/internal/resourcestore"
+)
+
+const (
+	// cleanupManifestSandbox and cleanupManifestContainer are the types of
+	// the cleanup manifests persisted for sandboxes and containers kept in
+	// the ResourceStore.
+	cleanupManifestSandbox   = "sandbox"
+	cleanupManifestContainer = "container"
+
+	// cleanupManifestStagedCheckpoint is the type of the cleanup manifests
+	// of checkpoint archives staged ahead of their restore, whose directory
+	// is kept as cleanupManifestDir.
+	cleanupManifestStagedCheckpoint = "staged-checkpoint"
+	cleanupManifestDir              = "dir"
+
+	// cleanupManifestID is the key of the ID of the sandbox or container
+	// in the cleanup manifest.
+	cleanupManifestID = "id"
+
+	// cleanupManifestNamespaceSuffix is appended to the namespace type to
+	// build the key of its path in the cleanup manifest, like "netns".
+	cleanupManifestNamespaceSuffix = "ns"
+)
+
+// setSandboxCleanupManifest describes the sandbox for the cleanup manifest
+// of its cleaner, so that it can be cleaned up after a crash of CRI-O.
+func setSandboxCleanupManifest(cleaner *resourcestore.ResourceCleaner, sb *sandbox.Sandbox) {
+	ids := map[string]string{cleanupManifestID: sb.ID()}
+	for _, ns := range sb.ManagedNamespacePaths() {
+		ids[string(ns.Type())+cleanupManifestNamespaceSuffix] = ns.Path()
+	}
+	cleaner.SetManifest(cleanupManifestSandbox, ids)
+}
+
+// setContainerCleanupManifest describes the container with the given ID for
+// the cleanup manifest of its cleaner.
+func setContainerCleanupManifest(cleaner *resourcestore.ResourceCleaner, id string) {
+	cleaner.SetManifest(cleanupManifestContainer, map[string]string{cleanupManifestID: id})
+}
+
+// replayResourceCleanups cleans up the sandboxes and containers which have
+// been kept in the ResourceStore by a previous run of CRI-O which exited
+// before the kubelet retrieved them.
+func (s *Server) replayResourceCleanups(ctx context.Context) {
+	s.sandboxStore.RegisterCleanupHandler(cleanupManifestSandbox, s.cleanupLeftoverSandbox)
+	s.containerStore.RegisterCleanupHandler(cleanupManifestContainer, s.cleanupLeftoverContainer)
+	s.containerStore.RegisterCleanupHandler(cleanupManifestStagedCheckpoint, cleanupLeftoverStagedCheckpoint)
+	// Containers left over by a previous run are removed before their
+	// sandboxes.
+	s.containerStore.ReplayCleanupManifests(ctx)
+	s.sandboxStore.ReplayCleanupManifests(ctx)
+}
+
+// cleanupLeftoverSandbox removes the sandbox of the manifest. A sandbox
+// which has been restored is stopped and removed like any other, the
+// remains of one which could not be restored are removed directly.
+func (s *Server) cleanupLeftoverSandbox(ctx context.Context, manifest *resourcestore.CleanupManifest) error {
+	id := manifest.IDs[cleanupManifestID]
+	if sb := s.GetSandbox(id); sb != nil {
+		if err := s.stopPodSandbox(ctx, sb); err != nil {
+			return fmt.Errorf("stop pod sandbox %s: %w", id, err)
+		}
+		return s.removePodSandbox(ctx, sb)
+	}
+
+	var errs []error
+	for _, nsType := range []nsmgr.NSType{nsmgr.UTSNS, nsmgr.IPCNS, nsmgr.NETNS, nsmgr.USERNS} {
+		path := manifest.IDs[string(nsType)+cleanupManifestNamespaceSuffix]
+		if path == "" {
+			continue
+		}
+		ns, err := nsmgr.GetNamespace(path, nsType)
+		if err != nil {
+			// The namespace is gone already.
+			log.Debugf(ctx, "Unable to get %s namespace %s of sandbox %s: %v", nsType, path, id, err)
+			continue
+		}
+		if err := ns.Remove(); err != nil {
+			errs = append(errs, fmt.Errorf("remove %s namespace of sandbox %s: %w", nsType, id, err))
+		}
+	}
+	if err := s.Store().DeleteContainer(id); err != nil && !isUnknownStorageContainer(err) {
+		errs = append(errs, fmt.Errorf("delete sandbox %s from storage: %w", id, err))
+	}
+	return errors.Join(errs...)
+}
+
+// cleanupLeftoverContainer removes the container of the manifest.
+func (s *Server) cleanupLeftoverContainer(ctx context.Context, manifest *resourcestore.CleanupManifest) error {
+	id := manifest.IDs[cleanupManifestID]
+	if s.GetContainer(ctx, id) != nil {
+		_, err := s.RemoveContainer(ctx, &types.RemoveContainerRequest{ContainerId: id})
+		return err
+	}
+	if err := s.Store().DeleteContainer(id); err != nil && !isUnknownStorageContainer(err) {
+		return fmt.Errorf("delete container %s from storage: %w", id, err)
+	}
+	return nil
+}
+
+// cleanupLeftoverStagedCheckpoint removes the data of the staged checkpoint
+// archive of the manifest.
+func cleanupLeftoverStagedCheckpoint(_ context.Context, manifest *resourcestore.CleanupManifest) error {
+	return os.RemoveAll(manifest.IDs[cleanupManifestDir])
+}
+
+// isUnknownStorageContainer returns true if err reports that a container
+// does not exist in the storage.
+func isUnknownStorageContainer(err error) bool {
+	return errors.Is(err, storageTypes.ErrContainerUnknown) || errors.Is(err, storageTypes.ErrNotAContainer)
+}
@@ -6,6 +6,8 @@ import (
 
 	"golang.org/x/net/context"
 	types "k8s.io/cri-api/pkg/apis/runtime/v1"
+
+	"github.com/cri-o/cri-o/internal/lib"
 )
 
 // networkNotReadyReason is the reason reported when network is not ready.
@@ -77,6 +79,10 @@ func (s *Server) createRuntimeInfo() (map[string]string, error) {
 	config := map[string]interface{}{
 		"sandboxImage": s.config.ImageConfig.PauseImage,
 	}
+	if capabilities := s.config.CheckpointRestoreCapabilities(); capabilities != nil {
+		config["checkpointRestore"] = capabilities
+	}
+	config["checkpointSelfCheck"] = lib.CheckpointSelfCheck(&s.config)
 	bytes, err := json.Marshal(config)
 	if err != nil {
 		return nil, fmt.Errorf("marshal data: %w", err)
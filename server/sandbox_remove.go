@@ -9,6 +9,7 @@ import (
 
 	"github.com/cri-o/cri-o/internal/lib/sandbox"
 	"github.com/cri-o/cri-o/internal/log"
+	"github.com/cri-o/cri-o/internal/resourcestore"
 )
 
 // RemovePodSandbox deletes the sandbox. If there are any running containers in the
@@ -42,6 +43,12 @@ func (s *Server) RemovePodSandbox(ctx context.Context, req *types.RemovePodSandb
 func (s *Server) removePodSandbox(ctx context.Context, sb *sandbox.Sandbox) error {
 	ctx, span := log.StartSpan(ctx)
 	defer span.End()
+	// Clean up the containers whose creation timed out and which are only
+	// kept for a retry of the kubelet, and let retries still waiting for a
+	// container of the pod fail.
+	if err := s.containerStore.RemoveByLabel(resourcestore.DefaultNamespace, resourceLabelSandboxID, sb.ID()); err != nil {
+		log.Warnf(ctx, "Unable to clean up pending containers of pod sandbox %s: %v", sb.ID(), err)
+	}
 	containers := sb.Containers().List()
 
 	// Delete all the containers in the sandbox
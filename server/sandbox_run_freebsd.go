@@ -75,9 +75,9 @@ func (s *Server) runPodSandbox(ctx context.Context, req *types.RunPodSandboxRequ
 		if reservedSbox := s.GetSandbox(reservedID); reservedSbox != nil && reservedSbox.Created() {
 			return &types.RunPodSandboxResponse{PodSandboxId: reservedID}, nil
 		}
-		cachedID, resourceErr := s.getResourceOrWait(ctx, sbox.Name(), "sandbox")
+		cached, resourceErr := s.getResourceOrWait(ctx, s.sandboxStore, sbox.Name(), "sandbox")
 		if resourceErr == nil {
-			return &types.RunPodSandboxResponse{PodSandboxId: cachedID}, nil
+			return &types.RunPodSandboxResponse{PodSandboxId: cached.ID()}, nil
 		}
 		return nil, fmt.Errorf("%v: %w", resourceErr, err)
 	}
@@ -86,7 +86,14 @@ func (s *Server) runPodSandbox(ctx context.Context, req *types.RunPodSandboxRequ
 		return nil
 	})
 
-	s.resourceStore.SetStageForResource(ctx, sbox.Name(), "sandbox creating")
+	s.sandboxStore.SetStageForResource(ctx, resourcestore.DefaultNamespace, sbox.Name(), "sandbox creating")
+	s.sandboxStore.Claim(resourcestore.DefaultNamespace, sbox.Name())
+	defer func() {
+		// Let retried requests waiting for this creation fail with its cause.
+		if retErr != nil && !isContextError(retErr) {
+			s.sandboxStore.Fail(resourcestore.DefaultNamespace, sbox.Name(), retErr)
+		}
+	}()
 
 	var securityContext *types.LinuxSandboxSecurityContext
 	if sbox.Config().Linux != nil && sbox.Config().Linux.SecurityContext != nil {
@@ -110,7 +117,7 @@ func (s *Server) runPodSandbox(ctx context.Context, req *types.RunPodSandboxRequ
 		}
 		log.Infof(ctx, "CNI plugin is now ready. Continuing to create %s", sbox.Name())
 	}
-	s.resourceStore.SetStageForResource(ctx, sbox.Name(), "sandbox network ready")
+	s.sandboxStore.SetStageForResource(ctx, resourcestore.DefaultNamespace, sbox.Name(), "sandbox network ready")
 
 	// validate the runtime handler
 	runtimeHandler, err := s.runtimeHandler(req)
@@ -138,7 +145,7 @@ func (s *Server) runPodSandbox(ctx context.Context, req *types.RunPodSandboxRequ
 	var labelOptions []string
 	privileged := s.privilegedSandbox(req)
 
-	s.resourceStore.SetStageForResource(ctx, sbox.Name(), "sandbox storage creation")
+	s.sandboxStore.SetStageForResource(ctx, resourcestore.DefaultNamespace, sbox.Name(), "sandbox storage creation")
 	pauseImage, err := s.config.ParsePauseImage()
 	if err != nil {
 		return nil, err
@@ -234,7 +241,7 @@ func (s *Server) runPodSandbox(ctx context.Context, req *types.RunPodSandboxRequ
 	}
 	g := sbox.Spec()
 
-	s.resourceStore.SetStageForResource(ctx, sbox.Name(), "sandbox spec configuration")
+	s.sandboxStore.SetStageForResource(ctx, resourcestore.DefaultNamespace, sbox.Name(), "sandbox spec configuration")
 
 	if err := s.CtrIDIndex().Add(sbox.ID()); err != nil {
 		return nil, err
@@ -352,7 +359,7 @@ func (s *Server) runPodSandbox(ctx context.Context, req *types.RunPodSandboxRequ
 	sysctls := s.configureGeneratorForSysctls(ctx, g, hostNetwork, hostIPC, req.Config.Linux.Sysctls)
 
 	// set up namespaces
-	s.resourceStore.SetStageForResource(ctx, sbox.Name(), "sandbox namespace creation")
+	s.sandboxStore.SetStageForResource(ctx, resourcestore.DefaultNamespace, sbox.Name(), "sandbox namespace creation")
 	nsCleanupFuncs, err := s.configureGeneratorForSandboxNamespaces(ctx, hostNetwork, hostIPC, hostPID, sandboxIDMappings, sysctls, sb, g)
 	// We want to cleanup after ourselves if we are managing any namespaces and fail in this function.
 	// However, we don't immediately register this func with resourceCleaner because we need to pair the
@@ -372,7 +379,7 @@ func (s *Server) runPodSandbox(ctx context.Context, req *types.RunPodSandboxRequ
 		return nil, err
 	}
 
-	s.resourceStore.SetStageForResource(ctx, sbox.Name(), "sandbox storage start")
+	s.sandboxStore.SetStageForResource(ctx, resourcestore.DefaultNamespace, sbox.Name(), "sandbox storage start")
 
 	mountPoint, err := s.StorageRuntimeServer().StartContainer(sbox.ID())
 	if err != nil {
@@ -466,7 +473,7 @@ func (s *Server) runPodSandbox(ctx context.Context, req *types.RunPodSandboxRequ
 		return nil
 	})
 
-	s.resourceStore.SetStageForResource(ctx, sbox.Name(), "sandbox container runtime creation")
+	s.sandboxStore.SetStageForResource(ctx, resourcestore.DefaultNamespace, sbox.Name(), "sandbox container runtime creation")
 	if err := s.createContainerPlatform(ctx, container, sb.CgroupParent(), sandboxIDMappings); err != nil {
 		return nil, err
 	}
@@ -491,7 +498,7 @@ func (s *Server) runPodSandbox(ctx context.Context, req *types.RunPodSandboxRequ
 	var ips []string
 	var result cnitypes.Result
 
-	s.resourceStore.SetStageForResource(ctx, sbox.Name(), "sandbox network creation")
+	s.sandboxStore.SetStageForResource(ctx, resourcestore.DefaultNamespace, sbox.Name(), "sandbox network creation")
 	logrus.Debugf("Calling s.networkStart")
 	ips, result, err = s.networkStart(ctx, sb)
 	if err != nil {
@@ -539,7 +546,8 @@ func (s *Server) runPodSandbox(ctx context.Context, req *types.RunPodSandboxRequ
 	}
 
 	if isContextError(ctx.Err()) {
-		if err := s.resourceStore.Put(sbox.Name(), sb, resourceCleaner); err != nil {
+		setSandboxCleanupManifest(resourceCleaner, sb)
+		if err := s.sandboxStore.Put(resourcestore.DefaultNamespace, sbox.Name(), sb, resourceCleaner); err != nil {
 			log.Errorf(ctx, "RunSandbox: failed to save progress of sandbox %s: %v", sbox.ID(), err)
 		}
 		log.Infof(ctx, "RunSandbox: context was either canceled or the deadline was exceeded: %v", ctx.Err())
@@ -547,7 +555,7 @@ func (s *Server) runPodSandbox(ctx context.Context, req *types.RunPodSandboxRequ
 	}
 
 	// Since it's not a context error, we can delete the resource from the store, it will be tracked in the server from now on.
-	s.resourceStore.Delete(sbox.Name())
+	s.sandboxStore.Delete(resourcestore.DefaultNamespace, sbox.Name())
 
 	sb.SetCreated()
 	s.generateCRIEvent(ctx, sb.InfraContainer(), types.ContainerEventType_CONTAINER_STARTED_EVENT)
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
@@ -21,6 +22,11 @@ func (s *Server) PodSandboxStatus(ctx context.Context, req *types.PodSandboxStat
 	defer span.End()
 	sb, err := s.getPodSandboxFromRequest(ctx, req.PodSandboxId)
 	if err != nil {
+		if errors.Is(err, errSandboxNotCreated) {
+			if inProgressErr := s.sandboxCreationInProgressError(ctx, req.PodSandboxId); inProgressErr != nil {
+				return nil, inProgressErr
+			}
+		}
 		return nil, status.Errorf(codes.NotFound, "could not find pod %q: %v", req.PodSandboxId, err)
 	}
 
@@ -50,6 +50,21 @@ const (
 	irqBalanceConfigRestoreDisable = "disable"
 	debounceDuration               = 200 * time.Millisecond
 	defaultRegistriesConfDDir      = "/etc/containers/registries.conf.d"
+
+	// resourceStoreShutdownTimeout is the time given to the cleanup of the
+	// resources left in the ResourceStores on shutdown.
+	resourceStoreShutdownTimeout = 30 * time.Second
+
+	// sandboxStoreName and containerStoreName are the names of the
+	// ResourceStores of sandboxes and of containers and their checkpoints.
+	sandboxStoreName   = "sandbox"
+	containerStoreName = "container"
+
+	// sandboxStoreTimeout and containerStoreTimeout are the default
+	// staleness timeouts of the ResourceStores of sandboxes and of
+	// containers. Both keep the timeout of the former single store.
+	sandboxStoreTimeout   = time.Minute
+	containerStoreTimeout = time.Minute
 )
 
 var errSandboxNotCreated = errors.New("sandbox not created")
@@ -82,11 +97,34 @@ type Server struct {
 	// pullOperationsLock is used to synchronize pull operations.
 	pullOperationsLock sync.Mutex
 
-	resourceStore *resourcestore.ResourceStore
+	// sandboxStore and containerStore keep the sandboxes and containers
+	// whose creation timed out for a retry of the kubelet.
+	sandboxStore   *resourcestore.ResourceStore
+	containerStore *resourcestore.ResourceStore
 
 	seccompNotifierChan chan seccomp.Notification
 	seccompNotifiers    sync.Map
 
+	crashDumpWatchers  sync.Map
+	fatalSignalMonitor sync.Once
+
+	checkpointCancels sync.Map
+	checkpointSlots   sync.Map
+
+	// checkpointVerifySlots limits the number of checkpoint verifications
+	// running at the same time, see checkpoint_verify_max_concurrent.
+	checkpointVerifySlots chan struct{}
+
+	// checkpointJobs are the checkpoints submitted by SubmitCheckpoint.
+	checkpointJobs checkpointJobs
+
+	// checkpointBreakers reject the checkpoints of containers which failed
+	// repeatedly.
+	checkpointBreakers checkpointBreakers
+
+	// checkpointOperations are the watchers of WatchCheckpointOperations.
+	checkpointOperations checkpointOperationWatchers
+
 	containerEventClients           sync.Map
 	containerEventStreamBroadcaster sync.Once
 
@@ -310,6 +348,9 @@ func (s *Server) restore(ctx context.Context) []storage.StorageImageID {
 		sb.AddIPs(ips)
 	}
 
+	// Re-establish the crash dump watchers of running containers
+	s.startCrashDumpWatchers(ctx)
+
 	// Return a slice of images to remove, if internal_wipe is set.
 	imagesOfDeletedContainers := []storage.StorageImageID{}
 	for _, image := range containersAndTheirImages {
@@ -319,10 +360,58 @@ func (s *Server) restore(ctx context.Context) []storage.StorageImageID {
 	return imagesOfDeletedContainers
 }
 
+// newResourceStore creates the ResourceStore with the given name and
+// staleness timeout, or the default timeout if zero. Its cleanup manifests
+// are persisted in a subdirectory of the resource cleanup directory.
+func newResourceStore(config *libconfig.Config, name string, timeout time.Duration) *resourcestore.ResourceStore {
+	stateDir := config.ResourceCleanupDir
+	if stateDir != "" {
+		stateDir = filepath.Join(stateDir, name)
+	}
+	return resourcestore.NewNamed(name, resourcestore.Options{
+		Timeout:             timeout,
+		Metrics:             metrics.ResourceStore(name),
+		StateDir:            stateDir,
+		MaxCleanupsPerCycle: config.ResourceCleanupMaxPerCycle,
+		MaxLifetime:         time.Duration(config.ResourceStoreMaxLifetime) * time.Second,
+	})
+}
+
+// resourceStoreTimeout returns the staleness timeout of the resource stores
+// configured by resource_store_timeout, or defaultTimeout if it is not set.
+func resourceStoreTimeout(config *libconfig.Config, defaultTimeout time.Duration) time.Duration {
+	if config.ResourceStoreTimeout == 0 {
+		return defaultTimeout
+	}
+	return time.Duration(config.ResourceStoreTimeout) * time.Second
+}
+
+// setResourceStoreTimeouts applies the staleness timeout of the current
+// configuration to the resource stores, for example after a reload.
+func (s *Server) setResourceStoreTimeouts() {
+	s.sandboxStore.SetTimeout(resourceStoreTimeout(&s.config, sandboxStoreTimeout))
+	s.containerStore.SetTimeout(resourceStoreTimeout(&s.config, containerStoreTimeout))
+}
+
+// resourceStores returns the ResourceStores of the server.
+func (s *Server) resourceStores() []*resourcestore.ResourceStore {
+	return []*resourcestore.ResourceStore{s.sandboxStore, s.containerStore}
+}
+
 // Shutdown attempts to shut down the server's storage cleanly.
 func (s *Server) Shutdown(ctx context.Context) error {
+	// The kubelet will not retrieve the resources kept in the store from
+	// this run anymore. ctx may already be canceled on shutdown.
+	storeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), resourceStoreShutdownTimeout)
+	defer cancel()
+	// Like replayResourceCleanups, clean up the containers before the
+	// sandboxes they run in.
+	for _, store := range []*resourcestore.ResourceStore{s.containerStore, s.sandboxStore} {
+		if err := store.Shutdown(storeCtx); err != nil {
+			log.Warnf(ctx, "Unable to clean up the %s resource store on shutdown: %v", store.Name(), err)
+		}
+	}
 	s.config.CNIManagerShutdown()
-	s.resourceStore.Close()
 
 	if err := s.ContainerServer.Shutdown(); err != nil {
 		return err
@@ -448,7 +537,9 @@ func New(
 		minimumMappableUID:       config.MinimumMappableUID,
 		minimumMappableGID:       config.MinimumMappableGID,
 		pullOperationsInProgress: make(map[pullArguments]*pullOperation),
-		resourceStore:            resourcestore.New(),
+		sandboxStore:             newResourceStore(config, sandboxStoreName, resourceStoreTimeout(config, sandboxStoreTimeout)),
+		containerStore:           newResourceStore(config, containerStoreName, resourceStoreTimeout(config, containerStoreTimeout)),
+		checkpointVerifySlots:    make(chan struct{}, config.CheckpointVerifyMaxConcurrent),
 	}
 	if s.config.EnablePodEvents {
 		// creating a container events channel only if the evented pleg is enabled
@@ -472,6 +563,10 @@ func New(
 	deletedImages := s.restore(ctx)
 	s.wipeIfAppropriate(ctx, deletedImages)
 
+	// Clean up the resources a previous run kept for the kubelet, which
+	// will not retrieve them from this one.
+	go s.replayResourceCleanups(ctx)
+
 	var bindAddressStr string
 	bindAddress := net.ParseIP(config.StreamAddress)
 	if bindAddress != nil {
@@ -543,6 +638,8 @@ func New(
 		logrus.Debug("Metrics are disabled")
 	}
 
+	s.startCheckpointRetention(ctx)
+
 	if err := s.startSeccompNotifierWatcher(ctx); err != nil {
 		return nil, fmt.Errorf("start seccomp notifier watcher: %w", err)
 	}
@@ -575,7 +672,11 @@ func (s *Server) startReloadWatcher(ctx context.Context) {
 		for {
 			// Block until the signal is received
 			<-ch
-			if err := s.config.Reload(ctx); err != nil {
+			err := s.config.Reload(ctx)
+			// The timeout may have been reloaded before a later option
+			// failed to reload.
+			s.setResourceStoreTimeouts()
+			if err != nil {
 				logrus.Errorf("Unable to reload configuration: %v", err)
 				continue
 			}
@@ -15,10 +15,13 @@ import (
 	"github.com/containers/storage/pkg/mount"
 	v1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	types "k8s.io/cri-api/pkg/apis/runtime/v1"
 	kubeletTypes "k8s.io/kubelet/pkg/types"
 
 	"github.com/cri-o/cri-o/internal/log"
+	"github.com/cri-o/cri-o/internal/resourcestore"
 	"github.com/cri-o/cri-o/server/metrics"
 )
 
@@ -152,7 +155,53 @@ func isContextError(err error) bool {
 	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
 }
 
-func (s *Server) getResourceOrWait(ctx context.Context, name, resourceType string) (string, error) {
+// creationInProgressError returns a NotFound error explaining that the
+// creation of the resourceType with the given ID and name is still in
+// progress, or has finished but not been retrieved by a retried request
+// yet, if store holds an entry for it. It returns nil otherwise.
+func creationInProgressError(store *resourcestore.ResourceStore, resourceType, id, name string) error {
+	exists, created, age := store.PeekState(resourcestore.DefaultNamespace, name)
+	if !exists {
+		return nil
+	}
+	if created {
+		return status.Errorf(codes.NotFound, "%s %s (%s) has been created %v ago, but not retrieved by a retried request yet", resourceType, name, id, age.Round(time.Second))
+	}
+	return status.Errorf(codes.NotFound, "creation of %s %s (%s) in progress for %v", resourceType, name, id, age.Round(time.Second))
+}
+
+// sandboxCreationInProgressError returns the creationInProgressError of the
+// pod sandbox with the given full or partial ID, or nil if it is unknown.
+func (s *Server) sandboxCreationInProgressError(ctx context.Context, podSandboxID string) error {
+	sandboxID, err := s.PodIDIndex().Get(podSandboxID)
+	if err != nil {
+		return nil
+	}
+	sb := s.getSandbox(ctx, sandboxID)
+	if sb == nil {
+		return nil
+	}
+	return creationInProgressError(s.sandboxStore, "pod sandbox", sb.ID(), sb.Name())
+}
+
+// containerCreationInProgressError returns the creationInProgressError of
+// the container with the given full or partial ID, or nil if it is unknown.
+func (s *Server) containerCreationInProgressError(ctx context.Context, containerID string) error {
+	ctrID, err := s.CtrIDIndex().Get(containerID)
+	if err != nil {
+		return nil
+	}
+	ctr := s.GetContainer(ctx, ctrID)
+	if ctr == nil {
+		return nil
+	}
+	return creationInProgressError(s.containerStore, "container", ctr.ID(), ctr.Name())
+}
+
+// getResourceOrWait returns the resource of a previous request for name
+// which has been created in the meantime in store, or waits for its
+// creation to finish.
+func (s *Server) getResourceOrWait(ctx context.Context, store *resourcestore.ResourceStore, name, resourceType string) (resourcestore.IdentifiableCreatable, error) {
 	ctx, span := log.StartSpan(ctx)
 	defer span.End()
 
@@ -165,13 +214,22 @@ func (s *Server) getResourceOrWait(ctx context.Context, name, resourceType strin
 		resourceCreationWaitTime += time.Until(initialDeadline)
 	}
 
-	if cachedID := s.resourceStore.Get(name); cachedID != "" {
-		log.Infof(ctx, "Found %s %s with ID %s in resource cache; using it", resourceType, name, cachedID)
-		return cachedID, nil
-	}
-	watcher, stage := s.resourceStore.WatcherForResource(name)
-	if watcher == nil {
-		return "", fmt.Errorf("error attempting to watch for %s %s: no longer found", resourceType, name)
+	var (
+		watcher chan error
+		stage   string
+	)
+	// A nil watcher means that the creation finished after the lookup, the
+	// resource is then looked up again.
+	for watcher == nil {
+		if cached, _, ok := store.GetResource(resourcestore.DefaultNamespace, name); ok {
+			log.Infof(ctx, "Found %s %s with ID %s in resource cache; using it", resourceType, name, cached.ID())
+			return cached, nil
+		}
+		var err error
+		watcher, stage, err = store.WatcherForPendingResource(ctx, resourcestore.DefaultNamespace, name)
+		if err != nil {
+			return nil, fmt.Errorf("error attempting to watch for %s %s: %w", resourceType, name, err)
+		}
 	}
 	log.Infof(ctx, "Creation of %s %s not yet finished. Currently at stage %v. Waiting up to %v for it to finish", resourceType, name, stage, resourceCreationWaitTime)
 	metrics.Instance().MetricResourcesStalledAtStage(stage)
@@ -190,7 +248,11 @@ func (s *Server) getResourceOrWait(ctx context.Context, name, resourceType strin
 	// However, we don't know how long we've been making the kubelet wait for the request, and the request could time out
 	// after we stop paying attention. This would cause CRI-O to attempt to send back a resource that the kubelet
 	// will not receive, causing a resource leak.
-	case <-watcher:
+	case createErr := <-watcher:
+		if createErr != nil {
+			// The creation failed, there is nothing to wait for.
+			return nil, fmt.Errorf("creation of %s %s failed: %w", resourceType, name, createErr)
+		}
 		// We need to wait again here. If we error out to the Kubelet before it times out
 		// it will bump the attempt number, nulllifying all of the work we've done so far.
 		// Just the same as above, use resourceCreationWaitTime to make sure we catch cases where the context
@@ -202,7 +264,7 @@ func (s *Server) getResourceOrWait(ctx context.Context, name, resourceType strin
 		err = fmt.Errorf("the requested %s %s is now ready and will be provided to the kubelet on next retry", resourceType, name)
 	}
 
-	return "", fmt.Errorf("kubelet may be retrying requests that are timing out in CRI-O due to system load. Currently at stage %v: %w", stage, err)
+	return nil, fmt.Errorf("kubelet may be retrying requests that are timing out in CRI-O due to system load. Currently at stage %v: %w", stage, err)
 }
 
 // FilterDisallowedAnnotations is a common place to have a map of annotations filtered for both runtimes and workloads.
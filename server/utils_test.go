@@ -1,15 +1,23 @@
 package server
 
 import (
+	"context"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
+	"errors"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/containers/storage/pkg/mount"
 	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	types "k8s.io/cri-api/pkg/apis/runtime/v1"
+
+	"github.com/cri-o/cri-o/internal/resourcestore"
 )
 
 func TestMergeEnvs(t *testing.T) {
@@ -109,3 +117,51 @@ func TestGetSourceMount(t *testing.T) {
 		}
 	}
 }
+
+func TestGetResourceOrWaitFailedCreation(t *testing.T) {
+	s := &Server{sandboxStore: resourcestore.New()}
+	defer s.sandboxStore.Close()
+	s.sandboxStore.SetStageForResource(context.Background(), "", "pod", "sandbox creating")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	waitErr := make(chan error, 1)
+	go func() {
+		_, err := s.getResourceOrWait(ctx, s.sandboxStore, "pod", "sandbox")
+		waitErr <- err
+	}()
+
+	createErr := errors.New("network setup failed")
+	// Fail the creation once the retry is waiting for it.
+	for s.sandboxStore.WatcherCounts()["pod"] == 0 && ctx.Err() == nil {
+		time.Sleep(time.Millisecond)
+	}
+	s.sandboxStore.Fail("", "pod", createErr)
+
+	select {
+	case err := <-waitErr:
+		if !errors.Is(err, createErr) {
+			t.Fatalf("expected the cause of the failed creation, got %v", err)
+		}
+	case <-ctx.Done():
+		t.Fatal("retry kept waiting for a failed creation")
+	}
+}
+
+func TestCreationInProgressError(t *testing.T) {
+	store := resourcestore.New()
+	defer store.Close()
+
+	if err := creationInProgressError(store, "container", "id", "ctr"); err != nil {
+		t.Fatalf("expected no error for an unknown resource, got %v", err)
+	}
+
+	store.SetStageForResource(context.Background(), "", "ctr", "container creating")
+	err := creationInProgressError(store, "container", "id", "ctr")
+	if status.Code(err) != codes.NotFound || !strings.Contains(err.Error(), "in progress") {
+		t.Fatalf("expected a NotFound in progress error, got %v", err)
+	}
+	if exists, _, _ := store.PeekState("", "ctr"); !exists {
+		t.Fatal("expected the resource to be kept")
+	}
+}
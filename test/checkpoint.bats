@@ -10,6 +10,12 @@ function setup() {
 
 	has_criu
 	setup_test
+	cat << EOF > "$CRIO_CONFIG_DIR/01-checkpoint-location.conf"
+[crio.runtime]
+checkpoint_location_allowlist = [
+    "$TESTDIR",
+]
+EOF
 }
 
 function teardown() {
@@ -148,3 +154,36 @@ function teardown() {
 	[[ "$container_name" == "restored-sleep-container" ]]
 	[[ "$pod_name" == "restoresandbox2" ]]
 }
+
+@test "checkpoint and restore one container in a user namespace" {
+	create_workload_with_allowed_annotation "io.kubernetes.cri-o.userns-mode"
+	CONTAINER_ENABLE_CRIU_SUPPORT=true start_crio
+	USERNS_SANDBOX_JSON=$(mktemp)
+	jq '.annotations."io.kubernetes.cri-o.userns-mode" = "auto"' \
+		"$TESTDATA"/sandbox_config.json > "$USERNS_SANDBOX_JSON"
+	pod_id=$(crictl runp "$USERNS_SANDBOX_JSON")
+	ctr_id=$(crictl create "$pod_id" "$TESTDATA"/container_sleep.json "$USERNS_SANDBOX_JSON")
+	crictl start "$ctr_id"
+	# Change the root file system so that it ends up in the checkpoint.
+	crictl exec --sync "$ctr_id" sh -c 'touch /owned && chown 1234:1234 /owned'
+	crictl checkpoint --export="$TESTDIR"/cp.tar "$ctr_id"
+	crictl rm -f "$ctr_id"
+	crictl rmp -f "$pod_id"
+	pod_id=$(crictl runp "$USERNS_SANDBOX_JSON")
+	# Replace original container with checkpoint image
+	RESTORE_JSON=$(mktemp)
+	jq ".image.image=\"$TESTDIR/cp.tar\"" "$TESTDATA"/container_sleep.json > "$RESTORE_JSON"
+	ctr_id=$(crictl create "$pod_id" "$RESTORE_JSON" "$USERNS_SANDBOX_JSON")
+	rm -f "$RESTORE_JSON"
+	rm -f "$USERNS_SANDBOX_JSON"
+	crictl start "$ctr_id"
+	restored=$(crictl inspect --output go-template --template "{{(index .info.restored)}}" "$ctr_id")
+	[[ "$restored" == "true" ]]
+	# The owner inside the user namespace is preserved ...
+	[[ $(crictl exec --sync "$ctr_id" stat -c "%u:%g" /owned) == "1234:1234" ]]
+	# ... and maps to the host IDs of the restored container.
+	pid=$(crictl inspect "$ctr_id" | jq .info.pid)
+	host_uid=$(awk '$1 == 0 { print $2 }' /proc/"$pid"/uid_map)
+	host_gid=$(awk '$1 == 0 { print $2 }' /proc/"$pid"/gid_map)
+	[[ $(stat -c "%u:%g" /proc/"$pid"/root/owned) == "$((host_uid + 1234)):$((host_gid + 1234))" ]]
+}
@@ -74,6 +74,20 @@ func (mr *MockRuntimeImplMockRecorder) CheckpointContainer(arg0, arg1, arg2, arg
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CheckpointContainer", reflect.TypeOf((*MockRuntimeImpl)(nil).CheckpointContainer), arg0, arg1, arg2, arg3)
 }
 
+// CheckpointRestoreSupported mocks base method.
+func (m *MockRuntimeImpl) CheckpointRestoreSupported(arg0 *oci.Container) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CheckpointRestoreSupported", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CheckpointRestoreSupported indicates an expected call of CheckpointRestoreSupported.
+func (mr *MockRuntimeImplMockRecorder) CheckpointRestoreSupported(arg0 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CheckpointRestoreSupported", reflect.TypeOf((*MockRuntimeImpl)(nil).CheckpointRestoreSupported), arg0)
+}
+
 // ContainerStats mocks base method.
 func (m *MockRuntimeImpl) ContainerStats(arg0 context.Context, arg1 *oci.Container, arg2 string) (*cgmgr.CgroupStats, error) {
 	m.ctrl.T.Helper()
@@ -285,3 +299,17 @@ func (mr *MockRuntimeImplMockRecorder) UpdateContainerStatus(arg0, arg1 any) *go
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateContainerStatus", reflect.TypeOf((*MockRuntimeImpl)(nil).UpdateContainerStatus), arg0, arg1)
 }
+
+// VerifyRestore mocks base method.
+func (m *MockRuntimeImpl) VerifyRestore(arg0 context.Context, arg1 *oci.Container, arg2, arg3, arg4 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "VerifyRestore", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// VerifyRestore indicates an expected call of VerifyRestore.
+func (mr *MockRuntimeImplMockRecorder) VerifyRestore(arg0, arg1, arg2, arg3, arg4 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VerifyRestore", reflect.TypeOf((*MockRuntimeImpl)(nil).VerifyRestore), arg0, arg1, arg2, arg3, arg4)
+}